@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/runner"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	logger.Init()
+
+	if err := godotenv.Load(); err != nil {
+		logger.Warn("No .env file found, using system environment variables")
+	}
+
+	serverURL := os.Getenv("RUNNER_SERVER_URL")
+	if serverURL == "" {
+		serverURL = "http://localhost:8080"
+	}
+
+	// Register once with the instance token, then reuse RUNNER_TOKEN
+	token := os.Getenv("RUNNER_TOKEN")
+	if token == "" {
+		name := os.Getenv("RUNNER_NAME")
+		if name == "" {
+			name, _ = os.Hostname()
+		}
+		registered, err := runner.Register(serverURL, os.Getenv("RUNNER_REGISTRATION_TOKEN"), name)
+		if err != nil {
+			logger.Error("Failed to register runner: " + err.Error())
+			os.Exit(1)
+		}
+		token = registered
+		logger.Info("Set RUNNER_TOKEN=" + token + " to reuse this registration")
+	}
+
+	agent, err := runner.NewAgent(serverURL, token)
+	if err != nil {
+		logger.Error("Failed to create runner: " + err.Error())
+		os.Exit(1)
+	}
+
+	// Finish the current job's cleanup on SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	agent.Run(ctx)
+}
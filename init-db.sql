@@ -1,4 +1,5 @@
 -- PostgreSQL initialization script for CI/CD backend
+-- Les changements de tables sont à reporter dans internal/database/schema_sqlite.sql
 
 -- SonarQube database configuration
 CREATE USER sonar WITH PASSWORD 'sonar';
@@ -12,9 +13,69 @@ CREATE TABLE IF NOT EXISTS users (
     avatar_url TEXT,
     provider TEXT,
     provider_id TEXT,
+    password_hash TEXT, -- bcrypt, uniquement pour les comptes locaux (provider = 'local')
+    oauth_token TEXT,   -- Chiffré, token OAuth du fournisseur pour lister et importer les dépôts
+    email_verified BOOLEAN DEFAULT FALSE, -- Adresse confirmée par le fournisseur OAuth ou par le lien envoyé au compte local
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
+-- Table des demandes de réinitialisation de mot de passe (Comptes locaux)
+CREATE TABLE IF NOT EXISTS password_resets (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    token_hash TEXT UNIQUE NOT NULL, -- SHA-256 du token envoyé à l'utilisateur
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,               -- Un token ne sert qu'une fois
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Table des confirmations d'adresse email (Comptes locaux)
+CREATE TABLE IF NOT EXISTS email_verifications (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    token_hash TEXT UNIQUE NOT NULL, -- SHA-256 du token envoyé à l'utilisateur
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Table des organisations (Équipes possédant des projets)
+CREATE TABLE IF NOT EXISTS organizations (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    owner_id INTEGER REFERENCES users(id) ON DELETE SET NULL, -- Le créateur, NULL une fois son compte supprimé
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Table des membres d'organisation (Rôle appliqué à tous les projets de l'organisation)
+CREATE TABLE IF NOT EXISTS organization_members (
+    organization_id INTEGER REFERENCES organizations(id) ON DELETE CASCADE,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    role TEXT DEFAULT 'viewer', -- viewer, developer, maintainer, owner
+    joined_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (organization_id, user_id)
+);
+
+-- Table des équipes d'organisation (Rôle de l'équipe appliqué à tous les projets de l'organisation pour ses membres)
+CREATE TABLE IF NOT EXISTS organization_teams (
+    id SERIAL PRIMARY KEY,
+    organization_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    role TEXT DEFAULT 'viewer', -- viewer, developer, maintainer, owner
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (organization_id, name)
+);
+
+-- Table des membres d'équipe
+CREATE TABLE IF NOT EXISTS team_members (
+    team_id INTEGER REFERENCES organization_teams(id) ON DELETE CASCADE,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    joined_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (team_id, user_id)
+);
+
 -- Table des projets (Repositories)
 CREATE TABLE IF NOT EXISTS projects (
     id SERIAL PRIMARY KEY,
@@ -22,13 +83,36 @@ CREATE TABLE IF NOT EXISTS projects (
     name TEXT NOT NULL,
     repo_url TEXT NOT NULL UNIQUE,
     access_token TEXT NOT NULL,
+    deploy_key TEXT, -- Clé SSH privée de clonage générée par le moteur, chiffrée
+    deploy_key_public TEXT, -- Clé publique à ajouter au dépôt, vide = clonage HTTPS
+    badge_token TEXT, -- Jeton à passer au badge de statut, vide = badge désactivé
     pipeline_filename TEXT DEFAULT 'pipeline.yml',
     deployment_filename TEXT DEFAULT 'docker-compose.yml',
+    deployment_files TEXT[] DEFAULT '{}', -- Fichiers et dossiers du dépôt copiés avec le fichier compose
     ssh_host TEXT,
     ssh_user TEXT,
     ssh_private_key TEXT,
+    ssh_bastion_host TEXT, -- Hôte de rebond, vide = connexion directe
+    ssh_bastion_user TEXT, -- Vide = ssh_user
+    ssh_bastion_private_key TEXT, -- Chiffré, vide = ssh_private_key
     registry_user TEXT,
     registry_token TEXT,
+    registry_url TEXT, -- Registre des images (ghcr.io, registry.gitlab.com/groupe...), vide = Docker Hub
+    deployment_method TEXT DEFAULT 'script', -- script (deploy.sh copié) ou context (docker compose vers le moteur distant)
+    build_platforms TEXT[] DEFAULT '{}', -- Plateformes buildx (ex: linux/amd64, linux/arm64), vide = celle du moteur
+    image_tags TEXT[] DEFAULT '{}', -- Tags poussés en plus du commit: latest, branch, semver
+    job_executor TEXT DEFAULT 'docker', -- docker (conteneur par job) ou shell (scripts exécutés sur l'hôte)
+    branch_filters TEXT[] DEFAULT '{}', -- Glob patterns (ex: main, release/*), vide = toutes les branches
+    max_concurrent_pipelines INTEGER DEFAULT 0, -- 0 = illimité
+    pipeline_timeout_seconds INTEGER DEFAULT 0, -- Durée maximale d'exécution d'une pipeline, 0 = PIPELINE_TIMEOUT
+    retention_days INTEGER DEFAULT 0, -- Âge des pipelines terminées supprimées ou archivées, 0 = conservées
+    retention_action TEXT DEFAULT 'delete', -- delete (pipeline supprimée) ou archive (logs et artefacts supprimés)
+    auto_cancel_redundant BOOLEAN DEFAULT FALSE, -- Annule les pipelines obsolètes d'une même branche
+    allow_privileged BOOLEAN DEFAULT FALSE, -- Autorise les jobs privileged: true
+    slack_webhook_url TEXT, -- Chiffré
+    slack_events TEXT DEFAULT 'failed', -- failed, all ou deploy
+    github_installation_id BIGINT DEFAULT 0, -- Installation de la GitHub App, 0 = access_token
+    organization_id INTEGER REFERENCES organizations(id) ON DELETE SET NULL, -- NULL = projet personnel
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
@@ -39,15 +123,64 @@ CREATE TABLE IF NOT EXISTS variables (
     key TEXT NOT NULL,
     value TEXT NOT NULL,
     is_secret BOOLEAN DEFAULT FALSE,
+    environment_scope TEXT NOT NULL DEFAULT '*', -- Nom d'environnement, * = tous
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(project_id, key, environment_scope)
+);
+
+-- Table des environnements de déploiement (staging, production...)
+CREATE TABLE IF NOT EXISTS environments (
+    id SERIAL PRIMARY KEY,
+    project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    ssh_host TEXT, -- Vide = déploiement local
+    ssh_user TEXT,
+    ssh_private_key TEXT, -- Chiffré, vide = clé du projet
+    deployment_filename TEXT DEFAULT 'docker-compose.yml',
+    protected BOOLEAN DEFAULT FALSE, -- Seuls les maintainers peuvent y déployer manuellement
+    protected_branches TEXT[] DEFAULT '{}', -- Motifs des branches dont les pushs déploient sur un environnement protégé
+    deployment_strategy TEXT DEFAULT 'recreate', -- recreate ou canary
+    canary_replicas INTEGER DEFAULT 1, -- Répliques canary démarrées par service répliqué
+    canary_bake_seconds INTEGER DEFAULT 60, -- Durée d'observation des répliques canary
+    ssh_hosts TEXT[] DEFAULT '{}', -- Hôtes supplémentaires, mêmes utilisateur et clé que ssh_host
+    rollout_batch_size INTEGER DEFAULT 1, -- Hôtes déployés en même temps
+    pre_deploy TEXT[] DEFAULT '{}', -- Commandes exécutées sur chaque hôte avant le déploiement (migrations...)
+    proxy TEXT, -- traefik ou caddy, vide = pas de labels de reverse proxy
+    proxy_domain TEXT, -- Projet exposé sur <projet>.<domaine>
+    proxy_service TEXT, -- Vide = seul service ou premier service avec un port
+    proxy_port INTEGER DEFAULT 0, -- 0 = port lu dans le fichier compose
+    post_deploy TEXT[] DEFAULT '{}', -- Commandes exécutées après le déploiement (cache, reload nginx...)
+    preview BOOLEAN DEFAULT FALSE, -- Chaque branche est déployée dans son propre projet compose
+    current_pipeline_id INTEGER, -- Pipeline dont la version est en ligne
+    current_commit_hash TEXT,
+    current_branch TEXT,
+    current_images TEXT[] DEFAULT '{}', -- Images déployées (registry/projet-service:commit)
+    deployed_at TIMESTAMP,
+    stopped_at TIMESTAMP, -- Déploiement arrêté (compose down), NULL = en ligne
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    UNIQUE(project_id, key)
+    UNIQUE(project_id, name)
+);
+
+-- Table des environnements de preview (Une branche déployée dans un environnement preview)
+CREATE TABLE IF NOT EXISTS preview_environments (
+    id SERIAL PRIMARY KEY,
+    project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    environment TEXT NOT NULL,
+    branch TEXT NOT NULL,
+    compose_project TEXT NOT NULL, -- <dépôt>-<branche>, isole les conteneurs de la branche
+    url TEXT, -- Vide = pas de reverse proxy
+    pipeline_id INTEGER, -- Dernière pipeline déployée
+    commit_hash TEXT,
+    deployed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- Point de départ du PREVIEW_TTL
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(project_id, environment, branch)
 );
 
 -- Table des membres de projet (Collaborateurs)
 CREATE TABLE IF NOT EXISTS project_members (
     project_id INTEGER REFERENCES projects(id) ON DELETE CASCADE,
     user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
-    role TEXT DEFAULT 'viewer', -- viewer, editor
+    role TEXT DEFAULT 'viewer', -- viewer, developer, maintainer
     joined_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     PRIMARY KEY (project_id, user_id)
 );
@@ -56,11 +189,17 @@ CREATE TABLE IF NOT EXISTS project_members (
 CREATE TABLE IF NOT EXISTS pipelines (
     id SERIAL PRIMARY KEY,
     project_id INTEGER NOT NULL,
-    status TEXT DEFAULT 'pending', -- pending, running, success, failed, cancelled
+    status TEXT DEFAULT 'pending', -- pending, queued, running, manual, success, failed, cancelled, skipped
     commit_hash TEXT,              -- Le hash du commit qui a déclenché la pipeline
     branch TEXT,                   -- La branche concernée (ex: main)
+    tag TEXT,                      -- Le tag poussé, vide pour une branche
+    default_branch TEXT,           -- La branche par défaut du dépôt lors du push
+    changed_files TEXT[],          -- Les fichiers modifiés par le push, NULL = inconnus
+    failure_reason TEXT,           -- Cause de l'échec (clone, fichier CI invalide, ...)
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    started_at TIMESTAMP,          -- Passage au statut running, base du timeout de la pipeline
     finished_at TIMESTAMP,
+    archived_at TIMESTAMP,         -- Logs et artefacts supprimés par la politique de rétention
     FOREIGN KEY(project_id) REFERENCES projects(id) ON DELETE CASCADE
 );
 
@@ -71,22 +210,28 @@ CREATE TABLE IF NOT EXISTS jobs (
     name TEXT NOT NULL,            -- ex: build_job
     stage TEXT NOT NULL,           -- ex: build, test
     image TEXT NOT NULL,           -- ex: alpine:latest
-    status TEXT DEFAULT 'pending', -- pending, running, success, failed
+    status TEXT DEFAULT 'pending', -- pending, manual, running, success, failed, cancelled, skipped
     exit_code INTEGER,             -- Code de retour du conteneur (0 = succès)
     started_at TIMESTAMP,
     finished_at TIMESTAMP,
+    cpu_seconds DOUBLE PRECISION,  -- Ressources consommées par le conteneur, NULL si non mesurées
+    peak_memory_bytes BIGINT,
+    io_read_bytes BIGINT,
+    io_write_bytes BIGINT,
     FOREIGN KEY(pipeline_id) REFERENCES pipelines(id) ON DELETE CASCADE
 );
 
 CREATE TABLE deployments (
     id SERIAL PRIMARY KEY,
     pipeline_id INTEGER NOT NULL REFERENCES pipelines(id) ON DELETE CASCADE,
-    status VARCHAR(20) NOT NULL,       -- 'deploying', 'success', 'failed', 'rolled_back'
+    status VARCHAR(20) NOT NULL,       -- 'pending', 'deploying', 'success', 'failed', 'rolled_back', 'cancelled', 'stopped'
+    environment TEXT, -- NULL = paramètres de déploiement du projet
     started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     finished_at TIMESTAMP
 );
 
 -- Table des logs (Stockage unitaire ligne par ligne pour le streaming)
+-- Ancien stockage, une ligne par log, encore lu pour les jobs antérieurs à job_log_chunks
 CREATE TABLE IF NOT EXISTS job_logs (
     id SERIAL PRIMARY KEY,
     job_id INTEGER NOT NULL,
@@ -95,6 +240,48 @@ CREATE TABLE IF NOT EXISTS job_logs (
     FOREIGN KEY(job_id) REFERENCES jobs(id) ON DELETE CASCADE
 );
 
+-- Table des morceaux de logs (Un lot de lignes par insertion au lieu d'une ligne par insertion)
+CREATE TABLE IF NOT EXISTS job_log_chunks (
+    id SERIAL PRIMARY KEY,
+    job_id INTEGER NOT NULL,
+    content TEXT,                  -- Les lignes séparées par des retours à la ligne, NULL si stocké dans l'object storage
+    object_key TEXT,               -- Clé de l'objet dans le bucket (S3/MinIO)
+    line_count INTEGER NOT NULL,   -- Nombre de lignes, pour calculer les positions
+    byte_size INTEGER NOT NULL,
+    timestamped BOOLEAN NOT NULL DEFAULT FALSE, -- Chaque ligne est préfixée de son horodatage et de son flux (stdout, stderr, system)
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(job_id) REFERENCES jobs(id) ON DELETE CASCADE
+);
+
+-- Table des vulnérabilités (Trouvées par les jobs security-scan)
+CREATE TABLE IF NOT EXISTS vulnerabilities (
+    id SERIAL PRIMARY KEY,
+    job_id INTEGER NOT NULL,
+    target TEXT NOT NULL,          -- Image ou fichier analysé (ex: app:abc123 (alpine 3.19), go.sum)
+    vulnerability_id TEXT NOT NULL, -- ex: CVE-2024-1234
+    pkg_name TEXT NOT NULL,
+    installed_version TEXT,
+    fixed_version TEXT,            -- Vide = pas de correctif
+    severity TEXT NOT NULL,        -- UNKNOWN, LOW, MEDIUM, HIGH, CRITICAL
+    title TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(job_id) REFERENCES jobs(id) ON DELETE CASCADE
+);
+
+-- Table des artefacts (Fichiers produits par une pipeline, ex: SBOM des images construites)
+CREATE TABLE IF NOT EXISTS artifacts (
+    id SERIAL PRIMARY KEY,
+    pipeline_id INTEGER NOT NULL,
+    name TEXT NOT NULL,            -- ex: sbom-backend.cdx.json
+    kind TEXT NOT NULL,            -- sbom
+    content_type TEXT NOT NULL,
+    content BYTEA,                 -- NULL si stocké dans l'object storage
+    object_key TEXT,               -- Clé de l'objet dans le bucket (S3/MinIO)
+    byte_size INTEGER NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(pipeline_id) REFERENCES pipelines(id) ON DELETE CASCADE
+);
+
 CREATE TABLE IF NOT EXISTS deployment_logs (
     id SERIAL PRIMARY KEY,
     pipeline_id INTEGER NOT NULL,
@@ -103,15 +290,103 @@ CREATE TABLE IF NOT EXISTS deployment_logs (
     FOREIGN KEY(pipeline_id) REFERENCES pipelines(id) ON DELETE CASCADE
 );
 
+-- Table des runners (Agents exécutant les jobs sur d'autres machines)
+CREATE TABLE IF NOT EXISTS runners (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    token_hash TEXT UNIQUE NOT NULL, -- SHA-256 du token du runner, jamais stocké en clair
+    last_seen_at TIMESTAMP,          -- Dernière demande de job
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Table des webhooks sortants (Intégrations notifiées des événements du projet)
+CREATE TABLE IF NOT EXISTS webhooks (
+    id SERIAL PRIMARY KEY,
+    project_id INTEGER NOT NULL,
+    url TEXT NOT NULL,
+    secret TEXT,             -- Chiffré, signe le corps des requêtes (HMAC-SHA256)
+    events TEXT[] DEFAULT '{}', -- Événements envoyés, vide = tous
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(project_id) REFERENCES projects(id) ON DELETE CASCADE
+);
+
+-- Table des tokens d'accès personnels (Accès à l'API par les scripts et CLIs)
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    token_hash TEXT UNIQUE NOT NULL, -- SHA-256 du token, jamais stocké en clair
+    scopes TEXT[] DEFAULT '{read}',  -- read, write
+    expires_at TIMESTAMP,            -- NULL = n'expire jamais
+    last_used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Table des livraisons de webhooks reçues (Journal, rejeu et déduplication des renvois de GitHub)
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id SERIAL PRIMARY KEY,
+    delivery_id TEXT UNIQUE,      -- En-tête X-GitHub-Delivery, NULL pour les rejeux
+    event TEXT NOT NULL,
+    project_id INTEGER,           -- NULL si aucun projet ne correspond au dépôt
+    headers TEXT,                 -- En-têtes X-GitHub-*, Content-Type et User-Agent (JSON)
+    payload TEXT,
+    status VARCHAR(20) DEFAULT 'received', -- received, triggered, skipped, handled, ignored, failed
+    reason TEXT,                  -- Pourquoi aucun pipeline n'a été lancé
+    pipeline_id INTEGER,
+    replay_of INTEGER,            -- Livraison rejouée
+    received_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(project_id) REFERENCES projects(id) ON DELETE CASCADE,
+    FOREIGN KEY(pipeline_id) REFERENCES pipelines(id) ON DELETE SET NULL,
+    FOREIGN KEY(replay_of) REFERENCES webhook_deliveries(id) ON DELETE SET NULL
+);
+
+-- Table des clés d'idempotence (Déclenchements manuels rejoués par les clients)
+CREATE TABLE IF NOT EXISTS pipeline_idempotency_keys (
+    project_id INTEGER NOT NULL,
+    idempotency_key TEXT NOT NULL, -- En-tête Idempotency-Key
+    pipeline_id INTEGER,           -- NULL tant que la première requête est en cours
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (project_id, idempotency_key),
+    FOREIGN KEY(project_id) REFERENCES projects(id) ON DELETE CASCADE,
+    FOREIGN KEY(pipeline_id) REFERENCES pipelines(id) ON DELETE CASCADE
+);
+
+-- Table des modèles de projet (Fichier de pipeline, variables et environnements des nouveaux projets)
+CREATE TABLE IF NOT EXISTS project_templates (
+    id SERIAL PRIMARY KEY,
+    owner_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    organization_id INTEGER REFERENCES organizations(id) ON DELETE SET NULL, -- Partagé avec les membres, NULL = personnel
+    name TEXT NOT NULL,
+    description TEXT,
+    pipeline_filename TEXT DEFAULT 'pipeline.yml',
+    pipeline_content TEXT, -- Commité dans le dépôt des projets, vide = aucun
+    variables TEXT, -- JSON chiffré des variables créées sur les projets
+    environments TEXT, -- JSON des environnements créés sur les projets, sans clé SSH
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
 -- Index pour optimiser les requêtes fréquentes
 CREATE INDEX IF NOT EXISTS idx_projects_owner_id ON projects(owner_id);
 CREATE INDEX IF NOT EXISTS idx_variables_project_id ON variables(project_id);
+CREATE INDEX IF NOT EXISTS idx_environments_project_id ON environments(project_id);
+CREATE INDEX IF NOT EXISTS idx_preview_environments_project_id ON preview_environments(project_id);
+CREATE INDEX IF NOT EXISTS idx_webhooks_project_id ON webhooks(project_id);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_project_id ON webhook_deliveries(project_id);
+CREATE INDEX IF NOT EXISTS idx_project_templates_owner_id ON project_templates(owner_id);
+CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens(user_id);
 CREATE INDEX IF NOT EXISTS idx_project_members_user_id ON project_members(user_id);
+CREATE INDEX IF NOT EXISTS idx_organization_members_user_id ON organization_members(user_id);
+CREATE INDEX IF NOT EXISTS idx_team_members_user_id ON team_members(user_id);
+CREATE INDEX IF NOT EXISTS idx_projects_organization_id ON projects(organization_id);
 CREATE INDEX IF NOT EXISTS idx_pipelines_project_id ON pipelines(project_id);
 CREATE INDEX IF NOT EXISTS idx_pipelines_status ON pipelines(status);
 CREATE INDEX IF NOT EXISTS idx_jobs_pipeline_id ON jobs(pipeline_id);
 CREATE INDEX IF NOT EXISTS idx_jobs_status ON jobs(status);
 CREATE INDEX IF NOT EXISTS idx_logs_job_id ON job_logs(job_id);
 CREATE INDEX IF NOT EXISTS idx_logs_created_at ON job_logs(created_at);
+CREATE INDEX IF NOT EXISTS idx_log_chunks_job_id ON job_log_chunks(job_id);
+CREATE INDEX IF NOT EXISTS idx_vulnerabilities_job_id ON vulnerabilities(job_id);
+CREATE INDEX IF NOT EXISTS idx_artifacts_pipeline_id ON artifacts(pipeline_id);
 CREATE INDEX IF NOT EXISTS idx_deployments_pipeline_id ON deployments(pipeline_id);
 CREATE INDEX IF NOT EXISTS idx_deployment_logs_pipeline_id ON deployment_logs(pipeline_id);
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+)
+
+// handleArtifacts lists the artifacts of a pipeline, such as the SBOMs of the images its deployment built
+// GET /api/v1/projects/{projectId}/pipelines/{pipelineId}/artifacts
+func (s *Server) handleArtifacts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if s.db == nil {
+		respondError(w, http.StatusServiceUnavailable, "Database not available")
+		return
+	}
+
+	projectID, err := parseIDFromPath(r.URL.Path, 3)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid project ID")
+		return
+	}
+	pipelineID, err := parseIDFromPath(r.URL.Path, 5)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid pipeline ID")
+		return
+	}
+
+	pipeline, err := s.db.GetPipeline(r.Context(), pipelineID)
+	if err != nil || pipeline.ProjectID != projectID {
+		respondError(w, http.StatusNotFound, "Pipeline not found")
+		return
+	}
+	artifacts, err := s.db.GetArtifactsByPipeline(r.Context(), pipelineID)
+	if err != nil {
+		logger.Error("Failed to get artifacts: " + err.Error())
+		respondError(w, http.StatusInternalServerError, "Failed to get artifacts")
+		return
+	}
+	if artifacts == nil {
+		artifacts = []models.Artifact{}
+	}
+	respondJSON(w, http.StatusOK, artifacts)
+}
+
+// handleArtifact downloads an artifact of a pipeline
+// GET /api/v1/projects/{projectId}/pipelines/{pipelineId}/artifacts/{artifactId}
+func (s *Server) handleArtifact(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if s.db == nil {
+		respondError(w, http.StatusServiceUnavailable, "Database not available")
+		return
+	}
+
+	projectID, err := parseIDFromPath(r.URL.Path, 3)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid project ID")
+		return
+	}
+	pipelineID, err := parseIDFromPath(r.URL.Path, 5)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid pipeline ID")
+		return
+	}
+	artifactID, err := parseIDFromPath(r.URL.Path, 7)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid artifact ID")
+		return
+	}
+
+	pipeline, err := s.db.GetPipeline(r.Context(), pipelineID)
+	if err != nil || pipeline.ProjectID != projectID {
+		respondError(w, http.StatusNotFound, "Pipeline not found")
+		return
+	}
+	artifact, content, err := s.db.GetArtifactContent(r.Context(), pipelineID, artifactID)
+	if err != nil {
+		if err.Error() == "artifact not found" {
+			respondError(w, http.StatusNotFound, "Artifact not found")
+			return
+		}
+		logger.Error("Failed to get artifact: " + err.Error())
+		respondError(w, http.StatusInternalServerError, "Failed to get artifact")
+		return
+	}
+
+	w.Header().Set("Content-Type", artifact.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, artifact.Name))
+	w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+	w.Write(content)
+}
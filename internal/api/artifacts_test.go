@@ -0,0 +1,46 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+)
+
+func TestArtifacts(t *testing.T) {
+	ctx := context.Background()
+	s, st := newTestServer()
+	ownerID := createTestUser(t, st, "owner@example.com")
+
+	project, err := st.CreateProject(ctx, &models.NewProject{OwnerID: ownerID, Name: "app", RepoURL: "https://example.com/app.git"})
+	if err != nil {
+		t.Fatalf("Expected no error creating project, got %v", err)
+	}
+	pipeline, _ := st.CreatePipeline(ctx, project.ID, "main", "abc123")
+	sbom := &models.Artifact{PipelineID: pipeline.ID, Name: "sbom-backend.cdx.json", Kind: models.ArtifactKindSBOM, ContentType: "application/vnd.cyclonedx+json"}
+	if err := st.CreateArtifact(ctx, sbom, []byte(`{"bomFormat":"CycloneDX"}`)); err != nil {
+		t.Fatalf("Expected no error creating artifact, got %v", err)
+	}
+	base := strconv.Itoa(project.ID) + "/pipelines/" + strconv.Itoa(pipeline.ID) + "/artifacts"
+
+	t.Run("Download", func(t *testing.T) {
+		w := serveProject(s, http.MethodGet, base+"/"+strconv.Itoa(sbom.ID), ownerID)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", w.Code)
+		}
+		if got := w.Header().Get("Content-Disposition"); got != `attachment; filename="sbom-backend.cdx.json"` {
+			t.Errorf("Expected the artifact name as filename, got %q", got)
+		}
+		if w.Body.String() != `{"bomFormat":"CycloneDX"}` {
+			t.Errorf("Expected the SBOM content, got %q", w.Body.String())
+		}
+	})
+
+	t.Run("Unknown", func(t *testing.T) {
+		if w := serveProject(s, http.MethodGet, base+"/999", ownerID); w.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404, got %d", w.Code)
+		}
+	})
+}
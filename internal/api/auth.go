@@ -10,6 +10,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"slices"
 	"strings"
 	"time"
 
@@ -26,8 +27,24 @@ var (
 
 	googleOauthConfig *oauth2.Config
 	githubOauthConfig *oauth2.Config
+	gitlabOauthConfig *oauth2.Config
 )
 
+// repoAccessScopes are the scopes a login with ?access=repos adds, to import repositories and register their push webhook
+// They are only asked for then, other logins getting a token limited to the profile of the user.
+var repoAccessScopes = map[string][]string{
+	"github": {"repo", "admin:repo_hook"},
+	"gitlab": {"api"},
+}
+
+// gitLabBaseURL returns the URL of the GitLab instance users log in with, gitlab.com unless GITLAB_URL is set
+func gitLabBaseURL() string {
+	if baseURL := strings.TrimRight(os.Getenv("GITLAB_URL"), "/"); baseURL != "" {
+		return baseURL
+	}
+	return "https://gitlab.com"
+}
+
 // InitializeOAuth configures the OAuth providers
 func InitializeOAuth() {
 	if len(jwtSecret) == 0 {
@@ -50,6 +67,17 @@ func InitializeOAuth() {
 		Scopes:       []string{"user:email", "read:user"},
 		Endpoint:     github.Endpoint,
 	}
+
+	gitlabOauthConfig = &oauth2.Config{
+		RedirectURL:  os.Getenv("API_URL") + "/auth/gitlab/callback",
+		ClientID:     os.Getenv("GITLAB_CLIENT_ID"),
+		ClientSecret: os.Getenv("GITLAB_CLIENT_SECRET"),
+		Scopes:       []string{"read_user", "read_repository"},
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  gitLabBaseURL() + "/oauth/authorize",
+			TokenURL: gitLabBaseURL() + "/oauth/token",
+		},
+	}
 }
 
 // UserClaims represents the JWT claims
@@ -77,6 +105,8 @@ func (s *Server) handleAuthLogin(w http.ResponseWriter, r *http.Request) {
 		config = googleOauthConfig
 	case "github":
 		config = githubOauthConfig
+	case "gitlab":
+		config = gitlabOauthConfig
 	default:
 		http.Error(w, "Unsupported provider", http.StatusBadRequest)
 		return
@@ -96,6 +126,16 @@ func (s *Server) handleAuthLogin(w http.ResponseWriter, r *http.Request) {
 		Path:     "/",
 	})
 
+	// The provider token is only kept by the callback of a login asking for repository access
+	access := &http.Cookie{Name: "oauthaccess", Path: "/", HttpOnly: true, MaxAge: -1}
+	if scopes, ok := repoAccessScopes[provider]; ok && r.URL.Query().Get("access") == "repos" {
+		repoConfig := *config
+		repoConfig.Scopes = append(slices.Clone(config.Scopes), scopes...)
+		config = &repoConfig
+		access.Value, access.MaxAge = "repos", 600
+	}
+	http.SetCookie(w, access)
+
 	url := config.AuthCodeURL(state)
 	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
 }
@@ -129,6 +169,8 @@ func (s *Server) handleAuthCallback(w http.ResponseWriter, r *http.Request) {
 		config = googleOauthConfig
 	case "github":
 		config = githubOauthConfig
+	case "gitlab":
+		config = gitlabOauthConfig
 	default:
 		http.Error(w, "Unsupported provider", http.StatusBadRequest)
 		return
@@ -148,7 +190,7 @@ func (s *Server) handleAuthCallback(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Save/Update user in DB
-	err = s.db.CreateUser(userInfo)
+	err = s.db.CreateUser(r.Context(), userInfo)
 	if err != nil {
 		log.Printf("Failed to save user: %v", err)
 		http.Error(w, "Database error", http.StatusInternalServerError)
@@ -156,13 +198,20 @@ func (s *Server) handleAuthCallback(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Retrieve full user (with ID)
-	dbUser, err := s.db.GetUserByEmail(userInfo.Email)
+	dbUser, err := s.db.GetUserByEmail(r.Context(), userInfo.Email)
 	if err != nil {
 		log.Printf("Failed to retrieve user: %v", err)
 		http.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
 
+	// The provider token is kept to list and import the repositories of the user when they granted access to them
+	if access, err := r.Cookie("oauthaccess"); err == nil && access.Value == "repos" {
+		if err := s.db.SetUserOAuthToken(r.Context(), dbUser.ID, token.AccessToken); err != nil {
+			log.Printf("Failed to save oauth token: %v", err)
+		}
+	}
+
 	// Create JWT
 	jwtToken, err := createToken(dbUser)
 	if err != nil {
@@ -186,6 +235,10 @@ func getUserInfo(provider, accessToken string) (*models.User, error) {
 		req, err = http.NewRequest("GET", "https://www.googleapis.com/oauth2/v2/userinfo", nil)
 	} else if provider == "github" {
 		req, err = http.NewRequest("GET", "https://api.github.com/user", nil)
+	} else if provider == "gitlab" {
+		req, err = http.NewRequest("GET", gitLabBaseURL()+"/api/v4/user", nil)
+	} else {
+		return nil, fmt.Errorf("unsupported provider: %s", provider)
 	}
 
 	if err != nil {
@@ -245,6 +298,32 @@ func getUserInfo(provider, accessToken string) (*models.User, error) {
 			user.Name = githubUser.Login
 		}
 		user.AvatarURL = githubUser.AvatarURL
+	} else if provider == "gitlab" {
+		var gitlabUser struct {
+			ID          int    `json:"id"`
+			Username    string `json:"username"`
+			Name        string `json:"name"`
+			Email       string `json:"email"`
+			PublicEmail string `json:"public_email"`
+			AvatarURL   string `json:"avatar_url"`
+		}
+		if err := json.Unmarshal(body, &gitlabUser); err != nil {
+			return nil, err
+		}
+		user.ProviderID = fmt.Sprintf("%d", gitlabUser.ID)
+		// The primary email is returned with the read_user scope, the public one is the fallback
+		user.Email = gitlabUser.Email
+		if user.Email == "" {
+			user.Email = gitlabUser.PublicEmail
+		}
+		if user.Email == "" {
+			return nil, fmt.Errorf("GitLab account %s has no email", gitlabUser.Username)
+		}
+		user.Name = gitlabUser.Name
+		if user.Name == "" {
+			user.Name = gitlabUser.Username
+		}
+		user.AvatarURL = gitlabUser.AvatarURL
 	}
 
 	return user, nil
@@ -267,7 +346,26 @@ func createToken(user *models.User) (string, error) {
 	return token.SignedString(jwtSecret)
 }
 
-// AuthMiddleware validates the JWT token
+// parseToken validates a JWT and returns its claims
+func parseToken(tokenString string) (*UserClaims, error) {
+	claims := &UserClaims{}
+
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return jwtSecret, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, fmt.Errorf("invalid token")
+	}
+	return claims, nil
+}
+
+// AuthMiddleware validates the JWT token, or the personal access token of a script
 func (s *Server) AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
@@ -282,17 +380,18 @@ func (s *Server) AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		tokenString := parts[1]
-		claims := &UserClaims{}
-
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		if strings.HasPrefix(parts[1], apiTokenPrefix) {
+			ctx, status, message := s.authenticateAPIToken(r, parts[1])
+			if ctx == nil {
+				http.Error(w, message, status)
+				return
 			}
-			return jwtSecret, nil
-		})
+			next(w, r.WithContext(ctx))
+			return
+		}
 
-		if err != nil || !token.Valid {
+		claims, err := parseToken(parts[1])
+		if err != nil {
 			http.Error(w, "Invalid token", http.StatusUnauthorized)
 			return
 		}
@@ -0,0 +1,206 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/secrets"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+)
+
+// Project roles, from the least to the most privileged
+// The owner is not a member: it holds every permission of its project.
+const (
+	RoleViewer     = "viewer"
+	RoleDeveloper  = "developer"
+	RoleMaintainer = "maintainer"
+	RoleOwner      = "owner"
+)
+
+// roleRanks orders the roles, "editor" being the developer role of older databases
+var roleRanks = map[string]int{
+	RoleViewer:     1,
+	"editor":       2,
+	RoleDeveloper:  2,
+	RoleMaintainer: 3,
+	RoleOwner:      4,
+}
+
+// Actions on a project, each requiring a minimum role
+const (
+	// ActionRead reads the project, its pipelines, jobs, logs, deployments and members, secrets masked
+	ActionRead = "read"
+	// ActionTrigger starts, cancels and retries pipelines and plays manual jobs
+	ActionTrigger = "trigger"
+	// ActionManage edits the project settings, variables, members and webhooks
+	ActionManage = "manage"
+	// ActionAdmin deletes the project, transfers it and moves it between organizations
+	ActionAdmin = "admin"
+)
+
+var actionRoles = map[string]string{
+	ActionRead:    RoleViewer,
+	ActionTrigger: RoleDeveloper,
+	ActionManage:  RoleMaintainer,
+	ActionAdmin:   RoleOwner,
+}
+
+// validMemberRole reports whether a role can be given to a member
+func validMemberRole(role string) bool {
+	return role == RoleViewer || role == RoleDeveloper || role == RoleMaintainer
+}
+
+// roleAllows reports whether a role may perform an action
+func roleAllows(role, action string) bool {
+	return roleRanks[role] > 0 && roleRanks[role] >= roleRanks[actionRoles[action]]
+}
+
+// projectAction returns the action of a request under /api/v1/projects/{id}, parts being the path after /api/v1/projects/
+func projectAction(parts []string, method string) string {
+	if len(parts) == 1 {
+		switch method {
+		case http.MethodGet:
+			return ActionRead
+		case http.MethodDelete:
+			return ActionAdmin
+		default:
+			return ActionManage
+		}
+	}
+
+	switch parts[1] {
+	case "organization", "transfer":
+		return ActionAdmin
+	case "webhooks":
+		// Webhook URLs may embed credentials, they are not shown to every member
+		return ActionManage
+	case "webhook-deliveries":
+		// Replaying a delivery builds its push again
+		return ActionManage
+	case "retention":
+		// Applying the policy deletes history, previewing it is part of the project settings
+		return ActionManage
+	case "ssh":
+		// The test connects from the server to the host of the project settings
+		return ActionManage
+	case "pipelines":
+		// A debug shell runs arbitrary commands next to the job secrets
+		if len(parts) == 6 && parts[5] == "debug" {
+			return ActionManage
+		}
+	case "members", "variables", "environments", "previews", "deploy-key", "badge-token":
+		if method == http.MethodGet {
+			return ActionRead
+		}
+		return ActionManage
+	}
+	if method == http.MethodGet {
+		return ActionRead
+	}
+	return ActionTrigger
+}
+
+// projectRole returns the role of a user in a project, empty when the user has no access
+// Members of the project's organization get their organization role when it is higher than their project one.
+func (s *Server) projectRole(ctx context.Context, project *models.Project, userID int) (string, error) {
+	if project.OwnerID == userID {
+		return RoleOwner, nil
+	}
+	role, err := s.db.GetProjectMemberRole(ctx, project.ID, userID)
+	if err != nil {
+		return "", err
+	}
+	if project.OrganizationID != nil {
+		organizationRole, err := s.db.GetOrganizationMemberRole(ctx, *project.OrganizationID, userID)
+		if err != nil {
+			return "", err
+		}
+		if roleRanks[organizationRole] > roleRanks[role] {
+			role = organizationRole
+		}
+	}
+	return role, nil
+}
+
+// authorize responds with an error unless the user of the request may perform action on the project
+// Projects the user cannot read are reported as not found.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, projectIDPart, action string) bool {
+	if s.db == nil {
+		respondError(w, http.StatusServiceUnavailable, "Database not available")
+		return false
+	}
+	projectID, err := strconv.Atoi(projectIDPart)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid project ID")
+		return false
+	}
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return false
+	}
+
+	project, err := s.db.GetProject(r.Context(), projectID)
+	if errors.Is(err, secrets.ErrKeyMismatch) {
+		logger.Error(err.Error())
+		respondError(w, http.StatusInternalServerError, keyMismatchReason)
+		return false
+	}
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Project not found")
+		return false
+	}
+	role, err := s.projectRole(r.Context(), project, userID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to check permissions")
+		return false
+	}
+	if !roleAllows(role, ActionRead) {
+		respondError(w, http.StatusNotFound, "Project not found")
+		return false
+	}
+	if !roleAllows(role, action) {
+		respondError(w, http.StatusForbidden, "Your role ("+role+") does not allow this action")
+		return false
+	}
+	return true
+}
+
+// authorizeInstanceAdmin checks that the user of the request administers the instance, its email being listed in ADMIN_EMAILS
+// It responds with an error and returns false otherwise.
+func (s *Server) authorizeInstanceAdmin(w http.ResponseWriter, r *http.Request) bool {
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return false
+	}
+	user, err := s.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return false
+	}
+	for _, email := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		if email = strings.TrimSpace(email); email != "" && strings.EqualFold(email, user.Email) {
+			return true
+		}
+	}
+	respondError(w, http.StatusForbidden, "Only administrators of the instance can perform this action")
+	return false
+}
+
+// maskProjectSecrets hides the credentials of a project from members who cannot manage it
+func maskProjectSecrets(project *models.Project, role string) {
+	if roleAllows(role, ActionManage) {
+		return
+	}
+	for _, secret := range []*string{&project.AccessToken, &project.SSHPrivateKey, &project.SSHBastionPrivateKey, &project.RegistryToken, &project.SlackWebhookURL} {
+		if *secret != "" {
+			*secret = "*****"
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/store/memstore"
+)
+
+// newTestServer creates a server backed by an in-memory store, without Docker
+func newTestServer() (*Server, *memstore.Store) {
+	st := memstore.New()
+	return &Server{db: st, ctx: context.Background(), runs: make(map[int]*trackedRun)}, st
+}
+
+// createTestUser stores a user and returns its ID
+func createTestUser(t *testing.T, st *memstore.Store, email string) int {
+	t.Helper()
+	u := &models.User{Email: email, Name: email}
+	if err := st.CreateUser(context.Background(), u); err != nil {
+		t.Fatalf("Expected no error creating user, got %v", err)
+	}
+	return u.ID
+}
+
+// serveProject sends a request under /api/v1/projects/ as the given user
+func serveProject(s *Server, method, path string, userID int) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, "/api/v1/projects/"+path, nil)
+	r = r.WithContext(context.WithValue(r.Context(), "userID", userID))
+	w := httptest.NewRecorder()
+	s.routeProjectsSubpath(w, r)
+	return w
+}
+
+// postProject sends a POST request with a JSON body under /api/v1/projects/ as the given user
+func postProject(s *Server, path, body string, userID int) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/projects/"+path, strings.NewReader(body))
+	r = r.WithContext(context.WithValue(r.Context(), "userID", userID))
+	w := httptest.NewRecorder()
+	s.routeProjectsSubpath(w, r)
+	return w
+}
+
+func TestAuthorize(t *testing.T) {
+	ctx := context.Background()
+	s, st := newTestServer()
+	ownerID := createTestUser(t, st, "owner@example.com")
+	viewerID := createTestUser(t, st, "viewer@example.com")
+	strangerID := createTestUser(t, st, "stranger@example.com")
+	orgMaintainerID := createTestUser(t, st, "org@example.com")
+
+	project, err := st.CreateProject(ctx, &models.NewProject{OwnerID: ownerID, Name: "app", RepoURL: "https://example.com/app.git", AccessToken: "secret-token"})
+	if err != nil {
+		t.Fatalf("Expected no error creating project, got %v", err)
+	}
+	id := strconv.Itoa(project.ID)
+	st.AddProjectMember(ctx, project.ID, viewerID, RoleViewer)
+	st.CreateVariable(ctx, &models.Variable{ProjectID: project.ID, Key: "API_KEY", Value: "hunter2", IsSecret: true})
+
+	org, _ := st.CreateOrganization(ctx, "acme", ownerID)
+	st.AddOrganizationMember(ctx, org.ID, orgMaintainerID, RoleMaintainer)
+	st.SetProjectOrganization(ctx, project.ID, &org.ID)
+
+	t.Run("HidesProjectFromNonMembers", func(t *testing.T) {
+		if w := serveProject(s, http.MethodGet, id, strangerID); w.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404, got %d", w.Code)
+		}
+	})
+
+	t.Run("UnknownProject", func(t *testing.T) {
+		if w := serveProject(s, http.MethodGet, "999", ownerID); w.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404, got %d", w.Code)
+		}
+	})
+
+	t.Run("ViewerReadsWithMaskedCredentials", func(t *testing.T) {
+		w := serveProject(s, http.MethodGet, id, viewerID)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", w.Code)
+		}
+		var got models.Project
+		if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+			t.Fatalf("Expected a project, got %v", err)
+		}
+		if got.AccessToken != "*****" {
+			t.Errorf("Expected masked access token, got '%s'", got.AccessToken)
+		}
+		if len(got.Variables) != 1 || got.Variables[0].Value != "*****" {
+			t.Errorf("Expected masked secret variable, got %+v", got.Variables)
+		}
+	})
+
+	t.Run("ViewerCannotManage", func(t *testing.T) {
+		if w := serveProject(s, http.MethodDelete, id+"/variables/API_KEY", viewerID); w.Code != http.StatusForbidden {
+			t.Errorf("Expected status 403, got %d", w.Code)
+		}
+		if w := serveProject(s, http.MethodDelete, id, viewerID); w.Code != http.StatusForbidden {
+			t.Errorf("Expected status 403, got %d", w.Code)
+		}
+	})
+
+	t.Run("OrganizationRoleApplies", func(t *testing.T) {
+		w := serveProject(s, http.MethodGet, id, orgMaintainerID)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", w.Code)
+		}
+		var got models.Project
+		json.NewDecoder(w.Body).Decode(&got)
+		if got.AccessToken != "secret-token" {
+			t.Errorf("Expected a maintainer to see the access token, got '%s'", got.AccessToken)
+		}
+	})
+
+	t.Run("ListVariablesMasksSecrets", func(t *testing.T) {
+		w := serveProject(s, http.MethodGet, id+"/variables", ownerID)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", w.Code)
+		}
+		var got []models.Variable
+		json.NewDecoder(w.Body).Decode(&got)
+		if len(got) != 1 || got[0].Value != "*****" {
+			t.Errorf("Expected masked secret variable, got %+v", got)
+		}
+	})
+
+	t.Run("DatabaseUnavailable", func(t *testing.T) {
+		if w := serveProject(&Server{}, http.MethodGet, id, ownerID); w.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected status 503, got %d", w.Code)
+		}
+	})
+}
+
+func TestProjectAction(t *testing.T) {
+	tests := []struct {
+		path   string
+		method string
+		want   string
+	}{
+		{"1", http.MethodGet, ActionRead},
+		{"1", http.MethodPut, ActionManage},
+		{"1", http.MethodDelete, ActionAdmin},
+		{"1/transfer", http.MethodPost, ActionAdmin},
+		{"1/organization", http.MethodPut, ActionAdmin},
+		{"1/members", http.MethodGet, ActionRead},
+		{"1/members", http.MethodPost, ActionManage},
+		{"1/members/2", http.MethodDelete, ActionManage},
+		{"1/variables", http.MethodGet, ActionRead},
+		{"1/variables/API_KEY", http.MethodDelete, ActionManage},
+		{"1/webhooks", http.MethodGet, ActionManage},
+		{"1/pipelines", http.MethodGet, ActionRead},
+		{"1/pipelines", http.MethodPost, ActionTrigger},
+		{"1/pipelines/2/cancel", http.MethodPost, ActionTrigger},
+		{"1/pipelines/2/jobs/3/debug", http.MethodPost, ActionManage},
+	}
+	for _, tt := range tests {
+		if got := projectAction(strings.Split(tt.path, "/"), tt.method); got != tt.want {
+			t.Errorf("projectAction(%s %s) = %s, want %s", tt.method, tt.path, got, tt.want)
+		}
+	}
+
+	for _, role := range []string{RoleViewer, RoleDeveloper, "editor", RoleMaintainer, RoleOwner} {
+		if !roleAllows(role, ActionRead) {
+			t.Errorf("Expected %s to read", role)
+		}
+	}
+	if roleAllows("", ActionRead) || roleAllows("stranger", ActionRead) {
+		t.Errorf("Expected users without a role to read nothing")
+	}
+	if roleAllows(RoleViewer, ActionTrigger) || !roleAllows("editor", ActionTrigger) || roleAllows(RoleDeveloper, ActionManage) {
+		t.Errorf("Expected developers, editors included, to trigger pipelines without managing the project")
+	}
+	if roleAllows(RoleMaintainer, ActionAdmin) || !roleAllows(RoleOwner, ActionAdmin) {
+		t.Errorf("Expected only the owner to administer the project")
+	}
+}
+
+func TestProjectMembers(t *testing.T) {
+	ctx := context.Background()
+	s, st := newTestServer()
+	ownerID := createTestUser(t, st, "owner@example.com")
+	maintainerID := createTestUser(t, st, "maintainer@example.com")
+	developerID := createTestUser(t, st, "developer@example.com")
+	newcomerID := createTestUser(t, st, "newcomer@example.com")
+
+	project, err := st.CreateProject(ctx, &models.NewProject{OwnerID: ownerID, Name: "app", RepoURL: "https://example.com/app.git"})
+	if err != nil {
+		t.Fatalf("Expected no error creating project, got %v", err)
+	}
+	id := strconv.Itoa(project.ID)
+	st.AddProjectMember(ctx, project.ID, maintainerID, RoleMaintainer)
+	st.AddProjectMember(ctx, project.ID, developerID, RoleDeveloper)
+
+	t.Run("DeveloperCannotInvite", func(t *testing.T) {
+		if w := postProject(s, id+"/members", `{"email": "newcomer@example.com"}`, developerID); w.Code != http.StatusForbidden {
+			t.Errorf("Expected status 403, got %d", w.Code)
+		}
+	})
+
+	t.Run("InvalidRole", func(t *testing.T) {
+		for _, role := range []string{RoleOwner, "admin"} {
+			if w := postProject(s, id+"/members", `{"email": "newcomer@example.com", "role": "`+role+`"}`, maintainerID); w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status 400 for role %s, got %d", role, w.Code)
+			}
+		}
+	})
+
+	t.Run("MaintainerInvites", func(t *testing.T) {
+		if w := postProject(s, id+"/members", `{"email": "newcomer@example.com"}`, maintainerID); w.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d", w.Code)
+		}
+		if role, _ := st.GetProjectMemberRole(ctx, project.ID, newcomerID); role != RoleViewer {
+			t.Errorf("Expected the newcomer to be invited as a viewer, got '%s'", role)
+		}
+		w := serveProject(s, http.MethodGet, id+"/members", newcomerID)
+		var members []models.ProjectMember
+		json.NewDecoder(w.Body).Decode(&members)
+		if w.Code != http.StatusOK || len(members) != 3 {
+			t.Errorf("Expected a viewer to list the 3 members, got %d with %d members", w.Code, len(members))
+		}
+	})
+
+	t.Run("RemoveMember", func(t *testing.T) {
+		path := id + "/members/" + strconv.Itoa(newcomerID)
+		if w := serveProject(s, http.MethodDelete, path, developerID); w.Code != http.StatusForbidden {
+			t.Errorf("Expected status 403 for a developer, got %d", w.Code)
+		}
+		if w := serveProject(s, http.MethodDelete, path, maintainerID); w.Code != http.StatusNoContent {
+			t.Fatalf("Expected status 204, got %d", w.Code)
+		}
+		if w := serveProject(s, http.MethodGet, id, newcomerID); w.Code != http.StatusNotFound {
+			t.Errorf("Expected the project hidden from a removed member, got %d", w.Code)
+		}
+	})
+}
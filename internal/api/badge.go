@@ -0,0 +1,122 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+)
+
+// badgeTemplate is a flat badge like the ones of other CI systems: label, message and message color
+const badgeTemplate = `<svg xmlns="http://www.w3.org/2000/svg" width="%[4]d" height="20" role="img" aria-label="build: %[2]s">
+  <title>build: %[2]s</title>
+  <linearGradient id="s" x2="0" y2="100%%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>
+  <clipPath id="r"><rect width="%[4]d" height="20" rx="3" fill="#fff"/></clipPath>
+  <g clip-path="url(#r)">
+    <rect width="37" height="20" fill="#555"/>
+    <rect x="37" width="%[5]d" height="20" fill="%[3]s"/>
+    <rect width="%[4]d" height="20" fill="url(#s)"/>
+  </g>
+  <g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">
+    <text x="18.5" y="14">%[1]s</text>
+    <text x="%[6]d" y="14">%[2]s</text>
+  </g>
+</svg>
+`
+
+// badgeTokenResponse is the token to pass to the status badge of a project
+type badgeTokenResponse struct {
+	Token string `json:"token"`
+}
+
+// handleBadge returns the status badge of the latest finished pipeline of a project
+// GET /api/v1/projects/{id}/badge.svg?token=...&branch=main, any branch when omitted
+// The badge is served without authentication, so it requires the badge token of the project: projects without one,
+// unknown projects and wrong tokens all get the same 404.
+func (s *Server) handleBadge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	projectID, err := parseIDFromPath(r.URL.Path, 3)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid project ID")
+		return
+	}
+
+	if s.db == nil {
+		respondError(w, http.StatusNotFound, "Project not found")
+		return
+	}
+	token, err := s.db.GetProjectBadgeToken(r.Context(), projectID)
+	if err != nil || token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(r.URL.Query().Get("token"))) != 1 {
+		respondError(w, http.StatusNotFound, "Project not found")
+		return
+	}
+
+	message, color := "unknown", "#9f9f9f"
+	pipeline, err := s.db.GetLatestFinishedPipeline(r.Context(), projectID, r.URL.Query().Get("branch"))
+	if err == nil && pipeline != nil {
+		switch pipeline.Status {
+		case "success":
+			message, color = "passing", "#4c1"
+		case "failed":
+			message, color = "failing", "#e05d44"
+		}
+	}
+
+	// Message width at about 7px per character plus padding
+	messageWidth := len(message)*7 + 10
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", "no-cache, max-age=0")
+	fmt.Fprintf(w, badgeTemplate, "build", message, color, 37+messageWidth, messageWidth, 37+messageWidth/2)
+}
+
+// handleBadgeToken handles GET, POST and DELETE /api/v1/projects/{id}/badge-token
+// POST generates a new token, so badge URLs shared with the previous one stop working. DELETE disables the badge.
+func (s *Server) handleBadgeToken(w http.ResponseWriter, r *http.Request) {
+	projectID, err := parseIDFromPath(r.URL.Path, 3)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid project ID")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		token, err := s.db.GetProjectBadgeToken(r.Context(), projectID)
+		if err != nil {
+			respondError(w, http.StatusNotFound, "Project not found")
+			return
+		}
+		if token == "" {
+			respondError(w, http.StatusNotFound, "Project has no badge token")
+			return
+		}
+		respondJSON(w, http.StatusOK, badgeTokenResponse{Token: token})
+	case http.MethodPost:
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			respondError(w, http.StatusInternalServerError, "Failed to generate badge token")
+			return
+		}
+		token := hex.EncodeToString(b)
+		if err := s.db.SetProjectBadgeToken(r.Context(), projectID, token); err != nil {
+			logger.Error("Failed to save badge token: " + err.Error())
+			respondError(w, http.StatusInternalServerError, "Failed to save badge token")
+			return
+		}
+		respondJSON(w, http.StatusCreated, badgeTokenResponse{Token: token})
+	case http.MethodDelete:
+		if err := s.db.SetProjectBadgeToken(r.Context(), projectID, ""); err != nil {
+			logger.Error("Failed to remove badge token: " + err.Error())
+			respondError(w, http.StatusInternalServerError, "Failed to remove badge token")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+)
+
+func TestBadge(t *testing.T) {
+	ctx := context.Background()
+	s, st := newTestServer()
+	ownerID := createTestUser(t, st, "owner@example.com")
+	developerID := createTestUser(t, st, "developer@example.com")
+
+	project, err := st.CreateProject(ctx, &models.NewProject{OwnerID: ownerID, Name: "app", RepoURL: "https://example.com/app.git"})
+	if err != nil {
+		t.Fatalf("Expected no error creating project, got %v", err)
+	}
+	st.AddProjectMember(ctx, project.ID, developerID, RoleDeveloper)
+	pipeline, _ := st.CreatePipeline(ctx, project.ID, "main", "abc123")
+	st.UpdatePipelineStatus(ctx, pipeline.ID, "success")
+	path := strconv.Itoa(project.ID) + "/badge-token"
+
+	badge := func(query string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/projects/"+strconv.Itoa(project.ID)+"/badge.svg"+query, nil)
+		w := httptest.NewRecorder()
+		s.routeProjectsPublic(w, r)
+		return w
+	}
+
+	t.Run("DisabledByDefault", func(t *testing.T) {
+		if w := badge(""); w.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404 without a badge token, got %d", w.Code)
+		}
+	})
+
+	var token string
+	t.Run("Generate", func(t *testing.T) {
+		if w := serveProject(s, http.MethodPost, path, developerID); w.Code != http.StatusForbidden {
+			t.Errorf("Expected status 403 for a developer, got %d", w.Code)
+		}
+		w := serveProject(s, http.MethodPost, path, ownerID)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d", w.Code)
+		}
+		var got badgeTokenResponse
+		json.NewDecoder(w.Body).Decode(&got)
+		if len(got.Token) != 32 {
+			t.Fatalf("Expected a 32 character token, got %q", got.Token)
+		}
+		token = got.Token
+	})
+
+	t.Run("WithToken", func(t *testing.T) {
+		w := badge("?token=" + token + "&branch=main")
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "passing") {
+			t.Errorf("Expected a passing badge, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("WrongToken", func(t *testing.T) {
+		if w := badge("?token=" + strings.Repeat("0", 32)); w.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404 with a wrong token, got %d", w.Code)
+		}
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+		if w := serveProject(s, http.MethodDelete, path, ownerID); w.Code != http.StatusNoContent {
+			t.Fatalf("Expected status 204, got %d", w.Code)
+		}
+		if w := badge("?token=" + token); w.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404 once removed, got %d", w.Code)
+		}
+	})
+}
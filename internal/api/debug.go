@@ -0,0 +1,214 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+)
+
+// debugTicketTTL is how long a debug session URL may be opened after it was issued
+const debugTicketTTL = time.Minute
+
+// debugTicket is a one-shot authorization to open a shell in a job container
+type debugTicket struct {
+	jobID     int
+	userID    int
+	expiresAt time.Time
+}
+
+// debugTicketResponse is the body of the response issuing a debug session URL
+type debugTicketResponse struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// debugResize is the text message with which a debug client sets the size of its terminal
+type debugResize struct {
+	Rows uint `json:"rows"`
+	Cols uint `json:"cols"`
+}
+
+// handleJobDebug handles POST /api/v1/projects/{id}/pipelines/{id}/jobs/{id}/debug
+// It issues the URL of a one-shot WebSocket session with a shell in the container of a failed job kept for debugging.
+func (s *Server) handleJobDebug(w http.ResponseWriter, r *http.Request) {
+	projectID, err := parseIDFromPath(r.URL.Path, 3)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid project ID")
+		return
+	}
+	pipelineID, err := parseIDFromPath(r.URL.Path, 5)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid pipeline ID")
+		return
+	}
+	jobID, err := parseIDFromPath(r.URL.Path, 7)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid job ID")
+		return
+	}
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if s.db == nil {
+		respondError(w, http.StatusServiceUnavailable, "Database not available")
+		return
+	}
+
+	pipeline, err := s.db.GetPipeline(r.Context(), pipelineID)
+	if err != nil || pipeline.ProjectID != projectID {
+		respondError(w, http.StatusNotFound, "Pipeline not found")
+		return
+	}
+	job, err := s.db.GetJob(r.Context(), jobID)
+	if err != nil || job.PipelineID != pipelineID {
+		respondError(w, http.StatusNotFound, "Job not found")
+		return
+	}
+	if !s.pipelineExecutor.CanDebug(r.Context(), jobID) {
+		respondError(w, http.StatusConflict, "Job is not a failed job kept for debugging")
+		return
+	}
+
+	userID, _ := r.Context().Value("userID").(int)
+	ticket, expiresAt, err := s.issueDebugTicket(jobID, userID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to issue the debug session")
+		return
+	}
+	logger.Info(fmt.Sprintf("User %d opens a debug session on job %d of pipeline %d", userID, jobID, pipelineID))
+	respondJSON(w, http.StatusCreated, debugTicketResponse{URL: "/api/v1/debug/" + ticket, ExpiresAt: expiresAt})
+}
+
+// issueDebugTicket records a ticket opening a debug session on a job, dropping the expired ones
+func (s *Server) issueDebugTicket(jobID, userID int) (string, time.Time, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", time.Time{}, err
+	}
+	ticket := hex.EncodeToString(b)
+	expiresAt := time.Now().Add(debugTicketTTL)
+
+	s.debugTicketsMu.Lock()
+	defer s.debugTicketsMu.Unlock()
+	if s.debugTickets == nil {
+		s.debugTickets = make(map[string]debugTicket)
+	}
+	for key, t := range s.debugTickets {
+		if time.Now().After(t.expiresAt) {
+			delete(s.debugTickets, key)
+		}
+	}
+	s.debugTickets[ticket] = debugTicket{jobID: jobID, userID: userID, expiresAt: expiresAt}
+	return ticket, expiresAt, nil
+}
+
+// useDebugTicket consumes a ticket, reporting whether it was valid
+func (s *Server) useDebugTicket(ticket string) (debugTicket, bool) {
+	s.debugTicketsMu.Lock()
+	defer s.debugTicketsMu.Unlock()
+	t, ok := s.debugTickets[ticket]
+	delete(s.debugTickets, ticket)
+	return t, ok && time.Now().Before(t.expiresAt)
+}
+
+// handleDebugSession handles /api/v1/debug/{ticket}
+// Binary messages carry the terminal input and output, text messages resize the terminal.
+// The ticket was issued to an authorized user, so the request needs no token of its own.
+func (s *Server) handleDebugSession(w http.ResponseWriter, r *http.Request) {
+	ticket, ok := s.useDebugTicket(strings.TrimPrefix(r.URL.Path, "/api/v1/debug/"))
+	if !ok {
+		respondError(w, http.StatusNotFound, "Debug session not found or expired")
+		return
+	}
+
+	session, err := s.pipelineExecutor.DebugShell(context.WithoutCancel(r.Context()), ticket.jobID)
+	if err != nil {
+		respondError(w, http.StatusConflict, "Failed to open the debug session: "+err.Error())
+		return
+	}
+	defer session.Close()
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logger.Error("WebSocket upgrade failed: " + err.Error())
+		return
+	}
+	defer conn.Close()
+
+	// Forward the client input, until it goes away
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			kind, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if kind == websocket.TextMessage {
+				var resize debugResize
+				if json.Unmarshal(message, &resize) == nil && resize.Rows > 0 && resize.Cols > 0 {
+					session.Resize(r.Context(), resize.Rows, resize.Cols)
+				}
+				continue
+			}
+			if _, err := session.Write(message); err != nil {
+				return
+			}
+		}
+	}()
+
+	// Read the terminal output, until the shell exits
+	output := make(chan []byte)
+	go func() {
+		defer close(output)
+		for {
+			buf := make([]byte, 4096)
+			n, err := session.Read(buf)
+			if n > 0 {
+				select {
+				case output <- buf[:n]:
+				case <-closed:
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case <-ping.C:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case data, ok := <-output:
+			if !ok {
+				conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "shell exited"))
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := conn.WriteMessage(websocket.BinaryMessage, data); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/executor"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+)
+
+func TestJobDebug(t *testing.T) {
+	ctx := context.Background()
+	s, st := newTestServer()
+	s.pipelineExecutor = executor.NewPipelineExecutor(st, nil)
+	ownerID := createTestUser(t, st, "owner@example.com")
+	developerID := createTestUser(t, st, "developer@example.com")
+
+	project, err := st.CreateProject(ctx, &models.NewProject{OwnerID: ownerID, Name: "app", RepoURL: "https://example.com/app.git"})
+	if err != nil {
+		t.Fatalf("Expected no error creating project, got %v", err)
+	}
+	st.AddProjectMember(ctx, project.ID, developerID, RoleDeveloper)
+	pipeline, _ := st.CreatePipeline(ctx, project.ID, "main", "abc123")
+	job, _ := st.CreateJob(ctx, pipeline.ID, "test", "test", "alpine")
+	path := fmt.Sprintf("%d/pipelines/%d/jobs/%d/debug", project.ID, pipeline.ID, job.ID)
+
+	t.Run("DeveloperForbidden", func(t *testing.T) {
+		if w := serveProject(s, http.MethodPost, path, developerID); w.Code != http.StatusForbidden {
+			t.Errorf("Expected status 403, got %d", w.Code)
+		}
+	})
+
+	t.Run("NotKeptForDebugging", func(t *testing.T) {
+		if w := serveProject(s, http.MethodPost, path, ownerID); w.Code != http.StatusConflict {
+			t.Errorf("Expected status 409, got %d", w.Code)
+		}
+	})
+
+	t.Run("TicketIsOneShot", func(t *testing.T) {
+		ticket, _, err := s.issueDebugTicket(job.ID, ownerID)
+		if err != nil {
+			t.Fatalf("Expected no error issuing a ticket, got %v", err)
+		}
+		if _, ok := s.useDebugTicket(ticket); !ok {
+			t.Fatal("Expected the ticket to be valid")
+		}
+		if _, ok := s.useDebugTicket(ticket); ok {
+			t.Error("Expected the ticket to be consumed")
+		}
+	})
+
+	t.Run("ExpiredTicket", func(t *testing.T) {
+		ticket, _, _ := s.issueDebugTicket(job.ID, ownerID)
+		s.debugTickets[ticket] = debugTicket{jobID: job.ID, userID: ownerID, expiresAt: time.Now().Add(-time.Second)}
+		w := httptest.NewRecorder()
+		s.handleDebugSession(w, httptest.NewRequest(http.MethodGet, "/api/v1/debug/"+ticket, nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404, got %d", w.Code)
+		}
+	})
+}
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+)
+
+// maxWebhookPayload is the largest webhook body accepted, the cap GitHub puts on its payloads
+const maxWebhookPayload = 25 << 20
+
+// maxListedDeliveries bounds the deliveries listed per request
+const maxListedDeliveries = 100
+
+// webhookHeaders returns the headers of a webhook request worth keeping with its delivery
+func webhookHeaders(header http.Header) map[string]string {
+	kept := make(map[string]string)
+	for name, values := range header {
+		if strings.HasPrefix(name, "X-Github-") || name == "Content-Type" || name == "User-Agent" {
+			kept[name] = strings.Join(values, ", ")
+		}
+	}
+	return kept
+}
+
+// recordDelivery stores a received delivery, false when it is a duplicate to ignore
+// Without database, or when it cannot be recorded, the delivery is processed unrecorded.
+func (s *Server) recordDelivery(ctx context.Context, delivery *models.WebhookDelivery) bool {
+	if s.db == nil {
+		return true
+	}
+	recorded, err := s.db.CreateWebhookDelivery(ctx, delivery)
+	if err != nil {
+		logger.Error("Failed to record webhook delivery: " + err.Error())
+		delivery.ID = 0
+		return true
+	}
+	return recorded
+}
+
+// processWebhookDelivery handles a recorded delivery and saves its outcome, returning the HTTP status and body answered to the host
+func (s *Server) processWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) (int, map[string]string) {
+	defer func() {
+		if s.db != nil && delivery.ID > 0 {
+			if err := s.db.FinishWebhookDelivery(context.WithoutCancel(ctx), delivery); err != nil {
+				logger.Error("Failed to record webhook delivery outcome: " + err.Error())
+			}
+		}
+	}()
+
+	switch delivery.Event {
+	case "push":
+		return s.handlePushEvent(ctx, delivery)
+	case "pull_request":
+		return s.handlePullRequestEvent(ctx, delivery)
+	}
+
+	logger.Info("Ignoring non-push event: " + delivery.Event)
+	var event struct {
+		Repository models.Repository `json:"repository"`
+	}
+	if json.Unmarshal([]byte(delivery.Payload), &event) == nil {
+		s.resolveDeliveryProject(ctx, delivery, event.Repository.CloneURL)
+	}
+	delivery.Status, delivery.Reason = "ignored", "Event "+delivery.Event+" does not trigger pipelines"
+	return http.StatusOK, map[string]string{"message": "event ignored"}
+}
+
+// resolveDeliveryProject links a delivery to the project of its repository, if any
+func (s *Server) resolveDeliveryProject(ctx context.Context, delivery *models.WebhookDelivery, repoURL string) {
+	if s.db == nil || repoURL == "" {
+		return
+	}
+	if project, err := s.db.FindProjectByUrl(ctx, repoURL); err == nil && project != nil {
+		delivery.ProjectID = &project.ID
+	}
+}
+
+// handleWebhookDeliveries handles GET /api/v1/projects/{id}/webhook-deliveries
+func (s *Server) handleWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	projectID, err := parseIDFromPath(r.URL.Path, 3)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid project ID")
+		return
+	}
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	limit := maxListedDeliveries
+	if value := r.URL.Query().Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > maxListedDeliveries {
+			respondError(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxListedDeliveries))
+			return
+		}
+	}
+	deliveries, err := s.db.GetWebhookDeliveriesByProject(r.Context(), projectID, limit)
+	if err != nil {
+		logger.Error("Failed to get webhook deliveries: " + err.Error())
+		respondError(w, http.StatusInternalServerError, "Failed to get webhook deliveries")
+		return
+	}
+	if deliveries == nil {
+		deliveries = []models.WebhookDelivery{}
+	}
+	respondJSON(w, http.StatusOK, deliveries)
+}
+
+// handleWebhookDelivery handles GET /api/v1/projects/{id}/webhook-deliveries/{deliveryId}, with the headers and payload
+func (s *Server) handleWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	projectID, deliveryID, ok := parseDeliveryPath(w, r)
+	if !ok {
+		return
+	}
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	delivery, err := s.db.GetWebhookDelivery(r.Context(), projectID, deliveryID)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Webhook delivery not found")
+		return
+	}
+	respondJSON(w, http.StatusOK, delivery)
+}
+
+// handleWebhookDeliveryReplay handles POST /api/v1/projects/{id}/webhook-deliveries/{deliveryId}/replay
+// The stored payload is processed again as a new delivery, without deduplication, which is returned with its outcome.
+func (s *Server) handleWebhookDeliveryReplay(w http.ResponseWriter, r *http.Request) {
+	projectID, deliveryID, ok := parseDeliveryPath(w, r)
+	if !ok {
+		return
+	}
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	original, err := s.db.GetWebhookDelivery(r.Context(), projectID, deliveryID)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Webhook delivery not found")
+		return
+	}
+	replay := &models.WebhookDelivery{
+		Event:    original.Event,
+		Headers:  original.Headers,
+		Payload:  original.Payload,
+		ReplayOf: &original.ID,
+	}
+	if _, err := s.db.CreateWebhookDelivery(r.Context(), replay); err != nil {
+		logger.Error("Failed to record webhook delivery: " + err.Error())
+		respondError(w, http.StatusInternalServerError, "Failed to record the replay")
+		return
+	}
+
+	logger.Info("Replaying webhook delivery " + strconv.Itoa(original.ID) + " as " + strconv.Itoa(replay.ID))
+	s.processWebhookDelivery(r.Context(), replay)
+	replay.Payload, replay.Headers = "", nil
+	respondJSON(w, http.StatusCreated, replay)
+}
+
+// parseDeliveryPath reads the project and delivery IDs of /api/v1/projects/{id}/webhook-deliveries/{deliveryId}[/...]
+func parseDeliveryPath(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	projectID, err := parseIDFromPath(r.URL.Path, 3)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid project ID")
+		return 0, 0, false
+	}
+	deliveryID, err := parseIDFromPath(r.URL.Path, 5)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid delivery ID")
+		return 0, 0, false
+	}
+	return projectID, deliveryID, true
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+)
+
+func TestWebhookDeliveries(t *testing.T) {
+	ctx := context.Background()
+	s, st := newTestServer()
+	ownerID := createTestUser(t, st, "owner@example.com")
+	project, err := st.CreateProject(ctx, &models.NewProject{OwnerID: ownerID, Name: "app", RepoURL: "https://example.com/app.git", BranchFilters: []string{"main"}})
+	if err != nil {
+		t.Fatalf("Expected no error creating project, got %v", err)
+	}
+	id := strconv.Itoa(project.ID)
+
+	payload := `{"ref": "refs/heads/feature", "after": "0123456789abcdef0123456789abcdef01234567",
+		"repository": {"name": "app", "full_name": "acme/app", "clone_url": "https://example.com/app.git"}}`
+	r := httptest.NewRequest(http.MethodPost, "/webhook/github", strings.NewReader(payload))
+	r.Header.Set("X-GitHub-Event", "push")
+	r.Header.Set("X-GitHub-Delivery", "delivery-1")
+	r.Header.Set("Authorization", "Bearer secret")
+	s.handleGitHubWebhook(httptest.NewRecorder(), r)
+
+	w := serveProject(s, http.MethodGet, id+"/webhook-deliveries", ownerID)
+	var deliveries []models.WebhookDelivery
+	json.Unmarshal(w.Body.Bytes(), &deliveries)
+	if w.Code != http.StatusOK || len(deliveries) != 1 {
+		t.Fatalf("Expected 1 delivery, got %d %s", w.Code, w.Body.String())
+	}
+	delivery := deliveries[0]
+	if delivery.Status != "ignored" || !strings.Contains(delivery.Reason, "branch filters") || delivery.Payload != "" {
+		t.Errorf("Expected an ignored delivery without payload, got %+v", delivery)
+	}
+
+	t.Run("Get", func(t *testing.T) {
+		w := serveProject(s, http.MethodGet, id+"/webhook-deliveries/"+strconv.Itoa(delivery.ID), ownerID)
+		var got models.WebhookDelivery
+		json.Unmarshal(w.Body.Bytes(), &got)
+		if got.Payload != payload || got.Headers["X-Github-Delivery"] != "delivery-1" {
+			t.Errorf("Expected the payload and headers, got %+v", got)
+		}
+		if _, ok := got.Headers["Authorization"]; ok {
+			t.Error("Expected the Authorization header not to be stored")
+		}
+	})
+
+	t.Run("Replay", func(t *testing.T) {
+		w := postProject(s, id+"/webhook-deliveries/"+strconv.Itoa(delivery.ID)+"/replay", "", ownerID)
+		var replay models.WebhookDelivery
+		json.Unmarshal(w.Body.Bytes(), &replay)
+		if w.Code != http.StatusCreated || replay.ReplayOf == nil || *replay.ReplayOf != delivery.ID || replay.Status != "ignored" {
+			t.Errorf("Expected a replay of delivery %d, got %d %s", delivery.ID, w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("OtherProject", func(t *testing.T) {
+		other, _ := st.CreateProject(ctx, &models.NewProject{OwnerID: ownerID, Name: "other", RepoURL: "https://example.com/other.git"})
+		w := serveProject(s, http.MethodGet, strconv.Itoa(other.ID)+"/webhook-deliveries/"+strconv.Itoa(delivery.ID), ownerID)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404, got %d", w.Code)
+		}
+	})
+}
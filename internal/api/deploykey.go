@@ -0,0 +1,61 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/ssh"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+)
+
+// deployKeyResponse is the public key to add to the deploy keys of the repository
+type deployKeyResponse struct {
+	PublicKey string `json:"public_key"`
+}
+
+// handleDeployKey handles GET, POST and DELETE /api/v1/projects/{id}/deploy-key
+// POST generates a new key pair, replacing the previous one. Only the public key is ever returned.
+func (s *Server) handleDeployKey(w http.ResponseWriter, r *http.Request) {
+	projectID, err := parseIDFromPath(r.URL.Path, 3)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid project ID")
+		return
+	}
+	project, err := s.db.GetProject(r.Context(), projectID)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Project not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if project.DeployKeyPublic == "" {
+			respondError(w, http.StatusNotFound, "Project has no deploy key")
+			return
+		}
+		respondJSON(w, http.StatusOK, deployKeyResponse{PublicKey: project.DeployKeyPublic})
+	case http.MethodPost:
+		privateKey, publicKey, err := ssh.GenerateKey(fmt.Sprintf("cicd-project-%d", projectID))
+		if err != nil {
+			logger.Error("Failed to generate deploy key: " + err.Error())
+			respondError(w, http.StatusInternalServerError, "Failed to generate deploy key")
+			return
+		}
+		if err := s.db.SetProjectDeployKey(r.Context(), projectID, privateKey, publicKey); err != nil {
+			logger.Error("Failed to save deploy key: " + err.Error())
+			respondError(w, http.StatusInternalServerError, "Failed to save deploy key")
+			return
+		}
+		logger.Info(fmt.Sprintf("Generated a deploy key for project %s", project.Name))
+		respondJSON(w, http.StatusCreated, deployKeyResponse{PublicKey: publicKey})
+	case http.MethodDelete:
+		if err := s.db.SetProjectDeployKey(r.Context(), projectID, "", ""); err != nil {
+			logger.Error("Failed to remove deploy key: " + err.Error())
+			respondError(w, http.StatusInternalServerError, "Failed to remove deploy key")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+)
+
+func TestDeployKey(t *testing.T) {
+	ctx := context.Background()
+	s, st := newTestServer()
+	ownerID := createTestUser(t, st, "owner@example.com")
+	developerID := createTestUser(t, st, "developer@example.com")
+
+	project, err := st.CreateProject(ctx, &models.NewProject{OwnerID: ownerID, Name: "app", RepoURL: "https://example.com/app.git"})
+	if err != nil {
+		t.Fatalf("Expected no error creating project, got %v", err)
+	}
+	st.AddProjectMember(ctx, project.ID, developerID, RoleDeveloper)
+	path := strconv.Itoa(project.ID) + "/deploy-key"
+
+	t.Run("Generate", func(t *testing.T) {
+		w := serveProject(s, http.MethodPost, path, ownerID)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d", w.Code)
+		}
+		var got deployKeyResponse
+		json.NewDecoder(w.Body).Decode(&got)
+		if !strings.HasPrefix(got.PublicKey, "ssh-ed25519 ") {
+			t.Errorf("Expected an ed25519 public key, got %q", got.PublicKey)
+		}
+
+		stored, _ := st.GetProject(ctx, project.ID)
+		if !strings.Contains(stored.DeployKey, "OPENSSH PRIVATE KEY") {
+			t.Errorf("Expected the private key to be stored")
+		}
+		if w := serveProject(s, http.MethodGet, path, developerID); !strings.Contains(w.Body.String(), got.PublicKey) {
+			t.Errorf("Expected members to read the public key, got %s", w.Body.String())
+		}
+	})
+
+	t.Run("DeveloperForbidden", func(t *testing.T) {
+		if w := serveProject(s, http.MethodPost, path, developerID); w.Code != http.StatusForbidden {
+			t.Errorf("Expected status 403, got %d", w.Code)
+		}
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+		if w := serveProject(s, http.MethodDelete, path, ownerID); w.Code != http.StatusNoContent {
+			t.Fatalf("Expected status 204, got %d", w.Code)
+		}
+		if w := serveProject(s, http.MethodGet, path, ownerID); w.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404 once removed, got %d", w.Code)
+		}
+	})
+}
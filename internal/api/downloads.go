@@ -0,0 +1,155 @@
+package api
+
+import (
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+)
+
+// handleRawLogs downloads the full log of a job as plain text, gzipped with ?gzip=true
+// GET /api/v1/projects/{projectId}/pipelines/{pipelineId}/jobs/{jobId}/logs/raw
+func (s *Server) handleRawLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if s.db == nil {
+		respondError(w, http.StatusServiceUnavailable, "Database not available")
+		return
+	}
+
+	projectID, err := parseIDFromPath(r.URL.Path, 3)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid project ID")
+		return
+	}
+	pipelineID, err := parseIDFromPath(r.URL.Path, 5)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid pipeline ID")
+		return
+	}
+	jobID, err := parseIDFromPath(r.URL.Path, 7)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid job ID")
+		return
+	}
+
+	pipeline, err := s.db.GetPipeline(r.Context(), pipelineID)
+	if err != nil || pipeline.ProjectID != projectID {
+		respondError(w, http.StatusNotFound, "Pipeline not found")
+		return
+	}
+	job, err := s.db.GetJob(r.Context(), jobID)
+	if err != nil || job.PipelineID != pipelineID {
+		respondError(w, http.StatusNotFound, "Job not found")
+		return
+	}
+	logs, err := s.db.GetLogsByJob(r.Context(), jobID)
+	if err != nil {
+		logger.Error("Failed to get logs: " + err.Error())
+		respondError(w, http.StatusInternalServerError, "Failed to get logs")
+		return
+	}
+
+	filename := fmt.Sprintf("job-%d-%s.log", job.ID, sanitizeProjectName(job.Name))
+	var out io.Writer = w
+	if r.URL.Query().Get("gzip") == "true" {
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.gz"`, filename))
+		gz := gzip.NewWriter(w)
+		defer gz.Close()
+		out = gz
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	}
+
+	writeJobLog(out, logs)
+}
+
+// handleLogsArchive downloads a zip with the log of every job of a pipeline and of its deployment
+// GET /api/v1/projects/{projectId}/pipelines/{pipelineId}/logs.zip
+func (s *Server) handleLogsArchive(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if s.db == nil {
+		respondError(w, http.StatusServiceUnavailable, "Database not available")
+		return
+	}
+
+	projectID, err := parseIDFromPath(r.URL.Path, 3)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid project ID")
+		return
+	}
+	pipelineID, err := parseIDFromPath(r.URL.Path, 5)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid pipeline ID")
+		return
+	}
+
+	pipeline, err := s.db.GetPipeline(r.Context(), pipelineID)
+	if err != nil || pipeline.ProjectID != projectID {
+		respondError(w, http.StatusNotFound, "Pipeline not found")
+		return
+	}
+	jobs, err := s.db.GetJobsByPipeline(r.Context(), pipelineID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get jobs")
+		return
+	}
+
+	// Headers are sent with the first byte, errors past this point can only be logged
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="pipeline-%d-logs.zip"`, pipelineID))
+	archive := zip.NewWriter(w)
+	defer archive.Close()
+
+	for i, job := range jobs {
+		logs, err := s.db.GetLogsByJob(r.Context(), job.ID)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to get logs of job %d: %v", job.ID, err))
+			return
+		}
+		// Files are numbered in execution order, job names may repeat across stages
+		entry, err := archive.Create(fmt.Sprintf("%02d-%s-%s.log", i+1, sanitizeProjectName(job.Stage), sanitizeProjectName(job.Name)))
+		if err != nil {
+			return
+		}
+		writeJobLog(entry, logs)
+	}
+
+	deploymentLogs, err := s.db.GetDeploymentLogs(r.Context(), pipelineID)
+	if err == nil && len(deploymentLogs) > 0 {
+		entry, err := archive.Create("deployment.log")
+		if err != nil {
+			return
+		}
+		for _, l := range deploymentLogs {
+			writeLogLine(entry, l.Content)
+		}
+	}
+}
+
+// writeJobLog writes log lines as text, one per line
+func writeJobLog(w io.Writer, logs []models.LogLine) {
+	for _, l := range logs {
+		writeLogLine(w, l.Content)
+	}
+}
+
+// writeLogLine writes a log entry, adding the newline entries stored without one
+func writeLogLine(w io.Writer, content string) {
+	io.WriteString(w, content)
+	if !strings.HasSuffix(content, "\n") {
+		io.WriteString(w, "\n")
+	}
+}
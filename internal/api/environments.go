@@ -0,0 +1,308 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/parser/compose"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/secrets"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+)
+
+// handleEnvironments handles GET and POST /api/v1/projects/{id}/environments
+func (s *Server) handleEnvironments(w http.ResponseWriter, r *http.Request) {
+	projectID, err := parseIDFromPath(r.URL.Path, 3)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid project ID")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.listEnvironments(w, r, projectID)
+	case http.MethodPost:
+		s.createEnvironment(w, r, projectID)
+	default:
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// handleEnvironment handles GET, PUT and DELETE /api/v1/projects/{id}/environments/{name}
+func (s *Server) handleEnvironment(w http.ResponseWriter, r *http.Request) {
+	projectID, err := parseIDFromPath(r.URL.Path, 3)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid project ID")
+		return
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 6 {
+		respondError(w, http.StatusBadRequest, "Invalid path")
+		return
+	}
+	name := parts[5]
+
+	switch r.Method {
+	case http.MethodGet:
+		env, err := s.db.GetEnvironment(r.Context(), projectID, name)
+		if err != nil {
+			respondEnvironmentError(w, err)
+			return
+		}
+		maskEnvironmentSecrets(env)
+		respondJSON(w, http.StatusOK, env)
+	case http.MethodPut:
+		s.updateEnvironment(w, r, projectID, name)
+	case http.MethodDelete:
+		if err := s.db.DeleteEnvironment(r.Context(), projectID, name); err != nil {
+			respondEnvironmentError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// handleEnvironmentVersion handles GET /api/v1/projects/{id}/environments/{name}/current
+func (s *Server) handleEnvironmentVersion(w http.ResponseWriter, r *http.Request) {
+	projectID, err := parseIDFromPath(r.URL.Path, 3)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid project ID")
+		return
+	}
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	name := strings.Split(strings.Trim(r.URL.Path, "/"), "/")[5]
+
+	version, err := s.db.GetEnvironmentVersion(r.Context(), projectID, name)
+	if err != nil {
+		respondEnvironmentError(w, err)
+		return
+	}
+	if version == nil {
+		respondError(w, http.StatusNotFound, "Nothing deployed to this environment yet")
+		return
+	}
+	if version.Images == nil {
+		version.Images = []string{}
+	}
+	respondJSON(w, http.StatusOK, version)
+}
+
+func (s *Server) listEnvironments(w http.ResponseWriter, r *http.Request, projectID int) {
+	environments, err := s.db.GetEnvironmentsByProject(r.Context(), projectID)
+	if err != nil {
+		respondEnvironmentError(w, err)
+		return
+	}
+	if environments == nil {
+		environments = []models.Environment{}
+	}
+	for i := range environments {
+		maskEnvironmentSecrets(&environments[i])
+	}
+	respondJSON(w, http.StatusOK, environments)
+}
+
+func (s *Server) createEnvironment(w http.ResponseWriter, r *http.Request, projectID int) {
+	var env models.Environment
+	if err := json.NewDecoder(r.Body).Decode(&env); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if !validEnvironmentName(env.Name) {
+		respondError(w, http.StatusBadRequest, "name is required and may not contain / or be *")
+		return
+	}
+	if msg := validateStrategy(&env); msg != "" {
+		respondError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	env.ProjectID = projectID
+	if err := s.db.CreateEnvironment(r.Context(), &env); err != nil {
+		if err.Error() == "environment already exists" {
+			respondError(w, http.StatusConflict, err.Error())
+			return
+		}
+		logger.Error("Failed to create environment: " + err.Error())
+		respondError(w, http.StatusInternalServerError, "Failed to create environment")
+		return
+	}
+
+	maskEnvironmentSecrets(&env)
+	respondJSON(w, http.StatusCreated, env)
+}
+
+// updateEnvironment changes the settings of an environment, omitted fields are kept
+func (s *Server) updateEnvironment(w http.ResponseWriter, r *http.Request, projectID int, name string) {
+	var req struct {
+		SSHHost            *string  `json:"ssh_host"`
+		SSHUser            *string  `json:"ssh_user"`
+		SSHPrivateKey      *string  `json:"ssh_private_key"`
+		DeploymentFilename *string  `json:"deployment_filename"`
+		Protected          *bool    `json:"protected"`
+		ProtectedBranches  []string `json:"protected_branches"`
+		DeploymentStrategy *string  `json:"deployment_strategy"`
+		CanaryReplicas     *int     `json:"canary_replicas"`
+		CanaryBakeSeconds  *int     `json:"canary_bake_seconds"`
+		SSHHosts           []string `json:"ssh_hosts"`
+		RolloutBatchSize   *int     `json:"rollout_batch_size"`
+		PreDeploy          []string `json:"pre_deploy"`
+		PostDeploy         []string `json:"post_deploy"`
+		Proxy              *string  `json:"proxy"`
+		ProxyDomain        *string  `json:"proxy_domain"`
+		ProxyService       *string  `json:"proxy_service"`
+		ProxyPort          *int     `json:"proxy_port"`
+		Preview            *bool    `json:"preview"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	env, err := s.db.GetEnvironment(r.Context(), projectID, name)
+	if err != nil {
+		respondEnvironmentError(w, err)
+		return
+	}
+	if req.SSHHost != nil {
+		env.SSHHost = *req.SSHHost
+	}
+	if req.SSHUser != nil {
+		env.SSHUser = *req.SSHUser
+	}
+	if req.SSHPrivateKey != nil {
+		env.SSHPrivateKey = *req.SSHPrivateKey
+	}
+	if req.DeploymentFilename != nil {
+		env.DeploymentFilename = *req.DeploymentFilename
+	}
+	if req.Protected != nil {
+		env.Protected = *req.Protected
+	}
+	if req.ProtectedBranches != nil {
+		env.ProtectedBranches = req.ProtectedBranches
+	}
+	if req.DeploymentStrategy != nil {
+		env.DeploymentStrategy = *req.DeploymentStrategy
+	}
+	if req.CanaryReplicas != nil {
+		env.CanaryReplicas = *req.CanaryReplicas
+	}
+	if req.CanaryBakeSeconds != nil {
+		env.CanaryBakeSeconds = *req.CanaryBakeSeconds
+	}
+	if req.SSHHosts != nil {
+		env.SSHHosts = req.SSHHosts
+	}
+	if req.RolloutBatchSize != nil {
+		env.RolloutBatchSize = *req.RolloutBatchSize
+	}
+	if req.PreDeploy != nil {
+		env.PreDeploy = req.PreDeploy
+	}
+	if req.PostDeploy != nil {
+		env.PostDeploy = req.PostDeploy
+	}
+	if req.Proxy != nil {
+		env.Proxy = *req.Proxy
+	}
+	if req.ProxyDomain != nil {
+		env.ProxyDomain = *req.ProxyDomain
+	}
+	if req.ProxyService != nil {
+		env.ProxyService = *req.ProxyService
+	}
+	if req.ProxyPort != nil {
+		env.ProxyPort = *req.ProxyPort
+	}
+	if req.Preview != nil {
+		env.Preview = *req.Preview
+	}
+	if msg := validateStrategy(env); msg != "" {
+		respondError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	if err := s.db.UpdateEnvironment(r.Context(), env); err != nil {
+		respondEnvironmentError(w, err)
+		return
+	}
+
+	maskEnvironmentSecrets(env)
+	respondJSON(w, http.StatusOK, env)
+}
+
+// respondEnvironmentError maps an environment store error to its HTTP status
+func respondEnvironmentError(w http.ResponseWriter, err error) {
+	switch {
+	case err.Error() == "environment not found":
+		respondError(w, http.StatusNotFound, "Environment not found")
+	case errors.Is(err, secrets.ErrKeyMismatch):
+		logger.Error(err.Error())
+		respondError(w, http.StatusInternalServerError, keyMismatchReason)
+	default:
+		logger.Error("Environment operation failed: " + err.Error())
+		respondError(w, http.StatusInternalServerError, "Failed to access environment")
+	}
+}
+
+// validEnvironmentName reports whether a name can be used in URLs and variable scopes
+func validEnvironmentName(name string) bool {
+	return name != "" && name != models.AllEnvironments && !strings.Contains(name, "/")
+}
+
+// validateStrategy returns why the deployment strategy settings of an environment are invalid, empty when valid
+func validateStrategy(env *models.Environment) string {
+	switch env.DeploymentStrategy {
+	case "", models.StrategyRecreate, models.StrategyCanary:
+	default:
+		return "deployment_strategy must be recreate or canary"
+	}
+	if env.CanaryReplicas < 0 || env.CanaryBakeSeconds < 0 {
+		return "canary_replicas and canary_bake_seconds may not be negative"
+	}
+	if env.RolloutBatchSize < 0 {
+		return "rollout_batch_size may not be negative"
+	}
+	if !validBranchFilters(env.ProtectedBranches) {
+		return "protected_branches must be valid branch globs"
+	}
+	if len(env.SSHHosts) > 0 && env.SSHHost == "" {
+		return "ssh_hosts need an ssh_host"
+	}
+	for _, host := range env.SSHHosts {
+		if host == "" || host == env.SSHHost {
+			return "ssh_hosts may not be empty or repeat ssh_host"
+		}
+	}
+	if slices.Contains(env.PreDeploy, "") || slices.Contains(env.PostDeploy, "") {
+		return "pre_deploy and post_deploy may not hold empty commands"
+	}
+	switch env.Proxy {
+	case "", compose.ProxyTraefik, compose.ProxyCaddy:
+	default:
+		return "proxy must be traefik or caddy"
+	}
+	if env.Proxy != "" && env.ProxyDomain == "" {
+		return "proxy_domain is required with a proxy"
+	}
+	if env.ProxyPort < 0 || env.ProxyPort > 65535 {
+		return "proxy_port must be a port number"
+	}
+	return ""
+}
+
+// maskEnvironmentSecrets hides the SSH key of an environment, it is only ever written
+func maskEnvironmentSecrets(env *models.Environment) {
+	if env.SSHPrivateKey != "" {
+		env.SSHPrivateKey = "*****"
+	}
+}
@@ -0,0 +1,192 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+)
+
+func TestEnvironments(t *testing.T) {
+	ctx := context.Background()
+	s, st := newTestServer()
+	ownerID := createTestUser(t, st, "owner@example.com")
+	developerID := createTestUser(t, st, "dev@example.com")
+
+	project, err := st.CreateProject(ctx, &models.NewProject{OwnerID: ownerID, Name: "app", RepoURL: "https://example.com/app.git"})
+	if err != nil {
+		t.Fatalf("Expected no error creating project, got %v", err)
+	}
+	id := strconv.Itoa(project.ID)
+	st.AddProjectMember(ctx, project.ID, developerID, RoleDeveloper)
+	st.CreateEnvironment(ctx, &models.Environment{ProjectID: project.ID, Name: "staging", SSHHost: "staging.example.com", SSHPrivateKey: "staging-key"})
+	st.CreateEnvironment(ctx, &models.Environment{ProjectID: project.ID, Name: "production", Protected: true, ProtectedBranches: []string{"main", "release/*"}})
+
+	t.Run("ListMasksKeys", func(t *testing.T) {
+		w := serveProject(s, http.MethodGet, id+"/environments", developerID)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", w.Code)
+		}
+		var got []models.Environment
+		if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+			t.Fatalf("Expected environments, got %v", err)
+		}
+		if len(got) != 2 || got[0].Name != "production" || got[1].SSHPrivateKey != "*****" {
+			t.Errorf("Expected sorted environments with masked keys, got %+v", got)
+		}
+	})
+
+	t.Run("DeveloperCannotDelete", func(t *testing.T) {
+		if w := serveProject(s, http.MethodDelete, id+"/environments/staging", developerID); w.Code != http.StatusForbidden {
+			t.Errorf("Expected status 403, got %d", w.Code)
+		}
+	})
+
+	t.Run("ProtectedEnvironment", func(t *testing.T) {
+		if _, reason := s.deployEnvironment(ctx, project, "production", "main", developerID); reason == "" {
+			t.Error("Expected a developer's run not to deploy to a protected environment")
+		}
+		if _, reason := s.deployEnvironment(ctx, project, "production", "feature", ownerID); reason != "" {
+			t.Errorf("Expected the owner's run to deploy, got %q", reason)
+		}
+	})
+
+	t.Run("ProtectedEnvironmentPush", func(t *testing.T) {
+		for branch, allowed := range map[string]bool{"main": true, "release/1.2": true, "feature": false, "main-copy": false} {
+			if _, reason := s.deployEnvironment(ctx, project, "production", branch, 0); (reason == "") != allowed {
+				t.Errorf("Expected a push of %s to deploy: %v, got %q", branch, allowed, reason)
+			}
+		}
+		st.CreateEnvironment(ctx, &models.Environment{ProjectID: project.ID, Name: "vault", Protected: true})
+		if _, reason := s.deployEnvironment(ctx, project, "vault", "main", 0); reason == "" {
+			t.Error("Expected pushes not to deploy to a protected environment without protected_branches")
+		}
+		if w := postProject(s, id+"/environments", `{"name": "qa", "protected": true, "protected_branches": ["release/["]}`, ownerID); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected an invalid protected branch glob to be rejected, got %d", w.Code)
+		}
+	})
+
+	t.Run("UnknownEnvironment", func(t *testing.T) {
+		if _, reason := s.deployEnvironment(ctx, project, "qa", "main", ownerID); reason == "" {
+			t.Error("Expected an undefined environment to fail the pipeline")
+		}
+	})
+
+	t.Run("UsesEnvironmentHost", func(t *testing.T) {
+		project.SSHPrivateKey = "project-key"
+		env, _ := st.GetEnvironment(ctx, project.ID, "production")
+		target := environmentProject(project, env)
+		if target.SSHHost != "" || target.SSHPrivateKey != "project-key" {
+			t.Errorf("Expected a local deployment with the project key, got host %q key %q", target.SSHHost, target.SSHPrivateKey)
+		}
+	})
+
+	t.Run("RolloutHosts", func(t *testing.T) {
+		env := &models.Environment{SSHHost: "vm1", SSHHosts: []string{"vm2", "vm1"}}
+		if validateStrategy(env) == "" {
+			t.Error("Expected ssh_hosts repeating ssh_host to be rejected")
+		}
+		env.SSHHosts = []string{"vm2", "vm3"}
+		if msg := validateStrategy(env); msg != "" {
+			t.Errorf("Expected distinct hosts to be valid, got %q", msg)
+		}
+		env.PostDeploy = []string{"nginx -s reload", ""}
+		if validateStrategy(env) == "" {
+			t.Error("Expected an empty post_deploy command to be rejected")
+		}
+		env.PostDeploy = nil
+
+		params := models.PipelineRunParams{SSHHosts: env.SSHHosts}
+		target, rollbackParams := rolloutTargets(&models.Project{SSHHost: "vm1"}, params, []string{"vm1", "vm2"})
+		if target.SSHHost != "vm1" || len(rollbackParams.SSHHosts) != 1 || rollbackParams.SSHHosts[0] != "vm2" {
+			t.Errorf("Expected the rollback to target vm1 and vm2, got %q and %v", target.SSHHost, rollbackParams.SSHHosts)
+		}
+	})
+}
+
+func TestEnvironmentVersion(t *testing.T) {
+	ctx := context.Background()
+	s, st := newTestServer()
+	ownerID := createTestUser(t, st, "owner@example.com")
+
+	project, err := st.CreateProject(ctx, &models.NewProject{OwnerID: ownerID, Name: "app", RepoURL: "https://example.com/app.git"})
+	if err != nil {
+		t.Fatalf("Expected no error creating project, got %v", err)
+	}
+	id := strconv.Itoa(project.ID)
+	st.CreateEnvironment(ctx, &models.Environment{ProjectID: project.ID, Name: "production", SSHHost: "prod.example.com"})
+
+	if w := serveProject(s, http.MethodGet, id+"/environments/production/current", ownerID); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 before any deployment, got %d", w.Code)
+	}
+
+	project.RegistryUser = "acme"
+	env, _ := st.GetEnvironment(ctx, project.ID, "production")
+	workspace := t.TempDir()
+	compose := "services:\n  web:\n    build: .\n  db:\n    image: postgres\n"
+	if err := os.WriteFile(filepath.Join(workspace, "docker-compose.yml"), []byte(compose), 0644); err != nil {
+		t.Fatal(err)
+	}
+	params := models.PipelineRunParams{RepoName: "app", Branch: "main", CommitHash: "0123456789abcdef", Environment: "production", DeploymentFilename: "docker-compose.yml"}
+	s.recordEnvironmentVersion(ctx, environmentProject(project, env), params, 7, workspace)
+
+	w := serveProject(s, http.MethodGet, id+"/environments/production/current", ownerID)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	var got models.EnvironmentVersion
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("Expected a version, got %v", err)
+	}
+	if got.PipelineID != 7 || got.CommitHash != "0123456789abcdef" || len(got.Images) != 1 || got.Images[0] != "acme/app-web:0123456789abcdef" {
+		t.Errorf("Expected pipeline 7 with the web image, got %+v", got)
+	}
+}
+
+func TestEnvironmentStop(t *testing.T) {
+	ctx := context.Background()
+	s, st := newTestServer()
+	ownerID := createTestUser(t, st, "owner@example.com")
+	developerID := createTestUser(t, st, "dev@example.com")
+
+	project, err := st.CreateProject(ctx, &models.NewProject{OwnerID: ownerID, Name: "app", RepoURL: "https://example.com/app.git"})
+	if err != nil {
+		t.Fatalf("Expected no error creating project, got %v", err)
+	}
+	id := strconv.Itoa(project.ID)
+	st.AddProjectMember(ctx, project.ID, developerID, RoleDeveloper)
+	st.CreateEnvironment(ctx, &models.Environment{ProjectID: project.ID, Name: "staging"})
+
+	t.Run("DeveloperCannotStop", func(t *testing.T) {
+		if w := serveProject(s, http.MethodPost, id+"/environments/staging/stop", developerID); w.Code != http.StatusForbidden {
+			t.Errorf("Expected status 403, got %d", w.Code)
+		}
+	})
+
+	t.Run("NothingDeployed", func(t *testing.T) {
+		if w := serveProject(s, http.MethodPost, id+"/environments/staging/stop", ownerID); w.Code != http.StatusConflict {
+			t.Errorf("Expected status 409, got %d", w.Code)
+		}
+	})
+
+	t.Run("StoppedUntilNextDeployment", func(t *testing.T) {
+		st.SetEnvironmentVersion(ctx, project.ID, &models.EnvironmentVersion{Environment: "staging", PipelineID: 1, CommitHash: "0123456789abcdef"})
+		st.SetEnvironmentStopped(ctx, project.ID, "staging")
+		if w := serveProject(s, http.MethodGet, id+"/environments/staging/current", ownerID); w.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404 once stopped, got %d", w.Code)
+		}
+		if env, _ := st.GetEnvironment(ctx, project.ID, "staging"); env.StoppedAt == nil {
+			t.Error("Expected the environment to be marked stopped")
+		}
+
+		st.SetEnvironmentVersion(ctx, project.ID, &models.EnvironmentVersion{Environment: "staging", PipelineID: 2, CommitHash: "0123456789abcdef"})
+		if env, _ := st.GetEnvironment(ctx, project.ID, "staging"); env.StoppedAt != nil {
+			t.Error("Expected a deployment to clear the stop")
+		}
+	})
+}
@@ -1,19 +1,37 @@
 package api
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"os"
+	"path"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
 
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/executor"
 	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/git"
 	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/notify"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/secrets"
 	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
 )
 
+// Pagination bounds of the pipeline listing
+const (
+	defaultPipelinePageSize = 50
+	maxPipelinePageSize     = 200
+)
+
 // === Helper Functions ===
 
 // respondJSON sends a JSON response
@@ -25,9 +43,13 @@ func respondJSON(w http.ResponseWriter, status int, data interface{}) {
 	}
 }
 
-// respondError sends an error response
+// respondError sends an error response, with the request ID to quote when reporting it
 func respondError(w http.ResponseWriter, status int, message string) {
-	respondJSON(w, status, map[string]string{"error": message})
+	body := map[string]string{"error": message}
+	if recorder, ok := w.(*statusRecorder); ok {
+		body["request_id"] = recorder.requestID
+	}
+	respondJSON(w, status, body)
 }
 
 // parseIDFromPath extracts an ID from a URL path segment
@@ -39,6 +61,9 @@ func parseIDFromPath(path string, segment int) (int, error) {
 	return strconv.Atoi(parts[segment])
 }
 
+// commitSHAPattern matches full and abbreviated commit hashes
+var commitSHAPattern = regexp.MustCompile(`^[0-9a-fA-F]{7,40}$`)
+
 // sanitizeProjectName sanitizes the project name for Docker Compose
 func sanitizeProjectName(name string) string {
 	name = strings.ToLower(name)
@@ -47,6 +72,70 @@ func sanitizeProjectName(name string) string {
 	return strings.Trim(name, "-")
 }
 
+// validDeploymentMethod reports whether method is a deployment method, empty selecting the default one
+func validDeploymentMethod(method string) bool {
+	switch method {
+	case "", models.DeploymentMethodScript, models.DeploymentMethodContext, models.DeploymentMethodAnsible:
+		return true
+	}
+	return false
+}
+
+// validJobExecutor reports whether executor is a job executor, empty selecting the default one
+func validJobExecutor(executor string) bool {
+	switch executor {
+	case "", models.JobExecutorDocker, models.JobExecutorShell:
+		return true
+	}
+	return false
+}
+
+// validDeploymentFiles reports whether the extra deployment files are paths inside the repository
+func validDeploymentFiles(files []string) bool {
+	for _, name := range files {
+		if !filepath.IsLocal(name) {
+			return false
+		}
+	}
+	return true
+}
+
+// buildPlatformPattern matches a buildx platform, os/arch with an optional variant (e.g. linux/arm/v7)
+var buildPlatformPattern = regexp.MustCompile(`^[a-z0-9]+/[a-z0-9_]+(/[a-z0-9]+)?$`)
+
+// validBuildPlatforms reports whether the build platforms are buildx platforms
+func validBuildPlatforms(platforms []string) bool {
+	for _, platform := range platforms {
+		if !buildPlatformPattern.MatchString(platform) {
+			return false
+		}
+	}
+	return true
+}
+
+// validImageTags reports whether the extra image tags are ImageTag values
+func validImageTags(tags []string) bool {
+	for _, tag := range tags {
+		switch tag {
+		case models.ImageTagLatest, models.ImageTagBranch, models.ImageTagSemver:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// validBranchFilters reports whether the branch filters are non-empty path.Match globs
+// A malformed glob would otherwise silently match no branch.
+func validBranchFilters(filters []string) bool {
+	for _, pattern := range filters {
+		if _, err := path.Match(pattern, ""); pattern == "" || err != nil {
+			return false
+		}
+	}
+	return true
+}
+
 // === Projects Handlers ===
 
 // handleProjects handles /api/v1/projects
@@ -86,7 +175,7 @@ func (s *Server) listVariables(w http.ResponseWriter, r *http.Request, projectID
 		return
 	}
 
-	variables, err := s.db.GetVariablesByProject(projectID)
+	variables, err := s.db.GetVariablesByProject(r.Context(), projectID)
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, "Failed to get variables")
 		return
@@ -116,7 +205,7 @@ func (s *Server) createVariable(w http.ResponseWriter, r *http.Request, projectI
 	}
 
 	v.ProjectID = projectID
-	if err := s.db.CreateVariable(&v); err != nil {
+	if err := s.db.CreateVariable(r.Context(), &v); err != nil {
 		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to create variable: %v", err))
 		return
 	}
@@ -140,21 +229,63 @@ func (s *Server) handleVariable(w http.ResponseWriter, r *http.Request) {
 	}
 	key := parts[5]
 
-	if r.Method == http.MethodDelete {
-		s.deleteVariable(w, r, projectID, key)
-	} else {
+	// Variables scoped to an environment are addressed with ?environment_scope=<name>
+	scope := r.URL.Query().Get("environment_scope")
+	if scope == "" {
+		scope = models.AllEnvironments
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		s.updateVariable(w, r, projectID, key, scope)
+	case http.MethodDelete:
+		s.deleteVariable(w, r, projectID, key, scope)
+	default:
 		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
 	}
 }
 
-func (s *Server) deleteVariable(w http.ResponseWriter, r *http.Request, projectID int, key string) {
+// updateVariable changes the value and/or secret flag of a variable, omitted fields are kept
+func (s *Server) updateVariable(w http.ResponseWriter, r *http.Request, projectID int, key, scope string) {
 	_, err := getUserIDFromContext(r)
 	if err != nil {
 		respondError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	if err := s.db.DeleteVariable(projectID, key); err != nil {
+	var req struct {
+		Value    *string `json:"value"`
+		IsSecret *bool   `json:"is_secret"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	v, err := s.db.UpdateVariable(r.Context(), projectID, key, scope, req.Value, req.IsSecret)
+	if err != nil {
+		if err.Error() == "variable not found" {
+			respondError(w, http.StatusNotFound, "Variable not found")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to update variable: %v", err))
+		return
+	}
+
+	if v.IsSecret {
+		v.Value = "*****"
+	}
+	respondJSON(w, http.StatusOK, v)
+}
+
+func (s *Server) deleteVariable(w http.ResponseWriter, r *http.Request, projectID int, key, scope string) {
+	_, err := getUserIDFromContext(r)
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if err := s.db.DeleteVariable(r.Context(), projectID, key, scope); err != nil {
 		respondError(w, http.StatusInternalServerError, "Failed to delete variable")
 		return
 	}
@@ -195,12 +326,24 @@ func (s *Server) listProjects(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	projects, err := s.db.GetProjectsForUser(userID)
+	projects, err := s.db.GetProjectsForUser(r.Context(), userID)
 	if err != nil {
 		logger.Error("Failed to get projects: " + err.Error())
+		if errors.Is(err, secrets.ErrKeyMismatch) {
+			respondError(w, http.StatusInternalServerError, keyMismatchReason)
+			return
+		}
 		respondError(w, http.StatusInternalServerError, "Failed to get projects")
 		return
 	}
+	for i := range projects {
+		role, err := s.projectRole(r.Context(), &projects[i], userID)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "Failed to check permissions")
+			return
+		}
+		maskProjectSecrets(&projects[i], role)
+	}
 
 	respondJSON(w, http.StatusOK, projects)
 }
@@ -222,6 +365,50 @@ func (s *Server) createProject(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusBadRequest, "Name and repo_url are required")
 		return
 	}
+	if !notify.ValidSlackEvents(newProject.SlackEvents) {
+		respondError(w, http.StatusBadRequest, "slack_events must be failed, all or deploy")
+		return
+	}
+	if !validDeploymentFiles(newProject.DeploymentFiles) {
+		respondError(w, http.StatusBadRequest, "deployment_files must be relative paths inside the repository")
+		return
+	}
+	if !validDeploymentMethod(newProject.DeploymentMethod) {
+		respondError(w, http.StatusBadRequest, "deployment_method must be script or context")
+		return
+	}
+	if !validBuildPlatforms(newProject.BuildPlatforms) {
+		respondError(w, http.StatusBadRequest, "build_platforms must be os/arch platforms, e.g. linux/arm64")
+		return
+	}
+	if !validImageTags(newProject.ImageTags) {
+		respondError(w, http.StatusBadRequest, "image_tags must be latest, branch or semver")
+		return
+	}
+	if !validJobExecutor(newProject.JobExecutor) {
+		respondError(w, http.StatusBadRequest, "job_executor must be docker or shell")
+		return
+	}
+	if !validBranchFilters(newProject.BranchFilters) {
+		respondError(w, http.StatusBadRequest, "branch_filters must be valid branch globs")
+		return
+	}
+	if newProject.PipelineTimeoutSeconds < 0 {
+		respondError(w, http.StatusBadRequest, "pipeline_timeout_seconds must not be negative")
+		return
+	}
+	if newProject.RetentionDays < 0 {
+		respondError(w, http.StatusBadRequest, "retention_days must not be negative")
+		return
+	}
+	if !validRetentionAction(newProject.RetentionAction) {
+		respondError(w, http.StatusBadRequest, "retention_action must be delete or archive")
+		return
+	}
+
+	if newProject.GitHubInstallationID != 0 && !s.checkInstallation(w, r, newProject.GitHubInstallationID, newProject.RepoURL) {
+		return
+	}
 
 	userID, err := getUserIDFromContext(r)
 	if err != nil {
@@ -230,7 +417,7 @@ func (s *Server) createProject(w http.ResponseWriter, r *http.Request) {
 	}
 	newProject.OwnerID = userID
 
-	project, err := s.db.CreateProject(&newProject)
+	project, err := s.db.CreateProject(r.Context(), &newProject)
 	if err != nil {
 		logger.Error("Failed to create project: " + err.Error())
 		respondError(w, http.StatusInternalServerError, "Failed to create project")
@@ -253,34 +440,19 @@ func (s *Server) getProject(w http.ResponseWriter, r *http.Request, projectID in
 		return
 	}
 
-	project, err := s.db.GetProject(projectID)
+	project, err := s.db.GetProject(r.Context(), projectID)
 	if err != nil {
 		respondError(w, http.StatusNotFound, "Project not found")
 		return
 	}
 
-	// Check access permissions (Owner or Member)
-	if project.OwnerID != userID {
-		members, err := s.db.GetProjectMembers(projectID)
-		if err != nil {
-			logger.Error("Failed to check membership: " + err.Error())
-			respondError(w, http.StatusInternalServerError, "Failed to check permissions")
-			return
-		}
-
-		isMember := false
-		for _, m := range members {
-			if m.UserID == userID {
-				isMember = true
-				break
-			}
-		}
-
-		if !isMember {
-			respondError(w, http.StatusForbidden, "You do not have access to this project")
-			return
-		}
+	// Access was checked by the router, the role only decides which credentials are shown
+	role, err := s.projectRole(r.Context(), project, userID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to check permissions")
+		return
 	}
+	maskProjectSecrets(project, role)
 
 	respondJSON(w, http.StatusOK, project)
 }
@@ -292,35 +464,70 @@ func (s *Server) updateProject(w http.ResponseWriter, r *http.Request, projectID
 		return
 	}
 
-	userID, err := getUserIDFromContext(r)
-	if err != nil {
-		respondError(w, http.StatusUnauthorized, "Unauthorized")
+	var updateData models.NewProject
+	if err := json.NewDecoder(r.Body).Decode(&updateData); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
-	existingProject, err := s.db.GetProject(projectID)
-	if err != nil {
-		respondError(w, http.StatusNotFound, "Project not found")
+	if updateData.Name == "" || updateData.RepoURL == "" {
+		respondError(w, http.StatusBadRequest, "Name and repo_url are required")
 		return
 	}
-
-	if existingProject.OwnerID != userID {
-		respondError(w, http.StatusForbidden, "You are not the owner of this project")
+	if !notify.ValidSlackEvents(updateData.SlackEvents) {
+		respondError(w, http.StatusBadRequest, "slack_events must be failed, all or deploy")
 		return
 	}
-
-	var updateData models.NewProject
-	if err := json.NewDecoder(r.Body).Decode(&updateData); err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid request body")
+	if !validDeploymentFiles(updateData.DeploymentFiles) {
+		respondError(w, http.StatusBadRequest, "deployment_files must be relative paths inside the repository")
 		return
 	}
-
-	if updateData.Name == "" || updateData.RepoURL == "" {
-		respondError(w, http.StatusBadRequest, "Name and repo_url are required")
+	if !validDeploymentMethod(updateData.DeploymentMethod) {
+		respondError(w, http.StatusBadRequest, "deployment_method must be script or context")
+		return
+	}
+	if !validBuildPlatforms(updateData.BuildPlatforms) {
+		respondError(w, http.StatusBadRequest, "build_platforms must be os/arch platforms, e.g. linux/arm64")
+		return
+	}
+	if !validImageTags(updateData.ImageTags) {
+		respondError(w, http.StatusBadRequest, "image_tags must be latest, branch or semver")
+		return
+	}
+	if !validJobExecutor(updateData.JobExecutor) {
+		respondError(w, http.StatusBadRequest, "job_executor must be docker or shell")
+		return
+	}
+	if !validBranchFilters(updateData.BranchFilters) {
+		respondError(w, http.StatusBadRequest, "branch_filters must be valid branch globs")
+		return
+	}
+	if updateData.PipelineTimeoutSeconds < 0 {
+		respondError(w, http.StatusBadRequest, "pipeline_timeout_seconds must not be negative")
 		return
 	}
+	if updateData.RetentionDays < 0 {
+		respondError(w, http.StatusBadRequest, "retention_days must not be negative")
+		return
+	}
+	if !validRetentionAction(updateData.RetentionAction) {
+		respondError(w, http.StatusBadRequest, "retention_action must be delete or archive")
+		return
+	}
+
+	if updateData.GitHubInstallationID != 0 {
+		current, err := s.db.GetProject(r.Context(), projectID)
+		if err != nil {
+			respondError(w, http.StatusNotFound, "Project not found")
+			return
+		}
+		changed := current.GitHubInstallationID != updateData.GitHubInstallationID || current.RepoURL != updateData.RepoURL
+		if changed && !s.checkInstallation(w, r, updateData.GitHubInstallationID, updateData.RepoURL) {
+			return
+		}
+	}
 
-	project, err := s.db.UpdateProject(projectID, &updateData)
+	project, err := s.db.UpdateProject(r.Context(), projectID, &updateData)
 	if err != nil {
 		logger.Error("Failed to update project: " + err.Error())
 		respondError(w, http.StatusInternalServerError, "Failed to update project")
@@ -330,6 +537,16 @@ func (s *Server) updateProject(w http.ResponseWriter, r *http.Request, projectID
 	respondJSON(w, http.StatusOK, project)
 }
 
+// checkInstallation rejects a GitHub App installation not giving access to the repository of a project
+// Otherwise any user could link their project to the installation of another account and clone its repositories.
+func (s *Server) checkInstallation(w http.ResponseWriter, r *http.Request, installationID int64, repoURL string) bool {
+	if err := s.githubApp.CheckInstallation(r.Context(), installationID, repoURL); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid github_installation_id: "+err.Error())
+		return false
+	}
+	return true
+}
+
 // deleteProject deletes a project
 func (s *Server) deleteProject(w http.ResponseWriter, r *http.Request, projectID int) {
 	if s.db == nil {
@@ -337,26 +554,12 @@ func (s *Server) deleteProject(w http.ResponseWriter, r *http.Request, projectID
 		return
 	}
 
-	userID, err := getUserIDFromContext(r)
-	if err != nil {
-		respondError(w, http.StatusUnauthorized, "Unauthorized")
-		return
-	}
-
-	existingProject, err := s.db.GetProject(projectID)
-	if err != nil {
+	if err := s.db.DeleteProject(r.Context(), projectID); err != nil {
 		respondError(w, http.StatusNotFound, "Project not found")
 		return
 	}
-
-	if existingProject.OwnerID != userID {
-		respondError(w, http.StatusForbidden, "You are not the owner of this project")
-		return
-	}
-
-	if err := s.db.DeleteProject(projectID); err != nil {
-		respondError(w, http.StatusNotFound, "Project not found")
-		return
+	if err := s.cloneCache.Remove(cloneCacheKey(projectID)); err != nil {
+		logger.Warn(fmt.Sprintf("Failed to remove the clone cache of project %d: %v", projectID, err))
 	}
 
 	w.WriteHeader(http.StatusNoContent)
@@ -413,7 +616,7 @@ func (s *Server) listProjectMembers(w http.ResponseWriter, r *http.Request, proj
 		return
 	}
 
-	members, err := s.db.GetProjectMembers(projectID)
+	members, err := s.db.GetProjectMembers(r.Context(), projectID)
 	if err != nil {
 		logger.Error("Failed to get project members: " + err.Error())
 		respondError(w, http.StatusInternalServerError, "Failed to get project members")
@@ -430,23 +633,6 @@ func (s *Server) inviteMember(w http.ResponseWriter, r *http.Request, projectID
 		return
 	}
 
-	userID, err := getUserIDFromContext(r)
-	if err != nil {
-		respondError(w, http.StatusUnauthorized, "Unauthorized")
-		return
-	}
-
-	project, err := s.db.GetProject(projectID)
-	if err != nil {
-		respondError(w, http.StatusNotFound, "Project not found")
-		return
-	}
-
-	if project.OwnerID != userID {
-		respondError(w, http.StatusForbidden, "Only the owner can invite members")
-		return
-	}
-
 	var reqBody struct {
 		Email string `json:"email"`
 		Role  string `json:"role"`
@@ -461,16 +647,20 @@ func (s *Server) inviteMember(w http.ResponseWriter, r *http.Request, projectID
 		return
 	}
 	if reqBody.Role == "" {
-		reqBody.Role = "viewer"
+		reqBody.Role = RoleViewer
+	}
+	if !validMemberRole(reqBody.Role) {
+		respondError(w, http.StatusBadRequest, "role must be viewer, developer or maintainer")
+		return
 	}
 
-	userToInvite, err := s.db.GetUserByEmail(reqBody.Email)
+	userToInvite, err := s.db.GetUserByEmail(r.Context(), reqBody.Email)
 	if err != nil {
 		respondError(w, http.StatusNotFound, "User not found. They must sign in first.")
 		return
 	}
 
-	if err := s.db.AddProjectMember(projectID, userToInvite.ID, reqBody.Role); err != nil {
+	if err := s.db.AddProjectMember(r.Context(), projectID, userToInvite.ID, reqBody.Role); err != nil {
 		logger.Error("Failed to add member: " + err.Error())
 		respondError(w, http.StatusInternalServerError, "Failed to add member")
 		return
@@ -486,29 +676,114 @@ func (s *Server) removeProjectMember(w http.ResponseWriter, r *http.Request, pro
 		return
 	}
 
-	userID, err := getUserIDFromContext(r)
+	if err := s.db.RemoveProjectMember(r.Context(), projectID, targetUserID); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to remove member")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleTransferProject gives a project to a new owner, POST /api/v1/projects/{projectId}/transfer
+// The previous owner stays a maintainer of the project, and can then be removed like any member.
+func (s *Server) handleTransferProject(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if s.db == nil {
+		respondError(w, http.StatusServiceUnavailable, "Database not available")
+		return
+	}
+
+	projectID, err := parseIDFromPath(r.URL.Path, 3)
 	if err != nil {
-		respondError(w, http.StatusUnauthorized, "Unauthorized")
+		respondError(w, http.StatusBadRequest, "Invalid project ID")
 		return
 	}
 
-	project, err := s.db.GetProject(projectID)
+	var reqBody struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if reqBody.Email == "" {
+		respondError(w, http.StatusBadRequest, "Email is required")
+		return
+	}
+
+	newOwner, err := s.db.GetUserByEmail(r.Context(), reqBody.Email)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "User not found. They must sign in first.")
+		return
+	}
+	project, err := s.db.GetProject(r.Context(), projectID)
 	if err != nil {
 		respondError(w, http.StatusNotFound, "Project not found")
 		return
 	}
+	if project.OwnerID == newOwner.ID {
+		respondError(w, http.StatusBadRequest, "User already owns this project")
+		return
+	}
 
-	if project.OwnerID != userID {
-		respondError(w, http.StatusForbidden, "Only the owner can remove members")
+	if err := s.db.TransferProjectOwnership(r.Context(), projectID, newOwner.ID); err != nil {
+		logger.Error("Failed to transfer project: " + err.Error())
+		respondError(w, http.StatusInternalServerError, "Failed to transfer project")
 		return
 	}
+	logger.Info(fmt.Sprintf("Project %d transferred from user %d to user %d", projectID, project.OwnerID, newOwner.ID))
 
-	if err := s.db.RemoveProjectMember(projectID, targetUserID); err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to remove member")
+	project, err = s.db.GetProject(r.Context(), projectID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	respondJSON(w, http.StatusOK, project)
+}
 
-	w.WriteHeader(http.StatusNoContent)
+// === Branches Handlers ===
+
+// handleBranches lists the remote branches of a project, GET /api/v1/projects/{projectId}/branches
+func (s *Server) handleBranches(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if s.db == nil {
+		respondError(w, http.StatusServiceUnavailable, "Database not available")
+		return
+	}
+
+	projectID, err := parseIDFromPath(r.URL.Path, 3)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid project ID")
+		return
+	}
+	project, err := s.db.GetProject(r.Context(), projectID)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Project not found")
+		return
+	}
+	accessToken, err := s.githubApp.RepoToken(r.Context(), project)
+	if err != nil {
+		respondError(w, http.StatusBadGateway, "Failed to get GitHub App installation token: "+err.Error())
+		return
+	}
+
+	branches, defaultBranch, err := git.ListRemoteBranches(project.RepoURL, git.Auth{Token: accessToken, DeployKey: project.DeployKey})
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to list branches of project %d: %v", projectID, err))
+		respondError(w, http.StatusBadGateway, "Failed to list remote branches")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"default_branch": defaultBranch,
+		"branches":       branches,
+	})
 }
 
 // === Pipelines Handlers ===
@@ -563,19 +838,52 @@ func (s *Server) listPipelines(w http.ResponseWriter, r *http.Request, projectID
 	}
 
 	// Verify project exists
-	_, err := s.db.GetProject(projectID)
+	_, err := s.db.GetProject(r.Context(), projectID)
 	if err != nil {
 		respondError(w, http.StatusNotFound, "Project not found")
 		return
 	}
 
-	pipelines, err := s.db.GetPipelinesByProject(projectID)
+	// Query params: ?status=failed&branch=main&limit=50&offset=0
+	query := r.URL.Query()
+	filter := models.PipelineFilter{
+		Status: query.Get("status"),
+		Branch: query.Get("branch"),
+		Limit:  defaultPipelinePageSize,
+	}
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxPipelinePageSize {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxPipelinePageSize))
+			return
+		}
+		filter.Limit = limit
+	}
+	if raw := query.Get("offset"); raw != "" {
+		offset, err := strconv.Atoi(raw)
+		if err != nil || offset < 0 {
+			respondError(w, http.StatusBadRequest, "offset must be a positive integer")
+			return
+		}
+		filter.Offset = offset
+	}
+
+	pipelines, err := s.db.GetPipelinesByProject(r.Context(), projectID, filter)
 	if err != nil {
 		logger.Error("Failed to get pipelines: " + err.Error())
 		respondError(w, http.StatusInternalServerError, "Failed to get pipelines")
 		return
 	}
 
+	total, err := s.db.CountPipelinesByProject(r.Context(), projectID, filter)
+	if err != nil {
+		logger.Error("Failed to count pipelines: " + err.Error())
+		respondError(w, http.StatusInternalServerError, "Failed to get pipelines")
+		return
+	}
+
+	// The body stays a plain array; the total is exposed as a header for pagination controls
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
 	respondJSON(w, http.StatusOK, pipelines)
 }
 
@@ -587,7 +895,7 @@ func (s *Server) triggerPipeline(w http.ResponseWriter, r *http.Request, project
 	}
 
 	// Get project
-	project, err := s.db.GetProject(projectID)
+	project, err := s.db.GetProject(r.Context(), projectID)
 	if err != nil {
 		respondError(w, http.StatusNotFound, "Project not found")
 		return
@@ -596,6 +904,8 @@ func (s *Server) triggerPipeline(w http.ResponseWriter, r *http.Request, project
 	// Parse request body
 	var reqBody struct {
 		Branch string `json:"branch"`
+		// CommitSHA rebuilds a past commit of the branch instead of its head
+		CommitSHA string `json:"commit_sha"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
 		reqBody.Branch = "main" // Default branch
@@ -603,29 +913,104 @@ func (s *Server) triggerPipeline(w http.ResponseWriter, r *http.Request, project
 	if reqBody.Branch == "" {
 		reqBody.Branch = "main"
 	}
+	if reqBody.CommitSHA != "" && !commitSHAPattern.MatchString(reqBody.CommitSHA) {
+		respondError(w, http.StatusBadRequest, "commit_sha must be a hexadecimal commit hash of 7 to 40 characters")
+		return
+	}
 
-	// Get latest commit hash
-	commitHash, err := git.GetRemoteHeadHash(project.RepoURL, reqBody.Branch, project.AccessToken)
+	// Retries carrying the Idempotency-Key of an earlier request get its pipeline instead of a new one
+	// The key is released when the request fails, so the retry triggers the pipeline.
+	idempotencyKey := r.Header.Get("Idempotency-Key")
+	if len(idempotencyKey) > maxIdempotencyKeyLength {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("Idempotency-Key must be at most %d characters", maxIdempotencyKeyLength))
+		return
+	}
+	queued := false
+	if idempotencyKey != "" {
+		claimed, existingID, err := s.db.ClaimIdempotencyKey(r.Context(), projectID, idempotencyKey)
+		if err != nil {
+			logger.Error("Failed to claim idempotency key: " + err.Error())
+			respondError(w, http.StatusInternalServerError, "Failed to record the idempotency key")
+			return
+		}
+		if !claimed {
+			s.respondIdempotentPipeline(w, r, projectID, existingID)
+			return
+		}
+		defer func() {
+			if !queued {
+				s.db.ReleaseIdempotencyKey(context.WithoutCancel(r.Context()), projectID, idempotencyKey)
+			}
+		}()
+	}
+
+	accessToken, err := s.githubApp.RepoToken(r.Context(), project)
 	if err != nil {
-		logger.Error("Failed to get latest commit hash: " + err.Error())
-		respondError(w, http.StatusInternalServerError, "Failed to get latest commit hash")
+		respondError(w, http.StatusBadGateway, "Failed to get GitHub App installation token: "+err.Error())
 		return
 	}
 
+	var commitHash string
+	if reqBody.CommitSHA != "" {
+		// The commit must be part of the branch, so the pipeline runs what the branch actually contained
+		commitHash, err = git.ResolveBranchCommit(project.RepoURL, reqBody.Branch, git.Auth{Token: accessToken, DeployKey: project.DeployKey}, reqBody.CommitSHA)
+		if err != nil {
+			logger.Error("Failed to resolve commit: " + err.Error())
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("Commit %s not found on branch %s", reqBody.CommitSHA, reqBody.Branch))
+			return
+		}
+	} else {
+		// Get latest commit hash
+		commitHash, err = git.GetRemoteHeadHash(project.RepoURL, reqBody.Branch, git.Auth{Token: accessToken, DeployKey: project.DeployKey})
+		if err != nil {
+			logger.Error("Failed to get latest commit hash: " + err.Error())
+			respondError(w, http.StatusInternalServerError, "Failed to get latest commit hash")
+			return
+		}
+	}
+
 	// Create pipeline record
-	pipeline, err := s.db.CreatePipeline(projectID, reqBody.Branch, commitHash)
+	pipeline, err := s.db.CreatePipeline(r.Context(), projectID, reqBody.Branch, commitHash)
 	if err != nil {
 		logger.Error("Failed to create pipeline: " + err.Error())
 		respondError(w, http.StatusInternalServerError, "Failed to create pipeline")
 		return
 	}
+	if idempotencyKey != "" {
+		if err := s.db.SetIdempotencyKeyPipeline(r.Context(), projectID, idempotencyKey, pipeline.ID); err != nil {
+			logger.Error("Failed to link idempotency key: " + err.Error())
+		}
+	}
 
-	// Trigger pipeline execution asynchronously
-	go s.runPipelineFromManualTrigger(project, pipeline, reqBody.Branch)
+	// Queue pipeline execution
+	if err := s.queuePipelineFromManualTrigger(r.Context(), project, pipeline, reqBody.Branch); err != nil {
+		respondError(w, http.StatusServiceUnavailable, "Pipeline queue is full, try again later")
+		return
+	}
+	pipeline.Status = "queued"
+	queued = true
 
 	respondJSON(w, http.StatusCreated, pipeline)
 }
 
+// maxIdempotencyKeyLength bounds the Idempotency-Key header of manual triggers
+const maxIdempotencyKeyLength = 255
+
+// respondIdempotentPipeline answers a retried manual trigger with the pipeline of the first request, 409 while that request is in progress
+func (s *Server) respondIdempotentPipeline(w http.ResponseWriter, r *http.Request, projectID, pipelineID int) {
+	if pipelineID == 0 {
+		respondError(w, http.StatusConflict, "A request with this Idempotency-Key is still in progress")
+		return
+	}
+	pipeline, err := s.db.GetPipeline(r.Context(), pipelineID)
+	if err != nil || pipeline.ProjectID != projectID {
+		respondError(w, http.StatusNotFound, "Pipeline not found")
+		return
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	respondJSON(w, http.StatusOK, pipeline)
+}
+
 // getPipeline returns a specific pipeline
 func (s *Server) getPipeline(w http.ResponseWriter, r *http.Request, projectID, pipelineID int) {
 	if s.db == nil {
@@ -634,13 +1019,13 @@ func (s *Server) getPipeline(w http.ResponseWriter, r *http.Request, projectID,
 	}
 
 	// Verify project exists
-	_, err := s.db.GetProject(projectID)
+	_, err := s.db.GetProject(r.Context(), projectID)
 	if err != nil {
 		respondError(w, http.StatusNotFound, "Project not found")
 		return
 	}
 
-	pipeline, err := s.db.GetPipeline(pipelineID)
+	pipeline, err := s.db.GetPipeline(r.Context(), pipelineID)
 	if err != nil {
 		respondError(w, http.StatusNotFound, "Pipeline not found")
 		return
@@ -655,6 +1040,127 @@ func (s *Server) getPipeline(w http.ResponseWriter, r *http.Request, projectID,
 	respondJSON(w, http.StatusOK, pipeline)
 }
 
+// handleCancelPipeline handles /api/v1/projects/{projectId}/pipelines/{pipelineId}/cancel
+func (s *Server) handleCancelPipeline(w http.ResponseWriter, r *http.Request) {
+	projectID, err := parseIDFromPath(r.URL.Path, 3)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid project ID")
+		return
+	}
+
+	pipelineID, err := parseIDFromPath(r.URL.Path, 5)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid pipeline ID")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		s.cancelPipeline(w, r, projectID, pipelineID)
+	default:
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// cancelPipeline cancels a pending or running pipeline
+func (s *Server) cancelPipeline(w http.ResponseWriter, r *http.Request, projectID, pipelineID int) {
+	if s.db == nil {
+		respondError(w, http.StatusServiceUnavailable, "Database not available")
+		return
+	}
+
+	pipeline, err := s.db.GetPipeline(r.Context(), pipelineID)
+	if err != nil || pipeline.ProjectID != projectID {
+		respondError(w, http.StatusNotFound, "Pipeline not found")
+		return
+	}
+
+	if pipeline.Status != "pending" && pipeline.Status != "queued" && pipeline.Status != "running" && pipeline.Status != "manual" {
+		respondError(w, http.StatusConflict, "Pipeline is not running")
+		return
+	}
+
+	s.requestCancel(pipelineID)
+
+	respondJSON(w, http.StatusAccepted, map[string]string{"message": "Pipeline cancellation requested"})
+}
+
+// handleRetryPipeline handles /api/v1/projects/{projectId}/pipelines/{pipelineId}/retry
+func (s *Server) handleRetryPipeline(w http.ResponseWriter, r *http.Request) {
+	projectID, err := parseIDFromPath(r.URL.Path, 3)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid project ID")
+		return
+	}
+
+	pipelineID, err := parseIDFromPath(r.URL.Path, 5)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid pipeline ID")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		s.retryPipeline(w, r, projectID, pipelineID)
+	default:
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// retryPipeline creates and runs a new pipeline for the commit and branch of a finished one
+func (s *Server) retryPipeline(w http.ResponseWriter, r *http.Request, projectID, pipelineID int) {
+	if s.db == nil {
+		respondError(w, http.StatusServiceUnavailable, "Database not available")
+		return
+	}
+
+	project, err := s.db.GetProject(r.Context(), projectID)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Project not found")
+		return
+	}
+
+	original, err := s.db.GetPipeline(r.Context(), pipelineID)
+	if err != nil || original.ProjectID != projectID {
+		respondError(w, http.StatusNotFound, "Pipeline not found")
+		return
+	}
+
+	// Optional body: {"failed_only": true} to skip stages that already succeeded
+	var reqBody struct {
+		FailedOnly bool `json:"failed_only"`
+	}
+	json.NewDecoder(r.Body).Decode(&reqBody)
+
+	if original.Status != "failed" && original.Status != "cancelled" {
+		respondError(w, http.StatusConflict, "Only failed or cancelled pipelines can be retried")
+		return
+	}
+
+	pipeline, err := s.db.CreatePipeline(r.Context(), projectID, original.Branch, original.CommitHash)
+	if err != nil {
+		logger.Error("Failed to create pipeline: " + err.Error())
+		respondError(w, http.StatusInternalServerError, "Failed to create pipeline")
+		return
+	}
+	// The retry runs for the same push as the original, tag and changed files included
+	pipeline.Tag, pipeline.DefaultBranch, pipeline.ChangedFiles = original.Tag, original.DefaultBranch, original.ChangedFiles
+	if err := s.db.SetPipelineTrigger(r.Context(), pipeline.ID, pipeline.Tag, pipeline.DefaultBranch, pipeline.ChangedFiles); err != nil {
+		logger.Error(fmt.Sprintf("Failed to record the push of pipeline %d: %v", pipeline.ID, err))
+	}
+
+	logger.Info(fmt.Sprintf("Retrying pipeline %d as pipeline %d", original.ID, pipeline.ID))
+
+	// Queue pipeline execution
+	if err := s.queuePipelineFromRetry(r.Context(), project, pipeline, reqBody.FailedOnly); err != nil {
+		respondError(w, http.StatusServiceUnavailable, "Pipeline queue is full, try again later")
+		return
+	}
+	pipeline.Status = "queued"
+
+	respondJSON(w, http.StatusCreated, pipeline)
+}
+
 // === Jobs Handlers ===
 
 // handleJobs handles /api/v1/projects/{projectId}/pipelines/{pipelineId}/jobs
@@ -717,20 +1223,20 @@ func (s *Server) listJobs(w http.ResponseWriter, r *http.Request, projectID, pip
 	}
 
 	// Verify project exists
-	_, err := s.db.GetProject(projectID)
+	_, err := s.db.GetProject(r.Context(), projectID)
 	if err != nil {
 		respondError(w, http.StatusNotFound, "Project not found")
 		return
 	}
 
 	// Verify pipeline exists and belongs to project
-	pipeline, err := s.db.GetPipeline(pipelineID)
+	pipeline, err := s.db.GetPipeline(r.Context(), pipelineID)
 	if err != nil || pipeline.ProjectID != projectID {
 		respondError(w, http.StatusNotFound, "Pipeline not found")
 		return
 	}
 
-	jobs, err := s.db.GetJobsByPipeline(pipelineID)
+	jobs, err := s.db.GetJobsByPipeline(r.Context(), pipelineID)
 	if err != nil {
 		logger.Error("Failed to get jobs: " + err.Error())
 		respondError(w, http.StatusInternalServerError, "Failed to get jobs")
@@ -748,20 +1254,20 @@ func (s *Server) getJob(w http.ResponseWriter, r *http.Request, projectID, pipel
 	}
 
 	// Verify project exists
-	_, err := s.db.GetProject(projectID)
+	_, err := s.db.GetProject(r.Context(), projectID)
 	if err != nil {
 		respondError(w, http.StatusNotFound, "Project not found")
 		return
 	}
 
 	// Verify pipeline exists and belongs to project
-	pipeline, err := s.db.GetPipeline(pipelineID)
+	pipeline, err := s.db.GetPipeline(r.Context(), pipelineID)
 	if err != nil || pipeline.ProjectID != projectID {
 		respondError(w, http.StatusNotFound, "Pipeline not found")
 		return
 	}
 
-	job, err := s.db.GetJob(jobID)
+	job, err := s.db.GetJob(r.Context(), jobID)
 	if err != nil {
 		respondError(w, http.StatusNotFound, "Job not found")
 		return
@@ -776,6 +1282,91 @@ func (s *Server) getJob(w http.ResponseWriter, r *http.Request, projectID, pipel
 	respondJSON(w, http.StatusOK, job)
 }
 
+// handleJobPlay handles /api/v1/projects/{projectId}/pipelines/{pipelineId}/jobs/{jobId}/play
+func (s *Server) handleJobPlay(w http.ResponseWriter, r *http.Request) {
+	projectID, err := parseIDFromPath(r.URL.Path, 3)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid project ID")
+		return
+	}
+
+	pipelineID, err := parseIDFromPath(r.URL.Path, 5)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid pipeline ID")
+		return
+	}
+
+	jobID, err := parseIDFromPath(r.URL.Path, 7)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid job ID")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		s.playJob(w, r, projectID, pipelineID, jobID)
+	default:
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// playJob starts a manual job waiting for approval
+func (s *Server) playJob(w http.ResponseWriter, r *http.Request, projectID, pipelineID, jobID int) {
+	if s.db == nil {
+		respondError(w, http.StatusServiceUnavailable, "Database not available")
+		return
+	}
+
+	pipeline, err := s.db.GetPipeline(r.Context(), pipelineID)
+	if err != nil || pipeline.ProjectID != projectID {
+		respondError(w, http.StatusNotFound, "Pipeline not found")
+		return
+	}
+
+	job, err := s.db.GetJob(r.Context(), jobID)
+	if err != nil || job.PipelineID != pipelineID {
+		respondError(w, http.StatusNotFound, "Job not found")
+		return
+	}
+
+	if job.Status != "manual" {
+		respondError(w, http.StatusConflict, "Job is not a manual job waiting to be played")
+		return
+	}
+
+	resume, err := s.pipelineExecutor.Play(r.Context(), jobID, pipelineID)
+	if errors.Is(err, executor.ErrNotWaiting) {
+		respondError(w, http.StatusConflict, "Job is not waiting to be played")
+		return
+	}
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to play job %d: %v", jobID, err))
+		respondError(w, http.StatusInternalServerError, "Failed to play job")
+		return
+	}
+
+	// The pipeline was parked on its manual jobs, a worker resumes it
+	if resume {
+		project, err := s.db.GetProject(r.Context(), projectID)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to get project of pipeline %d: %v", pipelineID, err))
+			s.failPipeline(pipelineID, "Failed to resume the pipeline: "+err.Error())
+			respondError(w, http.StatusInternalServerError, "Failed to resume pipeline")
+			return
+		}
+		params := manualRunParams(project, pipeline, pipeline.Branch)
+		// Protected environments are checked against the user playing the job
+		params.TriggeredBy, _ = r.Context().Value("userID").(int)
+		if err := s.enqueuePipeline(params); err != nil {
+			respondError(w, http.StatusServiceUnavailable, "Pipeline queue is full, try again later")
+			return
+		}
+	}
+
+	logger.Info(fmt.Sprintf("Manual job %d of pipeline %d played", jobID, pipelineID))
+	respondJSON(w, http.StatusAccepted, map[string]string{"message": "Job started"})
+}
+
 // === Logs Handlers ===
 
 // handleLogs handles /api/v1/projects/{projectId}/pipelines/{pipelineId}/jobs/{jobId}/logs
@@ -815,27 +1406,27 @@ func (s *Server) getJobLogs(w http.ResponseWriter, r *http.Request, projectID, p
 	}
 
 	// Verify project exists
-	_, err := s.db.GetProject(projectID)
+	_, err := s.db.GetProject(r.Context(), projectID)
 	if err != nil {
 		respondError(w, http.StatusNotFound, "Project not found")
 		return
 	}
 
 	// Verify pipeline exists and belongs to project
-	pipeline, err := s.db.GetPipeline(pipelineID)
+	pipeline, err := s.db.GetPipeline(r.Context(), pipelineID)
 	if err != nil || pipeline.ProjectID != projectID {
 		respondError(w, http.StatusNotFound, "Pipeline not found")
 		return
 	}
 
 	// Verify job exists and belongs to pipeline
-	job, err := s.db.GetJob(jobID)
+	job, err := s.db.GetJob(r.Context(), jobID)
 	if err != nil || job.PipelineID != pipelineID {
 		respondError(w, http.StatusNotFound, "Job not found")
 		return
 	}
 
-	logs, err := s.db.GetLogsByJob(jobID)
+	logs, err := s.db.GetLogsByJob(r.Context(), jobID)
 	if err != nil {
 		logger.Error("Failed to get logs: " + err.Error())
 		respondError(w, http.StatusInternalServerError, "Failed to get logs")
@@ -868,13 +1459,13 @@ func (s *Server) handleDeployment(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Verify project exists
-	_, err = s.db.GetProject(projectID)
+	_, err = s.db.GetProject(r.Context(), projectID)
 	if err != nil {
 		respondError(w, http.StatusNotFound, "Project not found")
 		return
 	}
 
-	deployment, err := s.db.GetDeploymentByPipeline(pipelineID)
+	deployment, err := s.db.GetDeploymentByPipeline(r.Context(), pipelineID)
 	if err != nil {
 		log.Printf("Failed to get deployment: %v", err)
 		respondError(w, http.StatusInternalServerError, "Failed to get deployment")
@@ -910,13 +1501,13 @@ func (s *Server) handleDeploymentLogs(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Verify project exists
-	_, err = s.db.GetProject(projectID)
+	_, err = s.db.GetProject(r.Context(), projectID)
 	if err != nil {
 		respondError(w, http.StatusNotFound, "Project not found")
 		return
 	}
 
-	logs, err := s.db.GetDeploymentLogs(pipelineID)
+	logs, err := s.db.GetDeploymentLogs(r.Context(), pipelineID)
 	if err != nil {
 		log.Printf("Failed to get deployment logs: %v", err)
 		respondError(w, http.StatusInternalServerError, "Failed to get deployment logs")
@@ -926,63 +1517,130 @@ func (s *Server) handleDeploymentLogs(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, logs)
 }
 
+// handlePullRequestEvent tears down the previews of the source branch of closed pull requests
+// Other actions are ignored, pull requests are built by the pushes to their branch.
+func (s *Server) handlePullRequestEvent(ctx context.Context, delivery *models.WebhookDelivery) (int, map[string]string) {
+	var event models.PullRequestEvent
+	if err := json.Unmarshal([]byte(delivery.Payload), &event); err != nil {
+		logger.Error("Failed to parse webhook payload: " + err.Error())
+		delivery.Status, delivery.Reason = "failed", "Invalid payload: "+err.Error()
+		return http.StatusBadRequest, map[string]string{"error": "Invalid payload"}
+	}
+	s.resolveDeliveryProject(ctx, delivery, event.Repository.CloneURL)
+
+	if event.Action == "closed" && event.PullRequest.Head.Ref != "" {
+		logger.Info(fmt.Sprintf("Pull request #%d closed, tearing down the previews of branch %s", event.Number, event.PullRequest.Head.Ref))
+		s.closeBranchPreviews(ctx, event.Repository.CloneURL, event.PullRequest.Head.Ref)
+		delivery.Status = "handled"
+		return http.StatusOK, map[string]string{"message": "previews torn down"}
+	}
+	delivery.Status, delivery.Reason = "ignored", fmt.Sprintf("Pull request action %s is ignored, the pushes to the branch are built", event.Action)
+	return http.StatusOK, map[string]string{"message": "event ignored"}
+}
+
 // === System Handlers ===
 
-// handleHealth is a simple health check endpoint
-func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+// handleQueue returns the depth and worker usage of the pipeline queue
+func (s *Server) handleQueue(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	respondJSON(w, http.StatusOK, s.queue.Stats())
 }
 
 // handleGitHubWebhook handles incoming GitHub push webhooks
+// Every delivery is recorded with its outcome, see deliveries.go.
 func (s *Server) handleGitHubWebhook(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Check GitHub event type
-	eventType := r.Header.Get("X-GitHub-Event")
-	if eventType != "push" {
-		logger.Info("Ignoring non-push event: " + eventType)
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookPayload))
+	if err != nil {
+		logger.Error("Failed to read webhook payload: " + err.Error())
+		http.Error(w, "Invalid payload", http.StatusBadRequest)
+		return
+	}
+	if !validGitHubSignature(body, r.Header.Get("X-Hub-Signature-256")) {
+		logger.Error("Rejected webhook delivery " + r.Header.Get("X-GitHub-Delivery") + " with an invalid signature")
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+	delivery := &models.WebhookDelivery{
+		DeliveryID: r.Header.Get("X-GitHub-Delivery"),
+		Event:      r.Header.Get("X-GitHub-Event"),
+		Headers:    webhookHeaders(r.Header),
+		Payload:    string(body),
+	}
+
+	// Retries and redeliveries keep the delivery ID of the original, they must not build the push again
+	// A failed delivery is processed again, so that its redelivery triggers the build.
+	if !s.recordDelivery(r.Context(), delivery) {
+		logger.Info("Ignoring duplicate delivery " + delivery.DeliveryID)
 		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]string{"message": "event ignored"})
+		json.NewEncoder(w).Encode(map[string]string{"message": "duplicate delivery ignored"})
 		return
 	}
 
-	// Parse the push event
+	status, response := s.processWebhookDelivery(r.Context(), delivery)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// validGitHubSignature checks the X-Hub-Signature-256 header of a delivery against GITHUB_WEBHOOK_SECRET
+// Without a secret every delivery is accepted, as webhooks were created without one.
+func validGitHubSignature(body []byte, signature string) bool {
+	secret := os.Getenv("GITHUB_WEBHOOK_SECRET")
+	if secret == "" {
+		return true
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal([]byte(signature), []byte("sha256="+hex.EncodeToString(mac.Sum(nil))))
+}
+
+// handlePushEvent queues the pipeline of a push, or tears down the previews of a deleted branch
+func (s *Server) handlePushEvent(ctx context.Context, delivery *models.WebhookDelivery) (int, map[string]string) {
 	var pushEvent models.PushEvent
-	if err := json.NewDecoder(r.Body).Decode(&pushEvent); err != nil {
+	if err := json.Unmarshal([]byte(delivery.Payload), &pushEvent); err != nil {
 		logger.Error("Failed to parse webhook payload: " + err.Error())
-		http.Error(w, "Invalid payload", http.StatusBadRequest)
-		return
+		delivery.Status, delivery.Reason = "failed", "Invalid payload: "+err.Error()
+		return http.StatusBadRequest, map[string]string{"error": "Invalid payload"}
 	}
 
-	// Ignore branch deletions
+	// Branch deletions run no pipeline, they only tear down the previews of the branch
 	if pushEvent.Deleted {
-		logger.Info("Ignoring branch deletion event")
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]string{"message": "deletion ignored"})
-		return
+		s.resolveDeliveryProject(ctx, delivery, pushEvent.Repository.CloneURL)
+		if branch, ok := strings.CutPrefix(pushEvent.Ref, "refs/heads/"); ok {
+			logger.Info(fmt.Sprintf("Branch %s deleted, tearing down its previews", branch))
+			s.closeBranchPreviews(ctx, pushEvent.Repository.CloneURL, branch)
+		}
+		delivery.Status = "handled"
+		return http.StatusOK, map[string]string{"message": "deletion handled"}
 	}
 
-	// Extract branch name from ref (refs/heads/main -> main)
-	branch := strings.TrimPrefix(pushEvent.Ref, "refs/heads/")
+	// Extract branch name from ref (refs/heads/main -> main, refs/tags/v1 -> v1)
+	branch := strings.TrimPrefix(strings.TrimPrefix(pushEvent.Ref, "refs/heads/"), "refs/tags/")
 	commitHash := pushEvent.After
 
 	logger.Info("Received push event for %s on branch %s (commit: %s)",
-		pushEvent.Repository.FullName, branch, commitHash[:8])
+		pushEvent.Repository.FullName, branch, commitHash[:min(8, len(commitHash))])
 
-	// Run pipeline asynchronously
-	go s.runPipelineFromWebhook(pushEvent, branch, commitHash)
+	// Queue the pipeline; GitHub marks the delivery as failed if there is no room left
+	if err := s.queuePipelineFromWebhook(ctx, pushEvent, branch, commitHash, delivery); err != nil {
+		if errors.Is(err, secrets.ErrKeyMismatch) {
+			return http.StatusInternalServerError, map[string]string{"error": keyMismatchReason}
+		}
+		return http.StatusServiceUnavailable, map[string]string{"error": "Pipeline queue is full"}
+	}
 
 	// Respond immediately
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusAccepted)
-	json.NewEncoder(w).Encode(map[string]string{
+	return http.StatusAccepted, map[string]string{
 		"message": "Pipeline triggered",
 		"branch":  branch,
 		"commit":  commitHash,
-	})
+	}
 }
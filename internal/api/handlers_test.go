@@ -0,0 +1,237 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/githubapp"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/queue"
+)
+
+func TestGitHubWebhookDeduplication(t *testing.T) {
+	s, _ := newTestServer()
+	payload := `{"ref": "refs/heads/main", "after": "0123456789abcdef0123456789abcdef01234567",
+		"repository": {"name": "unknown", "full_name": "acme/unknown", "clone_url": "https://example.com/unknown.git"}}`
+	deliver := func(deliveryID string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/webhook/github", strings.NewReader(payload))
+		r.Header.Set("X-GitHub-Event", "push")
+		r.Header.Set("X-GitHub-Delivery", deliveryID)
+		w := httptest.NewRecorder()
+		s.handleGitHubWebhook(w, r)
+		return w
+	}
+
+	if w := deliver("delivery-1"); w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d", w.Code)
+	}
+	w := deliver("delivery-1")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "duplicate delivery ignored") {
+		t.Errorf("Expected the redelivery to be ignored, got %d %s", w.Code, w.Body.String())
+	}
+	if w := deliver("delivery-2"); w.Code != http.StatusAccepted {
+		t.Errorf("Expected a new delivery to be processed, got %d", w.Code)
+	}
+}
+
+func TestTriggerPipelineIdempotencyKey(t *testing.T) {
+	ctx := context.Background()
+	s, st := newTestServer()
+	ownerID := createTestUser(t, st, "owner@example.com")
+	project, err := st.CreateProject(ctx, &models.NewProject{OwnerID: ownerID, Name: "app", RepoURL: "https://example.com/app.git"})
+	if err != nil {
+		t.Fatalf("Expected no error creating project, got %v", err)
+	}
+	trigger := func(key string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/projects/"+strconv.Itoa(project.ID)+"/pipelines", strings.NewReader(`{"branch": "main"}`))
+		r.Header.Set("Idempotency-Key", key)
+		r = r.WithContext(context.WithValue(r.Context(), "userID", ownerID))
+		w := httptest.NewRecorder()
+		s.routeProjectsSubpath(w, r)
+		return w
+	}
+
+	t.Run("InProgress", func(t *testing.T) {
+		st.ClaimIdempotencyKey(ctx, project.ID, "pending-key")
+		if w := trigger("pending-key"); w.Code != http.StatusConflict {
+			t.Errorf("Expected status 409, got %d", w.Code)
+		}
+	})
+
+	t.Run("Replayed", func(t *testing.T) {
+		pipeline, _ := st.CreatePipeline(ctx, project.ID, "main", "abc1234")
+		st.ClaimIdempotencyKey(ctx, project.ID, "done-key")
+		st.SetIdempotencyKeyPipeline(ctx, project.ID, "done-key", pipeline.ID)
+
+		w := trigger("done-key")
+		if w.Code != http.StatusOK || w.Header().Get("Idempotent-Replayed") != "true" {
+			t.Fatalf("Expected the first pipeline to be replayed, got %d", w.Code)
+		}
+		if !strings.Contains(w.Body.String(), `"id":`+strconv.Itoa(pipeline.ID)) {
+			t.Errorf("Expected pipeline %d, got %s", pipeline.ID, w.Body.String())
+		}
+	})
+
+	t.Run("TooLong", func(t *testing.T) {
+		if w := trigger(strings.Repeat("k", maxIdempotencyKeyLength+1)); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", w.Code)
+		}
+	})
+}
+
+func TestProjectGitHubInstallation(t *testing.T) {
+	github := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/repos/acme/app/installation" {
+			w.Write([]byte(`{"id": 42}`))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer github.Close()
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	s, st := newTestServer()
+	s.githubApp = githubapp.New("1234", key, github.URL)
+	ownerID := createTestUser(t, st, "owner@example.com")
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/api/v1/projects"+path, strings.NewReader(body))
+		r = r.WithContext(context.WithValue(r.Context(), "userID", ownerID))
+		w := httptest.NewRecorder()
+		if path == "" {
+			s.handleProjects(w, r)
+		} else {
+			s.routeProjectsSubpath(w, r)
+		}
+		return w
+	}
+
+	t.Run("OtherInstallationRejected", func(t *testing.T) {
+		w := send(http.MethodPost, "", `{"name": "app", "repo_url": "https://github.com/acme/app.git", "github_installation_id": 7}`)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", w.Code)
+		}
+	})
+
+	t.Run("RepositoryOutsideInstallationRejected", func(t *testing.T) {
+		w := send(http.MethodPost, "", `{"name": "steal", "repo_url": "https://github.com/victim/private.git", "github_installation_id": 42}`)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", w.Code)
+		}
+	})
+
+	t.Run("UpdateToOtherRepositoryRejected", func(t *testing.T) {
+		w := send(http.MethodPost, "", `{"name": "app", "repo_url": "https://github.com/acme/app.git", "github_installation_id": 42}`)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+		}
+		var project models.Project
+		json.NewDecoder(w.Body).Decode(&project)
+		path := "/" + strconv.Itoa(project.ID)
+		if w := send(http.MethodPut, path, `{"name": "app", "repo_url": "https://github.com/acme/app.git", "github_installation_id": 42}`); w.Code != http.StatusOK {
+			t.Errorf("Expected the covered repository to be kept, got %d: %s", w.Code, w.Body.String())
+		}
+		w = send(http.MethodPut, path, `{"name": "app", "repo_url": "https://github.com/victim/private.git", "github_installation_id": 42}`)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", w.Code)
+		}
+	})
+}
+
+func TestProjectBranchFilters(t *testing.T) {
+	s, st := newTestServer()
+	ownerID := createTestUser(t, st, "owner@example.com")
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/api/v1/projects"+path, strings.NewReader(body))
+		r = r.WithContext(context.WithValue(r.Context(), "userID", ownerID))
+		w := httptest.NewRecorder()
+		if path == "" {
+			s.handleProjects(w, r)
+		} else {
+			s.routeProjectsSubpath(w, r)
+		}
+		return w
+	}
+
+	t.Run("InvalidGlobRejectedOnCreate", func(t *testing.T) {
+		for _, filters := range []string{`["release-[0-9"]`, `[""]`, `["main", "feature\\"]`} {
+			w := send(http.MethodPost, "", `{"name": "app", "repo_url": "https://example.com/bad.git", "branch_filters": `+filters+`}`)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status 400 for %s, got %d", filters, w.Code)
+			}
+		}
+	})
+
+	t.Run("InvalidGlobRejectedOnUpdate", func(t *testing.T) {
+		w := send(http.MethodPost, "", `{"name": "app", "repo_url": "https://example.com/app.git", "branch_filters": ["main", "release/*"]}`)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+		}
+		var project models.Project
+		json.NewDecoder(w.Body).Decode(&project)
+		path := "/" + strconv.Itoa(project.ID)
+
+		if w := send(http.MethodPut, path, `{"name": "app", "repo_url": "https://example.com/app.git", "branch_filters": ["[main"]}`); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", w.Code)
+		}
+		stored, _ := st.GetProject(context.Background(), project.ID)
+		if len(stored.BranchFilters) != 2 {
+			t.Errorf("Expected the filters to be kept, got %v", stored.BranchFilters)
+		}
+	})
+
+	t.Run("Matching", func(t *testing.T) {
+		filters := []string{"main", "release/*"}
+		for branch, want := range map[string]bool{"main": true, "release/1.2": true, "release/1/2": false, "develop": false} {
+			if got := matchesBranchFilters(filters, branch); got != want {
+				t.Errorf("Expected %s to match %v, got %v", branch, want, got)
+			}
+		}
+		if !matchesBranchFilters(nil, "any") {
+			t.Errorf("Expected no filters to allow every branch")
+		}
+	})
+}
+
+func TestRetryTagPipeline(t *testing.T) {
+	ctx := context.Background()
+	recorder := recordSpans(t)
+	s, st := newTestServer()
+	s.queue = queue.New(1, 10)
+	s.queue.Start()
+	ownerID := createTestUser(t, st, "owner@example.com")
+
+	// The clone fails at once, the run ending before any job
+	project, _ := st.CreateProject(ctx, &models.NewProject{OwnerID: ownerID, Name: "app", RepoURL: filepath.Join(t.TempDir(), "missing.git")})
+	original, _ := st.CreatePipeline(ctx, project.ID, "v1.2.0", "0123456789abcdef")
+	st.SetPipelineTrigger(ctx, original.ID, "v1.2.0", "main", []string{"src/main.go"})
+	st.FailPipeline(ctx, original.ID, "tests failed")
+
+	for _, body := range []string{`{}`, `{"failed_only": true}`} {
+		t.Run(body, func(t *testing.T) {
+			w := postProject(s, fmt.Sprintf("%d/pipelines/%d/retry", project.ID, original.ID), body, ownerID)
+			if w.Code != http.StatusCreated {
+				t.Fatalf("Expected status 201, got %d %s", w.Code, w.Body.String())
+			}
+			var retried models.Pipeline
+			json.NewDecoder(w.Body).Decode(&retried)
+			if stored, _ := st.GetPipeline(ctx, retried.ID); stored.Tag != "v1.2.0" || stored.DefaultBranch != "main" || len(stored.ChangedFiles) != 1 {
+				t.Errorf("Expected the push of the original recorded with the retry, got %+v", stored)
+			}
+
+			attrs := waitRunSpan(t, recorder, retried.ID)
+			if tag, _ := attrs.Value("cicd.tag"); tag.AsString() != "v1.2.0" {
+				t.Errorf("Expected the retried run to keep tag v1.2.0, got %q", tag.AsString())
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"syscall"
+	"time"
+)
+
+// healthCheckTimeout bounds each dependency check of the readiness probe
+const healthCheckTimeout = 2 * time.Second
+
+// dependencyStatus is the result of one readiness check
+type dependencyStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// FreeBytes is reported by the disk check
+	FreeBytes uint64 `json:"free_bytes,omitempty"`
+}
+
+// handleHealthz is the liveness probe: the process is up and serving requests
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleReadyz is the readiness probe, checking the database, the Docker daemon and the workspace disk
+// It answers 503 as soon as one of them is not usable.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]dependencyStatus{
+		"database": s.checkDatabase(r.Context()),
+		"docker":   s.checkDocker(r.Context()),
+		"disk":     checkDisk(workspaceRoot, uint64(envInt("MIN_FREE_DISK_MB", 1024))<<20),
+	}
+
+	status, code := "ready", http.StatusOK
+	for _, check := range checks {
+		if check.Status == "error" {
+			status, code = "not_ready", http.StatusServiceUnavailable
+		}
+	}
+	respondJSON(w, code, map[string]interface{}{
+		"status": status,
+		"checks": checks,
+	})
+}
+
+// checkDatabase pings the database, reported as disabled when the server runs without one
+func (s *Server) checkDatabase(ctx context.Context) dependencyStatus {
+	if s.db == nil {
+		return dependencyStatus{Status: "disabled"}
+	}
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+	if err := s.db.Ping(ctx); err != nil {
+		return dependencyStatus{Status: "error", Error: err.Error()}
+	}
+	return dependencyStatus{Status: "ok"}
+}
+
+// checkDocker pings the Docker daemon running the jobs
+func (s *Server) checkDocker(ctx context.Context) dependencyStatus {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+	if err := s.docker.Ping(ctx); err != nil {
+		return dependencyStatus{Status: "error", Error: err.Error()}
+	}
+	return dependencyStatus{Status: "ok"}
+}
+
+// checkDisk reports an error when the filesystem of dir has less than minFree bytes available
+func checkDisk(dir string, minFree uint64) dependencyStatus {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return dependencyStatus{Status: "error", Error: err.Error()}
+	}
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return dependencyStatus{Status: "error", Error: err.Error()}
+	}
+
+	free := stat.Bavail * uint64(stat.Bsize)
+	if free < minFree {
+		return dependencyStatus{Status: "error", Error: fmt.Sprintf("only %d MB free", free>>20), FreeBytes: free}
+	}
+	return dependencyStatus{Status: "ok", FreeBytes: free}
+}
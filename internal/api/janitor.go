@@ -0,0 +1,83 @@
+package api
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+)
+
+// deliveryRetention is how long webhook delivery IDs and idempotency keys are remembered to deduplicate retries
+const deliveryRetention = 7 * 24 * time.Hour
+
+// runJanitor cleans up what pipelines leave behind every interval
+// Stopped job containers and dangling images are pruned, workspaces older than maxAge, expired previews and old webhook deliveries are removed,
+// and the retention policies of the projects applied.
+func (s *Server) runJanitor(interval, maxAge time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.cleanup(maxAge)
+	}
+}
+
+// cleanup runs a single janitor pass
+func (s *Server) cleanup(maxAge time.Duration) {
+	if count, space, err := s.docker.PruneJobContainers(); err != nil {
+		logger.Warn(fmt.Sprintf("Janitor: failed to prune job containers: %v", err))
+	} else if count > 0 {
+		logger.Info(fmt.Sprintf("Janitor: removed %d job containers (%d bytes)", count, space))
+	}
+
+	if count, space, err := s.docker.PruneDanglingImages(); err != nil {
+		logger.Warn(fmt.Sprintf("Janitor: failed to prune dangling images: %v", err))
+	} else if count > 0 {
+		logger.Info(fmt.Sprintf("Janitor: removed %d dangling images (%d bytes)", count, space))
+	}
+
+	removed, err := removeStaleWorkspaces(maxAge)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("Janitor: failed to clean workspaces: %v", err))
+	} else if removed > 0 {
+		logger.Info(fmt.Sprintf("Janitor: removed %d stale workspaces", removed))
+	}
+
+	s.expirePreviews(s.previewTTL)
+	s.enforceRetention()
+
+	if s.db != nil {
+		if removed, err := s.db.DeleteDeliveriesBefore(s.ctx, time.Now().Add(-deliveryRetention)); err != nil {
+			logger.Warn(fmt.Sprintf("Janitor: failed to prune webhook deliveries: %v", err))
+		} else if removed > 0 {
+			logger.Info(fmt.Sprintf("Janitor: forgot %d webhook deliveries and idempotency keys", removed))
+		}
+	}
+}
+
+// removeStaleWorkspaces deletes the workspace directories last modified more than maxAge ago
+func removeStaleWorkspaces(maxAge time.Duration) (int, error) {
+	entries, err := os.ReadDir(workspaceRoot)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < maxAge {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(workspaceRoot, entry.Name())); err != nil {
+			logger.Warn(fmt.Sprintf("Janitor: failed to remove workspace %s: %v", entry.Name(), err))
+			continue
+		}
+		removed++
+	}
+	return removed, nil
+}
@@ -0,0 +1,16 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/executor"
+)
+
+// handleJobTypes lists the job types pipeline files can use, with their properties
+func (s *Server) handleJobTypes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	respondJSON(w, http.StatusOK, executor.JobTypes())
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/executor"
+)
+
+func TestHandleJobTypes(t *testing.T) {
+	s, _ := newTestServer()
+	w := httptest.NewRecorder()
+	s.handleJobTypes(w, httptest.NewRequest(http.MethodGet, "/api/v1/job-types", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	var types []executor.JobTypeInfo
+	json.NewDecoder(w.Body).Decode(&types)
+	var names []string
+	for _, info := range types {
+		names = append(names, info.Name)
+	}
+	expected := []string{executor.JobTypeBuild, executor.JobTypeSecurityScan, executor.JobTypeTerraform}
+	if len(names) != len(expected) {
+		t.Fatalf("Expected job types %v, got %v", expected, names)
+	}
+	for i := range expected {
+		if names[i] != expected[i] || len(types[i].Properties) == 0 {
+			t.Errorf("Expected job type %s with its properties, got %+v", expected[i], types[i])
+		}
+	}
+}
@@ -0,0 +1,349 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/store"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+)
+
+const (
+	// minPasswordLength is the shortest password accepted for local accounts
+	minPasswordLength = 8
+	// passwordResetTTL is how long a password reset token stays valid
+	passwordResetTTL = time.Hour
+	// emailVerificationTTL is how long the verification link of a new local account stays valid
+	emailVerificationTTL = 24 * time.Hour
+)
+
+// mailSender sends the emails of local accounts, implemented by notify.Mailer
+type mailSender interface {
+	Send(to, subject, body string) error
+}
+
+// authLimits throttles the local account endpoints, nil limiters (in tests) never throttling
+type authLimits struct {
+	signup *rateLimiter
+	login  *rateLimiter
+	// reset covers reset requests and confirmations, and email verifications
+	reset *rateLimiter
+}
+
+func newAuthLimits() authLimits {
+	return authLimits{
+		signup: newRateLimiter(5, time.Hour),
+		login:  newRateLimiter(10, 15*time.Minute),
+		reset:  newRateLimiter(5, time.Hour),
+	}
+}
+
+// localAuthEnabled reports whether email/password accounts can log in, set by LOCAL_AUTH_ENABLED
+func localAuthEnabled() bool {
+	return os.Getenv("LOCAL_AUTH_ENABLED") == "true"
+}
+
+// localSignupEnabled reports whether anyone can create a local account, set by LOCAL_AUTH_SIGNUP
+func localSignupEnabled() bool {
+	return localAuthEnabled() && os.Getenv("LOCAL_AUTH_SIGNUP") == "true"
+}
+
+// requireLocalAuth responds with an error unless local accounts are usable
+func (s *Server) requireLocalAuth(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return false
+	}
+	if !localAuthEnabled() {
+		respondError(w, http.StatusNotFound, "Local authentication is disabled")
+		return false
+	}
+	if s.db == nil {
+		respondError(w, http.StatusServiceUnavailable, "Database not available")
+		return false
+	}
+	return true
+}
+
+// handleLocalSignup creates an unverified email/password account and emails it a verification link
+// The account cannot log in before the link is followed, so nobody can hold an account on an address they do not own.
+func (s *Server) handleLocalSignup(w http.ResponseWriter, r *http.Request) {
+	if !s.requireLocalAuth(w, r) {
+		return
+	}
+	if !localSignupEnabled() {
+		respondError(w, http.StatusForbidden, "Signup is disabled")
+		return
+	}
+	if s.mailer == nil {
+		respondError(w, http.StatusServiceUnavailable, "Signup needs a mail server to verify emails")
+		return
+	}
+	if !s.authLimits.signup.throttle(w, r, "") {
+		return
+	}
+
+	var req struct {
+		Email    string `json:"email"`
+		Name     string `json:"name"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.Email = strings.ToLower(strings.TrimSpace(req.Email))
+	if _, err := mail.ParseAddress(req.Email); err != nil {
+		respondError(w, http.StatusBadRequest, "A valid email is required")
+		return
+	}
+	if len(req.Password) < minPasswordLength {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("Password must be at least %d characters", minPasswordLength))
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid password")
+		return
+	}
+	user := &models.User{Email: req.Email, Name: req.Name}
+	if user.Name == "" {
+		user.Name = strings.Split(req.Email, "@")[0]
+	}
+	if err := s.db.CreateLocalUser(r.Context(), user, string(hash)); err != nil {
+		if errors.Is(err, store.ErrEmailTaken) {
+			respondError(w, http.StatusConflict, err.Error())
+			return
+		}
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	logger.Info(fmt.Sprintf("Local account %d (%s) created", user.ID, user.Email))
+
+	token, err := newAccountToken()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to generate verification token")
+		return
+	}
+	if err := s.db.CreateEmailVerification(r.Context(), user.ID, hashRunnerToken(token), time.Now().Add(emailVerificationTTL)); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	body := fmt.Sprintf("Confirm your email to activate your account: %s/auth/verify-email?token=%s\n\nThe link is valid for 24 hours.",
+		frontendURL(), token)
+	if err := s.mailer.Send(user.Email, "Confirm your email", body); err != nil {
+		// The account stays unverified, a password reset confirms the email as well
+		logger.Warn(fmt.Sprintf("Failed to send the verification email of user %d: %v", user.ID, err))
+		respondError(w, http.StatusBadGateway, "Failed to send the verification email, request a password reset to receive a new link")
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, map[string]interface{}{"status": "verification_sent", "user": user})
+}
+
+// handleEmailVerification confirms the email of a local account with its verification token and logs it in
+func (s *Server) handleEmailVerification(w http.ResponseWriter, r *http.Request) {
+	if !s.requireLocalAuth(w, r) {
+		return
+	}
+	if !s.authLimits.reset.throttle(w, r, "") {
+		return
+	}
+
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	userID, err := s.db.ConsumeEmailVerification(r.Context(), hashRunnerToken(req.Token))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid or expired verification token")
+		return
+	}
+	if err := s.db.SetEmailVerified(r.Context(), userID); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	user, err := s.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get user")
+		return
+	}
+	logger.Info(fmt.Sprintf("Email of user %d verified", userID))
+
+	s.respondLoginToken(w, http.StatusOK, user)
+}
+
+// handleLocalLogin exchanges an email and password for a JWT
+func (s *Server) handleLocalLogin(w http.ResponseWriter, r *http.Request) {
+	if !s.requireLocalAuth(w, r) {
+		return
+	}
+
+	var req struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	if !s.authLimits.login.throttle(w, r, email) {
+		return
+	}
+
+	// The same error is returned for unknown emails, accounts without password and wrong passwords
+	user, hash, err := s.db.GetUserPasswordHash(r.Context(), email)
+	if err != nil || hash == "" || bcrypt.CompareHashAndPassword([]byte(hash), []byte(req.Password)) != nil {
+		respondError(w, http.StatusUnauthorized, "Invalid email or password")
+		return
+	}
+	if !user.EmailVerified {
+		respondError(w, http.StatusForbidden, "Email not verified, follow the link sent at signup")
+		return
+	}
+
+	s.respondLoginToken(w, http.StatusOK, user)
+}
+
+// handlePasswordResetRequest emails a password reset link to a local account
+// The token only ever leaves the server in that email, without mail server no reset can be requested.
+func (s *Server) handlePasswordResetRequest(w http.ResponseWriter, r *http.Request) {
+	if !s.requireLocalAuth(w, r) {
+		return
+	}
+
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	if s.mailer == nil {
+		respondError(w, http.StatusServiceUnavailable, "Password resets need a mail server")
+		return
+	}
+	if !s.authLimits.reset.throttle(w, r, email) {
+		return
+	}
+
+	// Always accepted, the response does not tell which emails have an account
+	user, hash, err := s.db.GetUserPasswordHash(r.Context(), email)
+	if err == nil && hash != "" {
+		token, err := newAccountToken()
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "Failed to generate reset token")
+			return
+		}
+		if err := s.db.CreatePasswordReset(r.Context(), user.ID, hashRunnerToken(token), time.Now().Add(passwordResetTTL)); err != nil {
+			respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		body := fmt.Sprintf("Set a new password: %s/auth/reset-password?token=%s\n\nThe link is valid for one hour. Ignore this email if you did not ask for it.",
+			frontendURL(), token)
+		s.sendAccountEmail(user, "Reset your password", body)
+		logger.Info(fmt.Sprintf("Password reset requested for user %d", user.ID))
+	}
+
+	respondJSON(w, http.StatusAccepted, map[string]string{"status": "requested"})
+}
+
+// sendAccountEmail sends an email to a user, failures being logged since the response must not depend on them
+func (s *Server) sendAccountEmail(user *models.User, subject, body string) {
+	if err := s.mailer.Send(user.Email, subject, body); err != nil {
+		logger.Warn(fmt.Sprintf("Failed to send the %q email of user %d: %v", subject, user.ID, err))
+	}
+}
+
+// newAccountToken generates the random token of a verification or reset link
+func newAccountToken() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+// frontendURL returns the base URL of the frontend, the links sent to users pointing there
+func frontendURL() string {
+	if url := os.Getenv("FRONTEND_URL"); url != "" {
+		return strings.TrimRight(url, "/")
+	}
+	return "http://localhost:3000"
+}
+
+// handlePasswordResetConfirm sets a new password with a reset token
+func (s *Server) handlePasswordResetConfirm(w http.ResponseWriter, r *http.Request) {
+	if !s.requireLocalAuth(w, r) {
+		return
+	}
+
+	var req struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if !s.authLimits.reset.throttle(w, r, "") {
+		return
+	}
+	if len(req.Password) < minPasswordLength {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("Password must be at least %d characters", minPasswordLength))
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid password")
+		return
+	}
+	userID, err := s.db.ConsumePasswordReset(r.Context(), hashRunnerToken(req.Token))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid or expired reset token")
+		return
+	}
+	if err := s.db.SetUserPassword(r.Context(), userID, string(hash)); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	// The token was received by email, which confirms the address like the verification link
+	if err := s.db.SetEmailVerified(r.Context(), userID); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	logger.Info(fmt.Sprintf("Password of user %d reset", userID))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// respondLoginToken responds with the JWT of a user, the same one issued by the OAuth callback
+func (s *Server) respondLoginToken(w http.ResponseWriter, status int, user *models.User) {
+	token, err := createToken(user)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to create token")
+		return
+	}
+	respondJSON(w, status, map[string]interface{}{
+		"token": token,
+		"user":  user,
+	})
+}
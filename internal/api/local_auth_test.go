@@ -0,0 +1,143 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+)
+
+// fakeMailer records the emails instead of sending them
+type fakeMailer struct {
+	sent []string
+}
+
+func (m *fakeMailer) Send(to, subject, body string) error {
+	m.sent = append(m.sent, to+"\n"+body)
+	return nil
+}
+
+// lastToken returns the token of the link in the last email sent
+func (m *fakeMailer) lastToken(t *testing.T) string {
+	t.Helper()
+	if len(m.sent) == 0 {
+		t.Fatal("Expected an email, none sent")
+	}
+	match := regexp.MustCompile(`token=([0-9a-f]+)`).FindStringSubmatch(m.sent[len(m.sent)-1])
+	if match == nil {
+		t.Fatalf("Expected a link with a token, got %q", m.sent[len(m.sent)-1])
+	}
+	return match[1]
+}
+
+// postLocalAuth sends a JSON body to a local account handler
+func postLocalAuth(handler http.HandlerFunc, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/auth/local/", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func TestLocalAuth(t *testing.T) {
+	t.Setenv("LOCAL_AUTH_ENABLED", "true")
+	t.Setenv("LOCAL_AUTH_SIGNUP", "true")
+	s, st := newTestServer()
+	mailer := &fakeMailer{}
+	s.mailer = mailer
+
+	login := func(email, password string) int {
+		return postLocalAuth(s.handleLocalLogin, `{"email": "`+email+`", "password": "`+password+`"}`).Code
+	}
+
+	t.Run("SignupNeedsVerification", func(t *testing.T) {
+		w := postLocalAuth(s.handleLocalSignup, `{"email": "alice@example.com", "password": "correct horse"}`)
+		if w.Code != http.StatusCreated || strings.Contains(w.Body.String(), `"token"`) {
+			t.Fatalf("Expected the account to be created without login token, got %d %s", w.Code, w.Body.String())
+		}
+		if code := login("alice@example.com", "correct horse"); code != http.StatusForbidden {
+			t.Errorf("Expected status 403 before verification, got %d", code)
+		}
+
+		token := mailer.lastToken(t)
+		if w := postLocalAuth(s.handleEmailVerification, `{"token": "`+token+`"}`); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"token"`) {
+			t.Fatalf("Expected the verification to log in, got %d %s", w.Code, w.Body.String())
+		}
+		if w := postLocalAuth(s.handleEmailVerification, `{"token": "`+token+`"}`); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected the verification token to be single-use, got %d", w.Code)
+		}
+		if code := login("alice@example.com", "correct horse"); code != http.StatusOK {
+			t.Errorf("Expected status 200 once verified, got %d", code)
+		}
+	})
+
+	t.Run("EmailTaken", func(t *testing.T) {
+		w := postLocalAuth(s.handleLocalSignup, `{"email": "alice@example.com", "password": "another one"}`)
+		if w.Code != http.StatusConflict {
+			t.Errorf("Expected status 409, got %d", w.Code)
+		}
+	})
+
+	t.Run("OAuthLoginDiscardsUnverifiedPassword", func(t *testing.T) {
+		postLocalAuth(s.handleLocalSignup, `{"email": "victim@example.com", "password": "attacker pass"}`)
+		// The owner of the address logs in with GitHub, as the OAuth callback does
+		if err := st.CreateUser(context.Background(), &models.User{Email: "victim@example.com", Provider: "github", ProviderID: "1"}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if code := login("victim@example.com", "attacker pass"); code != http.StatusUnauthorized {
+			t.Errorf("Expected the pre-registered password to stop working, got %d", code)
+		}
+	})
+
+	t.Run("OAuthLoginKeepsVerifiedPassword", func(t *testing.T) {
+		if err := st.CreateUser(context.Background(), &models.User{Email: "alice@example.com", Provider: "github", ProviderID: "2"}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if code := login("alice@example.com", "correct horse"); code != http.StatusOK {
+			t.Errorf("Expected the verified account to keep its password, got %d", code)
+		}
+	})
+
+	t.Run("PasswordReset", func(t *testing.T) {
+		sent := len(mailer.sent)
+		if w := postLocalAuth(s.handlePasswordResetRequest, `{"email": "alice@example.com"}`); w.Code != http.StatusAccepted {
+			t.Fatalf("Expected status 202, got %d", w.Code)
+		}
+		if len(mailer.sent) != sent+1 || !strings.HasPrefix(mailer.sent[sent], "alice@example.com\n") {
+			t.Fatalf("Expected the reset link to be emailed to the account, got %v", mailer.sent[sent:])
+		}
+		w := postLocalAuth(s.handlePasswordResetConfirm, `{"token": "`+mailer.lastToken(t)+`", "password": "new password"}`)
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("Expected status 204, got %d", w.Code)
+		}
+		if code := login("alice@example.com", "new password"); code != http.StatusOK {
+			t.Errorf("Expected the new password to work, got %d", code)
+		}
+
+		if w := postLocalAuth(s.handlePasswordResetRequest, `{"email": "nobody@example.com"}`); w.Code != http.StatusAccepted || len(mailer.sent) != sent+1 {
+			t.Errorf("Expected unknown emails to be accepted without email, got %d", w.Code)
+		}
+	})
+
+	t.Run("Throttled", func(t *testing.T) {
+		s.authLimits = newAuthLimits()
+		defer func() { s.authLimits = authLimits{} }()
+		for i := 0; i < 10; i++ {
+			login("alice@example.com", "wrong password")
+		}
+		if code := login("alice@example.com", "new password"); code != http.StatusTooManyRequests {
+			t.Errorf("Expected status 429 after 10 attempts, got %d", code)
+		}
+	})
+
+	t.Run("NoMailServer", func(t *testing.T) {
+		s.mailer = nil
+		defer func() { s.mailer = mailer }()
+		if w := postLocalAuth(s.handleLocalSignup, `{"email": "bob@example.com", "password": "correct horse"}`); w.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected status 503, got %d", w.Code)
+		}
+	})
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/executor"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/queue"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestPlayManualJob(t *testing.T) {
+	ctx := context.Background()
+	s, st := newTestServer()
+	s.pipelineExecutor = executor.NewPipelineExecutor(st, nil)
+	s.queue = queue.New(1, 1)
+	ownerID := createTestUser(t, st, "owner@example.com")
+
+	project, err := st.CreateProject(ctx, &models.NewProject{OwnerID: ownerID, Name: "app", RepoURL: "https://example.com/app.git"})
+	if err != nil {
+		t.Fatalf("Expected no error creating project, got %v", err)
+	}
+	pipeline, _ := st.CreatePipeline(ctx, project.ID, "main", "abc12345")
+	job, _ := st.CreateJob(ctx, pipeline.ID, "deploy", "deploy", "alpine")
+	st.UpdateJobStatus(ctx, job.ID, "manual", nil)
+	path := fmt.Sprintf("%d/pipelines/%d/jobs/%d/play", project.ID, pipeline.ID, job.ID)
+
+	t.Run("NotWaiting", func(t *testing.T) {
+		st.UpdatePipelineStatus(ctx, pipeline.ID, "running")
+		if w := postProject(s, path, "", ownerID); w.Code != http.StatusConflict {
+			t.Errorf("Expected status 409, got %d", w.Code)
+		}
+	})
+
+	t.Run("ParkedPipelineResumes", func(t *testing.T) {
+		st.UpdatePipelineStatus(ctx, pipeline.ID, "manual")
+		if w := postProject(s, path, "", ownerID); w.Code != http.StatusAccepted {
+			t.Fatalf("Expected status 202, got %d %s", w.Code, w.Body.String())
+		}
+		played, _ := st.GetJob(ctx, job.ID)
+		resumed, _ := st.GetPipeline(ctx, pipeline.ID)
+		if played.Status != "pending" || resumed.Status != "queued" || s.queue.Stats().Queued != 1 {
+			t.Errorf("Expected a pending job and a queued pipeline, got %s, %s and %d queued", played.Status, resumed.Status, s.queue.Stats().Queued)
+		}
+	})
+
+	t.Run("ParkedPipelineCancelled", func(t *testing.T) {
+		parked, _ := st.CreatePipeline(ctx, project.ID, "main", "def67890")
+		manual, _ := st.CreateJob(ctx, parked.ID, "deploy", "deploy", "alpine")
+		st.UpdateJobStatus(ctx, manual.ID, "manual", nil)
+		st.UpdatePipelineStatus(ctx, parked.ID, "manual")
+
+		if w := postProject(s, fmt.Sprintf("%d/pipelines/%d/cancel", project.ID, parked.ID), "", ownerID); w.Code != http.StatusAccepted {
+			t.Fatalf("Expected status 202, got %d %s", w.Code, w.Body.String())
+		}
+		cancelled, _ := st.GetPipeline(ctx, parked.ID)
+		cancelledJob, _ := st.GetJob(ctx, manual.ID)
+		if cancelled.Status != "cancelled" || cancelledJob.Status != "cancelled" {
+			t.Errorf("Expected the parked pipeline and its manual job cancelled, got %s and %s", cancelled.Status, cancelledJob.Status)
+		}
+	})
+}
+
+// recordSpans records the spans ended during a test
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+// waitRunSpan waits for the run of a pipeline to end, returning the attributes of its span
+func waitRunSpan(t *testing.T, recorder *tracetest.SpanRecorder, pipelineID int) attribute.Set {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		for _, span := range recorder.Ended() {
+			attrs := attribute.NewSet(span.Attributes()...)
+			if id, _ := attrs.Value("cicd.pipeline.id"); span.Name() == "pipeline" && id.AsInt64() == int64(pipelineID) {
+				return attrs
+			}
+		}
+	}
+	t.Fatalf("Expected pipeline %d to run", pipelineID)
+	return attribute.Set{}
+}
+
+func TestResumeTagPipeline(t *testing.T) {
+	ctx := context.Background()
+	recorder := recordSpans(t)
+	s, st := newTestServer()
+	s.pipelineExecutor = executor.NewPipelineExecutor(st, nil)
+	s.queue = queue.New(1, 10)
+	ownerID := createTestUser(t, st, "owner@example.com")
+
+	// The clone fails at once, the run ending before any job
+	repoURL := filepath.Join(t.TempDir(), "missing.git")
+	project, _ := st.CreateProject(ctx, &models.NewProject{OwnerID: ownerID, Name: "app", RepoURL: repoURL})
+
+	push := models.PushEvent{
+		Ref:        "refs/tags/v1.2.0",
+		After:      "0123456789abcdef0123456789abcdef01234567",
+		Repository: models.Repository{Name: "app", CloneURL: repoURL, DefaultBranch: "main"},
+		Commits:    []models.Commit{{Modified: []string{"src/main.go"}}},
+	}
+	delivery := &models.WebhookDelivery{}
+	if err := s.queuePipelineFromWebhook(ctx, push, "v1.2.0", push.After, delivery); err != nil || delivery.PipelineID == nil {
+		t.Fatalf("Expected the push to be queued, got %v", err)
+	}
+	pipeline, _ := st.GetPipeline(ctx, *delivery.PipelineID)
+	if pipeline.Tag != "v1.2.0" || pipeline.DefaultBranch != "main" || len(pipeline.ChangedFiles) != 1 {
+		t.Fatalf("Expected the push recorded with the pipeline, got %+v", pipeline)
+	}
+
+	// The run parks on a manual job, whose play resumes it
+	s.queue.Remove(pipeline.ID)
+	s.untrackRun(pipeline.ID)
+	job, _ := st.CreateJob(ctx, pipeline.ID, "release", "deploy", "alpine")
+	st.UpdateJobStatus(ctx, job.ID, "manual", nil)
+	st.UpdatePipelineStatus(ctx, pipeline.ID, "manual")
+	if w := postProject(s, fmt.Sprintf("%d/pipelines/%d/jobs/%d/play", project.ID, pipeline.ID, job.ID), "", ownerID); w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d %s", w.Code, w.Body.String())
+	}
+	s.queue.Start()
+
+	attrs := waitRunSpan(t, recorder, pipeline.ID)
+	if tag, _ := attrs.Value("cicd.tag"); tag.AsString() != "v1.2.0" {
+		t.Errorf("Expected the resumed run to keep tag v1.2.0, got %q", tag.AsString())
+	}
+}
@@ -0,0 +1,339 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+)
+
+// handleOrganizations lists the organizations of the user and creates new ones, /api/v1/orgs
+func (s *Server) handleOrganizations(w http.ResponseWriter, r *http.Request) {
+	if s.db == nil {
+		respondError(w, http.StatusServiceUnavailable, "Database not available")
+		return
+	}
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		organizations, err := s.db.GetOrganizationsForUser(r.Context(), userID)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if organizations == nil {
+			organizations = []models.Organization{}
+		}
+		respondJSON(w, http.StatusOK, organizations)
+	case http.MethodPost:
+		var req struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+		if strings.TrimSpace(req.Name) == "" {
+			respondError(w, http.StatusBadRequest, "Organization name is required")
+			return
+		}
+		organization, err := s.db.CreateOrganization(r.Context(), req.Name, userID)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		logger.Info(fmt.Sprintf("Organization %d (%s) created by user %d", organization.ID, organization.Name, userID))
+		respondJSON(w, http.StatusCreated, organization)
+	default:
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// routeOrganizationsSubpath routes /api/v1/orgs/{orgId}[/members[/{userId}]|/teams[/{teamId}[/members[/{userId}]]]|/projects]
+func (s *Server) routeOrganizationsSubpath(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/orgs/"), "/")
+
+	// Reading is open to every member, changes need maintainers, deleting the organization its owners
+	minRole := RoleViewer
+	if r.Method != http.MethodGet {
+		minRole = RoleMaintainer
+		if len(parts) == 1 && r.Method == http.MethodDelete {
+			minRole = RoleOwner
+		}
+	}
+	organization, ok := s.authorizeOrganization(w, r, parts[0], minRole)
+	if !ok {
+		return
+	}
+
+	switch {
+	case len(parts) == 1:
+		s.handleOrganization(w, r, organization)
+	case len(parts) == 2 && parts[1] == "members":
+		s.handleOrganizationMembers(w, r, organization)
+	case len(parts) == 3 && parts[1] == "members":
+		targetUserID, err := strconv.Atoi(parts[2])
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid user ID")
+			return
+		}
+		s.handleOrganizationMember(w, r, organization, targetUserID)
+	case len(parts) >= 2 && parts[1] == "teams":
+		s.routeTeams(w, r, organization, parts[2:])
+	case len(parts) == 2 && parts[1] == "projects":
+		s.listOrganizationProjects(w, r, organization)
+	default:
+		respondError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+// authorizeOrganization responds with an error unless the user of the request has at least minRole in the organization
+// Organizations the user is not a member of are reported as not found.
+func (s *Server) authorizeOrganization(w http.ResponseWriter, r *http.Request, organizationIDPart, minRole string) (*models.Organization, bool) {
+	if s.db == nil {
+		respondError(w, http.StatusServiceUnavailable, "Database not available")
+		return nil, false
+	}
+	organizationID, err := strconv.Atoi(organizationIDPart)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid organization ID")
+		return nil, false
+	}
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return nil, false
+	}
+
+	organization, err := s.db.GetOrganization(r.Context(), organizationID)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Organization not found")
+		return nil, false
+	}
+	role, err := s.db.GetOrganizationMemberRole(r.Context(), organizationID, userID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to check permissions")
+		return nil, false
+	}
+	if roleRanks[role] == 0 {
+		respondError(w, http.StatusNotFound, "Organization not found")
+		return nil, false
+	}
+	if roleRanks[role] < roleRanks[minRole] {
+		respondError(w, http.StatusForbidden, "Your role ("+role+") does not allow this action")
+		return nil, false
+	}
+	organization.Role = role
+	return organization, true
+}
+
+// handleOrganization reads, renames and deletes an organization
+func (s *Server) handleOrganization(w http.ResponseWriter, r *http.Request, organization *models.Organization) {
+	switch r.Method {
+	case http.MethodGet:
+		respondJSON(w, http.StatusOK, organization)
+	case http.MethodPut:
+		var req struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+		if strings.TrimSpace(req.Name) == "" {
+			respondError(w, http.StatusBadRequest, "Organization name is required")
+			return
+		}
+		updated, err := s.db.UpdateOrganization(r.Context(), organization.ID, req.Name)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		updated.Role = organization.Role
+		respondJSON(w, http.StatusOK, updated)
+	case http.MethodDelete:
+		if err := s.db.DeleteOrganization(r.Context(), organization.ID); err != nil {
+			respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		logger.Info(fmt.Sprintf("Organization %d (%s) deleted", organization.ID, organization.Name))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// handleOrganizationMembers lists and adds the members of an organization
+func (s *Server) handleOrganizationMembers(w http.ResponseWriter, r *http.Request, organization *models.Organization) {
+	switch r.Method {
+	case http.MethodGet:
+		members, err := s.db.GetOrganizationMembers(r.Context(), organization.ID)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "Failed to get organization members")
+			return
+		}
+		if members == nil {
+			members = []models.OrganizationMember{}
+		}
+		respondJSON(w, http.StatusOK, members)
+	case http.MethodPost:
+		var req struct {
+			Email string `json:"email"`
+			Role  string `json:"role"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+		if req.Email == "" {
+			respondError(w, http.StatusBadRequest, "Email is required")
+			return
+		}
+		if req.Role == "" {
+			req.Role = RoleViewer
+		}
+		// Only owners can make other owners
+		if !validMemberRole(req.Role) && !(req.Role == RoleOwner && organization.Role == RoleOwner) {
+			respondError(w, http.StatusBadRequest, "role must be viewer, developer or maintainer")
+			return
+		}
+
+		user, err := s.db.GetUserByEmail(r.Context(), req.Email)
+		if err != nil {
+			respondError(w, http.StatusNotFound, "User not found. They must sign in first.")
+			return
+		}
+		if user.ID == organization.OwnerID {
+			respondError(w, http.StatusBadRequest, "The role of the organization creator cannot be changed")
+			return
+		}
+		if !s.authorizeOwnerTarget(w, r, organization, user.ID) {
+			return
+		}
+		if err := s.db.AddOrganizationMember(r.Context(), organization.ID, user.ID, req.Role); err != nil {
+			respondError(w, http.StatusInternalServerError, "Failed to add member")
+			return
+		}
+		respondJSON(w, http.StatusCreated, map[string]string{"message": "Member added"})
+	default:
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// handleOrganizationMember removes a member of an organization
+func (s *Server) handleOrganizationMember(w http.ResponseWriter, r *http.Request, organization *models.Organization, targetUserID int) {
+	if r.Method != http.MethodDelete {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if targetUserID == organization.OwnerID {
+		respondError(w, http.StatusBadRequest, "The organization creator cannot be removed")
+		return
+	}
+	if !s.authorizeOwnerTarget(w, r, organization, targetUserID) {
+		return
+	}
+
+	if err := s.db.RemoveOrganizationMember(r.Context(), organization.ID, targetUserID); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to remove member")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authorizeOwnerTarget responds with an error unless the user of the request may change the membership of targetUserID
+// Only owners change or remove the membership of owners, whether they are owners as members or through a team.
+func (s *Server) authorizeOwnerTarget(w http.ResponseWriter, r *http.Request, organization *models.Organization, targetUserID int) bool {
+	if organization.Role == RoleOwner {
+		return true
+	}
+	role, err := s.db.GetOrganizationMemberRole(r.Context(), organization.ID, targetUserID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to check permissions")
+		return false
+	}
+	if role == RoleOwner {
+		respondError(w, http.StatusForbidden, "Only owners can change the membership of an owner")
+		return false
+	}
+	return true
+}
+
+// listOrganizationProjects returns the projects of an organization, credentials masked for non maintainers
+func (s *Server) listOrganizationProjects(w http.ResponseWriter, r *http.Request, organization *models.Organization) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	projects, err := s.db.GetProjectsByOrganization(r.Context(), organization.ID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get projects")
+		return
+	}
+	if projects == nil {
+		projects = []models.Project{}
+	}
+	for i := range projects {
+		role, err := s.projectRole(r.Context(), &projects[i], userID)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "Failed to check permissions")
+			return
+		}
+		maskProjectSecrets(&projects[i], role)
+	}
+	respondJSON(w, http.StatusOK, projects)
+}
+
+// handleProjectOrganization moves a project into an organization or back to its owner, PUT /api/v1/projects/{id}/organization
+func (s *Server) handleProjectOrganization(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	projectID, err := parseIDFromPath(r.URL.Path, 3)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid project ID")
+		return
+	}
+
+	var req struct {
+		OrganizationID *int `json:"organization_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	// Moving a project into an organization grants its members access, so the user must manage the organization
+	if req.OrganizationID != nil {
+		if _, ok := s.authorizeOrganization(w, r, strconv.Itoa(*req.OrganizationID), RoleMaintainer); !ok {
+			return
+		}
+	}
+
+	if err := s.db.SetProjectOrganization(r.Context(), projectID, req.OrganizationID); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	project, err := s.db.GetProject(r.Context(), projectID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, project)
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+)
+
+// serveOrganization sends a request under /api/v1/orgs/ as the given user
+func serveOrganization(s *Server, method, path, body string, userID int) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, "/api/v1/orgs/"+path, strings.NewReader(body))
+	r = r.WithContext(context.WithValue(r.Context(), "userID", userID))
+	w := httptest.NewRecorder()
+	s.routeOrganizationsSubpath(w, r)
+	return w
+}
+
+func TestOrganizationMembers(t *testing.T) {
+	ctx := context.Background()
+	s, st := newTestServer()
+	creatorID := createTestUser(t, st, "creator@example.com")
+	ownerID := createTestUser(t, st, "owner@example.com")
+	maintainerID := createTestUser(t, st, "maintainer@example.com")
+	developerID := createTestUser(t, st, "developer@example.com")
+
+	organization, _ := st.CreateOrganization(ctx, "acme", creatorID)
+	st.AddOrganizationMember(ctx, organization.ID, ownerID, RoleOwner)
+	st.AddOrganizationMember(ctx, organization.ID, maintainerID, RoleMaintainer)
+	st.AddOrganizationMember(ctx, organization.ID, developerID, RoleDeveloper)
+	members := fmt.Sprintf("%d/members", organization.ID)
+
+	t.Run("MaintainerCannotDemoteOwner", func(t *testing.T) {
+		w := serveOrganization(s, http.MethodPost, members, `{"email":"owner@example.com","role":"viewer"}`, maintainerID)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("Expected status 403, got %d", w.Code)
+		}
+		if role, _ := st.GetOrganizationMemberRole(ctx, organization.ID, ownerID); role != RoleOwner {
+			t.Errorf("Expected the owner to stay owner, got %s", role)
+		}
+	})
+
+	t.Run("MaintainerCannotRemoveOwner", func(t *testing.T) {
+		w := serveOrganization(s, http.MethodDelete, fmt.Sprintf("%s/%d", members, ownerID), "", maintainerID)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("Expected status 403, got %d", w.Code)
+		}
+	})
+
+	t.Run("MaintainerCannotMakeOwner", func(t *testing.T) {
+		w := serveOrganization(s, http.MethodPost, members, `{"email":"developer@example.com","role":"owner"}`, maintainerID)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", w.Code)
+		}
+	})
+
+	t.Run("MaintainerChangesDeveloper", func(t *testing.T) {
+		w := serveOrganization(s, http.MethodPost, members, `{"email":"developer@example.com","role":"viewer"}`, maintainerID)
+		if w.Code != http.StatusCreated {
+			t.Errorf("Expected status 201, got %d %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("DeveloperCannotManage", func(t *testing.T) {
+		w := serveOrganization(s, http.MethodDelete, fmt.Sprintf("%s/%d", members, maintainerID), "", developerID)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("Expected status 403, got %d", w.Code)
+		}
+	})
+
+	t.Run("OwnerRemovesOwner", func(t *testing.T) {
+		w := serveOrganization(s, http.MethodDelete, fmt.Sprintf("%s/%d", members, ownerID), "", creatorID)
+		if w.Code != http.StatusNoContent {
+			t.Errorf("Expected status 204, got %d", w.Code)
+		}
+	})
+}
+
+func TestOrganizationTeams(t *testing.T) {
+	ctx := context.Background()
+	s, st := newTestServer()
+	creatorID := createTestUser(t, st, "creator@example.com")
+	maintainerID := createTestUser(t, st, "maintainer@example.com")
+	userID := createTestUser(t, st, "user@example.com")
+
+	organization, _ := st.CreateOrganization(ctx, "acme", creatorID)
+	st.AddOrganizationMember(ctx, organization.ID, maintainerID, RoleMaintainer)
+	project, err := st.CreateProject(ctx, &models.NewProject{OwnerID: creatorID, Name: "app", RepoURL: "https://example.com/app.git"})
+	if err != nil {
+		t.Fatalf("Expected no error creating project, got %v", err)
+	}
+	orgID := organization.ID
+	st.SetProjectOrganization(ctx, project.ID, &orgID)
+	project, _ = st.GetProject(ctx, project.ID)
+	teams := fmt.Sprintf("%d/teams", organization.ID)
+
+	var team models.Team
+	t.Run("Create", func(t *testing.T) {
+		w := serveOrganization(s, http.MethodPost, teams, `{"name":"backend","role":"developer"}`, maintainerID)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d %s", w.Code, w.Body.String())
+		}
+		json.Unmarshal(w.Body.Bytes(), &team)
+		if w := serveOrganization(s, http.MethodPost, teams, `{"name":"backend"}`, maintainerID); w.Code != http.StatusConflict {
+			t.Errorf("Expected status 409 for a duplicate team, got %d", w.Code)
+		}
+	})
+
+	t.Run("MemberGetsTeamRole", func(t *testing.T) {
+		w := serveOrganization(s, http.MethodPost, fmt.Sprintf("%s/%d/members", teams, team.ID), `{"email":"user@example.com"}`, maintainerID)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d %s", w.Code, w.Body.String())
+		}
+		role, err := s.projectRole(ctx, project, userID)
+		if err != nil || role != RoleDeveloper {
+			t.Errorf("Expected the team role on the organization project, got %q (%v)", role, err)
+		}
+		projects, _ := st.GetProjectsForUser(ctx, userID)
+		if len(projects) != 1 {
+			t.Errorf("Expected the organization project to be listed, got %d projects", len(projects))
+		}
+		if w := serveProject(s, http.MethodGet, fmt.Sprint(project.ID), userID); w.Code != http.StatusOK {
+			t.Errorf("Expected the team member to read the project, got %d", w.Code)
+		}
+	})
+
+	t.Run("MaintainerCannotCreateOwnerTeam", func(t *testing.T) {
+		w := serveOrganization(s, http.MethodPost, teams, `{"name":"admins","role":"owner"}`, maintainerID)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", w.Code)
+		}
+	})
+
+	t.Run("MaintainerCannotChangeOwnerTeam", func(t *testing.T) {
+		w := serveOrganization(s, http.MethodPost, teams, `{"name":"admins","role":"owner"}`, creatorID)
+		var admins models.Team
+		json.Unmarshal(w.Body.Bytes(), &admins)
+		w = serveOrganization(s, http.MethodPost, fmt.Sprintf("%s/%d/members", teams, admins.ID), `{"email":"maintainer@example.com"}`, maintainerID)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("Expected status 403, got %d", w.Code)
+		}
+	})
+
+	t.Run("OwnerTeamMemberProtected", func(t *testing.T) {
+		adminID := createTestUser(t, st, "admin@example.com")
+		admins, _ := st.CreateTeam(ctx, organization.ID, "owners", RoleOwner)
+		st.AddTeamMember(ctx, admins.ID, adminID)
+		w := serveOrganization(s, http.MethodPost, fmt.Sprintf("%d/members", organization.ID), `{"email":"admin@example.com","role":"viewer"}`, maintainerID)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("Expected status 403, got %d", w.Code)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		if w := serveOrganization(s, http.MethodDelete, fmt.Sprintf("%s/%d", teams, team.ID), "", maintainerID); w.Code != http.StatusNoContent {
+			t.Fatalf("Expected status 204, got %d", w.Code)
+		}
+		if role, _ := s.projectRole(ctx, project, userID); role != "" {
+			t.Errorf("Expected no role once the team is deleted, got %q", role)
+		}
+	})
+}
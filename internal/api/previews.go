@@ -0,0 +1,170 @@
+package api
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/executor"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+)
+
+// handlePreviews handles GET /api/v1/projects/{id}/previews
+func (s *Server) handlePreviews(w http.ResponseWriter, r *http.Request) {
+	projectID, err := parseIDFromPath(r.URL.Path, 3)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid project ID")
+		return
+	}
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	previews, err := s.db.GetPreviewsByProject(r.Context(), projectID)
+	if err != nil {
+		logger.Error("Failed to get previews: " + err.Error())
+		respondError(w, http.StatusInternalServerError, "Failed to get previews")
+		return
+	}
+	if previews == nil {
+		previews = []models.Preview{}
+	}
+	for i := range previews {
+		if s.previewTTL > 0 {
+			expiresAt := previews[i].DeployedAt.Add(s.previewTTL)
+			previews[i].ExpiresAt = &expiresAt
+		}
+	}
+	respondJSON(w, http.StatusOK, previews)
+}
+
+// handlePreview handles DELETE /api/v1/projects/{id}/previews/{previewId}, tearing the preview down
+func (s *Server) handlePreview(w http.ResponseWriter, r *http.Request) {
+	projectID, err := parseIDFromPath(r.URL.Path, 3)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid project ID")
+		return
+	}
+	previewID, err := parseIDFromPath(r.URL.Path, 5)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid preview ID")
+		return
+	}
+	if r.Method != http.MethodDelete {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	preview, err := s.db.GetPreview(r.Context(), projectID, previewID)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Preview not found")
+		return
+	}
+	project, err := s.db.GetProject(r.Context(), projectID)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Project not found")
+		return
+	}
+	if err := s.teardownPreview(r.Context(), project, preview, 0); err != nil {
+		respondError(w, http.StatusBadGateway, "Failed to tear down the preview: "+err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// previewBranch returns the branch, or tag, a preview environment deploys
+func previewBranch(params models.PipelineRunParams) string {
+	return cmp.Or(params.Branch, params.Tag)
+}
+
+// recordPreview records the branch of a run deployed to a preview environment, with the URL it is served at
+func (s *Server) recordPreview(ctx context.Context, params models.PipelineRunParams, pipelineID int) {
+	if s.db == nil || params.ProjectID == 0 {
+		return
+	}
+	p := &models.Preview{
+		ProjectID:      params.ProjectID,
+		Environment:    params.Environment,
+		Branch:         previewBranch(params),
+		ComposeProject: params.ComposeProject,
+		URL:            executor.ProxyURL(params),
+		PipelineID:     pipelineID,
+		CommitHash:     params.CommitHash,
+	}
+	if err := s.db.SavePreview(ctx, p); err != nil {
+		logger.Error(fmt.Sprintf("Failed to record the preview of branch %s: %v", p.Branch, err))
+		return
+	}
+	if p.URL != "" {
+		logger.Info(fmt.Sprintf("Preview of branch %s is live at %s", p.Branch, p.URL))
+	}
+}
+
+// teardownPreview removes the deployment of a preview from the hosts of its environment, then its record
+// The teardown is logged as the deployment of pipelineID, 0 for none. A deleted environment no longer says where the preview runs,
+// the project settings are used instead.
+func (s *Server) teardownPreview(ctx context.Context, project *models.Project, preview *models.Preview, pipelineID int) error {
+	deployProject := project
+	params := models.PipelineRunParams{ProjectID: project.ID, PipelineID: pipelineID, RepoName: project.Name, Branch: preview.Branch}
+	if env, err := s.db.GetEnvironment(ctx, project.ID, preview.Environment); err == nil {
+		deployProject = environmentProject(project, env)
+		applyEnvironment(&params, env)
+	}
+	params.ComposeProject = preview.ComposeProject
+
+	logger.Info(fmt.Sprintf("Tearing down the preview of branch %s (%s)", preview.Branch, preview.ComposeProject))
+	if _, err := s.deploymentExecutor.Teardown(ctx, deployProject, params); err != nil {
+		logger.Error(fmt.Sprintf("Failed to tear down the preview of branch %s: %v", preview.Branch, err))
+		return err
+	}
+	return s.db.DeletePreview(ctx, project.ID, preview.ID)
+}
+
+// closeBranchPreviews tears down in the background the previews of a deleted branch or closed pull request
+func (s *Server) closeBranchPreviews(ctx context.Context, repoURL, branch string) {
+	if s.db == nil {
+		return
+	}
+	project, err := s.db.FindProjectByUrl(ctx, repoURL)
+	if err != nil || project == nil {
+		return
+	}
+	previews, err := s.db.GetPreviewsByProject(ctx, project.ID)
+	if err != nil {
+		logger.Error("Failed to get previews: " + err.Error())
+		return
+	}
+	for _, preview := range previews {
+		if preview.Branch == branch {
+			go s.teardownPreview(context.WithoutCancel(ctx), project, &preview, 0)
+		}
+	}
+}
+
+// expirePreviews tears down the previews deployed more than ttl ago
+func (s *Server) expirePreviews(ttl time.Duration) {
+	if s.db == nil || ttl <= 0 {
+		return
+	}
+	previews, err := s.db.GetPreviews(s.ctx)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("Janitor: failed to get previews: %v", err))
+		return
+	}
+	for _, preview := range previews {
+		if time.Since(preview.DeployedAt) < ttl {
+			continue
+		}
+		project, err := s.db.GetProject(s.ctx, preview.ProjectID)
+		if err != nil {
+			continue
+		}
+		if err := s.teardownPreview(s.ctx, project, &preview, 0); err == nil {
+			logger.Info(fmt.Sprintf("Janitor: removed the expired preview of %s branch %s", project.Name, preview.Branch))
+		}
+	}
+}
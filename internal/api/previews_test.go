@@ -0,0 +1,70 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+)
+
+func TestPreviews(t *testing.T) {
+	ctx := context.Background()
+	s, st := newTestServer()
+	s.previewTTL = 24 * time.Hour
+	ownerID := createTestUser(t, st, "owner@example.com")
+	developerID := createTestUser(t, st, "dev@example.com")
+
+	project, err := st.CreateProject(ctx, &models.NewProject{OwnerID: ownerID, Name: "app", RepoURL: "https://example.com/app.git"})
+	if err != nil {
+		t.Fatalf("Expected no error creating project, got %v", err)
+	}
+	id := strconv.Itoa(project.ID)
+	st.AddProjectMember(ctx, project.ID, developerID, RoleDeveloper)
+	st.CreateEnvironment(ctx, &models.Environment{ProjectID: project.ID, Name: "review", Preview: true, Proxy: "traefik", ProxyDomain: "preview.example.com"})
+
+	t.Run("BranchComposeProject", func(t *testing.T) {
+		env, _ := st.GetEnvironment(ctx, project.ID, "review")
+		params := models.PipelineRunParams{ProjectID: project.ID, RepoName: "app", Branch: "feature/Login"}
+		applyEnvironment(&params, env)
+		if params.ComposeProject != "app-feature-login" {
+			t.Errorf("Expected compose project app-feature-login, got %q", params.ComposeProject)
+		}
+	})
+
+	t.Run("ListWithURL", func(t *testing.T) {
+		env, _ := st.GetEnvironment(ctx, project.ID, "review")
+		params := models.PipelineRunParams{ProjectID: project.ID, RepoName: "app", Branch: "feature/login", CommitHash: "0123456789abcdef"}
+		applyEnvironment(&params, env)
+		// A second deployment of the branch replaces its preview
+		s.recordEnvironmentVersion(ctx, project, params, 1, t.TempDir())
+		s.recordEnvironmentVersion(ctx, project, params, 2, t.TempDir())
+
+		w := serveProject(s, http.MethodGet, id+"/previews", developerID)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", w.Code)
+		}
+		var got []models.Preview
+		if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+			t.Fatalf("Expected previews, got %v", err)
+		}
+		if len(got) != 1 || got[0].PipelineID != 2 || got[0].URL != "https://app-feature-login.preview.example.com" {
+			t.Fatalf("Expected the last preview of the branch with its URL, got %+v", got)
+		}
+		if got[0].ExpiresAt == nil || !got[0].ExpiresAt.Equal(got[0].DeployedAt.Add(s.previewTTL)) {
+			t.Errorf("Expected the preview to expire a TTL after its deployment, got %v", got[0].ExpiresAt)
+		}
+		if version, _ := st.GetEnvironmentVersion(ctx, project.ID, "review"); version != nil {
+			t.Errorf("Expected previews not to set the version of the environment, got %+v", version)
+		}
+	})
+
+	t.Run("DeveloperCannotTearDown", func(t *testing.T) {
+		if w := serveProject(s, http.MethodDelete, id+"/previews/1", developerID); w.Code != http.StatusForbidden {
+			t.Errorf("Expected status 403, got %d", w.Code)
+		}
+	})
+}
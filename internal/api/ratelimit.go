@@ -0,0 +1,79 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rateLimiter allows a number of attempts per key within a fixed window
+type rateLimiter struct {
+	limit  int
+	window time.Duration
+
+	mu       sync.Mutex
+	attempts map[string]*rateWindow
+}
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{limit: limit, window: window, attempts: make(map[string]*rateWindow)}
+}
+
+// allow counts an attempt of key and reports whether it is within the limit, with the time left until the next window
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	// Expired windows are dropped as they are met, keeping the map bounded by the keys of one window
+	if len(l.attempts) > 10000 {
+		for k, w := range l.attempts {
+			if now.Sub(w.start) >= l.window {
+				delete(l.attempts, k)
+			}
+		}
+	}
+	w, ok := l.attempts[key]
+	if !ok || now.Sub(w.start) >= l.window {
+		w = &rateWindow{start: now}
+		l.attempts[key] = w
+	}
+	w.count++
+	return w.count <= l.limit, l.window - now.Sub(w.start)
+}
+
+// throttle counts an attempt of the client of a request, and of email when not empty, responding with 429 once
+// either used up the limit. A nil limiter never throttles.
+func (l *rateLimiter) throttle(w http.ResponseWriter, r *http.Request, email string) bool {
+	if l == nil {
+		return true
+	}
+	keys := []string{"ip:" + clientIP(r)}
+	if email != "" {
+		keys = append(keys, "email:"+email)
+	}
+	for _, key := range keys {
+		if ok, retryAfter := l.allow(key); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+			respondError(w, http.StatusTooManyRequests, "Too many attempts, try again later")
+			return false
+		}
+	}
+	return true
+}
+
+// clientIP returns the address of the client of a request, without port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/secrets"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+)
+
+// interruptedReason is the failure reason of pipelines that were running when the server stopped
+const interruptedReason = "Interrupted: the server restarted while the pipeline was running"
+
+// recoverPipelines reconciles the pipelines left unfinished by a previous server process
+// Running pipelines are marked failed, pipelines not started yet are queued again, and the
+// job containers and workspaces of the previous process are removed.
+func (s *Server) recoverPipelines() {
+	ctx := context.Background()
+	if count, err := s.docker.RemoveJobContainers(); err != nil {
+		logger.Warn(fmt.Sprintf("Recovery: failed to remove leftover job containers: %v", err))
+	} else if count > 0 {
+		logger.Info(fmt.Sprintf("Recovery: removed %d leftover job containers", count))
+	}
+
+	entries, err := os.ReadDir(workspaceRoot)
+	if err != nil && !os.IsNotExist(err) {
+		logger.Warn(fmt.Sprintf("Recovery: failed to list workspaces: %v", err))
+	}
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(workspaceRoot, entry.Name())); err != nil {
+			logger.Warn(fmt.Sprintf("Recovery: failed to remove workspace %s: %v", entry.Name(), err))
+		}
+	}
+
+	if s.db == nil {
+		return
+	}
+
+	pipelines, err := s.db.GetUnfinishedPipelines(ctx)
+	if err != nil {
+		logger.Error("Recovery: failed to get unfinished pipelines: " + err.Error())
+		return
+	}
+
+	for _, p := range pipelines {
+		if p.Status == "running" {
+			logger.Info(fmt.Sprintf("Recovery: pipeline %d was interrupted, marking it failed", p.ID))
+			if err := s.db.FailRunningJobs(ctx, p.ID); err != nil {
+				logger.Error(fmt.Sprintf("Recovery: failed to fail jobs of pipeline %d: %v", p.ID, err))
+			}
+			if err := s.db.CancelUnfinishedJobs(ctx, p.ID); err != nil {
+				logger.Error(fmt.Sprintf("Recovery: failed to cancel jobs of pipeline %d: %v", p.ID, err))
+			}
+			s.failPipeline(p.ID, interruptedReason)
+			continue
+		}
+
+		project, err := s.db.GetProject(ctx, p.ProjectID)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Recovery: failed to get project of pipeline %d: %v", p.ID, err))
+			reason := interruptedReason
+			if errors.Is(err, secrets.ErrKeyMismatch) {
+				reason = keyMismatchReason
+			}
+			s.failPipeline(p.ID, reason)
+			continue
+		}
+		logger.Info(fmt.Sprintf("Recovery: queuing pipeline %d again", p.ID))
+		pipeline := p
+		s.enqueuePipeline(manualRunParams(project, &pipeline, p.Branch))
+	}
+}
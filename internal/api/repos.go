@@ -0,0 +1,383 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/ssh"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+)
+
+// gitHubAPIURL is the base URL of the GitHub REST API, a variable for tests
+var gitHubAPIURL = "https://api.github.com"
+
+// repoClient calls the repository host APIs on behalf of the logged-in user
+var repoClient = &http.Client{Timeout: 15 * time.Second}
+
+// remoteRepository is a repository of the user on their OAuth provider
+type remoteRepository struct {
+	Provider      string `json:"provider"`
+	FullName      string `json:"full_name"`
+	Name          string `json:"name"`
+	CloneURL      string `json:"clone_url"`
+	DefaultBranch string `json:"default_branch"`
+	Private       bool   `json:"private"`
+}
+
+// gitHubRepo is a repository as returned by the GitHub API
+type gitHubRepo struct {
+	FullName      string `json:"full_name"`
+	Name          string `json:"name"`
+	CloneURL      string `json:"clone_url"`
+	DefaultBranch string `json:"default_branch"`
+	Private       bool   `json:"private"`
+}
+
+func (g gitHubRepo) remote() remoteRepository {
+	return remoteRepository{Provider: "github", FullName: g.FullName, Name: g.Name, CloneURL: g.CloneURL, DefaultBranch: g.DefaultBranch, Private: g.Private}
+}
+
+// gitLabRepo is a project as returned by the GitLab API
+type gitLabRepo struct {
+	PathWithNamespace string `json:"path_with_namespace"`
+	Name              string `json:"name"`
+	HTTPURLToRepo     string `json:"http_url_to_repo"`
+	DefaultBranch     string `json:"default_branch"`
+	Visibility        string `json:"visibility"`
+}
+
+func (g gitLabRepo) remote() remoteRepository {
+	return remoteRepository{Provider: "gitlab", FullName: g.PathWithNamespace, Name: g.Name, CloneURL: g.HTTPURLToRepo, DefaultBranch: g.DefaultBranch, Private: g.Visibility != "public"}
+}
+
+// userRepoToken returns the OAuth provider and token of the user of the request, responding with an error when unusable
+func (s *Server) userRepoToken(w http.ResponseWriter, r *http.Request) (int, string, string, bool) {
+	if s.db == nil {
+		respondError(w, http.StatusServiceUnavailable, "Database not available")
+		return 0, "", "", false
+	}
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return 0, "", "", false
+	}
+	user, err := s.db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return 0, "", "", false
+	}
+	if user.Provider != "github" && user.Provider != "gitlab" {
+		respondError(w, http.StatusBadRequest, "Repositories can only be listed for users logged in with GitHub or GitLab")
+		return 0, "", "", false
+	}
+	token, err := s.db.GetUserOAuthToken(r.Context(), userID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return 0, "", "", false
+	}
+	if token == "" {
+		respondError(w, http.StatusForbidden, "Repository access not granted, log in with /auth/"+user.Provider+"/login?access=repos")
+		return 0, "", "", false
+	}
+	return userID, user.Provider, token, true
+}
+
+// handleRepos lists the repositories the user can access on their OAuth provider, GET /api/v1/repos
+func (s *Server) handleRepos(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	_, provider, token, ok := s.userRepoToken(w, r)
+	if !ok {
+		return
+	}
+
+	repos := []remoteRepository{}
+	if provider == "github" {
+		var list []gitHubRepo
+		if err := repoAPI(http.MethodGet, gitHubAPIURL+"/user/repos?per_page=100&sort=updated", provider, token, nil, &list); err != nil {
+			respondError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+		for _, repo := range list {
+			repos = append(repos, repo.remote())
+		}
+	} else {
+		var list []gitLabRepo
+		if err := repoAPI(http.MethodGet, gitLabBaseURL()+"/api/v4/projects?membership=true&per_page=100&order_by=last_activity_at", provider, token, nil, &list); err != nil {
+			respondError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+		for _, repo := range list {
+			repos = append(repos, repo.remote())
+		}
+	}
+	respondJSON(w, http.StatusOK, repos)
+}
+
+// handleRepoImport creates a project from a repository of the user, optionally from a template, and registers its push webhook, POST /api/v1/repos/import
+func (s *Server) handleRepoImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	userID, provider, token, ok := s.userRepoToken(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		FullName string `json:"full_name"`
+		Name     string `json:"name"`
+		// TemplateID is the template the project is created from, 0 for none
+		TemplateID int `json:"template_id"`
+		// InstallationID is the GitHub App installation the project clones with, 0 for a deploy key
+		InstallationID int64 `json:"github_installation_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if _, err := repoPath(provider, req.FullName); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.InstallationID != 0 && provider != "github" {
+		respondError(w, http.StatusBadRequest, "github_installation_id is only valid for GitHub repositories")
+		return
+	}
+	var template *models.ProjectTemplate
+	if req.TemplateID != 0 {
+		if template, ok = s.authorizeTemplate(w, r, strconv.Itoa(req.TemplateID), false); !ok {
+			return
+		}
+	}
+
+	result := s.importRepository(r.Context(), userID, provider, token, req.FullName, req.Name, req.InstallationID, template)
+	if result.Project == nil {
+		respondError(w, result.status, result.Error)
+		return
+	}
+	respondJSON(w, http.StatusCreated, result)
+}
+
+// importResult is the outcome of the import of a repository as a project
+type importResult struct {
+	FullName string          `json:"full_name"`
+	Project  *models.Project `json:"project,omitempty"`
+	// WebhookRegistered is false when the push webhook could not be registered, the project being triggered manually then
+	WebhookRegistered bool   `json:"webhook_registered"`
+	WebhookError      string `json:"webhook_error,omitempty"`
+	// PipelineCommitted reports whether the pipeline file of the template was committed to the repository
+	PipelineCommitted bool `json:"pipeline_committed,omitempty"`
+	// TemplateErrors are the parts of the template that could not be applied to the project
+	TemplateErrors []string `json:"template_errors,omitempty"`
+	// Error is why no project was created
+	Error  string `json:"error,omitempty"`
+	status int
+}
+
+// importRepository creates a project from a repository of the user, registers its push webhook and applies template when not nil
+// The project clones with the GitHub App installation when installationID is set, with a read-only deploy key for private
+// repositories otherwise: the token of the user is only used during the import, its maintainers could read it from the project.
+// A project without its webhook or some of its template is kept, the result saying what is missing.
+func (s *Server) importRepository(ctx context.Context, userID int, provider, token, fullName, name string, installationID int64, template *models.ProjectTemplate) *importResult {
+	result := &importResult{FullName: fullName, status: http.StatusCreated}
+	path, err := repoPath(provider, fullName)
+	if err != nil {
+		result.Error, result.status = err.Error(), http.StatusBadRequest
+		return result
+	}
+
+	var repo remoteRepository
+	if provider == "github" {
+		var g gitHubRepo
+		if err := repoAPI(http.MethodGet, gitHubAPIURL+"/repos/"+path, provider, token, nil, &g); err != nil {
+			result.Error, result.status = err.Error(), http.StatusBadGateway
+			return result
+		}
+		repo = g.remote()
+	} else {
+		var g gitLabRepo
+		if err := repoAPI(http.MethodGet, gitLabBaseURL()+"/api/v4/projects/"+path, provider, token, nil, &g); err != nil {
+			result.Error, result.status = err.Error(), http.StatusBadGateway
+			return result
+		}
+		repo = g.remote()
+	}
+	if name == "" {
+		name = repo.Name
+	}
+
+	newProject := &models.NewProject{
+		OwnerID:              userID,
+		Name:                 name,
+		RepoURL:              repo.CloneURL,
+		GitHubInstallationID: installationID,
+	}
+	if installationID != 0 {
+		if err := s.githubApp.CheckInstallation(ctx, installationID, repo.CloneURL); err != nil {
+			result.Error, result.status = "Invalid github_installation_id: "+err.Error(), http.StatusBadRequest
+			return result
+		}
+	}
+	if template != nil {
+		newProject.PipelineFilename = template.PipelineFilename
+	}
+	project, err := s.db.CreateProject(ctx, newProject)
+	if err != nil {
+		logger.Error("Failed to create project: " + err.Error())
+		result.Error, result.status = "Failed to create project", http.StatusInternalServerError
+		return result
+	}
+
+	if installationID == 0 && repo.Private {
+		if err := s.addImportDeployKey(ctx, project, provider, token, repo); err != nil {
+			logger.Error(fmt.Sprintf("Failed to add deploy key to %s: %v", repo.FullName, err))
+			if err := s.db.DeleteProject(ctx, project.ID); err != nil {
+				logger.Error(fmt.Sprintf("Failed to delete project %d: %v", project.ID, err))
+			}
+			result.Error, result.status = "Failed to add a deploy key to the repository: "+err.Error(), http.StatusBadGateway
+			return result
+		}
+	}
+	result.Project = project
+	logger.Info(fmt.Sprintf("Project %d imported from %s repository %s", project.ID, provider, repo.FullName))
+
+	if err := registerPushWebhook(provider, token, repo); err != nil {
+		logger.Error(fmt.Sprintf("Failed to register webhook of %s: %v", repo.FullName, err))
+		result.WebhookError = err.Error()
+	} else {
+		result.WebhookRegistered = true
+	}
+
+	// Applied once the webhook is registered, so the commit of the pipeline file starts the first pipeline
+	if template != nil {
+		result.PipelineCommitted, result.TemplateErrors = s.applyTemplate(ctx, project, template, provider, token, repo)
+	}
+	return result
+}
+
+// addImportDeployKey generates the deploy key of an imported project and adds it, read-only, to the repository
+func (s *Server) addImportDeployKey(ctx context.Context, project *models.Project, provider, token string, repo remoteRepository) error {
+	privateKey, publicKey, err := ssh.GenerateKey(fmt.Sprintf("cicd-project-%d", project.ID))
+	if err != nil {
+		return err
+	}
+	path, err := repoPath(provider, repo.FullName)
+	if err != nil {
+		return err
+	}
+	title := fmt.Sprintf("CI/CD project %d", project.ID)
+	if provider == "github" {
+		key := map[string]interface{}{"title": title, "key": publicKey, "read_only": true}
+		err = repoAPI(http.MethodPost, gitHubAPIURL+"/repos/"+path+"/keys", provider, token, key, nil)
+	} else {
+		key := map[string]interface{}{"title": title, "key": publicKey, "can_push": false}
+		err = repoAPI(http.MethodPost, gitLabBaseURL()+"/api/v4/projects/"+path+"/deploy_keys", provider, token, key, nil)
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.db.SetProjectDeployKey(ctx, project.ID, privateKey, publicKey); err != nil {
+		return err
+	}
+	project.DeployKeyPublic = publicKey
+	return nil
+}
+
+// repoPath returns the escaped API path of a repository name, owner/repo on GitHub and group/.../project on GitLab
+// Other names are rejected, so that a name cannot reach another endpoint of the API with the token of the user.
+func repoPath(provider, fullName string) (string, error) {
+	segments := strings.Split(fullName, "/")
+	if len(segments) < 2 || (provider == "github" && len(segments) != 2) {
+		return "", fmt.Errorf("full_name must be owner/repository")
+	}
+	for _, segment := range segments {
+		if segment == "" || segment == "." || segment == ".." {
+			return "", fmt.Errorf("full_name must be owner/repository")
+		}
+	}
+	// GitLab identifies projects by their whole escaped path
+	if provider == "gitlab" {
+		return url.PathEscape(fullName), nil
+	}
+	return url.PathEscape(segments[0]) + "/" + url.PathEscape(segments[1]), nil
+}
+
+// registerPushWebhook makes the repository host send its push events to the webhook endpoint of API_URL
+// The webhook is signed with GITHUB_WEBHOOK_SECRET, checked by handleGitHubWebhook.
+func registerPushWebhook(provider, token string, repo remoteRepository) error {
+	apiURL := strings.TrimRight(os.Getenv("API_URL"), "/")
+	if apiURL == "" {
+		return fmt.Errorf("API_URL is not set")
+	}
+	if provider != "github" {
+		return fmt.Errorf("push webhooks are only received from GitHub")
+	}
+	secret := os.Getenv("GITHUB_WEBHOOK_SECRET")
+	if secret == "" {
+		return fmt.Errorf("GITHUB_WEBHOOK_SECRET is not set")
+	}
+	path, err := repoPath(provider, repo.FullName)
+	if err != nil {
+		return err
+	}
+
+	hook := map[string]interface{}{
+		"name":   "web",
+		"active": true,
+		"events": []string{"push"},
+		"config": map[string]string{
+			"url":          apiURL + "/webhook/github",
+			"content_type": "json",
+			"secret":       secret,
+		},
+	}
+	return repoAPI(http.MethodPost, gitHubAPIURL+"/repos/"+path+"/hooks", provider, token, hook, nil)
+}
+
+// repoAPI sends a request to the API of a repository host, reading the JSON response into out when set
+func repoAPI(method, apiURL, provider, token string, body, out interface{}) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, apiURL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	// GitHub and GitLab both accept OAuth tokens as bearer tokens
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	if provider == "github" {
+		req.Header.Set("Accept", "application/vnd.github+json")
+	}
+
+	resp, err := repoClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned %s", provider, resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
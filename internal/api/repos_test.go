@@ -0,0 +1,158 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+)
+
+// fakeGitHub serves the repository endpoints used by the import, recording the bodies it receives by path
+type fakeGitHub struct {
+	mu       sync.Mutex
+	received map[string]map[string]interface{}
+}
+
+func (f *fakeGitHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer user-token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if r.Method == http.MethodGet && r.URL.Path == "/repos/alice/app" {
+		json.NewEncoder(w).Encode(gitHubRepo{FullName: "alice/app", Name: "app", CloneURL: "https://github.com/alice/app.git", DefaultBranch: "main", Private: true})
+		return
+	}
+	if r.Method != http.MethodPost || (r.URL.Path != "/repos/alice/app/keys" && r.URL.Path != "/repos/alice/app/hooks") {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	var body map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&body)
+	f.mu.Lock()
+	f.received[r.URL.Path] = body
+	f.mu.Unlock()
+	w.WriteHeader(http.StatusCreated)
+}
+
+// postRepoImport sends an import request as the given user
+func postRepoImport(s *Server, body string, userID int) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/repos/import", strings.NewReader(body))
+	r = r.WithContext(context.WithValue(r.Context(), "userID", userID))
+	w := httptest.NewRecorder()
+	s.handleRepoImport(w, r)
+	return w
+}
+
+func TestRepoImport(t *testing.T) {
+	github := &fakeGitHub{received: map[string]map[string]interface{}{}}
+	srv := httptest.NewServer(github)
+	defer srv.Close()
+	defer func(url string) { gitHubAPIURL = url }(gitHubAPIURL)
+	gitHubAPIURL = srv.URL
+	t.Setenv("API_URL", "https://ci.example.com")
+	t.Setenv("GITHUB_WEBHOOK_SECRET", "hook-secret")
+
+	ctx := context.Background()
+	s, st := newTestServer()
+	user := &models.User{Email: "alice@example.com", Provider: "github", ProviderID: "1"}
+	if err := st.CreateUser(ctx, user); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	t.Run("NoRepositoryAccess", func(t *testing.T) {
+		if w := postRepoImport(s, `{"full_name": "alice/app"}`, user.ID); w.Code != http.StatusForbidden {
+			t.Errorf("Expected status 403 before repository access is granted, got %d", w.Code)
+		}
+	})
+
+	if err := st.SetUserOAuthToken(ctx, user.ID, "user-token"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	t.Run("InvalidName", func(t *testing.T) {
+		for _, name := range []string{"", "alice", "alice/app/hooks", "../user", "alice/..", "alice//app"} {
+			if w := postRepoImport(s, `{"full_name": "`+name+`"}`, user.ID); w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status 400 for %q, got %d", name, w.Code)
+			}
+		}
+	})
+
+	t.Run("DeployKeyAndSignedWebhook", func(t *testing.T) {
+		w := postRepoImport(s, `{"full_name": "alice/app"}`, user.ID)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d %s", w.Code, w.Body.String())
+		}
+		var result importResult
+		json.NewDecoder(w.Body).Decode(&result)
+		if !result.WebhookRegistered {
+			t.Errorf("Expected the webhook to be registered, got %q", result.WebhookError)
+		}
+
+		project, err := st.GetProject(ctx, result.Project.ID)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if project.AccessToken != "" {
+			t.Errorf("Expected the token of the user not to be stored in the project, got %q", project.AccessToken)
+		}
+		key := github.received["/repos/alice/app/keys"]
+		if project.DeployKey == "" || key["key"] != project.DeployKeyPublic || key["read_only"] != true {
+			t.Errorf("Expected a read-only deploy key matching the project one, got %v", key)
+		}
+		config, _ := github.received["/repos/alice/app/hooks"]["config"].(map[string]interface{})
+		if config["secret"] != "hook-secret" || config["url"] != "https://ci.example.com/webhook/github" {
+			t.Errorf("Expected the webhook to be signed with the secret, got %v", config)
+		}
+	})
+}
+
+func TestRepoAccessLogin(t *testing.T) {
+	InitializeOAuth()
+	s, _ := newTestServer()
+
+	for query, wantRepo := range map[string]bool{"": false, "?access=repos": true} {
+		r := httptest.NewRequest(http.MethodGet, "/auth/github/login"+query, nil)
+		w := httptest.NewRecorder()
+		s.handleAuthLogin(w, r)
+		location := w.Header().Get("Location")
+		if got := strings.Contains(location, "admin%3Arepo_hook"); got != wantRepo {
+			t.Errorf("Expected repository scopes %v for %q, got %s", wantRepo, query, location)
+		}
+	}
+}
+
+func TestGitHubWebhookSignature(t *testing.T) {
+	t.Setenv("GITHUB_WEBHOOK_SECRET", "hook-secret")
+	body := []byte(`{"ref": "refs/heads/main"}`)
+	sign := func(secret string) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	if !validGitHubSignature(body, sign("hook-secret")) {
+		t.Error("Expected the signature of the secret to be valid")
+	}
+	for _, bad := range []string{"", "sha256=00", sign("other-secret")} {
+		if validGitHubSignature(body, bad) {
+			t.Errorf("Expected signature %q to be rejected", bad)
+		}
+	}
+
+	s, _ := newTestServer()
+	r := httptest.NewRequest(http.MethodPost, "/webhook/github", strings.NewReader(string(body)))
+	r.Header.Set("X-Hub-Signature-256", "sha256=00")
+	w := httptest.NewRecorder()
+	s.handleGitHubWebhook(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 for an unsigned delivery, got %d", w.Code)
+	}
+}
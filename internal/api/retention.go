@@ -0,0 +1,103 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+)
+
+// validRetentionAction reports whether action is a retention action, empty selecting the default one
+func validRetentionAction(action string) bool {
+	switch action {
+	case "", models.RetentionActionDelete, models.RetentionActionArchive:
+		return true
+	}
+	return false
+}
+
+// handleRetention handles GET and POST /api/v1/projects/{id}/retention
+// GET counts what the policy of the project would remove now, ?days= and ?action= previewing another policy.
+// POST applies the policy of the project right away instead of waiting for the janitor.
+func (s *Server) handleRetention(w http.ResponseWriter, r *http.Request) {
+	projectID, err := parseIDFromPath(r.URL.Path, 3)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid project ID")
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	project, err := s.db.GetProject(r.Context(), projectID)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Project not found")
+		return
+	}
+	days, action := project.RetentionDays, project.RetentionAction
+	if r.Method == http.MethodGet {
+		if value := r.URL.Query().Get("days"); value != "" {
+			if days, err = strconv.Atoi(value); err != nil || days <= 0 {
+				respondError(w, http.StatusBadRequest, "days must be a positive number")
+				return
+			}
+		}
+		if value := r.URL.Query().Get("action"); value != "" {
+			if !validRetentionAction(value) {
+				respondError(w, http.StatusBadRequest, "action must be delete or archive")
+				return
+			}
+			action = value
+		}
+	}
+	if days == 0 {
+		respondError(w, http.StatusConflict, "The project keeps its pipelines forever, set retention_days first")
+		return
+	}
+
+	result, err := s.applyRetention(r.Context(), project.ID, days, action, r.Method == http.MethodGet)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to apply the retention policy of project %d: %v", project.ID, err))
+		if result == nil || result.Pipelines == 0 {
+			respondError(w, http.StatusInternalServerError, "Failed to apply the retention policy")
+			return
+		}
+	}
+	respondJSON(w, http.StatusOK, result)
+}
+
+// applyRetention removes, or counts with dryRun, the pipelines of a project finished more than days ago
+func (s *Server) applyRetention(ctx context.Context, projectID, days int, action string, dryRun bool) (*models.RetentionResult, error) {
+	before := time.Now().Add(-time.Duration(days) * 24 * time.Hour)
+	return s.db.PrunePipelines(ctx, projectID, before, action, dryRun)
+}
+
+// enforceRetention applies the retention policy of every project setting one
+func (s *Server) enforceRetention() {
+	if s.db == nil {
+		return
+	}
+	projects, err := s.db.GetAllProjects(s.ctx)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("Janitor: failed to get projects: %v", err))
+		return
+	}
+	for _, project := range projects {
+		if project.RetentionDays <= 0 {
+			continue
+		}
+		result, err := s.applyRetention(s.ctx, project.ID, project.RetentionDays, project.RetentionAction, false)
+		if err != nil {
+			logger.Warn(fmt.Sprintf("Janitor: failed to apply the retention policy of %s: %v", project.Name, err))
+		}
+		if result != nil && result.Pipelines > 0 {
+			logger.Info(fmt.Sprintf("Janitor: retention policy of %s (%s) removed %d pipelines, %d jobs, %d deployments and %d stored objects",
+				project.Name, result.Action, result.Pipelines, result.Jobs, result.Deployments, result.Objects))
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+)
+
+func TestRetention(t *testing.T) {
+	ctx := context.Background()
+	s, st := newTestServer()
+	ownerID := createTestUser(t, st, "owner@example.com")
+	developerID := createTestUser(t, st, "dev@example.com")
+
+	project, err := st.CreateProject(ctx, &models.NewProject{OwnerID: ownerID, Name: "app", RepoURL: "https://example.com/app.git"})
+	if err != nil {
+		t.Fatalf("Expected no error creating project, got %v", err)
+	}
+	id := strconv.Itoa(project.ID)
+	st.AddProjectMember(ctx, project.ID, developerID, RoleDeveloper)
+
+	finished := func(branch, status string) *models.Pipeline {
+		p, _ := st.CreatePipeline(ctx, project.ID, branch, "0123456789abcdef")
+		st.CreateJob(ctx, p.ID, "test", "test", "alpine")
+		st.UpdatePipelineStatus(ctx, p.ID, status)
+		return p
+	}
+	old := finished("main", "success")
+	latest := finished("main", "success")
+	failed := finished("feature", "failed")
+
+	t.Run("NoPolicy", func(t *testing.T) {
+		if w := serveProject(s, http.MethodPost, id+"/retention", ownerID); w.Code != http.StatusConflict {
+			t.Errorf("Expected status 409, got %d", w.Code)
+		}
+	})
+
+	t.Run("DeveloperForbidden", func(t *testing.T) {
+		if w := serveProject(s, http.MethodGet, id+"/retention?days=1", developerID); w.Code != http.StatusForbidden {
+			t.Errorf("Expected status 403, got %d", w.Code)
+		}
+	})
+
+	t.Run("DryRun", func(t *testing.T) {
+		// Nothing finished a day ago yet
+		w := serveProject(s, http.MethodGet, id+"/retention?days=1", ownerID)
+		var result models.RetentionResult
+		json.NewDecoder(w.Body).Decode(&result)
+		if w.Code != http.StatusOK || !result.DryRun || result.Pipelines != 0 {
+			t.Errorf("Expected an empty dry run, got %d %+v", w.Code, result)
+		}
+	})
+
+	t.Run("KeepsLatestSuccessfulPerBranch", func(t *testing.T) {
+		result, err := s.applyRetention(ctx, project.ID, -1, models.RetentionActionDelete, false)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if result.Pipelines != 2 || result.Jobs != 2 {
+			t.Errorf("Expected 2 pipelines and 2 jobs removed, got %+v", result)
+		}
+		if _, err := st.GetPipeline(ctx, old.ID); err == nil {
+			t.Error("Expected the older successful pipeline to be deleted")
+		}
+		if _, err := st.GetPipeline(ctx, failed.ID); err == nil {
+			t.Error("Expected the failed pipeline to be deleted")
+		}
+		if _, err := st.GetPipeline(ctx, latest.ID); err != nil {
+			t.Errorf("Expected the latest successful pipeline to be kept, got %v", err)
+		}
+	})
+
+	t.Run("Archive", func(t *testing.T) {
+		archived := finished("feature", "failed")
+		if _, err := s.applyRetention(ctx, project.ID, -1, models.RetentionActionArchive, false); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		p, err := st.GetPipeline(ctx, archived.ID)
+		if err != nil || p.ArchivedAt == nil {
+			t.Fatalf("Expected the pipeline to be kept archived, got %+v, %v", p, err)
+		}
+		if result, _ := s.applyRetention(ctx, project.ID, -1, models.RetentionActionArchive, true); result.Pipelines != 0 {
+			t.Errorf("Expected archived pipelines not to be archived again, got %+v", result)
+		}
+	})
+}
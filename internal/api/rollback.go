@@ -0,0 +1,113 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/tracing"
+)
+
+// handleRollback handles POST /api/v1/projects/{id}/deployments/rollback
+func (s *Server) handleRollback(w http.ResponseWriter, r *http.Request) {
+	projectID, err := parseIDFromPath(r.URL.Path, 3)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid project ID")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		s.rollbackDeployment(w, r, projectID)
+	default:
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// rollbackDeployment creates a pipeline redeploying the version of a previous successful pipeline
+// Without pipeline_id, the last version deployed to the environment (or the last successful pipeline) is used.
+func (s *Server) rollbackDeployment(w http.ResponseWriter, r *http.Request, projectID int) {
+	if s.db == nil {
+		respondError(w, http.StatusServiceUnavailable, "Database not available")
+		return
+	}
+
+	// Optional body: {"environment": "production", "pipeline_id": 42}
+	var req struct {
+		Environment string `json:"environment"`
+		PipelineID  int    `json:"pipeline_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	project, err := s.db.GetProject(r.Context(), projectID)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Project not found")
+		return
+	}
+
+	userID, _ := r.Context().Value("userID").(int)
+	if req.Environment != "" {
+		if _, err := s.db.GetEnvironment(r.Context(), projectID, req.Environment); err != nil {
+			respondEnvironmentError(w, err)
+			return
+		}
+		if _, reason := s.deployEnvironment(r.Context(), project, req.Environment, "", userID); reason != "" {
+			respondError(w, http.StatusForbidden, reason)
+			return
+		}
+	}
+
+	var target *models.Pipeline
+	if req.PipelineID != 0 {
+		target, err = s.db.GetPipeline(r.Context(), req.PipelineID)
+		if err != nil || target.ProjectID != projectID {
+			respondError(w, http.StatusNotFound, "Pipeline not found")
+			return
+		}
+		if target.Status != "success" {
+			respondError(w, http.StatusConflict, "Only successful pipelines can be rolled back to")
+			return
+		}
+	} else {
+		target = s.lastDeployedPipeline(r.Context(), projectID, req.Environment)
+	}
+	if target == nil || target.CommitHash == "" {
+		respondError(w, http.StatusNotFound, "No successful deployment to roll back to")
+		return
+	}
+
+	pipeline, err := s.db.CreatePipeline(r.Context(), projectID, target.Branch, target.CommitHash)
+	if err != nil {
+		logger.Error("Failed to create pipeline: " + err.Error())
+		respondError(w, http.StatusInternalServerError, "Failed to create pipeline")
+		return
+	}
+	if _, err := s.db.CreatePendingDeployment(r.Context(), pipeline.ID, req.Environment); err != nil {
+		logger.Error("Failed to pre-create deployment: " + err.Error())
+	}
+
+	logger.Info(fmt.Sprintf("Rolling back project %s to pipeline %d as pipeline %d", project.Name, target.ID, pipeline.ID))
+
+	params := manualRunParams(project, pipeline, target.Branch)
+	params.Environment = req.Environment
+	params.TriggeredBy = userID
+	params.TraceContext = tracing.Inject(r.Context())
+	params.RequestID = requestIDFromContext(r.Context())
+	if err := s.enqueueRun(params, func(ctx context.Context, params models.PipelineRunParams) {
+		s.runRollbackLogic(ctx, params, target)
+	}); err != nil {
+		respondError(w, http.StatusServiceUnavailable, "Pipeline queue is full, try again later")
+		return
+	}
+	pipeline.Status = "queued"
+
+	respondJSON(w, http.StatusAccepted, pipeline)
+}
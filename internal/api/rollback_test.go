@@ -0,0 +1,65 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+)
+
+// serveRollback posts a rollback request of a project as the given user
+func serveRollback(s *Server, projectID, body string, userID int) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/projects/"+projectID+"/deployments/rollback", strings.NewReader(body))
+	r = r.WithContext(context.WithValue(r.Context(), "userID", userID))
+	w := httptest.NewRecorder()
+	s.routeProjectsSubpath(w, r)
+	return w
+}
+
+func TestRollbackDeployment(t *testing.T) {
+	ctx := context.Background()
+	s, st := newTestServer()
+	ownerID := createTestUser(t, st, "owner@example.com")
+	developerID := createTestUser(t, st, "dev@example.com")
+
+	project, err := st.CreateProject(ctx, &models.NewProject{OwnerID: ownerID, Name: "app", RepoURL: "https://example.com/app.git"})
+	if err != nil {
+		t.Fatalf("Expected no error creating project, got %v", err)
+	}
+	id := strconv.Itoa(project.ID)
+	st.AddProjectMember(ctx, project.ID, developerID, RoleDeveloper)
+	st.CreateEnvironment(ctx, &models.Environment{ProjectID: project.ID, Name: "production", Protected: true})
+
+	t.Run("NothingToRollBackTo", func(t *testing.T) {
+		if w := serveProject(s, http.MethodPost, id+"/deployments/rollback", developerID); w.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404, got %d", w.Code)
+		}
+	})
+
+	t.Run("ViewerCannotRollBack", func(t *testing.T) {
+		viewerID := createTestUser(t, st, "viewer@example.com")
+		st.AddProjectMember(ctx, project.ID, viewerID, RoleViewer)
+		if w := serveProject(s, http.MethodPost, id+"/deployments/rollback", viewerID); w.Code != http.StatusForbidden {
+			t.Errorf("Expected status 403, got %d", w.Code)
+		}
+	})
+
+	t.Run("ProtectedEnvironment", func(t *testing.T) {
+		if w := serveRollback(s, id, `{"environment":"production"}`, developerID); w.Code != http.StatusForbidden {
+			t.Errorf("Expected status 403, got %d", w.Code)
+		}
+	})
+
+	t.Run("TargetMustHaveSucceeded", func(t *testing.T) {
+		failed, _ := st.CreatePipeline(ctx, project.ID, "main", "0123456789abcdef")
+		st.UpdatePipelineStatus(ctx, failed.ID, "failed")
+		body := `{"pipeline_id":` + strconv.Itoa(failed.ID) + `}`
+		if w := serveRollback(s, id, body, developerID); w.Code != http.StatusConflict {
+			t.Errorf("Expected status 409, got %d", w.Code)
+		}
+	})
+}
@@ -1,50 +1,128 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
+	"strings"
 	"time"
 
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/executor"
 	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/git"
 	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/parser/compose"
 	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/parser/pipeline"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/queue"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/secrets"
 	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+// workspaceRoot holds the repository clones of the running pipelines
+var workspaceRoot = filepath.Join("/tmp", "cicd-workspaces")
+
+// gitCacheRoot is the default directory of the repository mirrors, outside workspaceRoot so the janitor leaves it alone
+var gitCacheRoot = filepath.Join("/tmp", "cicd-git-cache")
+
+// cloneCacheKey names the mirror of a project in the clone cache
+func cloneCacheKey(projectID int) string {
+	return fmt.Sprintf("project-%d", projectID)
+}
+
+// cloneRepository clones the repository of a run to destPath, referencing the mirror of the project when the clone cache is enabled
+// The mirror is fetched first, so only the objects it lacks are downloaded; a failing mirror falls back to a plain clone.
+func (s *Server) cloneRepository(params models.PipelineRunParams, destPath string) error {
+	auth := git.Auth{Token: params.AccessToken, DeployKey: params.DeployKey}
+	if s.cloneCache == nil || params.ProjectID == 0 {
+		return git.Clone(params.RepoURL, params.Branch, destPath, auth, params.CommitHash)
+	}
+	mirror, release, err := s.cloneCache.Update(cloneCacheKey(params.ProjectID), params.RepoURL, auth)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("Failed to update the clone cache of project %d, cloning without it: %v", params.ProjectID, err))
+		return git.Clone(params.RepoURL, params.Branch, destPath, auth, params.CommitHash)
+	}
+	defer release()
+	return git.CloneWithReference(params.RepoURL, params.Branch, destPath, auth, params.CommitHash, mirror)
+}
+
 // runPipelineLogic executes the CI/CD pipeline logic
 // This unifies logic from webhook and manual trigger
-func (s *Server) runPipelineLogic(params models.PipelineRunParams) {
+// ctx is cancelled when the pipeline is, see trackRun
+func (s *Server) runPipelineLogic(ctx context.Context, params models.PipelineRunParams) {
+	// The pipeline span continues the trace of the request that triggered the run
+	ctx, span := tracing.Start(tracing.Extract(ctx, params.TraceContext), "pipeline",
+		attribute.Int("cicd.project.id", params.ProjectID),
+		attribute.Int("cicd.pipeline.id", params.PipelineID),
+		attribute.String("cicd.branch", params.Branch),
+		attribute.String("cicd.tag", params.Tag),
+		attribute.String("cicd.commit", params.CommitHash),
+		attribute.String("cicd.request_id", params.RequestID))
+	defer span.End()
+	// Records must land even once the pipeline is cancelled
+	dbCtx := context.WithoutCancel(ctx)
+
 	// Fetch project details for SSH/Registry info
 	var project *models.Project
 	if s.db != nil {
-		project, _ = s.db.GetProject(params.ProjectID)
+		var err error
+		project, err = s.db.GetProject(dbCtx, params.ProjectID)
+		// Credentials that cannot be decrypted would only fail later, in the clone or on the SSH host
+		if errors.Is(err, secrets.ErrKeyMismatch) {
+			logger.Error(fmt.Sprintf("Pipeline %d: %v", params.PipelineID, err))
+			s.failPipeline(params.PipelineID, keyMismatchReason)
+			return
+		}
+	}
+
+	// Installation tokens expire after an hour, so they are minted when the run starts rather than when it is queued
+	if project != nil && project.GitHubInstallationID != 0 {
+		token, err := s.githubApp.RepoToken(ctx, project)
+		if err != nil {
+			logger.Error("Failed to get GitHub App installation token: " + err.Error())
+			s.failPipeline(params.PipelineID, "Failed to get GitHub App installation token: "+err.Error())
+			return
+		}
+		params.AccessToken = token
 	}
 
 	// Create a unique workspace directory
-	workspaceDir := filepath.Join("/tmp", "cicd-workspaces", fmt.Sprintf("%s-%s-%d", params.RepoName, params.CommitHash[:8], time.Now().Unix()))
+	workspaceDir := filepath.Join(workspaceRoot, fmt.Sprintf("%s-%s-%d", params.RepoName, params.CommitHash[:8], time.Now().Unix()))
 
-	logger.Info(fmt.Sprintf("Starting pipeline for %s", params.RepoName))
+	logger.Info(fmt.Sprintf("Starting pipeline for %s", params.RepoName), runLogAttrs(params)...)
 
-	// Clone the repository
-	logger.Info(fmt.Sprintf("Cloning repository to %s", workspaceDir))
+	// A pipeline parked on its manual jobs resumes in the workspace its jobs left, unless it was removed meanwhile
+	if err := os.Rename(parkedWorkspace(params.PipelineID), workspaceDir); err == nil {
+		logger.Info(fmt.Sprintf("Resuming in the workspace of parked pipeline %d", params.PipelineID))
+	} else {
+		// Clone the repository
+		logger.Info(fmt.Sprintf("Cloning repository to %s", workspaceDir))
 
-	if err := git.Clone(params.RepoURL, params.Branch, workspaceDir, params.AccessToken, params.CommitHash); err != nil {
-		logger.Error("Failed to clone repository: " + err.Error())
-		if s.db != nil && params.PipelineID > 0 {
-			s.db.UpdatePipelineStatus(params.PipelineID, "failed")
+		_, cloneSpan := tracing.Start(ctx, "git.clone")
+		err := s.cloneRepository(params, workspaceDir)
+		tracing.End(cloneSpan, err)
+		if err != nil {
+			logger.Error("Failed to clone repository: " + err.Error())
+			s.failPipeline(params.PipelineID, "Failed to clone repository: "+err.Error())
+			return
 		}
-		return
 	}
 	defer git.Cleanup(workspaceDir)
 
+	if ctx.Err() != nil {
+		s.markRunInterrupted(ctx, params.PipelineID)
+		return
+	}
+
 	// Find and parse the CI config file
 	configPath := filepath.Join(workspaceDir, params.PipelineFilename)
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
 		logger.Warn(fmt.Sprintf("CI config file not found at %s", configPath))
-		if s.db != nil && params.PipelineID > 0 {
-			s.db.UpdatePipelineStatus(params.PipelineID, "failed")
-		}
+		s.failPipeline(params.PipelineID, fmt.Sprintf("CI config file %s not found in the repository", params.PipelineFilename))
 		return
 	}
 
@@ -52,48 +130,146 @@ func (s *Server) runPipelineLogic(params models.PipelineRunParams) {
 
 	// Parse the CI config
 	p := pipeline.NewParser(configPath)
+	p.RootDir = workspaceDir
+	for _, host := range strings.Split(os.Getenv("INCLUDE_REMOTE_HOSTS"), ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			p.RemoteHosts = append(p.RemoteHosts, host)
+		}
+	}
+	_, parseSpan := tracing.Start(ctx, "config.parse")
 	config, err := p.Parse()
+	tracing.End(parseSpan, err)
 	if err != nil {
 		logger.Error("Failed to parse CI config: " + err.Error())
-		if s.db != nil && params.PipelineID > 0 {
-			s.db.UpdatePipelineStatus(params.PipelineID, "failed")
-		}
+		s.failPipeline(params.PipelineID, "Invalid CI config: "+err.Error())
 		return
 	}
 
 	logger.Info(fmt.Sprintf("Config loaded with %d stages", len(config.Stages)))
 
-	// Pre-create jobs and deployment for visualization
+	// A pipeline with job records was parked on its manual jobs, it resumes from them
 	if s.db != nil && params.PipelineID > 0 {
+		if jobs, err := s.db.GetJobsByPipeline(dbCtx, params.PipelineID); err == nil && len(jobs) > 0 {
+			logger.Info(fmt.Sprintf("Resuming pipeline %d after a manual job was played", params.PipelineID))
+			params.Resume = true
+		}
+	}
+
+	// Drop the jobs excluded by their rules for this push
+	// A resumed pipeline does not know the changed files anymore, the jobs its first run excluded stay skipped from their records
+	ruleCtx := pipeline.RuleContext{Branch: params.Branch, Tag: params.Tag, ChangedFiles: params.ChangedFiles}
+	if params.Tag != "" {
+		ruleCtx.Branch = ""
+	}
+	excludedJobs := config.ApplyRules(ruleCtx)
+	if len(excludedJobs) > 0 && !params.Resume {
+		logger.Info(fmt.Sprintf("%d job(s) excluded by rules", len(excludedJobs)))
+	}
+
+	// Pick the environment to deploy to, CI files declaring none deploy with the project settings
+	deployProject, willDeploy := project, true
+	if name, declared := config.DeployEnvironment(ruleCtx); declared {
+		if name == "" {
+			logger.Info("No environment matches this push, nothing will be deployed")
+			willDeploy = false
+		} else {
+			env, reason := s.deployEnvironment(dbCtx, project, name, params.Branch, params.TriggeredBy)
+			if reason != "" {
+				logger.Error(fmt.Sprintf("Pipeline %d: %s", params.PipelineID, reason))
+				s.failPipeline(params.PipelineID, reason)
+				return
+			}
+			deployProject = environmentProject(project, env)
+			applyEnvironment(&params, env)
+			logger.Info(fmt.Sprintf("Pipeline deploys to environment %s", env.Name))
+		}
+	}
+
+	// On a failed-only retry, resume from the first stage that did not fully succeed for this commit
+	var skippedStages []string
+	if params.SkipSucceededJobs && s.db != nil && params.ProjectID > 0 {
+		succeeded, err := s.db.GetSucceededJobNames(dbCtx, params.ProjectID, params.CommitHash)
+		if err != nil {
+			logger.Error("Failed to get succeeded jobs, running full pipeline: " + err.Error())
+		} else {
+			resumeAt := resumeStageIndex(config, succeeded)
+			skippedStages = config.Stages[:resumeAt]
+			config.Stages = config.Stages[resumeAt:]
+			logger.Info(fmt.Sprintf("Skipping %d already succeeded stage(s)", len(skippedStages)))
+		}
+	}
+
+	// Pre-create jobs and deployment for visualization
+	if s.db != nil && params.PipelineID > 0 && !params.Resume {
+		// Jobs excluded by rules are shown as skipped
+		for jobName, job := range excludedJobs {
+			dbJob, err := s.db.CreateJob(dbCtx, params.PipelineID, jobName, job.Stage, job.Image)
+			if err != nil {
+				logger.Error(fmt.Sprintf("Failed to pre-create job %s: %v", jobName, err))
+				continue
+			}
+			s.db.UpdateJobStatus(dbCtx, dbJob.ID, "skipped", nil)
+		}
+		// Pre-create skipped jobs so the pipeline still shows the full graph
+		for _, stageName := range skippedStages {
+			for jobName, job := range config.Jobs {
+				if job.Stage == stageName {
+					dbJob, err := s.db.CreateJob(dbCtx, params.PipelineID, jobName, job.Stage, job.Image)
+					if err != nil {
+						logger.Error(fmt.Sprintf("Failed to pre-create job %s: %v", jobName, err))
+						continue
+					}
+					s.db.UpdateJobStatus(dbCtx, dbJob.ID, "skipped", nil)
+				}
+			}
+		}
 		// Pre-create jobs
 		for _, stageName := range config.Stages {
 			for jobName, job := range config.Jobs {
 				if job.Stage == stageName {
-					if _, err := s.db.CreateJob(params.PipelineID, jobName, job.Stage, job.Image); err != nil {
+					if _, err := s.db.CreateJob(dbCtx, params.PipelineID, jobName, job.Stage, job.Image); err != nil {
 						logger.Error(fmt.Sprintf("Failed to pre-create job %s: %v", jobName, err))
 					}
 				}
 			}
 		}
 		// Pre-create deployment
-		if _, err := s.db.CreatePendingDeployment(params.PipelineID); err != nil {
-			logger.Error("Failed to pre-create deployment: " + err.Error())
+		if willDeploy {
+			if _, err := s.db.CreatePendingDeployment(dbCtx, params.PipelineID, params.Environment); err != nil {
+				logger.Error("Failed to pre-create deployment: " + err.Error())
+			}
 		}
 	}
 
 	// Execute the pipeline jobs using delegated executor
-	pipelineSuccess := s.pipelineExecutor.Execute(config, workspaceDir, params.PipelineID, project)
+	status := s.pipelineExecutor.Execute(ctx, config, workspaceDir, params, project)
+
+	if ctx.Err() != nil {
+		s.markRunInterrupted(ctx, params.PipelineID)
+		return
+	}
+	// Parked on its manual jobs, the pipeline is queued again when one is played
+	if status == "manual" {
+		if err := os.Rename(workspaceDir, parkedWorkspace(params.PipelineID)); err != nil {
+			logger.Warn(fmt.Sprintf("Failed to keep the workspace of parked pipeline %d: %v", params.PipelineID, err))
+		}
+		return
+	}
+	pipelineSuccess := status == "success"
+
+	failureReason := "One or more jobs failed"
 
 	// Deploy if successful
-	if pipelineSuccess {
+	if pipelineSuccess && willDeploy {
 		logger.Info(fmt.Sprintf("Pipeline successful. Starting deployment using %s...", params.DeploymentFilename))
+		params.PrebuiltServices = prebuiltServices(config, s.succeededJobs(dbCtx, params.PipelineID, config, skippedStages))
 
 		var deploymentID int
 		if s.db != nil && params.PipelineID > 0 {
-			deploy, err := s.db.GetDeploymentByPipeline(params.PipelineID)
+			deploy, err := s.db.GetDeploymentByPipeline(dbCtx, params.PipelineID)
 			if err != nil {
 				// Fallback if not found
-				deploy, err = s.db.CreateDeployment(params.PipelineID)
+				deploy, err = s.db.CreateDeployment(dbCtx, params.PipelineID, params.Environment)
 				if err != nil {
 					logger.Error("Failed to create deployment record: " + err.Error())
 				}
@@ -101,108 +277,598 @@ func (s *Server) runPipelineLogic(params models.PipelineRunParams) {
 
 			if deploy != nil {
 				deploymentID = deploy.ID
-				s.db.UpdateDeploymentStatus(deploymentID, "deploying")
+				s.db.UpdateDeploymentStatus(dbCtx, deploymentID, "deploying")
 			}
 		}
 
 		// Deploy to environment using delegated executor
-		_, err := s.deploymentExecutor.Execute(project, params, workspaceDir)
+		deployCtx, deploySpan := tracing.Start(ctx, "deploy")
+		_, err := s.deploymentExecutor.Execute(deployCtx, deployProject, params, workspaceDir)
+		tracing.End(deploySpan, err)
 
 		if err != nil {
 			logger.Error("Deployment failed: " + err.Error())
 
 			// Attempt Rollback
 			rollbackSuccess := false
-			if s.db != nil && project != nil {
-				lastPipeline, _ := s.db.GetLastSuccessfulPipeline(project.ID)
+			rollbackProject, rollbackParams := deployProject, params
+			var rollout *executor.RolloutError
+			if errors.As(err, &rollout) {
+				// Hosts the rollout did not reach still run the last version
+				rollbackProject, rollbackParams = rolloutTargets(deployProject, params, rollout.Hosts)
+			}
+			if errors.Is(err, executor.ErrCanaryAborted) && (rollout == nil || len(rollout.Hosts) == 0) {
+				// Only the canary replicas ran the new version, and they are already removed
+				rollbackSuccess = true
+			} else if s.db != nil && project != nil && params.ComposeProject == "" {
+				// The last version of a preview environment is another branch's, previews are not rolled back
+				lastPipeline := s.lastDeployedPipeline(dbCtx, project.ID, params.Environment)
 				if lastPipeline != nil && lastPipeline.CommitHash != "" {
-					logger.Info(fmt.Sprintf("Attempting rollback to commit %s", lastPipeline.CommitHash))
-
-					// Prepare rollback params
-					rollbackParams := params
-					rollbackParams.CommitHash = lastPipeline.CommitHash
-					// Note: We use the same config filenames as current project settings.
-
-					// Create unique workspace for rollback
-					rollbackDir := filepath.Join("/tmp", "cicd-workspaces", fmt.Sprintf("%s-rollback-%s-%d", params.RepoName, rollbackParams.CommitHash[:8], time.Now().Unix()))
-
-					logger.Info(fmt.Sprintf("Cloning rollback commit to %s", rollbackDir))
-					if cloneErr := git.Clone(rollbackParams.RepoURL, rollbackParams.Branch, rollbackDir, rollbackParams.AccessToken, rollbackParams.CommitHash); cloneErr == nil {
-						defer git.Cleanup(rollbackDir)
-
-						// Log rollback start
-						s.db.CreateDeploymentLog(params.PipelineID, "=== ROLLBACK STARTED ===")
-
-						// Run deployment for old version using delegated executor
-						_, rbErr := s.deploymentExecutor.Execute(project, rollbackParams, rollbackDir)
-
-						if rbErr == nil {
-							rollbackSuccess = true
-							logger.Info("Rollback successful")
-						} else {
-							logger.Error("Rollback failed: " + rbErr.Error())
-						}
+					if rbErr := s.redeploy(ctx, rollbackProject, rollbackParams, lastPipeline); rbErr == nil {
+						rollbackSuccess = true
+						logger.Info("Rollback successful")
 					} else {
-						logger.Error("Rollback clone failed: " + cloneErr.Error())
+						logger.Error("Rollback failed: " + rbErr.Error())
 					}
 				}
 			}
 
 			pipelineSuccess = false
+			failureReason = "Deployment failed: " + err.Error()
+			if rollbackSuccess {
+				failureReason += " (rolled back to the last successful version)"
+			}
 			if s.db != nil && deploymentID > 0 {
 				if rollbackSuccess {
-					s.db.UpdateDeploymentStatus(deploymentID, "rolled_back")
+					s.db.UpdateDeploymentStatus(dbCtx, deploymentID, "rolled_back")
 				} else {
-					s.db.UpdateDeploymentStatus(deploymentID, "failed")
+					s.db.UpdateDeploymentStatus(dbCtx, deploymentID, "failed")
 				}
 			}
 		} else {
 			logger.Info("Deployment successful!")
 			if s.db != nil && deploymentID > 0 {
-				s.db.UpdateDeploymentStatus(deploymentID, "success")
+				s.db.UpdateDeploymentStatus(dbCtx, deploymentID, "success")
 			}
+			s.recordEnvironmentVersion(dbCtx, deployProject, params, params.PipelineID, workspaceDir)
 		}
 	}
 
 	// Update final pipeline status
 	if s.db != nil && params.PipelineID > 0 {
 		if pipelineSuccess {
-			s.db.UpdatePipelineStatus(params.PipelineID, "success")
-			logger.Info(fmt.Sprintf("Pipeline %d completed successfully", params.PipelineID))
+			s.db.UpdatePipelineStatus(dbCtx, params.PipelineID, "success")
+			logger.Info(fmt.Sprintf("Pipeline %d completed successfully", params.PipelineID), runLogAttrs(params)...)
 		} else {
-			s.db.UpdatePipelineStatus(params.PipelineID, "failed")
-			logger.Error(fmt.Sprintf("Pipeline %d failed", params.PipelineID))
+			s.failPipeline(params.PipelineID, failureReason)
+			logger.Error(fmt.Sprintf("Pipeline %d failed", params.PipelineID), runLogAttrs(params)...)
 
 			// Mark pending deployment as failed if pipeline failed
-			deploy, err := s.db.GetDeploymentByPipeline(params.PipelineID)
+			deploy, err := s.db.GetDeploymentByPipeline(dbCtx, params.PipelineID)
 			if err != nil && deploy != nil {
-				s.db.UpdateDeploymentStatus(deploy.ID, "failed")
+				s.db.UpdateDeploymentStatus(dbCtx, deploy.ID, "failed")
 			}
 		}
 	}
 }
 
+// runRollbackLogic deploys the commit of a previous pipeline as the deployment of params.PipelineID
+// No job runs, the pipeline only records the rollback and its deployment logs.
+func (s *Server) runRollbackLogic(ctx context.Context, params models.PipelineRunParams, target *models.Pipeline) {
+	ctx, span := tracing.Start(tracing.Extract(ctx, params.TraceContext), "pipeline",
+		attribute.Int("cicd.project.id", params.ProjectID),
+		attribute.Int("cicd.pipeline.id", params.PipelineID),
+		attribute.String("cicd.commit", params.CommitHash),
+		attribute.String("cicd.request_id", params.RequestID))
+	defer span.End()
+	dbCtx := context.WithoutCancel(ctx)
+
+	project, err := s.db.GetProject(dbCtx, params.ProjectID)
+	if errors.Is(err, secrets.ErrKeyMismatch) {
+		s.failPipeline(params.PipelineID, keyMismatchReason)
+		return
+	}
+	if err != nil {
+		s.failPipeline(params.PipelineID, "Project not found")
+		return
+	}
+	if project.GitHubInstallationID != 0 {
+		token, err := s.githubApp.RepoToken(ctx, project)
+		if err != nil {
+			logger.Error("Failed to get GitHub App installation token: " + err.Error())
+			s.failPipeline(params.PipelineID, "Failed to get GitHub App installation token: "+err.Error())
+			return
+		}
+		params.AccessToken = token
+	}
+
+	deployProject := project
+	if params.Environment != "" {
+		env, reason := s.deployEnvironment(dbCtx, project, params.Environment, params.Branch, params.TriggeredBy)
+		if reason != "" {
+			s.failPipeline(params.PipelineID, reason)
+			return
+		}
+		deployProject = environmentProject(project, env)
+		applyEnvironment(&params, env)
+	}
+
+	logger.Info(fmt.Sprintf("Pipeline %d rolls back to pipeline %d", params.PipelineID, target.ID), runLogAttrs(params)...)
+
+	var deploymentID int
+	if deploy, err := s.db.GetDeploymentByPipeline(dbCtx, params.PipelineID); err == nil && deploy != nil {
+		deploymentID = deploy.ID
+		s.db.UpdateDeploymentStatus(dbCtx, deploymentID, "deploying")
+	}
+
+	if err := s.redeploy(ctx, deployProject, params, target); err != nil {
+		logger.Error("Rollback failed: " + err.Error())
+		if deploymentID > 0 {
+			s.db.UpdateDeploymentStatus(dbCtx, deploymentID, "failed")
+		}
+		s.failPipeline(params.PipelineID, "Rollback failed: "+err.Error())
+		return
+	}
+
+	logger.Info("Rollback successful")
+	if deploymentID > 0 {
+		s.db.UpdateDeploymentStatus(dbCtx, deploymentID, "success")
+	}
+	s.db.UpdatePipelineStatus(dbCtx, params.PipelineID, "success")
+}
+
+// lastDeployedPipeline returns the pipeline to roll back to, nil when there is none
+// An environment is rolled back to the last version deployed to it, not to another environment's.
+func (s *Server) lastDeployedPipeline(ctx context.Context, projectID int, environment string) *models.Pipeline {
+	var p *models.Pipeline
+	var err error
+	if environment != "" {
+		p, err = s.db.GetLastDeployedPipeline(ctx, projectID, environment)
+	} else {
+		p, err = s.db.GetLastSuccessfulPipeline(ctx, projectID)
+	}
+	if err != nil {
+		logger.Error("Failed to get the pipeline to roll back to: " + err.Error())
+	}
+	return p
+}
+
+// redeploy deploys the commit of a previous pipeline again, from a fresh clone
+// Its logs are those of the deployment of params.PipelineID.
+func (s *Server) redeploy(ctx context.Context, deployProject *models.Project, params models.PipelineRunParams, target *models.Pipeline) error {
+	logger.Info(fmt.Sprintf("Attempting rollback to commit %s", target.CommitHash))
+
+	// Prepare rollback params
+	rollbackParams := params
+	rollbackParams.CommitHash = target.CommitHash
+	if target.Branch != "" {
+		rollbackParams.Branch = target.Branch
+	}
+	// Restoring a version replaces every replica at once
+	rollbackParams.DeploymentStrategy = models.StrategyRecreate
+	// Note: We use the same config filenames as current project settings.
+
+	// Create unique workspace for rollback
+	rollbackDir := filepath.Join(workspaceRoot, fmt.Sprintf("%s-rollback-%s-%d", params.RepoName, rollbackParams.CommitHash[:8], time.Now().Unix()))
+
+	logger.Info(fmt.Sprintf("Cloning rollback commit to %s", rollbackDir))
+	if err := s.cloneRepository(rollbackParams, rollbackDir); err != nil {
+		return fmt.Errorf("rollback clone failed: %w", err)
+	}
+	defer git.Cleanup(rollbackDir)
+
+	// Log rollback start
+	if s.db != nil {
+		if line, err := s.db.CreateDeploymentLog(context.WithoutCancel(ctx), params.PipelineID, "=== ROLLBACK STARTED ==="); err == nil {
+			s.deploymentExecutor.LogFeed().Publish(*line)
+		}
+	}
+
+	// Run deployment for old version using delegated executor
+	// The rollback is not cancellable, an interrupted deployment must still be restored
+	rollbackCtx, rollbackSpan := tracing.Start(context.WithoutCancel(ctx), "rollback",
+		attribute.String("cicd.commit", rollbackParams.CommitHash))
+	_, err := s.deploymentExecutor.Execute(rollbackCtx, deployProject, rollbackParams, rollbackDir)
+	tracing.End(rollbackSpan, err)
+	if err == nil {
+		s.recordEnvironmentVersion(context.WithoutCancel(ctx), deployProject, rollbackParams, target.ID, rollbackDir)
+	}
+	return err
+}
+
+// recordEnvironmentVersion records the commit and images deployed to the environment of a run
+// Deployments with the project settings are not tracked, they have no environment. Preview environments track each branch instead.
+func (s *Server) recordEnvironmentVersion(ctx context.Context, deployProject *models.Project, params models.PipelineRunParams, pipelineID int, workspaceDir string) {
+	if s.db == nil || params.Environment == "" || deployProject == nil {
+		return
+	}
+	if params.ComposeProject != "" {
+		s.recordPreview(ctx, params, pipelineID)
+		return
+	}
+	v := &models.EnvironmentVersion{
+		Environment: params.Environment,
+		PipelineID:  pipelineID,
+		CommitHash:  params.CommitHash,
+		Branch:      params.Branch,
+	}
+	// Same condition as the deployment executor, only the Registry/SSH flow pushes tagged images
+	if deployProject.RegistryUser != "" && deployProject.SSHHost != "" {
+		services, err := compose.ParseServices(filepath.Join(workspaceDir, params.DeploymentFilename))
+		if err != nil {
+			logger.Error("Failed to list deployed images: " + err.Error())
+		}
+		for _, service := range services {
+			v.Images = append(v.Images, compose.ImageName(compose.ImageNamespace(deployProject.RegistryURL, deployProject.RegistryUser), params.RepoName, service, params.CommitHash))
+		}
+	}
+	if err := s.db.SetEnvironmentVersion(ctx, deployProject.ID, v); err != nil {
+		logger.Error(fmt.Sprintf("Failed to record the version of environment %s: %v", params.Environment, err))
+	}
+}
+
+// deployEnvironment returns the environment of the project a pipeline deploys to
+// The reason the pipeline must fail is returned instead when the environment is unknown or protected from the user who triggered it,
+// or from the branch of a push.
+func (s *Server) deployEnvironment(ctx context.Context, project *models.Project, name, branch string, triggeredBy int) (*models.Environment, string) {
+	if s.db == nil || project == nil {
+		return nil, fmt.Sprintf("Environment %s cannot be resolved without a database", name)
+	}
+	env, err := s.db.GetEnvironment(ctx, project.ID, name)
+	if errors.Is(err, secrets.ErrKeyMismatch) {
+		return nil, keyMismatchReason
+	}
+	if err != nil {
+		return nil, fmt.Sprintf("Environment %s is not defined in the project settings", name)
+	}
+
+	if !env.Protected {
+		return env, ""
+	}
+	// Anyone able to push a branch could otherwise deploy it, pushes only deploy the protected branches
+	if triggeredBy == 0 {
+		if len(env.ProtectedBranches) == 0 || !matchesBranchFilters(env.ProtectedBranches, branch) {
+			return nil, fmt.Sprintf("Environment %s is protected, branch %s is not one of its protected_branches", name, branch)
+		}
+		return env, ""
+	}
+	role, err := s.projectRole(ctx, project, triggeredBy)
+	if err != nil || !roleAllows(role, ActionManage) {
+		return nil, fmt.Sprintf("Environment %s is protected, only maintainers can run pipelines deploying to it", name)
+	}
+	return env, ""
+}
+
+// applyEnvironment sets the deployment settings of an environment on the run parameters
+func applyEnvironment(params *models.PipelineRunParams, env *models.Environment) {
+	params.Environment = env.Name
+	params.DeploymentFilename = env.DeploymentFilename
+	params.DeploymentStrategy = env.DeploymentStrategy
+	params.CanaryReplicas = env.CanaryReplicas
+	params.CanaryBakeSeconds = env.CanaryBakeSeconds
+	params.SSHHosts = env.SSHHosts
+	params.RolloutBatchSize = env.RolloutBatchSize
+	params.PreDeploy = env.PreDeploy
+	params.PostDeploy = env.PostDeploy
+	params.Proxy = env.Proxy
+	params.ProxyDomain = env.ProxyDomain
+	params.ProxyService = env.ProxyService
+	params.ProxyPort = env.ProxyPort
+	if env.Preview {
+		// Each branch runs as its own compose project, next to the others
+		params.ComposeProject = sanitizeProjectName(params.RepoName + "-" + previewBranch(*params))
+	}
+}
+
+// environmentProject returns a copy of the project whose SSH settings are the environment's
+// An environment without SSH key uses the key of the project.
+func environmentProject(project *models.Project, env *models.Environment) *models.Project {
+	target := *project
+	target.SSHHost = env.SSHHost
+	target.SSHUser = env.SSHUser
+	if env.SSHPrivateKey != "" {
+		target.SSHPrivateKey = env.SSHPrivateKey
+	}
+	return &target
+}
+
+// rolloutTargets restricts a deployment to the hosts of a failed rollout
+func rolloutTargets(project *models.Project, params models.PipelineRunParams, hosts []string) (*models.Project, models.PipelineRunParams) {
+	if len(hosts) == 0 {
+		return project, params
+	}
+	target := *project
+	target.SSHHost = hosts[0]
+	params.SSHHosts = hosts[1:]
+	return &target, params
+}
+
+// runLogAttrs returns the log attributes correlating a run with the request that triggered it
+func runLogAttrs(params models.PipelineRunParams) []any {
+	attrs := []any{"pipeline_id", params.PipelineID}
+	if params.RequestID != "" {
+		attrs = append(attrs, "request_id", params.RequestID)
+	}
+	return attrs
+}
+
+// keyMismatchReason is the failure reason of pipelines whose project secrets cannot be decrypted
+const keyMismatchReason = "Encryption key mismatch: the project secrets cannot be decrypted, check ENCRYPTION_KEY or the secrets backend"
+
+// failPipeline marks a pipeline as failed with the reason shown to users
+func (s *Server) failPipeline(pipelineID int, reason string) {
+	if s.db == nil || pipelineID <= 0 {
+		return
+	}
+	if err := s.db.FailPipeline(context.Background(), pipelineID, reason); err != nil {
+		logger.Error(fmt.Sprintf("Failed to record failure of pipeline %d: %v", pipelineID, err))
+	}
+}
+
+// prebuiltServices returns the compose services whose image was built and pushed by a succeeded build job of the run
+func prebuiltServices(config *pipeline.PipelineConfig, succeeded map[string]bool) []string {
+	var services []string
+	for jobName, job := range config.Jobs {
+		if succeeded[jobName] && job.Type == executor.JobTypeBuild && job.Properties["service"] != "" && job.Properties["destination"] == "" {
+			services = append(services, job.Properties["service"])
+		}
+	}
+	return services
+}
+
+// succeededJobs returns the jobs of the run that succeeded, from the records of the pipeline
+// Build jobs left manual, allowed to fail or skipped pushed nothing, but the stages skipped by a failed-only retry
+// succeeded in a previous pipeline of the commit.
+func (s *Server) succeededJobs(ctx context.Context, pipelineID int, config *pipeline.PipelineConfig, skippedStages []string) map[string]bool {
+	succeeded := make(map[string]bool)
+	if s.db != nil && pipelineID > 0 {
+		jobs, err := s.db.GetJobsByPipeline(ctx, pipelineID)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to get jobs of pipeline %d, building every image on deployment: %v", pipelineID, err))
+		}
+		for _, job := range jobs {
+			if job.Status == "success" {
+				succeeded[job.Name] = true
+			}
+		}
+	}
+	for jobName, job := range config.Jobs {
+		if slices.Contains(skippedStages, job.Stage) {
+			succeeded[jobName] = true
+		}
+	}
+	return succeeded
+}
+
+// resumeStageIndex returns the index of the first stage containing a job that has not succeeded yet
+func resumeStageIndex(config *pipeline.PipelineConfig, succeeded map[string]bool) int {
+	for i, stageName := range config.Stages {
+		for jobName, job := range config.Jobs {
+			if job.Stage == stageName && !succeeded[jobName] {
+				return i
+			}
+		}
+	}
+	return len(config.Stages)
+}
+
+// === Cancellation ===
+
+// trackedRun is the cancel function of a pipeline queued or executing on this server
+type trackedRun struct {
+	cancel context.CancelCauseFunc
+}
+
+// trackRun registers a cancellable context for a pipeline, from the moment it is queued
+// A cancellation requested while a worker picks the pipeline up reaches the run, which checks its context first.
+// The returned function must be called once the run is over, or when it never starts
+func (s *Server) trackRun(pipelineID int) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(s.ctx)
+	if pipelineID <= 0 {
+		return ctx, func() { cancel(nil) }
+	}
+
+	run := &trackedRun{cancel: cancel}
+	s.runsMu.Lock()
+	s.runs[pipelineID] = run
+	s.runsMu.Unlock()
+
+	return ctx, func() {
+		s.runsMu.Lock()
+		// A resumed run of the same pipeline may already be registered
+		if s.runs[pipelineID] == run {
+			delete(s.runs, pipelineID)
+		}
+		s.runsMu.Unlock()
+		cancel(nil)
+	}
+}
+
+// untrackRun drops the registration of a pipeline removed from the queue before it started
+func (s *Server) untrackRun(pipelineID int) {
+	s.runsMu.Lock()
+	run, ok := s.runs[pipelineID]
+	delete(s.runs, pipelineID)
+	s.runsMu.Unlock()
+
+	if ok {
+		run.cancel(nil)
+	}
+}
+
+// cancelRun cancels a queued or running pipeline, returning false if it is not tracked by this server
+func (s *Server) cancelRun(pipelineID int) bool {
+	return s.cancelRunCause(pipelineID, nil)
+}
+
+// cancelRunCause cancels a running pipeline for the given cause, returned by context.Cause in the run
+func (s *Server) cancelRunCause(pipelineID int, cause error) bool {
+	s.runsMu.Lock()
+	run, ok := s.runs[pipelineID]
+	s.runsMu.Unlock()
+
+	if ok {
+		run.cancel(cause)
+	}
+	return ok
+}
+
+// requestCancel cancels a queued or running pipeline
+// The runner records the cancellation once its containers are stopped.
+// Queued pipelines and pipelines not tracked by this server (e.g. left over after a restart) are cancelled directly.
+func (s *Server) requestCancel(pipelineID int) {
+	if s.queue.Remove(pipelineID) {
+		s.untrackRun(pipelineID)
+		s.markPipelineCancelled(pipelineID)
+		return
+	}
+	if !s.cancelRun(pipelineID) {
+		s.markPipelineCancelled(pipelineID)
+	}
+}
+
+// cancelRedundantPipelines cancels the unfinished pipelines of a branch older than the given pipeline
+func (s *Server) cancelRedundantPipelines(ctx context.Context, projectID int, branch string, pipelineID int) {
+	pipelines, err := s.db.GetActivePipelinesByBranch(ctx, projectID, branch)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to list active pipelines of branch %s: %v", branch, err))
+		return
+	}
+
+	for _, p := range pipelines {
+		if p.ID >= pipelineID {
+			continue
+		}
+		logger.Info(fmt.Sprintf("Pipeline %d superseded by pipeline %d on branch %s", p.ID, pipelineID, branch))
+		s.requestCancel(p.ID)
+	}
+}
+
+// markRunInterrupted records the end of a run whose context was cancelled, failing it when the watchdog stopped it
+func (s *Server) markRunInterrupted(ctx context.Context, pipelineID int) {
+	var timeout *pipelineTimeoutError
+	if errors.As(context.Cause(ctx), &timeout) {
+		s.markPipelineTimedOut(pipelineID, timeout)
+		return
+	}
+	s.markPipelineCancelled(pipelineID)
+}
+
+// markPipelineCancelled records the cancellation of a pipeline and of its unfinished jobs and deployment
+func (s *Server) markPipelineCancelled(pipelineID int) {
+	logger.Info(fmt.Sprintf("Pipeline %d cancelled", pipelineID))
+	if s.db == nil || pipelineID <= 0 {
+		return
+	}
+	// Not the context of the run, which is cancelled by now
+	ctx := context.Background()
+
+	if err := s.db.CancelUnfinishedJobs(ctx, pipelineID); err != nil {
+		logger.Error(fmt.Sprintf("Failed to cancel jobs of pipeline %d: %v", pipelineID, err))
+	}
+	if deploy, err := s.db.GetDeploymentByPipeline(ctx, pipelineID); err == nil && deploy != nil && deploy.Status == "pending" {
+		s.db.UpdateDeploymentStatus(ctx, deploy.ID, "cancelled")
+	}
+	s.db.UpdatePipelineStatus(ctx, pipelineID, "cancelled")
+	git.Cleanup(parkedWorkspace(pipelineID))
+}
+
+// parkedWorkspace is where the workspace of a pipeline parked on its manual jobs is kept until a play resumes it
+func parkedWorkspace(pipelineID int) string {
+	return filepath.Join(workspaceRoot, fmt.Sprintf("parked-%d", pipelineID))
+}
+
 // === Higher level Wrappers ===
 
-// runPipelineFromWebhook adapts webhook data to the unified runner
-func (s *Server) runPipelineFromWebhook(pushEvent models.PushEvent, branch, commitHash string) {
+// enqueuePipeline schedules a pipeline run on the worker pool
+// The pipeline stays "queued" until a worker picks it up, or is marked failed if the queue is full
+func (s *Server) enqueuePipeline(params models.PipelineRunParams) error {
+	return s.enqueueRun(params, s.runPipelineLogic)
+}
+
+// enqueueRun schedules a run of the given pipeline on the worker pool
+func (s *Server) enqueueRun(params models.PipelineRunParams, run func(context.Context, models.PipelineRunParams)) error {
+	// The run outlives the request that queued it
+	ctx := context.Background()
+	if s.db != nil && params.PipelineID > 0 {
+		s.db.UpdatePipelineStatus(ctx, params.PipelineID, "queued")
+	}
+
+	// Registered before queueing, so the pipeline can be cancelled at any point until the run is over
+	runCtx, done := s.trackRun(params.PipelineID)
+	err := s.queue.Enqueue(queue.Task{
+		PipelineID:   params.PipelineID,
+		ProjectID:    params.ProjectID,
+		ProjectLimit: params.MaxConcurrentPipelines,
+		Run: func() {
+			s.runsWG.Add(1)
+			defer s.runsWG.Done()
+			defer done()
+
+			// Cancelled while a worker was picking it up
+			if runCtx.Err() != nil {
+				s.markRunInterrupted(runCtx, params.PipelineID)
+				return
+			}
+			if s.db != nil && params.PipelineID > 0 {
+				// Or cancelled by another instance, which does not track it
+				if p, err := s.db.GetPipeline(ctx, params.PipelineID); err == nil && p.Status == "cancelled" {
+					return
+				}
+				s.db.UpdatePipelineStatus(ctx, params.PipelineID, "running")
+			}
+			run(runCtx, params)
+		},
+	})
+	if err != nil {
+		done()
+		logger.Error(fmt.Sprintf("Failed to enqueue pipeline %d: %v", params.PipelineID, err), runLogAttrs(params)...)
+		s.failPipeline(params.PipelineID, "Could not be queued: "+err.Error())
+		return err
+	}
+
+	logger.Info(fmt.Sprintf("Pipeline %d queued", params.PipelineID), runLogAttrs(params)...)
+	return nil
+}
+
+// queuePipelineFromWebhook adapts webhook data to the unified runner
+// Pushes ignored by the project configuration are not an error. What became of the push is recorded on its delivery.
+func (s *Server) queuePipelineFromWebhook(ctx context.Context, pushEvent models.PushEvent, branch, commitHash string, delivery *models.WebhookDelivery) error {
 	// Find or create project in database
 	var projectID int
-	var accessToken string
+	var accessToken, deployKey string
 	var pipelineFilename string
 	var deploymentFilename string
+	var maxConcurrentPipelines int
+	var autoCancelRedundant bool
 
 	if s.db != nil {
-		project, err := s.db.FindProjectByUrl(pushEvent.Repository.CloneURL)
+		project, err := s.db.FindProjectByUrl(ctx, pushEvent.Repository.CloneURL)
+		if errors.Is(err, secrets.ErrKeyMismatch) {
+			logger.Error(fmt.Sprintf("Cannot build push to %s: %v", pushEvent.Repository.CloneURL, err))
+			delivery.Status, delivery.Reason = "failed", keyMismatchReason
+			return err
+		}
 		if err != nil {
 			logger.Error(fmt.Sprintf("Project not found for repo %s: %v. Ignoring webhook.", pushEvent.Repository.CloneURL, err))
-			return
+			delivery.Status, delivery.Reason = "ignored", "No project uses repository "+pushEvent.Repository.CloneURL
+			return nil
+		}
+		delivery.ProjectID = &project.ID
+
+		if !matchesBranchFilters(project.BranchFilters, branch) {
+			logger.Info(fmt.Sprintf("Branch %s does not match branch filters of project %s. Ignoring webhook.", branch, project.Name))
+			delivery.Status, delivery.Reason = "ignored", fmt.Sprintf("Branch %s does not match the branch filters %s", branch, strings.Join(project.BranchFilters, ", "))
+			return nil
 		}
 
 		projectID = project.ID
 		accessToken = project.AccessToken
+		deployKey = project.DeployKey
 		pipelineFilename = project.PipelineFilename
 		deploymentFilename = project.DeploymentFilename
+		maxConcurrentPipelines = project.MaxConcurrentPipelines
+		autoCancelRedundant = project.AutoCancelRedundant
 	}
 
 	if pipelineFilename == "" {
@@ -212,41 +878,146 @@ func (s *Server) runPipelineFromWebhook(pushEvent models.PushEvent, branch, comm
 		deploymentFilename = "docker-compose.yml"
 	}
 
+	// Commits asking not to be built still get a pipeline, so they show a status in the UI
+	if hasSkipCI(pushEvent.HeadCommit.Message) {
+		logger.Info(fmt.Sprintf("Commit %s asks to skip CI", commitHash))
+		delivery.Status, delivery.Reason = "skipped", "The commit message asks to skip CI"
+		if s.db != nil && projectID > 0 {
+			pipeline, err := s.db.CreatePipeline(ctx, projectID, branch, commitHash)
+			if err != nil {
+				logger.Error(fmt.Sprintf("Failed to create pipeline record: %v", err))
+			} else {
+				s.db.UpdatePipelineStatus(ctx, pipeline.ID, "skipped")
+				delivery.PipelineID = &pipeline.ID
+			}
+		}
+		return nil
+	}
+
 	// Create pipeline record
 	var pipelineID int
 	if s.db != nil && projectID > 0 {
-		pipeline, err := s.db.CreatePipeline(projectID, branch, commitHash)
+		pipeline, err := s.db.CreatePipeline(ctx, projectID, branch, commitHash)
 		if err != nil {
 			logger.Error(fmt.Sprintf("Failed to create pipeline record: %v", err))
 		} else {
 			pipelineID = pipeline.ID
 			logger.Info(fmt.Sprintf("Pipeline created with ID: %d", pipelineID))
-			s.db.UpdatePipelineStatus(pipelineID, "running")
 		}
 	}
 
+	// A newer commit makes the pipelines still building older commits of the branch useless
+	if autoCancelRedundant && pipelineID > 0 {
+		s.cancelRedundantPipelines(ctx, projectID, branch, pipelineID)
+	}
+
 	params := models.PipelineRunParams{
-		RepoURL:            pushEvent.Repository.CloneURL,
-		RepoName:           pushEvent.Repository.Name,
-		Branch:             branch,
-		CommitHash:         commitHash,
-		AccessToken:        accessToken,
-		PipelineFilename:   pipelineFilename,
-		DeploymentFilename: deploymentFilename,
-		ProjectID:          projectID,
-		PipelineID:         pipelineID,
+		RepoURL:                pushEvent.Repository.CloneURL,
+		RepoName:               pushEvent.Repository.Name,
+		Branch:                 branch,
+		CommitHash:             commitHash,
+		AccessToken:            accessToken,
+		DeployKey:              deployKey,
+		PipelineFilename:       pipelineFilename,
+		DeploymentFilename:     deploymentFilename,
+		ProjectID:              projectID,
+		PipelineID:             pipelineID,
+		MaxConcurrentPipelines: maxConcurrentPipelines,
+		ChangedFiles:           changedFiles(pushEvent),
+		DefaultBranch:          pushEvent.Repository.DefaultBranch,
+		TraceContext:           tracing.Inject(ctx),
+		RequestID:              requestIDFromContext(ctx),
+	}
+	if strings.HasPrefix(pushEvent.Ref, "refs/tags/") {
+		params.Tag = strings.TrimPrefix(pushEvent.Ref, "refs/tags/")
+	}
+
+	if pipelineID > 0 {
+		delivery.PipelineID = &pipelineID
+		// Resumed and retried runs get them back from the pipeline record
+		if err := s.db.SetPipelineTrigger(ctx, pipelineID, params.Tag, params.DefaultBranch, params.ChangedFiles); err != nil {
+			logger.Error(fmt.Sprintf("Failed to record the push of pipeline %d: %v", pipelineID, err))
+		}
+	}
+	if err := s.enqueuePipeline(params); err != nil {
+		delivery.Status, delivery.Reason = "failed", "Could not be queued: "+err.Error()
+		return err
+	}
+	delivery.Status = "triggered"
+	return nil
+}
+
+// hasSkipCI reports whether a commit message contains [skip ci] or [ci skip]
+func hasSkipCI(message string) bool {
+	message = strings.ToLower(message)
+	return strings.Contains(message, "[skip ci]") || strings.Contains(message, "[ci skip]")
+}
+
+// changedFiles returns the files added, modified or removed by the commits of a push, nil if it carries no commits
+func changedFiles(pushEvent models.PushEvent) []string {
+	if len(pushEvent.Commits) == 0 {
+		return nil
+	}
+	seen := make(map[string]bool)
+	files := []string{}
+	for _, commit := range pushEvent.Commits {
+		for _, list := range [][]string{commit.Added, commit.Modified, commit.Removed} {
+			for _, file := range list {
+				if !seen[file] {
+					seen[file] = true
+					files = append(files, file)
+				}
+			}
+		}
 	}
+	return files
+}
 
-	s.runPipelineLogic(params)
+// matchesBranchFilters reports whether a branch is allowed by the project's glob patterns
+// An empty filter list allows every branch
+func matchesBranchFilters(filters []string, branch string) bool {
+	if len(filters) == 0 {
+		return true
+	}
+	for _, pattern := range filters {
+		if matched, err := path.Match(pattern, branch); err == nil && matched {
+			return true
+		}
+	}
+	return false
 }
 
-// runPipelineFromManualTrigger adapts manual trigger data to the unified runner
-func (s *Server) runPipelineFromManualTrigger(project *models.Project, pipeline *models.Pipeline, branch string) {
+// queuePipelineFromManualTrigger adapts manual trigger data to the unified runner
+func (s *Server) queuePipelineFromManualTrigger(ctx context.Context, project *models.Project, pipeline *models.Pipeline, branch string) error {
 	logger.Info(fmt.Sprintf("Starting manual pipeline %d for project %s", pipeline.ID, project.Name))
 
-	// Update status to running
-	s.db.UpdatePipelineStatus(pipeline.ID, "running")
+	params := manualRunParams(project, pipeline, branch)
+	params.TriggeredBy, _ = ctx.Value("userID").(int)
+	params.TraceContext = tracing.Inject(ctx)
+	params.RequestID = requestIDFromContext(ctx)
 
+	return s.enqueuePipeline(params)
+}
+
+// queuePipelineFromRetry adapts a retried pipeline to the unified runner
+// When failedOnly is set, stages whose jobs all succeeded for the same commit are skipped. The pipeline carries the push
+// of the retried one, see manualRunParams.
+func (s *Server) queuePipelineFromRetry(ctx context.Context, project *models.Project, pipeline *models.Pipeline, failedOnly bool) error {
+	logger.Info(fmt.Sprintf("Starting retried pipeline %d for project %s", pipeline.ID, project.Name))
+
+	params := manualRunParams(project, pipeline, pipeline.Branch)
+	params.SkipSucceededJobs = failedOnly
+	params.TriggeredBy, _ = ctx.Value("userID").(int)
+	params.TraceContext = tracing.Inject(ctx)
+	params.RequestID = requestIDFromContext(ctx)
+
+	return s.enqueuePipeline(params)
+}
+
+// manualRunParams builds the run parameters of a pipeline started through the API
+// The tag, default branch and changed files recorded with the pipeline are restored, so that a resumed or retried
+// push runs with the same rules, variables and image tags as the original run.
+func manualRunParams(project *models.Project, pipeline *models.Pipeline, branch string) models.PipelineRunParams {
 	pipelineFilename := project.PipelineFilename
 	if pipelineFilename == "" {
 		pipelineFilename = ".gitlab-ci.yml"
@@ -256,17 +1027,20 @@ func (s *Server) runPipelineFromManualTrigger(project *models.Project, pipeline
 		deploymentFilename = "docker-compose.yml"
 	}
 
-	params := models.PipelineRunParams{
-		RepoURL:            project.RepoURL,
-		RepoName:           project.Name,
-		Branch:             branch,
-		CommitHash:         pipeline.CommitHash,
-		AccessToken:        project.AccessToken,
-		PipelineFilename:   pipelineFilename,
-		DeploymentFilename: deploymentFilename,
-		ProjectID:          project.ID,
-		PipelineID:         pipeline.ID,
-	}
-
-	s.runPipelineLogic(params)
+	return models.PipelineRunParams{
+		RepoURL:                project.RepoURL,
+		RepoName:               project.Name,
+		Branch:                 branch,
+		CommitHash:             pipeline.CommitHash,
+		AccessToken:            project.AccessToken,
+		DeployKey:              project.DeployKey,
+		PipelineFilename:       pipelineFilename,
+		DeploymentFilename:     deploymentFilename,
+		ProjectID:              project.ID,
+		PipelineID:             pipeline.ID,
+		MaxConcurrentPipelines: project.MaxConcurrentPipelines,
+		Tag:                    pipeline.Tag,
+		DefaultBranch:          pipeline.DefaultBranch,
+		ChangedFiles:           pipeline.ChangedFiles,
+	}
 }
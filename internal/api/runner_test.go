@@ -0,0 +1,98 @@
+package api
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/executor"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/parser/pipeline"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/queue"
+)
+
+func TestPrebuiltServices(t *testing.T) {
+	ctx := context.Background()
+	s, st := newTestServer()
+	ownerID := createTestUser(t, st, "owner@example.com")
+	project, _ := st.CreateProject(ctx, &models.NewProject{OwnerID: ownerID, Name: "app", RepoURL: "https://example.com/app.git"})
+	p, _ := st.CreatePipeline(ctx, project.ID, "main", "abc123")
+
+	build := func(stage, service string) pipeline.JobConfig {
+		return pipeline.JobConfig{Stage: stage, Type: executor.JobTypeBuild, Properties: map[string]string{"service": service}}
+	}
+	config := &pipeline.PipelineConfig{
+		Stages: []string{"build", "deploy"},
+		Jobs: map[string]pipeline.JobConfig{
+			"build-api":    build("build", "api"),
+			"build-web":    build("build", "web"),
+			"build-worker": build("build", "worker"),
+			"build-docs":   build("docs", "docs"),
+		},
+	}
+	for name, status := range map[string]string{"build-api": "success", "build-web": "failed", "build-worker": "manual"} {
+		job, _ := st.CreateJob(ctx, p.ID, name, "build", "")
+		st.UpdateJobStatus(ctx, job.ID, status, nil)
+	}
+
+	services := prebuiltServices(config, s.succeededJobs(ctx, p.ID, config, nil))
+	if !slices.Equal(services, []string{"api"}) {
+		t.Errorf("Expected only the service of the succeeded build job, got %v", services)
+	}
+
+	// The stages skipped by a failed-only retry were built by a previous pipeline of the commit
+	services = prebuiltServices(config, s.succeededJobs(ctx, p.ID, config, []string{"docs"}))
+	slices.Sort(services)
+	if !slices.Equal(services, []string{"api", "docs"}) {
+		t.Errorf("Expected the services of the skipped stages too, got %v", services)
+	}
+}
+
+func TestCancelQueuedRun(t *testing.T) {
+	ctx := context.Background()
+	s, st := newTestServer()
+	s.queue = queue.New(1, 10)
+	ownerID := createTestUser(t, st, "owner@example.com")
+	project, _ := st.CreateProject(ctx, &models.NewProject{OwnerID: ownerID, Name: "app", RepoURL: "https://example.com/app.git"})
+
+	ran := make(chan int, 2)
+	run := func(ctx context.Context, params models.PipelineRunParams) { ran <- params.PipelineID }
+
+	t.Run("RemovedFromQueue", func(t *testing.T) {
+		p, _ := st.CreatePipeline(ctx, project.ID, "main", "abc123")
+		s.enqueueRun(models.PipelineRunParams{PipelineID: p.ID, ProjectID: project.ID}, run)
+		s.requestCancel(p.ID)
+
+		if got, _ := st.GetPipeline(ctx, p.ID); got.Status != "cancelled" {
+			t.Errorf("Expected the pipeline to be cancelled, got %s", got.Status)
+		}
+		if s.cancelRun(p.ID) {
+			t.Errorf("Expected the run to be untracked once removed from the queue")
+		}
+	})
+
+	t.Run("PickedUpByWorker", func(t *testing.T) {
+		p, _ := st.CreatePipeline(ctx, project.ID, "main", "abc123")
+		s.enqueueRun(models.PipelineRunParams{PipelineID: p.ID, ProjectID: project.ID}, run)
+		// What requestCancel does once a worker has taken the pipeline off the queue, before the run starts
+		if !s.cancelRun(p.ID) {
+			t.Fatalf("Expected the queued pipeline to be tracked")
+		}
+		s.queue.Start()
+
+		for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+			if got, _ := st.GetPipeline(ctx, p.ID); got.Status == "cancelled" {
+				break
+			}
+		}
+		if got, _ := st.GetPipeline(ctx, p.ID); got.Status != "cancelled" {
+			t.Errorf("Expected the pipeline to be cancelled, got %s", got.Status)
+		}
+		select {
+		case id := <-ran:
+			t.Errorf("Expected cancelled pipeline %d not to run", id)
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+}
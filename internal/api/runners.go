@@ -0,0 +1,263 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/executor"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+)
+
+// hashRunnerToken returns the hash stored in place of a runner token
+func hashRunnerToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// RunnerAuthMiddleware authenticates runner agents with the token received at registration
+func (s *Server) RunnerAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.db == nil {
+			respondError(w, http.StatusServiceUnavailable, "Database not available")
+			return
+		}
+
+		token := r.Header.Get("X-Runner-Token")
+		if token == "" {
+			respondError(w, http.StatusUnauthorized, "Runner token required")
+			return
+		}
+		runner, err := s.db.GetRunnerByToken(r.Context(), hashRunnerToken(token))
+		if err != nil {
+			respondError(w, http.StatusUnauthorized, "Invalid runner token")
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), "runnerID", runner.ID)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// handleRunnerRegister registers a runner agent presenting the instance registration token
+func (s *Server) handleRunnerRegister(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if s.db == nil {
+		respondError(w, http.StatusServiceUnavailable, "Database not available")
+		return
+	}
+
+	var req struct {
+		RegistrationToken string `json:"registration_token"`
+		Name              string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	expected := os.Getenv("RUNNER_REGISTRATION_TOKEN")
+	if expected == "" || subtle.ConstantTimeCompare([]byte(req.RegistrationToken), []byte(expected)) != 1 {
+		respondError(w, http.StatusUnauthorized, "Invalid registration token")
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		respondError(w, http.StatusBadRequest, "Runner name is required")
+		return
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to generate runner token")
+		return
+	}
+	token := hex.EncodeToString(secret)
+
+	runner, err := s.db.CreateRunner(r.Context(), req.Name, hashRunnerToken(token))
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	logger.Info(fmt.Sprintf("Runner %d (%s) registered", runner.ID, runner.Name))
+
+	// The token is only ever returned here
+	respondJSON(w, http.StatusCreated, map[string]interface{}{
+		"id":    runner.ID,
+		"name":  runner.Name,
+		"token": token,
+	})
+}
+
+// handleRunners lists the registered runners
+func (s *Server) handleRunners(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if s.db == nil {
+		respondError(w, http.StatusServiceUnavailable, "Database not available")
+		return
+	}
+	// Runners execute the jobs of every project, only administrators see and remove them
+	if !s.authorizeInstanceAdmin(w, r) {
+		return
+	}
+
+	runners, err := s.db.GetRunners(r.Context())
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if runners == nil {
+		runners = []models.Runner{}
+	}
+	respondJSON(w, http.StatusOK, runners)
+}
+
+// handleRunner unregisters a runner, DELETE /api/v1/runners/{id}
+func (s *Server) handleRunner(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if s.db == nil {
+		respondError(w, http.StatusServiceUnavailable, "Database not available")
+		return
+	}
+	if !s.authorizeInstanceAdmin(w, r) {
+		return
+	}
+
+	runnerID, err := parseIDFromPath(r.URL.Path, 3)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid runner ID")
+		return
+	}
+
+	if err := s.db.DeleteRunner(r.Context(), runnerID); err != nil {
+		if err.Error() == "runner not found" {
+			respondError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// routeRunnerSubpath routes the runner agent requests under /api/v1/runner/
+func (s *Server) routeRunnerSubpath(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/api/v1/runner/")
+	parts := strings.Split(path, "/")
+	runnerID := r.Context().Value("runnerID").(int)
+
+	// /api/v1/runner/jobs/request
+	if len(parts) == 2 && parts[0] == "jobs" && parts[1] == "request" {
+		s.requestRunnerJob(w, r, runnerID)
+		return
+	}
+
+	// /api/v1/runner/jobs/{jobId}/logs and /api/v1/runner/jobs/{jobId}/finish
+	if len(parts) == 3 && parts[0] == "jobs" {
+		jobID, err := parseIDFromPath(r.URL.Path, 4)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid job ID")
+			return
+		}
+		switch parts[2] {
+		case "logs":
+			s.appendRunnerJobLogs(w, r, runnerID, jobID)
+			return
+		case "finish":
+			s.finishRunnerJob(w, r, runnerID, jobID)
+			return
+		}
+	}
+
+	respondError(w, http.StatusNotFound, "Not found")
+}
+
+// requestRunnerJob hands the next waiting job to a runner, 204 when there is none
+func (s *Server) requestRunnerJob(w http.ResponseWriter, r *http.Request, runnerID int) {
+	job := s.pipelineExecutor.ClaimJob(r.Context(), runnerID)
+	if job == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	logger.Info(fmt.Sprintf("Job %d claimed by runner %d", job.JobID, runnerID))
+	respondJSON(w, http.StatusOK, job)
+}
+
+// appendRunnerJobLogs stores log lines sent by a runner, an empty batch acting as a heartbeat
+// Runners send entries with their stream and timestamp, plain lines coming from older runners.
+// 409 tells the runner the job was cancelled or timed out and must be stopped
+func (s *Server) appendRunnerJobLogs(w http.ResponseWriter, r *http.Request, runnerID, jobID int) {
+	var req struct {
+		Entries []models.LogLine `json:"entries"`
+		Lines   []string         `json:"lines"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if !s.pipelineExecutor.TouchJob(jobID, runnerID) {
+		respondError(w, http.StatusConflict, "Job is no longer running on this runner")
+		return
+	}
+	entries := req.Entries
+	for _, line := range req.Lines {
+		entries = append(entries, models.LogLine{Content: line, Stream: models.LogStreamStdout, CreatedAt: time.Now()})
+	}
+	for i := range entries {
+		entries[i].Content = executor.SanitizeLogLine(entries[i].Content)
+	}
+	if len(entries) > 0 {
+		if err := s.db.CreateLogEntries(r.Context(), jobID, entries); err != nil {
+			respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// finishRunnerJob records the exit code of a job run by a runner
+func (s *Server) finishRunnerJob(w http.ResponseWriter, r *http.Request, runnerID, jobID int) {
+	var req struct {
+		ExitCode int `json:"exit_code"`
+		// Usage is optional, older runners do not sample it
+		Usage *models.ResourceUsage `json:"resource_usage"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if !s.pipelineExecutor.CompleteJob(jobID, runnerID, req.ExitCode) {
+		respondError(w, http.StatusConflict, "Job is no longer running on this runner")
+		return
+	}
+	if req.Usage != nil {
+		if err := s.db.SetJobUsage(r.Context(), jobID, *req.Usage); err != nil {
+			logger.Warn(fmt.Sprintf("Failed to record the resource usage of job %d: %v", jobID, err))
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
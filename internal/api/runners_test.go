@@ -0,0 +1,92 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRunnerRegistration(t *testing.T) {
+	t.Setenv("RUNNER_REGISTRATION_TOKEN", "registration-secret")
+	s, _ := newTestServer()
+
+	register := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.handleRunnerRegister(w, httptest.NewRequest(http.MethodPost, "/api/v1/runners/register", strings.NewReader(body)))
+		return w
+	}
+	authenticate := func(token string) (int, int) {
+		runnerID := 0
+		handler := s.RunnerAuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+			runnerID, _ = r.Context().Value("runnerID").(int)
+		})
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/runner/jobs/request", nil)
+		r.Header.Set("X-Runner-Token", token)
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w.Code, runnerID
+	}
+
+	t.Run("RejectsWrongRegistrationToken", func(t *testing.T) {
+		if w := register(`{"registration_token": "wrong", "name": "r1"}`); w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status 401, got %d", w.Code)
+		}
+	})
+
+	t.Run("IssuedTokenAuthenticates", func(t *testing.T) {
+		w := register(`{"registration_token": "registration-secret", "name": "r1"}`)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d", w.Code)
+		}
+		var resp struct {
+			ID    int    `json:"id"`
+			Token string `json:"token"`
+		}
+		json.NewDecoder(w.Body).Decode(&resp)
+
+		code, runnerID := authenticate(resp.Token)
+		if code != http.StatusOK || runnerID != resp.ID {
+			t.Errorf("Expected runner %d to be authenticated, got status %d and runner %d", resp.ID, code, runnerID)
+		}
+		if code, _ := authenticate("not-a-runner-token"); code != http.StatusUnauthorized {
+			t.Errorf("Expected status 401 for an unknown token, got %d", code)
+		}
+	})
+}
+
+func TestRunnerAdministration(t *testing.T) {
+	t.Setenv("ADMIN_EMAILS", "ops@example.com, admin@example.com")
+	s, st := newTestServer()
+	adminID := createTestUser(t, st, "Admin@example.com")
+	userID := createTestUser(t, st, "user@example.com")
+	runner, err := st.CreateRunner(context.Background(), "r1", hashRunnerToken("runner-token"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	serve := func(handler http.HandlerFunc, method, path string, userID int) int {
+		r := httptest.NewRequest(method, path, nil)
+		r = r.WithContext(context.WithValue(r.Context(), "userID", userID))
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w.Code
+	}
+	deletePath := "/api/v1/runners/" + strconv.Itoa(runner.ID)
+
+	if code := serve(s.handleRunners, http.MethodGet, "/api/v1/runners", userID); code != http.StatusForbidden {
+		t.Errorf("Expected status 403 listing runners as a user, got %d", code)
+	}
+	if code := serve(s.handleRunner, http.MethodDelete, deletePath, userID); code != http.StatusForbidden {
+		t.Errorf("Expected status 403 removing a runner as a user, got %d", code)
+	}
+	if code := serve(s.handleRunners, http.MethodGet, "/api/v1/runners", adminID); code != http.StatusOK {
+		t.Errorf("Expected status 200 listing runners as an administrator, got %d", code)
+	}
+	if code := serve(s.handleRunner, http.MethodDelete, deletePath, adminID); code != http.StatusNoContent {
+		t.Errorf("Expected status 204 removing a runner as an administrator, got %d", code)
+	}
+}
@@ -1,24 +1,67 @@
 package api
 
 import (
+	"cmp"
+	"context"
 	"fmt"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/database"
 	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/docker"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/events"
 	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/executor"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/git"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/githubapp"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/notify"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/queue"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/ssh"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/store"
 
 	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
 // Server represents the API server
 type Server struct {
-	db                 *database.DB
+	db                 store.Store
 	docker             *docker.DockerExecutor
 	port               string
 	pipelineExecutor   *executor.PipelineExecutor
 	deploymentExecutor *executor.DeploymentExecutor
+	events             *events.Bus
+	queue              *queue.Queue
+	// mailer sends the verification and password reset emails of local accounts, nil without SMTP server
+	mailer mailSender
+	// authLimits throttles signups, logins and password resets
+	authLimits authLimits
+	// githubApp mints repository tokens of projects linked to a GitHub App installation, nil when not configured
+	githubApp *githubapp.App
+	// previewTTL is how long a preview environment lives without a new push to its branch, 0 forever
+	previewTTL time.Duration
+	// cloneCache keeps a mirror of each project repository that pipeline clones reference, nil when disabled
+	cloneCache *git.Cache
+	// pipelineTimeout is how long a pipeline may run before the watchdog fails it, unless its project sets its own
+	pipelineTimeout time.Duration
+
+	// runs holds every pipeline queued or executing on this server, keyed by pipeline ID
+	runs   map[int]*trackedRun
+	runsMu sync.Mutex
+	// runsWG tracks the executing pipelines so shutdown can wait for them
+	runsWG sync.WaitGroup
+
+	// debugTickets holds the one-shot debug session tickets not used yet, keyed by ticket
+	debugTickets   map[string]debugTicket
+	debugTicketsMu sync.Mutex
+
+	// ctx is the parent of every pipeline context, cancelled on shutdown
+	ctx    context.Context
+	stop   context.CancelFunc
+	server *http.Server
 }
 
 // NewServer creates a new API server
@@ -28,16 +71,106 @@ func NewServer(db *database.DB, port string) (*Server, error) {
 		return nil, fmt.Errorf("failed to create docker executor: %w", err)
 	}
 
-	pipelineExecutor := executor.NewPipelineExecutor(db, docker)
-	deploymentExecutor := executor.NewDeploymentExecutor(db, docker)
+	// A nil *database.DB must become a nil Store, not a Store holding a nil pointer
+	var st store.Store
+	if db != nil {
+		st = db
+	}
+
+	pipelineExecutor := executor.NewPipelineExecutor(st, docker)
+	pipelineExecutor.SetMaxParallelJobs(envInt("MAX_PARALLEL_JOBS", 4))
+	pipelineExecutor.SetAllowPrivileged(os.Getenv("ALLOW_PRIVILEGED_JOBS") == "true")
+	pipelineExecutor.SetRemoteExecution(os.Getenv("EXECUTION_MODE") == "runners")
+	sshExecutors, err := sshExecutorsFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	pipelineExecutor.SetSSHExecutors(sshExecutors)
+	pipelineExecutor.SetShellExecution(os.Getenv("SHELL_EXECUTOR") == "true", strings.Fields(os.Getenv("SHELL_EXECUTOR_WRAPPER")))
+	deploymentExecutor := executor.NewDeploymentExecutor(st, docker)
+
+	// Status changes written to the database are broadcast to the streams, notifiers and WebSocket clients,
+	// and shared with the other instances when a Redis or NATS backend is configured
+	bus := events.NewBus()
+	if db != nil {
+		db.SetEventBus(bus)
+	}
+	if busURL := os.Getenv("EVENT_BUS_URL"); busURL != "" {
+		backend, err := events.BackendFromURL(busURL, cmp.Or(os.Getenv("EVENT_BUS_CHANNEL"), "cicd-events"))
+		if err != nil {
+			return nil, err
+		}
+		bus.SetBackend(backend)
+	}
+
+	githubApp, err := githubapp.FromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure GitHub App: %w", err)
+	}
+	if os.Getenv("GITHUB_WEBHOOK_SECRET") == "" {
+		logger.Warn("GITHUB_WEBHOOK_SECRET not set, GitHub webhook deliveries are not authenticated")
+	}
+
+	var cloneCache *git.Cache
+	if os.Getenv("GIT_CACHE") != "false" {
+		cloneCache = git.NewCache(cmp.Or(os.Getenv("GIT_CACHE_DIR"), gitCacheRoot))
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
 
-	return &Server{
-		db:                 db,
+	s := &Server{
+		ctx:                ctx,
+		stop:               stop,
+		db:                 st,
 		docker:             docker,
 		port:               port,
 		pipelineExecutor:   pipelineExecutor,
 		deploymentExecutor: deploymentExecutor,
-	}, nil
+		events:             bus,
+		githubApp:          githubApp,
+		authLimits:         newAuthLimits(),
+		previewTTL:         envDuration("PREVIEW_TTL", 7*24*time.Hour),
+		cloneCache:         cloneCache,
+		queue:              queue.New(envInt("MAX_CONCURRENT_PIPELINES", 2), envInt("PIPELINE_QUEUE_SIZE", 100)),
+		runs:               make(map[int]*trackedRun),
+		pipelineTimeout:    envDuration("PIPELINE_TIMEOUT", 6*time.Hour),
+	}
+	// A nil *notify.Mailer must stay a nil interface
+	if mailer := notify.MailerFromEnv(); mailer != nil {
+		s.mailer = mailer
+	}
+	return s, nil
+}
+
+// sshExecutorsFromEnv reads the machines of SSH_EXECUTORS, with the key of SSH_EXECUTOR_PRIVATE_KEY or the file at SSH_EXECUTOR_PRIVATE_KEY_PATH
+func sshExecutorsFromEnv() (map[string]ssh.Endpoint, error) {
+	key := os.Getenv("SSH_EXECUTOR_PRIVATE_KEY")
+	if path := os.Getenv("SSH_EXECUTOR_PRIVATE_KEY_PATH"); key == "" && path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read SSH executor private key: %w", err)
+		}
+		key = string(content)
+	}
+	// Keys passed in a single-line environment variable have escaped newlines
+	key = strings.ReplaceAll(key, `\n`, "\n")
+	return executor.ParseSSHExecutors(os.Getenv("SSH_EXECUTORS"), key)
+}
+
+// envInt reads an integer environment variable, falling back to def when unset or invalid
+func envInt(name string, def int) int {
+	if value, err := strconv.Atoi(os.Getenv(name)); err == nil {
+		return value
+	}
+	return def
+}
+
+// envDuration reads a duration environment variable (e.g. 30m), falling back to def when unset or invalid
+func envDuration(name string, def time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(name)); err == nil && value > 0 {
+		return value
+	}
+	return def
 }
 
 // enableCORS adds CORS headers to the response
@@ -45,7 +178,8 @@ func enableCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-GitHub-Event")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-GitHub-Event, X-Request-ID, Idempotency-Key")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Total-Count, X-Request-ID")
 
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusOK)
@@ -60,8 +194,30 @@ func enableCORS(next http.Handler) http.Handler {
 func (s *Server) Start() error {
 	InitializeOAuth()
 
-	// Health check
-	http.HandleFunc("/health", s.handleHealth)
+	// Reconcile the pipelines left unfinished by the previous process, then start the workers
+	s.recoverPipelines()
+	s.queue.Start()
+
+	// Periodically remove leftover containers, images and workspaces
+	go s.runJanitor(envDuration("JANITOR_INTERVAL", time.Hour), envDuration("WORKSPACE_MAX_AGE", 24*time.Hour))
+
+	// Stop the pipelines running for longer than their timeout
+	go s.runWatchdog(envDuration("WATCHDOG_INTERVAL", time.Minute))
+
+	// Relay the events of the other instances, then audit them, report statuses on the commits of the repository host,
+	// notify Slack and outbound webhooks
+	go s.events.Run(s.ctx)
+	go notify.NewAuditLogger().Run(s.ctx, s.events)
+	if s.db != nil {
+		go notify.NewStatusReporter(s.db, s.githubApp, os.Getenv("FRONTEND_URL")).Run(s.ctx, s.events)
+		go notify.NewSlackNotifier(s.db, os.Getenv("FRONTEND_URL")).Run(s.ctx, s.events)
+		go notify.NewWebhookDispatcher(s.db).Run(s.ctx, s.events)
+	}
+
+	// Health checks: /health is kept as an alias of the liveness probe
+	http.HandleFunc("/health", s.handleHealthz)
+	http.HandleFunc("/healthz", s.handleHealthz)
+	http.HandleFunc("/readyz", s.handleReadyz)
 
 	// Webhook
 	http.HandleFunc("/webhook/github", s.handleGitHubWebhook)
@@ -71,36 +227,196 @@ func (s *Server) Start() error {
 	http.HandleFunc("/auth/google/callback", s.handleAuthCallback)
 	http.HandleFunc("/auth/github/login", s.handleAuthLogin)
 	http.HandleFunc("/auth/github/callback", s.handleAuthCallback)
+	http.HandleFunc("/auth/gitlab/login", s.handleAuthLogin)
+	http.HandleFunc("/auth/gitlab/callback", s.handleAuthCallback)
+	http.HandleFunc("/auth/local/signup", s.handleLocalSignup)
+	http.HandleFunc("/auth/local/login", s.handleLocalLogin)
+	http.HandleFunc("/auth/local/password-reset", s.handlePasswordResetRequest)
+	http.HandleFunc("/auth/local/password-reset/confirm", s.handlePasswordResetConfirm)
+	http.HandleFunc("/auth/local/verify-email", s.handleEmailVerification)
 
 	// API v1 routes
 	http.HandleFunc("/api/v1/projects", s.AuthMiddleware(s.handleProjects))
-	http.HandleFunc("/api/v1/projects/", s.AuthMiddleware(s.routeProjectsSubpath))
+	http.HandleFunc("/api/v1/projects/", s.routeProjectsPublic)
+	http.HandleFunc("/api/v1/ws", s.handleWebSocket)
+	http.HandleFunc("/api/v1/debug/", s.handleDebugSession)
+	http.HandleFunc("/api/v1/queue", s.AuthMiddleware(s.handleQueue))
+	http.HandleFunc("/api/v1/job-types", s.AuthMiddleware(s.handleJobTypes))
+
+	// Repositories of the user on their OAuth provider
+	http.HandleFunc("/api/v1/repos", s.AuthMiddleware(s.handleRepos))
+	http.HandleFunc("/api/v1/repos/import", s.AuthMiddleware(s.handleRepoImport))
+
+	// Project templates, organizations and personal access tokens
+	http.HandleFunc("/api/v1/templates", s.AuthMiddleware(s.handleTemplates))
+	http.HandleFunc("/api/v1/templates/", s.AuthMiddleware(s.routeTemplatesSubpath))
+	http.HandleFunc("/api/v1/orgs", s.AuthMiddleware(s.handleOrganizations))
+	http.HandleFunc("/api/v1/orgs/", s.AuthMiddleware(s.routeOrganizationsSubpath))
+	http.HandleFunc("/api/v1/user/tokens", s.AuthMiddleware(s.handleAPITokens))
+	http.HandleFunc("/api/v1/user/tokens/", s.AuthMiddleware(s.handleAPIToken))
+
+	// Runner agents
+	http.HandleFunc("/api/v1/runners", s.AuthMiddleware(s.handleRunners))
+	http.HandleFunc("/api/v1/runners/", s.AuthMiddleware(s.handleRunner))
+	http.HandleFunc("/api/v1/runners/register", s.handleRunnerRegister)
+	http.HandleFunc("/api/v1/runner/", s.RunnerAuthMiddleware(s.routeRunnerSubpath))
 
 	logger.Info("Starting API server on port " + s.port)
 	logger.Info("Endpoints:")
 	logger.Info("  - GET    /health")
+	logger.Info("  - GET    /healthz")
+	logger.Info("  - GET    /readyz")
 	logger.Info("  - POST   /webhook/github")
 	logger.Info("  - GET    /auth/{provider}/login")
 	logger.Info("  - GET    /auth/{provider}/callback")
+	logger.Info("  - POST   /auth/local/signup")
+	logger.Info("  - POST   /auth/local/login")
+	logger.Info("  - POST   /auth/local/password-reset")
+	logger.Info("  - POST   /auth/local/password-reset/confirm")
+	logger.Info("  - POST   /auth/local/verify-email")
+	logger.Info("  - GET    /api/v1/ws")
+	logger.Info("  - GET    /api/v1/debug/{ticket}")
+	logger.Info("  - GET    /api/v1/queue")
+	logger.Info("  - GET    /api/v1/job-types")
+	logger.Info("  - GET    /api/v1/repos")
+	logger.Info("  - POST   /api/v1/repos/import")
+	logger.Info("  - GET    /api/v1/templates")
+	logger.Info("  - POST   /api/v1/templates")
+	logger.Info("  - GET    /api/v1/templates/{id}")
+	logger.Info("  - PUT    /api/v1/templates/{id}")
+	logger.Info("  - DELETE /api/v1/templates/{id}")
+	logger.Info("  - POST   /api/v1/templates/{id}/projects")
+	logger.Info("  - GET    /api/v1/orgs")
+	logger.Info("  - POST   /api/v1/orgs")
+	logger.Info("  - GET    /api/v1/orgs/{id}")
+	logger.Info("  - PUT    /api/v1/orgs/{id}")
+	logger.Info("  - DELETE /api/v1/orgs/{id}")
+	logger.Info("  - GET    /api/v1/orgs/{id}/members")
+	logger.Info("  - POST   /api/v1/orgs/{id}/members")
+	logger.Info("  - DELETE /api/v1/orgs/{id}/members/{userId}")
+	logger.Info("  - GET    /api/v1/orgs/{id}/teams")
+	logger.Info("  - POST   /api/v1/orgs/{id}/teams")
+	logger.Info("  - GET    /api/v1/orgs/{id}/teams/{teamId}")
+	logger.Info("  - PUT    /api/v1/orgs/{id}/teams/{teamId}")
+	logger.Info("  - DELETE /api/v1/orgs/{id}/teams/{teamId}")
+	logger.Info("  - GET    /api/v1/orgs/{id}/teams/{teamId}/members")
+	logger.Info("  - POST   /api/v1/orgs/{id}/teams/{teamId}/members")
+	logger.Info("  - DELETE /api/v1/orgs/{id}/teams/{teamId}/members/{userId}")
+	logger.Info("  - GET    /api/v1/orgs/{id}/projects")
+	logger.Info("  - GET    /api/v1/user/tokens")
+	logger.Info("  - POST   /api/v1/user/tokens")
+	logger.Info("  - DELETE /api/v1/user/tokens/{id}")
+	logger.Info("  - GET    /api/v1/runners")
+	logger.Info("  - POST   /api/v1/runners/register")
+	logger.Info("  - DELETE /api/v1/runners/{id}")
+	logger.Info("  - POST   /api/v1/runner/jobs/request")
+	logger.Info("  - POST   /api/v1/runner/jobs/{id}/logs")
+	logger.Info("  - POST   /api/v1/runner/jobs/{id}/finish")
 	logger.Info("  - GET    /api/v1/projects")
 	logger.Info("  - POST   /api/v1/projects")
 	logger.Info("  - GET    /api/v1/projects/{id}")
 	logger.Info("  - PUT    /api/v1/projects/{id}")
 	logger.Info("  - DELETE /api/v1/projects/{id}")
+	logger.Info("  - GET    /api/v1/projects/{id}/branches")
+	logger.Info("  - POST   /api/v1/projects/{id}/transfer")
+	logger.Info("  - PUT    /api/v1/projects/{id}/organization")
 	logger.Info("  - GET    /api/v1/projects/{id}/members")
 	logger.Info("  - POST   /api/v1/projects/{id}/members")
 	logger.Info("  - DELETE /api/v1/projects/{id}/members/{userId}")
 	logger.Info("  - GET    /api/v1/projects/{id}/variables")
 	logger.Info("  - POST   /api/v1/projects/{id}/variables")
+	logger.Info("  - PUT    /api/v1/projects/{id}/variables/{key}")
 	logger.Info("  - DELETE /api/v1/projects/{id}/variables/{key}")
+	logger.Info("  - GET    /api/v1/projects/{id}/environments")
+	logger.Info("  - POST   /api/v1/projects/{id}/environments")
+	logger.Info("  - GET    /api/v1/projects/{id}/environments/{name}")
+	logger.Info("  - PUT    /api/v1/projects/{id}/environments/{name}")
+	logger.Info("  - DELETE /api/v1/projects/{id}/environments/{name}")
+	logger.Info("  - GET    /api/v1/projects/{id}/environments/{name}/current")
+	logger.Info("  - POST   /api/v1/projects/{id}/environments/{name}/stop")
+	logger.Info("  - GET    /api/v1/projects/{id}/previews")
+	logger.Info("  - DELETE /api/v1/projects/{id}/previews/{previewId}")
+	logger.Info("  - POST   /api/v1/projects/{id}/ssh/test")
+	logger.Info("  - GET    /api/v1/projects/{id}/deploy-key")
+	logger.Info("  - POST   /api/v1/projects/{id}/deploy-key")
+	logger.Info("  - DELETE /api/v1/projects/{id}/deploy-key")
+	logger.Info("  - POST   /api/v1/projects/{id}/deployments/rollback")
+	logger.Info("  - GET    /api/v1/projects/{id}/badge.svg")
+	logger.Info("  - GET    /api/v1/projects/{id}/badge-token")
+	logger.Info("  - POST   /api/v1/projects/{id}/badge-token")
+	logger.Info("  - DELETE /api/v1/projects/{id}/badge-token")
+	logger.Info("  - GET    /api/v1/projects/{id}/webhooks")
+	logger.Info("  - POST   /api/v1/projects/{id}/webhooks")
+	logger.Info("  - DELETE /api/v1/projects/{id}/webhooks/{webhookId}")
+	logger.Info("  - GET    /api/v1/projects/{id}/webhook-deliveries")
+	logger.Info("  - GET    /api/v1/projects/{id}/webhook-deliveries/{deliveryId}")
+	logger.Info("  - POST   /api/v1/projects/{id}/webhook-deliveries/{deliveryId}/replay")
+	logger.Info("  - GET    /api/v1/projects/{id}/retention")
+	logger.Info("  - POST   /api/v1/projects/{id}/retention")
 	logger.Info("  - GET    /api/v1/projects/{id}/pipelines")
 	logger.Info("  - POST   /api/v1/projects/{id}/pipelines")
 	logger.Info("  - GET    /api/v1/projects/{id}/pipelines/{id}")
+	logger.Info("  - POST   /api/v1/projects/{id}/pipelines/{id}/cancel")
+	logger.Info("  - POST   /api/v1/projects/{id}/pipelines/{id}/retry")
 	logger.Info("  - GET    /api/v1/projects/{id}/pipelines/{id}/jobs")
 	logger.Info("  - GET    /api/v1/projects/{id}/pipelines/{id}/jobs/{id}")
+	logger.Info("  - POST   /api/v1/projects/{id}/pipelines/{id}/jobs/{id}/play")
+	logger.Info("  - POST   /api/v1/projects/{id}/pipelines/{id}/jobs/{id}/debug")
 	logger.Info("  - GET    /api/v1/projects/{id}/pipelines/{id}/jobs/{id}/logs")
+	logger.Info("  - GET    /api/v1/projects/{id}/pipelines/{id}/jobs/{id}/logs/stream")
+	logger.Info("  - GET    /api/v1/projects/{id}/pipelines/{id}/jobs/{id}/logs/raw")
+	logger.Info("  - GET    /api/v1/projects/{id}/pipelines/{id}/logs.zip")
+	logger.Info("  - GET    /api/v1/projects/{id}/pipelines/{id}/vulnerabilities")
+	logger.Info("  - GET    /api/v1/projects/{id}/pipelines/{id}/artifacts")
+	logger.Info("  - GET    /api/v1/projects/{id}/pipelines/{id}/artifacts/{id}")
+
+	// Every request gets a span, continuing the trace of the caller when it sends a traceparent header
+	handler := otelhttp.NewHandler(requestLogger(enableCORS(http.DefaultServeMux)), "api",
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return r.Method + " " + r.URL.Path
+		}))
+	s.server = &http.Server{Addr: ":" + s.port, Handler: handler}
+	err := s.server.ListenAndServe()
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// Shutdown stops accepting requests and cancels the running pipelines, stopping their containers
+// It waits for the pipelines to finish their cleanup until ctx is done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s.server != nil {
+		if err := s.server.Shutdown(ctx); err != nil {
+			return err
+		}
+	}
+	s.stop()
+
+	done := make(chan struct{})
+	go func() {
+		s.runsWG.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// routeProjectsPublic serves the public endpoints under /api/v1/projects/, the others requiring authentication
+func (s *Server) routeProjectsPublic(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/projects/"), "/")
 
-	return http.ListenAndServe(":"+s.port, enableCORS(http.DefaultServeMux))
+	// /api/v1/projects/{projectId}/badge.svg, embedded in READMEs without credentials
+	if len(parts) == 2 && parts[1] == "badge.svg" {
+		s.handleBadge(w, r)
+		return
+	}
+
+	s.AuthMiddleware(s.routeProjectsSubpath)(w, r)
 }
 
 // routeProjectsSubpath routes requests under /api/v1/projects/
@@ -108,12 +424,35 @@ func (s *Server) routeProjectsSubpath(w http.ResponseWriter, r *http.Request) {
 	path := strings.TrimPrefix(r.URL.Path, "/api/v1/projects/")
 	parts := strings.Split(path, "/")
 
+	// Every project route requires the user's role to allow the action
+	if parts[0] != "" && !s.authorize(w, r, parts[0], projectAction(parts, r.Method)) {
+		return
+	}
+
 	// /api/v1/projects/{projectId}
 	if len(parts) == 1 && parts[0] != "" {
 		s.handleProject(w, r)
 		return
 	}
 
+	// /api/v1/projects/{projectId}/branches
+	if len(parts) == 2 && parts[1] == "branches" {
+		s.handleBranches(w, r)
+		return
+	}
+
+	// /api/v1/projects/{projectId}/transfer
+	if len(parts) == 2 && parts[1] == "transfer" {
+		s.handleTransferProject(w, r)
+		return
+	}
+
+	// /api/v1/projects/{projectId}/organization
+	if len(parts) == 2 && parts[1] == "organization" {
+		s.handleProjectOrganization(w, r)
+		return
+	}
+
 	// /api/v1/projects/{projectId}/members
 	if len(parts) == 2 && parts[1] == "members" {
 		s.handleProjectMembers(w, r)
@@ -138,6 +477,102 @@ func (s *Server) routeProjectsSubpath(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// /api/v1/projects/{projectId}/environments
+	if len(parts) == 2 && parts[1] == "environments" {
+		s.handleEnvironments(w, r)
+		return
+	}
+
+	// /api/v1/projects/{projectId}/environments/{name}
+	if len(parts) == 3 && parts[1] == "environments" {
+		s.handleEnvironment(w, r)
+		return
+	}
+
+	// /api/v1/projects/{projectId}/environments/{name}/current
+	if len(parts) == 4 && parts[1] == "environments" && parts[3] == "current" {
+		s.handleEnvironmentVersion(w, r)
+		return
+	}
+
+	// /api/v1/projects/{projectId}/environments/{name}/stop
+	if len(parts) == 4 && parts[1] == "environments" && parts[3] == "stop" {
+		s.handleEnvironmentStop(w, r)
+		return
+	}
+
+	// /api/v1/projects/{projectId}/previews
+	if len(parts) == 2 && parts[1] == "previews" {
+		s.handlePreviews(w, r)
+		return
+	}
+
+	// /api/v1/projects/{projectId}/previews/{previewId}
+	if len(parts) == 3 && parts[1] == "previews" {
+		s.handlePreview(w, r)
+		return
+	}
+
+	// /api/v1/projects/{projectId}/deploy-key
+	if len(parts) == 2 && parts[1] == "deploy-key" {
+		s.handleDeployKey(w, r)
+		return
+	}
+
+	// /api/v1/projects/{projectId}/badge-token
+	if len(parts) == 2 && parts[1] == "badge-token" {
+		s.handleBadgeToken(w, r)
+		return
+	}
+
+	// /api/v1/projects/{projectId}/ssh/test
+	if len(parts) == 3 && parts[1] == "ssh" && parts[2] == "test" {
+		s.handleSSHTest(w, r)
+		return
+	}
+
+	// /api/v1/projects/{projectId}/deployments/rollback
+	if len(parts) == 3 && parts[1] == "deployments" && parts[2] == "rollback" {
+		s.handleRollback(w, r)
+		return
+	}
+
+	// /api/v1/projects/{projectId}/webhooks
+	if len(parts) == 2 && parts[1] == "webhooks" {
+		s.handleWebhooks(w, r)
+		return
+	}
+
+	// /api/v1/projects/{projectId}/webhooks/{webhookId}
+	if len(parts) == 3 && parts[1] == "webhooks" {
+		s.handleWebhook(w, r)
+		return
+	}
+
+	// /api/v1/projects/{projectId}/webhook-deliveries
+	if len(parts) == 2 && parts[1] == "webhook-deliveries" {
+		s.handleWebhookDeliveries(w, r)
+		return
+	}
+
+	// /api/v1/projects/{projectId}/webhook-deliveries/{deliveryId}
+	if len(parts) == 3 && parts[1] == "webhook-deliveries" {
+		s.handleWebhookDelivery(w, r)
+		return
+	}
+
+	// /api/v1/projects/{projectId}/webhook-deliveries/{deliveryId}/replay
+	if len(parts) == 4 && parts[1] == "webhook-deliveries" && parts[3] == "replay" {
+		s.handleWebhookDeliveryReplay(w, r)
+		return
+	}
+
+	// /api/v1/projects/{projectId}/retention
+	if len(parts) == 2 && parts[1] == "retention" {
+		s.handleRetention(w, r)
+		return
+	}
+
 	// /api/v1/projects/{projectId}/pipelines
 	if len(parts) == 2 && parts[1] == "pipelines" {
 		s.handlePipelines(w, r)
@@ -150,6 +585,18 @@ func (s *Server) routeProjectsSubpath(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// /api/v1/projects/{projectId}/pipelines/{pipelineId}/cancel
+	if len(parts) == 4 && parts[1] == "pipelines" && parts[3] == "cancel" {
+		s.handleCancelPipeline(w, r)
+		return
+	}
+
+	// /api/v1/projects/{projectId}/pipelines/{pipelineId}/retry
+	if len(parts) == 4 && parts[1] == "pipelines" && parts[3] == "retry" {
+		s.handleRetryPipeline(w, r)
+		return
+	}
+
 	// /api/v1/projects/{projectId}/pipelines/{pipelineId}/jobs
 	if len(parts) == 4 && parts[1] == "pipelines" && parts[3] == "jobs" {
 		s.handleJobs(w, r)
@@ -162,12 +609,60 @@ func (s *Server) routeProjectsSubpath(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// /api/v1/projects/{projectId}/pipelines/{pipelineId}/jobs/{jobId}/play
+	if len(parts) == 6 && parts[1] == "pipelines" && parts[3] == "jobs" && parts[5] == "play" {
+		s.handleJobPlay(w, r)
+		return
+	}
+
+	// /api/v1/projects/{projectId}/pipelines/{pipelineId}/jobs/{jobId}/debug
+	if len(parts) == 6 && parts[1] == "pipelines" && parts[3] == "jobs" && parts[5] == "debug" {
+		s.handleJobDebug(w, r)
+		return
+	}
+
 	// /api/v1/projects/{projectId}/pipelines/{pipelineId}/jobs/{jobId}/logs
 	if len(parts) == 6 && parts[1] == "pipelines" && parts[3] == "jobs" && parts[5] == "logs" {
 		s.handleLogs(w, r)
 		return
 	}
 
+	// /api/v1/projects/{projectId}/pipelines/{pipelineId}/jobs/{jobId}/logs/raw
+	if len(parts) == 7 && parts[1] == "pipelines" && parts[3] == "jobs" && parts[5] == "logs" && parts[6] == "raw" {
+		s.handleRawLogs(w, r)
+		return
+	}
+
+	// /api/v1/projects/{projectId}/pipelines/{pipelineId}/logs.zip
+	if len(parts) == 4 && parts[1] == "pipelines" && parts[3] == "logs.zip" {
+		s.handleLogsArchive(w, r)
+		return
+	}
+
+	// /api/v1/projects/{projectId}/pipelines/{pipelineId}/jobs/{jobId}/logs/stream
+	if len(parts) == 7 && parts[1] == "pipelines" && parts[3] == "jobs" && parts[5] == "logs" && parts[6] == "stream" {
+		s.handleLogsStream(w, r)
+		return
+	}
+
+	// /api/v1/projects/{projectId}/pipelines/{pipelineId}/vulnerabilities
+	if len(parts) == 4 && parts[1] == "pipelines" && parts[3] == "vulnerabilities" {
+		s.handleVulnerabilities(w, r)
+		return
+	}
+
+	// /api/v1/projects/{projectId}/pipelines/{pipelineId}/artifacts
+	if len(parts) == 4 && parts[1] == "pipelines" && parts[3] == "artifacts" {
+		s.handleArtifacts(w, r)
+		return
+	}
+
+	// /api/v1/projects/{projectId}/pipelines/{pipelineId}/artifacts/{artifactId}
+	if len(parts) == 5 && parts[1] == "pipelines" && parts[3] == "artifacts" {
+		s.handleArtifact(w, r)
+		return
+	}
+
 	// /api/v1/projects/{projectId}/pipelines/{pipelineId}/deployment
 	if len(parts) == 4 && parts[1] == "pipelines" && parts[3] == "deployment" {
 		s.handleDeployment(w, r)
@@ -180,5 +675,11 @@ func (s *Server) routeProjectsSubpath(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// /api/v1/projects/{projectId}/pipelines/{pipelineId}/deployment/logs/stream
+	if len(parts) == 6 && parts[1] == "pipelines" && parts[3] == "deployment" && parts[4] == "logs" && parts[5] == "stream" {
+		s.handleDeploymentLogsStream(w, r)
+		return
+	}
+
 	respondError(w, http.StatusNotFound, "Not found")
 }
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/executor"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/ssh"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+)
+
+// sshTestResult is the diagnostic of a connection attempt to the SSH host of a project
+type sshTestResult struct {
+	Success bool   `json:"success"`
+	Host    string `json:"host"`
+	Bastion string `json:"bastion,omitempty"`
+	// Reason is one of the ssh.Failure values, FailedAt "bastion" or "host"
+	Reason   string `json:"reason,omitempty"`
+	FailedAt string `json:"failed_at,omitempty"`
+	Message  string `json:"message,omitempty"`
+	// DockerCompose is the version of docker compose on the host, empty when it is missing
+	DockerCompose string `json:"docker_compose,omitempty"`
+}
+
+// handleSSHTest handles POST /api/v1/projects/{id}/ssh/test
+func (s *Server) handleSSHTest(w http.ResponseWriter, r *http.Request) {
+	projectID, err := parseIDFromPath(r.URL.Path, 3)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid project ID")
+		return
+	}
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	// Optional body: {"environment": "production"} to test the host of an environment
+	var req struct {
+		Environment string `json:"environment"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	project, err := s.db.GetProject(r.Context(), projectID)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Project not found")
+		return
+	}
+	if req.Environment != "" {
+		env, err := s.db.GetEnvironment(r.Context(), projectID, req.Environment)
+		if err != nil {
+			respondEnvironmentError(w, err)
+			return
+		}
+		project = environmentProject(project, env)
+	}
+	if project.SSHHost == "" {
+		respondError(w, http.StatusBadRequest, "No SSH host configured")
+		return
+	}
+
+	target, bastion := executor.SSHEndpoints(project)
+	result := sshTestResult{Host: target.Host}
+	if bastion != nil {
+		result.Bastion = bastion.Host
+	}
+
+	client, err := ssh.Connect(target, bastion)
+	if err != nil {
+		result.Reason, result.FailedAt, result.Message = ssh.FailureOther, "host", err.Error()
+		var connectErr *ssh.ConnectError
+		if errors.As(err, &connectErr) {
+			result.Reason = connectErr.Reason
+			if connectErr.Bastion {
+				result.FailedAt = "bastion"
+			}
+		}
+		logger.Info("SSH test of project " + project.Name + " failed: " + err.Error())
+		respondJSON(w, http.StatusOK, result)
+		return
+	}
+	defer client.Close()
+
+	result.Success = true
+	if out, err := client.RunCommand("export PATH=$PATH:/usr/local/bin:/usr/bin && docker compose version --short"); err == nil {
+		result.DockerCompose = strings.TrimSpace(out)
+	} else {
+		result.Message = "Connected, but docker compose is not available on the host"
+	}
+	respondJSON(w, http.StatusOK, result)
+}
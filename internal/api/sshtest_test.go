@@ -0,0 +1,82 @@
+package api
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+
+	gossh "golang.org/x/crypto/ssh"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/ssh"
+)
+
+func TestSSHTest(t *testing.T) {
+	ctx := context.Background()
+	s, st := newTestServer()
+	ownerID := createTestUser(t, st, "owner@example.com")
+	developerID := createTestUser(t, st, "dev@example.com")
+
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := gossh.MarshalPrivateKey(private, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A port nothing listens on
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddr := l.Addr().String()
+	l.Close()
+
+	project, err := st.CreateProject(ctx, &models.NewProject{OwnerID: ownerID, Name: "app", RepoURL: "https://example.com/app.git",
+		SSHHost: closedAddr, SSHUser: "deploy", SSHPrivateKey: string(pem.EncodeToMemory(block))})
+	if err != nil {
+		t.Fatalf("Expected no error creating project, got %v", err)
+	}
+	id := strconv.Itoa(project.ID)
+	st.AddProjectMember(ctx, project.ID, developerID, RoleDeveloper)
+	st.CreateEnvironment(ctx, &models.Environment{ProjectID: project.ID, Name: "staging", SSHHost: closedAddr, SSHPrivateKey: "not a key"})
+
+	diagnose := func(t *testing.T, body string) sshTestResult {
+		t.Helper()
+		w := postProject(s, id+"/ssh/test", body, ownerID)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", w.Code)
+		}
+		var result sshTestResult
+		if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+			t.Fatalf("Expected a diagnostic, got %v", err)
+		}
+		return result
+	}
+
+	t.Run("Unreachable", func(t *testing.T) {
+		if got := diagnose(t, ""); got.Success || got.Reason != ssh.FailureUnreachable || got.FailedAt != "host" {
+			t.Errorf("Expected an unreachable host, got %+v", got)
+		}
+	})
+
+	t.Run("InvalidKey", func(t *testing.T) {
+		if got := diagnose(t, `{"environment":"staging"}`); got.Reason != ssh.FailureInvalidKey {
+			t.Errorf("Expected an invalid key, got %+v", got)
+		}
+	})
+
+	t.Run("DeveloperCannotTest", func(t *testing.T) {
+		if w := serveProject(s, http.MethodPost, id+"/ssh/test", developerID); w.Code != http.StatusForbidden {
+			t.Errorf("Expected status 403, got %d", w.Code)
+		}
+	})
+}
@@ -0,0 +1,172 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/secrets"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// handleEnvironmentStop handles POST /api/v1/projects/{id}/environments/{name}/stop
+func (s *Server) handleEnvironmentStop(w http.ResponseWriter, r *http.Request) {
+	projectID, err := parseIDFromPath(r.URL.Path, 3)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid project ID")
+		return
+	}
+	if r.Method != http.MethodPost {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	s.stopEnvironment(w, r, projectID, strings.Split(strings.Trim(r.URL.Path, "/"), "/")[5])
+}
+
+// stopEnvironment creates a pipeline tearing down what runs on an environment
+// The pipeline runs no job, its deployment logs are those of the compose down.
+func (s *Server) stopEnvironment(w http.ResponseWriter, r *http.Request, projectID int, name string) {
+	if s.db == nil {
+		respondError(w, http.StatusServiceUnavailable, "Database not available")
+		return
+	}
+
+	project, err := s.db.GetProject(r.Context(), projectID)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Project not found")
+		return
+	}
+	env, err := s.db.GetEnvironment(r.Context(), projectID, name)
+	if err != nil {
+		respondEnvironmentError(w, err)
+		return
+	}
+	version, err := s.db.GetEnvironmentVersion(r.Context(), projectID, name)
+	if err != nil {
+		respondEnvironmentError(w, err)
+		return
+	}
+	// Preview environments have no version of their own, only the previews of their branches
+	previews, err := s.environmentPreviews(r.Context(), projectID, name)
+	if err != nil {
+		logger.Error("Failed to get previews: " + err.Error())
+		respondError(w, http.StatusInternalServerError, "Failed to get previews")
+		return
+	}
+	if version == nil && (!env.Preview || len(previews) == 0) {
+		respondError(w, http.StatusConflict, "Nothing is running on this environment")
+		return
+	}
+
+	var branch, commitHash string
+	if version != nil {
+		branch, commitHash = version.Branch, version.CommitHash
+	}
+	pipeline, err := s.db.CreatePipeline(r.Context(), projectID, branch, commitHash)
+	if err != nil {
+		logger.Error("Failed to create pipeline: " + err.Error())
+		respondError(w, http.StatusInternalServerError, "Failed to create pipeline")
+		return
+	}
+	if _, err := s.db.CreatePendingDeployment(r.Context(), pipeline.ID, name); err != nil {
+		logger.Error("Failed to pre-create deployment: " + err.Error())
+	}
+
+	logger.Info(fmt.Sprintf("Stopping environment %s of project %s as pipeline %d", name, project.Name, pipeline.ID))
+
+	userID, _ := r.Context().Value("userID").(int)
+	params := manualRunParams(project, pipeline, branch)
+	params.Environment = name
+	params.TriggeredBy = userID
+	params.TraceContext = tracing.Inject(r.Context())
+	params.RequestID = requestIDFromContext(r.Context())
+	if err := s.enqueueRun(params, s.runStopLogic); err != nil {
+		respondError(w, http.StatusServiceUnavailable, "Pipeline queue is full, try again later")
+		return
+	}
+	pipeline.Status = "queued"
+
+	respondJSON(w, http.StatusAccepted, pipeline)
+}
+
+// runStopLogic tears down the deployment of the environment of params.PipelineID, or every preview of a preview environment
+func (s *Server) runStopLogic(ctx context.Context, params models.PipelineRunParams) {
+	ctx, span := tracing.Start(tracing.Extract(ctx, params.TraceContext), "pipeline",
+		attribute.Int("cicd.project.id", params.ProjectID),
+		attribute.Int("cicd.pipeline.id", params.PipelineID),
+		attribute.String("cicd.environment", params.Environment),
+		attribute.String("cicd.request_id", params.RequestID))
+	defer span.End()
+	dbCtx := context.WithoutCancel(ctx)
+
+	project, err := s.db.GetProject(dbCtx, params.ProjectID)
+	if errors.Is(err, secrets.ErrKeyMismatch) {
+		s.failPipeline(params.PipelineID, keyMismatchReason)
+		return
+	}
+	if err != nil {
+		s.failPipeline(params.PipelineID, "Project not found")
+		return
+	}
+	env, reason := s.deployEnvironment(dbCtx, project, params.Environment, params.Branch, params.TriggeredBy)
+	if reason != "" {
+		s.failPipeline(params.PipelineID, reason)
+		return
+	}
+	applyEnvironment(&params, env)
+
+	logger.Info(fmt.Sprintf("Pipeline %d stops environment %s", params.PipelineID, env.Name), runLogAttrs(params)...)
+
+	var deploymentID int
+	if deploy, err := s.db.GetDeploymentByPipeline(dbCtx, params.PipelineID); err == nil && deploy != nil {
+		deploymentID = deploy.ID
+		s.db.UpdateDeploymentStatus(dbCtx, deploymentID, "deploying")
+	}
+
+	if env.Preview {
+		var previews []models.Preview
+		previews, err = s.environmentPreviews(dbCtx, project.ID, env.Name)
+		for _, preview := range previews {
+			err = errors.Join(err, s.teardownPreview(ctx, project, &preview, params.PipelineID))
+		}
+	} else {
+		_, err = s.deploymentExecutor.Teardown(ctx, environmentProject(project, env), params)
+	}
+
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to stop environment %s: %v", env.Name, err))
+		if deploymentID > 0 {
+			s.db.UpdateDeploymentStatus(dbCtx, deploymentID, "failed")
+		}
+		s.failPipeline(params.PipelineID, "Stop failed: "+err.Error())
+		return
+	}
+
+	if err := s.db.SetEnvironmentStopped(dbCtx, project.ID, env.Name); err != nil {
+		logger.Error(fmt.Sprintf("Failed to mark environment %s stopped: %v", env.Name, err))
+	}
+	if deploymentID > 0 {
+		s.db.UpdateDeploymentStatus(dbCtx, deploymentID, "stopped")
+	}
+	s.db.UpdatePipelineStatus(dbCtx, params.PipelineID, "success")
+}
+
+// environmentPreviews lists the previews deployed to an environment
+func (s *Server) environmentPreviews(ctx context.Context, projectID int, name string) ([]models.Preview, error) {
+	previews, err := s.db.GetPreviewsByProject(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	var matching []models.Preview
+	for _, preview := range previews {
+		if preview.Environment == name {
+			matching = append(matching, preview)
+		}
+	}
+	return matching, nil
+}
@@ -0,0 +1,299 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/events"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+)
+
+// streamPollInterval is how often the database is polled for new log lines
+const streamPollInterval = time.Second
+
+// subscribeStatus returns the status events of the bus matching, for a stream ending with a job or deployment
+// The database is still polled on a ticker, the events only end the stream as soon as the status changes.
+func (s *Server) subscribeStatus(match func(events.Event) bool) (<-chan struct{}, func()) {
+	changed := make(chan struct{}, 1)
+	if s.events == nil {
+		return changed, func() {}
+	}
+	eventsCh, unsubscribe := s.events.Subscribe()
+	go func() {
+		for event := range eventsCh {
+			if match(event) {
+				select {
+				case changed <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return changed, unsubscribe
+}
+
+// === Server-Sent Events Helpers ===
+
+// startSSE prepares the response for an event stream and returns its flusher
+func startSSE(w http.ResponseWriter) (http.Flusher, bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		respondError(w, http.StatusInternalServerError, "Streaming not supported")
+		return nil, false
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	return flusher, true
+}
+
+// writeSSE writes a single event with a JSON payload
+func writeSSE(w http.ResponseWriter, event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+	return err
+}
+
+// === Log Streaming Handlers ===
+
+// handleLogsStream handles /api/v1/projects/{projectId}/pipelines/{pipelineId}/jobs/{jobId}/logs/stream
+func (s *Server) handleLogsStream(w http.ResponseWriter, r *http.Request) {
+	// Extract IDs from path
+	projectID, err := parseIDFromPath(r.URL.Path, 3)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid project ID")
+		return
+	}
+
+	pipelineID, err := parseIDFromPath(r.URL.Path, 5)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid pipeline ID")
+		return
+	}
+
+	jobID, err := parseIDFromPath(r.URL.Path, 7)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid job ID")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.streamJobLogs(w, r, projectID, pipelineID, jobID)
+	default:
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// streamJobLogs tails the logs of a job as Server-Sent Events until the job finishes
+// Each line is sent as a "log" event, and a final "end" event carries the job status
+func (s *Server) streamJobLogs(w http.ResponseWriter, r *http.Request, projectID, pipelineID, jobID int) {
+	if s.db == nil {
+		respondError(w, http.StatusServiceUnavailable, "Database not available")
+		return
+	}
+
+	// Verify pipeline exists and belongs to project
+	pipeline, err := s.db.GetPipeline(r.Context(), pipelineID)
+	if err != nil || pipeline.ProjectID != projectID {
+		respondError(w, http.StatusNotFound, "Pipeline not found")
+		return
+	}
+
+	// Verify job exists and belongs to pipeline
+	job, err := s.db.GetJob(r.Context(), jobID)
+	if err != nil || job.PipelineID != pipelineID {
+		respondError(w, http.StatusNotFound, "Job not found")
+		return
+	}
+
+	flusher, ok := startSSE(w)
+	if !ok {
+		return
+	}
+
+	// Send the backlog first, then tail new lines
+	logs, err := s.db.GetLogsByJob(r.Context(), jobID)
+	if err != nil {
+		logger.Error("Failed to get logs: " + err.Error())
+		return
+	}
+
+	changed, unsubscribe := s.subscribeStatus(func(event events.Event) bool {
+		return event.Type == events.TypeJob && event.ID == jobID
+	})
+	defer unsubscribe()
+
+	lastID := 0
+	for _, line := range logs {
+		if err := writeSSE(w, "log", line); err != nil {
+			return
+		}
+		lastID = line.ID
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(streamPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		case <-changed:
+		}
+
+		// Read the status before the logs so no line written before completion is missed
+		job, err := s.db.GetJob(r.Context(), jobID)
+		if err != nil {
+			logger.Error("Failed to get job: " + err.Error())
+			return
+		}
+
+		newLogs, err := s.db.GetLogsAfter(r.Context(), jobID, lastID)
+		if err != nil {
+			logger.Error("Failed to get logs: " + err.Error())
+			return
+		}
+		for _, line := range newLogs {
+			if err := writeSSE(w, "log", line); err != nil {
+				return
+			}
+			lastID = line.ID
+		}
+
+		if job.Status != "pending" && job.Status != "manual" && job.Status != "running" {
+			writeSSE(w, "end", map[string]string{"status": job.Status})
+			flusher.Flush()
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// handleDeploymentLogsStream handles /api/v1/projects/{projectId}/pipelines/{pipelineId}/deployment/logs/stream
+func (s *Server) handleDeploymentLogsStream(w http.ResponseWriter, r *http.Request) {
+	projectID, err := parseIDFromPath(r.URL.Path, 3)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid project ID")
+		return
+	}
+
+	pipelineID, err := parseIDFromPath(r.URL.Path, 5)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid pipeline ID")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.streamDeploymentLogs(w, r, projectID, pipelineID)
+	default:
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// streamDeploymentLogs tails the deployment logs of a pipeline as Server-Sent Events until the deployment finishes
+// Lines are pushed by the deployment logger as they are written; the database is also polled so lines dropped for a slow client are still sent.
+func (s *Server) streamDeploymentLogs(w http.ResponseWriter, r *http.Request, projectID, pipelineID int) {
+	if s.db == nil {
+		respondError(w, http.StatusServiceUnavailable, "Database not available")
+		return
+	}
+
+	pipeline, err := s.db.GetPipeline(r.Context(), pipelineID)
+	if err != nil || pipeline.ProjectID != projectID {
+		respondError(w, http.StatusNotFound, "Pipeline not found")
+		return
+	}
+	if deployment, err := s.db.GetDeploymentByPipeline(r.Context(), pipelineID); err != nil || deployment == nil {
+		respondError(w, http.StatusNotFound, "Deployment not found")
+		return
+	}
+
+	// Subscribe before reading the backlog so no line falls between the two
+	var live <-chan models.DeploymentLog
+	if s.deploymentExecutor != nil {
+		ch, unsubscribe := s.deploymentExecutor.LogFeed().Subscribe(pipelineID)
+		defer unsubscribe()
+		live = ch
+	}
+
+	flusher, ok := startSSE(w)
+	if !ok {
+		return
+	}
+
+	sent := make(map[int]bool)
+	send := func(line models.DeploymentLog) bool {
+		if sent[line.ID] {
+			return true
+		}
+		sent[line.ID] = true
+		return writeSSE(w, "log", line) == nil
+	}
+	sendNew := func() bool {
+		logs, err := s.db.GetDeploymentLogs(r.Context(), pipelineID)
+		if err != nil {
+			logger.Error("Failed to get deployment logs: " + err.Error())
+			return false
+		}
+		for _, line := range logs {
+			if !send(line) {
+				return false
+			}
+		}
+		flusher.Flush()
+		return true
+	}
+	if !sendNew() {
+		return
+	}
+
+	changed, unsubscribe := s.subscribeStatus(func(event events.Event) bool {
+		return event.Type == events.TypeDeployment && event.PipelineID == pipelineID
+	})
+	defer unsubscribe()
+
+	ticker := time.NewTicker(streamPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case line := <-live:
+			if !send(line) {
+				return
+			}
+			flusher.Flush()
+			continue
+		case <-ticker.C:
+		case <-changed:
+		}
+
+		// Read the status before the logs so no line written before completion is missed
+		deployment, err := s.db.GetDeploymentByPipeline(r.Context(), pipelineID)
+		if err != nil || deployment == nil {
+			return
+		}
+		if !sendNew() {
+			return
+		}
+		if deployment.Status != "pending" && deployment.Status != "deploying" {
+			writeSSE(w, "end", map[string]string{"status": deployment.Status})
+			flusher.Flush()
+			return
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/executor"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+)
+
+func TestDeploymentLogsStream(t *testing.T) {
+	ctx := context.Background()
+	s, st := newTestServer()
+	s.deploymentExecutor = executor.NewDeploymentExecutor(st, nil)
+	ownerID := createTestUser(t, st, "owner@example.com")
+
+	project, err := st.CreateProject(ctx, &models.NewProject{OwnerID: ownerID, Name: "app", RepoURL: "https://example.com/app.git"})
+	if err != nil {
+		t.Fatalf("Expected no error creating project, got %v", err)
+	}
+	pipeline, _ := st.CreatePipeline(ctx, project.ID, "main", "abc1234")
+	path := strconv.Itoa(project.ID) + "/pipelines/" + strconv.Itoa(pipeline.ID) + "/deployment/logs/stream"
+
+	t.Run("NoDeployment", func(t *testing.T) {
+		if w := serveProject(s, http.MethodGet, path, ownerID); w.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404, got %d", w.Code)
+		}
+	})
+
+	t.Run("TailsUntilFinished", func(t *testing.T) {
+		deployment, _ := st.CreateDeployment(ctx, pipeline.ID, "")
+		st.UpdateDeploymentStatus(ctx, deployment.ID, "deploying")
+		st.CreateDeploymentLog(ctx, pipeline.ID, "Using Registry/SSH deployment flow")
+
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			if line, err := st.CreateDeploymentLog(ctx, pipeline.ID, "--- Health Check Passed ---"); err == nil {
+				s.deploymentExecutor.LogFeed().Publish(*line)
+			}
+			st.UpdateDeploymentStatus(ctx, deployment.ID, "success")
+		}()
+
+		w := serveProject(s, http.MethodGet, path, ownerID)
+		body := w.Body.String()
+		if strings.Count(body, "event: log") != 2 || !strings.Contains(body, "Health Check Passed") {
+			t.Errorf("Expected the backlog and the live line once each, got %q", body)
+		}
+		if !strings.Contains(body, "event: end") || !strings.Contains(body, `"status":"success"`) {
+			t.Errorf("Expected an end event with the deployment status, got %q", body)
+		}
+	})
+}
+
+func TestJobLogsStream(t *testing.T) {
+	ctx := context.Background()
+	s, st := newTestServer()
+	ownerID := createTestUser(t, st, "owner@example.com")
+
+	project, err := st.CreateProject(ctx, &models.NewProject{OwnerID: ownerID, Name: "app", RepoURL: "https://example.com/app.git"})
+	if err != nil {
+		t.Fatalf("Expected no error creating project, got %v", err)
+	}
+	pipeline, _ := st.CreatePipeline(ctx, project.ID, "main", "abc1234")
+	job, _ := st.CreateJob(ctx, pipeline.ID, "test", "test", "alpine")
+	st.UpdateJobStatus(ctx, job.ID, "running", nil)
+	path := strconv.Itoa(project.ID) + "/pipelines/" + strconv.Itoa(pipeline.ID) + "/jobs/" + strconv.Itoa(job.ID) + "/logs/stream"
+
+	// Lines flushed together share their timestamp, the stream must follow them by ID
+	at := time.Now()
+	st.CreateLogEntries(ctx, job.ID, []models.LogLine{{Content: "first", CreatedAt: at}})
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		st.CreateLogEntries(ctx, job.ID, []models.LogLine{{Content: "second", CreatedAt: at}, {Content: "third", CreatedAt: at}})
+		st.UpdateJobStatus(ctx, job.ID, "success", nil)
+	}()
+
+	w := serveProject(s, http.MethodGet, path, ownerID)
+	body := w.Body.String()
+	if strings.Count(body, "event: log") != 3 || !strings.Contains(body, "second") || !strings.Contains(body, "third") {
+		t.Errorf("Expected every line once, including the ones sharing a timestamp, got %q", body)
+	}
+	if !strings.Contains(body, "event: end") || !strings.Contains(body, `"status":"success"`) {
+		t.Errorf("Expected an end event with the job status, got %q", body)
+	}
+}
@@ -0,0 +1,192 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+)
+
+// routeTeams routes /api/v1/orgs/{orgId}/teams[/{teamId}[/members[/{userId}]]], parts being what follows /teams
+// The organization is already authorized: members read the teams, maintainers manage them.
+func (s *Server) routeTeams(w http.ResponseWriter, r *http.Request, organization *models.Organization, parts []string) {
+	if len(parts) == 0 {
+		s.handleTeams(w, r, organization)
+		return
+	}
+
+	teamID, err := strconv.Atoi(parts[0])
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid team ID")
+		return
+	}
+	team, err := s.db.GetTeam(r.Context(), teamID)
+	if err != nil || team.OrganizationID != organization.ID {
+		respondError(w, http.StatusNotFound, "Team not found")
+		return
+	}
+	// Owner teams give the owner role, so only owners change them
+	if r.Method != http.MethodGet && team.Role == RoleOwner && organization.Role != RoleOwner {
+		respondError(w, http.StatusForbidden, "Only owners can change an owner team")
+		return
+	}
+
+	switch {
+	case len(parts) == 1:
+		s.handleTeam(w, r, organization, team)
+	case len(parts) == 2 && parts[1] == "members":
+		s.handleTeamMembers(w, r, team)
+	case len(parts) == 3 && parts[1] == "members":
+		targetUserID, err := strconv.Atoi(parts[2])
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid user ID")
+			return
+		}
+		if r.Method != http.MethodDelete {
+			respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		if err := s.db.RemoveTeamMember(r.Context(), team.ID, targetUserID); err != nil {
+			respondError(w, http.StatusInternalServerError, "Failed to remove team member")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		respondError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+// teamRequest is the body creating or updating a team
+type teamRequest struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+// decodeTeamRequest reads and validates a team body, responding with an error when it is invalid
+// Only owners give the owner role to a team.
+func decodeTeamRequest(w http.ResponseWriter, r *http.Request, organization *models.Organization) (*teamRequest, bool) {
+	var req teamRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return nil, false
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		respondError(w, http.StatusBadRequest, "Team name is required")
+		return nil, false
+	}
+	if req.Role == "" {
+		req.Role = RoleViewer
+	}
+	if !validMemberRole(req.Role) && !(req.Role == RoleOwner && organization.Role == RoleOwner) {
+		respondError(w, http.StatusBadRequest, "role must be viewer, developer or maintainer")
+		return nil, false
+	}
+	return &req, true
+}
+
+// handleTeams lists and creates the teams of an organization
+func (s *Server) handleTeams(w http.ResponseWriter, r *http.Request, organization *models.Organization) {
+	switch r.Method {
+	case http.MethodGet:
+		teams, err := s.db.GetTeamsByOrganization(r.Context(), organization.ID)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "Failed to get teams")
+			return
+		}
+		if teams == nil {
+			teams = []models.Team{}
+		}
+		respondJSON(w, http.StatusOK, teams)
+	case http.MethodPost:
+		req, ok := decodeTeamRequest(w, r, organization)
+		if !ok {
+			return
+		}
+		team, err := s.db.CreateTeam(r.Context(), organization.ID, req.Name, req.Role)
+		if err != nil {
+			if err.Error() == "team already exists" {
+				respondError(w, http.StatusConflict, err.Error())
+				return
+			}
+			respondError(w, http.StatusInternalServerError, "Failed to create team")
+			return
+		}
+		logger.Info(fmt.Sprintf("Team %d (%s) created in organization %d", team.ID, team.Name, organization.ID))
+		respondJSON(w, http.StatusCreated, team)
+	default:
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// handleTeam reads, updates and deletes a team
+func (s *Server) handleTeam(w http.ResponseWriter, r *http.Request, organization *models.Organization, team *models.Team) {
+	switch r.Method {
+	case http.MethodGet:
+		respondJSON(w, http.StatusOK, team)
+	case http.MethodPut:
+		req, ok := decodeTeamRequest(w, r, organization)
+		if !ok {
+			return
+		}
+		updated, err := s.db.UpdateTeam(r.Context(), team.ID, req.Name, req.Role)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "Failed to update team")
+			return
+		}
+		respondJSON(w, http.StatusOK, updated)
+	case http.MethodDelete:
+		if err := s.db.DeleteTeam(r.Context(), team.ID); err != nil {
+			respondError(w, http.StatusInternalServerError, "Failed to delete team")
+			return
+		}
+		logger.Info(fmt.Sprintf("Team %d (%s) deleted from organization %d", team.ID, team.Name, organization.ID))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// handleTeamMembers lists and adds the members of a team
+func (s *Server) handleTeamMembers(w http.ResponseWriter, r *http.Request, team *models.Team) {
+	switch r.Method {
+	case http.MethodGet:
+		members, err := s.db.GetTeamMembers(r.Context(), team.ID)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "Failed to get team members")
+			return
+		}
+		if members == nil {
+			members = []models.TeamMember{}
+		}
+		respondJSON(w, http.StatusOK, members)
+	case http.MethodPost:
+		var req struct {
+			Email string `json:"email"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+		if req.Email == "" {
+			respondError(w, http.StatusBadRequest, "Email is required")
+			return
+		}
+		user, err := s.db.GetUserByEmail(r.Context(), req.Email)
+		if err != nil {
+			respondError(w, http.StatusNotFound, "User not found. They must sign in first.")
+			return
+		}
+		if err := s.db.AddTeamMember(r.Context(), team.ID, user.ID); err != nil {
+			respondError(w, http.StatusInternalServerError, "Failed to add team member")
+			return
+		}
+		respondJSON(w, http.StatusCreated, map[string]string{"message": "Member added"})
+	default:
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
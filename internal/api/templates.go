@@ -0,0 +1,358 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+)
+
+// maxTemplateImports bounds the repositories imported by a single request
+const maxTemplateImports = 100
+
+// handleTemplates lists the templates the user can use and creates new ones, /api/v1/templates
+func (s *Server) handleTemplates(w http.ResponseWriter, r *http.Request) {
+	if s.db == nil {
+		respondError(w, http.StatusServiceUnavailable, "Database not available")
+		return
+	}
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		templates, err := s.db.GetTemplatesForUser(r.Context(), userID)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if templates == nil {
+			templates = []models.ProjectTemplate{}
+		}
+		for i := range templates {
+			maskTemplateSecrets(&templates[i])
+		}
+		respondJSON(w, http.StatusOK, templates)
+	case http.MethodPost:
+		var template models.ProjectTemplate
+		if err := json.NewDecoder(r.Body).Decode(&template); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+		if msg := validateTemplate(&template); msg != "" {
+			respondError(w, http.StatusBadRequest, msg)
+			return
+		}
+		// Sharing a template with an organization needs the right to manage it
+		if template.OrganizationID != nil {
+			if _, ok := s.authorizeOrganization(w, r, strconv.Itoa(*template.OrganizationID), RoleMaintainer); !ok {
+				return
+			}
+		}
+		template.OwnerID = userID
+		if err := s.db.CreateTemplate(r.Context(), &template); err != nil {
+			logger.Error("Failed to create template: " + err.Error())
+			respondError(w, http.StatusInternalServerError, "Failed to create template")
+			return
+		}
+		logger.Info(fmt.Sprintf("Template %d (%s) created by user %d", template.ID, template.Name, userID))
+		maskTemplateSecrets(&template)
+		respondJSON(w, http.StatusCreated, template)
+	default:
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// routeTemplatesSubpath routes /api/v1/templates/{id}[/projects]
+func (s *Server) routeTemplatesSubpath(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/templates/"), "/")
+
+	switch {
+	case len(parts) == 1:
+		template, ok := s.authorizeTemplate(w, r, parts[0], r.Method != http.MethodGet)
+		if !ok {
+			return
+		}
+		s.handleTemplate(w, r, template)
+	case len(parts) == 2 && parts[1] == "projects":
+		if r.Method != http.MethodPost {
+			respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		template, ok := s.authorizeTemplate(w, r, parts[0], false)
+		if !ok {
+			return
+		}
+		s.createTemplateProjects(w, r, template)
+	default:
+		respondError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+// authorizeTemplate responds with an error unless the user of the request may use the template, or change it with manage
+// Owners can do anything with their templates, members of its organization use it and maintainers change it.
+// Templates of others are reported as not found.
+func (s *Server) authorizeTemplate(w http.ResponseWriter, r *http.Request, templateIDPart string, manage bool) (*models.ProjectTemplate, bool) {
+	if s.db == nil {
+		respondError(w, http.StatusServiceUnavailable, "Database not available")
+		return nil, false
+	}
+	templateID, err := strconv.Atoi(templateIDPart)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid template ID")
+		return nil, false
+	}
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return nil, false
+	}
+
+	template, err := s.db.GetTemplate(r.Context(), templateID)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Template not found")
+		return nil, false
+	}
+	if template.OwnerID == userID {
+		return template, true
+	}
+	if template.OrganizationID == nil {
+		respondError(w, http.StatusNotFound, "Template not found")
+		return nil, false
+	}
+	role, err := s.db.GetOrganizationMemberRole(r.Context(), *template.OrganizationID, userID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to check permissions")
+		return nil, false
+	}
+	if roleRanks[role] == 0 {
+		respondError(w, http.StatusNotFound, "Template not found")
+		return nil, false
+	}
+	if manage && roleRanks[role] < roleRanks[RoleMaintainer] {
+		respondError(w, http.StatusForbidden, "Your role ("+role+") does not allow this action")
+		return nil, false
+	}
+	return template, true
+}
+
+// handleTemplate reads, replaces and deletes a template
+func (s *Server) handleTemplate(w http.ResponseWriter, r *http.Request, template *models.ProjectTemplate) {
+	switch r.Method {
+	case http.MethodGet:
+		maskTemplateSecrets(template)
+		respondJSON(w, http.StatusOK, template)
+	case http.MethodPut:
+		var req models.ProjectTemplate
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+		if msg := validateTemplate(&req); msg != "" {
+			respondError(w, http.StatusBadRequest, msg)
+			return
+		}
+		if req.OrganizationID != nil && (template.OrganizationID == nil || *req.OrganizationID != *template.OrganizationID) {
+			if _, ok := s.authorizeOrganization(w, r, strconv.Itoa(*req.OrganizationID), RoleMaintainer); !ok {
+				return
+			}
+		}
+		keepTemplateSecrets(&req, template)
+		req.ID, req.OwnerID, req.CreatedAt = template.ID, template.OwnerID, template.CreatedAt
+		if err := s.db.UpdateTemplate(r.Context(), &req); err != nil {
+			logger.Error("Failed to update template: " + err.Error())
+			respondError(w, http.StatusInternalServerError, "Failed to update template")
+			return
+		}
+		maskTemplateSecrets(&req)
+		respondJSON(w, http.StatusOK, req)
+	case http.MethodDelete:
+		if err := s.db.DeleteTemplate(r.Context(), template.ID); err != nil {
+			respondError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		logger.Info(fmt.Sprintf("Template %d (%s) deleted", template.ID, template.Name))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// createTemplateProjects imports a batch of repositories of the user as projects created from a template
+// Every repository is imported even when others fail, the response listing the result of each.
+func (s *Server) createTemplateProjects(w http.ResponseWriter, r *http.Request, template *models.ProjectTemplate) {
+	var req struct {
+		Repositories []struct {
+			FullName string `json:"full_name"`
+			Name     string `json:"name"`
+		} `json:"repositories"`
+		// OrganizationID is the organization the projects are created in, nil for personal projects
+		OrganizationID *int `json:"organization_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if len(req.Repositories) == 0 {
+		respondError(w, http.StatusBadRequest, "repositories is required")
+		return
+	}
+	if len(req.Repositories) > maxTemplateImports {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("At most %d repositories can be imported at once", maxTemplateImports))
+		return
+	}
+	for _, repo := range req.Repositories {
+		if repo.FullName == "" {
+			respondError(w, http.StatusBadRequest, "full_name is required for every repository")
+			return
+		}
+	}
+	if req.OrganizationID != nil {
+		if _, ok := s.authorizeOrganization(w, r, strconv.Itoa(*req.OrganizationID), RoleMaintainer); !ok {
+			return
+		}
+	}
+	userID, provider, token, ok := s.userRepoToken(w, r)
+	if !ok {
+		return
+	}
+
+	results := make([]*importResult, 0, len(req.Repositories))
+	for _, repo := range req.Repositories {
+		result := s.importRepository(r.Context(), userID, provider, token, repo.FullName, repo.Name, 0, template)
+		if result.Project != nil && req.OrganizationID != nil {
+			if err := s.db.SetProjectOrganization(r.Context(), result.Project.ID, req.OrganizationID); err != nil {
+				result.TemplateErrors = append(result.TemplateErrors, "organization: "+err.Error())
+			} else {
+				result.Project.OrganizationID = req.OrganizationID
+			}
+		}
+		results = append(results, result)
+	}
+	respondJSON(w, http.StatusOK, results)
+}
+
+// applyTemplate creates the variables and environments of a template on a new project and commits its pipeline file
+// It returns whether the file was committed and what could not be applied.
+func (s *Server) applyTemplate(ctx context.Context, project *models.Project, template *models.ProjectTemplate, provider, token string, repo remoteRepository) (bool, []string) {
+	var errs []string
+	for _, v := range template.Variables {
+		v.ID, v.ProjectID = 0, project.ID
+		if err := s.db.CreateVariable(ctx, &v); err != nil {
+			errs = append(errs, fmt.Sprintf("variable %s: %v", v.Key, err))
+		}
+	}
+	for _, env := range template.Environments {
+		env.ID, env.ProjectID = 0, project.ID
+		if err := s.db.CreateEnvironment(ctx, &env); err != nil {
+			errs = append(errs, fmt.Sprintf("environment %s: %v", env.Name, err))
+		}
+	}
+
+	if template.PipelineContent == "" {
+		return false, errs
+	}
+	message := "Add CI pipeline from template " + template.Name
+	if err := commitRepoFile(provider, token, repo, project.PipelineFilename, template.PipelineContent, message); err != nil {
+		logger.Error(fmt.Sprintf("Failed to commit the pipeline file of template %d to %s: %v", template.ID, repo.FullName, err))
+		return false, append(errs, "pipeline file: "+err.Error())
+	}
+	logger.Info(fmt.Sprintf("Pipeline file of template %d committed to %s", template.ID, repo.FullName))
+	return true, errs
+}
+
+// commitRepoFile creates a file on the default branch of a repository through the API of its host
+func commitRepoFile(provider, token string, repo remoteRepository, path, content, message string) error {
+	encoded := base64.StdEncoding.EncodeToString([]byte(content))
+	repoName, err := repoPath(provider, repo.FullName)
+	if err != nil {
+		return err
+	}
+	if provider == "github" {
+		body := map[string]string{"message": message, "content": encoded}
+		if repo.DefaultBranch != "" {
+			body["branch"] = repo.DefaultBranch
+		}
+		return repoAPI(http.MethodPut, gitHubAPIURL+"/repos/"+repoName+"/contents/"+path, provider, token, body, nil)
+	}
+
+	branch := repo.DefaultBranch
+	if branch == "" {
+		branch = "main"
+	}
+	body := map[string]string{"branch": branch, "content": encoded, "encoding": "base64", "commit_message": message}
+	return repoAPI(http.MethodPost, gitLabBaseURL()+"/api/v4/projects/"+repoName+"/repository/files/"+url.PathEscape(path),
+		provider, token, body, nil)
+}
+
+// validateTemplate returns why a template is invalid, empty when valid
+func validateTemplate(t *models.ProjectTemplate) string {
+	if strings.TrimSpace(t.Name) == "" {
+		return "Template name is required"
+	}
+	if t.PipelineFilename != "" && !filepath.IsLocal(t.PipelineFilename) {
+		return "pipeline_filename must be a relative path inside the repository"
+	}
+	for _, v := range t.Variables {
+		if v.Key == "" {
+			return "Every variable needs a key"
+		}
+		if v.EnvironmentScope != "" && v.EnvironmentScope != models.AllEnvironments && !validEnvironmentName(v.EnvironmentScope) {
+			return "environment_scope of variable " + v.Key + " is invalid"
+		}
+	}
+	names := make(map[string]bool)
+	for i := range t.Environments {
+		env := &t.Environments[i]
+		if !validEnvironmentName(env.Name) {
+			return "Environment name is required and may not contain / or be *"
+		}
+		if names[env.Name] {
+			return "Environment " + env.Name + " is defined twice"
+		}
+		names[env.Name] = true
+		if env.SSHPrivateKey != "" {
+			return "Template environments may not hold an SSH key, they use the key of their project"
+		}
+		if msg := validateStrategy(env); msg != "" {
+			return msg
+		}
+	}
+	return ""
+}
+
+// maskTemplateSecrets hides the values of the secret variables of a template, they are only ever written
+func maskTemplateSecrets(t *models.ProjectTemplate) {
+	for i := range t.Variables {
+		if t.Variables[i].IsSecret {
+			t.Variables[i].Value = "*****"
+		}
+	}
+}
+
+// keepTemplateSecrets gives the secret variables of an update sent back masked their stored value
+func keepTemplateSecrets(update, stored *models.ProjectTemplate) {
+	for i := range update.Variables {
+		v := &update.Variables[i]
+		if !v.IsSecret || v.Value != "*****" {
+			continue
+		}
+		for _, old := range stored.Variables {
+			if old.IsSecret && old.Key == v.Key && old.EnvironmentScope == v.EnvironmentScope {
+				v.Value = old.Value
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+)
+
+// serveTemplate sends a request with an optional JSON body under /api/v1/templates as the given user
+func serveTemplate(s *Server, method, path, body string, userID int) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, "/api/v1/templates"+path, strings.NewReader(body))
+	r = r.WithContext(context.WithValue(r.Context(), "userID", userID))
+	w := httptest.NewRecorder()
+	if path == "" {
+		s.handleTemplates(w, r)
+	} else {
+		s.routeTemplatesSubpath(w, r)
+	}
+	return w
+}
+
+func TestTemplates(t *testing.T) {
+	ctx := context.Background()
+	s, st := newTestServer()
+	ownerID := createTestUser(t, st, "owner@example.com")
+	viewerID := createTestUser(t, st, "viewer@example.com")
+	strangerID := createTestUser(t, st, "stranger@example.com")
+
+	org, _ := st.CreateOrganization(ctx, "course", ownerID)
+	st.AddOrganizationMember(ctx, org.ID, viewerID, RoleViewer)
+
+	body := `{"name": "go-course", "organization_id": ` + strconv.Itoa(org.ID) + `,
+		"variables": [{"key": "TOKEN", "value": "hunter2", "is_secret": true}, {"key": "GO_VERSION", "value": "1.22"}],
+		"environments": [{"name": "staging"}]}`
+	w := serveTemplate(s, http.MethodPost, "", body, ownerID)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var created models.ProjectTemplate
+	json.NewDecoder(w.Body).Decode(&created)
+	path := "/" + strconv.Itoa(created.ID)
+
+	t.Run("InvalidRejected", func(t *testing.T) {
+		invalid := []string{
+			`{"name": ""}`,
+			`{"name": "x", "pipeline_filename": "../pipeline.yml"}`,
+			`{"name": "x", "environments": [{"name": "prod"}, {"name": "prod"}]}`,
+			`{"name": "x", "environments": [{"name": "prod", "ssh_private_key": "key"}]}`,
+		}
+		for _, body := range invalid {
+			if w := serveTemplate(s, http.MethodPost, "", body, ownerID); w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status 400 for %s, got %d", body, w.Code)
+			}
+		}
+	})
+
+	t.Run("SecretsMasked", func(t *testing.T) {
+		w := serveTemplate(s, http.MethodGet, path, "", viewerID)
+		var template models.ProjectTemplate
+		json.NewDecoder(w.Body).Decode(&template)
+		if w.Code != http.StatusOK || len(template.Variables) != 2 || template.Variables[0].Value != "*****" {
+			t.Errorf("Expected the organization member to read the template with its secret masked, got %d %+v", w.Code, template.Variables)
+		}
+	})
+
+	t.Run("HiddenFromStrangers", func(t *testing.T) {
+		if w := serveTemplate(s, http.MethodGet, path, "", strangerID); w.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404, got %d", w.Code)
+		}
+		w := serveTemplate(s, http.MethodGet, "", "", strangerID)
+		var templates []models.ProjectTemplate
+		json.NewDecoder(w.Body).Decode(&templates)
+		if len(templates) != 0 {
+			t.Errorf("Expected no templates listed, got %d", len(templates))
+		}
+	})
+
+	t.Run("ViewerCannotChange", func(t *testing.T) {
+		if w := serveTemplate(s, http.MethodDelete, path, "", viewerID); w.Code != http.StatusForbidden {
+			t.Errorf("Expected status 403, got %d", w.Code)
+		}
+	})
+
+	t.Run("UpdateKeepsMaskedSecrets", func(t *testing.T) {
+		update := `{"name": "go-course", "organization_id": ` + strconv.Itoa(org.ID) + `,
+			"variables": [{"key": "TOKEN", "value": "*****", "is_secret": true}]}`
+		if w := serveTemplate(s, http.MethodPut, path, update, ownerID); w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		template, _ := st.GetTemplate(ctx, created.ID)
+		if len(template.Variables) != 1 || template.Variables[0].Value != "hunter2" {
+			t.Errorf("Expected the secret to keep its value, got %+v", template.Variables)
+		}
+	})
+
+	t.Run("Apply", func(t *testing.T) {
+		template, _ := st.GetTemplate(ctx, created.ID)
+		template.Environments = []models.Environment{{Name: "staging"}}
+		project, _ := st.CreateProject(ctx, &models.NewProject{OwnerID: ownerID, Name: "student-1", RepoURL: "https://example.com/student-1.git"})
+
+		committed, errs := s.applyTemplate(ctx, project, template, "github", "token", remoteRepository{FullName: "course/student-1"})
+		if committed || len(errs) != 0 {
+			t.Fatalf("Expected no pipeline committed and no errors, got %v %v", committed, errs)
+		}
+		variables, _ := st.GetVariablesByProject(ctx, project.ID)
+		environments, _ := st.GetEnvironmentsByProject(ctx, project.ID)
+		if len(variables) != 1 || variables[0].Value != "hunter2" || len(environments) != 1 {
+			t.Errorf("Expected the variable and environment of the template on the project, got %+v %+v", variables, environments)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		if w := serveTemplate(s, http.MethodDelete, path, "", ownerID); w.Code != http.StatusNoContent {
+			t.Errorf("Expected status 204, got %d", w.Code)
+		}
+		if _, err := st.GetTemplate(ctx, created.ID); err == nil {
+			t.Error("Expected the template to be deleted")
+		}
+	})
+}
@@ -0,0 +1,184 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+)
+
+// apiTokenPrefix tells personal access tokens apart from JWTs in the Authorization header
+const apiTokenPrefix = "cicd_pat_"
+
+// API token scopes: read only allows safe methods, write allows every request of the user
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+// authenticateAPIToken resolves the user of a personal access token, checking its scopes allow the request
+func (s *Server) authenticateAPIToken(r *http.Request, token string) (context.Context, int, string) {
+	if s.db == nil {
+		return nil, http.StatusServiceUnavailable, "Database not available"
+	}
+	t, err := s.db.GetAPITokenByHash(r.Context(), hashRunnerToken(token))
+	if err != nil {
+		return nil, http.StatusUnauthorized, "Invalid token"
+	}
+	if !tokenScopeAllows(t.Scopes, r.Method) {
+		return nil, http.StatusForbidden, "Token scopes do not allow this request"
+	}
+
+	ctx := context.WithValue(r.Context(), "userID", t.UserID)
+	ctx = context.WithValue(ctx, "apiTokenID", t.ID)
+	return ctx, 0, ""
+}
+
+// tokenScopeAllows reports whether scopes allow a request method
+func tokenScopeAllows(scopes []string, method string) bool {
+	for _, scope := range scopes {
+		if scope == ScopeWrite {
+			return true
+		}
+		if scope == ScopeRead && (method == http.MethodGet || method == http.MethodHead) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleAPITokens lists and creates the personal access tokens of the user
+func (s *Server) handleAPITokens(w http.ResponseWriter, r *http.Request) {
+	if s.db == nil {
+		respondError(w, http.StatusServiceUnavailable, "Database not available")
+		return
+	}
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.listAPITokens(w, r, userID)
+	case http.MethodPost:
+		s.createAPIToken(w, r, userID)
+	default:
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func (s *Server) listAPITokens(w http.ResponseWriter, r *http.Request, userID int) {
+	tokens, err := s.db.GetAPITokensByUser(r.Context(), userID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if tokens == nil {
+		tokens = []models.APIToken{}
+	}
+	respondJSON(w, http.StatusOK, tokens)
+}
+
+func (s *Server) createAPIToken(w http.ResponseWriter, r *http.Request, userID int) {
+	// A leaked token must not be able to mint new ones
+	if r.Context().Value("apiTokenID") != nil {
+		respondError(w, http.StatusForbidden, "API tokens cannot create API tokens")
+		return
+	}
+
+	var req struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		respondError(w, http.StatusBadRequest, "Token name is required")
+		return
+	}
+	if len(req.Scopes) == 0 {
+		req.Scopes = []string{ScopeRead}
+	}
+	for _, scope := range req.Scopes {
+		if scope != ScopeRead && scope != ScopeWrite {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("Unknown scope: %s", scope))
+			return
+		}
+	}
+	if req.ExpiresInDays < 0 {
+		respondError(w, http.StatusBadRequest, "expires_in_days must be positive")
+		return
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to generate token")
+		return
+	}
+	token := apiTokenPrefix + hex.EncodeToString(secret)
+
+	t := &models.APIToken{UserID: userID, Name: req.Name, Scopes: req.Scopes}
+	if req.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		t.ExpiresAt = &expiresAt
+	}
+	if err := s.db.CreateAPIToken(r.Context(), t, hashRunnerToken(token)); err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	logger.Info(fmt.Sprintf("API token %d (%s) created for user %d", t.ID, t.Name, userID))
+
+	// The token is only ever returned here
+	respondJSON(w, http.StatusCreated, map[string]interface{}{
+		"id":         t.ID,
+		"name":       t.Name,
+		"scopes":     t.Scopes,
+		"expires_at": t.ExpiresAt,
+		"token":      token,
+	})
+}
+
+// handleAPIToken revokes a personal access token, DELETE /api/v1/user/tokens/{id}
+func (s *Server) handleAPIToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if s.db == nil {
+		respondError(w, http.StatusServiceUnavailable, "Database not available")
+		return
+	}
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	tokenID, err := parseIDFromPath(r.URL.Path, 4)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid token ID")
+		return
+	}
+
+	if err := s.db.DeleteAPIToken(r.Context(), userID, tokenID); err != nil {
+		if err.Error() == "API token not found" {
+			respondError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+)
+
+func TestAPITokens(t *testing.T) {
+	ctx := context.Background()
+	s, st := newTestServer()
+	userID := createTestUser(t, st, "user@example.com")
+	otherID := createTestUser(t, st, "other@example.com")
+
+	// asUser sends a request under /api/v1/user/tokens as a user signed in with a JWT
+	asUser := func(method, path, body string, userID int) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/api/v1/user/tokens"+path, strings.NewReader(body))
+		r = r.WithContext(context.WithValue(r.Context(), "userID", userID))
+		w := httptest.NewRecorder()
+		if path == "" {
+			s.handleAPITokens(w, r)
+		} else {
+			s.handleAPIToken(w, r)
+		}
+		return w
+	}
+	// withToken sends a request to the token list through the authentication middleware
+	withToken := func(method, token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/api/v1/user/tokens", strings.NewReader(`{"name": "minted"}`))
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		s.AuthMiddleware(s.handleAPITokens)(w, r)
+		return w
+	}
+	create := func(body string) (int, string) {
+		t.Helper()
+		w := asUser(http.MethodPost, "", body, userID)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+		}
+		var got struct {
+			ID    int    `json:"id"`
+			Token string `json:"token"`
+		}
+		json.NewDecoder(w.Body).Decode(&got)
+		if !strings.HasPrefix(got.Token, apiTokenPrefix) {
+			t.Fatalf("Expected a token starting with %s, got %q", apiTokenPrefix, got.Token)
+		}
+		return got.ID, got.Token
+	}
+
+	t.Run("InvalidRequests", func(t *testing.T) {
+		for _, body := range []string{`{"name": " "}`, `{"name": "ci", "scopes": ["admin"]}`, `{"name": "ci", "expires_in_days": -1}`, `not json`} {
+			if w := asUser(http.MethodPost, "", body, userID); w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status 400 for %s, got %d", body, w.Code)
+			}
+		}
+	})
+
+	readID, readToken := create(`{"name": "dashboard"}`)
+	_, writeToken := create(`{"name": "deploy script", "scopes": ["write"], "expires_in_days": 30}`)
+
+	t.Run("ListHidesSecrets", func(t *testing.T) {
+		w := asUser(http.MethodGet, "", "", userID)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", w.Code)
+		}
+		if strings.Contains(w.Body.String(), readToken) || strings.Contains(w.Body.String(), `"token"`) {
+			t.Errorf("Expected no token in the list, got %s", w.Body.String())
+		}
+		var tokens []models.APIToken
+		json.NewDecoder(w.Body).Decode(&tokens)
+		if len(tokens) != 2 || tokens[0].Scopes[0] != ScopeRead || tokens[1].ExpiresAt == nil {
+			t.Errorf("Expected a read token then an expiring token, got %+v", tokens)
+		}
+		if w := asUser(http.MethodGet, "", "", otherID); w.Body.String() != "[]\n" {
+			t.Errorf("Expected no token for another user, got %s", w.Body.String())
+		}
+	})
+
+	t.Run("ReadScope", func(t *testing.T) {
+		if w := withToken(http.MethodGet, readToken); w.Code != http.StatusOK {
+			t.Errorf("Expected status 200 for a read, got %d", w.Code)
+		}
+		if w := withToken(http.MethodPost, readToken); w.Code != http.StatusForbidden {
+			t.Errorf("Expected status 403 for a write, got %d", w.Code)
+		}
+	})
+
+	t.Run("TokensCannotMintTokens", func(t *testing.T) {
+		if w := withToken(http.MethodPost, writeToken); w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "cannot create") {
+			t.Errorf("Expected status 403, got %d: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("InvalidToken", func(t *testing.T) {
+		if w := withToken(http.MethodGet, apiTokenPrefix+strings.Repeat("0", 64)); w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status 401, got %d", w.Code)
+		}
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		expiresAt := time.Now().Add(-time.Minute)
+		token := apiTokenPrefix + strings.Repeat("1", 64)
+		st.CreateAPIToken(ctx, &models.APIToken{UserID: userID, Name: "old", Scopes: []string{ScopeRead}, ExpiresAt: &expiresAt}, hashRunnerToken(token))
+		if w := withToken(http.MethodGet, token); w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status 401, got %d", w.Code)
+		}
+	})
+
+	t.Run("Revoke", func(t *testing.T) {
+		path := "/" + strconv.Itoa(readID)
+		if w := asUser(http.MethodDelete, path, "", otherID); w.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404 for the token of another user, got %d", w.Code)
+		}
+		if w := asUser(http.MethodDelete, path, "", userID); w.Code != http.StatusNoContent {
+			t.Fatalf("Expected status 204, got %d", w.Code)
+		}
+		if w := withToken(http.MethodGet, readToken); w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status 401 once revoked, got %d", w.Code)
+		}
+	})
+}
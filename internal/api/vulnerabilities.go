@@ -0,0 +1,47 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+)
+
+// handleVulnerabilities handles GET /api/v1/projects/{id}/pipelines/{pipelineId}/vulnerabilities
+// It lists the findings of the security-scan jobs of the pipeline.
+func (s *Server) handleVulnerabilities(w http.ResponseWriter, r *http.Request) {
+	projectID, err := parseIDFromPath(r.URL.Path, 3)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid project ID")
+		return
+	}
+	pipelineID, err := parseIDFromPath(r.URL.Path, 5)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid pipeline ID")
+		return
+	}
+	if r.Method != http.MethodGet {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if s.db == nil {
+		respondError(w, http.StatusServiceUnavailable, "Database not available")
+		return
+	}
+
+	pipeline, err := s.db.GetPipeline(r.Context(), pipelineID)
+	if err != nil || pipeline.ProjectID != projectID {
+		respondError(w, http.StatusNotFound, "Pipeline not found")
+		return
+	}
+	vulns, err := s.db.GetVulnerabilitiesByPipeline(r.Context(), pipelineID)
+	if err != nil {
+		logger.Error("Failed to get vulnerabilities: " + err.Error())
+		respondError(w, http.StatusInternalServerError, "Failed to get vulnerabilities")
+		return
+	}
+	if vulns == nil {
+		vulns = []models.Vulnerability{}
+	}
+	respondJSON(w, http.StatusOK, vulns)
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+)
+
+func TestVulnerabilities(t *testing.T) {
+	ctx := context.Background()
+	s, st := newTestServer()
+	ownerID := createTestUser(t, st, "owner@example.com")
+
+	project, err := st.CreateProject(ctx, &models.NewProject{OwnerID: ownerID, Name: "app", RepoURL: "https://example.com/app.git"})
+	if err != nil {
+		t.Fatalf("Expected no error creating project, got %v", err)
+	}
+	other, _ := st.CreateProject(ctx, &models.NewProject{OwnerID: ownerID, Name: "other", RepoURL: "https://example.com/other.git"})
+	pipeline, _ := st.CreatePipeline(ctx, project.ID, "main", "abc123")
+	job, _ := st.CreateJob(ctx, pipeline.ID, "scan", "test", "aquasec/trivy:latest")
+	st.CreateVulnerabilities(ctx, job.ID, []models.Vulnerability{
+		{Target: "go.sum", VulnerabilityID: "CVE-2024-0001", PkgName: "golang.org/x/net", InstalledVersion: "0.1.0", FixedVersion: "0.2.0", Severity: "HIGH"},
+	})
+	path := strconv.Itoa(project.ID) + "/pipelines/" + strconv.Itoa(pipeline.ID) + "/vulnerabilities"
+
+	t.Run("List", func(t *testing.T) {
+		w := serveProject(s, http.MethodGet, path, ownerID)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", w.Code)
+		}
+		var got []models.Vulnerability
+		if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+			t.Fatalf("Expected vulnerabilities, got %v", err)
+		}
+		if len(got) != 1 || got[0].JobName != "scan" || got[0].VulnerabilityID != "CVE-2024-0001" {
+			t.Errorf("Expected the finding of the scan job, got %+v", got)
+		}
+	})
+
+	t.Run("OtherProject", func(t *testing.T) {
+		otherPath := strconv.Itoa(other.ID) + "/pipelines/" + strconv.Itoa(pipeline.ID) + "/vulnerabilities"
+		if w := serveProject(s, http.MethodGet, otherPath, ownerID); w.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404, got %d", w.Code)
+		}
+	})
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+)
+
+// pipelineTimeoutError is the cancellation cause of the runs stopped by the watchdog, its message the failure reason
+type pipelineTimeoutError struct {
+	timeout time.Duration
+}
+
+func (e *pipelineTimeoutError) Error() string {
+	return fmt.Sprintf("Pipeline timed out after running for %s", e.timeout)
+}
+
+// runWatchdog stops every interval the pipelines running for longer than their timeout
+func (s *Server) runWatchdog(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.stopStuckPipelines()
+	}
+}
+
+// projectPipelineTimeout returns how long the pipelines of a project may run, 0 for no limit
+func (s *Server) projectPipelineTimeout(project *models.Project) time.Duration {
+	if project != nil && project.PipelineTimeoutSeconds > 0 {
+		return time.Duration(project.PipelineTimeoutSeconds) * time.Second
+	}
+	return s.pipelineTimeout
+}
+
+// stopStuckPipelines runs a single watchdog pass
+// Runs of this server are cancelled, their worker records the timeout once the containers are stopped and frees its slot.
+// Pipelines running nowhere anymore are failed directly.
+func (s *Server) stopStuckPipelines() {
+	if s.db == nil {
+		return
+	}
+	pipelines, err := s.db.GetUnfinishedPipelines(s.ctx)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("Watchdog: failed to get unfinished pipelines: %v", err))
+		return
+	}
+
+	timeouts := make(map[int]time.Duration)
+	for _, p := range pipelines {
+		if p.Status != "running" || p.StartedAt == nil {
+			continue
+		}
+		timeout, ok := timeouts[p.ProjectID]
+		if !ok {
+			project, _ := s.db.GetProject(s.ctx, p.ProjectID)
+			timeout = s.projectPipelineTimeout(project)
+			timeouts[p.ProjectID] = timeout
+		}
+		if timeout <= 0 || time.Since(*p.StartedAt) < timeout {
+			continue
+		}
+
+		logger.Warn(fmt.Sprintf("Watchdog: pipeline %d has been running for more than %s, stopping it", p.ID, timeout))
+		cause := &pipelineTimeoutError{timeout: timeout}
+		if !s.cancelRunCause(p.ID, cause) {
+			s.queue.Remove(p.ID)
+			s.markPipelineTimedOut(p.ID, cause)
+		}
+	}
+}
+
+// markPipelineTimedOut fails a pipeline stopped by the watchdog, with its running jobs and pending deployment
+func (s *Server) markPipelineTimedOut(pipelineID int, cause *pipelineTimeoutError) {
+	logger.Info(fmt.Sprintf("Pipeline %d timed out", pipelineID))
+	if s.db == nil || pipelineID <= 0 {
+		return
+	}
+	// Not the context of the run, which is cancelled by now
+	ctx := context.Background()
+
+	if err := s.db.FailRunningJobs(ctx, pipelineID); err != nil {
+		logger.Error(fmt.Sprintf("Failed to fail jobs of pipeline %d: %v", pipelineID, err))
+	}
+	if err := s.db.CancelUnfinishedJobs(ctx, pipelineID); err != nil {
+		logger.Error(fmt.Sprintf("Failed to cancel jobs of pipeline %d: %v", pipelineID, err))
+	}
+	if deploy, err := s.db.GetDeploymentByPipeline(ctx, pipelineID); err == nil && deploy != nil && deploy.Status == "pending" {
+		s.db.UpdateDeploymentStatus(ctx, deploy.ID, "cancelled")
+	}
+	s.failPipeline(pipelineID, cause.Error())
+}
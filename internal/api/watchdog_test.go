@@ -0,0 +1,77 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/queue"
+)
+
+func TestWatchdog(t *testing.T) {
+	ctx := context.Background()
+	s, st := newTestServer()
+	s.ctx = ctx
+	s.queue = queue.New(1, 1)
+	s.runs = make(map[int]*trackedRun)
+	s.pipelineTimeout = time.Nanosecond
+	ownerID := createTestUser(t, st, "owner@example.com")
+
+	project, err := st.CreateProject(ctx, &models.NewProject{OwnerID: ownerID, Name: "app", RepoURL: "https://example.com/app.git"})
+	if err != nil {
+		t.Fatalf("Expected no error creating project, got %v", err)
+	}
+	patient, err := st.CreateProject(ctx, &models.NewProject{OwnerID: ownerID, Name: "slow", RepoURL: "https://example.com/slow.git", PipelineTimeoutSeconds: 3600})
+	if err != nil {
+		t.Fatalf("Expected no error creating project, got %v", err)
+	}
+
+	running := func(projectID int) *models.Pipeline {
+		p, _ := st.CreatePipeline(ctx, projectID, "main", "0123456789abcdef")
+		st.UpdatePipelineStatus(ctx, p.ID, "running")
+		return p
+	}
+	orphan := running(project.ID)
+	local := running(project.ID)
+	slow := running(patient.ID)
+	queued, _ := st.CreatePipeline(ctx, project.ID, "main", "0123456789abcdef")
+	st.UpdatePipelineStatus(ctx, queued.ID, "queued")
+
+	runCtx, done := s.trackRun(local.ID)
+	defer done()
+	time.Sleep(time.Millisecond)
+	s.stopStuckPipelines()
+
+	t.Run("OrphanFailed", func(t *testing.T) {
+		p, _ := st.GetPipeline(ctx, orphan.ID)
+		if p.Status != "failed" || p.FailureReason == "" {
+			t.Errorf("Expected the pipeline to fail with a reason, got %s (%q)", p.Status, p.FailureReason)
+		}
+	})
+
+	t.Run("LocalRunCancelled", func(t *testing.T) {
+		var timeout *pipelineTimeoutError
+		if !errors.As(context.Cause(runCtx), &timeout) {
+			t.Fatalf("Expected the run to be cancelled by a timeout, got %v", context.Cause(runCtx))
+		}
+		s.markRunInterrupted(runCtx, local.ID)
+		p, _ := st.GetPipeline(ctx, local.ID)
+		if p.Status != "failed" || p.FailureReason != timeout.Error() {
+			t.Errorf("Expected the pipeline to fail with %q, got %s (%q)", timeout.Error(), p.Status, p.FailureReason)
+		}
+	})
+
+	t.Run("ProjectTimeout", func(t *testing.T) {
+		if p, _ := st.GetPipeline(ctx, slow.ID); p.Status != "running" {
+			t.Errorf("Expected the pipeline within its project timeout to keep running, got %s", p.Status)
+		}
+	})
+
+	t.Run("QueuedUntouched", func(t *testing.T) {
+		if p, _ := st.GetPipeline(ctx, queued.ID); p.Status != "queued" {
+			t.Errorf("Expected the queued pipeline to stay queued, got %s", p.Status)
+		}
+	})
+}
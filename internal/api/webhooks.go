@@ -0,0 +1,108 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/notify"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+)
+
+// handleWebhooks handles GET and POST /api/v1/projects/{id}/webhooks
+func (s *Server) handleWebhooks(w http.ResponseWriter, r *http.Request) {
+	projectID, err := parseIDFromPath(r.URL.Path, 3)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid project ID")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.listWebhooks(w, r, projectID)
+	case http.MethodPost:
+		s.createWebhook(w, r, projectID)
+	default:
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// handleWebhook handles DELETE /api/v1/projects/{id}/webhooks/{webhookId}
+func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	projectID, err := parseIDFromPath(r.URL.Path, 3)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid project ID")
+		return
+	}
+	webhookID, err := parseIDFromPath(r.URL.Path, 5)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid webhook ID")
+		return
+	}
+	if r.Method != http.MethodDelete {
+		respondError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if err := s.db.DeleteWebhook(r.Context(), projectID, webhookID); err != nil {
+		if err.Error() == "webhook not found" {
+			respondError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) listWebhooks(w http.ResponseWriter, r *http.Request, projectID int) {
+	webhooks, err := s.db.GetWebhooksByProject(r.Context(), projectID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get webhooks")
+		return
+	}
+	if webhooks == nil {
+		webhooks = []models.Webhook{}
+	}
+	for i := range webhooks {
+		if webhooks[i].Secret != "" {
+			webhooks[i].Secret = "*****"
+		}
+	}
+	respondJSON(w, http.StatusOK, webhooks)
+}
+
+func (s *Server) createWebhook(w http.ResponseWriter, r *http.Request, projectID int) {
+	var webhook models.Webhook
+	if err := json.NewDecoder(r.Body).Decode(&webhook); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if u, err := url.Parse(webhook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		respondError(w, http.StatusBadRequest, "url must be an http or https URL")
+		return
+	}
+	for _, event := range webhook.Events {
+		if !notify.ValidWebhookEvent(event) {
+			respondError(w, http.StatusBadRequest, "Unknown event: "+event)
+			return
+		}
+	}
+	if webhook.Events == nil {
+		webhook.Events = []string{}
+	}
+
+	webhook.ProjectID = projectID
+	if err := s.db.CreateWebhook(r.Context(), &webhook); err != nil {
+		logger.Error("Failed to create webhook: " + err.Error())
+		respondError(w, http.StatusInternalServerError, "Failed to create webhook")
+		return
+	}
+
+	if webhook.Secret != "" {
+		webhook.Secret = "*****"
+	}
+	respondJSON(w, http.StatusCreated, webhook)
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+)
+
+const (
+	// wsWriteTimeout bounds the time spent writing a single message
+	wsWriteTimeout = 10 * time.Second
+	// wsPingInterval keeps idle connections alive through proxies
+	wsPingInterval = 30 * time.Second
+)
+
+var upgrader = websocket.Upgrader{
+	// CORS is already open to every origin for the REST API
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// handleWebSocket handles /api/v1/ws
+// It pushes pipeline, job and deployment status events for the projects the user can access.
+// Browsers cannot set headers on WebSocket requests, so the JWT may be passed as ?token=...
+// An optional ?project_id=... restricts the stream to a single project.
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	tokenString := r.URL.Query().Get("token")
+	if authHeader := r.Header.Get("Authorization"); strings.HasPrefix(authHeader, "Bearer ") {
+		tokenString = strings.TrimPrefix(authHeader, "Bearer ")
+	}
+	claims, err := parseToken(tokenString)
+	if err != nil {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	if s.db == nil {
+		respondError(w, http.StatusServiceUnavailable, "Database not available")
+		return
+	}
+
+	// Resolve the projects visible to the user once, at connection time
+	projects, err := s.db.GetProjectsForUser(r.Context(), claims.UserID)
+	if err != nil {
+		logger.Error("Failed to get projects: " + err.Error())
+		respondError(w, http.StatusInternalServerError, "Failed to get projects")
+		return
+	}
+	allowed := make(map[int]bool)
+	for _, p := range projects {
+		allowed[p.ID] = true
+	}
+
+	if raw := r.URL.Query().Get("project_id"); raw != "" {
+		projectID, err := strconv.Atoi(raw)
+		if err != nil || !allowed[projectID] {
+			respondError(w, http.StatusForbidden, "You do not have access to this project")
+			return
+		}
+		allowed = map[int]bool{projectID: true}
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logger.Error("WebSocket upgrade failed: " + err.Error())
+		return
+	}
+	defer conn.Close()
+
+	eventsCh, unsubscribe := s.events.Subscribe()
+	defer unsubscribe()
+
+	// Drain incoming messages to detect when the client goes away
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case <-ping.C:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case event, ok := <-eventsCh:
+			if !ok {
+				return
+			}
+			if !allowed[event.ProjectID] {
+				continue
+			}
+			conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := conn.WriteJSON(event); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+)
+
+const artifactColumns = `id, pipeline_id, name, kind, content_type, byte_size, created_at`
+
+// CreateArtifact records a file produced by a pipeline
+// The content is kept in the row, or uploaded next to the log chunks when a log store is set.
+func (db *DB) CreateArtifact(ctx context.Context, a *models.Artifact, content []byte) error {
+	a.Size = len(content)
+	var key sql.NullString
+	if db.logStore != nil {
+		key = sql.NullString{String: fmt.Sprintf("pipelines/%d/artifacts/%s", a.PipelineID, a.Name), Valid: true}
+		putCtx, cancel := context.WithTimeout(ctx, logStoreTimeout)
+		err := db.logStore.Put(putCtx, key.String, content)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("failed to store artifact: %w", err)
+		}
+		content = nil
+	}
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		INSERT INTO artifacts (pipeline_id, name, kind, content_type, content, object_key, byte_size)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at
+	`
+	err := db.conn.QueryRowContext(ctx, query, a.PipelineID, a.Name, a.Kind, a.ContentType, content, key, a.Size).Scan(&a.ID, &a.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create artifact: %w", err)
+	}
+	return nil
+}
+
+// GetArtifactsByPipeline lists the artifacts of a pipeline, without their content
+func (db *DB) GetArtifactsByPipeline(ctx context.Context, pipelineID int) ([]models.Artifact, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.conn.QueryContext(ctx, `SELECT `+artifactColumns+` FROM artifacts WHERE pipeline_id = $1 ORDER BY id`, pipelineID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get artifacts: %w", err)
+	}
+	defer rows.Close()
+
+	var artifacts []models.Artifact
+	for rows.Next() {
+		var a models.Artifact
+		if err := rows.Scan(&a.ID, &a.PipelineID, &a.Name, &a.Kind, &a.ContentType, &a.Size, &a.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan artifact: %w", err)
+		}
+		artifacts = append(artifacts, a)
+	}
+	return artifacts, rows.Err()
+}
+
+// GetArtifactContent retrieves an artifact of a pipeline with its content, read from object storage when it was uploaded there
+func (db *DB) GetArtifactContent(ctx context.Context, pipelineID, id int) (*models.Artifact, []byte, error) {
+	queryCtx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var a models.Artifact
+	var content []byte
+	var key sql.NullString
+	query := `SELECT ` + artifactColumns + `, content, object_key FROM artifacts WHERE pipeline_id = $1 AND id = $2`
+	err := db.conn.QueryRowContext(queryCtx, query, pipelineID, id).
+		Scan(&a.ID, &a.PipelineID, &a.Name, &a.Kind, &a.ContentType, &a.Size, &a.CreatedAt, &content, &key)
+	if err == sql.ErrNoRows {
+		return nil, nil, fmt.Errorf("artifact not found")
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get artifact: %w", err)
+	}
+
+	if key.Valid {
+		if db.logStore == nil {
+			return nil, nil, fmt.Errorf("artifact %d is in object storage, which is not configured", id)
+		}
+		getCtx, cancel := context.WithTimeout(ctx, logStoreTimeout)
+		defer cancel()
+		if content, err = db.logStore.Get(getCtx, key.String); err != nil {
+			return nil, nil, fmt.Errorf("failed to read artifact: %w", err)
+		}
+	}
+	return &a, content, nil
+}
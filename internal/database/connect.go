@@ -0,0 +1,83 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+)
+
+const (
+	// defaultConnectTimeout is how long the startup waits for the database, e.g. a container still booting
+	defaultConnectTimeout = 30 * time.Second
+	// maxConnectDelay caps the exponential backoff between two connection attempts
+	maxConnectDelay = 10 * time.Second
+	// reconnectInterval is how often a lost database is checked again at runtime
+	reconnectInterval = 10 * time.Second
+	// defaultQueryTimeout bounds a database operation when DB_QUERY_TIMEOUT is not set
+	defaultQueryTimeout = 10 * time.Second
+)
+
+// connectWithRetry pings the database until it answers, backing off exponentially
+// DB_CONNECT_TIMEOUT (a duration, 0 for a single attempt) bounds the attempts.
+func connectWithRetry(sqlDB *sql.DB, prepare func(*sql.DB) error) error {
+	timeout := defaultConnectTimeout
+	if value := os.Getenv("DB_CONNECT_TIMEOUT"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid DB_CONNECT_TIMEOUT: %w", err)
+		}
+		timeout = d
+	}
+
+	deadline := time.Now().Add(timeout)
+	delay := 500 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		err := sqlDB.Ping()
+		if err == nil {
+			return prepare(sqlDB)
+		}
+		if time.Now().Add(delay).After(deadline) {
+			return fmt.Errorf("failed to ping database after %d attempts: %w", attempt, err)
+		}
+		logger.Warn(fmt.Sprintf("Database not reachable, retrying in %s: %v", delay, err))
+		time.Sleep(delay)
+		delay = min(delay*2, maxConnectDelay)
+	}
+}
+
+// reconnectEnabled reports whether DB_RECONNECT asks to keep trying the database at runtime
+// instead of running without persistence once the startup window has passed.
+func reconnectEnabled() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv("DB_RECONNECT"))
+	return enabled
+}
+
+// watchConnection pings the database periodically, logging when it is lost and restored
+// The pool dials new connections by itself, prepare runs again once the database is back.
+func watchConnection(sqlDB *sql.DB, prepare func(*sql.DB) error, connected bool, closed <-chan struct{}) {
+	ticker := time.NewTicker(reconnectInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case <-ticker.C:
+		}
+
+		err := sqlDB.Ping()
+		if err == nil && !connected {
+			err = prepare(sqlDB)
+		}
+		switch {
+		case err == nil && !connected:
+			logger.Info("Database connection restored")
+		case err != nil && connected:
+			logger.Error("Database connection lost: " + err.Error())
+		}
+		connected = err == nil
+	}
+}
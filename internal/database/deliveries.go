@@ -0,0 +1,200 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+)
+
+const webhookDeliveryColumns = `id, delivery_id, event, project_id, status, reason, pipeline_id, replay_of, received_at`
+
+// CreateWebhookDelivery records a received webhook delivery
+// It returns false when the delivery ID was already received, unless that delivery failed: it is then processed again in the same row.
+func (db *DB) CreateWebhookDelivery(ctx context.Context, d *models.WebhookDelivery) (bool, error) {
+	headers, err := json.Marshal(d.Headers)
+	if err != nil {
+		return false, err
+	}
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		INSERT INTO webhook_deliveries (delivery_id, event, headers, payload, replay_of)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (delivery_id) DO UPDATE SET
+			headers = EXCLUDED.headers, payload = EXCLUDED.payload, status = 'received', reason = NULL, pipeline_id = NULL,
+			received_at = CURRENT_TIMESTAMP
+		WHERE webhook_deliveries.status = 'failed'
+		RETURNING id, received_at
+	`
+	deliveryID := sql.NullString{String: d.DeliveryID, Valid: d.DeliveryID != ""}
+	err = db.conn.QueryRowContext(ctx, query, deliveryID, d.Event, string(headers), d.Payload, d.ReplayOf).Scan(&d.ID, &d.ReceivedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to record webhook delivery: %w", err)
+	}
+	d.Status = "received"
+	return true, nil
+}
+
+// FinishWebhookDelivery records what became of a delivery
+func (db *DB) FinishWebhookDelivery(ctx context.Context, d *models.WebhookDelivery) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.conn.ExecContext(ctx, `UPDATE webhook_deliveries SET project_id = $1, status = $2, reason = $3, pipeline_id = $4 WHERE id = $5`,
+		d.ProjectID, d.Status, d.Reason, d.PipelineID, d.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// GetWebhookDeliveriesByProject lists the latest deliveries of a project, without their headers and payload
+func (db *DB) GetWebhookDeliveriesByProject(ctx context.Context, projectID, limit int) ([]models.WebhookDelivery, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT ` + webhookDeliveryColumns + ` FROM webhook_deliveries WHERE project_id = $1 ORDER BY id DESC LIMIT $2`
+	rows, err := db.conn.QueryContext(ctx, query, projectID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, *d)
+	}
+	return deliveries, rows.Err()
+}
+
+// GetWebhookDelivery retrieves a delivery of a project with its headers and payload
+func (db *DB) GetWebhookDelivery(ctx context.Context, projectID, id int) (*models.WebhookDelivery, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT ` + webhookDeliveryColumns + `, headers, payload FROM webhook_deliveries WHERE project_id = $1 AND id = $2`
+	var headers, payload sql.NullString
+	d, err := scanWebhookDelivery(db.conn.QueryRowContext(ctx, query, projectID, id), &headers, &payload)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("webhook delivery not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook delivery: %w", err)
+	}
+	d.Payload = payload.String
+	if headers.Valid {
+		json.Unmarshal([]byte(headers.String), &d.Headers)
+	}
+	return d, nil
+}
+
+// scanWebhookDelivery scans the webhookDeliveryColumns of a row, followed by extra columns
+func scanWebhookDelivery(row rowScanner, extra ...any) (*models.WebhookDelivery, error) {
+	var d models.WebhookDelivery
+	var deliveryID, reason sql.NullString
+	var projectID, pipelineID, replayOf sql.NullInt64
+	dest := append([]any{&d.ID, &deliveryID, &d.Event, &projectID, &d.Status, &reason, &pipelineID, &replayOf, &d.ReceivedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	d.DeliveryID, d.Reason = deliveryID.String, reason.String
+	d.ProjectID, d.PipelineID, d.ReplayOf = nullIntPtr(projectID), nullIntPtr(pipelineID), nullIntPtr(replayOf)
+	return &d, nil
+}
+
+// nullIntPtr returns the value of a nullable integer column, nil when NULL
+func nullIntPtr(n sql.NullInt64) *int {
+	if !n.Valid {
+		return nil
+	}
+	id := int(n.Int64)
+	return &id
+}
+
+// ClaimIdempotencyKey records the idempotency key of a manual trigger of a project
+// When the key was already used, it returns the pipeline created by that request, 0 while it is still in progress.
+func (db *DB) ClaimIdempotencyKey(ctx context.Context, projectID int, key string) (bool, int, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	result, err := db.conn.ExecContext(ctx, `
+		INSERT INTO pipeline_idempotency_keys (project_id, idempotency_key) VALUES ($1, $2)
+		ON CONFLICT (project_id, idempotency_key) DO NOTHING
+	`, projectID, key)
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to record idempotency key: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 1 {
+		return true, 0, nil
+	}
+
+	var pipelineID sql.NullInt64
+	err = db.conn.QueryRowContext(ctx, `SELECT pipeline_id FROM pipeline_idempotency_keys WHERE project_id = $1 AND idempotency_key = $2`,
+		projectID, key).Scan(&pipelineID)
+	if err == sql.ErrNoRows {
+		// Released in between, the retry is treated as in progress
+		return false, 0, nil
+	}
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to get idempotency key: %w", err)
+	}
+	return false, int(pipelineID.Int64), nil
+}
+
+// SetIdempotencyKeyPipeline links an idempotency key to the pipeline its request created
+func (db *DB) SetIdempotencyKeyPipeline(ctx context.Context, projectID int, key string, pipelineID int) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.conn.ExecContext(ctx, `UPDATE pipeline_idempotency_keys SET pipeline_id = $1 WHERE project_id = $2 AND idempotency_key = $3`,
+		pipelineID, projectID, key)
+	if err != nil {
+		return fmt.Errorf("failed to update idempotency key: %w", err)
+	}
+	return nil
+}
+
+// ReleaseIdempotencyKey forgets the idempotency key of a failed request, so that it can be retried
+func (db *DB) ReleaseIdempotencyKey(ctx context.Context, projectID int, key string) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.conn.ExecContext(ctx, `DELETE FROM pipeline_idempotency_keys WHERE project_id = $1 AND idempotency_key = $2`, projectID, key)
+	if err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
+
+// DeleteDeliveriesBefore removes the webhook deliveries and idempotency keys recorded before a time
+func (db *DB) DeleteDeliveriesBefore(ctx context.Context, before time.Time) (int, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	removed := 0
+	for _, query := range []string{
+		`DELETE FROM webhook_deliveries WHERE received_at < $1`,
+		`DELETE FROM pipeline_idempotency_keys WHERE created_at < $1`,
+	} {
+		result, err := db.conn.ExecContext(ctx, query, before.UTC())
+		if err != nil {
+			return removed, fmt.Errorf("failed to delete old deliveries: %w", err)
+		}
+		n, _ := result.RowsAffected()
+		removed += int(n)
+	}
+	return removed, nil
+}
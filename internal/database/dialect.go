@@ -0,0 +1,186 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/tracing"
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	_ "modernc.org/sqlite"
+)
+
+// dialect adapts the queries of the package, written for PostgreSQL, to a database driver
+type dialect interface {
+	// system is the database system, as reported on the spans
+	system() string
+	// rebind rewrites a query in the syntax of the driver
+	rebind(query string) string
+	// array binds a string slice as a query argument, or scans a column into it
+	array(a *[]string) arrayValue
+}
+
+// arrayValue is a slice both bound as an argument and scanned from a column
+type arrayValue interface {
+	driver.Valuer
+	sql.Scanner
+}
+
+// startQuery starts the span of a query, named after its first keyword (db.select, db.insert...)
+// The statement is recorded without its arguments, which may hold secrets.
+func startQuery(ctx context.Context, d dialect, query string) (context.Context, trace.Span) {
+	operation := "query"
+	if words := strings.Fields(query); len(words) > 0 {
+		operation = strings.ToLower(words[0])
+	}
+	return tracing.Start(ctx, "db."+operation,
+		attribute.String("db.system", d.system()),
+		attribute.String("db.statement", query))
+}
+
+// conn runs the queries of the package on the database, rewritten by its dialect, each in a span
+type conn struct {
+	*sql.DB
+	dialect
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	query = c.rebind(query)
+	ctx, span := startQuery(ctx, c.dialect, query)
+	rows, err := c.DB.QueryContext(ctx, query, args...)
+	tracing.End(span, err)
+	return rows, err
+}
+
+func (c *conn) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	query = c.rebind(query)
+	ctx, span := startQuery(ctx, c.dialect, query)
+	row := c.DB.QueryRowContext(ctx, query, args...)
+	tracing.End(span, row.Err())
+	return row
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	query = c.rebind(query)
+	ctx, span := startQuery(ctx, c.dialect, query)
+	result, err := c.DB.ExecContext(ctx, query, args...)
+	tracing.End(span, err)
+	return result, err
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts *sql.TxOptions) (*tx, error) {
+	t, err := c.DB.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &tx{Tx: t, dialect: c.dialect}, nil
+}
+
+// tx is a transaction whose queries are rewritten by the dialect of its database
+type tx struct {
+	*sql.Tx
+	dialect
+}
+
+func (t *tx) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	query = t.rebind(query)
+	ctx, span := startQuery(ctx, t.dialect, query)
+	row := t.Tx.QueryRowContext(ctx, query, args...)
+	tracing.End(span, row.Err())
+	return row
+}
+
+func (t *tx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	query = t.rebind(query)
+	ctx, span := startQuery(ctx, t.dialect, query)
+	result, err := t.Tx.ExecContext(ctx, query, args...)
+	tracing.End(span, err)
+	return result, err
+}
+
+// ============== PostgreSQL ==============
+
+type postgresDialect struct{}
+
+func (postgresDialect) system() string {
+	return "postgresql"
+}
+
+func (postgresDialect) rebind(query string) string {
+	return query
+}
+
+func (postgresDialect) array(a *[]string) arrayValue {
+	return pq.Array(a)
+}
+
+// ============== SQLite ==============
+
+// sqliteSchema creates the tables on SQLite, PostgreSQL being provisioned with init-db.sql
+//
+//go:embed schema_sqlite.sql
+var sqliteSchema string
+
+var (
+	sqliteAnyPattern         = regexp.MustCompile(`= ANY\((\$\d+)\)`)
+	sqliteForUpdatePattern   = regexp.MustCompile(`\s+FOR UPDATE`)
+	sqliteExpiryPattern      = regexp.MustCompile(`(\w+) > CURRENT_TIMESTAMP`)
+	sqliteEmptyArrayPattern  = regexp.MustCompile(`'\{\}'`)
+	sqlitePlaceholderPattern = regexp.MustCompile(`\$(\d+)`)
+)
+
+// sqliteDialect runs the engine on a SQLite file, for local development and demos
+// Arrays are stored as JSON text and rows are locked by SQLite serializing the writes.
+type sqliteDialect struct{}
+
+func (sqliteDialect) system() string {
+	return "sqlite"
+}
+
+func (sqliteDialect) rebind(query string) string {
+	query = sqliteAnyPattern.ReplaceAllString(query, `IN (SELECT value FROM json_each($1))`)
+	query = sqliteForUpdatePattern.ReplaceAllString(query, "")
+	query = sqliteEmptyArrayPattern.ReplaceAllString(query, "'[]'")
+	// Times are stored as text with their offset, which a plain comparison gets wrong
+	query = sqliteExpiryPattern.ReplaceAllString(query, `julianday($1) > julianday('now')`)
+	// $1 is a named parameter in SQLite, ?1 the numbered one
+	return sqlitePlaceholderPattern.ReplaceAllString(query, `?$1`)
+}
+
+func (sqliteDialect) array(a *[]string) arrayValue {
+	return jsonArray{a}
+}
+
+// jsonArray stores a string slice as a JSON array
+type jsonArray struct {
+	a *[]string
+}
+
+func (j jsonArray) Value() (driver.Value, error) {
+	if *j.a == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal(*j.a)
+	return string(data), err
+}
+
+func (j jsonArray) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*j.a = nil
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), j.a)
+	case []byte:
+		return json.Unmarshal(v, j.a)
+	default:
+		return fmt.Errorf("cannot scan %T into a string array", src)
+	}
+}
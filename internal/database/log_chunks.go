@@ -0,0 +1,149 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/logstore"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+)
+
+// logStoreTimeout bounds each upload or download of a log chunk, on top of the query timeout
+const logStoreTimeout = 30 * time.Second
+
+// SetLogStore sends job log chunks to object storage, only their metadata staying in the database
+func (db *DB) SetLogStore(store logstore.Store) {
+	db.logStore = store
+}
+
+// appendLogChunk records a batch of lines as one chunk of job_log_chunks
+// The text is kept in the row, or uploaded as an object whose key is recorded when a log store is set.
+// Each line is stored as "<RFC 3339 timestamp> <stream> <content>".
+func (db *DB) appendLogChunk(ctx context.Context, jobID int, entries []models.LogLine) error {
+	var b strings.Builder
+	now := time.Now()
+	for _, e := range entries {
+		createdAt := e.CreatedAt
+		if createdAt.IsZero() {
+			createdAt = now
+		}
+		stream := e.Stream
+		if stream == "" {
+			stream = models.LogStreamStdout
+		}
+		fmt.Fprintf(&b, "%s %s %s\n", createdAt.UTC().Format(time.RFC3339Nano), stream, e.Content)
+	}
+	data := b.String()
+
+	var content, key sql.NullString
+	if db.logStore != nil {
+		key = sql.NullString{String: fmt.Sprintf("jobs/%d/%d.log", jobID, now.UnixNano()), Valid: true}
+		putCtx, cancel := context.WithTimeout(ctx, logStoreTimeout)
+		err := db.logStore.Put(putCtx, key.String, []byte(data))
+		cancel()
+		if err != nil {
+			return fmt.Errorf("failed to store log chunk: %w", err)
+		}
+	} else {
+		content = sql.NullString{String: data, Valid: true}
+	}
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `INSERT INTO job_log_chunks (job_id, content, object_key, line_count, byte_size, timestamped) VALUES ($1, $2, $3, $4, $5, TRUE)`
+	if _, err := db.conn.ExecContext(ctx, query, jobID, content, key, len(entries), len(data)); err != nil {
+		return fmt.Errorf("failed to store log chunk: %w", err)
+	}
+	return nil
+}
+
+// getLogChunks rebuilds the lines of a job following the line afterID
+// Line IDs are their position in the job log, counted over every chunk.
+// Only the query is bound by the query timeout, reading from object storage having its own per chunk.
+func (db *DB) getLogChunks(ctx context.Context, jobID, afterID int) ([]models.LogLine, error) {
+	query := `
+		SELECT content, object_key, timestamped, line_offset, line_count, created_at FROM (
+			SELECT id, content, object_key, timestamped, line_count, created_at,
+			       SUM(line_count) OVER (ORDER BY id) - line_count AS line_offset
+			FROM job_log_chunks
+			WHERE job_id = $1
+		) chunks
+		WHERE line_offset + line_count > $2
+		ORDER BY id ASC
+	`
+	queryCtx, cancel := db.withTimeout(ctx)
+	defer cancel()
+	rows, err := db.conn.QueryContext(queryCtx, query, jobID, afterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query log chunks: %w", err)
+	}
+	defer rows.Close()
+
+	type chunk struct {
+		content     sql.NullString
+		key         sql.NullString
+		timestamped bool
+		offset      int
+		count       int
+		createdAt   time.Time
+	}
+	var chunks []chunk
+	for rows.Next() {
+		var c chunk
+		if err := rows.Scan(&c.content, &c.key, &c.timestamped, &c.offset, &c.count, &c.createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan log chunk: %w", err)
+		}
+		chunks = append(chunks, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query log chunks: %w", err)
+	}
+
+	var logs []models.LogLine
+	for _, c := range chunks {
+		data := c.content.String
+		if !c.content.Valid {
+			if db.logStore == nil {
+				return nil, fmt.Errorf("log chunk %s is in object storage, which is not configured", c.key.String)
+			}
+			getCtx, cancel := context.WithTimeout(ctx, logStoreTimeout)
+			object, err := db.logStore.Get(getCtx, c.key.String)
+			cancel()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read log chunk: %w", err)
+			}
+			data = string(object)
+		}
+
+		lines := strings.SplitN(strings.TrimSuffix(data, "\n"), "\n", c.count)
+		for i, content := range lines {
+			id := c.offset + i + 1
+			if id <= afterID {
+				continue
+			}
+			l := models.LogLine{ID: id, JobID: jobID, Content: content, CreatedAt: c.createdAt}
+			if c.timestamped {
+				parseLogEntry(&l)
+			}
+			logs = append(logs, l)
+		}
+	}
+	return logs, nil
+}
+
+// parseLogEntry splits the timestamp and stream stored in front of a chunk line from its content
+func parseLogEntry(l *models.LogLine) {
+	parts := strings.SplitN(l.Content, " ", 3)
+	if len(parts) < 3 {
+		return
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return
+	}
+	l.CreatedAt, l.Stream, l.Content = createdAt, parts[1], parts[2]
+}
@@ -0,0 +1,168 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+)
+
+// retentionBatchSize bounds the pipelines removed per transaction
+const retentionBatchSize = 500
+
+// retainedPipelines selects the pipelines of project $1 a retention policy never removes:
+// the latest successful one of each branch, and those deployed to an environment or a preview
+const retainedPipelines = `
+	SELECT MAX(id) FROM pipelines WHERE project_id = $1 AND status = 'success' GROUP BY branch
+	UNION SELECT current_pipeline_id FROM environments WHERE project_id = $1 AND current_pipeline_id IS NOT NULL
+	UNION SELECT pipeline_id FROM preview_environments WHERE project_id = $1 AND pipeline_id IS NOT NULL
+`
+
+// PrunePipelines deletes or archives the pipelines of a project finished before a time, counting what was removed
+// With dryRun nothing is removed, the counts being what would be. Objects in object storage are deleted after their rows,
+// a failure to delete them leaving them orphaned and being returned with the counts.
+func (db *DB) PrunePipelines(ctx context.Context, projectID int, before time.Time, action string, dryRun bool) (*models.RetentionResult, error) {
+	result := &models.RetentionResult{Action: action, DryRun: dryRun, Before: before}
+
+	ids, err := db.retentionCandidates(ctx, projectID, before, action == models.RetentionActionArchive)
+	if err != nil {
+		return result, err
+	}
+	for batch := range slices.Chunk(ids, retentionBatchSize) {
+		if err := db.pruneBatch(ctx, batch, action, dryRun, result); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// retentionCandidates lists the finished pipelines of a project a retention pass removes, skipping the archived ones when archiving
+func (db *DB) retentionCandidates(ctx context.Context, projectID int, before time.Time, archive bool) ([]int, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT id FROM pipelines
+		WHERE project_id = $1 AND status IN ('success', 'failed', 'cancelled', 'skipped')
+		AND COALESCE(finished_at, created_at) < $2
+		AND id NOT IN (` + retainedPipelines + `)`
+	if archive {
+		query += ` AND archived_at IS NULL`
+	}
+	rows, err := db.conn.QueryContext(ctx, query+` ORDER BY id`, projectID, before.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query expired pipelines: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan pipeline: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// pruneBatch removes a batch of expired pipelines and adds what it removed to result
+func (db *DB) pruneBatch(ctx context.Context, ids []int, action string, dryRun bool, result *models.RetentionResult) error {
+	queryCtx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		placeholders[i] = "$" + strconv.Itoa(i+1)
+		args[i] = id
+	}
+	in := strings.Join(placeholders, ", ")
+	jobsIn := `SELECT id FROM jobs WHERE pipeline_id IN (` + in + `)`
+
+	var jobs, deployments int
+	query := `SELECT (SELECT COUNT(*) FROM jobs WHERE pipeline_id IN (` + in + `)), (SELECT COUNT(*) FROM deployments WHERE pipeline_id IN (` + in + `))`
+	if err := db.conn.QueryRowContext(queryCtx, query, args...).Scan(&jobs, &deployments); err != nil {
+		return fmt.Errorf("failed to count expired jobs and deployments: %w", err)
+	}
+
+	var keys []string
+	if db.logStore != nil {
+		query := `
+			SELECT object_key FROM job_log_chunks WHERE object_key IS NOT NULL AND job_id IN (` + jobsIn + `)
+			UNION ALL SELECT object_key FROM artifacts WHERE object_key IS NOT NULL AND pipeline_id IN (` + in + `)
+		`
+		rows, err := db.conn.QueryContext(queryCtx, query, args...)
+		if err != nil {
+			return fmt.Errorf("failed to query expired objects: %w", err)
+		}
+		for rows.Next() {
+			var key string
+			if err := rows.Scan(&key); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan object key: %w", err)
+			}
+			keys = append(keys, key)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to query expired objects: %w", err)
+		}
+	}
+
+	if !dryRun {
+		tx, err := db.conn.BeginTx(queryCtx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		defer tx.Rollback()
+
+		statements := []string{`DELETE FROM pipelines WHERE id IN (` + in + `)`}
+		if action == models.RetentionActionArchive {
+			statements = []string{
+				`DELETE FROM job_logs WHERE job_id IN (` + jobsIn + `)`,
+				`DELETE FROM job_log_chunks WHERE job_id IN (` + jobsIn + `)`,
+				`DELETE FROM artifacts WHERE pipeline_id IN (` + in + `)`,
+				`DELETE FROM deployment_logs WHERE pipeline_id IN (` + in + `)`,
+				`UPDATE pipelines SET archived_at = CURRENT_TIMESTAMP WHERE id IN (` + in + `)`,
+			}
+		}
+		for _, statement := range statements {
+			if _, err := tx.ExecContext(queryCtx, statement, args...); err != nil {
+				return fmt.Errorf("failed to %s expired pipelines: %w", action, err)
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit transaction: %w", err)
+		}
+	}
+	result.Pipelines += len(ids)
+	result.Jobs += jobs
+	result.Deployments += deployments
+
+	if dryRun {
+		result.Objects += len(keys)
+		return nil
+	}
+	var failed int
+	var lastErr error
+	for _, key := range keys {
+		deleteCtx, cancel := context.WithTimeout(ctx, logStoreTimeout)
+		err := db.logStore.Delete(deleteCtx, key)
+		cancel()
+		if err != nil {
+			failed++
+			lastErr = err
+			continue
+		}
+		result.Objects++
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to delete %d objects from object storage: %w", failed, lastErr)
+	}
+	return nil
+}
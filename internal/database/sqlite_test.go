@@ -0,0 +1,302 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/secrets"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// batchCounter is a batching secrets backend counting its decryption calls
+type batchCounter struct {
+	*secrets.AES
+	calls int
+}
+
+func (b *batchCounter) Decrypt(ctx context.Context, ciphertext string) (string, error) {
+	b.calls++
+	return b.AES.Decrypt(ctx, ciphertext)
+}
+
+func (b *batchCounter) DecryptBatch(ctx context.Context, ciphertexts []string) ([]string, error) {
+	b.calls++
+	plaintexts := make([]string, len(ciphertexts))
+	for i, ciphertext := range ciphertexts {
+		var err error
+		if plaintexts[i], err = b.AES.Decrypt(ctx, ciphertext); err != nil {
+			return nil, err
+		}
+	}
+	return plaintexts, nil
+}
+
+// newSQLiteDB opens a database on a SQLite file of the test
+func newSQLiteDB(t *testing.T) *DB {
+	t.Helper()
+	return newSQLiteDBWithSecrets(t, secrets.NewAES("0123456789abcdef0123456789abcdef", true))
+}
+
+// newSQLiteDBWithSecrets opens a database on a SQLite file of the test, sealing secrets with the backend
+func newSQLiteDBWithSecrets(t *testing.T, backend secrets.Backend) *DB {
+	t.Helper()
+	t.Setenv("DATABASE_URL", "sqlite://"+filepath.Join(t.TempDir(), "cicd.db"))
+	t.Setenv("DB_RECONNECT", "false")
+	db, err := New(backend)
+	if err != nil {
+		t.Fatalf("Expected no error opening the database, got %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestRebind(t *testing.T) {
+	for query, want := range map[string]string{
+		`SELECT id FROM jobs WHERE id = $1 AND status = $2`:              `SELECT id FROM jobs WHERE id = ?1 AND status = ?2`,
+		`SELECT id FROM pipelines WHERE status = ANY($2)`:                `SELECT id FROM pipelines WHERE status IN (SELECT value FROM json_each(?2))`,
+		`SELECT id FROM jobs WHERE id = $1 FOR UPDATE`:                   `SELECT id FROM jobs WHERE id = ?1`,
+		`SELECT id FROM api_tokens WHERE expires_at > CURRENT_TIMESTAMP`: `SELECT id FROM api_tokens WHERE julianday(expires_at) > julianday('now')`,
+		`INSERT INTO projects (branch_filters) VALUES ('{}')`:            `INSERT INTO projects (branch_filters) VALUES ('[]')`,
+	} {
+		if got := (sqliteDialect{}).rebind(query); got != want {
+			t.Errorf("Expected %q, got %q", want, got)
+		}
+		if got := (postgresDialect{}).rebind(query); got != query {
+			t.Errorf("Expected PostgreSQL queries to be kept, got %q", got)
+		}
+	}
+}
+
+func TestBatchDecrypt(t *testing.T) {
+	ctx := context.Background()
+	backend := &batchCounter{AES: secrets.NewAES("0123456789abcdef0123456789abcdef", true)}
+	db := newSQLiteDBWithSecrets(t, backend)
+
+	owner := &models.User{Email: "owner@example.com", Name: "Owner"}
+	db.CreateUser(ctx, owner)
+	for _, name := range []string{"api", "web", "worker"} {
+		_, err := db.CreateProject(ctx, &models.NewProject{OwnerID: owner.ID, Name: name, RepoURL: "https://example.com/" + name + ".git",
+			AccessToken: "token-" + name, SSHPrivateKey: "key-" + name})
+		if err != nil {
+			t.Fatalf("Expected no error creating project, got %v", err)
+		}
+	}
+
+	backend.calls = 0
+	projects, err := db.GetAllProjects(ctx)
+	if err != nil || len(projects) != 3 {
+		t.Fatalf("Expected 3 projects, got %d (%v)", len(projects), err)
+	}
+	if backend.calls != 1 {
+		t.Errorf("Expected the secrets of every project opened in one call, got %d", backend.calls)
+	}
+	for _, p := range projects {
+		if p.AccessToken != "token-"+p.Name || p.SSHPrivateKey != "key-"+p.Name {
+			t.Errorf("Expected the secrets of %s, got %q and %q", p.Name, p.AccessToken, p.SSHPrivateKey)
+		}
+	}
+}
+
+func TestQuerySpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(previous)
+
+	db := newSQLiteDB(t)
+	if _, err := db.GetProject(context.Background(), 42); err == nil {
+		t.Fatalf("Expected an unknown project")
+	}
+
+	var found bool
+	for _, span := range recorder.Ended() {
+		if span.Name() != "db.select" {
+			continue
+		}
+		found = true
+		attrs := attribute.NewSet(span.Attributes()...)
+		if system, _ := attrs.Value("db.system"); system.AsString() != "sqlite" {
+			t.Errorf("Expected the sqlite system, got %q", system.AsString())
+		}
+		if statement, _ := attrs.Value("db.statement"); !strings.Contains(statement.AsString(), "FROM projects") {
+			t.Errorf("Expected the rebound statement, got %q", statement.AsString())
+		}
+	}
+	if !found {
+		t.Errorf("Expected a db.select span, got %d spans", len(recorder.Ended()))
+	}
+}
+
+// TestSQLiteStore runs the main store methods on SQLite, whose queries are the PostgreSQL ones rebound
+func TestSQLiteStore(t *testing.T) {
+	ctx := context.Background()
+	db := newSQLiteDB(t)
+
+	owner := &models.User{Email: "owner@example.com", Name: "Owner"}
+	if err := db.CreateUser(ctx, owner); err != nil {
+		t.Fatalf("Expected no error creating user, got %v", err)
+	}
+	member := &models.User{Email: "member@example.com", Name: "Member"}
+	if err := db.CreateUser(ctx, member); err != nil {
+		t.Fatalf("Expected no error creating user, got %v", err)
+	}
+
+	project, err := db.CreateProject(ctx, &models.NewProject{
+		OwnerID: owner.ID, Name: "app", RepoURL: "https://example.com/app.git", AccessToken: "ghp_secret",
+		BranchFilters: []string{"main", "release/*"}, ImageTags: []string{models.ImageTagLatest},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error creating project, got %v", err)
+	}
+
+	t.Run("Projects", func(t *testing.T) {
+		got, err := db.GetProject(ctx, project.ID)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if got.AccessToken != "ghp_secret" || !slices.Equal(got.BranchFilters, []string{"main", "release/*"}) {
+			t.Errorf("Expected the secret and arrays to round trip, got %q and %v", got.AccessToken, got.BranchFilters)
+		}
+		if found, err := db.FindProjectByUrl(ctx, "https://example.com/app.git"); err != nil || found.ID != project.ID {
+			t.Errorf("Expected the project by URL, got %+v (%v)", found, err)
+		}
+
+		if err := db.SetProjectBadgeToken(ctx, project.ID, "badge"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if token, err := db.GetProjectBadgeToken(ctx, project.ID); err != nil || token != "badge" {
+			t.Errorf("Expected the badge token, got %q (%v)", token, err)
+		}
+	})
+
+	t.Run("Members", func(t *testing.T) {
+		if err := db.AddProjectMember(ctx, project.ID, member.ID, "developer"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if role, err := db.GetProjectMemberRole(ctx, project.ID, member.ID); err != nil || role != "developer" {
+			t.Errorf("Expected developer, got %q (%v)", role, err)
+		}
+		projects, err := db.GetProjectsForUser(ctx, member.ID)
+		if err != nil || len(projects) != 1 {
+			t.Errorf("Expected the project of the member, got %d (%v)", len(projects), err)
+		}
+	})
+
+	t.Run("Organizations", func(t *testing.T) {
+		org, err := db.CreateOrganization(ctx, "acme", owner.ID)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		team, err := db.CreateTeam(ctx, org.ID, "ops", "maintainer")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if err := db.AddTeamMember(ctx, team.ID, member.ID); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if role, err := db.GetOrganizationMemberRole(ctx, org.ID, member.ID); err != nil || role != "maintainer" {
+			t.Errorf("Expected the role of the team, got %q (%v)", role, err)
+		}
+		if orgs, err := db.GetOrganizationsForUser(ctx, member.ID); err != nil || len(orgs) != 1 {
+			t.Errorf("Expected the organization reached through the team, got %d (%v)", len(orgs), err)
+		}
+	})
+
+	t.Run("PipelinesAndJobs", func(t *testing.T) {
+		pipeline, err := db.CreatePipeline(ctx, project.ID, "main", "0123456789abcdef")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if err := db.UpdatePipelineStatus(ctx, pipeline.ID, "running"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if active, err := db.GetActivePipelinesByBranch(ctx, project.ID, "main"); err != nil || len(active) != 1 {
+			t.Errorf("Expected the running pipeline to be active, got %d (%v)", len(active), err)
+		}
+		if pipeline.ChangedFiles != nil {
+			t.Errorf("Expected unknown changed files, got %q", pipeline.ChangedFiles)
+		}
+		if err := db.SetPipelineTrigger(ctx, pipeline.ID, "v1.0.0", "main", []string{"go.mod"}); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if got, err := db.GetPipeline(ctx, pipeline.ID); err != nil || got.Tag != "v1.0.0" || got.DefaultBranch != "main" || len(got.ChangedFiles) != 1 {
+			t.Errorf("Expected the push recorded with the pipeline, got %+v (%v)", got, err)
+		}
+
+		job, err := db.CreateJob(ctx, pipeline.ID, "test", "test", "alpine")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		exitCode := 0
+		if err := db.UpdateJobStatus(ctx, job.ID, "success", &exitCode); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if succeeded, err := db.GetSucceededJobNames(ctx, project.ID, "0123456789abcdef"); err != nil || !succeeded["test"] {
+			t.Errorf("Expected the succeeded job, got %v (%v)", succeeded, err)
+		}
+
+		at := time.Now()
+		lines := []models.LogLine{{Content: "one", CreatedAt: at}, {Content: "two", CreatedAt: at}, {Content: "three", CreatedAt: at}}
+		if err := db.CreateLogEntries(ctx, job.ID, lines); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		logs, err := db.GetLogsByJob(ctx, job.ID)
+		if err != nil || len(logs) != 3 {
+			t.Fatalf("Expected 3 lines, got %d (%v)", len(logs), err)
+		}
+		if after, err := db.GetLogsAfter(ctx, job.ID, logs[0].ID); err != nil || len(after) != 2 || after[0].Content != "two" {
+			t.Errorf("Expected the lines after the first, got %+v (%v)", after, err)
+		}
+
+		if err := db.UpdatePipelineStatus(ctx, pipeline.ID, "success"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if latest, err := db.GetLatestFinishedPipeline(ctx, project.ID, "main"); err != nil || latest.ID != pipeline.ID {
+			t.Errorf("Expected the finished pipeline, got %+v (%v)", latest, err)
+		}
+	})
+
+	t.Run("Variables", func(t *testing.T) {
+		v := &models.Variable{ProjectID: project.ID, Key: "TOKEN", Value: "s3cret", IsSecret: true, EnvironmentScope: "*"}
+		if err := db.CreateVariable(ctx, v); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		vars, err := db.GetVariablesByProject(ctx, project.ID)
+		if err != nil || len(vars) != 1 || vars[0].Value != "s3cret" {
+			t.Errorf("Expected the decrypted variable, got %+v (%v)", vars, err)
+		}
+	})
+
+	t.Run("APITokens", func(t *testing.T) {
+		expired := time.Now().Add(-time.Hour)
+		if err := db.CreateAPIToken(ctx, &models.APIToken{UserID: owner.ID, Name: "old", Scopes: []string{"read"}, ExpiresAt: &expired}, "expired-hash"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if err := db.CreateAPIToken(ctx, &models.APIToken{UserID: owner.ID, Name: "ci", Scopes: []string{"read", "write"}}, "valid-hash"); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if token, err := db.GetAPITokenByHash(ctx, "valid-hash"); err != nil || !slices.Equal(token.Scopes, []string{"read", "write"}) {
+			t.Errorf("Expected the token with its scopes, got %+v (%v)", token, err)
+		}
+		if token, err := db.GetAPITokenByHash(ctx, "expired-hash"); err == nil && token != nil {
+			t.Errorf("Expected the expired token to be refused, got %+v", token)
+		}
+	})
+
+	t.Run("DeleteProject", func(t *testing.T) {
+		if err := db.DeleteProject(ctx, project.ID); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if _, err := db.GetProject(ctx, project.ID); err == nil {
+			t.Errorf("Expected the project to be deleted")
+		}
+	})
+}
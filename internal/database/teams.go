@@ -0,0 +1,162 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+)
+
+const teamColumns = `id, organization_id, name, COALESCE(role, 'viewer'), created_at`
+
+func scanTeam(row rowScanner) (*models.Team, error) {
+	var t models.Team
+	if err := row.Scan(&t.ID, &t.OrganizationID, &t.Name, &t.Role, &t.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// CreateTeam creates a team in an organization, its name being unique in the organization
+func (db *DB) CreateTeam(ctx context.Context, organizationID int, name, role string) (*models.Team, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		INSERT INTO organization_teams (organization_id, name, role) VALUES ($1, $2, $3)
+		ON CONFLICT (organization_id, name) DO NOTHING
+		RETURNING ` + teamColumns
+	t, err := scanTeam(db.conn.QueryRowContext(ctx, query, organizationID, name, role))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("team already exists")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create team: %w", err)
+	}
+	return t, nil
+}
+
+// GetTeam retrieves a team by ID
+func (db *DB) GetTeam(ctx context.Context, id int) (*models.Team, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	t, err := scanTeam(db.conn.QueryRowContext(ctx, `SELECT `+teamColumns+` FROM organization_teams WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("team not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get team: %w", err)
+	}
+	return t, nil
+}
+
+// GetTeamsByOrganization retrieves the teams of an organization by name
+func (db *DB) GetTeamsByOrganization(ctx context.Context, organizationID int) ([]models.Team, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT ` + teamColumns + ` FROM organization_teams WHERE organization_id = $1 ORDER BY name ASC`
+	rows, err := db.conn.QueryContext(ctx, query, organizationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query teams: %w", err)
+	}
+	defer rows.Close()
+
+	var teams []models.Team
+	for rows.Next() {
+		t, err := scanTeam(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan team: %w", err)
+		}
+		teams = append(teams, *t)
+	}
+	return teams, nil
+}
+
+// UpdateTeam renames a team and changes its role
+func (db *DB) UpdateTeam(ctx context.Context, id int, name, role string) (*models.Team, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `UPDATE organization_teams SET name = $1, role = $2 WHERE id = $3 RETURNING ` + teamColumns
+	t, err := scanTeam(db.conn.QueryRowContext(ctx, query, name, role, id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("team not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update team: %w", err)
+	}
+	return t, nil
+}
+
+// DeleteTeam deletes a team, its members keeping only their own roles
+func (db *DB) DeleteTeam(ctx context.Context, id int) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	result, err := db.conn.ExecContext(ctx, `DELETE FROM organization_teams WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete team: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("team not found")
+	}
+	return nil
+}
+
+// AddTeamMember adds a user to a team, doing nothing when they already belong to it
+func (db *DB) AddTeamMember(ctx context.Context, teamID, userID int) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `INSERT INTO team_members (team_id, user_id) VALUES ($1, $2) ON CONFLICT (team_id, user_id) DO NOTHING`
+	if _, err := db.conn.ExecContext(ctx, query, teamID, userID); err != nil {
+		return fmt.Errorf("failed to add team member: %w", err)
+	}
+	return nil
+}
+
+// GetTeamMembers retrieves the members of a team, most recent first
+func (db *DB) GetTeamMembers(ctx context.Context, teamID int) ([]models.TeamMember, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT tm.team_id, tm.user_id, tm.joined_at,
+		       u.id, u.email, u.name, u.avatar_url
+		FROM team_members tm
+		JOIN users u ON tm.user_id = u.id
+		WHERE tm.team_id = $1
+		ORDER BY tm.joined_at DESC
+	`
+	rows, err := db.conn.QueryContext(ctx, query, teamID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query team members: %w", err)
+	}
+	defer rows.Close()
+
+	var members []models.TeamMember
+	for rows.Next() {
+		var tm models.TeamMember
+		var u models.User
+		if err := rows.Scan(&tm.TeamID, &tm.UserID, &tm.JoinedAt, &u.ID, &u.Email, &u.Name, &u.AvatarURL); err != nil {
+			return nil, fmt.Errorf("failed to scan team member: %w", err)
+		}
+		tm.User = &u
+		members = append(members, tm)
+	}
+	return members, nil
+}
+
+// RemoveTeamMember removes a user from a team
+func (db *DB) RemoveTeamMember(ctx context.Context, teamID, userID int) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := db.conn.ExecContext(ctx, `DELETE FROM team_members WHERE team_id = $1 AND user_id = $2`, teamID, userID); err != nil {
+		return fmt.Errorf("failed to remove team member: %w", err)
+	}
+	return nil
+}
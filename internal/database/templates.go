@@ -0,0 +1,170 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+)
+
+const templateColumns = `id, owner_id, organization_id, name, COALESCE(description, ''), COALESCE(pipeline_filename, 'pipeline.yml'),
+	COALESCE(pipeline_content, ''), COALESCE(variables, ''), COALESCE(environments, ''), created_at`
+
+// scanTemplate scans a row selected with templateColumns and decrypts its variables
+func (db *DB) scanTemplate(ctx context.Context, row rowScanner) (*models.ProjectTemplate, error) {
+	var t models.ProjectTemplate
+	var organizationID sql.NullInt64
+	var variables, environments string
+	err := row.Scan(&t.ID, &t.OwnerID, &organizationID, &t.Name, &t.Description, &t.PipelineFilename,
+		&t.PipelineContent, &variables, &environments, &t.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if organizationID.Valid {
+		id := int(organizationID.Int64)
+		t.OrganizationID = &id
+	}
+	if variables != "" {
+		if variables, err = db.Decrypt(ctx, variables); err != nil {
+			return nil, fmt.Errorf("failed to decrypt template variables: %w", err)
+		}
+		if err := json.Unmarshal([]byte(variables), &t.Variables); err != nil {
+			return nil, fmt.Errorf("invalid template variables: %w", err)
+		}
+	}
+	if environments != "" {
+		if err := json.Unmarshal([]byte(environments), &t.Environments); err != nil {
+			return nil, fmt.Errorf("invalid template environments: %w", err)
+		}
+	}
+	return &t, nil
+}
+
+// templateValues encodes the variables, encrypted, and the environments of a template
+func (db *DB) templateValues(ctx context.Context, t *models.ProjectTemplate) (string, string, error) {
+	variables, err := json.Marshal(t.Variables)
+	if err != nil {
+		return "", "", err
+	}
+	encVariables, err := db.Encrypt(ctx, string(variables))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encrypt template variables: %w", err)
+	}
+	environments, err := json.Marshal(t.Environments)
+	if err != nil {
+		return "", "", err
+	}
+	return encVariables, string(environments), nil
+}
+
+// CreateTemplate records a project template
+func (db *DB) CreateTemplate(ctx context.Context, t *models.ProjectTemplate) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	if t.PipelineFilename == "" {
+		t.PipelineFilename = "pipeline.yml"
+	}
+	variables, environments, err := db.templateValues(ctx, t)
+	if err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO project_templates (owner_id, organization_id, name, description, pipeline_filename, pipeline_content, variables, environments)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at
+	`
+	err = db.conn.QueryRowContext(ctx, query, t.OwnerID, t.OrganizationID, t.Name, t.Description, t.PipelineFilename, t.PipelineContent,
+		variables, environments).Scan(&t.ID, &t.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create template: %w", err)
+	}
+	return nil
+}
+
+// GetTemplate retrieves a project template
+func (db *DB) GetTemplate(ctx context.Context, id int) (*models.ProjectTemplate, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	t, err := db.scanTemplate(ctx, db.conn.QueryRowContext(ctx, `SELECT `+templateColumns+` FROM project_templates WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("template not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get template: %w", err)
+	}
+	return t, nil
+}
+
+// GetTemplatesForUser lists the templates of a user and of the organizations they belong to
+func (db *DB) GetTemplatesForUser(ctx context.Context, userID int) ([]models.ProjectTemplate, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+		SELECT ` + templateColumns + ` FROM project_templates
+		WHERE owner_id = $1 OR organization_id IN (` + userOrganizations + `)
+		ORDER BY name ASC, id ASC
+	`
+	rows, err := db.conn.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query templates: %w", err)
+	}
+	defer rows.Close()
+
+	var templates []models.ProjectTemplate
+	for rows.Next() {
+		t, err := db.scanTemplate(ctx, rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan template: %w", err)
+		}
+		templates = append(templates, *t)
+	}
+	return templates, rows.Err()
+}
+
+// UpdateTemplate replaces the content of a project template, its organization included
+func (db *DB) UpdateTemplate(ctx context.Context, t *models.ProjectTemplate) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	if t.PipelineFilename == "" {
+		t.PipelineFilename = "pipeline.yml"
+	}
+	variables, environments, err := db.templateValues(ctx, t)
+	if err != nil {
+		return err
+	}
+	query := `
+		UPDATE project_templates
+		SET organization_id = $1, name = $2, description = $3, pipeline_filename = $4, pipeline_content = $5, variables = $6, environments = $7
+		WHERE id = $8
+	`
+	result, err := db.conn.ExecContext(ctx, query, t.OrganizationID, t.Name, t.Description, t.PipelineFilename, t.PipelineContent,
+		variables, environments, t.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update template: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("template not found")
+	}
+	return nil
+}
+
+// DeleteTemplate removes a project template, the projects created from it are kept
+func (db *DB) DeleteTemplate(ctx context.Context, id int) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	result, err := db.conn.ExecContext(ctx, `DELETE FROM project_templates WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete template: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("template not found")
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package docker
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// CacheBuilder is the buildx builder used by builds exporting their layer cache
+// The default docker driver cannot export cache to a registry, this one uses the docker-container driver.
+const CacheBuilder = "cicd-builder"
+
+// EnsureCacheBuilder creates the CacheBuilder buildx builder unless it already exists
+func (e *DockerExecutor) EnsureCacheBuilder() error {
+	if err := exec.Command("docker", "buildx", "inspect", CacheBuilder).Run(); err == nil {
+		return nil
+	}
+
+	output, err := exec.Command("docker", "buildx", "create", "--name", CacheBuilder, "--driver", "docker-container").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("docker buildx create failed: %s - %w", string(output), err)
+	}
+	return nil
+}
@@ -1,13 +1,18 @@
 package docker
 
 import (
+	"bufio"
+	"cmp"
 	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
+	"os"
 	"os/exec"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/docker/docker/api/types/container"
@@ -15,12 +20,20 @@ import (
 	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/api/types/registry"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/tracing"
 )
 
 type DockerExecutor struct {
-	cli        *client.Client
+	cli *client.Client
+	// ctx is used by cleanup operations, which must complete even once the pipeline context is cancelled
 	ctx        context.Context
 	authConfig string
+	// host is the engine address of a remote executor, empty for the local engine
+	host string
 }
 
 func NewDockerExecutor() (*DockerExecutor, error) {
@@ -35,8 +48,60 @@ func NewDockerExecutor() (*DockerExecutor, error) {
 	}, nil
 }
 
-func (e *DockerExecutor) PullImage(imageName string) error {
-	reader, err := e.cli.ImagePull(e.ctx, imageName, image.PullOptions{})
+// NewRemoteExecutor returns an executor driving the engine listening at host, e.g. a forwarded socket
+// Its compose commands run the local CLI against that engine.
+func NewRemoteExecutor(host string) (*DockerExecutor, error) {
+	cli, err := client.NewClientWithOpts(client.WithHost(host), client.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, err
+	}
+	return &DockerExecutor{
+		cli:  cli,
+		ctx:  context.Background(),
+		host: host,
+	}, nil
+}
+
+// Close releases the connections of the engine client
+func (e *DockerExecutor) Close() error {
+	return e.cli.Close()
+}
+
+// command prepares a docker CLI command talking to the engine of the executor
+func (e *DockerExecutor) command(ctx context.Context, workDir string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "docker", args...)
+	cmd.Dir = workDir
+	if e.host != "" {
+		cmd.Env = append(os.Environ(), "DOCKER_HOST="+e.host)
+	}
+	return cmd
+}
+
+// Ping checks that the Docker daemon is reachable
+func (e *DockerExecutor) Ping(ctx context.Context) error {
+	_, err := e.cli.Ping(ctx)
+	return err
+}
+
+func (e *DockerExecutor) PullImage(ctx context.Context, imageName string) error {
+	return e.PullImageWithAuth(ctx, imageName, nil)
+}
+
+// PullImageWithAuth pulls an image from a private registry, auth being nil for anonymous pulls
+func (e *DockerExecutor) PullImageWithAuth(ctx context.Context, imageName string, auth *registry.AuthConfig) (err error) {
+	ctx, span := tracing.Start(ctx, "docker.pull", attribute.String("docker.image", imageName))
+	defer func() { tracing.End(span, err) }()
+
+	opts := image.PullOptions{}
+	if auth != nil {
+		encoded, err := registry.EncodeAuthConfig(*auth)
+		if err != nil {
+			return err
+		}
+		opts.RegistryAuth = encoded
+	}
+
+	reader, err := e.cli.ImagePull(ctx, imageName, opts)
 	if err != nil {
 		return err
 	}
@@ -100,36 +165,103 @@ func (e *DockerExecutor) PushImage(imageName string) error {
 	return err
 }
 
-// ComposeBuild builds the services defined in docker-compose.yml
-func (e *DockerExecutor) ComposeBuild(workDir, composeFile, overrideFile string) (string, error) {
-	args := []string{"compose", "-f", composeFile}
-	if overrideFile != "" {
-		args = append(args, "-f", overrideFile)
+// ComposeBuild builds the given services of the compose files with BuildKit, all of them when none is given
+// builder selects the buildx builder, empty for the default one
+func (e *DockerExecutor) ComposeBuild(ctx context.Context, workDir, builder string, composeFiles []string, services ...string) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "docker.compose.build", attribute.StringSlice("docker.services", services))
+	defer func() { tracing.End(span, err) }()
+	return e.composeBuild(ctx, workDir, builder, composeFiles, nil, services)
+}
+
+// ComposeBuildPush builds the given services and pushes them from the builder, as multi-platform images must be
+// They are not loaded into the engine, a manifest list not fitting its image store.
+func (e *DockerExecutor) ComposeBuildPush(ctx context.Context, workDir, builder string, composeFiles []string, services ...string) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "docker.compose.build", attribute.StringSlice("docker.services", services), attribute.Bool("docker.push", true))
+	defer func() { tracing.End(span, err) }()
+	return e.composeBuild(ctx, workDir, builder, composeFiles, []string{"--push"}, services)
+}
+
+func (e *DockerExecutor) composeBuild(ctx context.Context, workDir, builder string, composeFiles, buildArgs, services []string) (string, error) {
+	args := []string{"compose"}
+	for _, file := range composeFiles {
+		args = append(args, "-f", file)
 	}
 	args = append(args, "build")
+	args = append(args, buildArgs...)
+	args = append(args, services...)
 
-	cmd := exec.Command("docker", args...)
+	cmd := exec.CommandContext(ctx, "docker", args...)
 	cmd.Dir = workDir
+	cmd.Env = append(os.Environ(), "DOCKER_BUILDKIT=1", "COMPOSE_DOCKER_CLI_BUILD=1")
+	if builder != "" {
+		cmd.Env = append(cmd.Env, "BUILDX_BUILDER="+builder)
+	}
 	output, err := cmd.CombinedOutput()
 	return string(output), err
 }
 
-// ComposePush pushes the services defined in docker-compose.yml
-func (e *DockerExecutor) ComposePush(workDir, composeFile, overrideFile string) (string, error) {
+// ComposePush pushes the given services defined in docker-compose.yml, all of them when none is given
+func (e *DockerExecutor) ComposePush(ctx context.Context, workDir, composeFile, overrideFile string, services ...string) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "docker.compose.push", attribute.StringSlice("docker.services", services))
+	defer func() { tracing.End(span, err) }()
+
 	args := []string{"compose", "-f", composeFile}
 	if overrideFile != "" {
 		args = append(args, "-f", overrideFile)
 	}
 	args = append(args, "push")
+	args = append(args, services...)
 
-	cmd := exec.Command("docker", args...)
+	cmd := exec.CommandContext(ctx, "docker", args...)
 	cmd.Dir = workDir
 	output, err := cmd.CombinedOutput()
 	return string(output), err
 }
 
+// PushImages pushes images with the docker CLI, one after the other, stopping at the first failure
+// Unlike PushImage, a failure reported in the push output is returned as an error.
+func (e *DockerExecutor) PushImages(ctx context.Context, images ...string) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "docker.push", attribute.StringSlice("docker.images", images))
+	defer func() { tracing.End(span, err) }()
+
+	var logs strings.Builder
+	for _, imageName := range images {
+		output, err := e.command(ctx, "", "push", imageName).CombinedOutput()
+		logs.Write(output)
+		if err != nil {
+			return logs.String(), fmt.Errorf("docker push %s failed: %w", imageName, err)
+		}
+	}
+	return logs.String(), nil
+}
+
+// CacheMountPath is where a job's cache directory is mounted inside its container
+const CacheMountPath = "/cicd-cache"
+
+// DockerSocketPath is the host Docker socket, mounted into jobs needing Docker
+const DockerSocketPath = "/var/run/docker.sock"
+
+// JobOptions holds the optional settings of a job container
+type JobOptions struct {
+	// CacheDir is a host directory mounted at CacheMountPath, empty for none
+	CacheDir string
+	// DockerSocket mounts the host Docker socket into the container
+	DockerSocket bool
+	// Network is the network the container joins instead of the default bridge
+	Network string
+	// Privileged gives the container all the host capabilities and devices
+	Privileged bool
+	// Entrypoint replaces the image entrypoint, []string{""} clears it
+	Entrypoint []string
+	// WorkingDir is the directory of the container the commands run in, /workspace when empty
+	WorkingDir string
+}
+
 // RunJobWithVolume runs a job with a workspace directory mounted into the container
-func (e *DockerExecutor) RunJobWithVolume(imageName string, commands []string, workspacePath string, envVars []string) (string, error) {
+func (e *DockerExecutor) RunJobWithVolume(ctx context.Context, imageName string, commands []string, workspacePath string, envVars []string, opts JobOptions) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "docker.start", attribute.String("docker.image", imageName))
+	defer func() { tracing.End(span, err) }()
+
 	// On concatène les commandes avec " && " pour qu'elles s'exécutent séquentiellement
 	cmdString := strings.Join(commands, " && ")
 
@@ -137,8 +269,10 @@ func (e *DockerExecutor) RunJobWithVolume(imageName string, commands []string, w
 	containerConfig := &container.Config{
 		Image:      imageName,
 		Cmd:        []string{"sh", "-c", cmdString},
-		WorkingDir: "/workspace",
+		WorkingDir: cmp.Or(opts.WorkingDir, "/workspace"),
 		Env:        envVars,
+		Labels:     map[string]string{LabelJob: "true"},
+		Entrypoint: opts.Entrypoint,
 	}
 
 	// Configuration de l'hôte avec le volume monté
@@ -151,28 +285,106 @@ func (e *DockerExecutor) RunJobWithVolume(imageName string, commands []string, w
 			},
 		},
 	}
+	if opts.CacheDir != "" {
+		hostConfig.Mounts = append(hostConfig.Mounts, mount.Mount{
+			Type:   mount.TypeBind,
+			Source: opts.CacheDir,
+			Target: CacheMountPath,
+		})
+	}
+	if opts.DockerSocket {
+		hostConfig.Mounts = append(hostConfig.Mounts, mount.Mount{
+			Type:   mount.TypeBind,
+			Source: DockerSocketPath,
+			Target: DockerSocketPath,
+		})
+	}
+	hostConfig.Privileged = opts.Privileged
+	if opts.Network != "" {
+		hostConfig.NetworkMode = container.NetworkMode(opts.Network)
+	}
 
 	// Créer le conteneur
-	resp, err := e.cli.ContainerCreate(e.ctx, containerConfig, hostConfig, nil, nil, "")
+	resp, err := e.cli.ContainerCreate(ctx, containerConfig, hostConfig, nil, nil, "")
 	if err != nil {
 		return "", err
 	}
 
 	// Démarrer le conteneur
-	err = e.cli.ContainerStart(e.ctx, resp.ID, container.StartOptions{})
-	return resp.ID, err
+	if err := e.cli.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
+		e.RemoveContainer(resp.ID)
+		return "", err
+	}
+	return resp.ID, nil
 }
 
-func (e *DockerExecutor) GetLogs(containerID string) (io.ReadCloser, error) {
-	return e.cli.ContainerLogs(e.ctx, containerID, container.LogsOptions{
+func (e *DockerExecutor) GetLogs(ctx context.Context, containerID string) (io.ReadCloser, error) {
+	return e.cli.ContainerLogs(ctx, containerID, container.LogsOptions{
 		ShowStdout: true,
 		ShowStderr: true,
 		Follow:     true, // Important pour le temps réel
+		Timestamps: true,
 	})
 }
 
-func (e *DockerExecutor) WaitForContainer(containerID string) (int64, error) {
-	statusCh, errCh := e.cli.ContainerWait(e.ctx, containerID, container.WaitConditionNotRunning)
+// maxLogLineSize is the longest log line read from a container
+const maxLogLineSize = 1024 * 1024
+
+// FollowLogs streams the output of a container line by line, the channel being closed once it exits
+// Lines carry the stream they were written to and the time Docker received them.
+func (e *DockerExecutor) FollowLogs(ctx context.Context, containerID string) (<-chan models.LogLine, error) {
+	reader, err := e.GetLogs(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Demultiplex the docker stream, stdout and stderr each getting their own pipe
+	stdoutR, stdoutW := io.Pipe()
+	stderrR, stderrW := io.Pipe()
+	go func() {
+		_, err := stdcopy.StdCopy(stdoutW, stderrW, reader)
+		stdoutW.CloseWithError(err)
+		stderrW.CloseWithError(err)
+		reader.Close()
+	}()
+
+	lines := make(chan models.LogLine)
+	var wg sync.WaitGroup
+	scan := func(r io.Reader, stream string) {
+		defer wg.Done()
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), maxLogLineSize)
+		for scanner.Scan() {
+			createdAt, content := splitLogTimestamp(scanner.Text())
+			lines <- models.LogLine{Content: content, Stream: stream, CreatedAt: createdAt}
+		}
+		// A line too long for the scanner must not block the container output
+		io.Copy(io.Discard, r)
+	}
+	wg.Add(2)
+	go scan(stdoutR, models.LogStreamStdout)
+	go scan(stderrR, models.LogStreamStderr)
+	go func() {
+		wg.Wait()
+		close(lines)
+	}()
+	return lines, nil
+}
+
+// splitLogTimestamp separates the timestamp Docker prefixes log lines with from their content
+func splitLogTimestamp(line string) (time.Time, string) {
+	stamp, content, found := strings.Cut(line, " ")
+	if t, err := time.Parse(time.RFC3339Nano, stamp); found && err == nil {
+		return t, content
+	}
+	return time.Now(), line
+}
+
+func (e *DockerExecutor) WaitForContainer(ctx context.Context, containerID string) (_ int64, err error) {
+	ctx, span := tracing.Start(ctx, "docker.wait", attribute.String("docker.container", containerID))
+	defer func() { tracing.End(span, err) }()
+
+	statusCh, errCh := e.cli.ContainerWait(ctx, containerID, container.WaitConditionNotRunning)
 	select {
 	case err := <-errCh:
 		return 0, err
@@ -181,6 +393,14 @@ func (e *DockerExecutor) WaitForContainer(containerID string) (int64, error) {
 	}
 }
 
+// StopContainer stops a running container, killing it after a short grace period
+func (e *DockerExecutor) StopContainer(containerID string) error {
+	timeout := 5
+	return e.cli.ContainerStop(e.ctx, containerID, container.StopOptions{
+		Timeout: &timeout,
+	})
+}
+
 // RemoveContainer removes a container (cleanup)
 func (e *DockerExecutor) RemoveContainer(containerID string) error {
 	return e.cli.ContainerRemove(e.ctx, containerID, container.RemoveOptions{
@@ -189,17 +409,33 @@ func (e *DockerExecutor) RemoveContainer(containerID string) error {
 }
 
 // DeployCompose deploys using docker-compose with rollback capability
-func (e *DockerExecutor) DeployCompose(workDir, composeFile, projectName string) (string, error) {
+// Cancelling ctx aborts the deployment, the rollback itself always runs to completion
+func (e *DockerExecutor) DeployCompose(ctx context.Context, workDir, composeFile, projectName string) (string, error) {
+	return e.deployCompose(ctx, workDir, projectName, []string{composeFile}, "--build")
+}
+
+// DeployComposeFiles deploys the pushed images of compose files like DeployCompose, without building them
+func (e *DockerExecutor) DeployComposeFiles(ctx context.Context, workDir, projectName string, composeFiles ...string) (string, error) {
+	return e.deployCompose(ctx, workDir, projectName, composeFiles)
+}
+
+// deployCompose pulls and starts the services of compose files, restoring the previous images when they fail
+func (e *DockerExecutor) deployCompose(ctx context.Context, workDir, projectName string, composeFiles []string, upArgs ...string) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "docker.compose.deploy", attribute.String("docker.project", projectName))
+	defer func() { tracing.End(span, err) }()
+
 	var logs strings.Builder
 	
 	baseArgs := []string{"compose"}
 	if projectName != "" {
 		baseArgs = append(baseArgs, "-p", projectName)
 	}
-	baseArgs = append(baseArgs, "-f", composeFile)
+	for _, file := range composeFiles {
+		baseArgs = append(baseArgs, "-f", file)
+	}
 
 	// 1. Snapshot: Identify currently running containers and tag their images
-	backupImages, err := e.backupContainers(workDir, baseArgs, &logs)
+	backupImages, err := e.backupContainers(ctx, workDir, baseArgs, &logs)
 	if err != nil {
 		// Log but don't fail, we just won't have rollback
 		logs.WriteString(fmt.Sprintf("Backup warning: %v\n", err))
@@ -216,12 +452,12 @@ func (e *DockerExecutor) DeployCompose(workDir, composeFile, projectName string)
 	}
 
 	// 2. Pull
-	if err := e.runComposeCommand(workDir, append(baseArgs, "pull"), &logs); err != nil {
+	if err := e.runComposeCommand(ctx, workDir, append(baseArgs, "pull"), &logs); err != nil {
 		return logs.String(), fmt.Errorf("docker compose pull failed: %w", err)
 	}
 
 	// 3. Up
-	if err := e.runComposeCommand(workDir, append(baseArgs, "up", "-d", "--build"), &logs); err != nil {
+	if err := e.runComposeCommand(ctx, workDir, append(append(slices.Clone(baseArgs), "up", "-d"), upArgs...), &logs); err != nil {
 		// Attempt to resolve container name conflicts automatically
 		// Note: The original logic for conflict resolution was complex and specific.
 		// For clarity, I am simplifying to standard rollback behavior on failure.
@@ -232,7 +468,7 @@ func (e *DockerExecutor) DeployCompose(workDir, composeFile, projectName string)
 	}
 
 	// 4. Health Check
-	if err := e.checkDeploymentHealth(workDir, baseArgs, &logs); err != nil {
+	if err := e.checkDeploymentHealth(ctx, workDir, baseArgs, &logs); err != nil {
 		performRollback()
 		return logs.String(), err
 	}
@@ -243,10 +479,26 @@ func (e *DockerExecutor) DeployCompose(workDir, composeFile, projectName string)
 	return logs.String(), nil
 }
 
+// ComposeDown stops and removes the containers and networks of a compose project, and its volumes when volumes is set
+// Compose finds them by their project label, the compose files of the deployment are not needed.
+func (e *DockerExecutor) ComposeDown(ctx context.Context, projectName string, volumes bool) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "docker.compose.down", attribute.String("docker.project", projectName))
+	defer func() { tracing.End(span, err) }()
+
+	args := []string{"compose", "-p", projectName, "down", "--remove-orphans"}
+	if volumes {
+		args = append(args, "--volumes")
+	}
+	var logs strings.Builder
+	if err := e.runComposeCommand(ctx, "", args, &logs); err != nil {
+		return logs.String(), fmt.Errorf("docker compose down failed: %w", err)
+	}
+	return logs.String(), nil
+}
+
 // backupContainers identifies running containers and tags them for rollback
-func (e *DockerExecutor) backupContainers(workDir string, baseArgs []string, logs *strings.Builder) (map[string]string, error) {
-	cmdPs := exec.Command("docker", append(baseArgs, "ps", "-q")...)
-	cmdPs.Dir = workDir
+func (e *DockerExecutor) backupContainers(ctx context.Context, workDir string, baseArgs []string, logs *strings.Builder) (map[string]string, error) {
+	cmdPs := e.command(ctx, workDir, append(baseArgs, "ps", "-q")...)
 	output, err := cmdPs.Output()
 	if err != nil {
 		return nil, err
@@ -257,7 +509,7 @@ func (e *DockerExecutor) backupContainers(workDir string, baseArgs []string, log
 		containerIDs := strings.Split(strings.TrimSpace(string(output)), "\n")
 		for _, cid := range containerIDs {
 			if cid == "" { continue }
-			info, err := e.cli.ContainerInspect(e.ctx, cid)
+			info, err := e.cli.ContainerInspect(ctx, cid)
 			if err != nil {
 				continue
 			}
@@ -285,7 +537,7 @@ func (e *DockerExecutor) restoreBackup(workDir string, baseArgs []string, backup
 	}
 
 	argsRollback := append(baseArgs, "up", "-d", "--force-recreate")
-	if err := e.runComposeCommand(workDir, argsRollback, logs); err != nil {
+	if err := e.runComposeCommand(e.ctx, workDir, argsRollback, logs); err != nil {
 		logs.WriteString(fmt.Sprintf("Rollback failed: %v\n", err))
 	} else {
 		logs.WriteString("Rollback successful.\n")
@@ -300,21 +552,19 @@ func (e *DockerExecutor) cleanupBackups(backupImages map[string]string) {
 }
 
 // runComposeCommand executes a docker compose command and writes output to logs
-func (e *DockerExecutor) runComposeCommand(workDir string, args []string, logs *strings.Builder) error {
-	cmd := exec.Command("docker", args...)
-	cmd.Dir = workDir
+func (e *DockerExecutor) runComposeCommand(ctx context.Context, workDir string, args []string, logs *strings.Builder) error {
+	cmd := e.command(ctx, workDir, args...)
 	output, err := cmd.CombinedOutput()
 	logs.Write(output)
 	return err
 }
 
 // checkDeploymentHealth monitors service health
-func (e *DockerExecutor) checkDeploymentHealth(workDir string, baseArgs []string, logs *strings.Builder) error {
+func (e *DockerExecutor) checkDeploymentHealth(ctx context.Context, workDir string, baseArgs []string, logs *strings.Builder) error {
 	logs.WriteString("Starting deployment health check...\n")
 
 	// Get expected services
-	cmdServices := exec.Command("docker", append(baseArgs, "config", "--services")...)
-	cmdServices.Dir = workDir
+	cmdServices := e.command(ctx, workDir, append(baseArgs, "config", "--services")...)
 	outServices, err := cmdServices.Output()
 	if err != nil {
 		return fmt.Errorf("could not determine services from compose file: %w", err)
@@ -336,10 +586,13 @@ func (e *DockerExecutor) checkDeploymentHealth(workDir string, baseArgs []string
 	defer ticker.Stop()
 
 	for time.Now().Before(deadline) {
-		<-ticker.C
-		
-		cmdHealth := exec.Command("docker", append(baseArgs, "ps", "--all", "--format", "json")...)
-		cmdHealth.Dir = workDir
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		cmdHealth := e.command(ctx, workDir, append(baseArgs, "ps", "--all", "--format", "json")...)
 		outHealth, err := cmdHealth.Output()
 		if err != nil {
 			logs.WriteString(fmt.Sprintf("Health check 'ps' command failed: %v\n", err))
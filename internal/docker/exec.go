@@ -0,0 +1,62 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+)
+
+// ExecSession is a command run with a terminal in a running container, see Exec
+// Reads return the terminal output, writes go to its input.
+type ExecSession struct {
+	e    *DockerExecutor
+	id   string
+	conn types.HijackedResponse
+}
+
+// Exec starts cmd in a running container with a terminal, in the workspace
+func (e *DockerExecutor) Exec(ctx context.Context, containerID string, cmd []string) (*ExecSession, error) {
+	created, err := e.cli.ContainerExecCreate(ctx, containerID, container.ExecOptions{
+		Cmd:          cmd,
+		Tty:          true,
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+		WorkingDir:   "/workspace",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create exec: %w", err)
+	}
+	conn, err := e.cli.ContainerExecAttach(ctx, created.ID, container.ExecAttachOptions{Tty: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to attach exec: %w", err)
+	}
+	return &ExecSession{e: e, id: created.ID, conn: conn}, nil
+}
+
+func (s *ExecSession) Read(p []byte) (int, error) {
+	return s.conn.Reader.Read(p)
+}
+
+func (s *ExecSession) Write(p []byte) (int, error) {
+	return s.conn.Conn.Write(p)
+}
+
+// Resize sets the size of the terminal
+func (s *ExecSession) Resize(ctx context.Context, rows, cols uint) error {
+	return s.e.cli.ContainerExecResize(ctx, s.id, container.ResizeOptions{Height: rows, Width: cols})
+}
+
+// Close ends the session, the command getting a hangup
+func (s *ExecSession) Close() error {
+	s.conn.Close()
+	return nil
+}
+
+// FileExists reports whether path exists in a container
+func (e *DockerExecutor) FileExists(ctx context.Context, containerID, path string) bool {
+	_, err := e.cli.ContainerStatPath(ctx, containerID, path)
+	return err == nil
+}
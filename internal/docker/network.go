@@ -0,0 +1,24 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docker/docker/api/types/network"
+)
+
+// CreateNetwork creates a bridge network for the containers of a job or a pipeline
+func (e *DockerExecutor) CreateNetwork(ctx context.Context, name string) error {
+	if _, err := e.cli.NetworkCreate(ctx, name, network.CreateOptions{Driver: "bridge", Labels: map[string]string{LabelJob: "true"}}); err != nil {
+		return fmt.Errorf("failed to create network %s: %w", name, err)
+	}
+	return nil
+}
+
+// RemoveNetwork removes a network created by CreateNetwork
+func (e *DockerExecutor) RemoveNetwork(name string) error {
+	if err := e.cli.NetworkRemove(e.ctx, name); err != nil {
+		return fmt.Errorf("failed to remove network %s: %w", name, err)
+	}
+	return nil
+}
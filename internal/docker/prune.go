@@ -0,0 +1,59 @@
+package docker
+
+import (
+	"fmt"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+)
+
+// LabelJob marks the containers created for pipeline jobs and their services
+const LabelJob = "cicd.job"
+
+// PruneJobContainers removes the stopped job containers created more than 10 minutes ago
+// It returns the number of containers removed and the disk space reclaimed in bytes.
+func (e *DockerExecutor) PruneJobContainers() (int, uint64, error) {
+	report, err := e.cli.ContainersPrune(e.ctx, filters.NewArgs(
+		filters.Arg("label", LabelJob),
+		filters.Arg("until", "10m"),
+	))
+	if err != nil {
+		return 0, 0, err
+	}
+	return len(report.ContainersDeleted), report.SpaceReclaimed, nil
+}
+
+// RemoveJobContainers force removes every job container, running or not, and the unused job networks
+// Only meant for startup, when no job can be running anymore. It returns the number of containers removed.
+func (e *DockerExecutor) RemoveJobContainers() (int, error) {
+	containers, err := e.cli.ContainerList(e.ctx, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", LabelJob)),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, c := range containers {
+		if err := e.cli.ContainerRemove(e.ctx, c.ID, container.RemoveOptions{Force: true, RemoveVolumes: true}); err != nil {
+			return removed, fmt.Errorf("failed to remove container %s: %w", c.ID, err)
+		}
+		removed++
+	}
+
+	if _, err := e.cli.NetworksPrune(e.ctx, filters.NewArgs(filters.Arg("label", LabelJob))); err != nil {
+		return removed, fmt.Errorf("failed to prune job networks: %w", err)
+	}
+	return removed, nil
+}
+
+// PruneDanglingImages removes untagged images, left behind by rebuilt tags
+// It returns the number of images deleted and the disk space reclaimed in bytes.
+func (e *DockerExecutor) PruneDanglingImages() (int, uint64, error) {
+	report, err := e.cli.ImagesPrune(e.ctx, filters.NewArgs(filters.Arg("dangling", "true")))
+	if err != nil {
+		return 0, 0, err
+	}
+	return len(report.ImagesDeleted), report.SpaceReclaimed, nil
+}
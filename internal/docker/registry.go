@@ -0,0 +1,33 @@
+package docker
+
+import "strings"
+
+// DockerHubRegistry is the registry of images without a registry host
+const DockerHubRegistry = "docker.io"
+
+// RegistryHost returns the host of a registry URL, Docker Hub when it is empty
+// e.g. registry.gitlab.com for https://registry.gitlab.com/group/project
+func RegistryHost(registryURL string) string {
+	registryURL = strings.TrimPrefix(strings.TrimPrefix(registryURL, "https://"), "http://")
+	host, _, _ := strings.Cut(registryURL, "/")
+	if host == "" || host == "index.docker.io" {
+		return DockerHubRegistry
+	}
+	return host
+}
+
+// ImageRegistry returns the registry host of an image reference, e.g. ghcr.io for ghcr.io/org/app:1.0
+func ImageRegistry(imageName string) string {
+	first, _, found := strings.Cut(imageName, "/")
+	if !found {
+		return DockerHubRegistry
+	}
+	// Like the Docker CLI, the first component is a host only if it looks like one
+	if first == "localhost" || strings.ContainsAny(first, ".:") {
+		if first == "index.docker.io" || first == "registry-1.docker.io" {
+			return DockerHubRegistry
+		}
+		return first
+	}
+	return DockerHubRegistry
+}
@@ -0,0 +1,30 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// SyftImage generates the SBOMs of the images built by deployments
+const SyftImage = "anchore/syft:latest"
+
+// GenerateSBOM returns the CycloneDX JSON SBOM of an image of the engine
+// syft runs in a container reading the image through the Docker socket, falling back to the registry when the engine does not have it.
+func (e *DockerExecutor) GenerateSBOM(ctx context.Context, imageName string) (_ []byte, err error) {
+	ctx, span := tracing.Start(ctx, "docker.sbom", attribute.String("docker.image", imageName))
+	defer func() { tracing.End(span, err) }()
+
+	var stdout, stderr bytes.Buffer
+	cmd := e.command(ctx, "", "run", "--rm", "-v", DockerSocketPath+":"+DockerSocketPath, SyftImage,
+		imageName, "--quiet", "-o", "cyclonedx-json")
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("syft failed: %s - %w", strings.TrimSpace(stderr.String()), err)
+	}
+	return stdout.Bytes(), nil
+}
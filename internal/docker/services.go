@@ -0,0 +1,100 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+)
+
+// DindImage is the image of the Docker daemon started for dind jobs
+const DindImage = "docker:dind"
+
+// DindHost is the DOCKER_HOST a job uses to reach its dind service
+const DindHost = "tcp://docker:2375"
+
+// DindService is a Docker daemon reachable by a single job container
+type DindService struct {
+	ContainerID string
+	Network     string
+}
+
+// StartDindService starts a docker:dind daemon on a dedicated network, reachable as "docker" from containers of that network
+func (e *DockerExecutor) StartDindService(ctx context.Context, name string) (*DindService, error) {
+	if err := e.PullImage(ctx, DindImage); err != nil {
+		return nil, fmt.Errorf("failed to pull %s: %w", DindImage, err)
+	}
+
+	if err := e.CreateNetwork(ctx, name); err != nil {
+		return nil, err
+	}
+	service := &DindService{Network: name}
+
+	containerConfig := &container.Config{
+		Image: DindImage,
+		// Plain TCP on 2375, the daemon is only reachable from the job network
+		Env:    []string{"DOCKER_TLS_CERTDIR="},
+		Labels: map[string]string{LabelJob: "true"},
+	}
+	hostConfig := &container.HostConfig{
+		Privileged:  true,
+		NetworkMode: container.NetworkMode(name),
+	}
+	networkingConfig := &network.NetworkingConfig{
+		EndpointsConfig: map[string]*network.EndpointSettings{
+			name: {Aliases: []string{"docker"}},
+		},
+	}
+
+	resp, err := e.cli.ContainerCreate(ctx, containerConfig, hostConfig, networkingConfig, nil, name)
+	if err != nil {
+		e.StopDindService(service)
+		return nil, fmt.Errorf("failed to create dind container: %w", err)
+	}
+	service.ContainerID = resp.ID
+
+	if err := e.cli.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
+		e.StopDindService(service)
+		return nil, fmt.Errorf("failed to start dind container: %w", err)
+	}
+
+	return service, nil
+}
+
+// StartService starts a sidecar container of a job on a network, reachable from the containers of that network at its aliases
+// The container is removed like job containers, with RemoveContainer.
+func (e *DockerExecutor) StartService(ctx context.Context, imageName, networkName string, aliases, cmd, envVars []string) (string, error) {
+	containerConfig := &container.Config{
+		Image:  imageName,
+		Cmd:    cmd,
+		Env:    envVars,
+		Labels: map[string]string{LabelJob: "true"},
+	}
+	hostConfig := &container.HostConfig{NetworkMode: container.NetworkMode(networkName)}
+	networkingConfig := &network.NetworkingConfig{
+		EndpointsConfig: map[string]*network.EndpointSettings{
+			networkName: {Aliases: aliases},
+		},
+	}
+
+	resp, err := e.cli.ContainerCreate(ctx, containerConfig, hostConfig, networkingConfig, nil, "")
+	if err != nil {
+		return "", fmt.Errorf("failed to create service container: %w", err)
+	}
+	if err := e.cli.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
+		e.RemoveContainer(resp.ID)
+		return "", fmt.Errorf("failed to start service container: %w", err)
+	}
+	return resp.ID, nil
+}
+
+// StopDindService removes a dind daemon, its volumes and its network
+func (e *DockerExecutor) StopDindService(service *DindService) error {
+	if service.ContainerID != "" {
+		if err := e.cli.ContainerRemove(e.ctx, service.ContainerID, container.RemoveOptions{Force: true, RemoveVolumes: true}); err != nil {
+			return fmt.Errorf("failed to remove dind container: %w", err)
+		}
+	}
+	return e.RemoveNetwork(service.Network)
+}
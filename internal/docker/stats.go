@@ -0,0 +1,81 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+)
+
+// SampleUsage follows the resource usage of a running container until the returned function is called
+// The function returns the CPU time and disk I/O of the last sample and the peak memory of all samples, nil when none was read.
+func (e *DockerExecutor) SampleUsage(ctx context.Context, containerID string) func() *models.ResourceUsage {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	var usage *models.ResourceUsage
+
+	go func() {
+		defer close(done)
+		stats, err := e.cli.ContainerStats(ctx, containerID, true)
+		if err != nil {
+			return
+		}
+		defer stats.Body.Close()
+
+		decoder := json.NewDecoder(stats.Body)
+		for {
+			var s container.StatsResponse
+			if err := decoder.Decode(&s); err != nil {
+				return
+			}
+			// A stopped container reports empty samples
+			if s.CPUStats.CPUUsage.TotalUsage == 0 {
+				continue
+			}
+			if usage == nil {
+				usage = &models.ResourceUsage{}
+			}
+			usage.CPUSeconds = max(usage.CPUSeconds, float64(s.CPUStats.CPUUsage.TotalUsage)/1e9)
+			usage.PeakMemoryBytes = max(usage.PeakMemoryBytes, memoryUsage(s.MemoryStats))
+			read, write := blockIO(s.BlkioStats)
+			usage.IOReadBytes = max(usage.IOReadBytes, read)
+			usage.IOWriteBytes = max(usage.IOWriteBytes, write)
+		}
+	}()
+
+	return func() *models.ResourceUsage {
+		cancel()
+		<-done
+		return usage
+	}
+}
+
+// memoryUsage returns the memory used by a container without its reclaimable page cache, as docker stats shows it
+func memoryUsage(stats container.MemoryStats) int64 {
+	used := max(stats.Usage, stats.MaxUsage)
+	// cgroup v1 reports total_inactive_file, cgroup v2 inactive_file
+	inactive, ok := stats.Stats["total_inactive_file"]
+	if !ok {
+		inactive = stats.Stats["inactive_file"]
+	}
+	if inactive < used {
+		used -= inactive
+	}
+	return int64(used)
+}
+
+// blockIO returns the bytes a container read from and wrote to block devices
+func blockIO(stats container.BlkioStats) (read, write int64) {
+	for _, entry := range stats.IoServiceBytesRecursive {
+		switch strings.ToLower(entry.Op) {
+		case "read":
+			read += int64(entry.Value)
+		case "write":
+			write += int64(entry.Value)
+		}
+	}
+	return read, write
+}
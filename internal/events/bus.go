@@ -0,0 +1,278 @@
+package events
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+)
+
+// Event types
+const (
+	TypePipeline   = "pipeline"
+	TypeJob        = "job"
+	TypeDeployment = "deployment"
+)
+
+// subscriberBuffer is the number of events buffered per subscriber before new ones are dropped
+// Terminal events are never dropped, they wait in the backlog of the subscriber instead
+const subscriberBuffer = 64
+
+// outgoingBuffer is the number of events waiting to be sent to the backend before new ones are only delivered locally
+const outgoingBuffer = 256
+
+// backendRetryInterval is the pause before reconnecting to a backend whose subscription ended
+const backendRetryInterval = 5 * time.Second
+
+// Event is a status transition of a pipeline, job or deployment
+type Event struct {
+	Type       string    `json:"type"`
+	ID         int       `json:"id"`
+	ProjectID  int       `json:"project_id"`
+	PipelineID int       `json:"pipeline_id"`
+	Status     string    `json:"status"`
+	Timestamp  time.Time `json:"timestamp"`
+	// Remote marks the events published by another instance sharing the backend
+	// Side effects such as notifications are left to the instance that published the event.
+	Remote bool `json:"-"`
+}
+
+// Backend relays the events of the buses of several instances
+// Publish sends a message to every subscriber, including the publishing instance,
+// and Subscribe passes the received messages to handle until ctx is done or the connection is lost.
+type Backend interface {
+	Publish(ctx context.Context, message []byte) error
+	Subscribe(ctx context.Context, handle func(message []byte)) error
+}
+
+// BackendFromURL creates the backend of a redis://, rediss://, nats:// or tls:// (NATS over TLS) URL,
+// channel being the Redis channel or NATS subject the events go through
+func BackendFromURL(rawURL, channel string) (Backend, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid event bus URL: %w", err)
+	}
+	switch u.Scheme {
+	case "redis", "rediss":
+		return NewRedisBackend(u, channel), nil
+	case "nats", "tls":
+		return NewNATSBackend(u, channel), nil
+	}
+	return nil, fmt.Errorf("unsupported event bus URL scheme %q, expected redis, rediss, nats or tls", u.Scheme)
+}
+
+// envelope is an event as sent to the backend, with the instance that published it
+type envelope struct {
+	Origin string `json:"origin"`
+	Event  Event  `json:"event"`
+}
+
+// Terminal reports whether a status ends its pipeline, job or deployment
+func Terminal(status string) bool {
+	switch status {
+	case "success", "failed", "cancelled", "skipped", "rolled_back", "stopped":
+		return true
+	}
+	return false
+}
+
+// subscriber is the channel of a subscriber, and the terminal events that did not fit in it
+type subscriber struct {
+	ch chan Event
+
+	mu sync.Mutex
+	// backlog holds terminal events in order until pump moves them to ch
+	backlog []Event
+	wake    chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// pump moves the backlog to the channel of the subscriber as it reads, until it unsubscribes
+func (s *subscriber) pump() {
+	defer close(s.stopped)
+	for {
+		s.mu.Lock()
+		if len(s.backlog) == 0 {
+			s.mu.Unlock()
+			select {
+			case <-s.wake:
+				continue
+			case <-s.done:
+				return
+			}
+		}
+		event := s.backlog[0]
+		s.mu.Unlock()
+
+		select {
+		case s.ch <- event:
+			s.mu.Lock()
+			s.backlog = s.backlog[1:]
+			s.mu.Unlock()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// send delivers an event without blocking, keeping terminal events for later when the subscriber lags
+// Other events are dropped while it lags, so they do not overtake the terminal events waiting
+func (s *subscriber) send(event Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.backlog) == 0 {
+		select {
+		case s.ch <- event:
+			return
+		default:
+		}
+	}
+	if !Terminal(event.Status) {
+		return
+	}
+	s.backlog = append(s.backlog, event)
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Bus is an in-process publish/subscribe hub for status events, optionally shared with other instances through a Backend
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers map[int]*subscriber
+	nextID      int
+
+	// origin identifies this instance in the messages of the backend
+	origin   string
+	backend  Backend
+	outgoing chan Event
+}
+
+// NewBus creates an empty event bus
+func NewBus() *Bus {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return &Bus{
+		subscribers: make(map[int]*subscriber),
+		origin:      hex.EncodeToString(b),
+	}
+}
+
+// SetBackend shares the events of the bus with the other instances using backend, once Run is started
+func (b *Bus) SetBackend(backend Backend) {
+	b.backend = backend
+	b.outgoing = make(chan Event, outgoingBuffer)
+}
+
+// Run relays events between the bus and its backend until ctx is done, it returns at once without a backend
+func (b *Bus) Run(ctx context.Context) {
+	if b.backend == nil {
+		return
+	}
+	go b.send(ctx)
+
+	for {
+		err := b.backend.Subscribe(ctx, b.receive)
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Warn(fmt.Sprintf("Event bus backend subscription lost, retrying: %v", err))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backendRetryInterval):
+		}
+	}
+}
+
+// send publishes the local events to the backend
+func (b *Bus) send(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-b.outgoing:
+			message, err := json.Marshal(envelope{Origin: b.origin, Event: event})
+			if err != nil {
+				continue
+			}
+			if err := b.backend.Publish(ctx, message); err != nil {
+				logger.Warn(fmt.Sprintf("Failed to publish %s %d event to the backend: %v", event.Type, event.ID, err))
+			}
+		}
+	}
+}
+
+// receive delivers the events of other instances to the local subscribers
+func (b *Bus) receive(message []byte) {
+	var e envelope
+	if err := json.Unmarshal(message, &e); err != nil || e.Origin == b.origin {
+		return
+	}
+	e.Event.Remote = true
+	b.deliver(e.Event)
+}
+
+// Subscribe registers a new subscriber
+// The returned function unsubscribes and closes the channel
+func (b *Bus) Subscribe() (<-chan Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.nextID
+	b.nextID++
+	sub := &subscriber{
+		ch:      make(chan Event, subscriberBuffer),
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	b.subscribers[id] = sub
+	go sub.pump()
+
+	return sub.ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[id]; ok {
+			delete(b.subscribers, id)
+			close(sub.done)
+			<-sub.stopped
+			close(sub.ch)
+		}
+	}
+}
+
+// Publish sends an event to every subscriber, and to the backend, without blocking
+// Slow subscribers whose buffer is full miss the event, unless it is terminal, see subscriber.send
+func (b *Bus) Publish(event Event) {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+	b.deliver(event)
+
+	if b.outgoing != nil {
+		select {
+		case b.outgoing <- event:
+		default:
+			logger.Warn(fmt.Sprintf("Event bus backend is lagging, %s %d event only delivered locally", event.Type, event.ID))
+		}
+	}
+}
+
+// deliver sends an event to the local subscribers
+func (b *Bus) deliver(event Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, sub := range b.subscribers {
+		sub.send(event)
+	}
+}
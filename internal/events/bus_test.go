@@ -0,0 +1,131 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryBackend relays messages between the buses of a test, like a Redis channel
+type memoryBackend struct {
+	mu       sync.Mutex
+	handlers []func([]byte)
+}
+
+func (m *memoryBackend) Publish(ctx context.Context, message []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, handle := range m.handlers {
+		handle(message)
+	}
+	return nil
+}
+
+func (m *memoryBackend) Subscribe(ctx context.Context, handle func([]byte)) error {
+	m.mu.Lock()
+	m.handlers = append(m.handlers, handle)
+	m.mu.Unlock()
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func receive(t *testing.T, ch <-chan Event) (Event, bool) {
+	t.Helper()
+	select {
+	case event := <-ch:
+		return event, true
+	case <-time.After(200 * time.Millisecond):
+		return Event{}, false
+	}
+}
+
+func TestBusBackend(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	backend := &memoryBackend{}
+	local, remote := NewBus(), NewBus()
+	local.SetBackend(backend)
+	remote.SetBackend(backend)
+	go local.Run(ctx)
+	go remote.Run(ctx)
+	for deadline := time.Now().Add(time.Second); ; {
+		backend.mu.Lock()
+		n := len(backend.handlers)
+		backend.mu.Unlock()
+		if n == 2 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	localCh, unsubscribeLocal := local.Subscribe()
+	defer unsubscribeLocal()
+	remoteCh, unsubscribeRemote := remote.Subscribe()
+	defer unsubscribeRemote()
+
+	local.Publish(Event{Type: TypeJob, ID: 7, Status: "success"})
+
+	event, ok := receive(t, localCh)
+	if !ok || event.ID != 7 || event.Remote {
+		t.Errorf("Expected the local event once, got %+v (received: %v)", event, ok)
+	}
+	if event, ok := receive(t, localCh); ok {
+		t.Errorf("Expected the event echoed by the backend to be skipped, got %+v", event)
+	}
+
+	event, ok = receive(t, remoteCh)
+	if !ok || event.ID != 7 || !event.Remote {
+		t.Errorf("Expected the event relayed as remote, got %+v (received: %v)", event, ok)
+	}
+}
+
+func TestBusSlowSubscriber(t *testing.T) {
+	bus := NewBus()
+	ch, unsubscribe := bus.Subscribe()
+	defer unsubscribe()
+
+	for i := 0; i < subscriberBuffer; i++ {
+		bus.Publish(Event{Type: TypeJob, ID: i, Status: "running"})
+	}
+	bus.Publish(Event{Type: TypeJob, ID: 100, Status: "running"})
+	bus.Publish(Event{Type: TypeJob, ID: 101, Status: "success"})
+	bus.Publish(Event{Type: TypePipeline, ID: 102, Status: "failed"})
+
+	for i := 0; i < subscriberBuffer; i++ {
+		if event, ok := receive(t, ch); !ok || event.ID != i {
+			t.Fatalf("Expected buffered event %d, got %+v (received: %v)", i, event, ok)
+		}
+	}
+	for _, id := range []int{101, 102} {
+		if event, ok := receive(t, ch); !ok || event.ID != id {
+			t.Errorf("Expected terminal event %d to be kept, got %+v (received: %v)", id, event, ok)
+		}
+	}
+	if event, ok := receive(t, ch); ok {
+		t.Errorf("Expected the non-terminal event to be dropped, got %+v", event)
+	}
+}
+
+func TestReadReply(t *testing.T) {
+	input := "*3\r\n$7\r\nmessage\r\n$11\r\ncicd-events\r\n$5\r\nhello\r\n-ERR wrong\r\n:1\r\n"
+	r := bufio.NewReader(strings.NewReader(input))
+
+	reply, err := readReply(r)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	parts, ok := reply.([]any)
+	if !ok || len(parts) != 3 || parts[0] != "message" || parts[2] != "hello" {
+		t.Errorf("Expected a pushed message, got %#v", reply)
+	}
+	if _, err := readReply(r); err == nil || err.Error() != "ERR wrong" {
+		t.Errorf("Expected the error reply, got %v", err)
+	}
+	if reply, err := readReply(r); err != nil || reply != int64(1) {
+		t.Errorf("Expected integer 1, got %#v (%v)", reply, err)
+	}
+}
@@ -0,0 +1,177 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NATSBackend relays events over a NATS subject, speaking the NATS client protocol directly
+type NATSBackend struct {
+	addr     string
+	tls      bool
+	user     string
+	password string
+	subject  string
+
+	// The publishing connection, opened on first use and after an error
+	mu   sync.Mutex
+	conn *natsConn
+}
+
+// natsConn is a connection whose writes are serialized, the server pings having to be answered while publishing
+type natsConn struct {
+	net.Conn
+	reader *bufio.Reader
+	mu     sync.Mutex
+}
+
+func (c *natsConn) send(data string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.SetWriteDeadline(time.Now().Add(backendTimeout))
+	_, err := io.WriteString(c.Conn, data)
+	return err
+}
+
+// NewNATSBackend creates a backend for a nats://[user:password@]host[:port] or tls:// URL
+func NewNATSBackend(u *url.URL, subject string) *NATSBackend {
+	n := &NATSBackend{addr: u.Host, tls: u.Scheme == "tls", subject: subject}
+	if u.Port() == "" {
+		n.addr = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	if u.User != nil {
+		n.user = u.User.Username()
+		n.password, _ = u.User.Password()
+	}
+	return n
+}
+
+// dial opens a connection and completes the INFO/CONNECT handshake
+func (n *NATSBackend) dial(ctx context.Context) (*natsConn, error) {
+	ctx, cancel := context.WithTimeout(ctx, backendTimeout)
+	defer cancel()
+
+	var conn net.Conn
+	var err error
+	if n.tls {
+		conn, err = (&tls.Dialer{}).DialContext(ctx, "tcp", n.addr)
+	} else {
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", n.addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &natsConn{Conn: conn, reader: bufio.NewReader(conn)}
+	conn.SetDeadline(time.Now().Add(backendTimeout))
+
+	if line, err := c.reader.ReadString('\n'); err != nil || !strings.HasPrefix(line, "INFO ") {
+		conn.Close()
+		return nil, fmt.Errorf("invalid NATS greeting: %w", errors.Join(err, errors.New(strings.TrimSpace(line))))
+	}
+	options, _ := json.Marshal(map[string]any{"verbose": false, "pedantic": false, "name": "cicd-engine", "user": n.user, "pass": n.password})
+	if err := c.send("CONNECT " + string(options) + "\r\nPING\r\n"); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// The server answers the PING once it accepted the connection, or sends an error
+	line, err := c.reader.ReadString('\n')
+	if err != nil || strings.TrimSpace(line) != "PONG" {
+		conn.Close()
+		return nil, fmt.Errorf("NATS connection refused: %w", errors.Join(err, errors.New(strings.TrimSpace(line))))
+	}
+	conn.SetDeadline(time.Time{})
+	return c, nil
+}
+
+func (n *NATSBackend) Publish(ctx context.Context, message []byte) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.conn == nil {
+		c, err := n.dial(ctx)
+		if err != nil {
+			return err
+		}
+		n.conn = c
+		go n.keepAlive(c)
+	}
+	err := n.conn.send("PUB " + n.subject + " " + strconv.Itoa(len(message)) + "\r\n" + string(message) + "\r\n")
+	if err != nil {
+		n.conn.Close()
+		n.conn = nil
+	}
+	return err
+}
+
+// keepAlive answers the pings of the server on the publishing connection, dropping the connection once it fails
+func (n *NATSBackend) keepAlive(c *natsConn) {
+	for {
+		line, err := c.reader.ReadString('\n')
+		if err == nil && strings.TrimSpace(line) == "PING" {
+			err = c.send("PONG\r\n")
+		}
+		if err != nil {
+			c.Close()
+			n.mu.Lock()
+			if n.conn == c {
+				n.conn = nil
+			}
+			n.mu.Unlock()
+			return
+		}
+	}
+}
+
+func (n *NATSBackend) Subscribe(ctx context.Context, handle func(message []byte)) error {
+	c, err := n.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	stop := context.AfterFunc(ctx, func() { c.Close() })
+	defer stop()
+
+	if err := c.send("SUB " + n.subject + " 1\r\n"); err != nil {
+		return err
+	}
+	for {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "PING":
+			if err := c.send("PONG\r\n"); err != nil {
+				return err
+			}
+		case "-ERR":
+			return errors.New(strings.TrimSpace(line))
+		case "MSG":
+			// MSG <subject> <sid> [reply-to] <size>
+			size, err := strconv.Atoi(fields[len(fields)-1])
+			if err != nil || size < 0 {
+				return fmt.Errorf("invalid NATS message %q", strings.TrimSpace(line))
+			}
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(c.reader, payload); err != nil {
+				return err
+			}
+			handle(payload[:size])
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// backendTimeout bounds the connection to a backend and the sending of one message
+const backendTimeout = 5 * time.Second
+
+// RedisBackend relays events over a Redis pub/sub channel, speaking the RESP protocol directly
+type RedisBackend struct {
+	addr     string
+	tls      bool
+	username string
+	password string
+	channel  string
+
+	// The publishing connection, opened on first use and after an error
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// NewRedisBackend creates a backend for a redis://[user:password@]host[:port] or rediss:// URL
+func NewRedisBackend(u *url.URL, channel string) *RedisBackend {
+	r := &RedisBackend{addr: u.Host, tls: u.Scheme == "rediss", channel: channel}
+	if u.Port() == "" {
+		r.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		r.username = u.User.Username()
+		r.password, _ = u.User.Password()
+	}
+	return r
+}
+
+// dial opens an authenticated connection
+func (r *RedisBackend) dial(ctx context.Context) (net.Conn, *bufio.Reader, error) {
+	ctx, cancel := context.WithTimeout(ctx, backendTimeout)
+	defer cancel()
+
+	var conn net.Conn
+	var err error
+	if r.tls {
+		conn, err = (&tls.Dialer{}).DialContext(ctx, "tcp", r.addr)
+	} else {
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", r.addr)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	reader := bufio.NewReader(conn)
+
+	if r.password != "" {
+		args := []string{"AUTH", r.password}
+		if r.username != "" {
+			args = []string{"AUTH", r.username, r.password}
+		}
+		conn.SetDeadline(time.Now().Add(backendTimeout))
+		if err := writeCommand(conn, args...); err == nil {
+			_, err = readReply(reader)
+		}
+		if err != nil {
+			conn.Close()
+			return nil, nil, fmt.Errorf("redis authentication failed: %w", err)
+		}
+		conn.SetDeadline(time.Time{})
+	}
+	return conn, reader, nil
+}
+
+func (r *RedisBackend) Publish(ctx context.Context, message []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.conn == nil {
+		conn, reader, err := r.dial(ctx)
+		if err != nil {
+			return err
+		}
+		r.conn, r.reader = conn, reader
+	}
+	r.conn.SetDeadline(time.Now().Add(backendTimeout))
+	err := writeCommand(r.conn, "PUBLISH", r.channel, string(message))
+	if err == nil {
+		_, err = readReply(r.reader)
+	}
+	if err != nil {
+		r.conn.Close()
+		r.conn = nil
+	}
+	return err
+}
+
+func (r *RedisBackend) Subscribe(ctx context.Context, handle func(message []byte)) error {
+	conn, reader, err := r.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	if err := writeCommand(conn, "SUBSCRIBE", r.channel); err != nil {
+		return err
+	}
+	for {
+		reply, err := readReply(reader)
+		if err != nil {
+			return err
+		}
+		// Pushed messages are ["message", channel, payload], the others confirm the subscription
+		if parts, ok := reply.([]any); ok && len(parts) == 3 && parts[0] == "message" {
+			if payload, ok := parts[2].(string); ok {
+				handle([]byte(payload))
+			}
+		}
+	}
+}
+
+// writeCommand sends a command as a RESP array of bulk strings
+func writeCommand(w io.Writer, args ...string) error {
+	buf := []byte("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		buf = append(buf, "$"+strconv.Itoa(len(arg))+"\r\n"+arg+"\r\n"...)
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+// readReply reads a RESP reply: strings and bulk strings as string, integers as int64, arrays as []any
+// Error replies are returned as errors.
+func readReply(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 {
+		return nil, fmt.Errorf("invalid redis reply %q", line)
+	}
+	kind, value := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return value, nil
+	case '-':
+		return nil, errors.New(value)
+	case ':':
+		return strconv.ParseInt(value, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		parts := make([]any, n)
+		for i := range parts {
+			if parts[i], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return parts, nil
+	}
+	return nil, fmt.Errorf("invalid redis reply %q", line)
+}
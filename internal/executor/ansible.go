@@ -0,0 +1,207 @@
+package executor
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/docker"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ansibleImage is the default image playbooks run in, ANSIBLE_IMAGE replacing it
+const ansibleImage = "alpine/ansible:latest"
+
+// ansibleDir is the directory of the ansible container the keys, inventory and variables are written to, out of the workspace
+const ansibleDir = "/tmp/cicd-ansible"
+
+// deployAnsible runs the deployment file of the project as a playbook against its SSH hosts, in a container of ANSIBLE_IMAGE
+// The inventory holds the SSH host and the ssh_hosts of the environment in the deploy group, reached with the user, key and bastion
+// of the project. Keys, inventory and variables reach the container through its environment, its script writing them to ansibleDir.
+func (e *DeploymentExecutor) deployAnsible(ctx context.Context, project *models.Project, params models.PipelineRunParams, workspaceDir string, dLogger *DeploymentLogger) (err error) {
+	ctx, span := tracing.Start(ctx, "ansible.deploy", attribute.String("cicd.ssh.host", project.SSHHost), attribute.String("cicd.deployment.method", models.DeploymentMethodAnsible))
+	defer func() { tracing.End(span, err) }()
+
+	dLogger.Log("Using Ansible deployment flow")
+	if project.SSHHost == "" {
+		err = fmt.Errorf("the ansible deployment method needs an SSH host")
+		dLogger.Log(err.Error())
+		return err
+	}
+	playbook := params.DeploymentFilename
+	if !filepath.IsLocal(playbook) {
+		err = fmt.Errorf("invalid playbook path %q", playbook)
+		dLogger.Log(err.Error())
+		return err
+	}
+	if _, statErr := os.Stat(filepath.Join(workspaceDir, playbook)); statErr != nil {
+		err = fmt.Errorf("playbook %s not found in the repository", playbook)
+		dLogger.Log(err.Error())
+		return err
+	}
+	if params.DeploymentStrategy == models.StrategyCanary {
+		dLogger.Log("Canary deployments are not run by the ansible deployment method, the playbook deploys every host")
+	}
+	if len(params.PreDeploy) > 0 || len(params.PostDeploy) > 0 {
+		dLogger.Log("Deploy hooks are not run by the ansible deployment method, the playbook can run them as tasks")
+	}
+
+	variables, secretValues, err := e.deploymentVariables(ctx, project, params)
+	if err != nil {
+		dLogger.Log(err.Error())
+		return err
+	}
+	dLogger.addSecrets(secretValues)
+	extraVars := map[string]interface{}{}
+	for key, value := range variables {
+		extraVars[key] = value
+	}
+	extraVars["ci_pipeline_id"] = params.PipelineID
+	extraVars["ci_project_name"] = params.RepoName
+	extraVars["ci_commit_sha"] = params.CommitHash
+	extraVars["ci_commit_branch"] = params.Branch
+	extraVars["ci_environment"] = params.Environment
+	extraVars["ci_compose_project"] = composeProjectName(params)
+	extraVars["ci_rollout_batch_size"] = max(params.RolloutBatchSize, 1)
+	varsJSON, err := json.Marshal(extraVars)
+	if err != nil {
+		return err
+	}
+	inventory, err := json.Marshal(ansibleInventory(project, params.SSHHosts))
+	if err != nil {
+		return err
+	}
+
+	env := map[string]string{
+		"CICD_SSH_KEY":                project.SSHPrivateKey,
+		"CICD_ANSIBLE_INVENTORY":      string(inventory),
+		"CICD_ANSIBLE_VARS":           string(varsJSON),
+		"ANSIBLE_FORCE_COLOR":         "true",
+		"ANSIBLE_RETRY_FILES_ENABLED": "false",
+	}
+	script := []string{
+		"umask 077",
+		"mkdir -p " + ansibleDir,
+		`printf '%s\n' "$CICD_SSH_KEY" > ` + ansibleDir + "/id_key",
+		`printf '%s' "$CICD_ANSIBLE_INVENTORY" > ` + ansibleDir + "/inventory.yml",
+		`printf '%s' "$CICD_ANSIBLE_VARS" > ` + ansibleDir + "/vars.json",
+	}
+	if _, bastion := SSHEndpoints(project); bastion != nil {
+		env["CICD_BASTION_KEY"] = bastion.PrivateKey
+		script = append(script, `printf '%s\n' "$CICD_BASTION_KEY" > `+ansibleDir+"/bastion_key")
+	}
+	// Host keys are checked like the other deployments, against SSH_KNOWN_HOSTS when set
+	if knownHosts := os.Getenv("SSH_KNOWN_HOSTS"); knownHosts != "" {
+		content, err := os.ReadFile(knownHosts)
+		if err != nil {
+			err = fmt.Errorf("failed to read known hosts: %w", err)
+			dLogger.Log(err.Error())
+			return err
+		}
+		env["CICD_KNOWN_HOSTS"] = string(content)
+		script = append(script, `printf '%s' "$CICD_KNOWN_HOSTS" > `+ansibleDir+"/known_hosts")
+	}
+	script = append(script, fmt.Sprintf("ansible-playbook -i %s/inventory.yml -e @%s/vars.json %s",
+		ansibleDir, ansibleDir, shellQuote(path.Join("/workspace", filepath.ToSlash(playbook)))))
+
+	image := cmp.Or(os.Getenv("ANSIBLE_IMAGE"), ansibleImage)
+	dLogger.Log(fmt.Sprintf("Running playbook %s with %s", playbook, image))
+	if err := e.docker.PullImage(ctx, image); err != nil {
+		err = fmt.Errorf("failed to pull %s: %w", image, err)
+		dLogger.Log(err.Error())
+		return err
+	}
+
+	// The playbook directory holds the ansible.cfg and roles of the repository
+	opts := docker.JobOptions{
+		WorkingDir: path.Join("/workspace", path.Dir(filepath.ToSlash(playbook))),
+		Entrypoint: []string{""},
+	}
+	containerID, err := e.docker.RunJobWithVolume(ctx, image, script, workspaceDir, envList(env), opts)
+	if err != nil {
+		err = fmt.Errorf("failed to start the ansible container: %w", err)
+		dLogger.Log(err.Error())
+		return err
+	}
+	defer e.docker.RemoveContainer(containerID)
+	stop := context.AfterFunc(ctx, func() { e.docker.StopContainer(containerID) })
+	defer stop()
+
+	// Read until the container exits, a cancelled deployment stopping it
+	lines, err := e.docker.FollowLogs(context.WithoutCancel(ctx), containerID)
+	if err != nil {
+		dLogger.Log(fmt.Sprintf("Failed to follow the ansible output: %v", err))
+	} else {
+		dLogger.Log("=== ANSIBLE LOGS ===")
+		for line := range lines {
+			dLogger.Log(SanitizeLogLine(line.Content))
+		}
+	}
+	code, err := e.docker.WaitForContainer(context.WithoutCancel(ctx), containerID)
+	if ctx.Err() != nil {
+		dLogger.Log("Ansible deployment cancelled")
+		return ctx.Err()
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to wait for the ansible container: %w", err)
+		dLogger.Log(err.Error())
+		return err
+	}
+	if code != 0 {
+		err = fmt.Errorf("ansible-playbook exited with code %d", code)
+		dLogger.Log(err.Error())
+		return err
+	}
+	return nil
+}
+
+// ansibleInventory returns the inventory of an ansible deployment, the SSH host of the project then the other hosts, in the deploy group
+func ansibleInventory(project *models.Project, hosts []string) map[string]interface{} {
+	deployHosts := make(map[string]interface{})
+	for _, host := range append([]string{project.SSHHost}, hosts...) {
+		vars := map[string]interface{}{"ansible_host": host}
+		if name, port, err := net.SplitHostPort(host); err == nil {
+			vars["ansible_host"] = name
+			if n, err := strconv.Atoi(port); err == nil {
+				vars["ansible_port"] = n
+			}
+		}
+		deployHosts[host] = vars
+	}
+
+	target, bastion := SSHEndpoints(project)
+	sshArgs := "-o StrictHostKeyChecking=no -o UserKnownHostsFile=/dev/null"
+	if os.Getenv("SSH_KNOWN_HOSTS") != "" {
+		sshArgs = "-o StrictHostKeyChecking=yes -o UserKnownHostsFile=" + ansibleDir + "/known_hosts"
+	}
+	groupVars := map[string]interface{}{
+		"ansible_user":                 target.User,
+		"ansible_ssh_private_key_file": ansibleDir + "/id_key",
+	}
+	commonArgs := sshArgs
+	if bastion != nil {
+		bastionHost, bastionPort := bastion.Host, "22"
+		if name, port, err := net.SplitHostPort(bastion.Host); err == nil {
+			bastionHost, bastionPort = name, port
+		}
+		commonArgs += fmt.Sprintf(` -o ProxyCommand="ssh -q -i %s/bastion_key %s -p %s -W %%h:%%p %s@%s"`,
+			ansibleDir, sshArgs, bastionPort, bastion.User, bastionHost)
+	}
+	groupVars["ansible_ssh_common_args"] = commonArgs
+
+	return map[string]interface{}{
+		"all": map[string]interface{}{
+			"children": map[string]interface{}{
+				"deploy": map[string]interface{}{"hosts": deployHosts, "vars": groupVars},
+			},
+		},
+	}
+}
@@ -0,0 +1,113 @@
+package executor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+)
+
+// inventoryGroup returns the hosts and vars of the deploy group of an inventory
+func inventoryGroup(t *testing.T, inventory map[string]interface{}) (map[string]interface{}, map[string]interface{}) {
+	t.Helper()
+	children := inventory["all"].(map[string]interface{})["children"].(map[string]interface{})
+	group := children["deploy"].(map[string]interface{})
+	return group["hosts"].(map[string]interface{}), group["vars"].(map[string]interface{})
+}
+
+func TestAnsibleInventory(t *testing.T) {
+	t.Setenv("SSH_KNOWN_HOSTS", "")
+
+	t.Run("HostPort", func(t *testing.T) {
+		project := &models.Project{SSHHost: "web1.example.com", SSHUser: "deploy"}
+		hosts, vars := inventoryGroup(t, ansibleInventory(project, []string{"10.0.0.2:2222"}))
+
+		if len(hosts) != 2 {
+			t.Fatalf("Expected 2 hosts, got %d", len(hosts))
+		}
+		first := hosts["web1.example.com"].(map[string]interface{})
+		if first["ansible_host"] != "web1.example.com" || first["ansible_port"] != nil {
+			t.Errorf("Expected the host without a port, got %v", first)
+		}
+		second := hosts["10.0.0.2:2222"].(map[string]interface{})
+		if second["ansible_host"] != "10.0.0.2" || second["ansible_port"] != 2222 {
+			t.Errorf("Expected the host split from its port, got %v", second)
+		}
+		if vars["ansible_user"] != "deploy" || vars["ansible_ssh_private_key_file"] != ansibleDir+"/id_key" {
+			t.Errorf("Expected the user and key of the project, got %v", vars)
+		}
+		if args := vars["ansible_ssh_common_args"].(string); strings.Contains(args, "ProxyCommand") {
+			t.Errorf("Expected no ProxyCommand without a bastion, got %q", args)
+		}
+	})
+
+	t.Run("Bastion", func(t *testing.T) {
+		project := &models.Project{SSHHost: "10.0.0.1", SSHUser: "deploy", SSHBastionHost: "bastion.example.com"}
+		_, vars := inventoryGroup(t, ansibleInventory(project, nil))
+		args := vars["ansible_ssh_common_args"].(string)
+		if !strings.Contains(args, ` -o ProxyCommand="ssh -q -i `+ansibleDir+`/bastion_key `) ||
+			!strings.HasSuffix(args, `-p 22 -W %h:%p deploy@bastion.example.com"`) {
+			t.Errorf("Expected a ProxyCommand through port 22 as the target user, got %q", args)
+		}
+
+		project.SSHBastionHost, project.SSHBastionUser = "bastion.example.com:2200", "jump"
+		_, vars = inventoryGroup(t, ansibleInventory(project, nil))
+		if args := vars["ansible_ssh_common_args"].(string); !strings.HasSuffix(args, `-p 2200 -W %h:%p jump@bastion.example.com"`) {
+			t.Errorf("Expected a ProxyCommand through port 2200 as jump, got %q", args)
+		}
+	})
+
+	t.Run("KnownHosts", func(t *testing.T) {
+		project := &models.Project{SSHHost: "10.0.0.1", SSHUser: "deploy", SSHBastionHost: "bastion.example.com"}
+		_, vars := inventoryGroup(t, ansibleInventory(project, nil))
+		if args := vars["ansible_ssh_common_args"].(string); !strings.HasPrefix(args, "-o StrictHostKeyChecking=no -o UserKnownHostsFile=/dev/null") {
+			t.Errorf("Expected host keys unchecked without SSH_KNOWN_HOSTS, got %q", args)
+		}
+
+		t.Setenv("SSH_KNOWN_HOSTS", "10.0.0.1 ssh-ed25519 AAAA")
+		_, vars = inventoryGroup(t, ansibleInventory(project, nil))
+		args := vars["ansible_ssh_common_args"].(string)
+		checked := "-o StrictHostKeyChecking=yes -o UserKnownHostsFile=" + ansibleDir + "/known_hosts"
+		if !strings.HasPrefix(args, checked) || strings.Count(args, checked) != 2 || strings.Contains(args, "/dev/null") {
+			t.Errorf("Expected host keys checked for the target and the bastion, got %q", args)
+		}
+	})
+}
+
+func TestDeployAnsiblePlaybookPath(t *testing.T) {
+	workspaceDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(workspaceDir, "site.yml"), []byte("- hosts: deploy\n"), 0644); err != nil {
+		t.Fatalf("Expected no error writing the playbook, got %v", err)
+	}
+	e := &DeploymentExecutor{feed: NewDeploymentLogFeed()}
+
+	tests := []struct {
+		name     string
+		host     string
+		playbook string
+		want     string
+	}{
+		{"NoHost", "", "site.yml", "needs an SSH host"},
+		{"Parent", "10.0.0.1", "../site.yml", `invalid playbook path "../site.yml"`},
+		{"Absolute", "10.0.0.1", filepath.Join(workspaceDir, "site.yml"), "invalid playbook path"},
+		{"Missing", "10.0.0.1", "deploy/missing.yml", "playbook deploy/missing.yml not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			project := &models.Project{SSHHost: tt.host, SSHUser: "deploy"}
+			params := models.PipelineRunParams{DeploymentFilename: tt.playbook}
+			dLogger := &DeploymentLogger{}
+
+			err := e.deployAnsible(context.Background(), project, params, workspaceDir, dLogger)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Expected an error containing %q, got %v", tt.want, err)
+			}
+			if !strings.Contains(dLogger.String(), tt.want) {
+				t.Errorf("Expected the error in the deployment logs, got %q", dLogger.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package executor
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"path"
+
+	"github.com/docker/docker/api/types/registry"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/docker"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/parser/pipeline"
+)
+
+// Default images of the build job builders, the kaniko debug image providing the shell the job runs in
+const (
+	kanikoImage  = "gcr.io/kaniko-project/executor:debug"
+	buildahImage = "quay.io/buildah/stable"
+)
+
+// JobTypeBuild builds and pushes an image with kaniko or buildah, without Docker daemon
+// Properties: builder (kaniko or buildah), context, dockerfile, and destination or service.
+const JobTypeBuild = "build"
+
+// Builders of build jobs
+const (
+	BuilderKaniko  = "kaniko"
+	BuilderBuildah = "buildah"
+)
+
+// registryAuthVariable holds the Docker config with the push credentials of a build job
+const registryAuthVariable = "CICD_REGISTRY_AUTH"
+
+// buildJobType runs the build jobs, see JobTypeBuild
+type buildJobType struct{}
+
+func init() {
+	RegisterJobType(buildJobType{})
+}
+
+func (buildJobType) Info() JobTypeInfo {
+	return JobTypeInfo{
+		Name:        JobTypeBuild,
+		Description: "Builds and pushes an image with kaniko or buildah, without Docker daemon",
+		Image:       kanikoImage,
+		Properties: []JobTypeProperty{
+			{Name: "builder", Description: "kaniko (default) or buildah"},
+			{Name: "context", Description: "Build context, a repository directory"},
+			{Name: "dockerfile", Description: "Dockerfile path in the context, Dockerfile by default"},
+			{Name: "destination", Description: "Image pushed, required without service"},
+			{Name: "service", Description: "Compose service the deployment image is pushed for, required without destination"},
+		},
+	}
+}
+
+// Validate checks the builder of a build job and that it pushes to a destination or for a service
+func (buildJobType) Validate(name string, jobs map[string]pipeline.JobConfig) error {
+	props := jobs[name].Properties
+	switch props["builder"] {
+	case "", BuilderKaniko, BuilderBuildah:
+	default:
+		return fmt.Errorf("builder invalide %q (kaniko ou buildah)", props["builder"])
+	}
+	if props["destination"] == "" && props["service"] == "" {
+		return fmt.Errorf("un job build nécessite destination ou service")
+	}
+	return nil
+}
+
+// Prepare turns a build job into the builder image and script building and pushing its image
+// The destination defaults to the deployment image of the compose service named by the service property.
+func (buildJobType) Prepare(j *JobRun) pipeline.JobConfig {
+	job, vars := j.Config, j.Vars
+	props := job.Properties
+	destination := pipeline.Interpolate(props["destination"], vars)
+	if destination == "" {
+		destination = j.ServiceImage(props["service"])
+	}
+
+	contextDir := path.Join("/workspace", pipeline.Interpolate(props["context"], vars))
+	dockerfile := props["dockerfile"]
+	if dockerfile == "" {
+		dockerfile = "Dockerfile"
+	}
+	dockerfile = path.Join(contextDir, pipeline.Interpolate(dockerfile, vars))
+
+	// Push credentials are passed through a variable the script writes to the builder auth file
+	authFile := ""
+	if auth := j.RegistryAuth(destination); auth != nil {
+		if content, err := dockerConfigJSON(*auth); err == nil {
+			vars[registryAuthVariable] = content
+			authFile = "/tmp/cicd-auth.json"
+			if job.Properties["builder"] != BuilderBuildah {
+				authFile = "/kaniko/.docker/config.json"
+			}
+		}
+	}
+
+	var script []string
+	if authFile != "" {
+		script = append(script,
+			"mkdir -p "+shellQuote(path.Dir(authFile)),
+			fmt.Sprintf(`printf '%%s' "$%s" > %s`, registryAuthVariable, shellQuote(authFile)))
+	}
+
+	if props["builder"] == BuilderBuildah {
+		if job.Image == "" {
+			job.Image = buildahImage
+		}
+		// chroot isolation and vfs storage let buildah run in an unprivileged container
+		push := "buildah push --storage-driver vfs"
+		if authFile != "" {
+			push += " --authfile " + shellQuote(authFile)
+		}
+		script = append(script,
+			fmt.Sprintf("buildah build --isolation chroot --storage-driver vfs -f %s -t %s %s", shellQuote(dockerfile), shellQuote(destination), shellQuote(contextDir)),
+			push+" "+shellQuote(destination))
+	} else {
+		if job.Image == "" {
+			job.Image = kanikoImage
+		}
+		script = append(script, fmt.Sprintf("/kaniko/executor --context %s --dockerfile %s --destination %s",
+			shellQuote("dir://"+contextDir), shellQuote(dockerfile), shellQuote(destination)))
+	}
+
+	// The kaniko and buildah image entrypoints are the tools themselves, the job script runs in their shell instead
+	job.Entrypoint = []string{""}
+	job.BeforeScript = nil
+	job.Script = script
+	return job
+}
+
+// Finish does nothing, the image being pushed by the job script
+func (buildJobType) Finish(ctx context.Context, j *JobRun) error {
+	return nil
+}
+
+// dockerConfigJSON returns a Docker config file authenticating against a single registry
+func dockerConfigJSON(auth registry.AuthConfig) (string, error) {
+	server := auth.ServerAddress
+	if server == docker.DockerHubRegistry {
+		// The key Docker Hub credentials are looked up with
+		server = "https://index.docker.io/v1/"
+	}
+	config := map[string]map[string]map[string]string{
+		"auths": {
+			server: {"auth": base64.StdEncoding.EncodeToString([]byte(auth.Username + ":" + auth.Password))},
+		},
+	}
+	content, err := json.Marshal(config)
+	return string(content), err
+}
@@ -0,0 +1,24 @@
+package executor
+
+import (
+	"testing"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/parser/pipeline"
+)
+
+func TestBuildValidate(t *testing.T) {
+	for name, tt := range map[string]struct {
+		props map[string]string
+		valid bool
+	}{
+		"destination":    {map[string]string{"destination": "registry.example.com/app"}, true},
+		"service":        {map[string]string{"builder": BuilderBuildah, "service": "app"}, true},
+		"no destination": {map[string]string{"builder": BuilderKaniko}, false},
+		"builder":        {map[string]string{"builder": "docker", "destination": "registry.example.com/app"}, false},
+	} {
+		jobs := map[string]pipeline.JobConfig{"image": {Type: JobTypeBuild, Properties: tt.props}}
+		if err := (buildJobType{}).Validate("image", jobs); (err == nil) != tt.valid {
+			t.Errorf("Expected %s to be valid: %v, got %v", name, tt.valid, err)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package executor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/docker"
+)
+
+// cacheArchive is the archive holding a cache inside its mounted directory
+const cacheArchive = docker.CacheMountPath + "/cache.tar.gz"
+
+var unsafeCacheKeyChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// projectCacheDir returns the host directory storing a project's cache for a key, creating it if needed
+// The root directory is CACHE_DIR, /tmp/cicd-cache by default
+func projectCacheDir(projectID int, key string) (string, error) {
+	root := os.Getenv("CACHE_DIR")
+	if root == "" {
+		root = filepath.Join("/tmp", "cicd-cache")
+	}
+
+	key = unsafeCacheKeyChars.ReplaceAllString(key, "_")
+	if key == "" || strings.Trim(key, ".") == "" {
+		key = "default"
+	}
+
+	dir := filepath.Join(root, fmt.Sprintf("project-%d", projectID), key)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	return dir, nil
+}
+
+// wrapWithCache surrounds the job commands with the restore and save of the cached paths
+// The cache is only saved when every command succeeded, and cache errors never fail the job
+// Jobs sharing a cache key save it at the same time: each writes its own temporary archive next to the cache
+// and renames it over, so a restore reads either archive whole.
+func wrapWithCache(commands []string, paths []string) []string {
+	var archived []string
+	for _, p := range paths {
+		archived = append(archived, cacheArchivePath(p))
+	}
+	files := strings.Join(archived, " ")
+
+	restore := fmt.Sprintf(`{ [ ! -f %[1]s ] || tar -xzf %[1]s -C / || echo "WARNING: failed to restore cache"; }`, cacheArchive)
+	save := fmt.Sprintf(`{ cicd_cache_tmp=$(mktemp %[1]s.XXXXXX) && tar -czf "$cicd_cache_tmp" -C / %[2]s && chmod 644 "$cicd_cache_tmp" && mv -f "$cicd_cache_tmp" %[1]s || { rm -f "$cicd_cache_tmp"; echo "WARNING: failed to save cache"; }; }`, cacheArchive, files)
+
+	wrapped := append([]string{restore}, commands...)
+	return append(wrapped, save)
+}
+
+// cacheArchivePath converts a cached path into a shell word relative to the container root
+// Relative paths are resolved against the workspace, ~/ against the container user's home
+func cacheArchivePath(p string) string {
+	switch {
+	case p == "~" || strings.HasPrefix(p, "~/"):
+		return `"${HOME#/}"` + shellQuote(strings.TrimPrefix(p, "~"))
+	case strings.HasPrefix(p, "/"):
+		return shellQuote(strings.TrimPrefix(filepath.Clean(p), "/"))
+	default:
+		return shellQuote(filepath.Join("workspace", p))
+	}
+}
+
+// shellQuote quotes a string for a POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,103 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/parser/compose"
+)
+
+// ErrCanaryAborted reports a canary whose replicas failed, the stable replicas having kept serving
+var ErrCanaryAborted = errors.New("canary aborted, the stable version is still running")
+
+// canaryAbortedMarker is printed by canaryScript when it removed unhealthy canary replicas
+const canaryAbortedMarker = "--- Canary Aborted ---"
+
+// canaryOverrideFilename attaches the canary project to the networks of the stable one
+const canaryOverrideFilename = "docker-compose.canary.yml"
+
+const canaryScript = `#!/bin/bash
+set -e # Stop script on first error
+
+echo "--- CANARY DEPLOYMENT SCRIPT ---"
+
+PN=$1
+CF=$2
+OF=$3
+KF=$4
+BAKE=$5
+shift 5
+# Remaining arguments: <service>=<canary replicas>
+
+STABLE=(docker compose -p "$PN" -f "$CF" -f "$OF")
+CANARY=(docker compose -p "$PN-canary" -f "$CF" -f "$OF" -f "$KF")
+
+if [ -z "$("${STABLE[@]}" ps -q)" ]; then
+    echo "No stable version running, deploying every replica"
+    exec ./deploy.sh "$PN" "$CF" "$OF"
+fi
+
+SERVICES=()
+SCALE=()
+for spec in "$@"; do
+    SERVICES+=("${spec%%=*}")
+    SCALE+=(--scale "$spec")
+done
+
+abort() {
+    echo "$1"
+    "${CANARY[@]}" logs "${SERVICES[@]}" || true
+    "${CANARY[@]}" down --remove-orphans || true
+    echo "` + canaryAbortedMarker + `"
+    exit 1
+}
+
+echo "Pulling new images..."
+"${CANARY[@]}" pull "${SERVICES[@]}"
+
+echo "Starting canary replicas of ${SERVICES[*]}..."
+"${CANARY[@]}" up -d --no-deps --wait "${SCALE[@]}" "${SERVICES[@]}" || abort "Canary replicas did not start"
+
+echo "Watching canary replicas for ${BAKE}s..."
+END=$((SECONDS + BAKE))
+while [ $SECONDS -lt $END ]; do
+    STATES=$("${CANARY[@]}" ps -a -q | xargs docker inspect -f '{{.Name}} {{.State.Status}}{{if .State.Health}} {{.State.Health.Status}}{{end}}')
+    FAILED=$(echo "$STATES" | grep -Ev ' running( healthy| starting)?$' || true)
+    if [ -n "$FAILED" ]; then
+        echo "$FAILED"
+        abort "Unhealthy canary replicas detected"
+    fi
+    sleep 5
+done
+
+echo "Canary healthy, rolling out every replica..."
+"${STABLE[@]}" pull
+if ! "${STABLE[@]}" up -d --wait; then
+    "${CANARY[@]}" down --remove-orphans || true
+    exit 1
+fi
+"${CANARY[@]}" down --remove-orphans
+
+echo "--- Canary Promoted ---"
+`
+
+// canaryPlan returns the canaryScript arguments scaling the canary replicas of each replicated service
+// An empty plan means the compose file has no service with several replicas to canary.
+func canaryPlan(params models.PipelineRunParams, workspaceDir string) ([]string, error) {
+	replicated, err := compose.ReplicatedServices(filepath.Join(workspaceDir, params.DeploymentFilename))
+	if err != nil {
+		return nil, err
+	}
+
+	canaries := max(params.CanaryReplicas, 1)
+	var plan []string
+	for service, replicas := range replicated {
+		// The canary stays a subset, at least one stable replica keeps the old version
+		plan = append(plan, fmt.Sprintf("%s=%d", service, min(canaries, replicas-1)))
+	}
+	sort.Strings(plan)
+	return plan, nil
+}
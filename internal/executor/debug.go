@@ -0,0 +1,59 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/docker"
+)
+
+// debugMarker is the file a debugged job creates in its container once its script failed
+const debugMarker = "/tmp/.cicd-debug"
+
+// wrapForDebug keeps the container of a failed job running for window, the job still exiting with the code of its script
+// Stopping the container ends the window early.
+func wrapForDebug(commands []string, window time.Duration) []string {
+	message := fmt.Sprintf("Job failed with exit code $code, its container is kept %s for debugging", window)
+	return []string{fmt.Sprintf("{ %s\n}; code=$?; if [ \"$code\" -ne 0 ]; then touch %s; echo \"%s\"; trap 'exit $code' TERM; sleep %d & wait $!; fi; exit $code",
+		strings.Join(commands, " && "), debugMarker, message, int(window.Seconds()))}
+}
+
+// trackDebug records the container of a job kept for debugging, until the returned function is called
+func (e *PipelineExecutor) trackDebug(jobID int, containerID string) func() {
+	e.debugMu.Lock()
+	e.debugContainers[jobID] = containerID
+	e.debugMu.Unlock()
+	return func() {
+		e.debugMu.Lock()
+		delete(e.debugContainers, jobID)
+		e.debugMu.Unlock()
+	}
+}
+
+// debugContainer returns the container of a failed job kept for debugging
+func (e *PipelineExecutor) debugContainer(ctx context.Context, jobID int) (string, error) {
+	e.debugMu.Lock()
+	containerID, ok := e.debugContainers[jobID]
+	e.debugMu.Unlock()
+	if !ok || !e.docker.FileExists(ctx, containerID, debugMarker) {
+		return "", fmt.Errorf("job is not kept for debugging")
+	}
+	return containerID, nil
+}
+
+// CanDebug reports whether a job failed and its container is kept for debugging
+func (e *PipelineExecutor) CanDebug(ctx context.Context, jobID int) bool {
+	_, err := e.debugContainer(ctx, jobID)
+	return err == nil
+}
+
+// DebugShell opens a shell in the container of a failed job kept for debugging
+func (e *PipelineExecutor) DebugShell(ctx context.Context, jobID int) (*docker.ExecSession, error) {
+	containerID, err := e.debugContainer(ctx, jobID)
+	if err != nil {
+		return nil, err
+	}
+	return e.docker.Exec(ctx, containerID, []string{"sh"})
+}
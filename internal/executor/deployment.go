@@ -1,18 +1,24 @@
 package executor
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
+	"sync"
 
-	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/database"
 	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/docker"
 	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
 	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/parser/compose"
 	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/ssh"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/store"
 	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const deployScript = `#!/bin/bash
@@ -59,43 +65,59 @@ fi
 `
 
 type DeploymentExecutor struct {
-	db     *database.DB
+	db     store.Store
 	docker *docker.DockerExecutor
+	feed   *DeploymentLogFeed
 }
 
-func NewDeploymentExecutor(db *database.DB, docker *docker.DockerExecutor) *DeploymentExecutor {
+func NewDeploymentExecutor(db store.Store, docker *docker.DockerExecutor) *DeploymentExecutor {
 	return &DeploymentExecutor{
 		db:     db,
 		docker: docker,
+		feed:   NewDeploymentLogFeed(),
 	}
 }
 
+// LogFeed returns the feed of the deployment log lines stored by the executor
+func (e *DeploymentExecutor) LogFeed() *DeploymentLogFeed {
+	return e.feed
+}
+
 // Execute handles the deployment logic (Registry/SSH or Local)
-func (e *DeploymentExecutor) Execute(project *models.Project, params models.PipelineRunParams, workspaceDir string) (string, error) {
+// Cancelling ctx stops the deployment commands in progress
+func (e *DeploymentExecutor) Execute(ctx context.Context, project *models.Project, params models.PipelineRunParams, workspaceDir string) (string, error) {
 	dLogger := e.newDeploymentLogger(params.PipelineID)
 
 	var err error
 	// Check if we should use Registry/SSH flow
-	if project != nil && project.RegistryUser != "" && project.SSHHost != "" {
-		err = e.deployRemote(project, params, workspaceDir, dLogger)
+	if project != nil && project.DeploymentMethod == models.DeploymentMethodAnsible {
+		err = e.deployAnsible(ctx, project, params, workspaceDir, dLogger)
+	} else if project != nil && project.RegistryUser != "" && project.SSHHost != "" {
+		err = e.deployRemote(ctx, project, params, workspaceDir, dLogger)
 	} else {
-		err = e.deployLocal(params, workspaceDir, dLogger)
+		err = e.deployLocal(ctx, params, workspaceDir, dLogger)
 	}
 
 	return dLogger.String(), err
 }
 
 // deployLocal handles execution on the same machine
-func (e *DeploymentExecutor) deployLocal(params models.PipelineRunParams, workspaceDir string, dLogger *DeploymentLogger) error {
+func (e *DeploymentExecutor) deployLocal(ctx context.Context, params models.PipelineRunParams, workspaceDir string, dLogger *DeploymentLogger) error {
 	dLogger.Log("Using local deployment flow")
-	sanitizedRepoName := sanitizeProjectName(params.RepoName)
-	localLogs, localErr := e.docker.DeployCompose(workspaceDir, params.DeploymentFilename, sanitizedRepoName)
+	if params.DeploymentStrategy == models.StrategyCanary {
+		dLogger.Log("Canary deployments need the Registry/SSH flow, replacing every replica at once")
+	}
+	if len(params.PreDeploy) > 0 || len(params.PostDeploy) > 0 {
+		dLogger.Log("Deploy hooks run over SSH, skipping them for the local deployment")
+	}
+	sanitizedRepoName := composeProjectName(params)
+	localLogs, localErr := e.docker.DeployCompose(ctx, workspaceDir, params.DeploymentFilename, sanitizedRepoName)
 	dLogger.Log(localLogs)
 	return localErr
 }
 
 // deployRemote handles the build-push-deploy-ssh flow
-func (e *DeploymentExecutor) deployRemote(project *models.Project, params models.PipelineRunParams, workspaceDir string, dLogger *DeploymentLogger) error {
+func (e *DeploymentExecutor) deployRemote(ctx context.Context, project *models.Project, params models.PipelineRunParams, workspaceDir string, dLogger *DeploymentLogger) error {
 	dLogger.Log("Using Registry/SSH deployment flow")
 
 	// 1. Generate docker-compose.override.yml
@@ -106,12 +128,12 @@ func (e *DeploymentExecutor) deployRemote(project *models.Project, params models
 	}
 
 	// 2. Build and Push Images
-	if err := e.buildAndPushImages(project, params, workspaceDir, overrideFilename, dLogger); err != nil {
+	if err := e.buildAndPushImages(ctx, project, params, workspaceDir, overrideFilename, dLogger); err != nil {
 		return err
 	}
 
-	// 3. Remote Deploy via SSH
-	return e.executeRemoteSSH(project, params, workspaceDir, overrideFilename, overrideContent, dLogger)
+	// 3. Remote Deploy via SSH, host by host for environments with several hosts
+	return e.rollout(ctx, project, params, workspaceDir, overrideFilename, overrideContent, dLogger)
 }
 
 // generateOverride creates the compose override file for registry usage
@@ -124,13 +146,24 @@ func (e *DeploymentExecutor) generateOverride(project *models.Project, params mo
 		return nil, err
 	}
 
-	overrideContent, genErr := compose.GenerateOverride(services, project.RegistryUser, params.RepoName, params.CommitHash)
+	overrideContent, genErr := compose.GenerateOverride(services, compose.ImageNamespace(project.RegistryURL, project.RegistryUser), params.RepoName, params.CommitHash)
 	if genErr != nil {
 		err := fmt.Errorf("failed to generate override: %w", genErr)
 		dLogger.Log(err.Error())
 		return nil, err
 	}
 
+	if params.Proxy != "" {
+		route := proxyRoute(params)
+		overrideContent, genErr = compose.AddProxyLabels(overrideContent, composePath, route)
+		if genErr != nil {
+			err := fmt.Errorf("failed to add reverse proxy labels: %w", genErr)
+			dLogger.Log(err.Error())
+			return nil, err
+		}
+		dLogger.Log(fmt.Sprintf("Exposing the project at %s through %s", route.URL(), route.Provider))
+	}
+
 	if err := os.WriteFile(filepath.Join(workspaceDir, overrideFilename), overrideContent, 0644); err != nil {
 		dLogger.Log("Failed to write override file: " + err.Error())
 		return nil, err
@@ -140,18 +173,83 @@ func (e *DeploymentExecutor) generateOverride(project *models.Project, params mo
 }
 
 // buildAndPushImages logs into registry, builds, and pushes images
-func (e *DeploymentExecutor) buildAndPushImages(project *models.Project, params models.PipelineRunParams, workspaceDir, overrideFilename string, dLogger *DeploymentLogger) error {
+// Services already pushed by a build job of the pipeline are left out.
+func (e *DeploymentExecutor) buildAndPushImages(ctx context.Context, project *models.Project, params models.PipelineRunParams, workspaceDir, overrideFilename string, dLogger *DeploymentLogger) error {
+	var services []string
+	if len(params.PrebuiltServices) > 0 {
+		buildable, err := compose.ParseServices(filepath.Join(workspaceDir, params.DeploymentFilename))
+		if err != nil {
+			err = fmt.Errorf("failed to parse compose services: %w", err)
+			dLogger.Log(err.Error())
+			return err
+		}
+		for _, service := range buildable {
+			if !slices.Contains(params.PrebuiltServices, service) {
+				services = append(services, service)
+			}
+		}
+		dLogger.Log(fmt.Sprintf("Images already built by pipeline jobs: %s", strings.Join(params.PrebuiltServices, ", ")))
+		if len(services) == 0 {
+			return nil
+		}
+	}
+
 	// Login
-	if loginErr := e.docker.Login(project.RegistryUser, project.RegistryToken, ""); loginErr != nil {
+	if loginErr := e.docker.Login(project.RegistryUser, project.RegistryToken, registryServer(project.RegistryURL)); loginErr != nil {
 		err := fmt.Errorf("registry login failed: %w", loginErr)
 		dLogger.Log(err.Error())
 		return err
 	}
-	dLogger.Log(fmt.Sprintf("Logged in to registry as %s", project.RegistryUser))
+	dLogger.Log(fmt.Sprintf("Logged in to registry %s as %s", docker.RegistryHost(project.RegistryURL), project.RegistryUser))
+
+	// Build, reusing the layer cache of previous builds when available
+	composeFiles := []string{params.DeploymentFilename, overrideFilename}
+	builder := ""
+	if os.Getenv("BUILD_CACHE") != "false" {
+		cacheFile, err := e.prepareBuildCache(project, params, workspaceDir)
+		if err != nil {
+			dLogger.Log(fmt.Sprintf("Build cache disabled: %v", err))
+		} else {
+			composeFiles = append(composeFiles, cacheFile)
+			builder = docker.CacheBuilder
+			dLogger.Log("Using registry layer cache")
+		}
+	}
+
+	tags := imageTags(project, params)
+	if len(tags) > 0 {
+		tagsFile, err := e.prepareImageTags(project, params, workspaceDir, tags)
+		if err != nil {
+			err = fmt.Errorf("image tags setup failed: %w", err)
+			dLogger.Log(err.Error())
+			return err
+		}
+		composeFiles = append(composeFiles, tagsFile)
+		dLogger.Log(fmt.Sprintf("Also tagging images %s", strings.Join(tags, ", ")))
+	}
+
+	// Multi-platform images only exist in the builder, they are pushed from it instead of the engine, with their extra tags
+	if len(project.BuildPlatforms) > 0 {
+		platformsFile, err := e.preparePlatforms(project, params, workspaceDir)
+		if err != nil {
+			err = fmt.Errorf("multi-platform build setup failed: %w", err)
+			dLogger.Log(err.Error())
+			return err
+		}
+		composeFiles = append(composeFiles, platformsFile)
+		builder = docker.CacheBuilder
+		dLogger.Log(fmt.Sprintf("Building and pushing images for %s...", strings.Join(project.BuildPlatforms, ", ")))
+		buildLogs, buildErr := e.docker.ComposeBuildPush(ctx, workspaceDir, builder, composeFiles, services...)
+		dLogger.LogBlock("BUILD LOGS", buildLogs)
+		if buildErr != nil {
+			return buildErr
+		}
+		e.recordSBOMs(ctx, project, params, workspaceDir, services, dLogger)
+		return nil
+	}
 
-	// Build
 	dLogger.Log("Building images...")
-	buildLogs, buildErr := e.docker.ComposeBuild(workspaceDir, params.DeploymentFilename, overrideFilename)
+	buildLogs, buildErr := e.docker.ComposeBuild(ctx, workspaceDir, builder, composeFiles, services...)
 	dLogger.LogBlock("BUILD LOGS", buildLogs)
 	if buildErr != nil {
 		return buildErr
@@ -159,88 +257,351 @@ func (e *DeploymentExecutor) buildAndPushImages(project *models.Project, params
 
 	// Push
 	dLogger.Log("Pushing images...")
-	pushLogs, pushErr := e.docker.ComposePush(workspaceDir, params.DeploymentFilename, overrideFilename)
+	pushLogs, pushErr := e.docker.ComposePush(ctx, workspaceDir, params.DeploymentFilename, overrideFilename, services...)
 	dLogger.LogBlock("PUSH LOGS", pushLogs)
 	if pushErr != nil {
 		return pushErr
 	}
+	// docker compose push only pushes the image of each service, not its extra build tags
+	if len(tags) > 0 {
+		images, err := e.taggedImages(project, params, workspaceDir, services, tags)
+		if err != nil {
+			dLogger.Log(err.Error())
+			return err
+		}
+		tagLogs, tagErr := e.docker.PushImages(ctx, images...)
+		dLogger.LogBlock("TAG PUSH LOGS", tagLogs)
+		if tagErr != nil {
+			return tagErr
+		}
+	}
 
+	e.recordSBOMs(ctx, project, params, workspaceDir, services, dLogger)
 	return nil
 }
 
+// prepareBuildCache sets up the buildx builder and writes the compose override exporting the layer cache
+func (e *DeploymentExecutor) prepareBuildCache(project *models.Project, params models.PipelineRunParams, workspaceDir string) (string, error) {
+	if err := e.docker.EnsureCacheBuilder(); err != nil {
+		return "", err
+	}
+
+	services, err := compose.ParseServices(filepath.Join(workspaceDir, params.DeploymentFilename))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse compose services: %w", err)
+	}
+	content, err := compose.GenerateCacheOverride(services, compose.ImageNamespace(project.RegistryURL, project.RegistryUser), params.RepoName)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate cache override: %w", err)
+	}
+
+	cacheFilename := "docker-compose.cache.yml"
+	if err := os.WriteFile(filepath.Join(workspaceDir, cacheFilename), content, 0644); err != nil {
+		return "", fmt.Errorf("failed to write cache override: %w", err)
+	}
+	return cacheFilename, nil
+}
+
+// preparePlatforms sets up the buildx builder and writes the compose override building every buildable service for the project platforms
+func (e *DeploymentExecutor) preparePlatforms(project *models.Project, params models.PipelineRunParams, workspaceDir string) (string, error) {
+	// The default docker driver cannot build for several platforms
+	if err := e.docker.EnsureCacheBuilder(); err != nil {
+		return "", err
+	}
+
+	services, err := compose.ParseServices(filepath.Join(workspaceDir, params.DeploymentFilename))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse compose services: %w", err)
+	}
+	content, err := compose.GeneratePlatformsOverride(services, project.BuildPlatforms)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate platforms override: %w", err)
+	}
+
+	platformsFilename := "docker-compose.platforms.yml"
+	if err := os.WriteFile(filepath.Join(workspaceDir, platformsFilename), content, 0644); err != nil {
+		return "", fmt.Errorf("failed to write platforms override: %w", err)
+	}
+	return platformsFilename, nil
+}
+
+// prepareImageTags writes the compose override tagging every buildable service with the extra image tags
+func (e *DeploymentExecutor) prepareImageTags(project *models.Project, params models.PipelineRunParams, workspaceDir string, tags []string) (string, error) {
+	services, err := compose.ParseServices(filepath.Join(workspaceDir, params.DeploymentFilename))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse compose services: %w", err)
+	}
+	content, err := compose.GenerateTagsOverride(services, compose.ImageNamespace(project.RegistryURL, project.RegistryUser), params.RepoName, tags)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate tags override: %w", err)
+	}
+
+	tagsFilename := "docker-compose.tags.yml"
+	if err := os.WriteFile(filepath.Join(workspaceDir, tagsFilename), content, 0644); err != nil {
+		return "", fmt.Errorf("failed to write tags override: %w", err)
+	}
+	return tagsFilename, nil
+}
+
+// taggedImages returns the images of the built services with each of the extra tags
+// services are the built compose services, empty for every buildable one.
+func (e *DeploymentExecutor) taggedImages(project *models.Project, params models.PipelineRunParams, workspaceDir string, services, tags []string) ([]string, error) {
+	if len(services) == 0 {
+		var err error
+		if services, err = compose.ParseServices(filepath.Join(workspaceDir, params.DeploymentFilename)); err != nil {
+			return nil, fmt.Errorf("failed to parse compose services: %w", err)
+		}
+	}
+	namespace := compose.ImageNamespace(project.RegistryURL, project.RegistryUser)
+	var images []string
+	for _, service := range services {
+		for _, tag := range tags {
+			images = append(images, compose.ImageName(namespace, params.RepoName, service, tag))
+		}
+	}
+	return images, nil
+}
+
 // executeRemoteSSH handles the SSH connection and remote command execution
-func (e *DeploymentExecutor) executeRemoteSSH(project *models.Project, params models.PipelineRunParams, workspaceDir, overrideFilename string, overrideContent []byte, dLogger *DeploymentLogger) error {
+func (e *DeploymentExecutor) executeRemoteSSH(ctx context.Context, project *models.Project, params models.PipelineRunParams, workspaceDir, overrideFilename string, overrideContent []byte, dLogger *DeploymentLogger) (err error) {
 	if project.SSHHost == "" {
 		dLogger.Log("No SSH host configured, skipping remote deployment.")
 		return nil // Or error? Logic in original was "skip" but effectively success or just doing nothing.
 	}
 
-	client, sshErr := ssh.NewClient(project.SSHHost, project.SSHUser, project.SSHPrivateKey)
+	_, span := tracing.Start(ctx, "ssh.deploy", attribute.String("cicd.ssh.host", project.SSHHost))
+	defer func() { tracing.End(span, err) }()
+
+	target, bastion := SSHEndpoints(project)
+	client, sshErr := ssh.Connect(target, bastion)
 	if sshErr != nil {
 		err := fmt.Errorf("ssh connection failed: %w", sshErr)
 		dLogger.Log(err.Error())
 		return err
 	}
 	defer client.Close()
-	dLogger.Log(fmt.Sprintf("Connected via SSH to %s", project.SSHHost))
+	if bastion != nil {
+		dLogger.Log(fmt.Sprintf("Connected via SSH to %s through bastion %s", project.SSHHost, bastion.Host))
+	} else {
+		dLogger.Log(fmt.Sprintf("Connected via SSH to %s", project.SSHHost))
+	}
 
-	sanitizedRepoName := sanitizeProjectName(params.RepoName)
+	sanitizedRepoName := composeProjectName(params)
 	remoteDir := fmt.Sprintf("deploy/%s", sanitizedRepoName)
-	client.RunCommand("mkdir -p " + remoteDir)
 
-	// Copy files
-	composePath := filepath.Join(workspaceDir, params.DeploymentFilename)
-	composeContent, _ := os.ReadFile(composePath) // Error ignored in original, assuming file exists if parsed earlier
-	client.CopyFile(composeContent, remoteDir+"/"+params.DeploymentFilename)
-	client.CopyFile(overrideContent, remoteDir+"/"+overrideFilename)
+	// Compose files referencing ${VARS} are interpolated from the .env file next to them
+	envContent, secretValues, envErr := e.deploymentEnvFile(ctx, project, params)
+	if envErr != nil {
+		dLogger.Log(envErr.Error())
+		return envErr
+	}
+	dLogger.addSecrets(secretValues)
 
+	if err := uploadDeploymentFiles(client, project, params, workspaceDir, remoteDir, overrideFilename, overrideContent, envContent); err != nil {
+		err = fmt.Errorf("failed to copy deployment files: %w", err)
+		dLogger.Log(err.Error())
+		return err
+	}
 	dLogger.Log(fmt.Sprintf("Copied config files to remote dir: %s", remoteDir))
 
-	// Upload deploy script
-	client.CopyFile([]byte(deployScript), remoteDir+"/deploy.sh")
-	client.RunCommand("chmod +x " + remoteDir + "/deploy.sh")
-
 	logger.Debug(fmt.Sprintf("The sanitizedRepoName %s", sanitizedRepoName))
 
 	// Run script
 	cmd := fmt.Sprintf("export PATH=$PATH:/usr/local/bin:/usr/bin && cd %s && ./deploy.sh %s %s %s",
 		remoteDir, sanitizedRepoName, params.DeploymentFilename, overrideFilename)
 
+	if err := runHooks(client, "PRE-DEPLOY", remoteDir, params.PreDeploy, dLogger); err != nil {
+		return err
+	}
+
+	if params.DeploymentStrategy == models.StrategyCanary {
+		canaryCmd, canaryErr := e.prepareRemoteCanary(client, params, workspaceDir, remoteDir, overrideFilename, dLogger)
+		if canaryErr != nil {
+			return canaryErr
+		}
+		if canaryCmd != "" {
+			cmd = canaryCmd
+		}
+	}
+
+	aborted := false
 	remoteErr := client.RunCommandStream(cmd, func(line string) {
+		aborted = aborted || line == canaryAbortedMarker
 		dLogger.Log(line)
 	})
 
 	if remoteErr != nil {
 		dLogger.Log(fmt.Sprintf("Remote command error: %v", remoteErr))
+		if aborted {
+			return fmt.Errorf("%w: %v", ErrCanaryAborted, remoteErr)
+		}
 		return remoteErr
 	}
 
-	return nil
+	return runHooks(client, "POST-DEPLOY", remoteDir, params.PostDeploy, dLogger)
+}
+
+// uploadDeploymentFiles copies the compose files, the .env file, the extra deployment files and the deploy script over SFTP
+func uploadDeploymentFiles(client *ssh.Client, project *models.Project, params models.PipelineRunParams, workspaceDir, remoteDir, overrideFilename string, overrideContent, envContent []byte) error {
+	if err := client.UploadFile(filepath.Join(workspaceDir, params.DeploymentFilename), remoteDir+"/"+params.DeploymentFilename); err != nil {
+		return err
+	}
+	if err := client.CopyFile(overrideContent, remoteDir+"/"+overrideFilename); err != nil {
+		return err
+	}
+
+	if len(envContent) > 0 {
+		// The file holds secrets, it is only readable by the deploy user
+		if err := client.WriteFile(remoteDir+"/"+envFilename, bytes.NewReader(envContent), 0600); err != nil {
+			return err
+		}
+	} else {
+		client.RunCommand(fmt.Sprintf("rm -f %s/%s", remoteDir, envFilename))
+	}
+
+	// Files and directories of the repository the compose file needs, e.g. mounted configs, keep their relative path
+	for _, name := range project.DeploymentFiles {
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("deployment file %s is outside the repository", name)
+		}
+		localPath := filepath.Join(workspaceDir, name)
+		info, err := os.Stat(localPath)
+		if err != nil {
+			return fmt.Errorf("deployment file %s: %w", name, err)
+		}
+		remotePath := remoteDir + "/" + filepath.ToSlash(name)
+		if info.IsDir() {
+			err = client.UploadDir(localPath, remotePath)
+		} else {
+			err = client.UploadFile(localPath, remotePath)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return client.WriteFile(remoteDir+"/deploy.sh", strings.NewReader(deployScript), 0755)
+}
+
+// SSHEndpoints returns the SSH host of a project and its bastion, nil without one
+// The bastion falls back to the user and key of the SSH host.
+func SSHEndpoints(project *models.Project) (ssh.Endpoint, *ssh.Endpoint) {
+	target := ssh.Endpoint{Host: project.SSHHost, User: project.SSHUser, PrivateKey: project.SSHPrivateKey}
+	if project.SSHBastionHost == "" {
+		return target, nil
+	}
+	bastion := &ssh.Endpoint{Host: project.SSHBastionHost, User: project.SSHBastionUser, PrivateKey: project.SSHBastionPrivateKey}
+	if bastion.User == "" {
+		bastion.User = target.User
+	}
+	if bastion.PrivateKey == "" {
+		bastion.PrivateKey = target.PrivateKey
+	}
+	return target, bastion
+}
+
+// prepareRemoteCanary uploads the canary script and override, returning the command running them
+// The command is empty when no service has several replicas, the regular deploy script is then used.
+func (e *DeploymentExecutor) prepareRemoteCanary(client *ssh.Client, params models.PipelineRunParams, workspaceDir, remoteDir, overrideFilename string, dLogger *DeploymentLogger) (string, error) {
+	plan, err := canaryPlan(params, workspaceDir)
+	if err != nil {
+		err = fmt.Errorf("failed to plan canary: %w", err)
+		dLogger.Log(err.Error())
+		return "", err
+	}
+	if len(plan) == 0 {
+		dLogger.Log("No service runs several replicas, replacing every replica at once")
+		return "", nil
+	}
+
+	sanitizedRepoName := composeProjectName(params)
+	canaryOverride, err := compose.GenerateCanaryOverride(filepath.Join(workspaceDir, params.DeploymentFilename), sanitizedRepoName)
+	if err != nil {
+		err = fmt.Errorf("failed to generate canary override: %w", err)
+		dLogger.Log(err.Error())
+		return "", err
+	}
+	if err := client.CopyFile(canaryOverride, remoteDir+"/"+canaryOverrideFilename); err != nil {
+		err = fmt.Errorf("failed to copy canary override: %w", err)
+		dLogger.Log(err.Error())
+		return "", err
+	}
+	if err := client.WriteFile(remoteDir+"/canary.sh", strings.NewReader(canaryScript), 0755); err != nil {
+		err = fmt.Errorf("failed to copy canary script: %w", err)
+		dLogger.Log(err.Error())
+		return "", err
+	}
+
+	bake := params.CanaryBakeSeconds
+	if bake <= 0 {
+		bake = 60
+	}
+	dLogger.Log(fmt.Sprintf("Canary deployment of %s, baking for %ds", strings.Join(plan, ", "), bake))
+	return fmt.Sprintf("export PATH=$PATH:/usr/local/bin:/usr/bin && cd %s && ./canary.sh %s %s %s %s %d %s",
+		remoteDir, sanitizedRepoName, params.DeploymentFilename, overrideFilename, canaryOverrideFilename, bake, strings.Join(plan, " ")), nil
 }
 
 // === Deployment Helper Struct ===
 
 type DeploymentLogger struct {
-	db         *database.DB
+	db         store.Store
+	feed       *DeploymentLogFeed
 	pipelineID int
 	logs       strings.Builder
+	// secrets are replaced by ***** in every logged message
+	secrets []string
+	// mu guards logs and secrets, the hosts of a rollout batch log at once
+	mu sync.Mutex
+	// parent logs the messages of the logger of one host, with prefix prepended
+	parent *DeploymentLogger
+	prefix string
 }
 
 func (e *DeploymentExecutor) newDeploymentLogger(pipelineID int) *DeploymentLogger {
 	return &DeploymentLogger{
 		db:         e.db,
+		feed:       e.feed,
 		pipelineID: pipelineID,
 	}
 }
 
+// withPrefix returns a logger prepending prefix to the messages it logs through dLogger
+func (dLogger *DeploymentLogger) withPrefix(prefix string) *DeploymentLogger {
+	return &DeploymentLogger{parent: dLogger, prefix: prefix}
+}
+
+// addSecrets masks values in the messages logged from now on
+func (dLogger *DeploymentLogger) addSecrets(values []string) {
+	if dLogger.parent != nil {
+		dLogger.parent.addSecrets(values)
+		return
+	}
+	dLogger.mu.Lock()
+	defer dLogger.mu.Unlock()
+	dLogger.secrets = append(dLogger.secrets, values...)
+}
+
 func (dLogger *DeploymentLogger) Log(msg string) {
+	if dLogger.parent != nil {
+		dLogger.parent.Log(dLogger.prefix + msg)
+		return
+	}
+	dLogger.mu.Lock()
+	defer dLogger.mu.Unlock()
+	for _, secret := range dLogger.secrets {
+		msg = strings.ReplaceAll(msg, secret, "*****")
+	}
+
 	// 1. Append to local builder (for return)
 	dLogger.logs.WriteString(msg + "\n")
 
 	// 2. Stream to DB
 	if dLogger.db != nil && dLogger.pipelineID > 0 {
-		if dbErr := dLogger.db.CreateDeploymentLog(dLogger.pipelineID, msg); dbErr != nil {
+		line, dbErr := dLogger.db.CreateDeploymentLog(context.Background(), dLogger.pipelineID, msg)
+		if dbErr != nil {
 			logger.Error(fmt.Sprintf("Error streaming log to DB: %v", dbErr))
+		} else {
+			dLogger.feed.Publish(*line)
 		}
 	}
 
@@ -259,9 +620,20 @@ func (dLogger *DeploymentLogger) LogBlock(blockName, content string) {
 }
 
 func (dLogger *DeploymentLogger) String() string {
+	dLogger.mu.Lock()
+	defer dLogger.mu.Unlock()
 	return dLogger.logs.String()
 }
 
+// composeProjectName returns the compose project a deployment runs as, named after the repository
+// Preview environments set ComposeProject so that each branch runs next to the others.
+func composeProjectName(params models.PipelineRunParams) string {
+	if params.ComposeProject != "" {
+		return sanitizeProjectName(params.ComposeProject)
+	}
+	return sanitizeProjectName(params.RepoName)
+}
+
 // sanitizeProjectName sanitizes the project name for Docker Compose
 func sanitizeProjectName(name string) string {
 	name = strings.ToLower(name)
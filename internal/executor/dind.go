@@ -0,0 +1,48 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/docker"
+)
+
+// dindWaitCommand waits up to 30 seconds for the dind daemon to accept connections
+const dindWaitCommand = `i=0; while [ $i -lt 30 ] && ! docker info >/dev/null 2>&1; do i=$((i+1)); sleep 1; done`
+
+// setupDind gives a dind job access to a Docker daemon
+// By default (DIND_MODE=service) a docker:dind daemon dedicated to the job is started, returned so it can be stopped afterwards.
+// DIND_MODE=socket mounts the host Docker socket into the job container instead. Both are refused unless the project allows
+// privileged jobs: the daemon runs privileged and starts the containers the job asks for, privileged ones included, and the
+// socket gives root on the host.
+func (e *PipelineExecutor) setupDind(ctx context.Context, run *pipelineRun, jobName string, vars map[string]string, opts *docker.JobOptions) (*docker.DindService, error) {
+	socket := os.Getenv("DIND_MODE") == "socket"
+	if !run.allowPrivileged {
+		if socket {
+			return nil, fmt.Errorf("DIND_MODE=socket mounts the host Docker socket, which needs privileged jobs to be allowed for this project")
+		}
+		return nil, fmt.Errorf("dind runs a privileged Docker daemon, which needs privileged jobs to be allowed for this project")
+	}
+	if socket {
+		opts.DockerSocket = true
+		return nil, nil
+	}
+
+	// The job container has to join the dind network, which would replace the one the job chose
+	if opts.Network != run.network {
+		return nil, fmt.Errorf("dind moves the job to the network of its Docker daemon, which conflicts with network %q: use the pipeline network or DIND_MODE=socket", opts.Network)
+	}
+
+	name := fmt.Sprintf("cicd-dind-%d-%s", run.pipelineID, strings.Trim(sanitizeProjectName(jobName), "-"))
+	service, err := e.docker.StartDindService(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	opts.Network = service.Network
+	vars["DOCKER_HOST"] = docker.DindHost
+	vars["DOCKER_TLS_CERTDIR"] = ""
+	return service, nil
+}
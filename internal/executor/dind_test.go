@@ -0,0 +1,61 @@
+package executor
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/docker"
+)
+
+func TestSetupDindNeedsPrivilegedJobs(t *testing.T) {
+	// No Docker client: the job must fail before any daemon is started
+	e := &PipelineExecutor{}
+	run := &pipelineRun{pipelineID: 1}
+
+	for _, mode := range []string{"", "service", "socket"} {
+		t.Run("Mode"+mode, func(t *testing.T) {
+			t.Setenv("DIND_MODE", mode)
+			vars := map[string]string{}
+			opts := docker.JobOptions{Network: "cicd-pipeline-1"}
+
+			service, err := e.setupDind(context.Background(), run, "build image", vars, &opts)
+			if err == nil || !strings.Contains(err.Error(), "privileged jobs to be allowed") {
+				t.Fatalf("Expected the dind job to be refused, got %v", err)
+			}
+			if service != nil || opts.DockerSocket || opts.Network != "cicd-pipeline-1" || vars["DOCKER_HOST"] != "" {
+				t.Errorf("Expected the job options left untouched, got %+v and %v", opts, vars)
+			}
+		})
+	}
+}
+
+func TestSetupDindKeepsJobNetwork(t *testing.T) {
+	e := &PipelineExecutor{}
+	run := &pipelineRun{pipelineID: 1, allowPrivileged: true, network: "cicd-pipeline-1"}
+	t.Setenv("DIND_MODE", "")
+
+	for _, network := range []string{"none", "bridge", "host"} {
+		t.Run(network, func(t *testing.T) {
+			opts := docker.JobOptions{Network: network}
+			_, err := e.setupDind(context.Background(), run, "build image", map[string]string{}, &opts)
+			if err == nil || !strings.Contains(err.Error(), `conflicts with network "`+network+`"`) {
+				t.Fatalf("Expected the network of the job to be refused, got %v", err)
+			}
+			if opts.Network != network {
+				t.Errorf("Expected the network left to %s, got %s", network, opts.Network)
+			}
+		})
+	}
+
+	t.Run("Socket", func(t *testing.T) {
+		t.Setenv("DIND_MODE", "socket")
+		opts := docker.JobOptions{Network: "none"}
+		if _, err := e.setupDind(context.Background(), run, "build image", map[string]string{}, &opts); err != nil {
+			t.Fatalf("Expected the socket to work on any network, got %v", err)
+		}
+		if !opts.DockerSocket || opts.Network != "none" {
+			t.Errorf("Expected the socket mounted on the none network, got %+v", opts)
+		}
+	})
+}
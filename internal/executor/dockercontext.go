@@ -0,0 +1,108 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/docker"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/ssh"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// deployHost deploys to the SSH host of the project with its deployment method
+func (e *DeploymentExecutor) deployHost(ctx context.Context, project *models.Project, params models.PipelineRunParams, workspaceDir, overrideFilename string, overrideContent []byte, dLogger *DeploymentLogger) error {
+	if project.DeploymentMethod == models.DeploymentMethodContext {
+		return e.deployContext(ctx, project, params, workspaceDir, overrideFilename, dLogger)
+	}
+	return e.executeRemoteSSH(ctx, project, params, workspaceDir, overrideFilename, overrideContent, dLogger)
+}
+
+// deployContext runs docker compose from the workspace against the engine of the SSH host, reached through a forwarded socket
+// Like a docker context over ssh://, nothing but the images lands on the host: no script, no bash, no copied files.
+func (e *DeploymentExecutor) deployContext(ctx context.Context, project *models.Project, params models.PipelineRunParams, workspaceDir, overrideFilename string, dLogger *DeploymentLogger) (err error) {
+	ctx, span := tracing.Start(ctx, "ssh.deploy", attribute.String("cicd.ssh.host", project.SSHHost), attribute.String("cicd.deployment.method", models.DeploymentMethodContext))
+	defer func() { tracing.End(span, err) }()
+
+	target, bastion := SSHEndpoints(project)
+	client, err := ssh.Connect(target, bastion)
+	if err != nil {
+		err = fmt.Errorf("ssh connection failed: %w", err)
+		dLogger.Log(err.Error())
+		return err
+	}
+	defer client.Close()
+
+	addr, tunnel, err := client.ForwardUnix(docker.DockerSocketPath)
+	if err != nil {
+		dLogger.Log(err.Error())
+		return err
+	}
+	defer tunnel.Close()
+
+	engine, err := docker.NewRemoteExecutor("tcp://" + addr)
+	if err != nil {
+		err = fmt.Errorf("failed to create docker client: %w", err)
+		dLogger.Log(err.Error())
+		return err
+	}
+	defer engine.Close()
+	if err := engine.Ping(ctx); err != nil {
+		err = fmt.Errorf("docker engine of %s is unreachable: %w", project.SSHHost, err)
+		dLogger.Log(err.Error())
+		return err
+	}
+	dLogger.Log(fmt.Sprintf("Connected to the Docker engine of %s over SSH", project.SSHHost))
+
+	// The compose CLI sends the credentials of the local login with the pulls
+	if project.RegistryToken != "" {
+		if err := e.docker.Login(project.RegistryUser, project.RegistryToken, registryServer(project.RegistryURL)); err != nil {
+			err = fmt.Errorf("registry login failed: %w", err)
+			dLogger.Log(err.Error())
+			return err
+		}
+	}
+
+	// Compose interpolates ${VARS} on this side, from the .env file of the workspace
+	envContent, secretValues, err := e.deploymentEnvFile(ctx, project, params)
+	if err != nil {
+		dLogger.Log(err.Error())
+		return err
+	}
+	dLogger.addSecrets(secretValues)
+	envPath := filepath.Join(workspaceDir, envFilename)
+	if len(envContent) > 0 {
+		err = os.WriteFile(envPath, envContent, 0600)
+	} else if err = os.Remove(envPath); os.IsNotExist(err) {
+		err = nil
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to write %s: %w", envFilename, err)
+		dLogger.Log(err.Error())
+		return err
+	}
+
+	if params.DeploymentStrategy == models.StrategyCanary {
+		dLogger.Log("Canary deployments need the script deployment method, replacing every replica at once")
+	}
+	if len(project.DeploymentFiles) > 0 {
+		dLogger.Log("deployment_files are not copied by the context deployment method, bind mounts resolve on the host")
+	}
+
+	// Nothing is copied to the host, its hooks run from the home directory
+	if err := runHooks(client, "PRE-DEPLOY", "", params.PreDeploy, dLogger); err != nil {
+		return err
+	}
+
+	logs, err := engine.DeployComposeFiles(ctx, workspaceDir, composeProjectName(params), params.DeploymentFilename, overrideFilename)
+	dLogger.LogBlock("COMPOSE LOGS", logs)
+	if err != nil {
+		dLogger.Log(fmt.Sprintf("Remote deployment error: %v", err))
+		return err
+	}
+
+	return runHooks(client, "POST-DEPLOY", "", params.PostDeploy, dLogger)
+}
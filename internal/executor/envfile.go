@@ -0,0 +1,65 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+)
+
+// envFilename is read by docker compose from the directory of the deployment to interpolate ${VARS}
+const envFilename = ".env"
+
+// deploymentEnvFile renders the project variables of the deployed environment as a .env file
+// It also returns the secret values, to be masked in the deployment logs. The content is empty without variables.
+func (e *DeploymentExecutor) deploymentEnvFile(ctx context.Context, project *models.Project, params models.PipelineRunParams) ([]byte, []string, error) {
+	vars, secrets, err := e.deploymentVariables(ctx, project, params)
+	if err != nil || vars == nil {
+		return nil, nil, err
+	}
+	return renderEnvFile(vars), secrets, nil
+}
+
+// deploymentVariables returns the project variables of the deployed environment and their secret values, nil without a project
+func (e *DeploymentExecutor) deploymentVariables(ctx context.Context, project *models.Project, params models.PipelineRunParams) (map[string]string, []string, error) {
+	if e.db == nil || project == nil || project.ID == 0 {
+		return nil, nil, nil
+	}
+	variables, err := e.db.GetVariablesByProject(ctx, project.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch project variables: %w", err)
+	}
+
+	vars := scopedVariables(variables, params.Environment)
+	var secrets []string
+	for _, v := range variables {
+		if v.IsSecret && v.Value != "" && vars[v.Key] == v.Value {
+			secrets = append(secrets, v.Value)
+		}
+	}
+	return vars, secrets, nil
+}
+
+// renderEnvFile formats variables as KEY='value' lines, sorted by key
+// Single quoted values are not interpolated by compose. Values holding a quote or a line break are double quoted and escaped.
+func renderEnvFile(vars map[string]string) []byte {
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		v := vars[k]
+		if strings.ContainsAny(v, "'\n\r") {
+			v = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`).Replace(v) + `"`
+		} else {
+			v = "'" + v + "'"
+		}
+		fmt.Fprintf(&b, "%s=%s\n", k, v)
+	}
+	return []byte(b.String())
+}
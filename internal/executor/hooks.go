@@ -0,0 +1,30 @@
+package executor
+
+import (
+	"fmt"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/ssh"
+)
+
+// runHooks runs deploy hook commands on the host one after the other, from dir when not empty
+// Their output goes to the deployment logs, the first failing command stops the hook and fails the deployment.
+func runHooks(client *ssh.Client, name, dir string, commands []string, dLogger *DeploymentLogger) error {
+	if len(commands) == 0 {
+		return nil
+	}
+	dLogger.Log(fmt.Sprintf("=== %s HOOKS ===", name))
+
+	prefix := "export PATH=$PATH:/usr/local/bin:/usr/bin && "
+	if dir != "" {
+		prefix += fmt.Sprintf("cd %s && ", dir)
+	}
+	for _, command := range commands {
+		dLogger.Log("$ " + command)
+		if err := client.RunCommandStream(prefix+command, dLogger.Log); err != nil {
+			err = fmt.Errorf("%s hook %q failed: %w", name, command, err)
+			dLogger.Log(err.Error())
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package executor
+
+import (
+	"cmp"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+)
+
+// semverPattern matches a vX.Y.Z git tag, the v being optional and a pre-release suffix allowed
+var semverPattern = regexp.MustCompile(`^v?(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)(-[0-9A-Za-z.-]+)?$`)
+
+// invalidTagChars are the characters a Docker tag cannot hold
+var invalidTagChars = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// imageTags returns the tags the images of a run are pushed with next to the commit hash, following the project image tags
+// The default branch is main when the push did not report it. A pre-release only gets its full version.
+func imageTags(project *models.Project, params models.PipelineRunParams) []string {
+	var tags []string
+	for _, kind := range project.ImageTags {
+		switch kind {
+		case models.ImageTagLatest:
+			if params.Branch != "" && params.Branch == cmp.Or(params.DefaultBranch, "main") {
+				tags = append(tags, "latest")
+			}
+		case models.ImageTagBranch:
+			if tag := dockerTag(params.Branch); tag != "" {
+				tags = append(tags, tag)
+			}
+		case models.ImageTagSemver:
+			m := semverPattern.FindStringSubmatch(params.Tag)
+			if m == nil {
+				continue
+			}
+			if m[4] != "" {
+				tags = append(tags, strings.TrimPrefix(params.Tag, "v"))
+				continue
+			}
+			tags = append(tags, m[1]+"."+m[2]+"."+m[3], m[1]+"."+m[2], m[1])
+		}
+	}
+	slices.Sort(tags)
+	return slices.Compact(tags)
+}
+
+// dockerTag turns a branch name into a Docker tag, e.g. feature/login becomes feature-login
+func dockerTag(name string) string {
+	tag := strings.Trim(invalidTagChars.ReplaceAllString(name, "-"), "-.")
+	if len(tag) > 128 {
+		tag = tag[:128]
+	}
+	return tag
+}
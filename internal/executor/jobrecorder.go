@@ -0,0 +1,94 @@
+package executor
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+)
+
+// maxOutputLineSize is the longest output line of a job run outside a local container kept in the logs
+const maxOutputLineSize = 1024 * 1024
+
+// jobRecorder records the logs and final status of a job run outside a local container
+type jobRecorder struct {
+	e       *PipelineExecutor
+	ctx     context.Context
+	jobName string
+	jobID   int
+}
+
+// recorder returns the recorder of a job, whose records land even once the pipeline is cancelled or the job timed out
+func (e *PipelineExecutor) recorder(ctx context.Context, jobName string, jobID int) jobRecorder {
+	return jobRecorder{e: e, ctx: context.WithoutCancel(ctx), jobName: jobName, jobID: jobID}
+}
+
+// log appends lines to the job logs
+func (r jobRecorder) log(lines ...string) {
+	if r.e.db != nil && r.jobID > 0 {
+		r.e.db.CreateLogBatch(r.ctx, r.jobID, lines)
+	}
+}
+
+// finish records the final status of the job and returns it
+func (r jobRecorder) finish(status string, exitCode int) string {
+	if r.e.db != nil && r.jobID > 0 {
+		r.e.db.UpdateJobStatus(r.ctx, r.jobID, status, &exitCode)
+	}
+	return status
+}
+
+// fail fails the job with message logged as its error
+func (r jobRecorder) fail(message string) string {
+	logger.Error(fmt.Sprintf("Job %s: %s", r.jobName, message))
+	r.log("ERROR: " + message)
+	return r.finish("failed", 1)
+}
+
+// result records how the job ended: cancelled with the pipeline ctx, failed on timeout or a non-zero exit code, success otherwise
+func (r jobRecorder) result(ctx context.Context, timedOut bool, timeout time.Duration, exitCode int) string {
+	if ctx.Err() != nil {
+		logger.Info(fmt.Sprintf("Job %s cancelled", r.jobName))
+		return r.finish("cancelled", exitCode)
+	}
+	if timedOut {
+		logger.Error(fmt.Sprintf("Job %s timed out after %s", r.jobName, timeout))
+		r.log(fmt.Sprintf("ERROR: Job timed out after %s", timeout))
+		return r.finish("failed", exitCode)
+	}
+	if exitCode != 0 {
+		logger.Error(fmt.Sprintf("Job %s failed with exit code %d", r.jobName, exitCode))
+		return r.finish("failed", exitCode)
+	}
+	logger.Info(fmt.Sprintf("Job %s completed successfully", r.jobName))
+	return r.finish("success", exitCode)
+}
+
+// outputLines reads the output of a job line by line, closing the channel once both streams end
+func outputLines(stdout, stderr io.Reader) <-chan models.LogLine {
+	lines := make(chan models.LogLine)
+	var wg sync.WaitGroup
+	scan := func(r io.Reader, stream string) {
+		defer wg.Done()
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), maxOutputLineSize)
+		for scanner.Scan() {
+			lines <- models.LogLine{Content: scanner.Text(), Stream: stream, CreatedAt: time.Now()}
+		}
+		// A line too long for the scanner must not block the job output
+		io.Copy(io.Discard, r)
+	}
+	wg.Add(2)
+	go scan(stdout, models.LogStreamStdout)
+	go scan(stderr, models.LogStreamStderr)
+	go func() {
+		wg.Wait()
+		close(lines)
+	}()
+	return lines
+}
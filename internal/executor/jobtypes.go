@@ -0,0 +1,157 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/docker/docker/api/types/registry"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/parser/compose"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/parser/pipeline"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/store"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+)
+
+// JobTypeHandler runs the jobs of a job type, selected by the type field of the jobs
+// Each type lives in its own file, registering its handler with RegisterJobType from an init function.
+type JobTypeHandler interface {
+	// Info describes the type, its name being the value of the type field
+	Info() JobTypeInfo
+	// Prepare turns a job of the type into the image and script of its container, adding to job.Vars the variables the script reads
+	Prepare(job *JobRun) pipeline.JobConfig
+	// Finish runs once the script of a job succeeded, before the job is marked successful, a returned error failing it
+	Finish(ctx context.Context, job *JobRun) error
+}
+
+// JobTypeValidator is implemented by the handlers checking the properties of their jobs when pipeline files are parsed,
+// see pipeline.JobTypeValidator
+type JobTypeValidator interface {
+	Validate(name string, jobs map[string]pipeline.JobConfig) error
+}
+
+// JobTypeInfo describes a job type and its properties
+type JobTypeInfo struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Image       string            `json:"image,omitempty"`
+	Properties  []JobTypeProperty `json:"properties"`
+}
+
+// JobTypeProperty describes a property of the jobs of a type
+type JobTypeProperty struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+// JobRun is a job of a registered type, as handed to its handler
+type JobRun struct {
+	Name string
+	// ID is the job record, 0 in Prepare and when the pipeline is not recorded
+	ID     int
+	Config pipeline.JobConfig
+	Vars   map[string]string
+	// Local is set when the job runs in a container of this engine, whose workspace is WorkspaceDir
+	// Jobs run by runners and SSH executors leave their files on those machines.
+	Local bool
+
+	run *pipelineRun
+	db  store.Store
+}
+
+// WorkspaceDir returns the directory the repository is cloned to, mounted at /workspace in the job containers
+func (j *JobRun) WorkspaceDir() string {
+	return j.run.workspaceDir
+}
+
+// PipelineID returns the pipeline the job belongs to
+func (j *JobRun) PipelineID() int {
+	return j.run.pipelineID
+}
+
+// ServiceImage returns the deployment image of a compose service of the project at the pipeline commit
+func (j *JobRun) ServiceImage(service string) string {
+	return compose.ImageName(j.run.imageNamespace, j.run.predefinedVars["CI_PROJECT_NAME"], service, j.run.predefinedVars["CI_COMMIT_SHA"])
+}
+
+// RegistryAuth returns the credentials of the project for the registry of an image, nil without credentials
+func (j *JobRun) RegistryAuth(image string) *registry.AuthConfig {
+	return j.run.registryAuth(image)
+}
+
+// Store returns the store the job is recorded in, nil when the pipeline is not recorded
+func (j *JobRun) Store() store.Store {
+	if j.db == nil || j.ID <= 0 {
+		return nil
+	}
+	return j.db
+}
+
+// Log appends lines to the logs of the job
+func (j *JobRun) Log(ctx context.Context, lines ...string) {
+	if db := j.Store(); db != nil {
+		db.CreateLogBatch(ctx, j.ID, lines)
+	}
+}
+
+// jobTypes holds the registered job type handlers, by type
+var jobTypes = struct {
+	sync.RWMutex
+	handlers map[string]JobTypeHandler
+}{handlers: make(map[string]JobTypeHandler)}
+
+// RegisterJobType registers the handler of a job type, making the type usable by pipeline files
+// Registering a type again replaces its handler.
+func RegisterJobType(h JobTypeHandler) {
+	name := h.Info().Name
+	jobTypes.Lock()
+	jobTypes.handlers[name] = h
+	jobTypes.Unlock()
+
+	var validate pipeline.JobTypeValidator
+	if v, ok := h.(JobTypeValidator); ok {
+		validate = v.Validate
+	}
+	pipeline.RegisterJobType(name, validate)
+}
+
+// JobTypes describes the registered job types, sorted by name
+func JobTypes() []JobTypeInfo {
+	jobTypes.RLock()
+	defer jobTypes.RUnlock()
+	infos := make([]JobTypeInfo, 0, len(jobTypes.handlers))
+	for _, h := range jobTypes.handlers {
+		infos = append(infos, h.Info())
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// jobTypeHandler returns the handler of a job type, nil for untyped jobs and unknown types
+func jobTypeHandler(name string) JobTypeHandler {
+	jobTypes.RLock()
+	defer jobTypes.RUnlock()
+	return jobTypes.handlers[name]
+}
+
+// newJobRun returns the JobRun handed to the handler of a job
+func (e *PipelineExecutor) newJobRun(run *pipelineRun, jobName string, jobID int, job pipeline.JobConfig, vars map[string]string, local bool) *JobRun {
+	return &JobRun{Name: jobName, ID: jobID, Config: job, Vars: vars, Local: local, run: run, db: e.db}
+}
+
+// finishJob runs the Finish step of the handler of a successful job, logging the error failing it
+func (e *PipelineExecutor) finishJob(ctx context.Context, run *pipelineRun, jobName string, jobID int, job pipeline.JobConfig, vars map[string]string, local bool) error {
+	h := jobTypeHandler(job.Type)
+	if h == nil {
+		return nil
+	}
+	jobRun := e.newJobRun(run, jobName, jobID, job, vars, local)
+	if err := h.Finish(ctx, jobRun); err != nil {
+		logger.Error(fmt.Sprintf("Job %s failed: %v", jobName, err))
+		jobRun.Log(ctx, "ERROR: "+err.Error())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package executor
+
+import (
+	"sync"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+)
+
+// logFeedBuffer is the number of lines buffered per subscriber before new ones are dropped
+const logFeedBuffer = 256
+
+// DeploymentLogFeed hands the deployment log lines to live subscribers as they are stored, by pipeline
+type DeploymentLogFeed struct {
+	mu          sync.Mutex
+	subscribers map[int]map[chan models.DeploymentLog]struct{}
+}
+
+// NewDeploymentLogFeed creates a feed without subscribers
+func NewDeploymentLogFeed() *DeploymentLogFeed {
+	return &DeploymentLogFeed{subscribers: make(map[int]map[chan models.DeploymentLog]struct{})}
+}
+
+// Subscribe registers a subscriber to the deployment logs of a pipeline
+// The returned function unsubscribes and closes the channel
+func (f *DeploymentLogFeed) Subscribe(pipelineID int) (<-chan models.DeploymentLog, func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ch := make(chan models.DeploymentLog, logFeedBuffer)
+	if f.subscribers[pipelineID] == nil {
+		f.subscribers[pipelineID] = make(map[chan models.DeploymentLog]struct{})
+	}
+	f.subscribers[pipelineID][ch] = struct{}{}
+
+	return ch, func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if _, ok := f.subscribers[pipelineID][ch]; ok {
+			delete(f.subscribers[pipelineID], ch)
+			if len(f.subscribers[pipelineID]) == 0 {
+				delete(f.subscribers, pipelineID)
+			}
+			close(ch)
+		}
+	}
+}
+
+// Publish sends a stored line to the subscribers of its pipeline without blocking
+// Slow subscribers whose buffer is full miss the line
+func (f *DeploymentLogFeed) Publish(line models.DeploymentLog) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for ch := range f.subscribers[line.PipelineID] {
+		select {
+		case ch <- line:
+		default:
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package executor
+
+import "strings"
+
+// SanitizeLogLine cleans a line of job output before it is stored
+// ANSI color sequences are kept for the UI, while the sequences and control characters that move
+// the cursor or erase text are dropped. A line rewritten with carriage returns, like the progress
+// bars of docker pull or npm, is reduced to its final state. Embedded newlines, which the lines sent by
+// runners may hold, are kept and each of the lines they separate is cleaned on its own.
+func SanitizeLogLine(line string) string {
+	if strings.Contains(line, "\n") {
+		lines := strings.Split(line, "\n")
+		for i := range lines {
+			lines[i] = sanitizeLine(lines[i])
+		}
+		return strings.Join(lines, "\n")
+	}
+	return sanitizeLine(line)
+}
+
+// sanitizeLine cleans a line without newlines, see SanitizeLogLine
+func sanitizeLine(line string) string {
+	// Only the text written after the last carriage return is left on screen
+	if i := strings.LastIndexByte(strings.TrimRight(line, "\r"), '\r'); i >= 0 {
+		line = line[i+1:]
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == 0x1b:
+			end, keep := escapeSequence(line, i)
+			if keep {
+				b.WriteString(line[i:end])
+			}
+			i = end - 1
+		case c == '\t':
+			b.WriteByte(c)
+		case c < 0x20 || c == 0x7f:
+			// Null bytes (which Postgres rejects), backspaces, bells and other control characters
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// escapeSequence returns the end of the escape sequence starting at i, and whether it sets colors
+func escapeSequence(line string, i int) (int, bool) {
+	if i+1 >= len(line) {
+		return len(line), false
+	}
+	switch line[i+1] {
+	case '[':
+		// CSI: parameter and intermediate bytes, then a final byte, "m" selecting graphic rendition
+		j := i + 2
+		for j < len(line) && line[j] >= 0x20 && line[j] <= 0x3f {
+			j++
+		}
+		if j >= len(line) {
+			return len(line), false
+		}
+		return j + 1, line[j] == 'm'
+	case ']':
+		// OSC, such as window titles, ends with BEL or ESC \
+		for j := i + 2; j < len(line); j++ {
+			if line[j] == 0x07 {
+				return j + 1, false
+			}
+			if line[j] == 0x1b && j+1 < len(line) && line[j+1] == '\\' {
+				return j + 2, false
+			}
+		}
+		return len(line), false
+	default:
+		return i + 2, false
+	}
+}
@@ -0,0 +1,32 @@
+package executor
+
+import "testing"
+
+func TestSanitizeLogLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{"Plain", "Step 1/4 : FROM golang", "Step 1/4 : FROM golang"},
+		{"KeepsColors", "\x1b[1;32mok\x1b[0m", "\x1b[1;32mok\x1b[0m"},
+		{"DropsCursorMoves", "\x1b[2K\x1b[1Gdone\x1b[3A", "done"},
+		{"DropsTitleBell", "\x1b]0;npm install\x07added 12 packages", "added 12 packages"},
+		{"DropsTitleST", "\x1b]0;npm install\x1b\\added 12 packages", "added 12 packages"},
+		{"DropsUnterminatedEscape", "done\x1b[", "done"},
+		{"DropsControlCharacters", "a\x00b\x08c\x07d\x7f", "abcd"},
+		{"KeepsTabs", "name\tstatus", "name\tstatus"},
+		{"CollapsesCarriageReturns", "10%\r50%\r100% done", "100% done"},
+		{"TrailingCarriageReturn", "done\r", "done"},
+		{"EmbeddedNewlines", "first\nsecond", "first\nsecond"},
+		{"EmbeddedCRLF", "first\r\nsecond\r\n", "first\nsecond\n"},
+		{"RedrawsPerLine", "pull 10%\rpull 100%\n\x1b[2Kpush 5%\rpush 100%", "pull 100%\npush 100%"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SanitizeLogLine(tt.line); got != tt.want {
+				t.Errorf("SanitizeLogLine(%q) = %q, want %q", tt.line, got, tt.want)
+			}
+		})
+	}
+}
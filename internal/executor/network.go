@@ -0,0 +1,35 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/parser/pipeline"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+)
+
+// jobNetwork returns the Docker network mode of a job
+// The pipeline network is created by the first job using it and removed at the end of the run.
+func (e *PipelineExecutor) jobNetwork(ctx context.Context, run *pipelineRun, mode string) (string, error) {
+	if mode != pipeline.NetworkPipeline {
+		return mode, nil
+	}
+
+	run.networkOnce.Do(func() {
+		name := fmt.Sprintf("cicd-pipeline-%d", run.pipelineID)
+		if run.networkErr = e.docker.CreateNetwork(ctx, name); run.networkErr == nil {
+			run.network = name
+		}
+	})
+	return run.network, run.networkErr
+}
+
+// removePipelineNetwork removes the pipeline network if a job created it
+func (e *PipelineExecutor) removePipelineNetwork(run *pipelineRun) {
+	if run.network == "" {
+		return
+	}
+	if err := e.docker.RemoveNetwork(run.network); err != nil {
+		logger.Warn(fmt.Sprintf("Failed to remove pipeline network: %v", err))
+	}
+}
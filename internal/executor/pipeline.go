@@ -1,189 +1,914 @@
 package executor
 
 import (
-	"bufio"
+	"cmp"
+	"context"
+	"errors"
 	"fmt"
-	"io"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
-	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/docker/docker/api/types/registry"
 
-	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/database"
 	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/docker"
 	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/parser/compose"
 	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/parser/pipeline"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/ssh"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/store"
 	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 )
 
+// defaultMaxParallelJobs is the number of jobs of a pipeline allowed to run at once
+const defaultMaxParallelJobs = 4
+
 type PipelineExecutor struct {
-	db     *database.DB
-	docker *docker.DockerExecutor
+	db              store.Store
+	docker          *docker.DockerExecutor
+	maxParallelJobs int
+	// allowPrivileged lets jobs of every project run privileged, regardless of the project setting
+	allowPrivileged bool
+	// remoteExecution hands the jobs to runner agents instead of running them locally
+	remoteExecution bool
+	remote          remoteJobs
+	// allowShell lets projects run their jobs on the engine host, prefixed with shellWrapper
+	allowShell   bool
+	shellWrapper []string
+	// sshExecutors are the machines jobs with an ssh field run on, by name
+	sshExecutors map[string]ssh.Endpoint
+
+	// Manual jobs waiting to be played in a running pipeline, by job ID
+	// The channel of their pipeline run receives their name once played.
+	manualJobs   map[int]manualWait
+	manualJobsMu sync.Mutex
+
+	// Containers of the running jobs with a debug window, by job ID
+	debugContainers map[int]string
+	debugMu         sync.Mutex
 }
 
-func NewPipelineExecutor(db *database.DB, docker *docker.DockerExecutor) *PipelineExecutor {
+func NewPipelineExecutor(db store.Store, docker *docker.DockerExecutor) *PipelineExecutor {
 	return &PipelineExecutor{
-		db:     db,
-		docker: docker,
+		db:              db,
+		docker:          docker,
+		maxParallelJobs: defaultMaxParallelJobs,
+		manualJobs:      make(map[int]manualWait),
+		debugContainers: make(map[int]string),
+		remote:          remoteJobs{jobs: make(map[int]*remoteJob)},
+	}
+}
+
+// ErrNotWaiting is returned by Play for a job that is neither waiting in a running pipeline nor in a parked one
+var ErrNotWaiting = errors.New("job is not waiting to be played")
+
+// Play starts a manual job waiting in a running pipeline, or marks it played in a pipeline parked on its manual jobs
+// resume reports that the pipeline was parked: it is queued again and must be enqueued to run the job.
+func (e *PipelineExecutor) Play(ctx context.Context, jobID, pipelineID int) (resume bool, err error) {
+	e.manualJobsMu.Lock()
+	defer e.manualJobsMu.Unlock()
+
+	if wait, ok := e.manualJobs[jobID]; ok {
+		delete(e.manualJobs, jobID)
+		wait.plays <- wait.name
+		return false, nil
+	}
+
+	if e.db == nil {
+		return false, ErrNotWaiting
+	}
+	// parkPipeline sets the manual status under manualJobsMu, so a play cannot fall between the run and the park
+	p, err := e.db.GetPipeline(ctx, pipelineID)
+	if err != nil {
+		return false, err
+	}
+	if p.Status != "manual" {
+		return false, ErrNotWaiting
+	}
+	// A pending manual job is a played one, see resumedJobs
+	if err := e.db.UpdateJobStatus(ctx, jobID, "pending", nil); err != nil {
+		return false, err
+	}
+	if err := e.db.UpdatePipelineStatus(ctx, pipelineID, "queued"); err != nil {
+		return false, err
 	}
+	return true, nil
 }
 
-// Execute runs all jobs in the pipeline
-func (e *PipelineExecutor) Execute(config *pipeline.PipelineConfig, workspaceDir string, pipelineID int, project *models.Project) bool {
-	pipelineSuccess := true
+// SetMaxParallelJobs bounds the number of jobs of a pipeline running at once
+func (e *PipelineExecutor) SetMaxParallelJobs(n int) {
+	if n < 1 {
+		n = 1
+	}
+	e.maxParallelJobs = n
+}
+
+// SetAllowPrivileged allows privileged jobs on the whole instance
+func (e *PipelineExecutor) SetAllowPrivileged(allow bool) {
+	e.allowPrivileged = allow
+}
 
-	// Prepare environment variables
-	var envVars []string
+// Execute runs all jobs in the pipeline and returns its status: success, failed, or manual once it is parked
+// Jobs start as soon as their dependencies are done, see jobDependencies and jobCondition, up to maxParallelJobs at once
+// A pipeline where only unplayed manual jobs are left is parked in the manual state, freeing its worker, see Play.
+// Cancelling ctx stops the running job containers and skips the remaining jobs
+func (e *PipelineExecutor) Execute(ctx context.Context, config *pipeline.PipelineConfig, workspaceDir string, params models.PipelineRunParams, project *models.Project) string {
+	// Fetch project variables (Secrets/Env Vars), they take precedence over the CI file variables
+	projectVars := make(map[string]string)
+	if project != nil && e.db != nil {
+		variables, err := e.db.GetVariablesByProject(ctx, project.ID)
+		if err != nil {
+			logger.Error("Failed to fetch project variables: " + err.Error())
+		} else {
+			projectVars = scopedVariables(variables, params.Environment)
+		}
+	}
+
+	run := &pipelineRun{
+		params:          params,
+		workspaceDir:    workspaceDir,
+		pipelineID:      params.PipelineID,
+		projectID:       params.ProjectID,
+		predefinedVars:  predefinedVariables(params),
+		globalVariables: config.Variables,
+		projectVars:     projectVars,
+		allowPrivileged: e.allowPrivileged || (project != nil && project.AllowPrivileged),
+		pullCredentials: pullCredentials(project, projectVars),
+	}
 	if project != nil {
-		// Inject Custom Variables (Secrets/Env Vars)
-		if e.db != nil {
-			variables, err := e.db.GetVariablesByProject(project.ID)
-			if err != nil {
-				logger.Error("Failed to fetch project variables: " + err.Error())
-			} else {
-				for _, v := range variables {
-					envVars = append(envVars, fmt.Sprintf("%s=%s", v.Key, v.Value))
+		run.imageNamespace = compose.ImageNamespace(project.RegistryURL, project.RegistryUser)
+		run.jobExecutor = project.JobExecutor
+	}
+	defer e.removePipelineNetwork(run)
+
+	order := scheduledJobs(config)
+	deps := jobDependencies(config, order)
+
+	results := make(chan jobResult)
+	// Each manual job is played at most once, so Play never blocks on the buffer
+	plays := make(chan string, len(order))
+	started := make(map[string]bool)
+	// done holds the jobs that ran or were skipped
+	done := make(map[string]bool)
+	played := make(map[string]bool)
+	// waiting holds the IDs of the manual jobs waiting to be played, by name
+	waiting := make(map[string]int)
+	defer e.forgetManualJobs(waiting)
+	running := 0
+	var failedJobs []string
+
+	if params.Resume {
+		failedJobs = e.resumedJobs(ctx, run, config, order, done, played)
+	}
+
+	for {
+		// Start the jobs whose dependencies are all done and whose when holds, unless the pipeline is cancelled
+		if ctx.Err() == nil {
+			for _, jobName := range order {
+				if _, ok := waiting[jobName]; ok || started[jobName] || done[jobName] || !dependenciesMet(deps[jobName], done) {
+					continue
+				}
+				switch jobCondition(config.Jobs[jobName].When, len(failedJobs) > 0) {
+				case conditionWait:
+					continue
+				case conditionSkip:
+					e.skipJob(ctx, run, jobName)
+					done[jobName] = true
+					continue
 				}
+				if config.Jobs[jobName].When == pipeline.WhenManual && !played[jobName] {
+					if e.db == nil || run.pipelineID <= 0 {
+						logger.Warn(fmt.Sprintf("Manual job %s cannot be played without a database, starting it", jobName))
+					} else {
+						if jobID, ok := e.awaitPlay(ctx, run, jobName, config.Jobs[jobName], plays); ok {
+							waiting[jobName] = jobID
+						} else {
+							done[jobName] = true
+						}
+						continue
+					}
+				}
+				if running >= e.maxParallelJobs {
+					break
+				}
+				started[jobName] = true
+				running++
+				go func(jobName string, job pipeline.JobConfig) {
+					results <- jobResult{name: jobName, status: e.runJob(ctx, run, jobName, job)}
+				}(jobName, config.Jobs[jobName])
+			}
+		}
+
+		if running == 0 && (len(waiting) == 0 || ctx.Err() != nil) {
+			// Nothing can fail anymore, the on_failure jobs are skipped, which may let their dependents start
+			if e.skipWaitingJobs(ctx, run, config, order, deps, started, done) {
+				continue
+			}
+			break
+		}
+		if running == 0 {
+			// Only manual jobs are left, the pipeline waits for a play without holding its worker
+			if e.parkPipeline(ctx, run, waiting, plays) {
+				logger.Info(fmt.Sprintf("Pipeline %d is waiting for manual jobs to be played", run.pipelineID))
+				return "manual"
+			}
+		}
+
+		select {
+		case result := <-results:
+			running--
+			done[result.name] = true
+			if result.status == "failed" {
+				// Only on_failure and always jobs start after a failure, jobs already running are left to finish
+				failedJobs = append(failedJobs, result.name)
+				e.skipManualJobs(ctx, run, waiting, done)
+			}
+		case name := <-plays:
+			// A play racing a failure finds the job skipped already
+			if _, ok := waiting[name]; ok {
+				delete(waiting, name)
+				played[name] = true
+				logger.Info(fmt.Sprintf("Manual job %s played", name))
 			}
 		}
 	}
 
-	for _, stageName := range config.Stages {
-		logger.Info(fmt.Sprintf("Running stage: %s", stageName))
+	if ctx.Err() != nil {
+		logger.Info("Pipeline cancelled, remaining jobs skipped")
+		return "failed"
+	}
+	if len(failedJobs) > 0 {
+		sort.Strings(failedJobs)
+		logger.Error(fmt.Sprintf("Pipeline failed, failed jobs: %s", strings.Join(failedJobs, ", ")))
+		return "failed"
+	}
+	if len(done) != len(order) {
+		return "failed"
+	}
+	return "success"
+}
 
-		for jobName, job := range config.Jobs {
-			if job.Stage != stageName {
-				continue
+// pipelineRun holds what every job of a pipeline run shares
+type pipelineRun struct {
+	params          models.PipelineRunParams
+	workspaceDir    string
+	pipelineID      int
+	projectID       int
+	predefinedVars  map[string]string
+	globalVariables map[string]string
+	projectVars     map[string]string
+	allowPrivileged bool
+	pullCredentials map[string]registry.AuthConfig
+	// jobExecutor is the JobExecutor value of the project
+	jobExecutor string
+	// imageNamespace prefixes the images built for compose services, see compose.ImageNamespace
+	imageNamespace string
+
+	// Network shared by the jobs using network: pipeline, created on first use
+	networkOnce sync.Once
+	network     string
+	networkErr  error
+}
+
+// predefinedVariables returns the CI_* variables describing the pipeline run
+func predefinedVariables(params models.PipelineRunParams) map[string]string {
+	shortSHA := params.CommitHash
+	if len(shortSHA) > 8 {
+		shortSHA = shortSHA[:8]
+	}
+	vars := map[string]string{
+		"CI":                  "true",
+		"CI_PIPELINE_ID":      strconv.Itoa(params.PipelineID),
+		"CI_PROJECT_ID":       strconv.Itoa(params.ProjectID),
+		"CI_PROJECT_NAME":     params.RepoName,
+		"CI_REPOSITORY_URL":   params.RepoURL,
+		"CI_COMMIT_SHA":       params.CommitHash,
+		"CI_COMMIT_SHORT_SHA": shortSHA,
+		"CI_COMMIT_BRANCH":    params.Branch,
+	}
+	if params.Tag != "" {
+		vars["CI_COMMIT_TAG"] = params.Tag
+		delete(vars, "CI_COMMIT_BRANCH")
+	}
+	if params.Environment != "" {
+		vars["CI_ENVIRONMENT_NAME"] = params.Environment
+	}
+	return vars
+}
+
+// scopedVariables returns the project variables given to the jobs of a pipeline deploying to environment
+// Variables scoped to the environment override the ones shared by every environment, other scopes are left out
+func scopedVariables(variables []models.Variable, environment string) map[string]string {
+	vars := make(map[string]string)
+	for _, v := range variables {
+		if v.EnvironmentScope == models.AllEnvironments || v.EnvironmentScope == "" {
+			vars[v.Key] = v.Value
+		}
+	}
+	if environment != "" {
+		for _, v := range variables {
+			if v.EnvironmentScope == environment {
+				vars[v.Key] = v.Value
 			}
+		}
+	}
+	return vars
+}
 
-			logger.Info(fmt.Sprintf("Running job: %s (image: %s)", jobName, job.Image))
+// jobVariables merges the variables available to a job
+// Precedence: project variables, then job variables, then the CI file global variables, then predefined variables
+func (run *pipelineRun) jobVariables(jobName string, job pipeline.JobConfig) map[string]string {
+	merged := map[string]string{
+		"CI_JOB_NAME":  jobName,
+		"CI_JOB_STAGE": job.Stage,
+	}
+	for _, vars := range []map[string]string{run.predefinedVars, run.globalVariables, job.Variables, run.projectVars} {
+		for k, v := range vars {
+			merged[k] = v
+		}
+	}
+	return merged
+}
 
-			// Update job status in database
-			var jobID int
-			if e.db != nil && pipelineID > 0 {
-				dbJob, err := e.db.GetJobByName(pipelineID, jobName)
-				if err != nil {
-					logger.Warn(fmt.Sprintf("Job not found, creating: %v", err))
-					dbJob, err = e.db.CreateJob(pipelineID, jobName, job.Stage, job.Image)
-				}
+// envList formats variables as KEY=value entries sorted by name
+func envList(vars map[string]string) []string {
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
 
-				if err == nil && dbJob != nil {
-					jobID = dbJob.ID
-					e.db.UpdateJobStatus(jobID, "running", nil)
-				} else {
-					logger.Error(fmt.Sprintf("Failed to get/create job record: %v", err))
-				}
+	env := make([]string, 0, len(keys))
+	for _, k := range keys {
+		env = append(env, fmt.Sprintf("%s=%s", k, vars[k]))
+	}
+	return env
+}
+
+// manualWait is a manual job waiting to be played in a running pipeline
+type manualWait struct {
+	name  string
+	plays chan<- string
+}
+
+// jobResult is the final status of a job run by the scheduler
+type jobResult struct {
+	name   string
+	status string
+}
+
+// scheduledJobs returns the jobs of the configured stages, ordered by stage then by name
+func scheduledJobs(config *pipeline.PipelineConfig) []string {
+	var order []string
+	for _, stageName := range config.Stages {
+		var names []string
+		for jobName, job := range config.Jobs {
+			if job.Stage == stageName {
+				names = append(names, jobName)
 			}
+		}
+		sort.Strings(names)
+		order = append(order, names...)
+	}
+	return order
+}
+
+// jobDependencies returns the jobs each scheduled job waits for
+// A job declaring needs waits only for those jobs, others wait for every job of the previous stages.
+// Needs on jobs that are not scheduled (e.g. stages skipped on retry) are ignored.
+func jobDependencies(config *pipeline.PipelineConfig, order []string) map[string][]string {
+	scheduled := make(map[string]bool, len(order))
+	for _, jobName := range order {
+		scheduled[jobName] = true
+	}
+
+	deps := make(map[string][]string, len(order))
+	var previousStages []string
+	var stageJobs []string
+	currentStage := ""
 
-			// Pull the image
-			logger.Info(fmt.Sprintf("Pulling image: %s", job.Image))
-			if err := e.docker.PullImage(job.Image); err != nil {
-				logger.Error(fmt.Sprintf("Failed to pull image %s: %v", job.Image, err))
-				if e.db != nil && jobID > 0 {
-					exitCode := 1
-					e.db.UpdateJobStatus(jobID, "failed", &exitCode)
+	for _, jobName := range order {
+		job := config.Jobs[jobName]
+		if job.Stage != currentStage {
+			previousStages = append(previousStages, stageJobs...)
+			stageJobs = nil
+			currentStage = job.Stage
+		}
+		stageJobs = append(stageJobs, jobName)
+
+		if job.Needs != nil {
+			for _, need := range job.Needs {
+				if scheduled[need] {
+					deps[jobName] = append(deps[jobName], need)
 				}
-				pipelineSuccess = false
-				continue
 			}
+			continue
+		}
 
-			// Run the job with workspace mounted
-			containerID, err := e.docker.RunJobWithVolume(job.Image, job.Script, workspaceDir, envVars)
-			if err != nil {
-				logger.Error(fmt.Sprintf("Failed to start job %s: %v", jobName, err))
-				if e.db != nil && jobID > 0 {
-					exitCode := 1
-					e.db.UpdateJobStatus(jobID, "failed", &exitCode)
-				}
-				pipelineSuccess = false
-				continue
+		deps[jobName] = append([]string(nil), previousStages...)
+	}
+	return deps
+}
+
+// Decisions of jobCondition on a job whose dependencies are done
+const (
+	conditionRun = iota
+	conditionSkip
+	conditionWait
+)
+
+// jobCondition decides whether a job whose dependencies are done runs, given whether a job of the pipeline failed
+// An on_failure job waits while jobs still running may fail, see skipWaitingJobs.
+func jobCondition(when string, failed bool) int {
+	switch when {
+	case pipeline.WhenAlways:
+		return conditionRun
+	case pipeline.WhenOnFailure:
+		if failed {
+			return conditionRun
+		}
+		return conditionWait
+	default:
+		if failed {
+			return conditionSkip
+		}
+		return conditionRun
+	}
+}
+
+// skipWaitingJobs skips the on_failure jobs ready to run in a pipeline where no job failed, reporting whether there were any
+func (e *PipelineExecutor) skipWaitingJobs(ctx context.Context, run *pipelineRun, config *pipeline.PipelineConfig, order []string, deps map[string][]string, started, done map[string]bool) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	skipped := false
+	for _, jobName := range order {
+		if started[jobName] || done[jobName] || config.Jobs[jobName].When != pipeline.WhenOnFailure || !dependenciesMet(deps[jobName], done) {
+			continue
+		}
+		e.skipJob(ctx, run, jobName)
+		done[jobName] = true
+		skipped = true
+	}
+	return skipped
+}
+
+// skipJob marks a job the pipeline does not run as skipped
+func (e *PipelineExecutor) skipJob(ctx context.Context, run *pipelineRun, jobName string) {
+	logger.Info(fmt.Sprintf("Job %s skipped", jobName))
+	if e.db == nil || run.pipelineID <= 0 {
+		return
+	}
+	if dbJob, err := e.db.GetJobByName(ctx, run.pipelineID, jobName); err == nil {
+		e.db.UpdateJobStatus(ctx, dbJob.ID, "skipped", nil)
+	}
+}
+
+// dependenciesMet reports whether all the given jobs are done
+func dependenciesMet(deps []string, done map[string]bool) bool {
+	for _, dep := range deps {
+		if !done[dep] {
+			return false
+		}
+	}
+	return true
+}
+
+// awaitPlay puts a manual job in the manual state and registers it so Play sends its name on plays
+// It reports false when the job has no record to wait on, the job is then left out of the pipeline.
+func (e *PipelineExecutor) awaitPlay(ctx context.Context, run *pipelineRun, jobName string, job pipeline.JobConfig, plays chan<- string) (int, bool) {
+	dbJob, err := e.db.GetJobByName(ctx, run.pipelineID, jobName)
+	if err != nil {
+		dbJob, err = e.db.CreateJob(ctx, run.pipelineID, jobName, job.Stage, job.Image)
+	}
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to get/create manual job record %s: %v", jobName, err))
+		return 0, false
+	}
+
+	e.manualJobsMu.Lock()
+	e.manualJobs[dbJob.ID] = manualWait{name: jobName, plays: plays}
+	e.manualJobsMu.Unlock()
+	e.db.UpdateJobStatus(ctx, dbJob.ID, "manual", nil)
+	logger.Info(fmt.Sprintf("Job %s is waiting to be played", jobName))
+	return dbJob.ID, true
+}
+
+// parkPipeline puts a pipeline whose only jobs left are waiting manual jobs in the manual state
+// It reports false when a play came in meanwhile, the pipeline then keeps running.
+// The jobs stay in the manual state and a play queues the pipeline again, see Play.
+func (e *PipelineExecutor) parkPipeline(ctx context.Context, run *pipelineRun, waiting map[string]int, plays <-chan string) bool {
+	e.manualJobsMu.Lock()
+	defer e.manualJobsMu.Unlock()
+
+	if len(plays) > 0 {
+		return false
+	}
+	for _, jobID := range waiting {
+		delete(e.manualJobs, jobID)
+	}
+	clear(waiting)
+	e.db.UpdatePipelineStatus(ctx, run.pipelineID, "manual")
+	return true
+}
+
+// skipManualJobs skips the manual jobs waiting in a pipeline where a job failed
+func (e *PipelineExecutor) skipManualJobs(ctx context.Context, run *pipelineRun, waiting map[string]int, done map[string]bool) {
+	e.forgetManualJobs(waiting)
+	for jobName, jobID := range waiting {
+		e.db.UpdateJobStatus(ctx, jobID, "skipped", nil)
+		done[jobName] = true
+		delete(waiting, jobName)
+	}
+}
+
+// forgetManualJobs stops the waiting manual jobs from being played in this run
+// A cancelled pipeline cancels its unfinished jobs itself.
+func (e *PipelineExecutor) forgetManualJobs(waiting map[string]int) {
+	e.manualJobsMu.Lock()
+	defer e.manualJobsMu.Unlock()
+	for _, jobID := range waiting {
+		delete(e.manualJobs, jobID)
+	}
+}
+
+// resumedJobs restores the state of a resumed pipeline from its job records, returning the failed jobs
+// Finished jobs are done, and manual jobs left pending by Play are played. Manual jobs still
+// in the manual state wait again.
+func (e *PipelineExecutor) resumedJobs(ctx context.Context, run *pipelineRun, config *pipeline.PipelineConfig, order []string, done, played map[string]bool) []string {
+	if e.db == nil || run.pipelineID <= 0 {
+		return nil
+	}
+	jobs, err := e.db.GetJobsByPipeline(ctx, run.pipelineID)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to get the jobs of resumed pipeline %d: %v", run.pipelineID, err))
+		return nil
+	}
+	statuses := make(map[string]string, len(jobs))
+	for _, job := range jobs {
+		statuses[job.Name] = job.Status
+	}
+
+	var failedJobs []string
+	for _, jobName := range order {
+		switch statuses[jobName] {
+		case "success", "skipped", "cancelled":
+			done[jobName] = true
+		case "failed":
+			done[jobName] = true
+			failedJobs = append(failedJobs, jobName)
+		case "pending":
+			if config.Jobs[jobName].When == pipeline.WhenManual {
+				played[jobName] = true
 			}
+		}
+	}
+	return failedJobs
+}
+
+// runJob runs a single job container and returns its final status: success, failed or cancelled
+func (e *PipelineExecutor) runJob(ctx context.Context, run *pipelineRun, jobName string, job pipeline.JobConfig) (status string) {
+	pipelineID := run.pipelineID
+
+	ctx, span := tracing.Start(ctx, "job "+jobName,
+		attribute.String("cicd.job.name", jobName),
+		attribute.String("cicd.job.stage", job.Stage))
+	defer func() {
+		span.SetAttributes(attribute.String("cicd.job.status", status))
+		if status == "failed" {
+			span.SetStatus(codes.Error, "job failed")
+		}
+		span.End()
+	}()
+
+	// Records must land even once the pipeline is cancelled or the job timed out
+	dbCtx := context.WithoutCancel(ctx)
+
+	// Expand ${VAR} references in the image and workdir
+	// Script lines are left to the job shell, which reads the variables from its environment: a value spliced into the
+	// script would be run as shell code, and secrets would appear in the command of the container.
+	vars := run.jobVariables(jobName, job)
+	if h := jobTypeHandler(job.Type); h != nil {
+		job = h.Prepare(e.newJobRun(run, jobName, 0, job, vars, false))
+	}
+	job.Image = pipeline.Interpolate(job.Image, vars)
+	job.Workdir = pipeline.Interpolate(job.Workdir, vars)
+	var script []string
+	for i, line := range append(append([]string(nil), job.BeforeScript...), job.Script...) {
+		script = append(script, sectionStart(i+1, line), line, sectionEnd(i+1))
+	}
+
+	logger.Info(fmt.Sprintf("Running job: %s (stage: %s, image: %s)", jobName, job.Stage, job.Image))
 
-			// Collect and store logs
-			e.collectLogs(containerID, jobID)
+	// Update job status in database
+	var jobID int
+	if e.db != nil && pipelineID > 0 {
+		dbJob, err := e.db.GetJobByName(dbCtx, pipelineID, jobName)
+		if err != nil {
+			logger.Warn(fmt.Sprintf("Job not found, creating: %v", err))
+			dbJob, err = e.db.CreateJob(dbCtx, pipelineID, jobName, job.Stage, job.Image)
+		}
 
-			// Wait for container to finish
-			statusCode, err := e.docker.WaitForContainer(containerID)
-			if err != nil {
-				logger.Error(fmt.Sprintf("Error waiting for container: %v", err))
+		if err == nil && dbJob != nil {
+			jobID = dbJob.ID
+			// Remote jobs are running once a runner claims them
+			if !e.remoteExecution || run.jobExecutor == models.JobExecutorShell || job.SSH != "" {
+				e.db.UpdateJobStatus(dbCtx, jobID, "running", nil)
 			}
+		} else {
+			logger.Error(fmt.Sprintf("Failed to get/create job record: %v", err))
+		}
+	}
 
-			// Update job status
-			exitCode := int(statusCode)
+	// SSH and shell jobs run where they say even when the other jobs go to runners
+	if job.SSH != "" {
+		return e.runSSHJob(ctx, run, jobName, jobID, job, script, vars)
+	}
+	if run.jobExecutor == models.JobExecutorShell {
+		return e.runShellJob(ctx, run, jobName, jobID, job, script, vars)
+	}
+	if e.remoteExecution && jobID > 0 {
+		return e.runRemoteJob(ctx, run, jobName, jobID, job, script, vars)
+	}
+
+	// Pull the image
+	logger.Info(fmt.Sprintf("Pulling image: %s", job.Image))
+	if err := e.docker.PullImageWithAuth(ctx, job.Image, run.registryAuth(job.Image)); err != nil {
+		logger.Error(fmt.Sprintf("Failed to pull image %s: %v", job.Image, err))
+		if e.db != nil && jobID > 0 {
+			exitCode := 1
+			e.db.UpdateJobStatus(dbCtx, jobID, "failed", &exitCode)
+		}
+		return "failed"
+	}
+
+	// Run the job with workspace mounted, restoring and saving its cache around the script
+	opts := docker.JobOptions{WorkingDir: job.WorkingDir("/workspace"), Entrypoint: job.Entrypoint}
+	if job.Cache != nil && len(job.Cache.Paths) > 0 && run.projectID > 0 {
+		cacheDir, err := projectCacheDir(run.projectID, job.Cache.Key)
+		if err != nil {
+			logger.Warn(fmt.Sprintf("Cache disabled for job %s: %v", jobName, err))
+		} else {
+			opts.CacheDir = cacheDir
+			script = wrapWithCache(script, job.Cache.Paths)
+		}
+	}
+	if job.Privileged {
+		if !run.allowPrivileged {
+			logger.Error(fmt.Sprintf("Job %s requests privileged mode, which the project does not allow", jobName))
+			if e.db != nil && jobID > 0 {
+				e.db.CreateLogBatch(dbCtx, jobID, []string{"ERROR: Privileged mode is not allowed for this project"})
+				exitCode := 1
+				e.db.UpdateJobStatus(dbCtx, jobID, "failed", &exitCode)
+			}
+			return "failed"
+		}
+		opts.Privileged = true
+	}
+	// The host network reaches the services of the server and its loopback, it is gated as privileged mode is
+	if job.Network == pipeline.NetworkHost && !run.allowPrivileged {
+		logger.Error(fmt.Sprintf("Job %s requests the host network, which the project does not allow", jobName))
+		if e.db != nil && jobID > 0 {
+			e.db.CreateLogBatch(dbCtx, jobID, []string{"ERROR: The host network is not allowed for this project, it needs privileged jobs to be allowed"})
+			exitCode := 1
+			e.db.UpdateJobStatus(dbCtx, jobID, "failed", &exitCode)
+		}
+		return "failed"
+	}
+	// Jobs share the network of their pipeline, and of their services, unless they choose another one
+	network, err := e.jobNetwork(ctx, run, cmp.Or(job.Network, pipeline.NetworkPipeline))
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to set up network for job %s: %v", jobName, err))
+		if e.db != nil && jobID > 0 {
+			e.db.CreateLogBatch(dbCtx, jobID, []string{"ERROR: Failed to set up the job network: " + err.Error()})
+			exitCode := 1
+			e.db.UpdateJobStatus(dbCtx, jobID, "failed", &exitCode)
+		}
+		return "failed"
+	}
+	opts.Network = network
+	if job.Dind {
+		service, err := e.setupDind(ctx, run, jobName, vars, &opts)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to set up Docker for job %s: %v", jobName, err))
 			if e.db != nil && jobID > 0 {
-				status := "success"
-				if statusCode != 0 {
-					status = "failed"
+				e.db.CreateLogBatch(dbCtx, jobID, []string{"ERROR: Failed to set up Docker: " + err.Error()})
+				exitCode := 1
+				e.db.UpdateJobStatus(dbCtx, jobID, "failed", &exitCode)
+			}
+			return "failed"
+		}
+		if service != nil {
+			defer func() {
+				if err := e.docker.StopDindService(service); err != nil {
+					logger.Warn(fmt.Sprintf("Failed to stop Docker service of job %s: %v", jobName, err))
 				}
-				e.db.UpdateJobStatus(jobID, status, &exitCode)
+			}()
+			script = append([]string{dindWaitCommand}, script...)
+		}
+	}
+	if len(job.Services) > 0 {
+		stopServices, err := e.startServices(ctx, run, jobName, job, vars)
+		if err == nil && opts.Network != run.network {
+			stopServices()
+			err = fmt.Errorf("the job left the pipeline network for its Docker service")
+		}
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to start the services of job %s: %v", jobName, err))
+			if e.db != nil && jobID > 0 {
+				e.db.CreateLogBatch(dbCtx, jobID, []string{"ERROR: Failed to start the job services: " + err.Error()})
+				exitCode := 1
+				e.db.UpdateJobStatus(dbCtx, jobID, "failed", &exitCode)
 			}
+			return "failed"
+		}
+		defer stopServices()
+	}
+	debug, _ := job.DebugDuration()
+	if debug > 0 {
+		script = wrapForDebug(script, debug)
+	}
+	containerID, err := e.docker.RunJobWithVolume(ctx, job.Image, script, run.workspaceDir, envList(vars), opts)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to start job %s: %v", jobName, err))
+		if e.db != nil && jobID > 0 {
+			exitCode := 1
+			e.db.UpdateJobStatus(dbCtx, jobID, "failed", &exitCode)
+		}
+		return "failed"
+	}
 
-			if statusCode != 0 {
-				logger.Error(fmt.Sprintf("Job %s failed with exit code %d", jobName, statusCode))
-				pipelineSuccess = false
-				// Stop pipeline on first failure
-				return false
-			}
+	defer func() {
+		if err := e.docker.RemoveContainer(containerID); err != nil {
+			logger.Warn(fmt.Sprintf("Failed to remove container %s: %v", containerID, err))
+		}
+	}()
 
-			logger.Info(fmt.Sprintf("Job %s completed successfully", jobName))
+	if debug > 0 && jobID > 0 {
+		defer e.trackDebug(jobID, containerID)()
+	}
+
+	// Stop the container if the pipeline gets cancelled or the job times out
+	jobCtx, cancelJob := ctx, context.CancelFunc(func() {})
+	timeout, _ := job.TimeoutDuration()
+	if timeout > 0 {
+		// The debug window does not eat into the time of the script
+		jobCtx, cancelJob = context.WithTimeout(ctx, timeout+debug)
+	}
+	stopWatch := e.watchCancellation(jobCtx, containerID)
+	stopSampling := e.docker.SampleUsage(ctx, containerID)
+
+	// Collect and store logs
+	e.collectLogs(jobCtx, containerID, jobName, jobID)
+
+	// Wait for container to finish
+	statusCode, err := e.docker.WaitForContainer(jobCtx, containerID)
+	stopWatch()
+	e.recordUsage(dbCtx, jobName, jobID, stopSampling())
+	timedOut := jobCtx.Err() == context.DeadlineExceeded
+	cancelJob()
+	if ctx.Err() != nil {
+		logger.Info(fmt.Sprintf("Job %s cancelled", jobName))
+		if e.db != nil && jobID > 0 {
+			exitCode := int(statusCode)
+			e.db.UpdateJobStatus(dbCtx, jobID, "cancelled", &exitCode)
+		}
+		return "cancelled"
+	}
+	if timedOut {
+		logger.Error(fmt.Sprintf("Job %s timed out after %s", jobName, timeout))
+		if e.db != nil && jobID > 0 {
+			e.db.CreateLogBatch(dbCtx, jobID, []string{fmt.Sprintf("ERROR: Job timed out after %s", timeout)})
+			exitCode := int(statusCode)
+			e.db.UpdateJobStatus(dbCtx, jobID, "failed", &exitCode)
+		}
+		return "failed"
+	}
+	if err != nil {
+		logger.Error(fmt.Sprintf("Error waiting for container: %v", err))
+	}
+
+	// Update job status
+	exitCode := int(statusCode)
+	if statusCode != 0 {
+		logger.Error(fmt.Sprintf("Job %s failed with exit code %d", jobName, statusCode))
+		if e.db != nil && jobID > 0 {
+			e.db.UpdateJobStatus(dbCtx, jobID, "failed", &exitCode)
+		}
+		return "failed"
+	}
+	if err := e.finishJob(dbCtx, run, jobName, jobID, job, vars, true); err != nil {
+		if e.db != nil && jobID > 0 {
+			exitCode = 1
+			e.db.UpdateJobStatus(dbCtx, jobID, "failed", &exitCode)
 		}
+		return "failed"
 	}
 
-	return pipelineSuccess
+	if e.db != nil && jobID > 0 {
+		e.db.UpdateJobStatus(dbCtx, jobID, "success", &exitCode)
+	}
+	logger.Info(fmt.Sprintf("Job %s completed successfully", jobName))
+	return "success"
 }
 
-// collectLogs collects logs from the container and stores them in the database
-func (e *PipelineExecutor) collectLogs(containerID string, jobID int) {
-	reader, err := e.docker.GetLogs(containerID)
-	if err != nil {
-		logger.Error(fmt.Sprintf("Failed to get logs: %v", err))
+// recordUsage stores the resources a job container used, when they could be sampled
+func (e *PipelineExecutor) recordUsage(ctx context.Context, jobName string, jobID int, usage *models.ResourceUsage) {
+	if usage == nil || e.db == nil || jobID <= 0 {
 		return
 	}
-	defer reader.Close()
-
-	// Use a pipe to connect stdcopy (writer) to scanner (reader)
-	pr, pw := io.Pipe()
+	if err := e.db.SetJobUsage(ctx, jobID, *usage); err != nil {
+		logger.Warn(fmt.Sprintf("Failed to record the resource usage of job %s: %v", jobName, err))
+	}
+}
 
-	// Run stdcopy in a goroutine to demultiplex the docker stream
+// watchCancellation stops the container as soon as ctx is cancelled
+// The returned function ends the watch once the container has finished on its own
+func (e *PipelineExecutor) watchCancellation(ctx context.Context, containerID string) func() {
+	finished := make(chan struct{})
 	go func() {
-		// We write both stdout and stderr to the same pipe
-		if _, err := stdcopy.StdCopy(pw, pw, reader); err != nil {
-			logger.Error(fmt.Sprintf("Error demultiplexing logs: %v", err))
+		select {
+		case <-ctx.Done():
+			logger.Info(fmt.Sprintf("Stopping container %s", containerID))
+			if err := e.docker.StopContainer(containerID); err != nil {
+				logger.Warn(fmt.Sprintf("Failed to stop container %s: %v", containerID, err))
+			}
+		case <-finished:
 		}
-		pw.Close()
 	}()
+	return func() { close(finished) }
+}
 
-	scanner := bufio.NewScanner(pr)
-	var logBatch []string
+const (
+	// logChunkSize is the size of text after which collected lines are stored as one chunk
+	logChunkSize = 64 * 1024
+	// logFlushInterval stores the lines collected so far even when the chunk is not full, for streaming
+	logFlushInterval = time.Second
+)
 
-	for scanner.Scan() {
-		line := scanner.Text()
+// collectLogs collects logs from the container and stores them in the database
+func (e *PipelineExecutor) collectLogs(ctx context.Context, containerID, jobName string, jobID int) {
+	lines, err := e.docker.FollowLogs(ctx, containerID)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to get logs: %v", err))
+		return
+	}
+	e.storeLogs(ctx, lines, jobName, jobID)
+}
 
-		// Sanitize line: remove null bytes (Postgres doesn't allow them in text)
-		cleanLine := strings.ReplaceAll(line, "\x00", "")
+// storeLogs stores the output lines of a job in the database until lines is closed
+// Console output is prefixed with the job name since jobs may run in parallel
+func (e *PipelineExecutor) storeLogs(ctx context.Context, lines <-chan models.LogLine, jobName string, jobID int) {
+	// The last lines are stored once the job context is done
+	dbCtx := context.WithoutCancel(ctx)
 
-		if cleanLine == "" {
-			continue
+	var logBatch []models.LogLine
+	batchSize := 0
+	flush := func() {
+		if len(logBatch) > 0 && e.db != nil && jobID > 0 {
+			if err := e.db.CreateLogEntries(dbCtx, jobID, logBatch); err != nil {
+				logger.Error(fmt.Sprintf("Failed to store logs: %v", err))
+			}
 		}
+		logBatch = nil
+		batchSize = 0
+	}
+
+	ticker := time.NewTicker(logFlushInterval)
+	defer ticker.Stop()
 
-		// Print to console
-		fmt.Println(cleanLine)
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				// Store remaining logs
+				flush()
+				return
+			}
 
-		// Add to batch
-		logBatch = append(logBatch, cleanLine)
+			// Sanitize line: keep colors, drop control characters and progress bar redraws
+			line.Content = SanitizeLogLine(line.Content)
 
-		// Store in batches of 10
-		if len(logBatch) >= 10 && e.db != nil && jobID > 0 {
-			if err := e.db.CreateLogBatch(jobID, logBatch); err != nil {
-				logger.Error(fmt.Sprintf("Failed to store logs: %v", err))
+			if line.Content == "" {
+				continue
 			}
-			logBatch = nil
-		}
-	}
 
-	// Store remaining logs
-	if len(logBatch) > 0 && e.db != nil && jobID > 0 {
-		if err := e.db.CreateLogBatch(jobID, logBatch); err != nil {
-			logger.Error(fmt.Sprintf("Failed to store remaining logs: %v", err))
+			// Print to console
+			fmt.Printf("[%s] %s\n", jobName, line.Content)
+
+			// Store in chunks of about logChunkSize
+			logBatch = append(logBatch, line)
+			batchSize += len(line.Content) + 1
+			if batchSize >= logChunkSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
 		}
 	}
 }
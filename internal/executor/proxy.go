@@ -0,0 +1,44 @@
+package executor
+
+import (
+	"os"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/parser/compose"
+)
+
+// proxyRoute returns the route of the project behind the reverse proxy of the environment
+// The proxy setup shared by the hosts comes from PROXY_NETWORK (the external network of the proxy, named after it by default),
+// PROXY_TLS=false to serve plain HTTP, TRAEFIK_ENTRYPOINT (websecure by default) and TRAEFIK_CERT_RESOLVER.
+func proxyRoute(params models.PipelineRunParams) compose.ProxyRoute {
+	name := composeProjectName(params)
+	route := compose.ProxyRoute{
+		Provider:     params.Proxy,
+		Name:         name,
+		Host:         name + "." + params.ProxyDomain,
+		Service:      params.ProxyService,
+		Port:         params.ProxyPort,
+		Network:      os.Getenv("PROXY_NETWORK"),
+		EntryPoint:   os.Getenv("TRAEFIK_ENTRYPOINT"),
+		TLS:          os.Getenv("PROXY_TLS") != "false",
+		CertResolver: os.Getenv("TRAEFIK_CERT_RESOLVER"),
+	}
+	if route.Network == "" {
+		route.Network = params.Proxy
+	}
+	if route.EntryPoint == "" {
+		route.EntryPoint = "websecure"
+		if !route.TLS {
+			route.EntryPoint = "web"
+		}
+	}
+	return route
+}
+
+// ProxyURL returns the URL a deployment is served at through the reverse proxy of its environment, empty without proxy
+func ProxyURL(params models.PipelineRunParams) string {
+	if params.Proxy == "" {
+		return ""
+	}
+	return proxyRoute(params).URL()
+}
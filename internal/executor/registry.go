@@ -0,0 +1,94 @@
+package executor
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types/registry"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/docker"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+)
+
+// dockerAuthConfigVariable is the project variable holding pull secrets, in the ~/.docker/config.json format
+const dockerAuthConfigVariable = "DOCKER_AUTH_CONFIG"
+
+// pullCredentials returns the registry credentials for job image pulls, by registry host
+// The project registry user and token are used for the project registry (Docker Hub by default), entries of DOCKER_AUTH_CONFIG override them.
+func pullCredentials(project *models.Project, projectVars map[string]string) map[string]registry.AuthConfig {
+	credentials := make(map[string]registry.AuthConfig)
+	if project != nil && project.RegistryUser != "" && project.RegistryToken != "" {
+		host := docker.RegistryHost(project.RegistryURL)
+		credentials[host] = registry.AuthConfig{
+			Username:      project.RegistryUser,
+			Password:      project.RegistryToken,
+			ServerAddress: host,
+		}
+	}
+
+	if authConfig := projectVars[dockerAuthConfigVariable]; authConfig != "" {
+		secrets, err := parseDockerAuthConfig(authConfig)
+		if err != nil {
+			logger.Warn(fmt.Sprintf("Ignoring %s: %v", dockerAuthConfigVariable, err))
+		}
+		for host, auth := range secrets {
+			credentials[host] = auth
+		}
+	}
+	return credentials
+}
+
+// registryServer returns the server address docker login expects for a registry URL, empty for Docker Hub
+func registryServer(registryURL string) string {
+	if host := docker.RegistryHost(registryURL); host != docker.DockerHubRegistry {
+		return host
+	}
+	return ""
+}
+
+// parseDockerAuthConfig reads the auths of a Docker config file, keyed by registry host
+func parseDockerAuthConfig(content string) (map[string]registry.AuthConfig, error) {
+	var config struct {
+		Auths map[string]struct {
+			Auth     string `json:"auth"`
+			Username string `json:"username"`
+			Password string `json:"password"`
+		} `json:"auths"`
+	}
+	if err := json.Unmarshal([]byte(content), &config); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	secrets := make(map[string]registry.AuthConfig, len(config.Auths))
+	for server, entry := range config.Auths {
+		username, password := entry.Username, entry.Password
+		if entry.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+			if err != nil {
+				return nil, fmt.Errorf("invalid auth for %s: %w", server, err)
+			}
+			var found bool
+			username, password, found = strings.Cut(string(decoded), ":")
+			if !found {
+				return nil, fmt.Errorf("invalid auth for %s: expected user:password", server)
+			}
+		}
+
+		// Servers may be written as URLs, e.g. https://index.docker.io/v1/
+		host := strings.TrimPrefix(strings.TrimPrefix(server, "https://"), "http://")
+		host = docker.ImageRegistry(host + "/")
+		secrets[host] = registry.AuthConfig{Username: username, Password: password, ServerAddress: host}
+	}
+	return secrets, nil
+}
+
+// registryAuth returns the credentials to pull an image with, nil for an anonymous pull
+func (run *pipelineRun) registryAuth(imageName string) *registry.AuthConfig {
+	if auth, ok := run.pullCredentials[docker.ImageRegistry(imageName)]; ok {
+		return &auth
+	}
+	return nil
+}
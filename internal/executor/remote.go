@@ -0,0 +1,205 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/registry"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/parser/pipeline"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+)
+
+// runnerLostTimeout is how long a claimed job may go without news from its runner before failing
+const runnerLostTimeout = 2 * time.Minute
+
+// remoteJob is a job waiting for or running on a runner agent
+type remoteJob struct {
+	payload    models.RunnerJob
+	runnerID   int // 0 until a runner claims the job
+	lastUpdate time.Time
+	done       chan int // receives the exit code reported by the runner
+}
+
+// remoteJobs holds the jobs handed to runner agents
+type remoteJobs struct {
+	mu      sync.Mutex
+	pending []*remoteJob
+	jobs    map[int]*remoteJob
+}
+
+// SetRemoteExecution makes jobs run on runner agents instead of the local Docker daemon
+func (e *PipelineExecutor) SetRemoteExecution(remote bool) {
+	e.remoteExecution = remote
+}
+
+// ClaimJob hands the oldest job waiting for a runner to the given runner, nil when there is none
+func (e *PipelineExecutor) ClaimJob(ctx context.Context, runnerID int) *models.RunnerJob {
+	e.remote.mu.Lock()
+	defer e.remote.mu.Unlock()
+
+	if len(e.remote.pending) == 0 {
+		return nil
+	}
+	job := e.remote.pending[0]
+	e.remote.pending = e.remote.pending[1:]
+	job.runnerID = runnerID
+	job.lastUpdate = time.Now()
+
+	if e.db != nil {
+		e.db.UpdateJobStatus(ctx, job.payload.JobID, "running", nil)
+	}
+	payload := job.payload
+	return &payload
+}
+
+// TouchJob records news from the runner of a job, returning false once the job is no longer running there
+// A false result tells the runner to stop the job, e.g. after a cancellation or a timeout.
+func (e *PipelineExecutor) TouchJob(jobID, runnerID int) bool {
+	e.remote.mu.Lock()
+	defer e.remote.mu.Unlock()
+
+	job, ok := e.remote.jobs[jobID]
+	if !ok || job.runnerID != runnerID {
+		return false
+	}
+	job.lastUpdate = time.Now()
+	return true
+}
+
+// CompleteJob reports the exit code of a job run by a runner, returning false if the job is no longer running there
+func (e *PipelineExecutor) CompleteJob(jobID, runnerID, exitCode int) bool {
+	e.remote.mu.Lock()
+	defer e.remote.mu.Unlock()
+
+	job, ok := e.remote.jobs[jobID]
+	if !ok || job.runnerID != runnerID {
+		return false
+	}
+	delete(e.remote.jobs, jobID)
+	job.done <- exitCode
+	return true
+}
+
+// runRemoteJob queues a job for the runner agents and waits for its outcome
+// Runners clone the repository themselves, so files written by previous jobs are not available.
+func (e *PipelineExecutor) runRemoteJob(ctx context.Context, run *pipelineRun, jobName string, jobID int, job pipeline.JobConfig, script []string, vars map[string]string) string {
+	// Records must land even once the pipeline is cancelled or the job timed out
+	dbCtx := context.WithoutCancel(ctx)
+	fail := func(message string) string {
+		logger.Error(fmt.Sprintf("Job %s: %s", jobName, message))
+		e.db.CreateLogBatch(dbCtx, jobID, []string{"ERROR: " + message})
+		exitCode := 1
+		e.db.UpdateJobStatus(dbCtx, jobID, "failed", &exitCode)
+		return "failed"
+	}
+
+	if job.Privileged && !run.allowPrivileged {
+		return fail("Privileged mode is not allowed for this project")
+	}
+	if job.Network == pipeline.NetworkHost && !run.allowPrivileged {
+		return fail("The host network is not allowed for this project, it needs privileged jobs to be allowed")
+	}
+	if job.Cache != nil || job.Network == pipeline.NetworkPipeline || len(job.Services) > 0 || job.Dind {
+		e.db.CreateLogBatch(dbCtx, jobID, []string{"WARNING: cache, pipeline network, services and dind are not supported on runners and are ignored"})
+	}
+
+	payload := models.RunnerJob{
+		JobID:       jobID,
+		PipelineID:  run.pipelineID,
+		Name:        jobName,
+		Image:       job.Image,
+		Script:      script,
+		Env:         envList(vars),
+		RepoURL:     run.params.RepoURL,
+		AccessToken: run.params.AccessToken,
+		DeployKey:   run.params.DeployKey,
+		Branch:      run.params.Branch,
+		CommitHash:  run.params.CommitHash,
+		Privileged:  job.Privileged,
+		WorkingDir:  job.WorkingDir("/workspace"),
+		Entrypoint:  job.Entrypoint,
+	}
+	if job.Network != pipeline.NetworkPipeline {
+		payload.Network = job.Network
+	}
+	if auth := run.registryAuth(job.Image); auth != nil {
+		if encoded, err := registry.EncodeAuthConfig(*auth); err == nil {
+			payload.RegistryAuth = encoded
+		}
+	}
+
+	remote := &remoteJob{payload: payload, done: make(chan int, 1)}
+	e.remote.mu.Lock()
+	e.remote.pending = append(e.remote.pending, remote)
+	e.remote.jobs[jobID] = remote
+	e.remote.mu.Unlock()
+	defer e.removeRemoteJob(jobID)
+	logger.Info(fmt.Sprintf("Job %s waiting for a runner", jobName))
+
+	jobCtx, cancelJob := ctx, context.CancelFunc(func() {})
+	timeout, _ := job.TimeoutDuration()
+	if timeout > 0 {
+		jobCtx, cancelJob = context.WithTimeout(ctx, timeout)
+	}
+	defer cancelJob()
+
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case exitCode := <-remote.done:
+			if exitCode != 0 {
+				logger.Error(fmt.Sprintf("Job %s failed with exit code %d", jobName, exitCode))
+				e.db.UpdateJobStatus(dbCtx, jobID, "failed", &exitCode)
+				return "failed"
+			}
+			if err := e.finishJob(dbCtx, run, jobName, jobID, job, vars, false); err != nil {
+				exitCode = 1
+				e.db.UpdateJobStatus(dbCtx, jobID, "failed", &exitCode)
+				return "failed"
+			}
+			e.db.UpdateJobStatus(dbCtx, jobID, "success", &exitCode)
+			logger.Info(fmt.Sprintf("Job %s completed successfully", jobName))
+			return "success"
+		case <-jobCtx.Done():
+			if ctx.Err() != nil {
+				logger.Info(fmt.Sprintf("Job %s cancelled", jobName))
+				e.db.UpdateJobStatus(dbCtx, jobID, "cancelled", nil)
+				return "cancelled"
+			}
+			return fail(fmt.Sprintf("Job timed out after %s", timeout))
+		case <-ticker.C:
+			if e.runnerLost(jobID) {
+				return fail("The runner stopped reporting, job abandoned")
+			}
+		}
+	}
+}
+
+// runnerLost reports whether the runner of a claimed job has been silent for too long
+func (e *PipelineExecutor) runnerLost(jobID int) bool {
+	e.remote.mu.Lock()
+	defer e.remote.mu.Unlock()
+
+	job, ok := e.remote.jobs[jobID]
+	return ok && job.runnerID != 0 && time.Since(job.lastUpdate) > runnerLostTimeout
+}
+
+// removeRemoteJob forgets a job, whether it was claimed or is still waiting for a runner
+func (e *PipelineExecutor) removeRemoteJob(jobID int) {
+	e.remote.mu.Lock()
+	defer e.remote.mu.Unlock()
+
+	delete(e.remote.jobs, jobID)
+	for i, job := range e.remote.pending {
+		if job.payload.JobID == jobID {
+			e.remote.pending = append(e.remote.pending[:i], e.remote.pending[i+1:]...)
+			break
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+)
+
+// RolloutError reports a deployment to several hosts stopped at a failing batch
+// Hosts lists the hosts which may run the new version, the ones a rollback must restore.
+type RolloutError struct {
+	Hosts []string
+	Err   error
+}
+
+func (e *RolloutError) Error() string { return e.Err.Error() }
+
+func (e *RolloutError) Unwrap() error { return e.Err }
+
+// rolloutBatches splits the hosts of a deployment in batches of size hosts, the SSH host of the project first
+func rolloutBatches(project *models.Project, params models.PipelineRunParams) [][]string {
+	hosts := append([]string{project.SSHHost}, params.SSHHosts...)
+	size := max(params.RolloutBatchSize, 1)
+	var batches [][]string
+	for len(hosts) > 0 {
+		n := min(size, len(hosts))
+		batches = append(batches, hosts[:n])
+		hosts = hosts[n:]
+	}
+	return batches
+}
+
+// rollout deploys to the hosts of an environment batch by batch, the hosts of a batch at once
+// The deploy script fails on unhealthy containers, the rollout stops at the first batch with a failed host.
+func (e *DeploymentExecutor) rollout(ctx context.Context, project *models.Project, params models.PipelineRunParams, workspaceDir, overrideFilename string, overrideContent []byte, dLogger *DeploymentLogger) error {
+	if len(params.SSHHosts) == 0 {
+		return e.deployHost(ctx, project, params, workspaceDir, overrideFilename, overrideContent, dLogger)
+	}
+
+	batches := rolloutBatches(project, params)
+	var updated []string
+	for i, batch := range batches {
+		dLogger.Log(fmt.Sprintf("=== ROLLOUT BATCH %d/%d: %s ===", i+1, len(batches), strings.Join(batch, ", ")))
+
+		errs := make([]error, len(batch))
+		var wg sync.WaitGroup
+		for j, host := range batch {
+			hostProject := *project
+			hostProject.SSHHost = host
+			hostLogger := dLogger.withPrefix("[" + host + "] ")
+			wg.Go(func() {
+				errs[j] = e.deployHost(ctx, &hostProject, params, workspaceDir, overrideFilename, overrideContent, hostLogger)
+			})
+		}
+		wg.Wait()
+
+		var failed error
+		for j, host := range batch {
+			// An aborted canary leaves the stable version running
+			if !errors.Is(errs[j], ErrCanaryAborted) {
+				updated = append(updated, host)
+			}
+			if errs[j] != nil && failed == nil {
+				failed = fmt.Errorf("deployment to %s failed: %w", host, errs[j])
+			}
+		}
+		if failed != nil {
+			dLogger.Log(fmt.Sprintf("Rollout stopped: %v", failed))
+			return &RolloutError{Hosts: updated, Err: failed}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/parser/compose"
+)
+
+// sbomContentType is the media type of CycloneDX JSON documents
+const sbomContentType = "application/vnd.cyclonedx+json"
+
+// recordSBOMs stores the SBOM of every image the deployment built as an artifact of the pipeline
+// services are the built compose services, empty for every buildable one. A failed SBOM is logged without failing the deployment,
+// and SBOM_GENERATION=false turns them off.
+func (e *DeploymentExecutor) recordSBOMs(ctx context.Context, project *models.Project, params models.PipelineRunParams, workspaceDir string, services []string, dLogger *DeploymentLogger) {
+	if os.Getenv("SBOM_GENERATION") == "false" || e.db == nil || params.PipelineID == 0 {
+		return
+	}
+	if len(services) == 0 {
+		var err error
+		if services, err = compose.ParseServices(filepath.Join(workspaceDir, params.DeploymentFilename)); err != nil {
+			dLogger.Log(fmt.Sprintf("SBOM generation skipped: failed to parse compose services: %v", err))
+			return
+		}
+	}
+
+	namespace := compose.ImageNamespace(project.RegistryURL, project.RegistryUser)
+	for _, service := range services {
+		imageName := compose.ImageName(namespace, params.RepoName, service, params.CommitHash)
+		content, err := e.docker.GenerateSBOM(ctx, imageName)
+		if err != nil {
+			dLogger.Log(fmt.Sprintf("Failed to generate the SBOM of %s: %v", imageName, err))
+			continue
+		}
+		artifact := &models.Artifact{
+			PipelineID:  params.PipelineID,
+			Name:        fmt.Sprintf("sbom-%s.cdx.json", service),
+			Kind:        models.ArtifactKindSBOM,
+			ContentType: sbomContentType,
+		}
+		if err := e.db.CreateArtifact(context.WithoutCancel(ctx), artifact, content); err != nil {
+			dLogger.Log(fmt.Sprintf("Failed to store the SBOM of %s: %v", imageName, err))
+			continue
+		}
+		dLogger.Log(fmt.Sprintf("Stored the SBOM of %s (%d bytes)", imageName, artifact.Size))
+	}
+}
@@ -0,0 +1,24 @@
+package executor
+
+import "fmt"
+
+// Each script command runs in a log section, delimited by marker lines in the style of GitLab:
+//
+//	section_start:<unix time>:step_<n>
+//	$ <command>
+//	... output of the command ...
+//	section_end:<unix time>:step_<n>
+//
+// The UI collapses a section and shows its duration from the timestamps of its lines.
+// A failing command leaves its section open, the job ending there.
+
+// sectionStart prints the opening marker of step n followed by its command
+// The command is printed as written in the pipeline file so interpolated secrets stay out of the logs.
+func sectionStart(n int, command string) string {
+	return fmt.Sprintf(`printf 'section_start:%%s:step_%d\n$ %%s\n' "$(date +%%s)" %s`, n, shellQuote(command))
+}
+
+// sectionEnd prints the closing marker of step n
+func sectionEnd(n int) string {
+	return fmt.Sprintf(`printf 'section_end:%%s:step_%d\n' "$(date +%%s)"`, n)
+}
@@ -0,0 +1,205 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/parser/pipeline"
+)
+
+// trivyImage is the default image of security-scan jobs
+const trivyImage = "aquasec/trivy:latest"
+
+// scanReportDir is the workspace directory security-scan jobs write their Trivy reports to, one subdirectory per job
+const scanReportDir = ".cicd-scan"
+
+// JobTypeSecurityScan scans images and the repository with Trivy, the vulnerabilities found being recorded
+// Properties: image, or service for the image a build job pushed, path (a repository directory, . when no image is scanned),
+// severity_threshold failing the job on findings at least that severe and ignore_unfixed.
+const JobTypeSecurityScan = "security-scan"
+
+// Severities are the Trivy severity levels, from the least severe
+var Severities = []string{"UNKNOWN", "LOW", "MEDIUM", "HIGH", "CRITICAL"}
+
+// securityScanJobType runs the security-scan jobs, see JobTypeSecurityScan
+type securityScanJobType struct{}
+
+func init() {
+	RegisterJobType(securityScanJobType{})
+}
+
+func (securityScanJobType) Info() JobTypeInfo {
+	return JobTypeInfo{
+		Name:        JobTypeSecurityScan,
+		Description: "Scans an image and the repository with Trivy, the vulnerabilities found being recorded",
+		Image:       trivyImage,
+		Properties: []JobTypeProperty{
+			{Name: "image", Description: "Image scanned"},
+			{Name: "service", Description: "Compose service the deployment image of which is scanned, instead of image"},
+			{Name: "path", Description: "Repository directory scanned, . when no image is scanned"},
+			{Name: "severity_threshold", Description: "Fails the job on findings at least that severe: " + strings.Join(Severities[1:], ", ")},
+			{Name: "ignore_unfixed", Description: "true to ignore the vulnerabilities without fix"},
+		},
+	}
+}
+
+// Validate checks that a security-scan job scans an image or a service, not both, and its severity threshold
+func (securityScanJobType) Validate(name string, jobs map[string]pipeline.JobConfig) error {
+	props := jobs[name].Properties
+	if props["image"] != "" && props["service"] != "" {
+		return fmt.Errorf("un job security-scan prend image ou service, pas les deux")
+	}
+	if threshold := props["severity_threshold"]; threshold != "" && !slices.Contains(Severities, strings.ToUpper(threshold)) {
+		return fmt.Errorf("severity_threshold invalide %q (%s)", threshold, strings.Join(Severities[1:], ", "))
+	}
+	return nil
+}
+
+// Prepare turns a security-scan job into the Trivy image and script writing its JSON reports
+// The image defaults to the deployment image of the compose service named by the service property,
+// the repository is scanned at path, or at its root when no image is scanned.
+func (securityScanJobType) Prepare(j *JobRun) pipeline.JobConfig {
+	job, vars, jobName := j.Config, j.Vars, j.Name
+	props := job.Properties
+	ref := pipeline.Interpolate(props["image"], vars)
+	if ref == "" && props["service"] != "" {
+		ref = j.ServiceImage(props["service"])
+	}
+	fsPath := pipeline.Interpolate(props["path"], vars)
+	if fsPath == "" && ref == "" {
+		fsPath = "."
+	}
+
+	flags := "--quiet --format json"
+	if props["ignore_unfixed"] == "true" {
+		flags += " --ignore-unfixed"
+	}
+	reportDir := path.Join("/workspace", scanReportDir, jobName)
+	script := []string{"mkdir -p " + shellQuote(reportDir)}
+	if ref != "" {
+		// Trivy reads the registry credentials from its environment
+		if auth := j.RegistryAuth(ref); auth != nil {
+			vars["TRIVY_USERNAME"] = auth.Username
+			vars["TRIVY_PASSWORD"] = auth.Password
+		}
+		script = append(script, fmt.Sprintf("trivy image %s --output %s %s", flags, shellQuote(path.Join(reportDir, "image.json")), shellQuote(ref)))
+	}
+	if fsPath != "" {
+		script = append(script, fmt.Sprintf("trivy fs %s --skip-dirs %s --output %s %s", flags, shellQuote(path.Join("/workspace", scanReportDir)),
+			shellQuote(path.Join(reportDir, "fs.json")), shellQuote(path.Join("/workspace", fsPath))))
+	}
+
+	if job.Image == "" {
+		job.Image = trivyImage
+	}
+	// The Trivy image entrypoint is the tool itself, the job script runs in its shell instead
+	job.Entrypoint = []string{""}
+	job.BeforeScript = nil
+	job.Script = script
+	return job
+}
+
+// trivyReport is the part of a Trivy JSON report the findings are read from
+type trivyReport struct {
+	Results []struct {
+		Target          string
+		Vulnerabilities []struct {
+			VulnerabilityID  string
+			PkgName          string
+			InstalledVersion string
+			FixedVersion     string
+			Severity         string
+			Title            string
+		}
+	}
+}
+
+// readScanReports returns the findings of the reports a security-scan job wrote to the workspace
+func readScanReports(workspaceDir, jobName string) ([]models.Vulnerability, error) {
+	var vulns []models.Vulnerability
+	for _, name := range []string{"image.json", "fs.json"} {
+		content, err := os.ReadFile(filepath.Join(workspaceDir, scanReportDir, jobName, name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var report trivyReport
+		if err := json.Unmarshal(content, &report); err != nil {
+			return nil, fmt.Errorf("invalid Trivy report %s: %w", name, err)
+		}
+		for _, result := range report.Results {
+			for _, v := range result.Vulnerabilities {
+				vulns = append(vulns, models.Vulnerability{
+					Target:           result.Target,
+					VulnerabilityID:  v.VulnerabilityID,
+					PkgName:          v.PkgName,
+					InstalledVersion: v.InstalledVersion,
+					FixedVersion:     v.FixedVersion,
+					Severity:         strings.ToUpper(v.Severity),
+					Title:            v.Title,
+				})
+			}
+		}
+	}
+	return vulns, nil
+}
+
+// Finish stores the findings of a finished security-scan job and logs their count by severity
+// The returned error fails the job, when the reports cannot be read or findings reach the severity threshold.
+func (securityScanJobType) Finish(ctx context.Context, j *JobRun) error {
+	if !j.Local {
+		j.Log(ctx, "WARNING: the findings of security-scan jobs run by runners and SSH executors are not recorded")
+		return nil
+	}
+	vulns, err := readScanReports(j.WorkspaceDir(), j.Name)
+	if err != nil {
+		return fmt.Errorf("failed to read the scan reports: %w", err)
+	}
+
+	counts := make(map[string]int)
+	for _, v := range vulns {
+		counts[v.Severity]++
+	}
+	summary := fmt.Sprintf("Security scan found %d vulnerabilities", len(vulns))
+	var parts []string
+	for _, severity := range slices.Backward(Severities) {
+		if counts[severity] > 0 {
+			parts = append(parts, fmt.Sprintf("%s: %d", severity, counts[severity]))
+		}
+	}
+	if len(parts) > 0 {
+		summary += " (" + strings.Join(parts, ", ") + ")"
+	}
+	if db := j.Store(); db != nil {
+		if err := db.CreateVulnerabilities(ctx, j.ID, vulns); err != nil {
+			return fmt.Errorf("failed to store the vulnerabilities: %w", err)
+		}
+		j.Log(ctx, summary)
+	}
+
+	threshold := strings.ToUpper(j.Config.Properties["severity_threshold"])
+	if threshold == "" {
+		return nil
+	}
+	minimum := slices.Index(Severities, threshold)
+	above := 0
+	for _, v := range vulns {
+		if slices.Index(Severities, v.Severity) >= minimum {
+			above++
+		}
+	}
+	if above > 0 {
+		return fmt.Errorf("%d vulnerabilities at or above the %s severity threshold", above, threshold)
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package executor
+
+import (
+	"testing"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/parser/pipeline"
+)
+
+func TestSecurityScanValidate(t *testing.T) {
+	for name, tt := range map[string]struct {
+		props map[string]string
+		valid bool
+	}{
+		"repository":    {map[string]string{}, true},
+		"threshold":     {map[string]string{"image": "alpine", "severity_threshold": "high"}, true},
+		"both":          {map[string]string{"image": "alpine", "service": "app"}, false},
+		"bad threshold": {map[string]string{"severity_threshold": "severe"}, false},
+	} {
+		jobs := map[string]pipeline.JobConfig{"scan": {Type: JobTypeSecurityScan, Properties: tt.props}}
+		if err := (securityScanJobType{}).Validate("scan", jobs); (err == nil) != tt.valid {
+			t.Errorf("Expected %s to be valid: %v, got %v", name, tt.valid, err)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"maps"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/parser/pipeline"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+)
+
+// startServices starts the services of a job on the pipeline network, returned with the function removing them
+// Services get the job variables and their own, and are started in order, a failure removing the ones already started.
+func (e *PipelineExecutor) startServices(ctx context.Context, run *pipelineRun, jobName string, job pipeline.JobConfig, vars map[string]string) (func(), error) {
+	var containerIDs []string
+	stop := func() {
+		for _, containerID := range containerIDs {
+			if err := e.docker.RemoveContainer(containerID); err != nil {
+				logger.Warn(fmt.Sprintf("Failed to remove service container of job %s: %v", jobName, err))
+			}
+		}
+	}
+	if len(job.Services) == 0 {
+		return stop, nil
+	}
+
+	network, err := e.jobNetwork(ctx, run, pipeline.NetworkPipeline)
+	if err != nil {
+		return nil, err
+	}
+	for _, service := range job.Services {
+		image := pipeline.Interpolate(service.Image, vars)
+		if err := e.docker.PullImageWithAuth(ctx, image, run.registryAuth(image)); err != nil {
+			stop()
+			return nil, fmt.Errorf("failed to pull service %s: %w", image, err)
+		}
+		env := maps.Clone(vars)
+		for k, v := range service.Variables {
+			env[k] = pipeline.Interpolate(v, vars)
+		}
+		containerID, err := e.docker.StartService(ctx, image, network, []string{service.Hostname()}, service.Command, envList(env))
+		if err != nil {
+			stop()
+			return nil, fmt.Errorf("service %s: %w", service.Hostname(), err)
+		}
+		containerIDs = append(containerIDs, containerID)
+		logger.Info(fmt.Sprintf("Job %s service %s started from %s", jobName, service.Hostname(), image))
+	}
+	return stop, nil
+}
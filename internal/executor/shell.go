@@ -0,0 +1,101 @@
+package executor
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/parser/pipeline"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+)
+
+// shellStopDelay is how long the output of a killed shell job is still read before its pipes are closed
+const shellStopDelay = 10 * time.Second
+
+// SetShellExecution allows projects to run their jobs with the shell executor
+// wrapper prefixes the job shell, e.g. unshare --user --map-root-user or chroot /srv/jail, nil to run it as is.
+func (e *PipelineExecutor) SetShellExecution(allow bool, wrapper []string) {
+	e.allowShell = allow
+	e.shellWrapper = wrapper
+}
+
+// shellEnv returns the environment of a shell job, the host one only contributing its PATH
+// The engine environment holds its own secrets, which jobs must not see.
+func shellEnv(workspaceDir string, vars map[string]string) []string {
+	env := []string{
+		"PATH=" + cmp.Or(os.Getenv("PATH"), "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"),
+		"HOME=" + workspaceDir,
+		"CI_PROJECT_DIR=" + workspaceDir,
+	}
+	return append(env, envList(vars)...)
+}
+
+// runShellJob runs the script of a job on the engine host, in the workspace, with the logs and exit code of a container job
+// The image is ignored, and so are the cache, network, services, dind, privileged and entrypoint settings.
+func (e *PipelineExecutor) runShellJob(ctx context.Context, run *pipelineRun, jobName string, jobID int, job pipeline.JobConfig, script []string, vars map[string]string) string {
+	rec := e.recorder(ctx, jobName, jobID)
+	if !e.allowShell {
+		return rec.fail("The shell executor is not enabled on this instance")
+	}
+	if job.Type != "" && job.Type != pipeline.JobTypeShell {
+		return rec.fail(fmt.Sprintf("%s jobs need the docker executor", job.Type))
+	}
+	if job.Cache != nil || job.Network != "" || len(job.Services) > 0 || job.Dind || job.Privileged || job.Entrypoint != nil {
+		rec.log("WARNING: cache, network, services, dind, privileged and entrypoint are not supported by the shell executor and are ignored")
+	}
+
+	jobCtx, cancelJob := ctx, context.CancelFunc(func() {})
+	timeout, _ := job.TimeoutDuration()
+	if timeout > 0 {
+		jobCtx, cancelJob = context.WithTimeout(ctx, timeout)
+	}
+	defer cancelJob()
+
+	args := append(slices.Clone(e.shellWrapper), "sh", "-c", strings.Join(script, " && "))
+	cmd := exec.CommandContext(jobCtx, args[0], args[1:]...)
+	cmd.Dir = job.WorkingDir(run.workspaceDir)
+	cmd.Env = shellEnv(run.workspaceDir, vars)
+	// The script runs in its own process group, killed as a whole when the job is stopped
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		logger.Info(fmt.Sprintf("Stopping shell job %s", jobName))
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = shellStopDelay
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return rec.fail("Failed to start the job: " + err.Error())
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return rec.fail("Failed to start the job: " + err.Error())
+	}
+	if err := cmd.Start(); err != nil {
+		return rec.fail("Failed to start the job: " + err.Error())
+	}
+
+	e.storeLogs(jobCtx, outputLines(stdout, stderr), jobName, jobID)
+	err = cmd.Wait()
+	timedOut := jobCtx.Err() == context.DeadlineExceeded
+
+	exitCode := 0
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		exitCode = exitErr.ExitCode()
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			// Shells report a process killed by a signal as 128 + the signal
+			exitCode = 128 + int(status.Signal())
+		}
+	} else if err != nil {
+		logger.Error(fmt.Sprintf("Error waiting for shell job %s: %v", jobName, err))
+		exitCode = 1
+	}
+	return rec.result(ctx, timedOut, timeout, exitCode)
+}
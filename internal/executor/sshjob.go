@@ -0,0 +1,181 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/docker"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/parser/pipeline"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/ssh"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+)
+
+// sshJobRoot is the directory of the SSH machines the workspaces of their jobs are uploaded to
+const sshJobRoot = "/tmp/cicd-jobs"
+
+// envName matches the variable names a shell can export
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ParseSSHExecutors parses the machines jobs may run on over SSH, a comma-separated list of name=user@host[:port]
+// Every machine authenticates the engine with privateKey.
+func ParseSSHExecutors(spec, privateKey string) (map[string]ssh.Endpoint, error) {
+	executors := make(map[string]ssh.Endpoint)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, target, _ := strings.Cut(entry, "=")
+		user, host, ok := strings.Cut(target, "@")
+		if name == "" || !ok || user == "" || host == "" {
+			return nil, fmt.Errorf("invalid SSH executor %q, expected name=user@host[:port]", entry)
+		}
+		executors[name] = ssh.Endpoint{Host: host, User: user, PrivateKey: privateKey}
+	}
+	if len(executors) > 0 && privateKey == "" {
+		return nil, fmt.Errorf("SSH executors need a private key")
+	}
+	return executors, nil
+}
+
+// SetSSHExecutors sets the machines jobs with an ssh field run on, by name
+func (e *PipelineExecutor) SetSSHExecutors(executors map[string]ssh.Endpoint) {
+	e.sshExecutors = executors
+}
+
+// runSSHJob runs a job in a container of its image on the Docker engine of an SSH machine
+// The workspace is uploaded to the machine and removed afterwards, what the job writes there is not brought back.
+func (e *PipelineExecutor) runSSHJob(ctx context.Context, run *pipelineRun, jobName string, jobID int, job pipeline.JobConfig, script []string, vars map[string]string) string {
+	rec := e.recorder(ctx, jobName, jobID)
+	endpoint, ok := e.sshExecutors[job.SSH]
+	if !ok {
+		return rec.fail(fmt.Sprintf("Unknown SSH executor %s", job.SSH))
+	}
+	if job.Privileged && !run.allowPrivileged {
+		return rec.fail("Privileged mode is not allowed for this project")
+	}
+	if job.Network == pipeline.NetworkHost && !run.allowPrivileged {
+		return rec.fail("The host network is not allowed for this project, it needs privileged jobs to be allowed")
+	}
+	// The Docker socket of the machine gives root on it, as privileged mode does
+	if job.Dind && !run.allowPrivileged {
+		return rec.fail("dind mounts the Docker socket of SSH executors, which needs privileged jobs to be allowed for this project")
+	}
+	if job.Cache != nil || job.Network == pipeline.NetworkPipeline || len(job.Services) > 0 {
+		rec.log("WARNING: cache, pipeline network and services are not supported by SSH executors and are ignored")
+	}
+
+	client, err := ssh.Connect(endpoint, nil)
+	if err != nil {
+		return rec.fail(fmt.Sprintf("Failed to connect to SSH executor %s: %v", job.SSH, err))
+	}
+	defer client.Close()
+
+	name := fmt.Sprintf("cicd-job-%d-%s", run.pipelineID, unsafeCacheKeyChars.ReplaceAllString(jobName, "_"))
+	dir := path.Join(sshJobRoot, name)
+	defer func() {
+		if _, err := client.RunCommand(fmt.Sprintf("docker rm -f %s >/dev/null 2>&1; rm -rf %s %s", name, shellQuote(dir), shellQuote(dir+".sh"))); err != nil {
+			logger.Warn(fmt.Sprintf("Failed to clean up job %s on SSH executor %s: %v", jobName, job.SSH, err))
+		}
+	}()
+
+	logger.Info(fmt.Sprintf("Uploading the workspace of job %s to SSH executor %s", jobName, job.SSH))
+	if err := client.UploadDir(run.workspaceDir, dir); err != nil {
+		return rec.fail(fmt.Sprintf("Failed to upload the workspace to SSH executor %s: %v", job.SSH, err))
+	}
+	if err := client.WriteFile(dir+".sh", strings.NewReader(sshJobScript(name, dir, job, script, vars)), 0700); err != nil {
+		return rec.fail(fmt.Sprintf("Failed to upload the job script to SSH executor %s: %v", job.SSH, err))
+	}
+
+	jobCtx, cancelJob := ctx, context.CancelFunc(func() {})
+	timeout, _ := job.TimeoutDuration()
+	if timeout > 0 {
+		jobCtx, cancelJob = context.WithTimeout(ctx, timeout)
+	}
+	defer cancelJob()
+
+	// Removing the container ends the session running it
+	finished := make(chan struct{})
+	defer close(finished)
+	go func() {
+		select {
+		case <-jobCtx.Done():
+			logger.Info(fmt.Sprintf("Stopping job %s on SSH executor %s", jobName, job.SSH))
+			client.RunCommand("docker rm -f " + name)
+		case <-finished:
+		}
+	}()
+
+	stdoutR, stdoutW := io.Pipe()
+	stderrR, stderrW := io.Pipe()
+	type execResult struct {
+		code int
+		err  error
+	}
+	done := make(chan execResult, 1)
+	go func() {
+		code, err := client.Exec("sh "+shellQuote(dir+".sh"), stdoutW, stderrW)
+		stdoutW.Close()
+		stderrW.Close()
+		done <- execResult{code, err}
+	}()
+	e.storeLogs(jobCtx, outputLines(stdoutR, stderrR), jobName, jobID)
+	result := <-done
+	timedOut := jobCtx.Err() == context.DeadlineExceeded
+	if result.err != nil && jobCtx.Err() == nil {
+		return rec.fail(fmt.Sprintf("Lost SSH executor %s: %v", job.SSH, result.err))
+	}
+	if ctx.Err() == nil && !timedOut && result.code == 0 {
+		if err := e.finishJob(context.WithoutCancel(ctx), run, jobName, jobID, job, vars, false); err != nil {
+			return rec.finish("failed", 1)
+		}
+	}
+	return rec.result(ctx, timedOut, timeout, result.code)
+}
+
+// sshJobScript returns the shell script running a job container on an SSH machine
+// The variables are exported by the script and passed by name, so their values appear on no command line.
+func sshJobScript(name, dir string, job pipeline.JobConfig, script []string, vars map[string]string) string {
+	var keys []string
+	for key := range vars {
+		if envName.MatchString(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, key := range keys {
+		fmt.Fprintf(&b, "export %s=%s\n", key, shellQuote(vars[key]))
+	}
+	args := []string{"docker", "run", "--rm", "--name", name, "--label", docker.LabelJob + "=true",
+		"-v", shellQuote(dir + ":/workspace"), "-w", shellQuote(job.WorkingDir("/workspace"))}
+	for _, key := range keys {
+		args = append(args, "-e", key)
+	}
+	// docker run takes the first word of the entrypoint, the others go before the command
+	if len(job.Entrypoint) > 0 {
+		args = append(args, "--entrypoint", shellQuote(job.Entrypoint[0]))
+	}
+	if job.Privileged {
+		args = append(args, "--privileged")
+	}
+	if job.Network != "" && job.Network != pipeline.NetworkPipeline {
+		args = append(args, "--network", job.Network)
+	}
+	if job.Dind {
+		args = append(args, "-v", docker.DockerSocketPath+":"+docker.DockerSocketPath)
+	}
+	args = append(args, shellQuote(job.Image))
+	for _, word := range job.Entrypoint[min(1, len(job.Entrypoint)):] {
+		args = append(args, shellQuote(word))
+	}
+	args = append(args, "sh", "-c", shellQuote(strings.Join(script, " && ")))
+	fmt.Fprintf(&b, "exec %s\n", strings.Join(args, " "))
+	return b.String()
+}
@@ -0,0 +1,95 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/docker"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/ssh"
+)
+
+// Teardown removes a deployment from the hosts it runs on, the containers and networks of its compose project
+// The volumes are only removed for previews (params.ComposeProject set): those of an environment hold its data, kept for its
+// next deployment. Every host is torn down even when one fails. The messages are the deployment logs of params.PipelineID,
+// only logged when it is 0.
+func (e *DeploymentExecutor) Teardown(ctx context.Context, project *models.Project, params models.PipelineRunParams) (string, error) {
+	dLogger := e.newDeploymentLogger(params.PipelineID)
+	projectName := composeProjectName(params)
+	// An empty name would tear down the compose project of the working directory and remove all of deploy/
+	if projectName == "" {
+		err := fmt.Errorf("no compose project to tear down, the project name has no letter or digit")
+		dLogger.Log(err.Error())
+		return dLogger.String(), err
+	}
+	volumes := params.ComposeProject != ""
+	dLogger.Log(fmt.Sprintf("=== TEARDOWN OF %s ===", projectName))
+
+	// Only the playbook knows what it deployed, and no repository is cloned to run it
+	if project != nil && project.DeploymentMethod == models.DeploymentMethodAnsible {
+		dLogger.Log("The ansible deployment method does not tear deployments down, the hosts are left untouched")
+		return dLogger.String(), nil
+	}
+
+	// Same condition as Execute, the other deployments run on this machine
+	if project == nil || project.RegistryUser == "" || project.SSHHost == "" {
+		logs, err := e.docker.ComposeDown(ctx, projectName, volumes)
+		dLogger.LogBlock("COMPOSE LOGS", logs)
+		if err != nil {
+			dLogger.Log(err.Error())
+		}
+		return dLogger.String(), err
+	}
+
+	var errs []error
+	for _, host := range append([]string{project.SSHHost}, params.SSHHosts...) {
+		hostProject := *project
+		hostProject.SSHHost = host
+		hostLogger := dLogger
+		if len(params.SSHHosts) > 0 {
+			hostLogger = dLogger.withPrefix("[" + host + "] ")
+		}
+		if err := e.teardownHost(ctx, &hostProject, projectName, volumes, hostLogger); err != nil {
+			hostLogger.Log(err.Error())
+			errs = append(errs, fmt.Errorf("teardown of %s failed: %w", host, err))
+		}
+	}
+	return dLogger.String(), errors.Join(errs...)
+}
+
+// teardownHost stops a compose project on the SSH host of the project, with its deployment method
+// The script method also removes the directory the deployment files were copied to.
+func (e *DeploymentExecutor) teardownHost(ctx context.Context, project *models.Project, projectName string, volumes bool, dLogger *DeploymentLogger) error {
+	target, bastion := SSHEndpoints(project)
+	client, err := ssh.Connect(target, bastion)
+	if err != nil {
+		return fmt.Errorf("ssh connection failed: %w", err)
+	}
+	defer client.Close()
+
+	if project.DeploymentMethod == models.DeploymentMethodContext {
+		addr, tunnel, err := client.ForwardUnix(docker.DockerSocketPath)
+		if err != nil {
+			return err
+		}
+		defer tunnel.Close()
+
+		engine, err := docker.NewRemoteExecutor("tcp://" + addr)
+		if err != nil {
+			return fmt.Errorf("failed to create docker client: %w", err)
+		}
+		defer engine.Close()
+		logs, err := engine.ComposeDown(ctx, projectName, volumes)
+		dLogger.LogBlock("COMPOSE LOGS", logs)
+		return err
+	}
+
+	down := "down --remove-orphans"
+	if volumes {
+		down += " --volumes"
+	}
+	cmd := fmt.Sprintf("export PATH=$PATH:/usr/local/bin:/usr/bin && docker compose -p %s %s && rm -rf deploy/%s",
+		projectName, down, projectName)
+	return client.RunCommandStream(cmd, dLogger.Log)
+}
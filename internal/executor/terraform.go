@@ -0,0 +1,212 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/parser/pipeline"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+)
+
+// JobTypeTerraform runs terraform init then plan or apply in a root module of the repository
+// Properties: action (plan or apply), dir, plan (the plan job an apply job applies the saved plan of),
+// backend.<key> passed to init as backend configuration, var.<name> as input variables, and auto_approve.
+// Apply jobs wait for their plan job and are manual unless auto_approve is true or they set when.
+const JobTypeTerraform = "terraform"
+
+// Actions of terraform jobs
+const (
+	TerraformPlan  = "plan"
+	TerraformApply = "apply"
+)
+
+// terraformImage is the default image of terraform jobs
+const terraformImage = "hashicorp/terraform:latest"
+
+// terraformPlanDir is the workspace directory plan jobs save their plan to, one subdirectory per plan job
+const terraformPlanDir = ".cicd-terraform"
+
+// terraformBackendVariable holds the backend configuration of a terraform job, written to a file by its script
+const terraformBackendVariable = "CICD_TF_BACKEND"
+
+// terraformName matches the names of the input variables and backend settings of terraform jobs
+var terraformName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// terraformJobType runs the terraform jobs, see JobTypeTerraform
+type terraformJobType struct{}
+
+func init() {
+	RegisterJobType(terraformJobType{})
+}
+
+func (terraformJobType) Info() JobTypeInfo {
+	return JobTypeInfo{
+		Name:        JobTypeTerraform,
+		Description: "Runs terraform init then plan or apply in a root module of the repository, plans being stored as artifacts",
+		Image:       terraformImage,
+		Properties: []JobTypeProperty{
+			{Name: "action", Description: "plan (default) or apply"},
+			{Name: "dir", Description: "Root module, a repository directory"},
+			{Name: "plan", Description: "Plan job an apply job applies the saved plan of, required by apply jobs"},
+			{Name: "backend.<key>", Description: "Backend configuration passed to init"},
+			{Name: "var.<name>", Description: "Input variable"},
+			{Name: "auto_approve", Description: "true to run an apply job without manual approval"},
+		},
+	}
+}
+
+// Validate checks the properties of a terraform job and makes an apply job wait for its plan job,
+// manually unless it is auto-approved
+func (terraformJobType) Validate(name string, jobs map[string]pipeline.JobConfig) error {
+	job := jobs[name]
+	fail := func(format string, args ...interface{}) error {
+		return &pipeline.ParseError{Job: name, Field: "properties", Message: fmt.Sprintf(format, args...)}
+	}
+	props := job.Properties
+	if dir := props["dir"]; dir != "" && !filepath.IsLocal(dir) {
+		return fail("dir invalide %q : doit être un chemin relatif du dépôt", dir)
+	}
+	for key := range props {
+		if name, ok := strings.CutPrefix(key, "var."); ok && !terraformName.MatchString(name) {
+			return fail("nom de variable terraform invalide %q", name)
+		}
+		if name, ok := strings.CutPrefix(key, "backend."); ok && !terraformName.MatchString(name) {
+			return fail("clé de backend terraform invalide %q", name)
+		}
+	}
+	switch props["action"] {
+	case "", TerraformPlan:
+		if props["plan"] != "" {
+			return fail("plan ne s'utilise qu'avec action: apply")
+		}
+		return nil
+	case TerraformApply:
+	default:
+		return fail("action invalide %q (plan ou apply)", props["action"])
+	}
+
+	planJob, ok := jobs[props["plan"]]
+	if props["plan"] == "" || !ok || planJob.Type != JobTypeTerraform || (planJob.Properties["action"] != "" && planJob.Properties["action"] != TerraformPlan) {
+		return fail("un job terraform apply nécessite plan, le nom d'un job terraform plan")
+	}
+	if filepath.Clean("./"+props["dir"]) != filepath.Clean("./"+planJob.Properties["dir"]) {
+		return fail("dir doit être celui du job plan %q", props["plan"])
+	}
+	if !slices.Contains(job.Needs, props["plan"]) {
+		job.Needs = append(slices.Clone(job.Needs), props["plan"])
+	}
+	if job.When == "" && props["auto_approve"] != "true" {
+		job.When = pipeline.WhenManual
+	}
+	jobs[name] = job
+	return nil
+}
+
+// Prepare turns a terraform job into the Terraform image and the script running init then plan or apply
+// Plan jobs save their plan and its text rendering under terraformPlanDir, apply jobs apply the saved plan of their plan job.
+// The backend configuration and the input variables go through the environment, so their values appear on no command line.
+func (terraformJobType) Prepare(j *JobRun) pipeline.JobConfig {
+	job, vars, jobName := j.Config, j.Vars, j.Name
+	props := job.Properties
+	planJob := jobName
+	if props["action"] == TerraformApply {
+		planJob = props["plan"]
+	}
+	chdir := "-chdir=" + shellQuote(path.Join("/workspace", pipeline.Interpolate(props["dir"], vars)))
+	planDir := path.Join("/workspace", terraformPlanDir, planJob)
+	planFile := shellQuote(path.Join(planDir, "plan.tfplan"))
+
+	var keys []string
+	for key := range props {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var backend strings.Builder
+	for _, key := range keys {
+		if name, ok := strings.CutPrefix(key, "backend."); ok {
+			fmt.Fprintf(&backend, "%s = %s\n", name, strconv.Quote(pipeline.Interpolate(props[key], vars)))
+		}
+		if name, ok := strings.CutPrefix(key, "var."); ok {
+			vars["TF_VAR_"+name] = pipeline.Interpolate(props[key], vars)
+		}
+	}
+	vars["TF_IN_AUTOMATION"] = "true"
+	vars["TF_INPUT"] = "false"
+
+	var script []string
+	initCommand := "terraform " + chdir + " init -input=false"
+	if backend.Len() > 0 {
+		vars[terraformBackendVariable] = backend.String()
+		script = append(script, fmt.Sprintf(`printf '%%s' "$%s" > /tmp/cicd-backend.tfbackend`, terraformBackendVariable))
+		initCommand += " -backend-config=/tmp/cicd-backend.tfbackend"
+	}
+	script = append(script, initCommand)
+	if props["action"] == TerraformApply {
+		script = append(script,
+			fmt.Sprintf("test -f %s || { echo %s; exit 1; }", planFile, shellQuote("No saved plan, the plan job "+planJob+" must run in this workspace first")),
+			"terraform "+chdir+" apply -input=false "+planFile)
+	} else {
+		script = append(script,
+			"mkdir -p "+shellQuote(planDir),
+			"terraform "+chdir+" plan -input=false -out="+planFile,
+			"terraform "+chdir+" show -no-color "+planFile+" > "+shellQuote(path.Join(planDir, "plan.txt")))
+	}
+
+	if job.Image == "" {
+		job.Image = terraformImage
+	}
+	// The Terraform image entrypoint is the tool itself, the job script runs in its shell instead
+	job.Entrypoint = []string{""}
+	job.BeforeScript = nil
+	job.Script = script
+	return job
+}
+
+// Finish stores the plan a terraform plan job saved as an artifact of the pipeline and logs its summary
+// A plan that cannot be stored is logged without failing the job, the apply job reading it from the workspace.
+func (terraformJobType) Finish(ctx context.Context, j *JobRun) error {
+	db := j.Store()
+	if j.Config.Properties["action"] == TerraformApply || db == nil {
+		return nil
+	}
+	if !j.Local {
+		j.Log(ctx, "WARNING: the plans of terraform jobs run by runners and SSH executors are not stored as artifacts")
+		return nil
+	}
+	jobName := j.Name
+	content, err := os.ReadFile(filepath.Join(j.WorkspaceDir(), terraformPlanDir, jobName, "plan.txt"))
+	if err != nil {
+		j.Log(ctx, "WARNING: failed to read the Terraform plan: "+err.Error())
+		return nil
+	}
+
+	summary := "Terraform plan stored"
+	for _, line := range strings.Split(string(content), "\n") {
+		if strings.HasPrefix(line, "Plan:") || strings.HasPrefix(line, "No changes.") {
+			summary += ": " + strings.TrimSpace(line)
+			break
+		}
+	}
+	artifact := &models.Artifact{
+		PipelineID:  j.PipelineID(),
+		Name:        fmt.Sprintf("terraform-plan-%s.txt", jobName),
+		Kind:        models.ArtifactKindTerraformPlan,
+		ContentType: "text/plain; charset=utf-8",
+	}
+	if err := db.CreateArtifact(ctx, artifact, content); err != nil {
+		logger.Warn(fmt.Sprintf("Failed to store the Terraform plan of job %s: %v", jobName, err))
+		j.Log(ctx, "WARNING: failed to store the Terraform plan: "+err.Error())
+		return nil
+	}
+	j.Log(ctx, summary)
+	return nil
+}
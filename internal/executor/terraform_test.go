@@ -0,0 +1,191 @@
+package executor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/parser/pipeline"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/store/memstore"
+)
+
+func TestTerraformPrepare(t *testing.T) {
+	t.Run("Plan", func(t *testing.T) {
+		vars := map[string]string{"BUCKET": "tf-state"}
+		job := terraformJobType{}.Prepare(&JobRun{
+			Name: "plan infra",
+			Config: pipeline.JobConfig{Type: JobTypeTerraform, Properties: map[string]string{
+				"dir":            "infra/it's prod",
+				"backend.bucket": "${BUCKET}",
+				"backend.key":    `state "main"`,
+				"var.region":     "eu-west-3",
+			}},
+			Vars: vars,
+		})
+
+		if job.Image != terraformImage || len(job.Entrypoint) != 1 || job.Entrypoint[0] != "" {
+			t.Errorf("Expected the Terraform image without its entrypoint, got %s %q", job.Image, job.Entrypoint)
+		}
+		if want := "bucket = \"tf-state\"\nkey = \"state \\\"main\\\"\"\n"; vars[terraformBackendVariable] != want {
+			t.Errorf("Expected the backend file %q, got %q", want, vars[terraformBackendVariable])
+		}
+		if vars["TF_VAR_region"] != "eu-west-3" {
+			t.Errorf("Expected TF_VAR_region, got %q", vars["TF_VAR_region"])
+		}
+
+		script := strings.Join(job.Script, "\n")
+		if strings.Contains(script, "tf-state") || strings.Contains(script, "eu-west-3") {
+			t.Errorf("Expected no backend or variable value on the command line, got %q", script)
+		}
+		chdir := `-chdir='/workspace/infra/it'\''s prod'`
+		planFile := `'/workspace/.cicd-terraform/plan infra/plan.tfplan'`
+		for _, want := range []string{
+			`printf '%s' "$CICD_TF_BACKEND" > /tmp/cicd-backend.tfbackend`,
+			"terraform " + chdir + " init -input=false -backend-config=/tmp/cicd-backend.tfbackend",
+			"terraform " + chdir + " plan -input=false -out=" + planFile,
+			"terraform " + chdir + " show -no-color " + planFile + ` > '/workspace/.cicd-terraform/plan infra/plan.txt'`,
+		} {
+			if !strings.Contains(script, want) {
+				t.Errorf("Expected the script to contain %q, got %q", want, script)
+			}
+		}
+	})
+
+	t.Run("NoBackend", func(t *testing.T) {
+		vars := map[string]string{}
+		job := terraformJobType{}.Prepare(&JobRun{Name: "plan", Config: pipeline.JobConfig{Properties: map[string]string{}}, Vars: vars})
+		if _, ok := vars[terraformBackendVariable]; ok {
+			t.Errorf("Expected no backend file without backend properties")
+		}
+		if job.Script[0] != "terraform -chdir='/workspace' init -input=false" {
+			t.Errorf("Expected a plain init, got %q", job.Script[0])
+		}
+	})
+
+	t.Run("ApplyRefusesMissingPlan", func(t *testing.T) {
+		job := terraformJobType{}.Prepare(&JobRun{
+			Name:   "apply",
+			Config: pipeline.JobConfig{Properties: map[string]string{"action": TerraformApply, "plan": "plan"}},
+			Vars:   map[string]string{},
+		})
+		planFile := "'/workspace/.cicd-terraform/plan/plan.tfplan'"
+		want := []string{
+			"terraform -chdir='/workspace' init -input=false",
+			"test -f " + planFile + " || { echo 'No saved plan, the plan job plan must run in this workspace first'; exit 1; }",
+			"terraform -chdir='/workspace' apply -input=false " + planFile,
+		}
+		if strings.Join(job.Script, "\n") != strings.Join(want, "\n") {
+			t.Errorf("Expected the script %q, got %q", want, job.Script)
+		}
+	})
+}
+
+func TestTerraformJobs(t *testing.T) {
+	t.Run("ApplyWaitsForPlan", func(t *testing.T) {
+		jobs := map[string]pipeline.JobConfig{
+			"plan":  {Stage: "plan", Type: JobTypeTerraform, Properties: map[string]string{"dir": "infra", "backend.bucket": "state", "var.region": "eu-west-3"}},
+			"apply": {Stage: "apply", Type: JobTypeTerraform, Properties: map[string]string{"action": TerraformApply, "plan": "plan", "dir": "infra/"}},
+			"auto":  {Stage: "apply", Type: JobTypeTerraform, Properties: map[string]string{"action": TerraformApply, "plan": "plan", "dir": "infra", "auto_approve": "true"}},
+		}
+		for _, name := range []string{"plan", "apply", "auto"} {
+			if err := (terraformJobType{}).Validate(name, jobs); err != nil {
+				t.Fatalf("Expected no error for %s, got %v", name, err)
+			}
+		}
+		if apply := jobs["apply"]; apply.When != pipeline.WhenManual || len(apply.Needs) != 1 || apply.Needs[0] != "plan" {
+			t.Errorf("Expected the apply job to be manual and need the plan job, got %q %v", apply.When, apply.Needs)
+		}
+		if auto := jobs["auto"]; auto.When != "" {
+			t.Errorf("Expected the auto-approved apply job to run on success, got %q", auto.When)
+		}
+		if plan := jobs["plan"]; plan.When != "" || len(plan.Needs) != 0 {
+			t.Errorf("Expected the plan job to be unchanged, got %q %v", plan.When, plan.Needs)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		plan := pipeline.JobConfig{Type: JobTypeTerraform}
+		for name, props := range map[string]map[string]string{
+			"action":      {"action": "destroy"},
+			"no plan":     {"action": TerraformApply},
+			"unknown":     {"action": TerraformApply, "plan": "missing"},
+			"other dir":   {"action": TerraformApply, "plan": "plan", "dir": "other"},
+			"outside":     {"dir": "../infra"},
+			"variable":    {"var.my var": "x"},
+			"plan option": {"plan": "plan"},
+		} {
+			jobs := map[string]pipeline.JobConfig{"plan": plan, "job": {Type: JobTypeTerraform, Properties: props}}
+			if err := (terraformJobType{}).Validate("job", jobs); err == nil {
+				t.Errorf("Expected error for %s, got nil", name)
+			}
+		}
+	})
+}
+
+func TestTerraformFinish(t *testing.T) {
+	ctx := context.Background()
+	st := memstore.New()
+	project, _ := st.CreateProject(ctx, &models.NewProject{Name: "infra", RepoURL: "https://example.com/infra.git"})
+	p, _ := st.CreatePipeline(ctx, project.ID, "main", "abc123")
+
+	workspaceDir := t.TempDir()
+	planDir := filepath.Join(workspaceDir, terraformPlanDir, "plan")
+	os.MkdirAll(planDir, 0755)
+	plan := "Terraform will perform the following actions:\n\nPlan: 2 to add, 0 to change, 0 to destroy.\n"
+	if err := os.WriteFile(filepath.Join(planDir, "plan.txt"), []byte(plan), 0644); err != nil {
+		t.Fatalf("Expected no error writing the plan, got %v", err)
+	}
+
+	finish := func(action string, local bool) []models.LogLine {
+		t.Helper()
+		job, _ := st.CreateJob(ctx, p.ID, "plan", "infra", terraformImage)
+		j := &JobRun{
+			Name:   "plan",
+			ID:     job.ID,
+			Config: pipeline.JobConfig{Properties: map[string]string{"action": action}},
+			Local:  local,
+			run:    &pipelineRun{workspaceDir: workspaceDir, pipelineID: p.ID},
+			db:     st,
+		}
+		if err := (terraformJobType{}).Finish(ctx, j); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		logs, _ := st.GetLogsByJob(ctx, job.ID)
+		return logs
+	}
+
+	t.Run("StoresPlan", func(t *testing.T) {
+		logs := finish(TerraformPlan, true)
+		artifacts, _ := st.GetArtifactsByPipeline(ctx, p.ID)
+		if len(artifacts) != 1 || artifacts[0].Name != "terraform-plan-plan.txt" || artifacts[0].Kind != models.ArtifactKindTerraformPlan {
+			t.Fatalf("Expected the plan stored as an artifact, got %+v", artifacts)
+		}
+		_, content, _ := st.GetArtifactContent(ctx, p.ID, artifacts[0].ID)
+		if string(content) != plan {
+			t.Errorf("Expected the plan content, got %q", content)
+		}
+		if len(logs) != 1 || logs[0].Content != "Terraform plan stored: Plan: 2 to add, 0 to change, 0 to destroy." {
+			t.Errorf("Expected the plan summary logged, got %+v", logs)
+		}
+	})
+
+	t.Run("ApplyStoresNothing", func(t *testing.T) {
+		finish(TerraformApply, true)
+		if artifacts, _ := st.GetArtifactsByPipeline(ctx, p.ID); len(artifacts) != 1 {
+			t.Errorf("Expected no artifact stored by an apply job, got %d artifacts", len(artifacts))
+		}
+	})
+
+	t.Run("RemoteJob", func(t *testing.T) {
+		logs := finish(TerraformPlan, false)
+		if artifacts, _ := st.GetArtifactsByPipeline(ctx, p.ID); len(artifacts) != 1 {
+			t.Errorf("Expected no artifact stored by a remote job, got %d artifacts", len(artifacts))
+		}
+		if len(logs) != 1 || !strings.HasPrefix(logs[0].Content, "WARNING: the plans of terraform jobs run by runners") {
+			t.Errorf("Expected a warning logged, got %+v", logs)
+		}
+	})
+}
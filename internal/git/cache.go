@@ -0,0 +1,100 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+)
+
+// Cache keeps a bare mirror of repositories on disk, which clones borrow their objects from
+// A nil *Cache caches nothing.
+type Cache struct {
+	dir string
+
+	mu sync.Mutex
+	// locks serializes the updates of each mirror, which clones read under the read lock
+	locks map[string]*sync.RWMutex
+}
+
+// NewCache creates a cache keeping its mirrors under dir
+func NewCache(dir string) *Cache {
+	return &Cache{dir: dir, locks: make(map[string]*sync.RWMutex)}
+}
+
+// lock returns the lock of the mirror of key
+func (c *Cache) lock(key string) *sync.RWMutex {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	l, ok := c.locks[key]
+	if !ok {
+		l = &sync.RWMutex{}
+		c.locks[key] = l
+	}
+	return l
+}
+
+// Update creates or fetches the mirror of key from the remote repository and returns its path
+// The mirror is not updated again before release is called, a clone referencing it must happen in between.
+// The remote URL and its credentials are not stored in the mirror.
+func (c *Cache) Update(key, repoURL string, auth Auth) (string, func(), error) {
+	if c == nil {
+		return "", func() {}, nil
+	}
+	l := c.lock(key)
+	l.Lock()
+	unlocked := false
+	defer func() {
+		if !unlocked {
+			l.Unlock()
+		}
+	}()
+
+	mirror := filepath.Join(c.dir, key+".git")
+	_, err := os.Stat(mirror)
+	created := os.IsNotExist(err)
+	if created {
+		cmd := exec.Command("git", "init", "--bare", "--quiet", mirror)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return "", nil, fmt.Errorf("git init failed: %s - %w", string(output), err)
+		}
+	}
+
+	repoURL, env, cleanup, err := remote(repoURL, auth)
+	if err != nil {
+		return "", nil, err
+	}
+	defer cleanup()
+	cmd := exec.Command("git", "--git-dir", mirror, "fetch", "--quiet", "--prune", "--force", repoURL,
+		"+refs/heads/*:refs/heads/*", "+refs/tags/*:refs/tags/*")
+	cmd.Env = env
+	if output, err := cmd.CombinedOutput(); err != nil {
+		// A half-written mirror is fetched from scratch next time
+		if created {
+			os.RemoveAll(mirror)
+		}
+		return "", nil, fmt.Errorf("git fetch failed: %s - %w", string(output), err)
+	}
+
+	// Downgrade to the read lock, so clones of the same repository run side by side
+	l.Unlock()
+	l.RLock()
+	unlocked = true
+	if _, err := os.Stat(mirror); err != nil {
+		l.RUnlock()
+		return "", nil, fmt.Errorf("mirror removed during update: %w", err)
+	}
+	return mirror, l.RUnlock, nil
+}
+
+// Remove deletes the mirror of key
+func (c *Cache) Remove(key string) error {
+	if c == nil {
+		return nil
+	}
+	l := c.lock(key)
+	l.Lock()
+	defer l.Unlock()
+	return os.RemoveAll(filepath.Join(c.dir, key+".git"))
+}
@@ -4,31 +4,91 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"sort"
 	"strings"
 )
 
+// Auth holds the credentials of a remote repository, left empty for a public one
+type Auth struct {
+	// Token authenticates HTTPS clones
+	Token string
+	// DeployKey is a private SSH key, the repository being cloned over SSH with it rather than with Token
+	DeployKey string
+}
+
+// remote returns the URL and environment git reaches a repository with, and a cleanup removing the files they need
+// https://github.com/user/repo.git -> https://token@github.com/user/repo.git with a token, git@github.com:user/repo.git with a deploy key
+func remote(repoURL string, auth Auth) (string, []string, func(), error) {
+	if auth.DeployKey == "" {
+		if auth.Token != "" {
+			repoURL = injectToken(repoURL, auth.Token)
+		}
+		return repoURL, nil, func() {}, nil
+	}
+
+	keyDir, err := os.MkdirTemp("", "cicd-deploy-key-")
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	cleanup := func() { os.RemoveAll(keyDir) }
+	keyFile := filepath.Join(keyDir, "id")
+	key := strings.TrimSpace(auth.DeployKey) + "\n"
+	if err := os.WriteFile(keyFile, []byte(key), 0600); err != nil {
+		cleanup()
+		return "", nil, nil, fmt.Errorf("failed to write deploy key: %w", err)
+	}
+	// The host key is accepted on first use, in a known_hosts file of this command only
+	sshCommand := fmt.Sprintf("ssh -i %s -o IdentitiesOnly=yes -o StrictHostKeyChecking=accept-new -o UserKnownHostsFile=%s",
+		keyFile, filepath.Join(keyDir, "known_hosts"))
+	return sshURL(repoURL), append(os.Environ(), "GIT_SSH_COMMAND="+sshCommand), cleanup, nil
+}
+
+// sshURL turns an HTTPS repository URL into its SSH equivalent, leaving other URLs as they are
+func sshURL(repoURL string) string {
+	rest, ok := strings.CutPrefix(repoURL, "https://")
+	if !ok {
+		return repoURL
+	}
+	// Credentials of the HTTPS URL are not those of the SSH user
+	if at := strings.Index(rest, "@"); at >= 0 && at < strings.Index(rest+"/", "/") {
+		rest = rest[at+1:]
+	}
+	host, path, _ := strings.Cut(rest, "/")
+	return "git@" + host + ":" + path
+}
+
 // Clone clones a repository to the destination path and checks out a specific commit
-// If token is provided, it's used for authentication (HTTPS)
 // If commitHash is provided, it checks out that specific commit after cloning
-func Clone(repoURL, branch, destPath, token, commitHash string) error {
-	// If token provided, inject it into the URL for auth
-	// https://github.com/user/repo.git -> https://token@github.com/user/repo.git
-	if token != "" {
-		repoURL = injectToken(repoURL, token)
+func Clone(repoURL, branch, destPath string, auth Auth, commitHash string) error {
+	return CloneWithReference(repoURL, branch, destPath, auth, commitHash, "")
+}
+
+// CloneWithReference clones like Clone, borrowing the objects of the local repository at reference, empty for none
+// Only the objects missing there are downloaded, and they are copied into the clone (--dissociate) so it does not depend on reference.
+func CloneWithReference(repoURL, branch, destPath string, auth Auth, commitHash, reference string) error {
+	repoURL, env, cleanup, err := remote(repoURL, auth)
+	if err != nil {
+		return err
 	}
+	defer cleanup()
 
 	// If we need a specific commit, we can't use shallow clone
 	// because the commit might not be the latest on the branch
-	var args []string
+	args := []string{"clone"}
+	if reference != "" {
+		args = append(args, "--reference", reference, "--dissociate")
+	}
 	if commitHash != "" {
 		// Full clone to ensure we have the commit
-		args = []string{"clone", "--branch", branch, repoURL, destPath}
+		args = append(args, "--branch", branch, repoURL, destPath)
 	} else {
 		// Shallow clone if no specific commit needed
-		args = []string{"clone", "--depth", "1", "--branch", branch, repoURL, destPath}
+		args = append(args, "--depth", "1", "--branch", branch, repoURL, destPath)
 	}
 
 	cmd := exec.Command("git", args...)
+	cmd.Env = env
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("git clone failed: %s - %w", string(output), err)
@@ -70,12 +130,15 @@ func injectToken(repoURL, token string) string {
 }
 
 // GetRemoteHeadHash fetches the latest commit hash from the remote repository for a given branch
-func GetRemoteHeadHash(repoURL, branch, token string) (string, error) {
-	if token != "" {
-		repoURL = injectToken(repoURL, token)
+func GetRemoteHeadHash(repoURL, branch string, auth Auth) (string, error) {
+	repoURL, env, cleanup, err := remote(repoURL, auth)
+	if err != nil {
+		return "", err
 	}
+	defer cleanup()
 
 	cmd := exec.Command("git", "ls-remote", repoURL, branch)
+	cmd.Env = env
 	output, err := cmd.Output()
 	if err != nil {
 		return "", fmt.Errorf("failed to get remote head hash: %w", err)
@@ -90,6 +153,83 @@ func GetRemoteHeadHash(repoURL, branch, token string) (string, error) {
 	return parts[0], nil
 }
 
+// Branch is a branch of a remote repository with the commit at its head
+type Branch struct {
+	Name       string `json:"name"`
+	CommitHash string `json:"commit_hash"`
+}
+
+// ListRemoteBranches lists the branches of a remote repository, sorted by name, with its default branch
+func ListRemoteBranches(repoURL string, auth Auth) ([]Branch, string, error) {
+	repoURL, env, cleanup, err := remote(repoURL, auth)
+	if err != nil {
+		return nil, "", err
+	}
+	defer cleanup()
+
+	cmd := exec.Command("git", "ls-remote", "--symref", repoURL, "HEAD", "refs/heads/*")
+	cmd.Env = env
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list remote branches: %w", err)
+	}
+
+	// Output format: ref: refs/heads/<default>\tHEAD, then <hash>\t<ref> lines
+	branches := []Branch{}
+	defaultBranch := ""
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 3 && fields[0] == "ref:" && fields[2] == "HEAD" {
+			defaultBranch = strings.TrimPrefix(fields[1], "refs/heads/")
+			continue
+		}
+		if len(fields) == 2 && strings.HasPrefix(fields[1], "refs/heads/") {
+			branches = append(branches, Branch{Name: strings.TrimPrefix(fields[1], "refs/heads/"), CommitHash: fields[0]})
+		}
+	}
+	sort.Slice(branches, func(i, j int) bool { return branches[i].Name < branches[j].Name })
+
+	return branches, defaultBranch, nil
+}
+
+// ResolveBranchCommit checks that a commit (full or abbreviated hash) belongs to the history of a remote branch
+// and returns its full hash. Only the commit graph is fetched, in a temporary bare clone.
+func ResolveBranchCommit(repoURL, branch string, auth Auth, commitHash string) (string, error) {
+	repoURL, env, cleanup, err := remote(repoURL, auth)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	tmpDir, err := os.MkdirTemp("", "cicd-resolve-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cmd := exec.Command("git", "clone", "--bare", "--filter=blob:none", "--single-branch", "--no-tags", "--branch", branch, repoURL, tmpDir)
+	cmd.Env = env
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("git clone failed: %s - %w", string(output), err)
+	}
+
+	cmd = exec.Command("git", "rev-parse", "--verify", "--quiet", commitHash+"^{commit}")
+	cmd.Dir = tmpDir
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("commit %s not found on branch %s", commitHash, branch)
+	}
+	fullHash := strings.TrimSpace(string(output))
+
+	cmd = exec.Command("git", "merge-base", "--is-ancestor", fullHash, "refs/heads/"+branch)
+	cmd.Dir = tmpDir
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("commit %s not found on branch %s", commitHash, branch)
+	}
+
+	return fullHash, nil
+}
+
 // GetLatestCommitHash returns the HEAD commit hash (optional but useful)
 func GetLatestCommitHash(repoPath string) (string, error) {
 	cmd := exec.Command("git", "rev-parse", "HEAD")
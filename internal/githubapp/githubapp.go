@@ -0,0 +1,238 @@
+// Package githubapp authenticates as a GitHub App to mint short-lived installation tokens
+// Projects of repositories where the app is installed no longer need a personal access token.
+package githubapp
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+)
+
+// gitHubAPI is the base URL of the GitHub REST API
+const gitHubAPI = "https://api.github.com"
+
+// tokenRefreshMargin renews installation tokens this long before GitHub expires them (after one hour)
+const tokenRefreshMargin = 5 * time.Minute
+
+// Permissions of the installation tokens, restricted to what each use needs
+var (
+	// RepoPermissions let the token clone the repository and read its branches and commits
+	RepoPermissions = map[string]string{"contents": "read"}
+	// StatusPermissions let the token report commit statuses
+	StatusPermissions = map[string]string{"statuses": "write"}
+)
+
+// App mints the installation tokens of a GitHub App, caching them until they are about to expire
+type App struct {
+	appID   string
+	key     *rsa.PrivateKey
+	client  *http.Client
+	baseURL string
+
+	mu     sync.Mutex
+	tokens map[tokenScope]installationToken
+}
+
+// tokenScope identifies the cached tokens of an installation, by repository and permissions
+type tokenScope struct {
+	installationID int64
+	repo           string
+	permissions    string
+}
+
+type installationToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// FromEnv creates the app configured by GITHUB_APP_ID and GITHUB_APP_PRIVATE_KEY (or GITHUB_APP_PRIVATE_KEY_PATH)
+// It returns nil without error when no app is configured.
+func FromEnv() (*App, error) {
+	appID := os.Getenv("GITHUB_APP_ID")
+	if appID == "" {
+		return nil, nil
+	}
+
+	pemKey := []byte(os.Getenv("GITHUB_APP_PRIVATE_KEY"))
+	if path := os.Getenv("GITHUB_APP_PRIVATE_KEY_PATH"); len(pemKey) == 0 && path != "" {
+		var err error
+		if pemKey, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("failed to read GitHub App private key: %w", err)
+		}
+	}
+	// Keys passed in a single-line environment variable have escaped newlines
+	pemKey = []byte(strings.ReplaceAll(string(pemKey), `\n`, "\n"))
+
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(pemKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GitHub App private key: %w", err)
+	}
+
+	return New(appID, key, ""), nil
+}
+
+// New creates the app of an ID and private key, calling the GitHub REST API at baseURL, api.github.com when empty
+func New(appID string, key *rsa.PrivateKey, baseURL string) *App {
+	if baseURL == "" {
+		baseURL = gitHubAPI
+	}
+	return &App{
+		appID:   appID,
+		key:     key,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		tokens:  make(map[tokenScope]installationToken),
+	}
+}
+
+// Repository extracts owner/name from a github.com repository URL
+func Repository(repoURL string) (string, bool) {
+	u, err := url.Parse(repoURL)
+	if err != nil || u.Host != "github.com" {
+		return "", false
+	}
+	repo := strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git")
+	if strings.Count(repo, "/") != 1 {
+		return "", false
+	}
+	return repo, true
+}
+
+// RepoToken returns the token giving read access to the repository of a project
+// Projects linked to an installation get an installation token, the others keep their stored access token.
+// A nil App always returns the stored token.
+func (a *App) RepoToken(ctx context.Context, project *models.Project) (string, error) {
+	return a.projectToken(ctx, project, RepoPermissions)
+}
+
+// StatusToken returns the token reporting commit statuses on the repository of a project, like RepoToken
+func (a *App) StatusToken(ctx context.Context, project *models.Project) (string, error) {
+	return a.projectToken(ctx, project, StatusPermissions)
+}
+
+func (a *App) projectToken(ctx context.Context, project *models.Project, permissions map[string]string) (string, error) {
+	if a == nil || project.GitHubInstallationID == 0 {
+		return project.AccessToken, nil
+	}
+	repo, ok := Repository(project.RepoURL)
+	if !ok {
+		return "", fmt.Errorf("installation tokens need a github.com repository")
+	}
+	return a.InstallationToken(ctx, project.GitHubInstallationID, repo, permissions)
+}
+
+// CheckInstallation checks that an installation of the app is the one giving access to the repository of repoURL
+// Projects are only linked to installations covering their repository, their tokens reaching no other repository.
+func (a *App) CheckInstallation(ctx context.Context, installationID int64, repoURL string) error {
+	if a == nil {
+		return fmt.Errorf("no GitHub App is configured on this instance")
+	}
+	repo, ok := Repository(repoURL)
+	if !ok {
+		return fmt.Errorf("GitHub App installations need a github.com repository")
+	}
+
+	resp, err := a.appRequest(ctx, http.MethodGet, "/repos/"+repo+"/installation", nil)
+	if err != nil {
+		return fmt.Errorf("failed to look up the installation of %s: %w", repo, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("the GitHub App is not installed on %s", repo)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GitHub returned %s for the installation of %s", resp.Status, repo)
+	}
+	var installation struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&installation); err != nil {
+		return fmt.Errorf("invalid installation response: %w", err)
+	}
+	if installation.ID != installationID {
+		return fmt.Errorf("installation %d does not give access to %s", installationID, repo)
+	}
+	return nil
+}
+
+// InstallationToken returns a token of an installation of the app restricted to a repository (owner/name) and permissions,
+// minting a new one when needed
+func (a *App) InstallationToken(ctx context.Context, installationID int64, repo string, permissions map[string]string) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	encodedPermissions, err := json.Marshal(permissions)
+	if err != nil {
+		return "", err
+	}
+	scope := tokenScope{installationID: installationID, repo: repo, permissions: string(encodedPermissions)}
+	if t, ok := a.tokens[scope]; ok && time.Until(t.ExpiresAt) > tokenRefreshMargin {
+		return t.Token, nil
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"repositories": []string{path.Base(repo)},
+		"permissions":  permissions,
+	})
+	if err != nil {
+		return "", err
+	}
+	resp, err := a.appRequest(ctx, http.MethodPost, fmt.Sprintf("/app/installations/%d/access_tokens", installationID), body)
+	if err != nil {
+		return "", fmt.Errorf("failed to request installation token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("GitHub returned %s for installation %d", resp.Status, installationID)
+	}
+
+	var t installationToken
+	if err := json.NewDecoder(resp.Body).Decode(&t); err != nil {
+		return "", fmt.Errorf("invalid installation token response: %w", err)
+	}
+	a.tokens[scope] = t
+	return t.Token, nil
+}
+
+// appRequest sends a request to the GitHub API authenticated as the app itself
+func (a *App) appRequest(ctx context.Context, method, endpoint string, body []byte) (*http.Response, error) {
+	appJWT, err := a.jwt()
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign GitHub App JWT: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, a.baseURL+endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+appJWT)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return a.client.Do(req)
+}
+
+// jwt signs the short-lived JWT authenticating the app itself
+// It is backdated a minute to tolerate clock drift with GitHub, which refuses expirations over ten minutes.
+func (a *App) jwt() (string, error) {
+	now := time.Now()
+	claims := jwt.RegisteredClaims{
+		Issuer:    a.appID,
+		IssuedAt:  jwt.NewNumericDate(now.Add(-time.Minute)),
+		ExpiresAt: jwt.NewNumericDate(now.Add(9 * time.Minute)),
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(a.key)
+}
@@ -0,0 +1,94 @@
+package githubapp
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+)
+
+// newTestApp returns an app calling a fake GitHub API where installation 42 covers acme/app
+func newTestApp(t *testing.T) (*App, *[]map[string]interface{}) {
+	t.Helper()
+	var tokenRequests []map[string]interface{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /repos/acme/app/installation", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]int64{"id": 42})
+	})
+	mux.HandleFunc("POST /app/installations/42/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		tokenRequests = append(tokenRequests, body)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(installationToken{Token: "ghs_token", ExpiresAt: time.Now().Add(time.Hour)})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	return New("1234", key, server.URL), &tokenRequests
+}
+
+func TestCheckInstallation(t *testing.T) {
+	app, _ := newTestApp(t)
+	ctx := context.Background()
+
+	if err := app.CheckInstallation(ctx, 42, "https://github.com/acme/app.git"); err != nil {
+		t.Errorf("Expected installation 42 to cover acme/app, got %v", err)
+	}
+	invalid := map[string]struct {
+		installationID int64
+		repoURL        string
+	}{
+		"other installation": {7, "https://github.com/acme/app.git"},
+		"app not installed":  {42, "https://github.com/victim/private.git"},
+		"not github":         {42, "https://gitlab.com/acme/app.git"},
+	}
+	for name, c := range invalid {
+		if err := app.CheckInstallation(ctx, c.installationID, c.repoURL); err == nil {
+			t.Errorf("Expected error for %s, got nil", name)
+		}
+	}
+	var noApp *App
+	if err := noApp.CheckInstallation(ctx, 42, "https://github.com/acme/app.git"); err == nil {
+		t.Error("Expected error without GitHub App, got nil")
+	}
+}
+
+func TestRepoTokenRestricted(t *testing.T) {
+	app, requests := newTestApp(t)
+	project := &models.Project{RepoURL: "https://github.com/acme/app.git", GitHubInstallationID: 42}
+
+	token, err := app.RepoToken(context.Background(), project)
+	if err != nil || token != "ghs_token" {
+		t.Fatalf("Expected the installation token, got %q %v", token, err)
+	}
+	if _, err := app.RepoToken(context.Background(), project); err != nil {
+		t.Fatalf("Expected the cached token, got %v", err)
+	}
+	if _, err := app.StatusToken(context.Background(), project); err != nil {
+		t.Fatalf("Expected the status token, got %v", err)
+	}
+	if len(*requests) != 2 {
+		t.Fatalf("Expected one token per permission set, got %d requests", len(*requests))
+	}
+
+	body := (*requests)[0]
+	repositories, _ := body["repositories"].([]interface{})
+	permissions, _ := body["permissions"].(map[string]interface{})
+	if len(repositories) != 1 || repositories[0] != "app" || len(permissions) != 1 || permissions["contents"] != "read" {
+		t.Errorf("Expected a token restricted to app with contents:read, got %v", body)
+	}
+	if permissions, _ := (*requests)[1]["permissions"].(map[string]interface{}); permissions["statuses"] != "write" {
+		t.Errorf("Expected a status token with statuses:write, got %v", (*requests)[1])
+	}
+}
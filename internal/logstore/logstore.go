@@ -0,0 +1,93 @@
+// Package logstore keeps job logs in object storage (S3, MinIO) instead of the database
+package logstore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// Store saves, reads and deletes log chunks by key
+type Store interface {
+	Put(ctx context.Context, key string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// S3Store is a Store backed by an S3-compatible bucket
+type S3Store struct {
+	client *minio.Client
+	bucket string
+}
+
+// NewS3FromEnv connects to the bucket set by LOG_S3_ENDPOINT and LOG_S3_BUCKET, creating it when missing
+// It returns nil without error when no endpoint is configured, logs then staying in the database.
+func NewS3FromEnv(ctx context.Context) (*S3Store, error) {
+	endpoint := os.Getenv("LOG_S3_ENDPOINT")
+	if endpoint == "" {
+		return nil, nil
+	}
+	bucket := os.Getenv("LOG_S3_BUCKET")
+	if bucket == "" {
+		return nil, fmt.Errorf("LOG_S3_BUCKET is required with LOG_S3_ENDPOINT")
+	}
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(os.Getenv("LOG_S3_ACCESS_KEY"), os.Getenv("LOG_S3_SECRET_KEY"), ""),
+		Secure: os.Getenv("LOG_S3_USE_SSL") != "false",
+		Region: os.Getenv("LOG_S3_REGION"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client: %w", err)
+	}
+
+	exists, err := client.BucketExists(ctx, bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check bucket %s: %w", bucket, err)
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, bucket, minio.MakeBucketOptions{Region: os.Getenv("LOG_S3_REGION")}); err != nil {
+			return nil, fmt.Errorf("failed to create bucket %s: %w", bucket, err)
+		}
+	}
+
+	return &S3Store{client: client, bucket: bucket}, nil
+}
+
+// Put uploads a chunk
+func (s *S3Store) Put(ctx context.Context, key string, data []byte) error {
+	_, err := s.client.PutObject(ctx, s.bucket, key, bytes.NewReader(data), int64(len(data)),
+		minio.PutObjectOptions{ContentType: "text/plain; charset=utf-8"})
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+	return nil
+}
+
+// Get downloads a chunk
+func (s *S3Store) Get(ctx context.Context, key string) ([]byte, error) {
+	object, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", key, err)
+	}
+	defer object.Close()
+
+	data, err := io.ReadAll(object)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", key, err)
+	}
+	return data, nil
+}
+
+// Delete removes a chunk, a missing one included
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	if err := s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to delete %s: %w", key, err)
+	}
+	return nil
+}
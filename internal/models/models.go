@@ -3,24 +3,146 @@ package models
 import "time"
 
 type User struct {
-	ID         int       `json:"id"`
-	Email      string    `json:"email"`
-	Name       string    `json:"name"`
-	AvatarURL  string    `json:"avatar_url"`
-	Provider   string    `json:"provider"`
-	ProviderID string    `json:"provider_id"`
-	CreatedAt  time.Time `json:"created_at"`
+	ID            int       `json:"id"`
+	Email         string    `json:"email"`
+	Name          string    `json:"name"`
+	AvatarURL     string    `json:"avatar_url"`
+	Provider      string    `json:"provider"`
+	ProviderID    string    `json:"provider_id"`
+	EmailVerified bool      `json:"email_verified"` // Set for OAuth accounts, and local accounts once their email is confirmed
+	CreatedAt     time.Time `json:"created_at"`
 }
 
 type Variable struct {
-	ID        int       `json:"id"`
-	ProjectID int       `json:"project_id"`
-	Key       string    `json:"key"`
-	Value     string    `json:"value"`
-	IsSecret  bool      `json:"is_secret"`
-	CreatedAt time.Time `json:"created_at"`
+	ID        int    `json:"id"`
+	ProjectID int    `json:"project_id"`
+	Key       string `json:"key"`
+	Value     string `json:"value"`
+	IsSecret  bool   `json:"is_secret"`
+	// EnvironmentScope is the environment the variable applies to, * for every environment
+	EnvironmentScope string    `json:"environment_scope"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// AllEnvironments is the environment scope of the variables given to every environment
+const AllEnvironments = "*"
+
+// Environment is a deployment target of a project, e.g. staging or production
+type Environment struct {
+	ID        int    `json:"id"`
+	ProjectID int    `json:"project_id"`
+	Name      string `json:"name"`
+	// SSHHost is the host deployed to over SSH, empty for a local deployment
+	SSHHost string `json:"ssh_host"`
+	SSHUser string `json:"ssh_user"`
+	// SSHPrivateKey is empty to use the key of the project
+	SSHPrivateKey      string `json:"ssh_private_key"`
+	DeploymentFilename string `json:"deployment_filename"`
+	// Protected environments only accept deployments of pipelines started by a maintainer or pushed to ProtectedBranches
+	Protected bool `json:"protected"`
+	// ProtectedBranches are the branch globs whose pushes deploy to a protected environment, empty for none
+	ProtectedBranches []string `json:"protected_branches"`
+	// DeploymentStrategy is one of the Strategy values
+	DeploymentStrategy string `json:"deployment_strategy"`
+	// CanaryReplicas is the number of new replicas started next to the stable ones of each replicated service
+	CanaryReplicas int `json:"canary_replicas"`
+	// CanaryBakeSeconds is how long the canary replicas must stay healthy before the rollout completes
+	CanaryBakeSeconds int `json:"canary_bake_seconds"`
+	// SSHHosts are deployed after SSHHost with the same user and key, one batch after the other
+	SSHHosts []string `json:"ssh_hosts"`
+	// RolloutBatchSize is the number of hosts deployed at once
+	RolloutBatchSize int `json:"rollout_batch_size"`
+	// PreDeploy and PostDeploy are shell commands run over SSH on each host before and after its deployment
+	PreDeploy  []string `json:"pre_deploy"`
+	PostDeploy []string `json:"post_deploy"`
+	// Proxy is the reverse proxy of the hosts (traefik or caddy) the project is exposed through, empty for none
+	Proxy string `json:"proxy"`
+	// ProxyDomain serves the project at <project>.<domain>
+	ProxyDomain string `json:"proxy_domain"`
+	// ProxyService and ProxyPort are the routed service and container port, empty to read them from the compose file
+	ProxyService string `json:"proxy_service"`
+	ProxyPort    int    `json:"proxy_port"`
+	// Preview environments deploy each branch as its own compose project, torn down with the branch, see Preview
+	Preview bool `json:"preview"`
+	// StoppedAt is when the deployment of the environment was torn down, nil while it runs
+	StoppedAt *time.Time `json:"stopped_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
 }
 
+// Preview is a branch deployed to a preview environment, removed when the branch or its pull request is closed
+type Preview struct {
+	ID          int    `json:"id"`
+	ProjectID   int    `json:"project_id"`
+	Environment string `json:"environment"`
+	Branch      string `json:"branch"`
+	// ComposeProject is the compose project the branch runs as on the hosts of the environment
+	ComposeProject string `json:"compose_project"`
+	// URL is empty when the environment has no proxy
+	URL        string    `json:"url"`
+	PipelineID int       `json:"pipeline_id"`
+	CommitHash string    `json:"commit_hash"`
+	DeployedAt time.Time `json:"deployed_at"`
+	// ExpiresAt is when the preview is torn down if its branch is still open, nil without PREVIEW_TTL
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// EnvironmentVersion is the version live on an environment, updated by deployments and rollbacks
+type EnvironmentVersion struct {
+	Environment string `json:"environment"`
+	// PipelineID is the pipeline whose commit is deployed, the rolled back to pipeline after a rollback
+	PipelineID int    `json:"pipeline_id"`
+	CommitHash string `json:"commit_hash"`
+	Branch     string `json:"branch"`
+	// Images is empty for local deployments, whose images are not pushed to a registry
+	Images     []string  `json:"images"`
+	DeployedAt time.Time `json:"deployed_at"`
+}
+
+// Deployment strategies of an environment
+const (
+	// StrategyRecreate replaces every container at once
+	StrategyRecreate = "recreate"
+	// StrategyCanary first runs a few replicas of the new version next to the stable ones, see Environment
+	StrategyCanary = "canary"
+)
+
+// Deployment methods of a project
+const (
+	// DeploymentMethodScript copies the compose files and a bash deploy script to the SSH host
+	DeploymentMethodScript = "script"
+	// DeploymentMethodContext runs docker compose here against the engine of the SSH host, tunnelled over SSH
+	DeploymentMethodContext = "context"
+	// DeploymentMethodAnsible runs the deployment file as an Ansible playbook against the SSH hosts, from a container here
+	DeploymentMethodAnsible = "ansible"
+)
+
+// Job executors of a project
+const (
+	// JobExecutorDocker runs each job in a container of its image
+	JobExecutorDocker = "docker"
+	// JobExecutorShell runs the job scripts directly on the engine host, when the instance allows it
+	JobExecutorShell = "shell"
+)
+
+// What a retention policy does with the old pipelines of a project
+const (
+	// RetentionActionDelete deletes the pipelines with their jobs, deployments, logs and artifacts
+	RetentionActionDelete = "delete"
+	// RetentionActionArchive keeps the pipelines, jobs and deployments but deletes their logs and artifacts
+	RetentionActionArchive = "archive"
+)
+
+// Extra image tags a project pushes next to the commit hash
+const (
+	// ImageTagLatest tags the images of the default branch latest
+	ImageTagLatest = "latest"
+	// ImageTagBranch tags the images with their branch name
+	ImageTagBranch = "branch"
+	// ImageTagSemver tags the images of a vX.Y.Z git tag X.Y.Z, X.Y and X
+	ImageTagSemver = "semver"
+)
+
 type Project struct {
 	ID        int       `json:"id"`
 	OwnerID   int       `json:"owner_id"`
@@ -29,11 +151,54 @@ type Project struct {
 	AccessToken        string    `json:"access_token"`
 	PipelineFilename   string    `json:"pipeline_filename"`
 	DeploymentFilename string    `json:"deployment_filename"`
+	// DeploymentFiles are the repository files and directories copied to the SSH host next to the compose file
+	DeploymentFiles []string  `json:"deployment_files"`
 	SSHHost            string    `json:"ssh_host"`
 	SSHUser            string    `json:"ssh_user"`
 	SSHPrivateKey      string    `json:"ssh_private_key"`
-	RegistryUser       string    `json:"registry_user"`
-	RegistryToken   string    `json:"registry_token"`
+	// SSHBastionHost is the jump host the SSH host is reached through, empty to connect directly
+	SSHBastionHost string `json:"ssh_bastion_host"`
+	// SSHBastionUser and SSHBastionPrivateKey are empty to use the ones of the SSH host
+	SSHBastionUser       string   `json:"ssh_bastion_user"`
+	SSHBastionPrivateKey string   `json:"ssh_bastion_private_key"`
+	RegistryUser         string   `json:"registry_user"`
+	RegistryToken        string   `json:"registry_token"`
+	// RegistryURL is the registry the images are pushed to, empty for Docker Hub, see compose.ImageNamespace
+	RegistryURL string `json:"registry_url"`
+	// DeploymentMethod is how the SSH host is deployed to, one of the DeploymentMethod values
+	DeploymentMethod string `json:"deployment_method"`
+	// BuildPlatforms are the platforms the deployment builds images for (e.g. linux/amd64, linux/arm64), empty for the one of the engine
+	BuildPlatforms []string `json:"build_platforms"`
+	// ImageTags are the ImageTag values of the tags pushed with the commit hash
+	ImageTags     []string `json:"image_tags"`
+	// JobExecutor runs the pipeline jobs, one of the JobExecutor values
+	JobExecutor   string   `json:"job_executor"`
+	BranchFilters []string `json:"branch_filters"`
+	// MaxConcurrentPipelines caps the pipelines running at once for the project, 0 for unlimited
+	MaxConcurrentPipelines int `json:"max_concurrent_pipelines"`
+	// PipelineTimeoutSeconds stops the pipelines running for longer, 0 for the PIPELINE_TIMEOUT of the instance
+	PipelineTimeoutSeconds int `json:"pipeline_timeout_seconds"`
+	// RetentionDays is the age in days of the finished pipelines the janitor removes, 0 to keep them forever
+	// The latest successful pipeline of each branch and the deployed ones are always kept.
+	RetentionDays int `json:"retention_days"`
+	// RetentionAction is what happens to them, one of the RetentionAction values
+	RetentionAction string `json:"retention_action"`
+	// AutoCancelRedundant cancels older pipelines of a branch when a newer commit is pushed
+	AutoCancelRedundant bool `json:"auto_cancel_redundant"`
+	// AllowPrivileged lets jobs of the project run privileged containers
+	AllowPrivileged bool `json:"allow_privileged"`
+	// SlackWebhookURL is the incoming webhook receiving the project notifications, empty for none
+	SlackWebhookURL string `json:"slack_webhook_url"`
+	// SlackEvents selects the notified events: failed, all or deploy
+	SlackEvents string `json:"slack_events"`
+	// GitHubInstallationID is the GitHub App installation giving access to the repository, 0 to use AccessToken
+	GitHubInstallationID int64 `json:"github_installation_id"`
+	// DeployKey is the private SSH key generated to clone the repository over SSH, empty to clone over HTTPS
+	DeployKey string `json:"-"`
+	// DeployKeyPublic is its public key, to add to the deploy keys of the repository
+	DeployKeyPublic string `json:"deploy_key_public,omitempty"`
+	// OrganizationID is the organization owning the project, nil for a personal project
+	OrganizationID *int       `json:"organization_id,omitempty"`
 	Variables       []Variable `json:"variables,omitempty"`
 	CreatedAt       time.Time  `json:"created_at"`
 }
@@ -45,11 +210,48 @@ type NewProject struct {
 	AccessToken        string `json:"access_token"`
 	PipelineFilename   string `json:"pipeline_filename"`
 	DeploymentFilename string `json:"deployment_filename"`
+	DeploymentFiles    []string `json:"deployment_files"`
 	SSHHost            string `json:"ssh_host"`
 	SSHUser            string `json:"ssh_user"`
 	SSHPrivateKey      string `json:"ssh_private_key"`
+	SSHBastionHost       string `json:"ssh_bastion_host"`
+	SSHBastionUser       string `json:"ssh_bastion_user"`
+	SSHBastionPrivateKey string `json:"ssh_bastion_private_key"`
 	RegistryUser       string `json:"registry_user"`
 	RegistryToken   string `json:"registry_token"`
+	RegistryURL     string `json:"registry_url"`
+	DeploymentMethod string `json:"deployment_method"`
+	BuildPlatforms  []string `json:"build_platforms"`
+	ImageTags       []string `json:"image_tags"`
+	JobExecutor     string   `json:"job_executor"`
+	BranchFilters   []string `json:"branch_filters"`
+	MaxConcurrentPipelines int  `json:"max_concurrent_pipelines"`
+	PipelineTimeoutSeconds int  `json:"pipeline_timeout_seconds"`
+	RetentionDays          int    `json:"retention_days"`
+	RetentionAction        string `json:"retention_action"`
+	AutoCancelRedundant    bool `json:"auto_cancel_redundant"`
+	AllowPrivileged        bool `json:"allow_privileged"`
+	SlackWebhookURL        string `json:"slack_webhook_url"`
+	SlackEvents            string `json:"slack_events"`
+	GitHubInstallationID   int64  `json:"github_installation_id"`
+}
+
+// ProjectTemplate is a blueprint projects are created from: a pipeline file committed to their repository,
+// default variables and environments
+type ProjectTemplate struct {
+	ID      int `json:"id"`
+	OwnerID int `json:"owner_id"`
+	// OrganizationID shares the template with the members of an organization, nil for a personal template
+	OrganizationID *int   `json:"organization_id,omitempty"`
+	Name           string `json:"name"`
+	Description    string `json:"description"`
+	// PipelineFilename is the path the pipeline file is committed to and read from, PipelineContent empty to commit none
+	PipelineFilename string `json:"pipeline_filename"`
+	PipelineContent  string `json:"pipeline_content"`
+	// Variables and Environments are created on every project, the environments using the SSH key of their project
+	Variables    []Variable    `json:"variables"`
+	Environments []Environment `json:"environments"`
+	CreatedAt    time.Time     `json:"created_at"`
 }
 
 type ProjectMember struct {
@@ -60,14 +262,82 @@ type ProjectMember struct {
 	User      *User     `json:"user,omitempty"`
 }
 
+// Organization groups projects whose members share access to all of them
+type Organization struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	OwnerID int    `json:"owner_id"`
+	// Role is the role of the requesting user, set when listing their organizations
+	Role      string    `json:"role,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OrganizationMember gives a user a role on every project of an organization
+type OrganizationMember struct {
+	OrganizationID int       `json:"organization_id"`
+	UserID         int       `json:"user_id"`
+	Role           string    `json:"role"`
+	JoinedAt       time.Time `json:"joined_at"`
+	User           *User     `json:"user,omitempty"`
+}
+
+// Team gives its members a role on every project of its organization
+type Team struct {
+	ID             int       `json:"id"`
+	OrganizationID int       `json:"organization_id"`
+	Name           string    `json:"name"`
+	Role           string    `json:"role"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// TeamMember is a user belonging to a team
+type TeamMember struct {
+	TeamID   int       `json:"team_id"`
+	UserID   int       `json:"user_id"`
+	JoinedAt time.Time `json:"joined_at"`
+	User     *User     `json:"user,omitempty"`
+}
+
 type Pipeline struct {
-	ID         int        `json:"id"`
-	ProjectID  int        `json:"project_id"`
-	Status     string     `json:"status"`
-	CommitHash string     `json:"commit_hash,omitempty"`
-	Branch     string     `json:"branch,omitempty"`
-	CreatedAt  time.Time  `json:"created_at"`
+	ID         int    `json:"id"`
+	ProjectID  int    `json:"project_id"`
+	Status     string `json:"status"`
+	CommitHash string `json:"commit_hash,omitempty"`
+	Branch     string `json:"branch,omitempty"`
+	// Tag is set for the pipelines of a pushed tag, see PipelineRunParams
+	Tag string `json:"tag,omitempty"`
+	// DefaultBranch and ChangedFiles come from the push, they are restored when the pipeline is resumed or retried
+	DefaultBranch string   `json:"default_branch,omitempty"`
+	ChangedFiles  []string `json:"changed_files,omitempty"`
+	// FailureReason explains why a failed pipeline stopped, e.g. a clone or CI config error
+	FailureReason string     `json:"failure_reason,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	// StartedAt is when the pipeline started running, its timeout counts from there
+	StartedAt  *time.Time `json:"started_at,omitempty"`
 	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	// ArchivedAt is when the retention policy deleted the logs and artifacts of the pipeline
+	ArchivedAt *time.Time `json:"archived_at,omitempty"`
+}
+
+// RetentionResult counts what a retention pass archived or deleted, or would with a dry run
+type RetentionResult struct {
+	Action string `json:"action"`
+	DryRun bool   `json:"dry_run"`
+	// Before is the finish time under which pipelines are removed
+	Before      time.Time `json:"before"`
+	Pipelines   int       `json:"pipelines"`
+	Jobs        int       `json:"jobs"`
+	Deployments int       `json:"deployments"`
+	// Objects are the log chunks and artifacts deleted from object storage
+	Objects int `json:"objects"`
+}
+
+// PipelineFilter narrows and paginates a pipeline listing
+type PipelineFilter struct {
+	Status string
+	Branch string
+	Limit  int
+	Offset int
 }
 
 type Job struct {
@@ -80,21 +350,77 @@ type Job struct {
 	ExitCode   int        `json:"exit_code"`
 	StartedAt  *time.Time `json:"started_at,omitempty"`
 	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	// Usage is what the job container consumed, nil when it was not measured
+	Usage *ResourceUsage `json:"resource_usage,omitempty"`
+}
+
+// ResourceUsage is the CPU time, peak memory and disk I/O of a job container
+type ResourceUsage struct {
+	CPUSeconds      float64 `json:"cpu_seconds"`
+	PeakMemoryBytes int64   `json:"peak_memory_bytes"`
+	IOReadBytes     int64   `json:"io_read_bytes"`
+	IOWriteBytes    int64   `json:"io_write_bytes"`
+}
+
+// Vulnerability is a finding of a security-scan job
+type Vulnerability struct {
+	ID    int `json:"id"`
+	JobID int `json:"job_id"`
+	// JobName is filled when listing the vulnerabilities of a pipeline
+	JobName          string    `json:"job_name,omitempty"`
+	Target           string    `json:"target"`
+	VulnerabilityID  string    `json:"vulnerability_id"`
+	PkgName          string    `json:"pkg_name"`
+	InstalledVersion string    `json:"installed_version"`
+	FixedVersion     string    `json:"fixed_version,omitempty"`
+	Severity         string    `json:"severity"`
+	Title            string    `json:"title,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// Artifact kinds
+const (
+	ArtifactKindSBOM = "sbom"
+	// ArtifactKindTerraformPlan is the text rendering of the plan of a terraform plan job
+	ArtifactKindTerraformPlan = "terraform-plan"
+)
+
+// Artifact is a file produced by a pipeline, its content being downloaded separately
+type Artifact struct {
+	ID          int       `json:"id"`
+	PipelineID  int       `json:"pipeline_id"`
+	Name        string    `json:"name"`
+	Kind        string    `json:"kind"`
+	ContentType string    `json:"content_type"`
+	Size        int       `json:"size"`
+	CreatedAt   time.Time `json:"created_at"`
 }
 
 type LogLine struct {
-	ID        int       `json:"id"`
-	JobID     int       `json:"job_id"`
-	Content   string    `json:"content"`
+	ID      int    `json:"id"`
+	JobID   int    `json:"job_id"`
+	Content string `json:"content"`
+	// Stream is one of the LogStream values, empty for lines logged before streams were recorded
+	Stream    string    `json:"stream,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
+// Streams a log line was written to
+const (
+	LogStreamStdout = "stdout"
+	LogStreamStderr = "stderr"
+	// LogStreamSystem holds the messages of the CI itself, such as a job timeout
+	LogStreamSystem = "system"
+)
+
 type Deployment struct {
-	ID         int        `json:"id"`
-	PipelineID int        `json:"pipeline_id"`
-	Status     string     `json:"status"`
-	StartedAt  *time.Time `json:"started_at,omitempty"`
-	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	ID         int    `json:"id"`
+	PipelineID int    `json:"pipeline_id"`
+	Status     string `json:"status"`
+	// Environment is the environment deployed to, empty when the project settings are used
+	Environment string     `json:"environment,omitempty"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
 }
 
 type DeploymentLog struct {
@@ -104,6 +430,80 @@ type DeploymentLog struct {
 	CreatedAt  time.Time `json:"created_at"`
 }
 
+// Webhook is an outbound URL receiving the events of a project
+type Webhook struct {
+	ID        int    `json:"id"`
+	ProjectID int    `json:"project_id"`
+	URL       string `json:"url"`
+	// Secret signs the request bodies, masked in API responses
+	Secret string `json:"secret,omitempty"`
+	// Events lists the delivered event names, empty for all
+	Events    []string  `json:"events"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookDelivery is a webhook received from the repository host, kept with what became of it to diagnose and replay it
+type WebhookDelivery struct {
+	ID int `json:"id"`
+	// DeliveryID is the X-GitHub-Delivery header, empty for replays
+	DeliveryID string            `json:"delivery_id,omitempty"`
+	Event      string            `json:"event"`
+	ProjectID  *int              `json:"project_id,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	// Payload is the request body, omitted from lists
+	Payload string `json:"payload,omitempty"`
+	// Status is received while processed, then triggered, skipped, handled, ignored or failed
+	Status string `json:"status"`
+	// Reason tells why no pipeline was triggered
+	Reason     string    `json:"reason,omitempty"`
+	PipelineID *int      `json:"pipeline_id,omitempty"`
+	ReplayOf   *int      `json:"replay_of,omitempty"`
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// APIToken is a personal access token letting scripts call the API as its user
+type APIToken struct {
+	ID     int    `json:"id"`
+	UserID int    `json:"user_id"`
+	Name   string `json:"name"`
+	// Scopes lists the granted scopes: read, write
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Runner is an agent executing jobs on its own Docker host
+type Runner struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// RunnerJob is a job handed to a runner, with everything needed to run it
+type RunnerJob struct {
+	JobID       int      `json:"job_id"`
+	PipelineID  int      `json:"pipeline_id"`
+	Name        string   `json:"name"`
+	Image       string   `json:"image"`
+	Script      []string `json:"script"`
+	Env         []string `json:"env"`
+	RepoURL     string   `json:"repo_url"`
+	AccessToken string   `json:"access_token,omitempty"`
+	DeployKey   string   `json:"deploy_key,omitempty"`
+	Branch      string   `json:"branch"`
+	CommitHash  string   `json:"commit_hash"`
+	Privileged  bool     `json:"privileged,omitempty"`
+	Network     string   `json:"network,omitempty"`
+	// WorkingDir is the directory of the container the script runs in, the workspace when empty
+	WorkingDir string `json:"working_dir,omitempty"`
+	// Entrypoint replaces the image entrypoint when set, [""] clearing it
+	Entrypoint []string `json:"entrypoint,omitempty"`
+	// RegistryAuth is the encoded registry credentials to pull the image with, empty for anonymous pulls
+	RegistryAuth string `json:"registry_auth,omitempty"`
+}
+
 // PipelineRunParams contains parameters to run a pipeline
 type PipelineRunParams struct {
 	RepoURL            string
@@ -111,6 +511,8 @@ type PipelineRunParams struct {
 	Branch             string
 	CommitHash         string
 	AccessToken        string
+	// DeployKey is the private SSH key the repository is cloned with instead of AccessToken, empty for none
+	DeployKey          string
 	PipelineFilename   string
 	DeploymentFilename string
 	SSHHost            string
@@ -121,6 +523,45 @@ type PipelineRunParams struct {
 	Variables       []Variable
 	ProjectID          int
 	PipelineID         int
+	// SkipSucceededJobs resumes the pipeline from the first stage that did not succeed for this commit
+	SkipSucceededJobs bool
+	// Resume runs again a pipeline parked on its manual jobs, from the records of its jobs
+	Resume bool
+	// MaxConcurrentPipelines caps the pipelines of the project running at once, 0 for unlimited
+	MaxConcurrentPipelines int
+	// Tag is set instead of a branch for pipelines of a pushed tag
+	Tag string
+	// DefaultBranch is the default branch of the repository, as reported by the push, empty when unknown
+	DefaultBranch string
+	// ChangedFiles lists the files changed by the push, nil when unknown
+	ChangedFiles []string
+	// PrebuiltServices lists the compose services whose image was already pushed by a build job
+	PrebuiltServices []string
+	// TraceContext carries the trace of the request that triggered the run, see pkg/tracing
+	TraceContext map[string]string
+	// RequestID is the ID of the API request or webhook delivery that triggered the run
+	RequestID string
+	// TriggeredBy is the user who started or retried the pipeline through the API, 0 for a push
+	TriggeredBy int
+	// Environment is the environment the pipeline deploys to, set once the CI file is parsed
+	Environment string
+	// DeploymentStrategy, CanaryReplicas and CanaryBakeSeconds come from the environment, empty for a recreate
+	DeploymentStrategy string
+	CanaryReplicas     int
+	CanaryBakeSeconds  int
+	// SSHHosts and RolloutBatchSize come from the environment, the hosts deployed after the SSH host of the project
+	SSHHosts         []string
+	RolloutBatchSize int
+	// PreDeploy and PostDeploy are the deploy hooks of the environment
+	PreDeploy  []string
+	PostDeploy []string
+	// Proxy, ProxyDomain, ProxyService and ProxyPort come from the environment, see Environment
+	Proxy        string
+	ProxyDomain  string
+	ProxyService string
+	ProxyPort    int
+	// ComposeProject replaces the repository name as compose project, set for the branches deployed to a preview environment
+	ComposeProject string
 }
 
 // PushEvent represents a GitHub push webhook payload
@@ -138,6 +579,22 @@ type PushEvent struct {
 	Commits    []Commit   `json:"commits"`
 }
 
+// PullRequestEvent represents a GitHub pull_request webhook payload
+type PullRequestEvent struct {
+	Action      string      `json:"action"`
+	Number      int         `json:"number"`
+	PullRequest PullRequest `json:"pull_request"`
+	Repository  Repository  `json:"repository"`
+}
+
+// PullRequest represents the pull request of a pull_request webhook
+type PullRequest struct {
+	// Head is the source branch of the pull request
+	Head struct {
+		Ref string `json:"ref"`
+	} `json:"head"`
+}
+
 // Repository represents the repository information in the webhook
 type Repository struct {
 	ID            int    `json:"id"`
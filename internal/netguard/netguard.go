@@ -0,0 +1,50 @@
+// Package netguard keeps outgoing requests built from user input off the internal network
+// Addresses are checked when dialing, after DNS resolution, so a name resolving to a private address is refused too.
+package netguard
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// ErrBlocked is returned when dialing an address that is not public
+var ErrBlocked = errors.New("address is not public")
+
+// sharedAddressSpace is the carrier-grade NAT range, not covered by netip.Addr.IsPrivate
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// Public reports whether ip is a public unicast address
+func Public(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !sharedAddressSpace.Contains(ip)
+}
+
+// Control is a net.Dialer Control function refusing the addresses that are not public
+func Control(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrBlocked, address)
+	}
+	if !Public(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s", ErrBlocked, addrPort.Addr())
+	}
+	return nil
+}
+
+// Client returns an HTTP client that only connects to public addresses
+// Proxies are not used, they would dial the target in our place.
+func Client(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: Control}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+		},
+	}
+}
@@ -0,0 +1,30 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/events"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+)
+
+// AuditLogger writes every pipeline, job and deployment status transition to the structured log
+type AuditLogger struct{}
+
+// NewAuditLogger creates an audit logger
+func NewAuditLogger() *AuditLogger {
+	return &AuditLogger{}
+}
+
+// Run logs the events of the bus until the context is cancelled
+func (a *AuditLogger) Run(ctx context.Context, bus *events.Bus) {
+	consume(ctx, bus, func(event events.Event) {
+		logger.Info(fmt.Sprintf("%s %d is %s", event.Type, event.ID, event.Status),
+			"audit", true,
+			"event_type", event.Type,
+			"event_id", event.ID,
+			"project_id", event.ProjectID,
+			"pipeline_id", event.PipelineID,
+			"status", event.Status)
+	})
+}
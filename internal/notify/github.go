@@ -0,0 +1,64 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// gitHubAPI is the base URL of the GitHub REST API
+const gitHubAPI = "https://api.github.com"
+
+// postGitHubStatus creates a commit status, shown on the pull requests containing the commit
+func (r *StatusReporter) postGitHubStatus(token, repo, sha string, status commitStatus) error {
+	body, err := json.Marshal(map[string]string{
+		"state":       gitHubState(status.Status),
+		"target_url":  status.TargetURL,
+		"description": truncate(status.Description, 140),
+		"context":     status.Context,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/repos/%s/statuses/%s", gitHubAPI, repo, sha), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("GitHub returned %s", resp.Status)
+	}
+	return nil
+}
+
+// gitHubState maps a pipeline or job status to a GitHub commit status state
+func gitHubState(status string) string {
+	switch status {
+	case "success":
+		return "success"
+	case "failed":
+		return "failure"
+	case "cancelled":
+		return "error"
+	default:
+		return "pending"
+	}
+}
+
+// truncate shortens s to at most n characters
+func truncate(s string, n int) string {
+	if len([]rune(s)) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
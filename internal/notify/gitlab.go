@@ -0,0 +1,83 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// gitLabRepository extracts the instance URL and the project path of a GitLab repository URL
+// Repositories on gitlab.com are recognised, and those of the self-hosted instance set in GITLAB_URL.
+func gitLabRepository(repoURL string) (string, string, bool) {
+	u, err := url.Parse(repoURL)
+	if err != nil || u.Host == "" {
+		return "", "", false
+	}
+
+	baseURL := "https://gitlab.com"
+	if u.Host != "gitlab.com" {
+		instance, err := url.Parse(os.Getenv("GITLAB_URL"))
+		if err != nil || instance.Host != u.Host {
+			return "", "", false
+		}
+		baseURL = strings.TrimRight(instance.String(), "/")
+	}
+
+	// Subgroups make paths like group/subgroup/project
+	repo := strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git")
+	if !strings.Contains(repo, "/") {
+		return "", "", false
+	}
+	return baseURL, repo, true
+}
+
+// postGitLabStatus sets a commit status, shown as an external stage of the merge request pipelines
+func (r *StatusReporter) postGitLabStatus(baseURL, token, repo, sha string, status commitStatus) error {
+	body, err := json.Marshal(map[string]string{
+		"state":       gitLabState(status.Status),
+		"name":        status.Context,
+		"target_url":  status.TargetURL,
+		"description": truncate(status.Description, 255),
+	})
+	if err != nil {
+		return err
+	}
+
+	endpoint := fmt.Sprintf("%s/api/v4/projects/%s/statuses/%s", baseURL, url.PathEscape(repo), sha)
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("PRIVATE-TOKEN", token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("GitLab returned %s", resp.Status)
+	}
+	return nil
+}
+
+// gitLabState maps a pipeline or job status to a GitLab commit status state
+func gitLabState(status string) string {
+	switch status {
+	case "running":
+		return "running"
+	case "success":
+		return "success"
+	case "failed":
+		return "failed"
+	case "cancelled":
+		return "canceled"
+	default:
+		return "pending"
+	}
+}
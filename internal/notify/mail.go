@@ -0,0 +1,52 @@
+package notify
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+)
+
+// Mailer sends the account emails of local accounts through an SMTP server
+type Mailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// MailerFromEnv creates the mailer configured by SMTP_ADDR (host:port) and SMTP_FROM, authenticated with SMTP_USERNAME
+// and SMTP_PASSWORD when set. It returns nil when no SMTP server is configured.
+func MailerFromEnv() *Mailer {
+	addr := os.Getenv("SMTP_ADDR")
+	if addr == "" {
+		return nil
+	}
+	m := &Mailer{addr: addr, from: os.Getenv("SMTP_FROM")}
+	if m.from == "" {
+		m.from = "cicd@localhost"
+	}
+	if username := os.Getenv("SMTP_USERNAME"); username != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		m.auth = smtp.PlainAuth("", username, os.Getenv("SMTP_PASSWORD"), host)
+	}
+	return m
+}
+
+// Send sends a plain text email
+func (m *Mailer) Send(to, subject, body string) error {
+	// Header values with line breaks would add headers of their own
+	if strings.ContainsAny(to+subject, "\r\n") {
+		return fmt.Errorf("invalid email header")
+	}
+	msg := "From: " + m.from + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n\r\n" +
+		strings.ReplaceAll(body, "\n", "\r\n")
+	if err := smtp.SendMail(m.addr, m.auth, m.from, []string{to}, []byte(msg)); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/events"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/netguard"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/store"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+)
+
+// Slack event selections of a project
+const (
+	SlackEventsFailed = "failed" // failed pipelines and deployments
+	SlackEventsAll    = "all"    // every finished pipeline and deployment
+	SlackEventsDeploy = "deploy" // finished deployments only
+)
+
+// ValidSlackEvents reports whether events is a known selection, empty meaning the default
+func ValidSlackEvents(events string) bool {
+	switch events {
+	case "", SlackEventsFailed, SlackEventsAll, SlackEventsDeploy:
+		return true
+	}
+	return false
+}
+
+// SlackNotifier posts finished pipelines and deployments to the Slack webhook of their project
+type SlackNotifier struct {
+	db          store.Store
+	frontendURL string
+	client      *http.Client
+}
+
+// NewSlackNotifier creates a notifier linking messages to pages of the frontend
+func NewSlackNotifier(db store.Store, frontendURL string) *SlackNotifier {
+	return &SlackNotifier{
+		db:          db,
+		frontendURL: strings.TrimRight(frontendURL, "/"),
+		client:      netguard.Client(10 * time.Second),
+	}
+}
+
+// Run notifies the events of the bus until the context is cancelled
+func (n *SlackNotifier) Run(ctx context.Context, bus *events.Bus) {
+	consume(ctx, bus, func(event events.Event) {
+		if err := n.notify(event); err != nil {
+			logger.Warn(fmt.Sprintf("Failed to notify Slack of %s %d: %v", event.Type, event.ID, err))
+		}
+	})
+}
+
+// notify posts an event to the project webhook when the project selected it
+func (n *SlackNotifier) notify(event events.Event) error {
+	if !slackFinished(event) {
+		return nil
+	}
+
+	ctx := context.Background()
+
+	project, err := n.db.GetProject(ctx, event.ProjectID)
+	if err != nil {
+		return err
+	}
+	if project.SlackWebhookURL == "" || !slackSelected(project.SlackEvents, event) {
+		return nil
+	}
+	pipeline, err := n.db.GetPipeline(ctx, event.PipelineID)
+	if err != nil {
+		return err
+	}
+
+	var message string
+	switch event.Type {
+	case events.TypePipeline:
+		message = n.pipelineMessage(project, pipeline)
+	case events.TypeDeployment:
+		deployment, err := n.db.GetDeploymentByPipeline(ctx, pipeline.ID)
+		if err != nil {
+			return err
+		}
+		message = n.deploymentMessage(project, pipeline, deployment)
+	}
+
+	return n.post(project.SlackWebhookURL, message, slackColor(event.Status))
+}
+
+func (n *SlackNotifier) pipelineMessage(project *models.Project, pipeline *models.Pipeline) string {
+	header := fmt.Sprintf("*%s* pipeline #%d %s", project.Name, pipeline.ID, slackOutcome(pipeline.Status))
+	duration := ""
+	if pipeline.FinishedAt != nil {
+		duration = pipeline.FinishedAt.Sub(pipeline.CreatedAt).Round(time.Second).String()
+	}
+	link := fmt.Sprintf("%s/projects/%d/pipelines/%d", n.frontendURL, project.ID, pipeline.ID)
+
+	lines := []string{header, slackDetails(pipeline, duration)}
+	if pipeline.FailureReason != "" {
+		lines = append(lines, "> "+pipeline.FailureReason)
+	}
+	lines = append(lines, fmt.Sprintf("<%s|View pipeline>", link))
+	return strings.Join(lines, "\n")
+}
+
+func (n *SlackNotifier) deploymentMessage(project *models.Project, pipeline *models.Pipeline, deployment *models.Deployment) string {
+	header := fmt.Sprintf("*%s* deployment of pipeline #%d %s", project.Name, pipeline.ID, slackOutcome(deployment.Status))
+	duration := ""
+	if deployment.StartedAt != nil && deployment.FinishedAt != nil {
+		duration = deployment.FinishedAt.Sub(*deployment.StartedAt).Round(time.Second).String()
+	}
+	link := fmt.Sprintf("%s/projects/%d/pipelines/%d", n.frontendURL, project.ID, pipeline.ID)
+
+	return strings.Join([]string{header, slackDetails(pipeline, duration), fmt.Sprintf("<%s|View deployment>", link)}, "\n")
+}
+
+// slackDetails formats the branch, commit and duration line of a message
+func slackDetails(pipeline *models.Pipeline, duration string) string {
+	commit := pipeline.CommitHash
+	if len(commit) > 8 {
+		commit = commit[:8]
+	}
+	details := fmt.Sprintf("Branch: `%s` · Commit: `%s`", pipeline.Branch, commit)
+	if duration != "" {
+		details += " · Duration: " + duration
+	}
+	return details
+}
+
+// post sends a message to an incoming webhook as a colored attachment
+func (n *SlackNotifier) post(webhookURL, message, color string) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"attachments": []map[string]string{
+			{"color": color, "text": message, "fallback": message},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := n.client.Post(webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Slack returned %s", resp.Status)
+	}
+	return nil
+}
+
+// slackFinished reports whether an event is the end of a pipeline or deployment
+func slackFinished(event events.Event) bool {
+	switch event.Type {
+	case events.TypePipeline:
+		return event.Status == "success" || event.Status == "failed" || event.Status == "cancelled"
+	case events.TypeDeployment:
+		return event.Status == "success" || event.Status == "failed" || event.Status == "rolled_back"
+	}
+	return false
+}
+
+// slackSelected reports whether a finished event matches the project selection
+func slackSelected(selection string, event events.Event) bool {
+	switch selection {
+	case SlackEventsAll:
+		return true
+	case SlackEventsDeploy:
+		return event.Type == events.TypeDeployment
+	default:
+		return event.Status == "failed" || event.Status == "rolled_back"
+	}
+}
+
+func slackOutcome(status string) string {
+	switch status {
+	case "success":
+		return "succeeded :white_check_mark:"
+	case "failed":
+		return "failed :x:"
+	case "rolled_back":
+		return "failed and was rolled back :leftwards_arrow_with_hook:"
+	case "cancelled":
+		return "was cancelled"
+	}
+	return status
+}
+
+func slackColor(status string) string {
+	switch status {
+	case "success":
+		return "good"
+	case "failed", "rolled_back":
+		return "danger"
+	}
+	return "warning"
+}
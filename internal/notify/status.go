@@ -0,0 +1,157 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/events"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/githubapp"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/store"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+)
+
+// statusContext prefixes the contexts under which statuses are reported
+const statusContext = "cicd"
+
+// commitStatus is the state of a pipeline or job reported on a commit
+type commitStatus struct {
+	// Status is the pipeline or job status, mapped to the states of each host
+	Status      string
+	Context     string
+	Description string
+	TargetURL   string
+}
+
+// StatusReporter reports pipeline and job statuses on the commits of the repository host
+type StatusReporter struct {
+	db          store.Store
+	app         *githubapp.App
+	frontendURL string
+	client      *http.Client
+}
+
+// NewStatusReporter creates a reporter linking statuses to pages of the frontend
+// Projects linked to an installation of app are reported with its installation tokens.
+func NewStatusReporter(db store.Store, app *githubapp.App, frontendURL string) *StatusReporter {
+	return &StatusReporter{
+		db:          db,
+		app:         app,
+		frontendURL: strings.TrimRight(frontendURL, "/"),
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Run reports the events of the bus until the context is cancelled
+// Events are handled one at a time so statuses reach the host in order.
+func (r *StatusReporter) Run(ctx context.Context, bus *events.Bus) {
+	consume(ctx, bus, func(event events.Event) {
+		if event.Type != events.TypePipeline && event.Type != events.TypeJob {
+			return
+		}
+		if err := r.report(event); err != nil {
+			logger.Warn(fmt.Sprintf("Failed to report %s %d status: %v", event.Type, event.ID, err))
+		}
+	})
+}
+
+// consume passes the events of the bus to handle, one at a time, until the context is cancelled
+// Events of other instances are skipped, their notifications being sent by the instance that published them.
+func consume(ctx context.Context, bus *events.Bus, handle func(events.Event)) {
+	eventsCh, unsubscribe := bus.Subscribe()
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-eventsCh:
+			if !ok {
+				return
+			}
+			if !event.Remote {
+				handle(event)
+			}
+		}
+	}
+}
+
+// report sends the status of an event to the host of the project repository
+func (r *StatusReporter) report(event events.Event) error {
+	description := statusDescription(event.Status)
+	if description == "" {
+		return nil
+	}
+
+	ctx := context.Background()
+	project, err := r.db.GetProject(ctx, event.ProjectID)
+	if err != nil {
+		return err
+	}
+	token, err := r.app.StatusToken(ctx, project)
+	if err != nil {
+		return err
+	}
+	if token == "" {
+		return nil
+	}
+	pipeline, err := r.db.GetPipeline(ctx, event.PipelineID)
+	if err != nil {
+		return err
+	}
+	if pipeline.CommitHash == "" {
+		return nil
+	}
+
+	status := commitStatus{
+		Status:      event.Status,
+		Context:     statusContext + "/pipeline",
+		Description: fmt.Sprintf("Pipeline #%d %s", pipeline.ID, description),
+		TargetURL:   fmt.Sprintf("%s/projects/%d/pipelines/%d", r.frontendURL, project.ID, pipeline.ID),
+	}
+	if event.Type == events.TypeJob {
+		job, err := r.db.GetJob(ctx, event.ID)
+		if err != nil {
+			return err
+		}
+		status.Context = statusContext + "/" + job.Name
+		status.Description = "Job " + job.Name + " " + description
+		status.TargetURL += fmt.Sprintf("/jobs/%d", job.ID)
+	}
+
+	return r.send(project, token, pipeline, status)
+}
+
+// send posts the status with the API of the repository host, ignoring hosts without support
+func (r *StatusReporter) send(project *models.Project, token string, pipeline *models.Pipeline, status commitStatus) error {
+	if repo, ok := githubapp.Repository(project.RepoURL); ok {
+		return r.postGitHubStatus(token, repo, pipeline.CommitHash, status)
+	}
+	if baseURL, repo, ok := gitLabRepository(project.RepoURL); ok {
+		return r.postGitLabStatus(baseURL, token, repo, pipeline.CommitHash, status)
+	}
+	return nil
+}
+
+// statusDescription describes a pipeline or job status, empty when the status is not reported
+func statusDescription(status string) string {
+	switch status {
+	case "pending", "queued":
+		return "is pending"
+	case "running":
+		return "is running"
+	case "manual":
+		return "is waiting for a manual action"
+	case "success":
+		return "passed"
+	case "failed":
+		return "failed"
+	case "cancelled":
+		return "was cancelled"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,240 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/events"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/netguard"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/store"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+)
+
+// Outbound webhook event names
+const (
+	EventPipelineStarted      = "pipeline.started"
+	EventPipelineFinished     = "pipeline.finished"
+	EventJobFailed            = "job.failed"
+	EventDeploymentSucceeded  = "deployment.succeeded"
+	EventDeploymentFailed     = "deployment.failed"
+	EventDeploymentRolledBack = "deployment.rolled_back"
+)
+
+// WebhookEvents lists the event names a webhook can subscribe to
+var WebhookEvents = []string{
+	EventPipelineStarted,
+	EventPipelineFinished,
+	EventJobFailed,
+	EventDeploymentSucceeded,
+	EventDeploymentFailed,
+	EventDeploymentRolledBack,
+}
+
+// signatureHeader carries the HMAC-SHA256 of the request body, keyed with the webhook secret
+const signatureHeader = "X-CICD-Signature"
+
+// webhookAttempts bounds the deliveries of an event to a webhook, retried on network errors, 429 and 5xx
+const webhookAttempts = 4
+
+// webhookBackoff is the wait before the first retry, doubled for each next one
+var webhookBackoff = time.Second
+
+// WebhookPayload is the JSON body posted to outbound webhooks
+type WebhookPayload struct {
+	Event      string    `json:"event"`
+	ProjectID  int       `json:"project_id"`
+	PipelineID int       `json:"pipeline_id"`
+	JobID      int       `json:"job_id,omitempty"`
+	JobName    string    `json:"job_name,omitempty"`
+	Status     string    `json:"status"`
+	Branch     string    `json:"branch,omitempty"`
+	CommitHash string    `json:"commit_hash,omitempty"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// WebhookDispatcher posts project events to their registered outbound webhooks
+type WebhookDispatcher struct {
+	db store.Store
+	// client only reaches public addresses, the webhook URLs being set by project maintainers
+	client *http.Client
+}
+
+// NewWebhookDispatcher creates a dispatcher reading the webhooks from the database
+func NewWebhookDispatcher(db store.Store) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		db:     db,
+		client: netguard.Client(10 * time.Second),
+	}
+}
+
+// Run delivers the events of the bus until the context is cancelled
+func (d *WebhookDispatcher) Run(ctx context.Context, bus *events.Bus) {
+	consume(ctx, bus, func(event events.Event) {
+		name := webhookEventName(event)
+		if name == "" {
+			return
+		}
+		if err := d.dispatch(name, event); err != nil {
+			logger.Warn(fmt.Sprintf("Failed to dispatch %s webhooks: %v", name, err))
+		}
+	})
+}
+
+// dispatch sends an event to every webhook of its project subscribed to it
+func (d *WebhookDispatcher) dispatch(name string, event events.Event) error {
+	ctx := context.Background()
+	webhooks, err := d.db.GetWebhooksByProject(ctx, event.ProjectID)
+	if err != nil || len(webhooks) == 0 {
+		return err
+	}
+
+	payload := WebhookPayload{
+		Event:      name,
+		ProjectID:  event.ProjectID,
+		PipelineID: event.PipelineID,
+		Status:     event.Status,
+		Timestamp:  event.Timestamp,
+	}
+	if pipeline, err := d.db.GetPipeline(ctx, event.PipelineID); err == nil {
+		payload.Branch = pipeline.Branch
+		payload.CommitHash = pipeline.CommitHash
+	}
+	if event.Type == events.TypeJob {
+		payload.JobID = event.ID
+		if job, err := d.db.GetJob(ctx, event.ID); err == nil {
+			payload.JobName = job.Name
+		}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	// Deliveries run concurrently so a slow endpoint does not hold back the others
+	for _, webhook := range webhooks {
+		if !subscribed(webhook, name) {
+			continue
+		}
+		go func(webhook models.Webhook) {
+			if err := d.deliverWithRetry(webhook, name, body); err != nil {
+				logger.Warn(fmt.Sprintf("Webhook %d delivery of %s failed: %v", webhook.ID, name, err))
+			}
+		}(webhook)
+	}
+	return nil
+}
+
+// deliverWithRetry delivers a payload up to webhookAttempts times, with an exponential backoff between them
+func (d *WebhookDispatcher) deliverWithRetry(webhook models.Webhook, name string, body []byte) error {
+	backoff := webhookBackoff
+	for attempt := 1; ; attempt++ {
+		err := d.deliver(webhook, name, body)
+		var status *statusError
+		retryable := err != nil && !errors.Is(err, netguard.ErrBlocked) &&
+			(!errors.As(err, &status) || status.code == http.StatusTooManyRequests || status.code >= 500)
+		if !retryable || attempt == webhookAttempts {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// statusError is a delivery answered with a non-2xx status
+type statusError struct {
+	code   int
+	status string
+}
+
+func (e *statusError) Error() string {
+	return "endpoint returned " + e.status
+}
+
+// deliver posts a payload to a webhook, signed when the webhook has a secret
+func (d *WebhookDispatcher) deliver(webhook models.Webhook, name string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-CICD-Event", name)
+	if webhook.Secret != "" {
+		req.Header.Set(signatureHeader, "sha256="+Sign(webhook.Secret, body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &statusError{code: resp.StatusCode, status: resp.Status}
+	}
+	return nil
+}
+
+// Sign returns the hex HMAC-SHA256 of body keyed with secret
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ValidWebhookEvent reports whether name is a known webhook event
+func ValidWebhookEvent(name string) bool {
+	for _, event := range WebhookEvents {
+		if event == name {
+			return true
+		}
+	}
+	return false
+}
+
+// subscribed reports whether a webhook receives an event, no events meaning all of them
+func subscribed(webhook models.Webhook, name string) bool {
+	if len(webhook.Events) == 0 {
+		return true
+	}
+	for _, event := range webhook.Events {
+		if event == name {
+			return true
+		}
+	}
+	return false
+}
+
+// webhookEventName maps a status event to its webhook event name, empty when it is not delivered
+func webhookEventName(event events.Event) string {
+	switch event.Type {
+	case events.TypePipeline:
+		switch event.Status {
+		case "running":
+			return EventPipelineStarted
+		case "success", "failed", "cancelled":
+			return EventPipelineFinished
+		}
+	case events.TypeJob:
+		if event.Status == "failed" {
+			return EventJobFailed
+		}
+	case events.TypeDeployment:
+		switch event.Status {
+		case "success":
+			return EventDeploymentSucceeded
+		case "failed":
+			return EventDeploymentFailed
+		case "rolled_back":
+			return EventDeploymentRolledBack
+		}
+	}
+	return ""
+}
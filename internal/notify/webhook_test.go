@@ -0,0 +1,57 @@
+package notify
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/netguard"
+)
+
+func TestWebhookDelivery(t *testing.T) {
+	defer func(backoff time.Duration) { webhookBackoff = backoff }(webhookBackoff)
+	webhookBackoff = 0
+
+	tests := []struct {
+		name     string
+		statuses []int
+		attempts int32
+		ok       bool
+	}{
+		{"Delivered", []int{http.StatusOK}, 1, true},
+		{"RetriedAfterServerError", []int{http.StatusBadGateway, http.StatusTooManyRequests, http.StatusNoContent}, 3, true},
+		{"ClientErrorNotRetried", []int{http.StatusNotFound}, 1, false},
+		{"AttemptsBounded", []int{500, 500, 500, 500, 500}, webhookAttempts, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.statuses[calls.Add(1)-1])
+			}))
+			defer server.Close()
+
+			d := &WebhookDispatcher{client: server.Client()}
+			err := d.deliverWithRetry(models.Webhook{URL: server.URL}, EventPipelineFinished, []byte("{}"))
+			if (err == nil) != tt.ok || calls.Load() != tt.attempts {
+				t.Errorf("Expected %d attempt(s) and success %v, got %d and %v", tt.attempts, tt.ok, calls.Load(), err)
+			}
+		})
+	}
+
+	t.Run("PrivateAddressBlocked", func(t *testing.T) {
+		var calls atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { calls.Add(1) }))
+		defer server.Close()
+
+		d := NewWebhookDispatcher(nil)
+		err := d.deliverWithRetry(models.Webhook{URL: server.URL}, EventPipelineFinished, []byte("{}"))
+		if !errors.Is(err, netguard.ErrBlocked) || calls.Load() != 0 {
+			t.Errorf("Expected the loopback endpoint to be blocked, got %d call(s) and %v", calls.Load(), err)
+		}
+	})
+}
@@ -9,9 +9,10 @@ import (
 )
 
 // ComposeConfig represents the partial structure of a docker-compose file
-// We only care about the keys under 'services'
+// We only care about the keys under 'services' and 'networks'
 type ComposeConfig struct {
 	Services map[string]interface{} `yaml:"services"`
+	Networks map[string]interface{} `yaml:"networks"`
 }
 
 // ParseServices reads a docker-compose file and returns the list of buildable service names
@@ -42,18 +43,14 @@ func ParseServices(path string) ([]string, error) {
 
 // GenerateOverride creates the YAML content for docker-compose.override.yml
 // It enforces standardized image names for all buildable services based on the project, registry and commit hash.
-// Format: registryUser/project-service:tag
-func GenerateOverride(services []string, registryUser, projectName, tag string) ([]byte, error) {
+// Format: namespace/project-service:tag, see ImageNamespace
+func GenerateOverride(services []string, namespace, projectName, tag string) ([]byte, error) {
 	serviceConfig := make(map[string]interface{})
 
-	cleanProject := strings.ToLower(strings.ReplaceAll(projectName, " ", "-"))
-
 	for _, service := range services {
-		cleanService := strings.ToLower(strings.ReplaceAll(service, " ", "-"))
-
 		// Construct standardized image name
 		// e.g. "myuser/myproject-backend:abc1234"
-		imageName := fmt.Sprintf("%s/%s-%s:%s", registryUser, cleanProject, cleanService, tag)
+		imageName := ImageName(namespace, projectName, service, tag)
 
 		// We only override the 'image' field
 		serviceConfig[service] = map[string]string{
@@ -68,6 +65,163 @@ func GenerateOverride(services []string, registryUser, projectName, tag string)
 	return yaml.Marshal(override)
 }
 
+// BuildCacheTag is the tag of the registry image holding the layer cache of a service
+const BuildCacheTag = "buildcache"
+
+// GenerateCacheOverride creates a compose override importing and exporting the BuildKit layer cache of buildable services
+// The cache is stored in the registry next to the service image, e.g. "myuser/myproject-backend:buildcache".
+func GenerateCacheOverride(services []string, namespace, projectName string) ([]byte, error) {
+	serviceConfig := make(map[string]interface{})
+
+	for _, service := range services {
+		cacheRef := fmt.Sprintf("%s:%s", imageRepository(namespace, projectName, service), BuildCacheTag)
+		serviceConfig[service] = map[string]interface{}{
+			"build": map[string][]string{
+				"cache_from": {"type=registry,ref=" + cacheRef},
+				"cache_to":   {"type=registry,ref=" + cacheRef + ",mode=max"},
+			},
+		}
+	}
+
+	override := map[string]interface{}{
+		"services": serviceConfig,
+	}
+
+	return yaml.Marshal(override)
+}
+
+// GeneratePlatformsOverride creates a compose override building buildable services for several platforms
+// e.g. linux/amd64 and linux/arm64, the pushed image being a manifest list holding one image per platform.
+func GeneratePlatformsOverride(services, platforms []string) ([]byte, error) {
+	serviceConfig := make(map[string]interface{})
+	for _, service := range services {
+		serviceConfig[service] = map[string]interface{}{
+			"build": map[string][]string{"platforms": platforms},
+		}
+	}
+
+	override := map[string]interface{}{
+		"services": serviceConfig,
+	}
+
+	return yaml.Marshal(override)
+}
+
+// GenerateTagsOverride creates a compose override tagging the images of buildable services with extra tags
+// e.g. "myuser/myproject-backend:latest" next to the commit hash tag of GenerateOverride.
+func GenerateTagsOverride(services []string, namespace, projectName string, tags []string) ([]byte, error) {
+	serviceConfig := make(map[string]interface{})
+	for _, service := range services {
+		var images []string
+		for _, tag := range tags {
+			images = append(images, ImageName(namespace, projectName, service, tag))
+		}
+		serviceConfig[service] = map[string]interface{}{
+			"build": map[string][]string{"tags": images},
+		}
+	}
+
+	override := map[string]interface{}{
+		"services": serviceConfig,
+	}
+
+	return yaml.Marshal(override)
+}
+
+// ImageName returns the standardized image name of a service, e.g. "myuser/myproject-backend:abc1234"
+func ImageName(namespace, projectName, service, tag string) string {
+	return fmt.Sprintf("%s:%s", imageRepository(namespace, projectName, service), tag)
+}
+
+// imageRepository returns the standardized image name of a service, without tag
+func imageRepository(namespace, projectName, service string) string {
+	cleanProject := strings.ToLower(strings.ReplaceAll(projectName, " ", "-"))
+	cleanService := strings.ToLower(strings.ReplaceAll(service, " ", "-"))
+	return fmt.Sprintf("%s/%s-%s", namespace, cleanProject, cleanService)
+}
+
+// ImageNamespace returns the prefix of the images of a project, the registry user on Docker Hub
+// Other registries prefix it with their host, e.g. "ghcr.io/myuser". A registry URL with a path,
+// like "registry.gitlab.com/group/project", is the prefix itself.
+func ImageNamespace(registryURL, registryUser string) string {
+	registryURL = strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(registryURL, "https://"), "http://"), "/")
+	switch {
+	case registryURL == "" || registryURL == "docker.io" || registryURL == "index.docker.io":
+		return registryUser
+	case strings.Contains(registryURL, "/"):
+		return registryURL
+	default:
+		return registryURL + "/" + registryUser
+	}
+}
+
+// ReplicatedServices returns the services of a docker-compose file running several replicas, with their replica count
+// The count is read from deploy.replicas, or from the legacy scale key.
+func ReplicatedServices(path string) (map[string]int, error) {
+	config, err := readConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	replicated := make(map[string]int)
+	for name, serviceBody := range config.Services {
+		serviceMap, ok := serviceBody.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		replicas, _ := serviceMap["scale"].(int)
+		if deploy, ok := serviceMap["deploy"].(map[string]interface{}); ok {
+			if n, ok := deploy["replicas"].(int); ok {
+				replicas = n
+			}
+		}
+		if replicas > 1 {
+			replicated[name] = replicas
+		}
+	}
+	return replicated, nil
+}
+
+// GenerateCanaryOverride creates a compose override attaching a canary project to the networks of the stable one
+// The canary replicas then share the networks, hence the service DNS names, of the stable replicas.
+func GenerateCanaryOverride(path, stableProject string) ([]byte, error) {
+	config, err := readConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	networks := map[string]interface{}{
+		"default": map[string]interface{}{"name": stableProject + "_default", "external": true},
+	}
+	for name, networkBody := range config.Networks {
+		networkMap, _ := networkBody.(map[string]interface{})
+		if external, _ := networkMap["external"].(bool); external {
+			continue
+		}
+		networkName, ok := networkMap["name"].(string)
+		if !ok {
+			networkName = stableProject + "_" + name
+		}
+		networks[name] = map[string]interface{}{"name": networkName, "external": true}
+	}
+
+	return yaml.Marshal(map[string]interface{}{"networks": networks})
+}
+
+// readConfig reads and parses a docker-compose file
+func readConfig(path string) (*ComposeConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read compose file: %w", err)
+	}
+
+	var config ComposeConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse compose file: %w", err)
+	}
+	return &config, nil
+}
+
 // GetContainerNames extracts all hardcoded 'container_name' values from a docker-compose file
 func GetContainerNames(path string) ([]string, error) {
 	data, err := os.ReadFile(path)
@@ -2,6 +2,7 @@ package compose
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 
 	"gopkg.in/yaml.v3"
@@ -96,6 +97,81 @@ func TestGenerateOverride(t *testing.T) {
 	}
 }
 
+func TestGenerateCacheOverride(t *testing.T) {
+	overrideBytes, err := GenerateCacheOverride([]string{"api"}, "testuser", "Test Project")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var override struct {
+		Services map[string]struct {
+			Build struct {
+				CacheFrom []string `yaml:"cache_from"`
+				CacheTo   []string `yaml:"cache_to"`
+			} `yaml:"build"`
+		} `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(overrideBytes, &override); err != nil {
+		t.Fatalf("Failed to parse generated override YAML: %v", err)
+	}
+
+	build := override.Services["api"].Build
+	expectedFrom := "type=registry,ref=testuser/test-project-api:buildcache"
+	if len(build.CacheFrom) != 1 || build.CacheFrom[0] != expectedFrom {
+		t.Errorf("Expected cache_from [%s], got %v", expectedFrom, build.CacheFrom)
+	}
+	expectedTo := expectedFrom + ",mode=max"
+	if len(build.CacheTo) != 1 || build.CacheTo[0] != expectedTo {
+		t.Errorf("Expected cache_to [%s], got %v", expectedTo, build.CacheTo)
+	}
+}
+
+func TestGeneratePlatformsOverride(t *testing.T) {
+	overrideBytes, err := GeneratePlatformsOverride([]string{"api"}, []string{"linux/amd64", "linux/arm64"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var override struct {
+		Services map[string]struct {
+			Build struct {
+				Platforms []string `yaml:"platforms"`
+			} `yaml:"build"`
+		} `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(overrideBytes, &override); err != nil {
+		t.Fatalf("Failed to parse generated override YAML: %v", err)
+	}
+
+	platforms := override.Services["api"].Build.Platforms
+	if len(platforms) != 2 || platforms[0] != "linux/amd64" || platforms[1] != "linux/arm64" {
+		t.Errorf("Expected platforms [linux/amd64 linux/arm64], got %v", platforms)
+	}
+}
+
+func TestGenerateTagsOverride(t *testing.T) {
+	overrideBytes, err := GenerateTagsOverride([]string{"api"}, "testuser", "Test Project", []string{"latest", "1.2.3"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var override struct {
+		Services map[string]struct {
+			Build struct {
+				Tags []string `yaml:"tags"`
+			} `yaml:"build"`
+		} `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(overrideBytes, &override); err != nil {
+		t.Fatalf("Failed to parse generated override YAML: %v", err)
+	}
+
+	tags := override.Services["api"].Build.Tags
+	if len(tags) != 2 || tags[0] != "testuser/test-project-api:latest" || tags[1] != "testuser/test-project-api:1.2.3" {
+		t.Errorf("Expected the latest and 1.2.3 images, got %v", tags)
+	}
+}
+
 func TestGetContainerNames(t *testing.T) {
 	content := `
 services:
@@ -141,3 +217,141 @@ services:
 		t.Errorf("Expected my-app and my-db, got %v", names)
 	}
 }
+
+func TestCanary(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "docker-compose.yml")
+	content := `
+services:
+  web:
+    build: .
+    deploy:
+      replicas: 3
+  worker:
+    build: ./worker
+    scale: 2
+  database:
+    image: postgres
+networks:
+  backend: {}
+  shared:
+    external: true
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write compose file: %v", err)
+	}
+
+	replicated, err := ReplicatedServices(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(replicated) != 2 || replicated["web"] != 3 || replicated["worker"] != 2 {
+		t.Errorf("Expected web and worker replicas, got %v", replicated)
+	}
+
+	override, err := GenerateCanaryOverride(path, "app")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	var parsed struct {
+		Networks map[string]struct {
+			Name     string `yaml:"name"`
+			External bool   `yaml:"external"`
+		} `yaml:"networks"`
+	}
+	if err := yaml.Unmarshal(override, &parsed); err != nil {
+		t.Fatalf("Failed to parse override: %v", err)
+	}
+	if parsed.Networks["default"].Name != "app_default" || parsed.Networks["backend"].Name != "app_backend" || !parsed.Networks["backend"].External {
+		t.Errorf("Expected the stable networks as external, got %+v", parsed.Networks)
+	}
+	if _, ok := parsed.Networks["shared"]; ok {
+		t.Error("Expected external networks to be left as is")
+	}
+}
+
+func TestImageNamespace(t *testing.T) {
+	tests := []struct {
+		registryURL string
+		expected    string
+	}{
+		{"", "testuser"},
+		{"docker.io", "testuser"},
+		{"ghcr.io", "ghcr.io/testuser"},
+		{"https://harbor.example.com/", "harbor.example.com/testuser"},
+		{"registry.gitlab.com/group/project", "registry.gitlab.com/group/project"},
+	}
+	for _, tt := range tests {
+		if got := ImageNamespace(tt.registryURL, "testuser"); got != tt.expected {
+			t.Errorf("Expected namespace '%s' for '%s', got '%s'", tt.expected, tt.registryURL, got)
+		}
+	}
+}
+
+func TestAddProxyLabels(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "docker-compose.yml")
+	content := `
+services:
+  web:
+    build: .
+    ports:
+      - "127.0.0.1:8080:3000/tcp"
+  database:
+    image: postgres
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write compose file: %v", err)
+	}
+	base, _ := GenerateOverride([]string{"web"}, "testuser", "app", "abc1234")
+
+	route := ProxyRoute{Provider: ProxyTraefik, Name: "app", Host: "app.example.com", Network: "traefik", EntryPoint: "websecure", TLS: true, CertResolver: "letsencrypt"}
+	overrideBytes, err := AddProxyLabels(base, path, route)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var override struct {
+		Services map[string]struct {
+			Image    string                 `yaml:"image"`
+			Labels   map[string]string      `yaml:"labels"`
+			Networks map[string]interface{} `yaml:"networks"`
+		} `yaml:"services"`
+		Networks map[string]struct {
+			Name     string `yaml:"name"`
+			External bool   `yaml:"external"`
+		} `yaml:"networks"`
+	}
+	if err := yaml.Unmarshal(overrideBytes, &override); err != nil {
+		t.Fatalf("Failed to parse override YAML: %v", err)
+	}
+	web := override.Services["web"]
+	if web.Image != "testuser/app-web:abc1234" {
+		t.Errorf("Expected the image override to be kept, got '%s'", web.Image)
+	}
+	if web.Labels["traefik.http.routers.app.rule"] != "Host(`app.example.com`)" || web.Labels["traefik.http.services.app.loadbalancer.server.port"] != "3000" {
+		t.Errorf("Expected the router and the container port, got %v", web.Labels)
+	}
+	if web.Labels["traefik.http.routers.app.tls.certresolver"] != "letsencrypt" {
+		t.Errorf("Expected the certificate resolver, got %v", web.Labels)
+	}
+	if _, ok := web.Networks["default"]; !ok || len(web.Networks) != 2 {
+		t.Errorf("Expected the service to join the proxy network and keep the default one, got %v", web.Networks)
+	}
+	if n := override.Networks[proxyNetworkKey]; n.Name != "traefik" || !n.External {
+		t.Errorf("Expected the external proxy network, got %+v", n)
+	}
+
+	caddy, err := AddProxyLabels(base, path, ProxyRoute{Provider: ProxyCaddy, Host: "app.example.com", Service: "database", Port: 5432, Network: "caddy"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := yaml.Unmarshal(caddy, &override); err != nil {
+		t.Fatalf("Failed to parse override YAML: %v", err)
+	}
+	if labels := override.Services["database"].Labels; labels["caddy"] != "http://app.example.com" || labels["caddy.reverse_proxy"] != "{{upstreams 5432}}" {
+		t.Errorf("Expected caddy labels for the database port, got %v", labels)
+	}
+
+	if _, err := AddProxyLabels(base, path, ProxyRoute{Provider: ProxyTraefik, Service: "database", Network: "traefik"}); err == nil {
+		t.Error("Expected an error for a service without port")
+	}
+}
@@ -0,0 +1,197 @@
+package compose
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Reverse proxies whose labels can be added to a deployment
+const (
+	ProxyTraefik = "traefik"
+	ProxyCaddy   = "caddy"
+)
+
+// proxyNetworkKey is the key of the proxy network in the override, its actual name is ProxyRoute.Network
+const proxyNetworkKey = "cicd-proxy"
+
+// ProxyRoute exposes a service of a deployment at a hostname, through the reverse proxy running on the host
+type ProxyRoute struct {
+	// Provider is ProxyTraefik or ProxyCaddy
+	Provider string
+	// Name identifies the Traefik router and service, e.g. the compose project name
+	Name string
+	Host string
+	// Service is the routed compose service, empty for the only service or the first one with a port
+	Service string
+	// Port is the container port of the service, 0 to read it from its expose or ports entries
+	Port int
+	// Network is the external network the proxy reaches the containers on
+	Network string
+	// EntryPoint is the Traefik entrypoint of the router
+	EntryPoint string
+	// TLS serves the hostname over HTTPS, with CertResolver issuing Traefik certificates when set
+	TLS          bool
+	CertResolver string
+}
+
+// URL returns the address the route serves its hostname at
+func (r ProxyRoute) URL() string {
+	if r.TLS {
+		return "https://" + r.Host
+	}
+	return "http://" + r.Host
+}
+
+// AddProxyLabels adds to a generated override the labels and network routing the route hostname to its service
+func AddProxyLabels(override []byte, composePath string, route ProxyRoute) ([]byte, error) {
+	config, err := readConfig(composePath)
+	if err != nil {
+		return nil, err
+	}
+	service, port, err := proxyTarget(config, route.Service, route.Port)
+	if err != nil {
+		return nil, err
+	}
+	labels, err := proxyLabels(route, port)
+	if err != nil {
+		return nil, err
+	}
+
+	var content map[string]interface{}
+	if err := yaml.Unmarshal(override, &content); err != nil {
+		return nil, fmt.Errorf("failed to parse override: %w", err)
+	}
+	if content == nil {
+		content = make(map[string]interface{})
+	}
+	services, _ := content["services"].(map[string]interface{})
+	if services == nil {
+		services = make(map[string]interface{})
+		content["services"] = services
+	}
+	serviceConfig, _ := services[service].(map[string]interface{})
+	if serviceConfig == nil {
+		serviceConfig = make(map[string]interface{})
+		services[service] = serviceConfig
+	}
+	serviceConfig["labels"] = labels
+
+	// Compose merges the networks of the override, a service without any would leave the default one
+	networks := map[string]interface{}{proxyNetworkKey: map[string]interface{}{}}
+	if body, _ := config.Services[service].(map[string]interface{}); body["networks"] == nil {
+		networks["default"] = map[string]interface{}{}
+	}
+	serviceConfig["networks"] = networks
+	content["networks"] = map[string]interface{}{
+		proxyNetworkKey: map[string]interface{}{"name": route.Network, "external": true},
+	}
+
+	return yaml.Marshal(content)
+}
+
+// proxyLabels returns the labels the provider reads to route the hostname to port
+func proxyLabels(route ProxyRoute, port int) (map[string]string, error) {
+	switch route.Provider {
+	case ProxyTraefik:
+		router := "traefik.http.routers." + route.Name
+		labels := map[string]string{
+			"traefik.enable":         "true",
+			"traefik.docker.network": route.Network,
+			router + ".rule":         fmt.Sprintf("Host(`%s`)", route.Host),
+			router + ".entrypoints":  route.EntryPoint,
+			router + ".service":      route.Name,
+			"traefik.http.services." + route.Name + ".loadbalancer.server.port": strconv.Itoa(port),
+		}
+		if route.TLS {
+			labels[router+".tls"] = "true"
+			if route.CertResolver != "" {
+				labels[router+".tls.certresolver"] = route.CertResolver
+			}
+		}
+		return labels, nil
+	case ProxyCaddy:
+		// caddy-docker-proxy provisions certificates itself, unless the site is plain http://
+		site := route.Host
+		if !route.TLS {
+			site = "http://" + site
+		}
+		return map[string]string{
+			"caddy":               site,
+			"caddy.reverse_proxy": fmt.Sprintf("{{upstreams %d}}", port),
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown reverse proxy %q", route.Provider)
+}
+
+// proxyTarget resolves the routed service and its container port
+func proxyTarget(config *ComposeConfig, service string, port int) (string, int, error) {
+	if service == "" {
+		names := make([]string, 0, len(config.Services))
+		for name := range config.Services {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if len(names) == 1 {
+			service = names[0]
+		}
+		for _, name := range names {
+			if service == "" && servicePort(config.Services[name]) != 0 {
+				service = name
+			}
+		}
+		if service == "" {
+			return "", 0, fmt.Errorf("no service exposes a port, set the proxied service")
+		}
+	}
+
+	body, ok := config.Services[service]
+	if !ok {
+		return "", 0, fmt.Errorf("service %s is not in the compose file", service)
+	}
+	if port == 0 {
+		port = servicePort(body)
+	}
+	if port == 0 {
+		return "", 0, fmt.Errorf("service %s exposes no port, set the proxied port", service)
+	}
+	return service, port, nil
+}
+
+// servicePort returns the first container port of a service from its expose or ports entries, 0 without any
+func servicePort(body interface{}) int {
+	serviceMap, _ := body.(map[string]interface{})
+	for _, key := range []string{"expose", "ports"} {
+		entries, _ := serviceMap[key].([]interface{})
+		for _, entry := range entries {
+			if port := containerPort(entry); port != 0 {
+				return port
+			}
+		}
+	}
+	return 0
+}
+
+// containerPort parses the container side of a port entry: 80, "8080:80", "127.0.0.1:8080:80/tcp" or {target: 80}
+func containerPort(entry interface{}) int {
+	switch v := entry.(type) {
+	case int:
+		return v
+	case map[string]interface{}:
+		target, _ := v["target"].(int)
+		return target
+	case string:
+		v = strings.SplitN(v, "/", 2)[0]
+		if i := strings.LastIndex(v, ":"); i >= 0 {
+			v = v[i+1:]
+		}
+		// A range maps its first port
+		v = strings.SplitN(v, "-", 2)[0]
+		port, _ := strconv.Atoi(v)
+		return port
+	}
+	return 0
+}
@@ -0,0 +1,53 @@
+package pipeline
+
+import "fmt"
+
+// EnvironmentTarget selects the project environment deployed to once the pipeline succeeds
+// The first target whose rules match is deployed to, a target without rules always matches
+type EnvironmentTarget struct {
+	Name  string `yaml:"name"`            // Nom de l'environnement du projet (ex: staging, production)
+	Rules []Rule `yaml:"rules,omitempty"` // Conditions sur la branche, le tag et les fichiers modifiés
+}
+
+// DeployEnvironment returns the environment the pipeline deploys to for a push
+// ok is false when the file declares no environments, the project settings then apply
+// An empty name with ok set means no target matched and nothing is deployed
+func (c *PipelineConfig) DeployEnvironment(ctx RuleContext) (name string, ok bool) {
+	if len(c.Environments) == 0 {
+		return "", false
+	}
+	for _, target := range c.Environments {
+		if len(target.Rules) == 0 {
+			return target.Name, true
+		}
+		for _, rule := range target.Rules {
+			if rule.matches(ctx) {
+				if rule.When == WhenNever {
+					break
+				}
+				return target.Name, true
+			}
+		}
+	}
+	return "", true
+}
+
+// validateEnvironments checks the environments block, environments being defined by the project
+func validateEnvironments(targets []EnvironmentTarget) error {
+	seen := make(map[string]bool, len(targets))
+	for _, target := range targets {
+		if target.Name == "" {
+			return &ParseError{Field: "environments", Message: "environnement sans name"}
+		}
+		if seen[target.Name] {
+			return &ParseError{Field: "environments", Message: fmt.Sprintf("environnement %q déclaré deux fois", target.Name)}
+		}
+		seen[target.Name] = true
+		for _, rule := range target.Rules {
+			if rule.When != "" && rule.When != WhenOnSuccess && rule.When != WhenNever {
+				return &ParseError{Field: "environments", Message: fmt.Sprintf("when invalide %q (on_success ou never)", rule.When)}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ParseError describes an invalid pipeline file, located as precisely as possible
+// Line and Column refer to the file defining the job, which may be an included file
+type ParseError struct {
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	Job     string `json:"job,omitempty"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e *ParseError) Error() string {
+	var b strings.Builder
+	if e.File != "" {
+		b.WriteString(e.File)
+	}
+	if e.Line > 0 {
+		if b.Len() > 0 {
+			b.WriteString(":")
+		}
+		fmt.Fprintf(&b, "ligne %d", e.Line)
+		if e.Column > 0 {
+			fmt.Fprintf(&b, ", colonne %d", e.Column)
+		}
+	}
+	if e.Job != "" {
+		if b.Len() > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "job %s", e.Job)
+		if e.Field != "" {
+			fmt.Fprintf(&b, ", champ %s", e.Field)
+		}
+	} else if e.Field != "" {
+		if b.Len() > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "champ %s", e.Field)
+	}
+	if b.Len() > 0 {
+		b.WriteString(" : ")
+	}
+	b.WriteString(e.Message)
+	return b.String()
+}
+
+// yamlErrorLine matches the line prefix of yaml.v3 error messages
+var yamlErrorLine = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// syntaxError converts a yaml.v3 error into a ParseError of the given file
+func syntaxError(file string, err error) *ParseError {
+	line, message := splitYAMLError(err.Error())
+	return &ParseError{File: file, Line: line, Message: message}
+}
+
+// decodeError converts a yaml.v3 decoding error into a ParseError pointing at the job and field at fault
+func decodeError(root *yaml.Node, err error) *ParseError {
+	message := err.Error()
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) && len(typeErr.Errors) > 0 {
+		message = typeErr.Errors[0]
+	}
+
+	line, message := splitYAMLError(message)
+	parseErr := &ParseError{Line: line, Message: message}
+	if line > 0 {
+		parseErr.Job, parseErr.Field = locateLine(root, line)
+	}
+	return parseErr
+}
+
+// splitYAMLError extracts the line number of a yaml.v3 error message
+func splitYAMLError(message string) (int, string) {
+	m := yamlErrorLine.FindStringSubmatch(strings.TrimPrefix(message, "yaml: unmarshal errors:\n  "))
+	if m == nil {
+		return 0, strings.TrimPrefix(message, "yaml: ")
+	}
+	line, _ := strconv.Atoi(m[1])
+	return line, m[2]
+}
+
+// locate fills the position of an error from its job and field
+func locate(root *yaml.Node, parseErr *ParseError) {
+	if parseErr.Line > 0 || parseErr.Job == "" {
+		return
+	}
+	jobKey, jobValue := mappingEntry(root, parseErr.Job)
+	if jobKey == nil {
+		return
+	}
+	parseErr.Line, parseErr.Column = jobKey.Line, jobKey.Column
+	if parseErr.Field == "" || jobValue.Kind != yaml.MappingNode {
+		return
+	}
+	if fieldKey, _ := mappingEntry(jobValue, parseErr.Field); fieldKey != nil {
+		parseErr.Line, parseErr.Column = fieldKey.Line, fieldKey.Column
+	}
+}
+
+// locateLine returns the job and field defined at a line of the top-level mapping
+func locateLine(root *yaml.Node, line int) (string, string) {
+	job, jobValue := entryAtLine(root, line)
+	if job == "" || reservedKeys[job] || jobValue.Kind != yaml.MappingNode {
+		return job, ""
+	}
+	field, _ := entryAtLine(jobValue, line)
+	return job, field
+}
+
+// entryAtLine returns the key of a mapping whose entry spans the given line
+func entryAtLine(mapping *yaml.Node, line int) (string, *yaml.Node) {
+	var key string
+	var value *yaml.Node
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Line > line {
+			break
+		}
+		key, value = mapping.Content[i].Value, mapping.Content[i+1]
+	}
+	return key, value
+}
+
+// mappingEntry returns the key and value nodes of a mapping entry, nil if absent
+func mappingEntry(mapping *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i], mapping.Content[i+1]
+		}
+	}
+	return nil, nil
+}
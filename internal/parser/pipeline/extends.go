@@ -0,0 +1,135 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// reservedKeys are the top-level keys that are not jobs
+var reservedKeys = map[string]bool{
+	"stages":       true,
+	"variables":    true,
+	"include":      true,
+	"environments": true,
+}
+
+// isHiddenJob reports whether a job is a template, never run on its own
+func isHiddenJob(name string) bool {
+	return strings.HasPrefix(name, ".")
+}
+
+// resolveExtends applies the extends: keyword of every job and drops hidden jobs
+// The configuration of the extended jobs is deep merged under the job's own keys, in order
+func resolveExtends(root *yaml.Node) error {
+	jobs := make(map[string]*yaml.Node)
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		name := root.Content[i].Value
+		if !reservedKeys[name] && root.Content[i+1].Kind == yaml.MappingNode {
+			jobs[name] = root.Content[i+1]
+		}
+	}
+
+	resolved := make(map[string]*yaml.Node)
+	resolving := make(map[string]bool)
+	var resolve func(name string) (*yaml.Node, error)
+	resolve = func(name string) (*yaml.Node, error) {
+		if node, ok := resolved[name]; ok {
+			return node, nil
+		}
+		job := jobs[name]
+		if resolving[name] {
+			return nil, &ParseError{Job: name, Field: "extends", Message: "extends circulaire"}
+		}
+		resolving[name] = true
+		defer delete(resolving, name)
+
+		own := copyNode(job)
+		extendsNode := removeKey(own, "extends")
+		if extendsNode == nil {
+			resolved[name] = own
+			return own, nil
+		}
+
+		var parents []string
+		if extendsNode.Kind == yaml.SequenceNode {
+			if err := extendsNode.Decode(&parents); err != nil {
+				return nil, &ParseError{Job: name, Field: "extends", Message: "extends invalide : " + err.Error()}
+			}
+		} else {
+			parents = []string{extendsNode.Value}
+		}
+
+		merged := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		for _, parent := range parents {
+			if _, ok := jobs[parent]; !ok {
+				return nil, &ParseError{Job: name, Field: "extends", Message: fmt.Sprintf("extends référence un job inconnu %q", parent)}
+			}
+			base, err := resolve(parent)
+			if err != nil {
+				return nil, err
+			}
+			deepMerge(merged, copyNode(base))
+		}
+		deepMerge(merged, own)
+
+		resolved[name] = merged
+		return merged, nil
+	}
+
+	content := make([]*yaml.Node, 0, len(root.Content))
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		if _, ok := jobs[key.Value]; ok {
+			node, err := resolve(key.Value)
+			if err != nil {
+				return err
+			}
+			value = node
+		}
+		if isHiddenJob(key.Value) {
+			continue
+		}
+		content = append(content, key, value)
+	}
+	root.Content = content
+
+	return nil
+}
+
+// deepMerge copies src into dst, merging nested mappings and replacing every other value
+func deepMerge(dst, src *yaml.Node) {
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+		merged := false
+		for j := 0; j+1 < len(dst.Content); j += 2 {
+			if dst.Content[j].Value != key.Value {
+				continue
+			}
+			if dst.Content[j+1].Kind == yaml.MappingNode && value.Kind == yaml.MappingNode {
+				deepMerge(dst.Content[j+1], value)
+			} else {
+				dst.Content[j+1] = value
+			}
+			merged = true
+			break
+		}
+		if !merged {
+			dst.Content = append(dst.Content, key, value)
+		}
+	}
+}
+
+// copyNode returns a deep copy of a YAML node
+func copyNode(node *yaml.Node) *yaml.Node {
+	if node == nil {
+		return nil
+	}
+	c := *node
+	c.Content = make([]*yaml.Node, len(node.Content))
+	for i, child := range node.Content {
+		c.Content[i] = copyNode(child)
+	}
+	return &c
+}
@@ -0,0 +1,224 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/netguard"
+)
+
+// maxIncludeDepth bounds nested includes
+const maxIncludeDepth = 10
+
+// maxRemoteIncludeSize bounds the size of a remote included file
+const maxRemoteIncludeSize = 1 << 20
+
+// remoteIncludeClient only reaches public addresses, remote includes being fetched on the server
+var remoteIncludeClient = netguard.Client(10 * time.Second)
+
+// includeEntry is one element of the include: list
+type includeEntry struct {
+	Local  string `yaml:"local"`
+	Remote string `yaml:"remote"`
+}
+
+// UnmarshalYAML accepts both the short form (a path or URL) and the local:/remote: form
+func (i *includeEntry) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		if strings.HasPrefix(value.Value, "http://") || strings.HasPrefix(value.Value, "https://") {
+			i.Remote = value.Value
+		} else {
+			i.Local = value.Value
+		}
+		return nil
+	}
+	type plain includeEntry
+	return value.Decode((*plain)(i))
+}
+
+// loadDocument decodes a YAML document and merges its includes, the document's own keys winning over included ones
+// source identifies the document to detect include cycles
+func (p *Parser) loadDocument(data []byte, source string, depth int, loading map[string]bool) (*yaml.Node, error) {
+	if depth > maxIncludeDepth {
+		return nil, &ParseError{File: source, Field: "include", Message: fmt.Sprintf("trop d'includes imbriqués (max %d)", maxIncludeDepth)}
+	}
+	if loading[source] {
+		return nil, &ParseError{File: source, Field: "include", Message: "include circulaire"}
+	}
+	loading[source] = true
+	defer delete(loading, source)
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, syntaxError(source, err)
+	}
+
+	root := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	if len(doc.Content) > 0 {
+		root = doc.Content[0]
+	}
+	if root.Kind != yaml.MappingNode {
+		return nil, &ParseError{File: source, Line: root.Line, Message: "le fichier doit contenir un dictionnaire"}
+	}
+
+	includeNode := removeKey(root, "include")
+	if includeNode == nil {
+		return root, nil
+	}
+
+	var entries []includeEntry
+	if includeNode.Kind == yaml.SequenceNode {
+		err := includeNode.Decode(&entries)
+		if err != nil {
+			return nil, &ParseError{File: source, Line: includeNode.Line, Field: "include", Message: "include invalide : " + err.Error()}
+		}
+	} else {
+		var entry includeEntry
+		if err := includeNode.Decode(&entry); err != nil {
+			return nil, &ParseError{File: source, Line: includeNode.Line, Field: "include", Message: "include invalide : " + err.Error()}
+		}
+		entries = append(entries, entry)
+	}
+
+	merged := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, entry := range entries {
+		includedData, includedSource, err := p.readInclude(entry)
+		if err != nil {
+			return nil, &ParseError{File: source, Line: includeNode.Line, Field: "include", Message: err.Error()}
+		}
+		included, err := p.loadDocument(includedData, includedSource, depth+1, loading)
+		if err != nil {
+			return nil, err
+		}
+		mergeMappings(merged, included)
+	}
+	mergeMappings(merged, root)
+
+	return merged, nil
+}
+
+// readInclude fetches the content of an included file
+// Local paths are relative to the repository root and may not leave it, symlinks included
+// Remote includes must be https URLs of a public host, one of RemoteHosts when set
+func (p *Parser) readInclude(entry includeEntry) ([]byte, string, error) {
+	switch {
+	case entry.Local != "":
+		name := strings.TrimPrefix(filepath.Clean("/"+entry.Local), "/")
+		data, err := p.readRepoFile(filepath.Join(p.rootDir(), name))
+		if err != nil {
+			return nil, "", fmt.Errorf("impossible de lire l'include %s : %w", entry.Local, err)
+		}
+		return data, name, nil
+
+	case entry.Remote != "":
+		if err := p.checkRemoteInclude(entry.Remote); err != nil {
+			return nil, "", fmt.Errorf("include %s refusé : %w", entry.Remote, err)
+		}
+		client := *remoteIncludeClient
+		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("trop de redirections")
+			}
+			return p.checkRemoteInclude(req.URL.String())
+		}
+		resp, err := client.Get(entry.Remote)
+		if err != nil {
+			return nil, "", fmt.Errorf("impossible de télécharger l'include %s : %w", entry.Remote, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, "", fmt.Errorf("impossible de télécharger l'include %s : statut %d", entry.Remote, resp.StatusCode)
+		}
+		data, err := io.ReadAll(io.LimitReader(resp.Body, maxRemoteIncludeSize))
+		if err != nil {
+			return nil, "", fmt.Errorf("impossible de télécharger l'include %s : %w", entry.Remote, err)
+		}
+		return data, entry.Remote, nil
+
+	default:
+		return nil, "", fmt.Errorf("include vide")
+	}
+}
+
+// readRepoFile reads a file of the repository, refusing symlinks resolving outside of it
+func (p *Parser) readRepoFile(path string) ([]byte, error) {
+	root, err := filepath.EvalSymlinks(p.rootDir())
+	if err != nil {
+		return nil, err
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, err
+	}
+	if rel, err := filepath.Rel(root, resolved); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, errors.New("le fichier pointe hors du dépôt")
+	}
+	return os.ReadFile(resolved)
+}
+
+// checkRemoteInclude checks the scheme and host of a remote include URL, the address being checked when dialing
+func (p *Parser) checkRemoteInclude(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "https" {
+		return errors.New("seules les URL https sont acceptées")
+	}
+	if len(p.RemoteHosts) == 0 {
+		return nil
+	}
+	for _, host := range p.RemoteHosts {
+		if strings.EqualFold(host, u.Hostname()) {
+			return nil
+		}
+	}
+	return fmt.Errorf("l'hôte %s n'est pas autorisé", u.Hostname())
+}
+
+// rootDir returns the repository root local includes are resolved against
+func (p *Parser) rootDir() string {
+	if p.RootDir != "" {
+		return p.RootDir
+	}
+	return filepath.Dir(p.FilePath)
+}
+
+// removeKey deletes a key from a mapping node and returns its value, nil if absent
+func removeKey(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			value := mapping.Content[i+1]
+			mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+			return value
+		}
+	}
+	return nil
+}
+
+// mergeMappings copies the keys of src into dst, replacing the values of keys already present
+func mergeMappings(dst, src *yaml.Node) {
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+		replaced := false
+		for j := 0; j+1 < len(dst.Content); j += 2 {
+			if dst.Content[j].Value == key.Value {
+				dst.Content[j+1] = value
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			dst.Content = append(dst.Content, key, value)
+		}
+	}
+}
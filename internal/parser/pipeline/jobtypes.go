@@ -0,0 +1,59 @@
+package pipeline
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// JobTypeValidator checks the properties of a job of its type once the pipeline file is decoded
+// It may complete the job in jobs, all the jobs of the file being there. Errors other than a ParseError are
+// reported on the properties of the job.
+type JobTypeValidator func(name string, jobs map[string]JobConfig) error
+
+// jobTypes holds the validators of the job types a pipeline file may use, by type
+// The parser knows no type by itself: the handlers of the executor register theirs.
+var jobTypes = struct {
+	sync.RWMutex
+	validators map[string]JobTypeValidator
+}{validators: make(map[string]JobTypeValidator)}
+
+// RegisterJobType makes a job type usable by pipeline files, validate being nil for a type without checks
+// Registering a type again replaces its validator.
+func RegisterJobType(name string, validate JobTypeValidator) {
+	jobTypes.Lock()
+	defer jobTypes.Unlock()
+	jobTypes.validators[name] = validate
+}
+
+// validateJobTypes rejects the jobs of unknown types and runs the validator of the type of the other typed jobs
+func validateJobTypes(jobs map[string]JobConfig) error {
+	names := make([]string, 0, len(jobs))
+	for name := range jobs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	jobTypes.RLock()
+	defer jobTypes.RUnlock()
+	for _, name := range names {
+		job := jobs[name]
+		if job.Type == "" || job.Type == JobTypeShell {
+			continue
+		}
+		validate, ok := jobTypes.validators[job.Type]
+		if !ok {
+			return &ParseError{Job: name, Field: "type", Message: fmt.Sprintf("type de job inconnu %q", job.Type)}
+		}
+		if validate == nil {
+			continue
+		}
+		if err := validate(name, jobs); err != nil {
+			if _, ok := err.(*ParseError); ok {
+				return err
+			}
+			return &ParseError{Job: name, Field: "properties", Message: err.Error()}
+		}
+	}
+	return nil
+}
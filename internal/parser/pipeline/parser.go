@@ -2,26 +2,156 @@ package pipeline
 
 import (
 	"fmt"
-	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 type PipelineConfig struct {
-	Stages []string             `yaml:"stages"`
-	Jobs   map[string]JobConfig `yaml:",inline"`
+	Stages       []string             `yaml:"stages"`
+	Variables    map[string]string    `yaml:"variables,omitempty"`    // Variables communes à tous les jobs
+	Environments []EnvironmentTarget  `yaml:"environments,omitempty"` // Cibles de déploiement, la première qui correspond est déployée
+	Jobs         map[string]JobConfig `yaml:",inline"`
 }
 
 type JobConfig struct {
-	Stage      string            `yaml:"stage"`
-	Image      string            `yaml:"image"`
-	Script     []string          `yaml:"script"`
-	Type       string            `yaml:"type,omitempty"`       // shell (default), docker-deploy, docker-compose-deploy
-	Properties map[string]string `yaml:"properties,omitempty"` // Params spécifiques au type de job
+	Stage        string            `yaml:"stage"`
+	Image        string            `yaml:"image"`
+	Script       []string          `yaml:"script"`
+	BeforeScript []string          `yaml:"before_script,omitempty"` // Exécuté avant script, utile dans les templates
+	Type         string            `yaml:"type,omitempty"`          // shell (défaut) ou un type enregistré avec RegisterJobType
+	Properties   map[string]string `yaml:"properties,omitempty"`    // Params spécifiques au type de job
+	Timeout      string            `yaml:"timeout,omitempty"`       // Durée maximale du job (ex: 15m, 1h30m)
+	Needs        []string          `yaml:"needs,omitempty"`         // Jobs à attendre, sans tenir compte des stages
+	Cache        *CacheConfig      `yaml:"cache,omitempty"`         // Dossiers conservés d'un pipeline à l'autre
+	Variables    map[string]string `yaml:"variables,omitempty"`     // Surcharge les variables globales du fichier
+	When         string            `yaml:"when,omitempty"`          // on_success (défaut), on_failure, always ou manual
+	Rules        []Rule            `yaml:"rules,omitempty"`         // Conditions d'exécution selon la branche, le tag et les fichiers modifiés
+	Dind         bool              `yaml:"dind,omitempty"`          // Donne accès à Docker (docker build, docker compose) dans le job
+	Network      string            `yaml:"network,omitempty"`       // pipeline (défaut), none, bridge ou host
+	Services     []ServiceConfig   `yaml:"services,omitempty"`      // Conteneurs annexes (base de données, cache...) joignables par leur alias
+	Privileged   bool              `yaml:"privileged,omitempty"`    // Conteneur privilégié, si le projet l'autorise
+	SSH          string            `yaml:"ssh,omitempty"`           // Machine de SSH_EXECUTORS exécutant le job au lieu du moteur
+	Debug        string            `yaml:"debug,omitempty"`         // Durée pendant laquelle le conteneur d'un job échoué reste ouvert au débogage (ex: 10m)
+	Workdir      string            `yaml:"workdir,omitempty"`       // Dossier de travail du script, relatif au workspace ou absolu
+	Entrypoint   []string          `yaml:"entrypoint,omitempty"`    // Remplace le point d'entrée de l'image, [""] le supprime
+}
+
+// CacheConfig declares directories saved after a successful job and restored in later pipelines of the project
+type CacheConfig struct {
+	Key   string   `yaml:"key"`   // Les jobs partageant une clé partagent le cache (défaut: default)
+	Paths []string `yaml:"paths"` // Relatifs au workspace, absolus ou ~/...
+}
+
+// ServiceConfig is a sidecar container started on the pipeline network for the duration of a job
+type ServiceConfig struct {
+	Image     string            `yaml:"image"`
+	Alias     string            `yaml:"alias,omitempty"`     // Nom d'hôte du service (défaut: nom de l'image sans tag)
+	Command   []string          `yaml:"command,omitempty"`   // Remplace la commande de l'image
+	Variables map[string]string `yaml:"variables,omitempty"` // Ajoutées aux variables du job
+}
+
+// UnmarshalYAML accepts both the short form (an image) and the image:/alias: form
+func (s *ServiceConfig) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		s.Image = value.Value
+		return nil
+	}
+	type plain ServiceConfig
+	return value.Decode((*plain)(s))
+}
+
+// Hostname returns the name the job reaches the service at, its alias or the name of its image without registry nor tag
+func (s ServiceConfig) Hostname() string {
+	if s.Alias != "" {
+		return s.Alias
+	}
+	name, _, _ := strings.Cut(s.Image, "@")
+	name = name[strings.LastIndex(name, "/")+1:]
+	name, _, _ = strings.Cut(name, ":")
+	return name
+}
+
+// Values of the when field of a job
+// on_failure jobs run only once a job of the pipeline failed, always jobs whatever the result of the previous jobs.
+const (
+	WhenOnSuccess = "on_success"
+	WhenManual    = "manual"
+	WhenOnFailure = "on_failure"
+	WhenAlways    = "always"
+)
+
+// validWhen reports whether when is a valid when value of a job
+func validWhen(when string) bool {
+	switch when {
+	case "", WhenOnSuccess, WhenManual, WhenOnFailure, WhenAlways:
+		return true
+	}
+	return false
+}
+
+// JobTypeShell runs the script of the job, like a job without type
+const JobTypeShell = "shell"
+
+// Values of the network field of a job
+const (
+	NetworkNone   = "none"
+	NetworkBridge = "bridge"
+	NetworkHost   = "host"
+	// NetworkPipeline is a network shared by the jobs and services of a pipeline run, the default of jobs run in Docker
+	NetworkPipeline = "pipeline"
+)
+
+// WorkingDir returns the directory the script of a job runs in, its workdir resolved against the workspace
+func (j JobConfig) WorkingDir(workspace string) string {
+	if filepath.IsAbs(j.Workdir) {
+		return filepath.Clean(j.Workdir)
+	}
+	return filepath.Join(workspace, j.Workdir)
+}
+
+// TimeoutDuration returns the parsed job timeout, 0 when none is set
+func (j JobConfig) TimeoutDuration() (time.Duration, error) {
+	if j.Timeout == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(j.Timeout)
+	if err != nil {
+		return 0, fmt.Errorf("timeout invalide %q : %w", j.Timeout, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("timeout invalide %q : doit être positif", j.Timeout)
+	}
+	return d, nil
+}
+
+// MaxDebugDuration bounds how long a failed job container is kept for debugging
+const MaxDebugDuration = time.Hour
+
+// DebugDuration returns the parsed debug window of the job, 0 when failed jobs are not kept for debugging
+func (j JobConfig) DebugDuration() (time.Duration, error) {
+	if j.Debug == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(j.Debug)
+	if err != nil {
+		return 0, fmt.Errorf("debug invalide %q : %w", j.Debug, err)
+	}
+	if d <= 0 || d > MaxDebugDuration {
+		return 0, fmt.Errorf("debug invalide %q : doit être positif et au plus %s", j.Debug, MaxDebugDuration)
+	}
+	return d, nil
 }
 
 type Parser struct {
 	FilePath string
+	// RootDir is the repository root local includes are resolved against, the directory of FilePath by default
+	RootDir string
+	// RemoteHosts are the hosts remote includes may be fetched from, any public host when empty
+	RemoteHosts []string
 }
 
 func NewParser(filePath string) *Parser {
@@ -29,16 +159,161 @@ func NewParser(filePath string) *Parser {
 }
 
 func (p *Parser) Parse() (*PipelineConfig, error) {
-	data, err := os.ReadFile(p.FilePath)
+	data, err := p.readRepoFile(p.FilePath)
 	if err != nil {
 		return nil, fmt.Errorf("impossible de lire le fichier : %w", err)
 	}
 
+	// Included files are merged before decoding
+	source := filepath.Base(p.FilePath)
+	if rel, err := filepath.Rel(p.rootDir(), p.FilePath); err == nil {
+		source = rel
+	}
+	root, err := p.loadDocument(data, source, 0, make(map[string]bool))
+	if err != nil {
+		return nil, err
+	}
+
+	// Templates are applied once every file is merged
+	if err := resolveExtends(root); err != nil {
+		return nil, withPosition(root, err)
+	}
+
 	var config PipelineConfig
-	err = yaml.Unmarshal(data, &config)
+	err = root.Decode(&config)
 	if err != nil {
-		return nil, fmt.Errorf("erreur lors du décodage YAML : %w", err)
+		return nil, decodeError(root, err)
+	}
+
+	for name, job := range config.Jobs {
+		if _, err := job.TimeoutDuration(); err != nil {
+			return nil, withPosition(root, &ParseError{Job: name, Field: "timeout", Message: err.Error()})
+		}
+		if _, err := job.DebugDuration(); err != nil {
+			return nil, withPosition(root, &ParseError{Job: name, Field: "debug", Message: err.Error()})
+		}
+		if !validWhen(job.When) {
+			return nil, withPosition(root, &ParseError{Job: name, Field: "when", Message: fmt.Sprintf("when invalide %q", job.When)})
+		}
+		switch job.Network {
+		case "", NetworkNone, NetworkBridge, NetworkHost, NetworkPipeline:
+		default:
+			return nil, withPosition(root, &ParseError{Job: name, Field: "network", Message: fmt.Sprintf("network invalide %q", job.Network)})
+		}
+		if err := validateServices(job); err != nil {
+			return nil, withPosition(root, &ParseError{Job: name, Field: "services", Message: err.Error()})
+		}
+		for _, rule := range job.Rules {
+			if !validWhen(rule.When) && rule.When != WhenNever {
+				return nil, withPosition(root, &ParseError{Job: name, Field: "rules", Message: fmt.Sprintf("when invalide %q", rule.When)})
+			}
+		}
+	}
+	if err := validateJobTypes(config.Jobs); err != nil {
+		return nil, withPosition(root, err)
+	}
+	if err := validateNeeds(config.Jobs); err != nil {
+		return nil, withPosition(root, err)
+	}
+	if err := validateEnvironments(config.Environments); err != nil {
+		// The block holds no job, so it is located on its key
+		if key, _ := mappingEntry(root, "environments"); key != nil {
+			if parseErr, ok := err.(*ParseError); ok {
+				parseErr.Line = key.Line
+			}
+		}
+		return nil, err
 	}
 
 	return &config, nil
-}
\ No newline at end of file
+}
+
+// serviceHostname matches the aliases services can be reached at
+var serviceHostname = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// validateServices checks the services of a job, which need the pipeline network and distinct hostnames
+func validateServices(job JobConfig) error {
+	if len(job.Services) == 0 {
+		return nil
+	}
+	if job.Network != "" && job.Network != NetworkPipeline {
+		return fmt.Errorf("les services nécessitent le réseau pipeline, pas %q", job.Network)
+	}
+	hostnames := make(map[string]bool)
+	for _, service := range job.Services {
+		if service.Image == "" {
+			return fmt.Errorf("image manquante pour un service")
+		}
+		hostname := service.Hostname()
+		if !serviceHostname.MatchString(hostname) {
+			return fmt.Errorf("alias de service invalide %q", hostname)
+		}
+		if hostnames[hostname] {
+			return fmt.Errorf("alias de service en double %q", hostname)
+		}
+		hostnames[hostname] = true
+	}
+	return nil
+}
+
+// withPosition locates a ParseError raised after decoding in the merged file
+func withPosition(root *yaml.Node, err error) error {
+	if parseErr, ok := err.(*ParseError); ok {
+		locate(root, parseErr)
+	}
+	return err
+}
+
+// validateNeeds checks that needs reference existing jobs and do not form a cycle
+func validateNeeds(jobs map[string]JobConfig) error {
+	for name, job := range jobs {
+		for _, need := range job.Needs {
+			if _, ok := jobs[need]; !ok {
+				return &ParseError{Job: name, Field: "needs", Message: fmt.Sprintf("needs référence un job inconnu %q", need)}
+			}
+		}
+	}
+
+	// Depth-first search, a job met again while still being visited closes a cycle
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int, len(jobs))
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			return &ParseError{Job: name, Field: "needs", Message: "dépendance circulaire dans needs"}
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		for _, need := range jobs[name].Needs {
+			if err := visit(need); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		return nil
+	}
+	for name := range jobs {
+		if err := visit(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var variableReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// Interpolate expands the ${VAR} references of s with vars
+// Unknown references are left untouched so the job shell can still resolve them
+func Interpolate(s string, vars map[string]string) string {
+	return variableReference.ReplaceAllStringFunc(s, func(ref string) string {
+		if value, ok := vars[ref[2:len(ref)-1]]; ok {
+			return value
+		}
+		return ref
+	})
+}
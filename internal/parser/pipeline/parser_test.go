@@ -1,8 +1,13 @@
 package pipeline
 
 import (
+	"errors"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
 func TestParse(t *testing.T) {
@@ -45,7 +50,7 @@ jobs:
 		if len(config.Jobs) != 1 {
 			t.Errorf("Expected 1 job, got %d", len(config.Jobs))
 		}
-		
+
 		job, ok := config.Jobs["build-job"]
 		if !ok {
 			t.Errorf("Expected job 'build-job' to exist")
@@ -71,7 +76,7 @@ jobs:
 			t.Fatalf("Failed to create temp file: %v", err)
 		}
 		defer os.Remove(invalidTmpFile.Name())
-		
+
 		if _, err := invalidTmpFile.WriteString("invalid: [ yaml"); err != nil {
 			t.Fatalf("Failed to write to temp file: %v", err)
 		}
@@ -84,3 +89,610 @@ jobs:
 		}
 	})
 }
+
+func TestJobTimeout(t *testing.T) {
+	t.Run("Unset", func(t *testing.T) {
+		d, err := JobConfig{}.TimeoutDuration()
+		if err != nil || d != 0 {
+			t.Errorf("Expected no timeout, got %v (err: %v)", d, err)
+		}
+	})
+
+	t.Run("Valid", func(t *testing.T) {
+		d, err := JobConfig{Timeout: "15m"}.TimeoutDuration()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if d != 15*time.Minute {
+			t.Errorf("Expected 15m, got %v", d)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, timeout := range []string{"soon", "-5m", "0s"} {
+			if _, err := (JobConfig{Timeout: timeout}).TimeoutDuration(); err == nil {
+				t.Errorf("Expected error for timeout %q, got nil", timeout)
+			}
+		}
+	})
+}
+
+func TestJobDebug(t *testing.T) {
+	t.Run("Valid", func(t *testing.T) {
+		d, err := JobConfig{Debug: "10m"}.DebugDuration()
+		if err != nil || d != 10*time.Minute {
+			t.Errorf("Expected 10m, got %v (err: %v)", d, err)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, debug := range []string{"later", "0s", "2h"} {
+			if _, err := (JobConfig{Debug: debug}).DebugDuration(); err == nil {
+				t.Errorf("Expected error for debug %q, got nil", debug)
+			}
+		}
+	})
+}
+
+func TestWorkingDir(t *testing.T) {
+	for workdir, want := range map[string]string{
+		"":             "/workspace",
+		"frontend":     "/workspace/frontend",
+		"./app/../api": "/workspace/api",
+		"/srv/app/":    "/srv/app",
+	} {
+		if got := (JobConfig{Workdir: workdir}).WorkingDir("/workspace"); got != want {
+			t.Errorf("Expected %q for workdir %q, got %q", want, workdir, got)
+		}
+	}
+}
+
+func TestServices(t *testing.T) {
+	t.Run("Forms", func(t *testing.T) {
+		var job JobConfig
+		err := yaml.Unmarshal([]byte(`
+services:
+  - postgres:16
+  - image: registry.example.com/cache/redis:7
+    alias: cache
+`), &job)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(job.Services) != 2 {
+			t.Fatalf("Expected 2 services, got %d", len(job.Services))
+		}
+		if got := job.Services[0].Hostname(); got != "postgres" {
+			t.Errorf("Expected hostname postgres, got %q", got)
+		}
+		if got := job.Services[1].Hostname(); got != "cache" {
+			t.Errorf("Expected hostname cache, got %q", got)
+		}
+		if err := validateServices(job); err != nil {
+			t.Errorf("Expected valid services, got %v", err)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for name, job := range map[string]JobConfig{
+			"network":   {Network: NetworkHost, Services: []ServiceConfig{{Image: "postgres"}}},
+			"image":     {Services: []ServiceConfig{{Alias: "db"}}},
+			"duplicate": {Services: []ServiceConfig{{Image: "postgres:15"}, {Image: "postgres:16"}}},
+			"alias":     {Services: []ServiceConfig{{Image: "postgres", Alias: "my db"}}},
+		} {
+			if err := validateServices(job); err == nil {
+				t.Errorf("Expected error for %s, got nil", name)
+			}
+		}
+	})
+}
+
+func TestValidWhen(t *testing.T) {
+	for _, when := range []string{"", WhenOnSuccess, WhenManual, WhenOnFailure, WhenAlways} {
+		if !validWhen(when) {
+			t.Errorf("Expected when %q to be valid", when)
+		}
+	}
+	for _, when := range []string{"never", "sometimes"} {
+		if validWhen(when) {
+			t.Errorf("Expected when %q to be invalid", when)
+		}
+	}
+}
+
+func TestNeeds(t *testing.T) {
+	parse := func(t *testing.T, content string) (*PipelineConfig, error) {
+		tmpFile, err := os.CreateTemp("", "needs-pipeline-*.yml")
+		if err != nil {
+			t.Fatalf("Failed to create temp file: %v", err)
+		}
+		defer os.Remove(tmpFile.Name())
+		if _, err := tmpFile.WriteString(content); err != nil {
+			t.Fatalf("Failed to write to temp file: %v", err)
+		}
+		tmpFile.Close()
+		return NewParser(tmpFile.Name()).Parse()
+	}
+
+	t.Run("Valid", func(t *testing.T) {
+		config, err := parse(t, `
+stages: [build, test]
+build-a:
+  stage: build
+  image: alpine
+build-b:
+  stage: build
+  image: alpine
+test-a:
+  stage: test
+  image: alpine
+  needs: [build-a]
+`)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if needs := config.Jobs["test-a"].Needs; len(needs) != 1 || needs[0] != "build-a" {
+			t.Errorf("Expected test-a to need build-a, got %v", needs)
+		}
+	})
+
+	t.Run("UnknownJob", func(t *testing.T) {
+		_, err := parse(t, `
+stages: [test]
+test-a:
+  stage: test
+  image: alpine
+  needs: [missing]
+`)
+		if err == nil {
+			t.Error("Expected error for unknown need, got nil")
+		}
+	})
+
+	t.Run("Cycle", func(t *testing.T) {
+		_, err := parse(t, `
+stages: [test]
+test-a:
+  stage: test
+  image: alpine
+  needs: [test-b]
+test-b:
+  stage: test
+  image: alpine
+  needs: [test-a]
+`)
+		if err == nil {
+			t.Error("Expected error for circular needs, got nil")
+		}
+	})
+}
+
+func TestVariables(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "variables-pipeline-*.yml")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.WriteString(`
+stages: [build]
+variables:
+  GO_VERSION: "1.25"
+  PORT: 8080
+build-job:
+  stage: build
+  image: golang
+  variables:
+    CGO_ENABLED: 0
+`); err != nil {
+		t.Fatalf("Failed to write to temp file: %v", err)
+	}
+	tmpFile.Close()
+
+	config, err := NewParser(tmpFile.Name()).Parse()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if _, ok := config.Jobs["variables"]; ok {
+		t.Error("Expected variables block not to be parsed as a job")
+	}
+	if config.Variables["GO_VERSION"] != "1.25" || config.Variables["PORT"] != "8080" {
+		t.Errorf("Unexpected global variables: %v", config.Variables)
+	}
+	if config.Jobs["build-job"].Variables["CGO_ENABLED"] != "0" {
+		t.Errorf("Unexpected job variables: %v", config.Jobs["build-job"].Variables)
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	vars := map[string]string{"REGISTRY": "registry.local:5000", "TAG": "1.2.3"}
+
+	tests := map[string]string{
+		"${REGISTRY}/app:${TAG}": "registry.local:5000/app:1.2.3",
+		"echo ${UNKNOWN}":        "echo ${UNKNOWN}",
+		"echo $TAG":              "echo $TAG",
+		"no variables":           "no variables",
+	}
+	for input, expected := range tests {
+		if got := Interpolate(input, vars); got != expected {
+			t.Errorf("Interpolate(%q) = %q, expected %q", input, got, expected)
+		}
+	}
+}
+
+func TestInclude(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		return path
+	}
+
+	t.Run("Merge", func(t *testing.T) {
+		write("ci/common.yml", `
+stages: [build, test]
+lint:
+  stage: test
+  image: golangci/golangci-lint
+build:
+  stage: build
+  image: golang:1.21
+`)
+		main := write("pipeline.yml", `
+include:
+  - ci/common.yml
+build:
+  stage: build
+  image: golang:1.25
+`)
+		config, err := NewParser(main).Parse()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(config.Stages) != 2 {
+			t.Errorf("Expected stages from the included file, got %v", config.Stages)
+		}
+		if _, ok := config.Jobs["lint"]; !ok {
+			t.Error("Expected included job 'lint' to exist")
+		}
+		if _, ok := config.Jobs["include"]; ok {
+			t.Error("Expected include not to be parsed as a job")
+		}
+		if config.Jobs["build"].Image != "golang:1.25" {
+			t.Errorf("Expected the including file to override 'build', got image %s", config.Jobs["build"].Image)
+		}
+	})
+
+	t.Run("Cycle", func(t *testing.T) {
+		write("a.yml", "include: b.yml\n")
+		write("b.yml", "include: a.yml\n")
+		if _, err := NewParser(filepath.Join(dir, "a.yml")).Parse(); err == nil {
+			t.Error("Expected error for circular include, got nil")
+		}
+	})
+
+	t.Run("OutsideRepository", func(t *testing.T) {
+		main := write("escape.yml", "include: ../../etc/passwd\n")
+		if _, err := NewParser(main).Parse(); err == nil {
+			t.Error("Expected error for include outside the repository, got nil")
+		}
+	})
+
+	t.Run("SymlinkOutsideRepository", func(t *testing.T) {
+		outside := filepath.Join(t.TempDir(), "secret.yml")
+		if err := os.WriteFile(outside, []byte("stages: [secret]\n"), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", outside, err)
+		}
+		if err := os.Symlink(outside, filepath.Join(dir, "link.yml")); err != nil {
+			t.Fatalf("Failed to create symlink: %v", err)
+		}
+		main := write("symlink.yml", "include: link.yml\n")
+		if _, err := NewParser(main).Parse(); err == nil {
+			t.Error("Expected error for a symlink leaving the repository, got nil")
+		}
+	})
+
+	t.Run("RemoteRefused", func(t *testing.T) {
+		tests := []struct {
+			name        string
+			url         string
+			remoteHosts []string
+		}{
+			{"PlainHTTP", "http://example.com/ci.yml", nil},
+			{"OtherScheme", "file:///etc/passwd", nil},
+			{"HostNotAllowed", "https://example.com/ci.yml", []string{"gitlab.com"}},
+			{"PrivateAddress", "https://127.0.0.1/ci.yml", nil},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				main := write("remote.yml", "include:\n  - remote: "+tt.url+"\n")
+				p := NewParser(main)
+				p.RemoteHosts = tt.remoteHosts
+				if _, err := p.Parse(); err == nil {
+					t.Errorf("Expected error for remote include %s, got nil", tt.url)
+				}
+			})
+		}
+	})
+}
+
+func TestExtends(t *testing.T) {
+	parse := func(t *testing.T, content string) (*PipelineConfig, error) {
+		path := filepath.Join(t.TempDir(), "pipeline.yml")
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write pipeline: %v", err)
+		}
+		return NewParser(path).Parse()
+	}
+
+	t.Run("Template", func(t *testing.T) {
+		config, err := parse(t, `
+stages: [test]
+.go:
+  image: golang:1.25
+  before_script:
+    - go mod download
+  variables:
+    CGO_ENABLED: "0"
+    GOFLAGS: -mod=mod
+unit:
+  extends: .go
+  stage: test
+  script:
+    - go test ./...
+  variables:
+    GOFLAGS: -race
+`)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if _, ok := config.Jobs[".go"]; ok {
+			t.Error("Expected hidden job '.go' to be dropped")
+		}
+		job := config.Jobs["unit"]
+		if job.Image != "golang:1.25" || len(job.BeforeScript) != 1 || len(job.Script) != 1 {
+			t.Errorf("Expected template fields to be inherited, got %+v", job)
+		}
+		if job.Variables["CGO_ENABLED"] != "0" || job.Variables["GOFLAGS"] != "-race" {
+			t.Errorf("Expected variables to be deep merged, got %v", job.Variables)
+		}
+	})
+
+	t.Run("UnknownTemplate", func(t *testing.T) {
+		if _, err := parse(t, "unit:\n  extends: .missing\n"); err == nil {
+			t.Error("Expected error for unknown template, got nil")
+		}
+	})
+
+	t.Run("Cycle", func(t *testing.T) {
+		if _, err := parse(t, ".a:\n  extends: .b\n.b:\n  extends: .a\n"); err == nil {
+			t.Error("Expected error for circular extends, got nil")
+		}
+	})
+}
+
+func TestParseErrors(t *testing.T) {
+	parse := func(t *testing.T, content string) *ParseError {
+		path := filepath.Join(t.TempDir(), "pipeline.yml")
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write pipeline: %v", err)
+		}
+		_, err := NewParser(path).Parse()
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) {
+			t.Fatalf("Expected a ParseError, got %v", err)
+		}
+		return parseErr
+	}
+
+	t.Run("Syntax", func(t *testing.T) {
+		parseErr := parse(t, "stages: [build\n")
+		if parseErr.File != "pipeline.yml" || parseErr.Line == 0 {
+			t.Errorf("Expected file and line, got %+v", parseErr)
+		}
+	})
+
+	t.Run("WrongType", func(t *testing.T) {
+		parseErr := parse(t, `
+stages: [build]
+build:
+  stage: build
+  image: [alpine]
+`)
+		if parseErr.Job != "build" || parseErr.Field != "image" || parseErr.Line != 5 {
+			t.Errorf("Expected job build, field image at line 5, got %+v", parseErr)
+		}
+	})
+
+	t.Run("InvalidField", func(t *testing.T) {
+		parseErr := parse(t, `
+stages: [build]
+build:
+  stage: build
+  image: alpine
+  timeout: soon
+`)
+		if parseErr.Job != "build" || parseErr.Field != "timeout" || parseErr.Line != 6 || parseErr.Column != 3 {
+			t.Errorf("Expected job build, field timeout at 6:3, got %+v", parseErr)
+		}
+	})
+
+	t.Run("InvalidNetwork", func(t *testing.T) {
+		parseErr := parse(t, `
+stages: [build]
+build:
+  stage: build
+  image: alpine
+  network: internet
+`)
+		if parseErr.Job != "build" || parseErr.Field != "network" || parseErr.Line != 6 {
+			t.Errorf("Expected job build, field network at line 6, got %+v", parseErr)
+		}
+	})
+
+	t.Run("InvalidProperties", func(t *testing.T) {
+		RegisterJobType("checked", func(name string, jobs map[string]JobConfig) error {
+			if jobs[name].Properties["level"] != "high" {
+				return errors.New("level invalide")
+			}
+			return nil
+		})
+		parseErr := parse(t, `
+stages: [test]
+check:
+  stage: test
+  type: checked
+  properties:
+    level: low
+`)
+		if parseErr.Job != "check" || parseErr.Field != "properties" || parseErr.Line != 6 || parseErr.Message != "level invalide" {
+			t.Errorf("Expected job check, field properties at line 6, got %+v", parseErr)
+		}
+	})
+
+	t.Run("UnknownJobType", func(t *testing.T) {
+		parseErr := parse(t, `
+stages: [deploy]
+deploy:
+  stage: deploy
+  type: docker-deploy
+  script: [./deploy.sh]
+`)
+		if parseErr.Job != "deploy" || parseErr.Field != "type" || parseErr.Line != 5 {
+			t.Errorf("Expected job deploy, field type at line 5, got %+v", parseErr)
+		}
+	})
+}
+
+func TestApplyRules(t *testing.T) {
+	newConfig := func() *PipelineConfig {
+		return &PipelineConfig{
+			Stages: []string{"build", "deploy"},
+			Jobs: map[string]JobConfig{
+				"build":    {Stage: "build"},
+				"frontend": {Stage: "build", Rules: []Rule{{Changes: []string{"frontend/**"}}}},
+				"deploy":   {Stage: "deploy", Rules: []Rule{{Branches: []string{"main"}, When: WhenManual}}},
+				"release":  {Stage: "deploy", Rules: []Rule{{Tags: []string{"v*"}}}},
+			},
+		}
+	}
+
+	t.Run("FeatureBranch", func(t *testing.T) {
+		config := newConfig()
+		excluded := config.ApplyRules(RuleContext{Branch: "feature/login", ChangedFiles: []string{"backend/main.go"}})
+		for _, name := range []string{"frontend", "deploy", "release"} {
+			if _, ok := excluded[name]; !ok {
+				t.Errorf("Expected job %s to be excluded", name)
+			}
+		}
+		if _, ok := config.Jobs["build"]; !ok {
+			t.Error("Expected job without rules to be kept")
+		}
+	})
+
+	t.Run("MainBranch", func(t *testing.T) {
+		config := newConfig()
+		config.ApplyRules(RuleContext{Branch: "main", ChangedFiles: []string{"frontend/src/app/App.tsx"}})
+		if _, ok := config.Jobs["frontend"]; !ok {
+			t.Error("Expected frontend job to run when frontend files changed")
+		}
+		if config.Jobs["deploy"].When != WhenManual {
+			t.Errorf("Expected when of the matching rule, got %q", config.Jobs["deploy"].When)
+		}
+	})
+
+	t.Run("Tag", func(t *testing.T) {
+		config := newConfig()
+		config.ApplyRules(RuleContext{Tag: "v1.2.0"})
+		if _, ok := config.Jobs["release"]; !ok {
+			t.Error("Expected release job to run on a version tag")
+		}
+		if _, ok := config.Jobs["frontend"]; !ok {
+			t.Error("Expected changes rules to match when changed files are unknown")
+		}
+	})
+}
+
+func TestEnvironments(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pipeline.yml")
+	if err := os.WriteFile(path, []byte(`
+stages: [build]
+environments:
+  - name: production
+    rules:
+      - tags: ["v*"]
+      - branches: [main]
+  - name: staging
+    rules:
+      - branches: [develop, "release/*"]
+build:
+  stage: build
+  image: golang
+`), 0644); err != nil {
+		t.Fatalf("Failed to write pipeline: %v", err)
+	}
+	config, err := NewParser(path).Parse()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, ok := config.Jobs["environments"]; ok {
+		t.Error("Expected environments block not to be parsed as a job")
+	}
+
+	tests := []struct {
+		ctx  RuleContext
+		want string
+	}{
+		{RuleContext{Branch: "main"}, "production"},
+		{RuleContext{Tag: "v1.0.0"}, "production"},
+		{RuleContext{Branch: "release/1.2"}, "staging"},
+		{RuleContext{Branch: "feature/x"}, ""},
+	}
+	for _, tt := range tests {
+		name, declared := config.DeployEnvironment(tt.ctx)
+		if !declared || name != tt.want {
+			t.Errorf("Expected environment %q for %+v, got %q (declared %v)", tt.want, tt.ctx, name, declared)
+		}
+	}
+
+	t.Run("NotDeclared", func(t *testing.T) {
+		if _, declared := (&PipelineConfig{}).DeployEnvironment(RuleContext{Branch: "main"}); declared {
+			t.Error("Expected no environment to be declared")
+		}
+	})
+
+	t.Run("Duplicate", func(t *testing.T) {
+		if err := os.WriteFile(path, []byte("environments:\n  - name: staging\n  - name: staging\n"), 0644); err != nil {
+			t.Fatalf("Failed to write pipeline: %v", err)
+		}
+		_, err := NewParser(path).Parse()
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) || parseErr.Field != "environments" || parseErr.Line != 1 {
+			t.Errorf("Expected an environments error on line 1, got %v", err)
+		}
+	})
+}
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		expected      bool
+	}{
+		{"frontend/**", "frontend/src/index.ts", true},
+		{"frontend/**", "backend/main.go", false},
+		{"**/*.go", "internal/api/server.go", true},
+		{"**/*.go", "main.go", true},
+		{"docs/*.md", "docs/guide/intro.md", false},
+		{"release/*", "release/1.0", true},
+	}
+	for _, tt := range tests {
+		if got := MatchGlob(tt.pattern, tt.name); got != tt.expected {
+			t.Errorf("MatchGlob(%q, %q) = %v, expected %v", tt.pattern, tt.name, got, tt.expected)
+		}
+	}
+}
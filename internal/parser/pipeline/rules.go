@@ -0,0 +1,117 @@
+package pipeline
+
+import (
+	"path"
+	"strings"
+)
+
+// WhenNever excludes a job from the pipeline when returned by its matching rule
+const WhenNever = "never"
+
+// Rule includes or excludes a job depending on the pushed ref and changed files
+// Every condition set must match; the first matching rule of a job decides its when
+type Rule struct {
+	Branches []string `yaml:"branches,omitempty"` // Globs sur la branche (ex: main, release/*)
+	Tags     []string `yaml:"tags,omitempty"`     // Globs sur le tag (ex: v*)
+	Changes  []string `yaml:"changes,omitempty"`  // Globs sur les fichiers modifiés (ex: frontend/**)
+	When     string   `yaml:"when,omitempty"`     // on_success (défaut), manual ou never
+}
+
+// RuleContext is what rules are evaluated against
+type RuleContext struct {
+	Branch string
+	Tag    string
+	// ChangedFiles lists the files changed by the push, nil when unknown (changes conditions then match)
+	ChangedFiles []string
+}
+
+// ApplyRules evaluates the rules of every job, removing the jobs they exclude and returning them
+// A job with rules but no matching rule is excluded, the when of the matching rule replaces the job's
+func (c *PipelineConfig) ApplyRules(ctx RuleContext) map[string]JobConfig {
+	excluded := make(map[string]JobConfig)
+	for name, job := range c.Jobs {
+		if len(job.Rules) == 0 {
+			continue
+		}
+
+		when := WhenNever
+		for _, rule := range job.Rules {
+			if rule.matches(ctx) {
+				when = rule.When
+				if when == "" {
+					when = WhenOnSuccess
+				}
+				break
+			}
+		}
+
+		if when == WhenNever {
+			excluded[name] = job
+			delete(c.Jobs, name)
+			continue
+		}
+		job.When = when
+		c.Jobs[name] = job
+	}
+	return excluded
+}
+
+// matches reports whether every condition of the rule holds
+func (r Rule) matches(ctx RuleContext) bool {
+	if len(r.Branches) > 0 && (ctx.Branch == "" || !matchAny(r.Branches, ctx.Branch)) {
+		return false
+	}
+	if len(r.Tags) > 0 && (ctx.Tag == "" || !matchAny(r.Tags, ctx.Tag)) {
+		return false
+	}
+	if len(r.Changes) > 0 && ctx.ChangedFiles != nil {
+		changed := false
+		for _, file := range ctx.ChangedFiles {
+			if matchAny(r.Changes, file) {
+				changed = true
+				break
+			}
+		}
+		if !changed {
+			return false
+		}
+	}
+	return true
+}
+
+// matchAny reports whether name matches one of the glob patterns
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if MatchGlob(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchGlob matches a slash separated name against a glob pattern where ** matches any number of segments
+func MatchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// ** matches zero or more segments
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
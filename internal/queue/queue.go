@@ -0,0 +1,142 @@
+package queue
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrQueueFull is returned when the queue already holds its maximum number of pipelines
+var ErrQueueFull = errors.New("pipeline queue is full")
+
+// Task is a pipeline waiting for a worker
+type Task struct {
+	PipelineID int
+	ProjectID  int
+	// ProjectLimit caps the pipelines of the same project running at once, 0 for unlimited
+	ProjectLimit int
+	Run          func()
+}
+
+// Stats is a snapshot of the queue state
+type Stats struct {
+	Queued   int `json:"queued"`
+	Running  int `json:"running"`
+	Workers  int `json:"workers"`
+	Capacity int `json:"capacity"`
+}
+
+// Queue is a bounded FIFO of pipelines executed by a fixed pool of workers
+// A pipeline whose project is at its concurrency limit is skipped until a slot frees up
+type Queue struct {
+	mu               sync.Mutex
+	cond             *sync.Cond
+	pending          []Task
+	capacity         int
+	workers          int
+	running          int
+	runningByProject map[int]int
+}
+
+// New creates a queue holding at most capacity pipelines, executed by the given number of workers
+func New(workers, capacity int) *Queue {
+	if workers < 1 {
+		workers = 1
+	}
+	if capacity < 1 {
+		capacity = 1
+	}
+	q := &Queue{
+		capacity:         capacity,
+		workers:          workers,
+		runningByProject: make(map[int]int),
+	}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// Start launches the worker pool
+func (q *Queue) Start() {
+	for i := 0; i < q.workers; i++ {
+		go q.work()
+	}
+}
+
+// Enqueue adds a pipeline at the end of the queue
+func (q *Queue) Enqueue(task Task) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.pending) >= q.capacity {
+		return ErrQueueFull
+	}
+	q.pending = append(q.pending, task)
+	q.cond.Signal()
+	return nil
+}
+
+// Remove drops a pipeline that has not started yet, returning false if it is not queued
+func (q *Queue) Remove(pipelineID int) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, task := range q.pending {
+		if task.PipelineID == pipelineID {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Stats returns the current queue depth and worker usage
+func (q *Queue) Stats() Stats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return Stats{
+		Queued:   len(q.pending),
+		Running:  q.running,
+		Workers:  q.workers,
+		Capacity: q.capacity,
+	}
+}
+
+// next removes and returns the oldest task allowed to start, if any
+// Must be called with the lock held
+func (q *Queue) next() (Task, bool) {
+	for i, task := range q.pending {
+		if task.ProjectLimit > 0 && q.runningByProject[task.ProjectID] >= task.ProjectLimit {
+			continue
+		}
+		q.pending = append(q.pending[:i], q.pending[i+1:]...)
+		return task, true
+	}
+	return Task{}, false
+}
+
+// work executes queued pipelines one at a time, forever
+func (q *Queue) work() {
+	for {
+		q.mu.Lock()
+		task, ok := q.next()
+		for !ok {
+			q.cond.Wait()
+			task, ok = q.next()
+		}
+		q.running++
+		q.runningByProject[task.ProjectID]++
+		q.mu.Unlock()
+
+		task.Run()
+
+		q.mu.Lock()
+		q.running--
+		q.runningByProject[task.ProjectID]--
+		if q.runningByProject[task.ProjectID] == 0 {
+			delete(q.runningByProject, task.ProjectID)
+		}
+		// A project slot freed up: waiting workers may now be able to start a task
+		q.cond.Broadcast()
+		q.mu.Unlock()
+	}
+}
@@ -0,0 +1,97 @@
+package queue
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestQueue(t *testing.T) {
+	t.Run("RejectsWhenFull", func(t *testing.T) {
+		q := New(1, 2)
+		for i := 1; i <= 2; i++ {
+			if err := q.Enqueue(Task{PipelineID: i, Run: func() {}}); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+		}
+		if err := q.Enqueue(Task{PipelineID: 3, Run: func() {}}); err != ErrQueueFull {
+			t.Errorf("Expected ErrQueueFull, got %v", err)
+		}
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+		q := New(1, 10)
+		q.Enqueue(Task{PipelineID: 1, Run: func() {}})
+		q.Enqueue(Task{PipelineID: 2, Run: func() {}})
+
+		if !q.Remove(1) {
+			t.Error("Expected pipeline 1 to be removed")
+		}
+		if q.Remove(1) {
+			t.Error("Expected pipeline 1 to be already removed")
+		}
+		if stats := q.Stats(); stats.Queued != 1 {
+			t.Errorf("Expected 1 queued pipeline, got %d", stats.Queued)
+		}
+	})
+
+	t.Run("BoundsConcurrency", func(t *testing.T) {
+		q := New(2, 10)
+		q.Start()
+
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		current, peak := 0, 0
+		for i := 1; i <= 6; i++ {
+			wg.Add(1)
+			q.Enqueue(Task{PipelineID: i, Run: func() {
+				defer wg.Done()
+				mu.Lock()
+				current++
+				if current > peak {
+					peak = current
+				}
+				mu.Unlock()
+				time.Sleep(10 * time.Millisecond)
+				mu.Lock()
+				current--
+				mu.Unlock()
+			}})
+		}
+		wg.Wait()
+
+		if peak > 2 {
+			t.Errorf("Expected at most 2 concurrent pipelines, got %d", peak)
+		}
+	})
+
+	t.Run("ProjectLimit", func(t *testing.T) {
+		q := New(3, 10)
+		q.Start()
+
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		current, peak := 0, 0
+		for i := 1; i <= 4; i++ {
+			wg.Add(1)
+			q.Enqueue(Task{PipelineID: i, ProjectID: 1, ProjectLimit: 1, Run: func() {
+				defer wg.Done()
+				mu.Lock()
+				current++
+				if current > peak {
+					peak = current
+				}
+				mu.Unlock()
+				time.Sleep(10 * time.Millisecond)
+				mu.Lock()
+				current--
+				mu.Unlock()
+			}})
+		}
+		wg.Wait()
+
+		if peak != 1 {
+			t.Errorf("Expected 1 concurrent pipeline for the project, got %d", peak)
+		}
+	})
+}
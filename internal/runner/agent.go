@@ -0,0 +1,369 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/registry"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/docker"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/git"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+)
+
+const (
+	// pollInterval is how long the agent waits before asking again when no job is waiting
+	pollInterval = 5 * time.Second
+	// flushInterval is how often buffered log lines are sent to the server
+	flushInterval = 2 * time.Second
+	// heartbeatInterval is how often the agent reports a silent job as still running
+	heartbeatInterval = 30 * time.Second
+)
+
+// errJobGone is returned when the server no longer expects the job, e.g. after a cancellation
+var errJobGone = errors.New("job is no longer running on this runner")
+
+// Agent claims jobs from the CI/CD server and runs them on the local Docker daemon
+type Agent struct {
+	serverURL string
+	token     string
+	client    *http.Client
+	docker    *docker.DockerExecutor
+	workDir   string
+}
+
+// NewAgent creates an agent authenticated with the token received at registration
+func NewAgent(serverURL, token string) (*Agent, error) {
+	dockerExec, err := docker.NewDockerExecutor()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create docker executor: %w", err)
+	}
+	return &Agent{
+		serverURL: strings.TrimRight(serverURL, "/"),
+		token:     token,
+		client:    &http.Client{Timeout: 30 * time.Second},
+		docker:    dockerExec,
+		workDir:   filepath.Join(os.TempDir(), "cicd-runner"),
+	}, nil
+}
+
+// Register registers a runner with the server and returns its token
+func Register(serverURL, registrationToken, name string) (string, error) {
+	body, _ := json.Marshal(map[string]string{
+		"registration_token": registrationToken,
+		"name":               name,
+	})
+	resp, err := http.Post(strings.TrimRight(serverURL, "/")+"/api/v1/runners/register", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("registration refused: %s", resp.Status)
+	}
+	var registered struct {
+		ID    int    `json:"id"`
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&registered); err != nil {
+		return "", err
+	}
+	logger.Info(fmt.Sprintf("Registered as runner %d", registered.ID))
+	return registered.Token, nil
+}
+
+// Run claims and runs jobs one at a time until the context is cancelled
+func (a *Agent) Run(ctx context.Context) {
+	logger.Info("Runner polling " + a.serverURL + " for jobs")
+	for {
+		job, err := a.requestJob(ctx)
+		if err != nil {
+			logger.Warn("Failed to request a job: " + err.Error())
+		}
+		if job != nil {
+			a.runJob(ctx, job)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// runJob clones the repository, runs the job container and reports its logs and exit code
+func (a *Agent) runJob(ctx context.Context, job *models.RunnerJob) {
+	logger.Info(fmt.Sprintf("Running job %d (%s) of pipeline %d", job.JobID, job.Name, job.PipelineID))
+	logs := newLogStream(a, job.JobID)
+
+	exitCode, usage, err := a.execute(ctx, job, logs)
+	if err != nil {
+		logs.add(models.LogLine{Content: "ERROR: " + err.Error(), Stream: models.LogStreamSystem, CreatedAt: time.Now()})
+		exitCode = 1
+	}
+	if err := logs.close(); errors.Is(err, errJobGone) {
+		logger.Info(fmt.Sprintf("Job %d was stopped by the server", job.JobID))
+		return
+	}
+
+	if err := a.finishJob(job.JobID, exitCode, usage); err != nil {
+		logger.Warn(fmt.Sprintf("Failed to report the result of job %d: %v", job.JobID, err))
+		return
+	}
+	logger.Info(fmt.Sprintf("Job %d finished with exit code %d", job.JobID, exitCode))
+}
+
+// execute runs the job in a fresh workspace, returning the container exit code and its resource usage, nil when not sampled
+func (a *Agent) execute(ctx context.Context, job *models.RunnerJob, logs *logStream) (int, *models.ResourceUsage, error) {
+	workspace := filepath.Join(a.workDir, fmt.Sprintf("job-%d", job.JobID))
+	os.RemoveAll(workspace)
+	defer os.RemoveAll(workspace)
+
+	if err := os.MkdirAll(a.workDir, 0755); err != nil {
+		return 1, nil, fmt.Errorf("failed to create workspace: %w", err)
+	}
+	if err := git.Clone(job.RepoURL, job.Branch, workspace, git.Auth{Token: job.AccessToken, DeployKey: job.DeployKey}, job.CommitHash); err != nil {
+		return 1, nil, fmt.Errorf("failed to clone repository: %w", err)
+	}
+
+	var auth *registry.AuthConfig
+	if job.RegistryAuth != "" {
+		decoded, err := registry.DecodeAuthConfig(job.RegistryAuth)
+		if err != nil {
+			return 1, nil, fmt.Errorf("invalid registry credentials: %w", err)
+		}
+		auth = decoded
+	}
+	if err := a.docker.PullImageWithAuth(ctx, job.Image, auth); err != nil {
+		return 1, nil, fmt.Errorf("failed to pull image %s: %w", job.Image, err)
+	}
+
+	// The job context is cancelled when the server reports the job gone
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	logs.setOnGone(cancel)
+
+	containerID, err := a.docker.RunJobWithVolume(jobCtx, job.Image, job.Script, workspace, job.Env, docker.JobOptions{
+		Network:    job.Network,
+		Privileged: job.Privileged,
+		WorkingDir: job.WorkingDir,
+		Entrypoint: job.Entrypoint,
+	})
+	if err != nil {
+		return 1, nil, fmt.Errorf("failed to start container: %w", err)
+	}
+	defer a.docker.RemoveContainer(containerID)
+
+	go func() {
+		<-jobCtx.Done()
+		a.docker.StopContainer(containerID)
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		a.streamLogs(jobCtx, containerID, logs)
+	}()
+
+	stopSampling := a.docker.SampleUsage(jobCtx, containerID)
+	exitCode, err := a.docker.WaitForContainer(jobCtx, containerID)
+	wg.Wait()
+	usage := stopSampling()
+	if err != nil {
+		return 1, usage, fmt.Errorf("failed waiting for container: %w", err)
+	}
+	return int(exitCode), usage, nil
+}
+
+// streamLogs follows the container output line by line
+func (a *Agent) streamLogs(ctx context.Context, containerID string, logs *logStream) {
+	lines, err := a.docker.FollowLogs(ctx, containerID)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to get logs: %v", err))
+		return
+	}
+	for line := range lines {
+		logs.add(line)
+	}
+}
+
+// requestJob claims the next waiting job, nil when there is none
+func (a *Agent) requestJob(ctx context.Context) (*models.RunnerJob, error) {
+	resp, err := a.post(ctx, "/api/v1/runner/jobs/request", struct{}{})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNoContent:
+		return nil, nil
+	case http.StatusOK:
+		var job models.RunnerJob
+		if err := json.NewDecoder(resp.Body).Decode(&job); err != nil {
+			return nil, err
+		}
+		return &job, nil
+	default:
+		return nil, fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+}
+
+// sendLogs appends log lines to a job, an empty batch acting as a heartbeat
+func (a *Agent) sendLogs(jobID int, lines []models.LogLine) error {
+	resp, err := a.post(context.Background(), fmt.Sprintf("/api/v1/runner/jobs/%d/logs", jobID), map[string][]models.LogLine{"entries": lines})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return checkResponse(resp)
+}
+
+// finishJob reports the exit code and resource usage of a job
+func (a *Agent) finishJob(jobID, exitCode int, usage *models.ResourceUsage) error {
+	payload := struct {
+		ExitCode int                   `json:"exit_code"`
+		Usage    *models.ResourceUsage `json:"resource_usage,omitempty"`
+	}{exitCode, usage}
+	resp, err := a.post(context.Background(), fmt.Sprintf("/api/v1/runner/jobs/%d/finish", jobID), payload)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return checkResponse(resp)
+}
+
+func (a *Agent) post(ctx context.Context, path string, payload interface{}) (*http.Response, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.serverURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Runner-Token", a.token)
+	return a.client.Do(req)
+}
+
+func checkResponse(resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusNoContent, http.StatusOK:
+		return nil
+	case http.StatusConflict:
+		return errJobGone
+	default:
+		return fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+}
+
+// logStream buffers the log lines of a job and sends them to the server periodically
+type logStream struct {
+	agent  *Agent
+	jobID  int
+	onGone func()
+
+	mu       sync.Mutex
+	lines    []models.LogLine
+	lastSent time.Time
+	gone     bool
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func newLogStream(agent *Agent, jobID int) *logStream {
+	s := &logStream{
+		agent:    agent,
+		jobID:    jobID,
+		lastSent: time.Now(),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go s.loop()
+	return s
+}
+
+func (s *logStream) add(line models.LogLine) {
+	s.mu.Lock()
+	s.lines = append(s.lines, line)
+	s.mu.Unlock()
+}
+
+// setOnGone registers the function called once the server reports the job gone
+func (s *logStream) setOnGone(fn func()) {
+	s.mu.Lock()
+	s.onGone = fn
+	s.mu.Unlock()
+}
+
+func (s *logStream) loop() {
+	defer close(s.done)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.flush(false)
+		}
+	}
+}
+
+// flush sends the buffered lines, or an empty heartbeat once the job has been silent for a while
+func (s *logStream) flush(force bool) error {
+	s.mu.Lock()
+	if s.gone {
+		s.mu.Unlock()
+		return errJobGone
+	}
+	lines := s.lines
+	s.lines = nil
+	heartbeat := time.Since(s.lastSent) >= heartbeatInterval
+	s.mu.Unlock()
+
+	if len(lines) == 0 && !heartbeat && !force {
+		return nil
+	}
+
+	err := s.agent.sendLogs(s.jobID, lines)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case errors.Is(err, errJobGone):
+		s.gone = true
+		if s.onGone != nil {
+			s.onGone()
+		}
+	case err != nil:
+		// Keep the lines for the next attempt
+		logger.Warn(fmt.Sprintf("Failed to send logs of job %d: %v", s.jobID, err))
+		s.lines = append(lines, s.lines...)
+	default:
+		s.lastSent = time.Now()
+	}
+	return err
+}
+
+// close stops the periodic flush and sends the remaining lines
+func (s *logStream) close() error {
+	close(s.stop)
+	<-s.done
+	return s.flush(true)
+}
@@ -0,0 +1,77 @@
+package secrets
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+)
+
+// AES seals secrets with AES-GCM, storing the nonce in front of the ciphertext
+// An empty key stores secrets in clear.
+type AES struct {
+	key string
+	// strict fails on values the key cannot open instead of returning them as they are stored
+	strict bool
+}
+
+// NewAES creates an AES backend, key being 16, 24 or 32 bytes long
+func NewAES(key string, strict bool) *AES {
+	return &AES{key: key, strict: strict}
+}
+
+func (a *AES) Encrypt(ctx context.Context, text string) (string, error) {
+	if a.key == "" {
+		return text, nil
+	}
+	block, err := aes.NewCipher([]byte(a.key))
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	ciphertext := gcm.Seal(nonce, nonce, []byte(text), nil)
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// Decrypt opens a sealed secret, values that are not ciphertexts being returned as stored before encryption
+// A ciphertext sealed with another key fails with ErrKeyMismatch in strict mode, and is returned as is otherwise.
+func (a *AES) Decrypt(ctx context.Context, text string) (string, error) {
+	if a.key == "" || text == "" {
+		return text, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(text)
+	if err != nil {
+		return text, nil // Return raw text if not base64 (migration support)
+	}
+	block, err := aes.NewCipher([]byte(a.key))
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	nonceSize := gcm.NonceSize()
+	if len(data) < nonceSize {
+		return text, nil // Return raw text if too short
+	}
+	nonce, ciphertext := data[:nonceSize], data[nonceSize:]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		if a.strict {
+			return "", fmt.Errorf("%w: a secret was not sealed with ENCRYPTION_KEY", ErrKeyMismatch)
+		}
+		return text, nil // Return raw text if decryption fails (wrong key or not encrypted)
+	}
+	return string(plaintext), nil
+}
@@ -0,0 +1,76 @@
+// Package secrets encrypts the project secrets stored in the database
+// Secrets are sealed with AES-GCM and ENCRYPTION_KEY by default, or by the Vault Transit engine
+// with SECRETS_BACKEND=vault, the key then never leaving Vault.
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrKeyMismatch is returned for a secret that cannot be opened, usually because ENCRYPTION_KEY changed
+var ErrKeyMismatch = errors.New("encryption key mismatch")
+
+// Backend seals and opens the secrets of the database
+type Backend interface {
+	Encrypt(ctx context.Context, plaintext string) (string, error)
+	Decrypt(ctx context.Context, ciphertext string) (string, error)
+}
+
+// BatchBackend is a backend opening several secrets in a single call
+// Backends calling a remote service implement it, so that listings do not make one call per secret.
+type BatchBackend interface {
+	Backend
+	// DecryptBatch opens the ciphertexts, returning the plaintexts in the same order
+	DecryptBatch(ctx context.Context, ciphertexts []string) ([]string, error)
+}
+
+// DecryptAll opens secrets in place, in a single call when the backend is a BatchBackend
+func DecryptAll(ctx context.Context, backend Backend, secrets []*string) error {
+	if batch, ok := backend.(BatchBackend); ok {
+		ciphertexts := make([]string, len(secrets))
+		for i, secret := range secrets {
+			ciphertexts[i] = *secret
+		}
+		plaintexts, err := batch.DecryptBatch(ctx, ciphertexts)
+		if err != nil {
+			return err
+		}
+		for i, secret := range secrets {
+			*secret = plaintexts[i]
+		}
+		return nil
+	}
+
+	for _, secret := range secrets {
+		plaintext, err := backend.Decrypt(ctx, *secret)
+		if err != nil {
+			return err
+		}
+		*secret = plaintext
+	}
+	return nil
+}
+
+// FromEnv creates the backend selected by SECRETS_BACKEND: aes (default) or vault
+// Values sealed with ENCRYPTION_KEY before switching to Vault stay readable.
+// Secrets that cannot be opened are errors unless SECRETS_STRICT=false.
+func FromEnv() (Backend, error) {
+	aes := NewAES(os.Getenv("ENCRYPTION_KEY"), os.Getenv("SECRETS_STRICT") != "false")
+
+	switch backend := os.Getenv("SECRETS_BACKEND"); backend {
+	case "", "aes":
+		return aes, nil
+	case "vault":
+		vault, err := NewVaultFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		vault.legacy = aes
+		return vault, nil
+	default:
+		return nil, fmt.Errorf("unknown SECRETS_BACKEND %q, expected aes or vault", backend)
+	}
+}
@@ -0,0 +1,178 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// vaultPrefix starts every ciphertext of the Transit engine, e.g. vault:v1:...
+const vaultPrefix = "vault:"
+
+// Vault seals secrets with a key of the Vault Transit engine
+// Only the ciphertext is stored in the database, a compromised database dump being useless without Vault.
+type Vault struct {
+	addr      string
+	token     string
+	namespace string
+	mount     string
+	key       string
+	client    *http.Client
+	// legacy opens the values sealed before the switch to Vault
+	legacy Backend
+}
+
+// NewVaultFromEnv configures Vault from VAULT_ADDR and VAULT_TOKEN, with the Transit key
+// VAULT_TRANSIT_KEY (cicd by default) of the engine mounted at VAULT_TRANSIT_MOUNT (transit by default)
+func NewVaultFromEnv() (*Vault, error) {
+	addr := strings.TrimSuffix(os.Getenv("VAULT_ADDR"), "/")
+	token := os.Getenv("VAULT_TOKEN")
+	if addr == "" || token == "" {
+		return nil, fmt.Errorf("VAULT_ADDR and VAULT_TOKEN are required with SECRETS_BACKEND=vault")
+	}
+	v := &Vault{
+		addr:      addr,
+		token:     token,
+		namespace: os.Getenv("VAULT_NAMESPACE"),
+		mount:     envOr("VAULT_TRANSIT_MOUNT", "transit"),
+		key:       envOr("VAULT_TRANSIT_KEY", "cicd"),
+		client:    &http.Client{Timeout: 10 * time.Second},
+	}
+	return v, nil
+}
+
+// envOr reads an environment variable, falling back to def when unset
+func envOr(name, def string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return def
+}
+
+// Encrypt seals a secret with the Transit key, empty values being stored as is
+func (v *Vault) Encrypt(ctx context.Context, plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	var resp struct {
+		Ciphertext string `json:"ciphertext"`
+	}
+	body := map[string]string{"plaintext": base64.StdEncoding.EncodeToString([]byte(plaintext))}
+	if err := v.call(ctx, "encrypt", body, &resp); err != nil {
+		return "", err
+	}
+	return resp.Ciphertext, nil
+}
+
+// Decrypt opens a secret sealed by the Transit key, or by the legacy backend when it has no Vault prefix
+func (v *Vault) Decrypt(ctx context.Context, ciphertext string) (string, error) {
+	if !strings.HasPrefix(ciphertext, vaultPrefix) {
+		if v.legacy == nil {
+			return ciphertext, nil
+		}
+		return v.legacy.Decrypt(ctx, ciphertext)
+	}
+	var resp struct {
+		Plaintext string `json:"plaintext"`
+	}
+	if err := v.call(ctx, "decrypt", map[string]string{"ciphertext": ciphertext}, &resp); err != nil {
+		return "", err
+	}
+	plaintext, err := base64.StdEncoding.DecodeString(resp.Plaintext)
+	if err != nil {
+		return "", fmt.Errorf("invalid plaintext from Vault: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// DecryptBatch opens the ciphertexts sealed by the Transit key in one batch request, the others with the legacy backend
+func (v *Vault) DecryptBatch(ctx context.Context, ciphertexts []string) ([]string, error) {
+	plaintexts := make([]string, len(ciphertexts))
+	var batch []map[string]string
+	var positions []int
+	for i, ciphertext := range ciphertexts {
+		if !strings.HasPrefix(ciphertext, vaultPrefix) {
+			plaintext, err := v.Decrypt(ctx, ciphertext)
+			if err != nil {
+				return nil, err
+			}
+			plaintexts[i] = plaintext
+			continue
+		}
+		batch = append(batch, map[string]string{"ciphertext": ciphertext})
+		positions = append(positions, i)
+	}
+	if len(batch) == 0 {
+		return plaintexts, nil
+	}
+
+	var resp struct {
+		BatchResults []struct {
+			Plaintext string `json:"plaintext"`
+			Error     string `json:"error"`
+		} `json:"batch_results"`
+	}
+	if err := v.call(ctx, "decrypt", map[string]interface{}{"batch_input": batch}, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.BatchResults) != len(batch) {
+		return nil, fmt.Errorf("vault returned %d results for %d ciphertexts", len(resp.BatchResults), len(batch))
+	}
+	for i, result := range resp.BatchResults {
+		if result.Error != "" {
+			return nil, fmt.Errorf("%w: vault decrypt failed: %s", ErrKeyMismatch, result.Error)
+		}
+		plaintext, err := base64.StdEncoding.DecodeString(result.Plaintext)
+		if err != nil {
+			return nil, fmt.Errorf("invalid plaintext from Vault: %w", err)
+		}
+		plaintexts[positions[i]] = string(plaintext)
+	}
+	return plaintexts, nil
+}
+
+// call posts to the encrypt or decrypt endpoint of the Transit key and decodes the data of the response
+func (v *Vault) call(ctx context.Context, operation string, body interface{}, data interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("%s/v1/%s/%s/%s", v.addr, v.mount, operation, v.key)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Vault-Token", v.token)
+	if v.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.namespace)
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach Vault: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []string        `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("invalid response from Vault (status %d): %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode == http.StatusBadRequest && operation == "decrypt" {
+		// Vault rejects ciphertexts of another key, or altered ones
+		return fmt.Errorf("%w: vault decrypt failed: %s", ErrKeyMismatch, strings.Join(result.Errors, "; "))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("vault %s failed with status %d: %s", operation, resp.StatusCode, strings.Join(result.Errors, "; "))
+	}
+	return json.Unmarshal(result.Data, data)
+}
@@ -0,0 +1,139 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// fakeTransit is a Transit engine sealing plaintexts as vault:v1:<base64>, counting its calls
+func fakeTransit(t *testing.T, calls *atomic.Int32) *Vault {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string][]string{"errors": {"permission denied"}})
+			return
+		}
+		var body struct {
+			Plaintext  string              `json:"plaintext"`
+			Ciphertext string              `json:"ciphertext"`
+			BatchInput []map[string]string `json:"batch_input"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		open := func(ciphertext string) (string, bool) {
+			return strings.CutPrefix(ciphertext, "vault:v1:")
+		}
+		switch r.URL.Path {
+		case "/v1/transit/encrypt/cicd":
+			json.NewEncoder(w).Encode(map[string]any{"data": map[string]string{"ciphertext": "vault:v1:" + body.Plaintext}})
+		case "/v1/transit/decrypt/cicd":
+			if body.BatchInput != nil {
+				var results []map[string]string
+				for _, item := range body.BatchInput {
+					if plaintext, ok := open(item["ciphertext"]); ok {
+						results = append(results, map[string]string{"plaintext": plaintext})
+					} else {
+						results = append(results, map[string]string{"error": "invalid ciphertext"})
+					}
+				}
+				json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"batch_results": results}})
+				return
+			}
+			plaintext, ok := open(body.Ciphertext)
+			if !ok {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string][]string{"errors": {"invalid ciphertext"}})
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]any{"data": map[string]string{"plaintext": plaintext}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return &Vault{addr: server.URL, token: "token", mount: "transit", key: "cicd", client: server.Client()}
+}
+
+func TestVault(t *testing.T) {
+	ctx := context.Background()
+	var calls atomic.Int32
+	vault := fakeTransit(t, &calls)
+	vault.legacy = NewAES("0123456789abcdef0123456789abcdef", true)
+
+	sealed, err := vault.Encrypt(ctx, "ghp_token")
+	if err != nil || !strings.HasPrefix(sealed, vaultPrefix) {
+		t.Fatalf("Expected a Transit ciphertext, got '%s' (%v)", sealed, err)
+	}
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		got, err := vault.Decrypt(ctx, sealed)
+		if err != nil || got != "ghp_token" {
+			t.Errorf("Expected 'ghp_token', got '%s' (%v)", got, err)
+		}
+	})
+
+	t.Run("EmptyValuesNotSent", func(t *testing.T) {
+		before := calls.Load()
+		if got, err := vault.Encrypt(ctx, ""); err != nil || got != "" {
+			t.Errorf("Expected an empty ciphertext, got '%s' (%v)", got, err)
+		}
+		if calls.Load() != before {
+			t.Errorf("Expected no call to Vault for an empty value")
+		}
+	})
+
+	t.Run("LegacyValues", func(t *testing.T) {
+		legacy, _ := vault.legacy.Encrypt(ctx, "old_token")
+		got, err := vault.Decrypt(ctx, legacy)
+		if err != nil || got != "old_token" {
+			t.Errorf("Expected the value sealed before Vault to be opened, got '%s' (%v)", got, err)
+		}
+	})
+
+	t.Run("KeyMismatch", func(t *testing.T) {
+		if _, err := vault.Decrypt(ctx, "vault:v2:tampered"); !errors.Is(err, ErrKeyMismatch) {
+			t.Errorf("Expected ErrKeyMismatch, got %v", err)
+		}
+	})
+
+	t.Run("BatchInOneCall", func(t *testing.T) {
+		second, _ := vault.Encrypt(ctx, "ssh_key")
+		legacy, _ := vault.legacy.Encrypt(ctx, "old_token")
+		values := []string{sealed, "", legacy, second}
+		fields := []*string{&values[0], &values[1], &values[2], &values[3]}
+
+		before := calls.Load()
+		if err := DecryptAll(ctx, vault, fields); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if got := calls.Load() - before; got != 1 {
+			t.Errorf("Expected a single call to Vault, got %d", got)
+		}
+		if values[0] != "ghp_token" || values[1] != "" || values[2] != "old_token" || values[3] != "ssh_key" {
+			t.Errorf("Expected the values opened in order, got %q", values)
+		}
+	})
+
+	t.Run("BatchKeyMismatch", func(t *testing.T) {
+		values := []string{sealed, "vault:v2:tampered"}
+		if err := DecryptAll(ctx, vault, []*string{&values[0], &values[1]}); !errors.Is(err, ErrKeyMismatch) {
+			t.Errorf("Expected ErrKeyMismatch, got %v", err)
+		}
+	})
+
+	t.Run("Forbidden", func(t *testing.T) {
+		denied := *vault
+		denied.token = "wrong"
+		if _, err := denied.Encrypt(ctx, "ghp_token"); err == nil || errors.Is(err, ErrKeyMismatch) {
+			t.Errorf("Expected an error other than a key mismatch, got %v", err)
+		}
+	})
+}
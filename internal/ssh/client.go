@@ -3,49 +3,122 @@ package ssh
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"strings"
+	"time"
 
+	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
 )
 
 type Client struct {
 	client *ssh.Client
+	// bastion is the connection to the jump host, nil for a direct connection
+	bastion *ssh.Client
+	// sftp is opened by the first file transfer
+	sftp *sftp.Client
+}
+
+// Endpoint is an SSH server with the credentials to log into it
+type Endpoint struct {
+	Host       string
+	User       string
+	PrivateKey string
 }
 
 // NewClient creates a new SSH connection
 func NewClient(host, user, privateKey string) (*Client, error) {
-	signer, err := ssh.ParsePrivateKey([]byte(privateKey))
+	return Connect(Endpoint{Host: host, User: user, PrivateKey: privateKey}, nil)
+}
+
+// Connect opens an SSH connection to target, through the bastion when it is not nil
+// The connection to the target is tunnelled in the one to the bastion, which only needs to reach it over TCP.
+// Failures are returned as a *ConnectError.
+func Connect(target Endpoint, bastion *Endpoint) (*Client, error) {
+	config, err := clientConfig(target)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse private key: %w", err)
+		return nil, connectError(false, err)
 	}
 
-	config := &ssh.ClientConfig{
-		User: user,
-		Auth: []ssh.AuthMethod{
-			ssh.PublicKeys(signer),
-		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(), // Note: In production, verify host keys
+	if bastion == nil {
+		client, err := ssh.Dial("tcp", address(target.Host), config)
+		if err != nil {
+			return nil, connectError(false, fmt.Errorf("failed to dial ssh: %w", err))
+		}
+		return &Client{client: client}, nil
 	}
 
-	// Handle host:port logic simply
-	addr := host
-	if !strings.Contains(host, ":") {
-		addr = host + ":22"
+	bastionConfig, err := clientConfig(*bastion)
+	if err != nil {
+		return nil, connectError(true, fmt.Errorf("bastion: %w", err))
+	}
+	jump, err := ssh.Dial("tcp", address(bastion.Host), bastionConfig)
+	if err != nil {
+		return nil, connectError(true, fmt.Errorf("failed to dial ssh bastion: %w", err))
 	}
 
-	client, err := ssh.Dial("tcp", addr, config)
+	addr := address(target.Host)
+	conn, err := jump.Dial("tcp", addr)
+	if err != nil {
+		jump.Close()
+		// The bastion reports the failure of its own dial, which is not a *net.OpError here
+		return nil, &ConnectError{Reason: FailureUnreachable, Err: fmt.Errorf("failed to reach %s through the bastion: %w", addr, err)}
+	}
+	clientConn, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
 	if err != nil {
-		return nil, fmt.Errorf("failed to dial ssh: %w", err)
+		conn.Close()
+		jump.Close()
+		return nil, connectError(false, fmt.Errorf("failed to dial ssh: %w", err))
 	}
 
-	return &Client{client: client}, nil
+	return &Client{client: ssh.NewClient(clientConn, chans, reqs), bastion: jump}, nil
+}
+
+// connectTimeout bounds the TCP connection and handshake with each server
+const connectTimeout = 30 * time.Second
+
+// clientConfig returns the configuration authenticating with the private key of an endpoint
+func clientConfig(e Endpoint) (*ssh.ClientConfig, error) {
+	signer, err := ssh.ParsePrivateKey([]byte(e.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidKey, err)
+	}
+	hostKeys, err := hostKeyCallback()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load known hosts: %w", err)
+	}
+
+	return &ssh.ClientConfig{
+		User: e.User,
+		Auth: []ssh.AuthMethod{
+			ssh.PublicKeys(signer),
+		},
+		HostKeyCallback: hostKeys,
+		Timeout:         connectTimeout,
+	}, nil
+}
+
+// address adds the default SSH port to a host without one
+func address(host string) string {
+	// Handle host:port logic simply
+	if !strings.Contains(host, ":") {
+		return host + ":22"
+	}
+	return host
 }
 
 // Close closes the connection
 func (c *Client) Close() error {
-	return c.client.Close()
+	if c.sftp != nil {
+		c.sftp.Close()
+	}
+	err := c.client.Close()
+	if c.bastion != nil {
+		c.bastion.Close()
+	}
+	return err
 }
 
 // RunCommand executes a command on the remote server
@@ -69,17 +142,26 @@ func (c *Client) RunCommand(cmd string) (string, error) {
 	return output, nil
 }
 
-// CopyFile sends a file content to a remote path (using simple cat redirection)
-func (c *Client) CopyFile(localContent []byte, remotePath string) error {
+// Exec runs a command on the remote server, copying its output to stdout and stderr, and returns its exit status
+// The error is only set when the command could not run to completion, e.g. when the connection broke.
+func (c *Client) Exec(cmd string, stdout, stderr io.Writer) (int, error) {
 	session, err := c.client.NewSession()
 	if err != nil {
-		return err
+		return -1, fmt.Errorf("failed to create session: %w", err)
 	}
 	defer session.Close()
 
-	session.Stdin = bytes.NewReader(localContent)
-	// Write stdin to file on remote
-	return session.Run(fmt.Sprintf("cat > %s", remotePath))
+	session.Stdout = stdout
+	session.Stderr = stderr
+	err = session.Run(cmd)
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitStatus(), nil
+	}
+	if err != nil {
+		return -1, fmt.Errorf("remote command failed: %w", err)
+	}
+	return 0, nil
 }
 
 // RunCommandStream executes a command on the remote server and streams the output line by line
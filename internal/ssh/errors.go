@@ -0,0 +1,71 @@
+package ssh
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Reasons of a failed connection, see ConnectError
+const (
+	FailureInvalidKey      = "invalid_key"
+	FailureUnreachable     = "unreachable"
+	FailureAuth            = "auth_failed"
+	FailureHostKeyMismatch = "host_key_mismatch"
+	FailureUnknownHostKey  = "unknown_host_key"
+	FailureOther           = "error"
+)
+
+// errInvalidKey marks private keys that cannot be parsed
+var errInvalidKey = errors.New("invalid private key")
+
+// ConnectError is returned by Connect, telling which server of the chain failed and why
+type ConnectError struct {
+	// Bastion is set when the bastion failed rather than the target
+	Bastion bool
+	// Reason is one of the Failure values
+	Reason string
+	Err    error
+}
+
+func (e *ConnectError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConnectError) Unwrap() error {
+	return e.Err
+}
+
+// connectError classifies an error of a connection attempt
+func connectError(bastion bool, err error) *ConnectError {
+	var keyErr *knownhosts.KeyError
+	var netErr *net.OpError
+	reason := FailureOther
+	switch {
+	case errors.Is(err, errInvalidKey):
+		reason = FailureInvalidKey
+	case errors.As(err, &keyErr) && len(keyErr.Want) > 0:
+		reason = FailureHostKeyMismatch
+	case errors.As(err, &keyErr):
+		reason = FailureUnknownHostKey
+	case errors.As(err, &netErr), errors.Is(err, os.ErrDeadlineExceeded):
+		reason = FailureUnreachable
+	case strings.Contains(err.Error(), "unable to authenticate"):
+		// The ssh package has no error type for rejected credentials
+		reason = FailureAuth
+	}
+	return &ConnectError{Bastion: bastion, Reason: reason, Err: err}
+}
+
+// hostKeyCallback verifies host keys against the SSH_KNOWN_HOSTS file, accepting any key without it
+func hostKeyCallback() (ssh.HostKeyCallback, error) {
+	path := os.Getenv("SSH_KNOWN_HOSTS")
+	if path == "" {
+		return ssh.InsecureIgnoreHostKey(), nil // Note: In production, verify host keys
+	}
+	return knownhosts.New(path)
+}
@@ -0,0 +1,48 @@
+package ssh
+
+import (
+	"fmt"
+	"io"
+	"net"
+)
+
+// ForwardUnix forwards a loopback TCP port to a unix socket of the remote host, returning its address
+// Every accepted connection opens a channel to the socket, until the returned listener is closed.
+func (c *Client) ForwardUnix(socketPath string) (string, io.Closer, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to listen for forwarding: %w", err)
+	}
+
+	go func() {
+		for {
+			local, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go c.forward(local, socketPath)
+		}
+	}()
+	return listener.Addr().String(), listener, nil
+}
+
+// forward copies a local connection to and from a new connection to the remote socket
+func (c *Client) forward(local net.Conn, socketPath string) {
+	defer local.Close()
+	remote, err := c.client.Dial("unix", socketPath)
+	if err != nil {
+		return
+	}
+	defer remote.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(remote, local)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(local, remote)
+		done <- struct{}{}
+	}()
+	<-done
+}
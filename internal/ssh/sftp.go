@@ -0,0 +1,105 @@
+package ssh
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/pkg/sftp"
+)
+
+// sftpClient returns the SFTP session of the connection, opening it on first use
+func (c *Client) sftpClient() (*sftp.Client, error) {
+	if c.sftp != nil {
+		return c.sftp, nil
+	}
+	client, err := sftp.NewClient(c.client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start sftp: %w", err)
+	}
+	c.sftp = client
+	return client, nil
+}
+
+// CopyFile sends a file content to a remote path, readable by everyone
+func (c *Client) CopyFile(localContent []byte, remotePath string) error {
+	return c.WriteFile(remotePath, bytes.NewReader(localContent), 0644)
+}
+
+// WriteFile streams r to a remote file with the given permissions, creating its parent directories
+// The permissions are applied before any content is written, so secrets are never readable by others.
+func (c *Client) WriteFile(remotePath string, r io.Reader, mode fs.FileMode) error {
+	client, err := c.sftpClient()
+	if err != nil {
+		return err
+	}
+	if err := client.MkdirAll(path.Dir(remotePath)); err != nil {
+		return fmt.Errorf("failed to create remote directory of %s: %w", remotePath, err)
+	}
+
+	f, err := client.OpenFile(remotePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return fmt.Errorf("failed to open remote file %s: %w", remotePath, err)
+	}
+	defer f.Close()
+	if err := f.Chmod(mode.Perm()); err != nil {
+		return fmt.Errorf("failed to set permissions of %s: %w", remotePath, err)
+	}
+	if _, err := f.ReadFrom(r); err != nil {
+		return fmt.Errorf("failed to write remote file %s: %w", remotePath, err)
+	}
+	return f.Close()
+}
+
+// UploadFile copies a local file to a remote path, keeping its permissions
+func (c *Client) UploadFile(localPath, remotePath string) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return c.WriteFile(remotePath, f, info.Mode())
+}
+
+// UploadDir copies a local directory tree to a remote directory, keeping the permissions
+// Symbolic links and other special files are skipped.
+func (c *Client) UploadDir(localDir, remoteDir string) error {
+	client, err := c.sftpClient()
+	if err != nil {
+		return err
+	}
+	return filepath.WalkDir(localDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(localDir, p)
+		if err != nil {
+			return err
+		}
+		remotePath := path.Join(remoteDir, filepath.ToSlash(rel))
+
+		switch {
+		case d.IsDir():
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			if err := client.MkdirAll(remotePath); err != nil {
+				return fmt.Errorf("failed to create remote directory %s: %w", remotePath, err)
+			}
+			return client.Chmod(remotePath, info.Mode().Perm())
+		case d.Type().IsRegular():
+			return c.UploadFile(p, remotePath)
+		default:
+			return nil
+		}
+	})
+}
@@ -0,0 +1,2034 @@
+// Package memstore is an in-memory store.Store for tests
+// It mirrors the semantics of the database package (defaults, error messages, secret masking)
+// without encryption, so handlers and executors can be exercised without a database.
+package memstore
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/events"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/store"
+)
+
+var _ store.Store = (*Store)(nil)
+
+type membership struct {
+	role     string
+	joinedAt time.Time
+}
+
+type user struct {
+	models.User
+	passwordHash string
+	oauthToken   string
+}
+
+type passwordReset struct {
+	userID    int
+	expiresAt time.Time
+	used      bool
+}
+
+type runner struct {
+	models.Runner
+	tokenHash string
+}
+
+type apiToken struct {
+	models.APIToken
+	tokenHash string
+}
+
+type artifact struct {
+	models.Artifact
+	content []byte
+}
+
+type idempotencyKey struct {
+	pipelineID int
+	createdAt  time.Time
+}
+
+// Store keeps every record in maps guarded by a single mutex
+type Store struct {
+	mu     sync.Mutex
+	nextID int
+	events *events.Bus
+
+	users               map[int]*user
+	passwordResets      map[string]*passwordReset
+	emailVerifications  map[string]*passwordReset
+	projects            map[int]*models.Project
+	badgeTokens         map[int]string
+	projectMembers      map[int]map[int]*membership
+	organizations       map[int]*models.Organization
+	organizationMembers map[int]map[int]*membership
+	teams               map[int]*models.Team
+	teamMembers         map[int]map[int]*membership
+	pipelines           map[int]*models.Pipeline
+	jobs                map[int]*models.Job
+	logs                map[int][]models.LogLine
+	vulnerabilities     map[int][]models.Vulnerability
+	artifacts           map[int]*artifact
+	deployments         map[int]*models.Deployment
+	deploymentLogs      map[int][]models.DeploymentLog
+	variables           map[int][]*models.Variable
+	environments        map[int][]*models.Environment
+	environmentVersions map[int]*models.EnvironmentVersion
+	previews            map[int]*models.Preview
+	runners             map[int]*runner
+	webhooks            map[int]*models.Webhook
+	apiTokens           map[int]*apiToken
+	deliveries          map[int]*models.WebhookDelivery
+	idempotencyKeys     map[string]*idempotencyKey
+	templates           map[int]*models.ProjectTemplate
+
+	// Err, when set, is returned by Ping
+	Err error
+}
+
+// New creates an empty store
+func New() *Store {
+	return &Store{
+		users:               make(map[int]*user),
+		passwordResets:      make(map[string]*passwordReset),
+		emailVerifications:  make(map[string]*passwordReset),
+		projects:            make(map[int]*models.Project),
+		badgeTokens:         make(map[int]string),
+		projectMembers:      make(map[int]map[int]*membership),
+		organizations:       make(map[int]*models.Organization),
+		organizationMembers: make(map[int]map[int]*membership),
+		teams:               make(map[int]*models.Team),
+		teamMembers:         make(map[int]map[int]*membership),
+		pipelines:           make(map[int]*models.Pipeline),
+		jobs:                make(map[int]*models.Job),
+		logs:                make(map[int][]models.LogLine),
+		vulnerabilities:     make(map[int][]models.Vulnerability),
+		artifacts:           make(map[int]*artifact),
+		deployments:         make(map[int]*models.Deployment),
+		deploymentLogs:      make(map[int][]models.DeploymentLog),
+		variables:           make(map[int][]*models.Variable),
+		environments:        make(map[int][]*models.Environment),
+		environmentVersions: make(map[int]*models.EnvironmentVersion),
+		previews:            make(map[int]*models.Preview),
+		runners:             make(map[int]*runner),
+		webhooks:            make(map[int]*models.Webhook),
+		apiTokens:           make(map[int]*apiToken),
+		deliveries:          make(map[int]*models.WebhookDelivery),
+		idempotencyKeys:     make(map[string]*idempotencyKey),
+		templates:           make(map[int]*models.ProjectTemplate),
+	}
+}
+
+// SetEventBus registers the bus notified of every pipeline, job and deployment status change
+func (s *Store) SetEventBus(bus *events.Bus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = bus
+}
+
+// publish sends an event on the bus if one is registered
+func (s *Store) publish(event events.Event) {
+	if s.events != nil {
+		s.events.Publish(event)
+	}
+}
+
+// id returns the next identifier, shared by every record kind
+func (s *Store) id() int {
+	s.nextID++
+	return s.nextID
+}
+
+// Ping checks that the store is reachable
+func (s *Store) Ping(ctx context.Context) error {
+	return s.Err
+}
+
+// ============== User Operations ==============
+
+func (s *Store) CreateUser(ctx context.Context, u *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u.EmailVerified = true
+	if existing := s.userByEmail(u.Email); existing != nil {
+		if !existing.EmailVerified {
+			existing.passwordHash = ""
+		}
+		existing.Name, existing.AvatarURL, existing.Provider, existing.ProviderID = u.Name, u.AvatarURL, u.Provider, u.ProviderID
+		existing.EmailVerified = true
+		u.ID, u.CreatedAt = existing.ID, existing.CreatedAt
+		return nil
+	}
+	u.ID, u.CreatedAt = s.id(), time.Now()
+	s.users[u.ID] = &user{User: *u}
+	return nil
+}
+
+// userByEmail finds a user by email, nil when there is none
+func (s *Store) userByEmail(email string) *user {
+	for _, u := range s.users {
+		if u.Email == email {
+			return u
+		}
+	}
+	return nil
+}
+
+func (s *Store) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.userByEmail(email)
+	if u == nil {
+		return nil, fmt.Errorf("user not found")
+	}
+	c := u.User
+	return &c, nil
+}
+
+func (s *Store) GetUserByID(ctx context.Context, id int) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[id]
+	if !ok {
+		return nil, fmt.Errorf("user not found")
+	}
+	c := u.User
+	return &c, nil
+}
+
+func (s *Store) CreateLocalUser(ctx context.Context, u *models.User, passwordHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.userByEmail(u.Email) != nil {
+		return store.ErrEmailTaken
+	}
+	u.ID, u.CreatedAt = s.id(), time.Now()
+	u.AvatarURL, u.Provider, u.ProviderID, u.EmailVerified = "", "local", "", false
+	s.users[u.ID] = &user{User: *u, passwordHash: passwordHash}
+	return nil
+}
+
+func (s *Store) GetUserPasswordHash(ctx context.Context, email string) (*models.User, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.userByEmail(email)
+	if u == nil {
+		return nil, "", fmt.Errorf("user not found")
+	}
+	c := u.User
+	return &c, u.passwordHash, nil
+}
+
+func (s *Store) SetUserPassword(ctx context.Context, userID int, passwordHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u, ok := s.users[userID]; ok {
+		u.passwordHash = passwordHash
+	}
+	return nil
+}
+
+func (s *Store) SetUserOAuthToken(ctx context.Context, userID int, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u, ok := s.users[userID]; ok {
+		u.oauthToken = token
+	}
+	return nil
+}
+
+func (s *Store) GetUserOAuthToken(ctx context.Context, userID int) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[userID]
+	if !ok {
+		return "", fmt.Errorf("failed to get oauth token: user not found")
+	}
+	return u.oauthToken, nil
+}
+
+func (s *Store) CreatePasswordReset(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.passwordResets[tokenHash] = &passwordReset{userID: userID, expiresAt: expiresAt}
+	return nil
+}
+
+func (s *Store) ConsumePasswordReset(ctx context.Context, tokenHash string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	reset, ok := s.passwordResets[tokenHash]
+	if !ok || reset.used || !reset.expiresAt.After(time.Now()) {
+		return 0, fmt.Errorf("password reset not found")
+	}
+	reset.used = true
+	return reset.userID, nil
+}
+
+func (s *Store) CreateEmailVerification(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.emailVerifications[tokenHash] = &passwordReset{userID: userID, expiresAt: expiresAt}
+	return nil
+}
+
+func (s *Store) ConsumeEmailVerification(ctx context.Context, tokenHash string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	verification, ok := s.emailVerifications[tokenHash]
+	if !ok || verification.used || !verification.expiresAt.After(time.Now()) {
+		return 0, fmt.Errorf("email verification not found")
+	}
+	verification.used = true
+	return verification.userID, nil
+}
+
+func (s *Store) SetEmailVerified(ctx context.Context, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u, ok := s.users[userID]; ok {
+		u.EmailVerified = true
+	}
+	return nil
+}
+
+// ============== Project Operations ==============
+
+// setProjectFields copies the writable fields of a project, applying the defaults of the database
+func setProjectFields(p *models.Project, project *models.NewProject, defaultPipelineFilename string) {
+	if project.PipelineFilename == "" {
+		project.PipelineFilename = defaultPipelineFilename
+	}
+	if project.DeploymentFilename == "" {
+		project.DeploymentFilename = "docker-compose.yml"
+	}
+	if project.SlackEvents == "" {
+		project.SlackEvents = "failed"
+	}
+	if project.DeploymentMethod == "" {
+		project.DeploymentMethod = models.DeploymentMethodScript
+	}
+	if project.JobExecutor == "" {
+		project.JobExecutor = models.JobExecutorDocker
+	}
+	if project.RetentionAction == "" {
+		project.RetentionAction = models.RetentionActionDelete
+	}
+	p.Name, p.RepoURL, p.AccessToken = project.Name, project.RepoURL, project.AccessToken
+	p.PipelineFilename, p.DeploymentFilename = project.PipelineFilename, project.DeploymentFilename
+	p.DeploymentFiles = slices.Clone(project.DeploymentFiles)
+	p.SSHHost, p.SSHUser, p.SSHPrivateKey = project.SSHHost, project.SSHUser, project.SSHPrivateKey
+	p.SSHBastionHost, p.SSHBastionUser, p.SSHBastionPrivateKey = project.SSHBastionHost, project.SSHBastionUser, project.SSHBastionPrivateKey
+	p.RegistryUser, p.RegistryToken, p.RegistryURL = project.RegistryUser, project.RegistryToken, project.RegistryURL
+	p.DeploymentMethod = project.DeploymentMethod
+	p.BuildPlatforms = slices.Clone(project.BuildPlatforms)
+	p.ImageTags = slices.Clone(project.ImageTags)
+	p.JobExecutor = project.JobExecutor
+	p.BranchFilters = slices.Clone(project.BranchFilters)
+	p.MaxConcurrentPipelines, p.AutoCancelRedundant, p.AllowPrivileged = project.MaxConcurrentPipelines, project.AutoCancelRedundant, project.AllowPrivileged
+	p.PipelineTimeoutSeconds = project.PipelineTimeoutSeconds
+	p.RetentionDays, p.RetentionAction = project.RetentionDays, project.RetentionAction
+	p.SlackWebhookURL, p.SlackEvents = project.SlackWebhookURL, project.SlackEvents
+	p.GitHubInstallationID = project.GitHubInstallationID
+}
+
+// copyProject returns a copy of a stored project, without its variables
+func copyProject(p *models.Project) *models.Project {
+	c := *p
+	c.BranchFilters = slices.Clone(p.BranchFilters)
+	c.DeploymentFiles = slices.Clone(p.DeploymentFiles)
+	c.BuildPlatforms = slices.Clone(p.BuildPlatforms)
+	c.ImageTags = slices.Clone(p.ImageTags)
+	if p.OrganizationID != nil {
+		id := *p.OrganizationID
+		c.OrganizationID = &id
+	}
+	return &c
+}
+
+// listProjects returns the projects matching keep, newest first
+func (s *Store) listProjects(keep func(*models.Project) bool) []models.Project {
+	var projects []models.Project
+	for _, p := range s.projects {
+		if keep(p) {
+			projects = append(projects, *copyProject(p))
+		}
+	}
+	sort.Slice(projects, func(i, j int) bool { return projects[i].ID > projects[j].ID })
+	return projects
+}
+
+func (s *Store) CreateProject(ctx context.Context, project *models.NewProject) (*models.Project, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := &models.Project{ID: s.id(), OwnerID: project.OwnerID, CreatedAt: time.Now()}
+	setProjectFields(p, project, "pipeline.yml")
+	s.projects[p.ID] = p
+	return copyProject(p), nil
+}
+
+func (s *Store) GetProject(ctx context.Context, id int) (*models.Project, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.projects[id]
+	if !ok {
+		return nil, fmt.Errorf("project not found")
+	}
+	project := copyProject(p)
+	for _, v := range s.variables[id] {
+		variable := *v
+		// Mask secrets
+		if variable.IsSecret {
+			variable.Value = "*****"
+		}
+		project.Variables = append(project.Variables, variable)
+	}
+	return project, nil
+}
+
+func (s *Store) GetAllProjects(ctx context.Context) ([]models.Project, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.listProjects(func(*models.Project) bool { return true }), nil
+}
+
+func (s *Store) GetProjectsForUser(ctx context.Context, userID int) ([]models.Project, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.listProjects(func(p *models.Project) bool {
+		if p.OwnerID == userID || s.projectMembers[p.ID][userID] != nil {
+			return true
+		}
+		return p.OrganizationID != nil && s.organizationRole(*p.OrganizationID, userID) != ""
+	}), nil
+}
+
+func (s *Store) FindProjectByUrl(ctx context.Context, url string) (*models.Project, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.projects {
+		if p.RepoURL == url {
+			return copyProject(p), nil
+		}
+	}
+	return nil, fmt.Errorf("project not found")
+}
+
+func (s *Store) UpdateProject(ctx context.Context, id int, project *models.NewProject) (*models.Project, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.projects[id]
+	if !ok {
+		return nil, fmt.Errorf("failed to update project: project not found")
+	}
+	setProjectFields(p, project, ".gitlab-ci.yml")
+	return copyProject(p), nil
+}
+
+func (s *Store) DeleteProject(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.projects[id]; !ok {
+		return fmt.Errorf("project not found")
+	}
+	delete(s.projects, id)
+	delete(s.badgeTokens, id)
+	delete(s.projectMembers, id)
+	delete(s.variables, id)
+	for _, env := range s.environments[id] {
+		delete(s.environmentVersions, env.ID)
+	}
+	delete(s.environments, id)
+	for previewID, p := range s.previews {
+		if p.ProjectID == id {
+			delete(s.previews, previewID)
+		}
+	}
+	for webhookID, w := range s.webhooks {
+		if w.ProjectID == id {
+			delete(s.webhooks, webhookID)
+		}
+	}
+	for pipelineID, p := range s.pipelines {
+		if p.ProjectID == id {
+			s.deletePipeline(pipelineID)
+		}
+	}
+	return nil
+}
+
+// deletePipeline removes a pipeline with its jobs, logs and deployment
+func (s *Store) deletePipeline(id int) {
+	delete(s.pipelines, id)
+	delete(s.deploymentLogs, id)
+	for jobID, j := range s.jobs {
+		if j.PipelineID == id {
+			delete(s.jobs, jobID)
+			delete(s.logs, jobID)
+			delete(s.vulnerabilities, jobID)
+		}
+	}
+	for deploymentID, d := range s.deployments {
+		if d.PipelineID == id {
+			delete(s.deployments, deploymentID)
+		}
+	}
+	for artifactID, a := range s.artifacts {
+		if a.PipelineID == id {
+			delete(s.artifacts, artifactID)
+		}
+	}
+}
+
+func (s *Store) SetProjectOrganization(ctx context.Context, projectID int, organizationID *int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.projects[projectID]
+	if !ok {
+		return fmt.Errorf("project not found")
+	}
+	p.OrganizationID = nil
+	if organizationID != nil {
+		id := *organizationID
+		p.OrganizationID = &id
+	}
+	return nil
+}
+
+func (s *Store) SetProjectDeployKey(ctx context.Context, projectID int, privateKey, publicKey string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.projects[projectID]
+	if !ok {
+		return fmt.Errorf("project not found")
+	}
+	p.DeployKey = privateKey
+	p.DeployKeyPublic = publicKey
+	return nil
+}
+
+func (s *Store) GetProjectBadgeToken(ctx context.Context, projectID int) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.projects[projectID]; !ok {
+		return "", fmt.Errorf("project not found")
+	}
+	return s.badgeTokens[projectID], nil
+}
+
+func (s *Store) SetProjectBadgeToken(ctx context.Context, projectID int, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.projects[projectID]; !ok {
+		return fmt.Errorf("project not found")
+	}
+	if token == "" {
+		delete(s.badgeTokens, projectID)
+	} else {
+		s.badgeTokens[projectID] = token
+	}
+	return nil
+}
+
+func (s *Store) TransferProjectOwnership(ctx context.Context, projectID, newOwnerID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.projects[projectID]
+	if !ok {
+		return fmt.Errorf("project not found")
+	}
+	previousOwnerID := p.OwnerID
+	p.OwnerID = newOwnerID
+	delete(s.projectMembers[projectID], newOwnerID)
+	s.addMember(s.projectMembers, projectID, previousOwnerID, "maintainer")
+	return nil
+}
+
+func (s *Store) GetProjectsByOrganization(ctx context.Context, organizationID int) ([]models.Project, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.listProjects(func(p *models.Project) bool {
+		return p.OrganizationID != nil && *p.OrganizationID == organizationID
+	}), nil
+}
+
+// ============== Member Operations ==============
+
+// addMember adds a member to a project, organization or team, or changes their role
+func (s *Store) addMember(members map[int]map[int]*membership, groupID, userID int, role string) {
+	if members[groupID] == nil {
+		members[groupID] = make(map[int]*membership)
+	}
+	if m, ok := members[groupID][userID]; ok {
+		m.role = role
+		return
+	}
+	members[groupID][userID] = &membership{role: role, joinedAt: time.Now()}
+}
+
+// memberUsers returns the user IDs of the members of a group who have an account, most recent first
+func (s *Store) memberUsers(members map[int]*membership) []int {
+	var userIDs []int
+	for userID := range members {
+		if _, ok := s.users[userID]; ok {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	sort.Slice(userIDs, func(i, j int) bool {
+		a, b := members[userIDs[i]].joinedAt, members[userIDs[j]].joinedAt
+		if a.Equal(b) {
+			return userIDs[i] > userIDs[j]
+		}
+		return a.After(b)
+	})
+	return userIDs
+}
+
+// memberUser returns the public fields of a member, as selected by the database
+func (s *Store) memberUser(userID int) *models.User {
+	u := s.users[userID]
+	return &models.User{ID: u.ID, Email: u.Email, Name: u.Name, AvatarURL: u.AvatarURL}
+}
+
+func (s *Store) GetProjectMemberRole(ctx context.Context, projectID, userID int) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if m, ok := s.projectMembers[projectID][userID]; ok {
+		return m.role, nil
+	}
+	return "", nil
+}
+
+func (s *Store) AddProjectMember(ctx context.Context, projectID, userID int, role string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.projects[projectID]; !ok {
+		return fmt.Errorf("failed to add project member: project not found")
+	}
+	if _, ok := s.users[userID]; !ok {
+		return fmt.Errorf("failed to add project member: user not found")
+	}
+	s.addMember(s.projectMembers, projectID, userID, role)
+	return nil
+}
+
+func (s *Store) GetProjectMembers(ctx context.Context, projectID int) ([]models.ProjectMember, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var members []models.ProjectMember
+	for _, userID := range s.memberUsers(s.projectMembers[projectID]) {
+		m := s.projectMembers[projectID][userID]
+		members = append(members, models.ProjectMember{ProjectID: projectID, UserID: userID, Role: m.role, JoinedAt: m.joinedAt, User: s.memberUser(userID)})
+	}
+	return members, nil
+}
+
+func (s *Store) RemoveProjectMember(ctx context.Context, projectID, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.projectMembers[projectID], userID)
+	return nil
+}
+
+// ============== Organization Operations ==============
+
+func (s *Store) CreateOrganization(ctx context.Context, name string, ownerID int) (*models.Organization, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o := &models.Organization{ID: s.id(), Name: name, OwnerID: ownerID, CreatedAt: time.Now()}
+	s.organizations[o.ID] = o
+	s.addMember(s.organizationMembers, o.ID, ownerID, "owner")
+	c := *o
+	c.Role = "owner"
+	return &c, nil
+}
+
+func (s *Store) GetOrganization(ctx context.Context, id int) (*models.Organization, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.organizations[id]
+	if !ok {
+		return nil, fmt.Errorf("organization not found")
+	}
+	c := *o
+	return &c, nil
+}
+
+func (s *Store) GetOrganizationsForUser(ctx context.Context, userID int) ([]models.Organization, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var organizations []models.Organization
+	for id, o := range s.organizations {
+		if role := s.organizationRole(id, userID); role != "" {
+			c := *o
+			c.Role = role
+			organizations = append(organizations, c)
+		}
+	}
+	sort.Slice(organizations, func(i, j int) bool { return organizations[i].Name < organizations[j].Name })
+	return organizations, nil
+}
+
+func (s *Store) UpdateOrganization(ctx context.Context, id int, name string) (*models.Organization, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.organizations[id]
+	if !ok {
+		return nil, fmt.Errorf("organization not found")
+	}
+	o.Name = name
+	c := *o
+	return &c, nil
+}
+
+func (s *Store) DeleteOrganization(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.organizations[id]; !ok {
+		return fmt.Errorf("organization not found")
+	}
+	delete(s.organizations, id)
+	delete(s.organizationMembers, id)
+	for teamID, t := range s.teams {
+		if t.OrganizationID == id {
+			delete(s.teams, teamID)
+			delete(s.teamMembers, teamID)
+		}
+	}
+	// Its projects and templates become personal ones of their owners
+	for _, p := range s.projects {
+		if p.OrganizationID != nil && *p.OrganizationID == id {
+			p.OrganizationID = nil
+		}
+	}
+	for _, t := range s.templates {
+		if t.OrganizationID != nil && *t.OrganizationID == id {
+			t.OrganizationID = nil
+		}
+	}
+	return nil
+}
+
+func (s *Store) GetOrganizationMemberRole(ctx context.Context, organizationID, userID int) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.organizationRole(organizationID, userID), nil
+}
+
+// roleRanks orders the member roles, as the database does
+var roleRanks = map[string]int{"viewer": 1, "developer": 2, "maintainer": 3, "owner": 4}
+
+// organizationRole returns the highest role of a user in an organization, its own or one of its teams, empty for none
+func (s *Store) organizationRole(organizationID, userID int) string {
+	var role string
+	if m, ok := s.organizationMembers[organizationID][userID]; ok {
+		role = m.role
+	}
+	for teamID, t := range s.teams {
+		if _, ok := s.teamMembers[teamID][userID]; ok && t.OrganizationID == organizationID && roleRanks[t.Role] > roleRanks[role] {
+			role = t.Role
+		}
+	}
+	return role
+}
+
+func (s *Store) AddOrganizationMember(ctx context.Context, organizationID, userID int, role string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.organizations[organizationID]; !ok {
+		return fmt.Errorf("failed to add organization member: organization not found")
+	}
+	if _, ok := s.users[userID]; !ok {
+		return fmt.Errorf("failed to add organization member: user not found")
+	}
+	s.addMember(s.organizationMembers, organizationID, userID, role)
+	return nil
+}
+
+func (s *Store) GetOrganizationMembers(ctx context.Context, organizationID int) ([]models.OrganizationMember, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var members []models.OrganizationMember
+	for _, userID := range s.memberUsers(s.organizationMembers[organizationID]) {
+		m := s.organizationMembers[organizationID][userID]
+		members = append(members, models.OrganizationMember{OrganizationID: organizationID, UserID: userID, Role: m.role, JoinedAt: m.joinedAt, User: s.memberUser(userID)})
+	}
+	return members, nil
+}
+
+func (s *Store) RemoveOrganizationMember(ctx context.Context, organizationID, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.organizationMembers[organizationID], userID)
+	return nil
+}
+
+func (s *Store) CreateTeam(ctx context.Context, organizationID int, name, role string) (*models.Team, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.organizations[organizationID]; !ok {
+		return nil, fmt.Errorf("failed to create team: organization not found")
+	}
+	for _, t := range s.teams {
+		if t.OrganizationID == organizationID && t.Name == name {
+			return nil, fmt.Errorf("team already exists")
+		}
+	}
+	t := &models.Team{ID: s.id(), OrganizationID: organizationID, Name: name, Role: role, CreatedAt: time.Now()}
+	s.teams[t.ID] = t
+	c := *t
+	return &c, nil
+}
+
+func (s *Store) GetTeam(ctx context.Context, id int) (*models.Team, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.teams[id]
+	if !ok {
+		return nil, fmt.Errorf("team not found")
+	}
+	c := *t
+	return &c, nil
+}
+
+func (s *Store) GetTeamsByOrganization(ctx context.Context, organizationID int) ([]models.Team, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var teams []models.Team
+	for _, t := range s.teams {
+		if t.OrganizationID == organizationID {
+			teams = append(teams, *t)
+		}
+	}
+	sort.Slice(teams, func(i, j int) bool { return teams[i].Name < teams[j].Name })
+	return teams, nil
+}
+
+func (s *Store) UpdateTeam(ctx context.Context, id int, name, role string) (*models.Team, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.teams[id]
+	if !ok {
+		return nil, fmt.Errorf("team not found")
+	}
+	t.Name, t.Role = name, role
+	c := *t
+	return &c, nil
+}
+
+func (s *Store) DeleteTeam(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.teams[id]; !ok {
+		return fmt.Errorf("team not found")
+	}
+	delete(s.teams, id)
+	delete(s.teamMembers, id)
+	return nil
+}
+
+func (s *Store) AddTeamMember(ctx context.Context, teamID, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.teams[teamID]; !ok {
+		return fmt.Errorf("failed to add team member: team not found")
+	}
+	if _, ok := s.users[userID]; !ok {
+		return fmt.Errorf("failed to add team member: user not found")
+	}
+	if _, ok := s.teamMembers[teamID][userID]; !ok {
+		s.addMember(s.teamMembers, teamID, userID, "")
+	}
+	return nil
+}
+
+func (s *Store) GetTeamMembers(ctx context.Context, teamID int) ([]models.TeamMember, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var members []models.TeamMember
+	for _, userID := range s.memberUsers(s.teamMembers[teamID]) {
+		members = append(members, models.TeamMember{TeamID: teamID, UserID: userID, JoinedAt: s.teamMembers[teamID][userID].joinedAt, User: s.memberUser(userID)})
+	}
+	return members, nil
+}
+
+func (s *Store) RemoveTeamMember(ctx context.Context, teamID, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.teamMembers[teamID], userID)
+	return nil
+}
+
+// ============== Pipeline Operations ==============
+
+// isFinalStatus reports whether a pipeline status sets its finish time
+func isFinalStatus(status string) bool {
+	return status == "success" || status == "failed" || status == "cancelled" || status == "skipped"
+}
+
+// listPipelines returns copies of the pipelines matching keep, by ascending ID
+func (s *Store) listPipelines(keep func(*models.Pipeline) bool) []models.Pipeline {
+	var pipelines []models.Pipeline
+	for _, p := range s.pipelines {
+		if keep(p) {
+			pipelines = append(pipelines, *p)
+		}
+	}
+	sort.Slice(pipelines, func(i, j int) bool { return pipelines[i].ID < pipelines[j].ID })
+	return pipelines
+}
+
+// filterPipelines returns the pipelines of a project matching a filter, ignoring pagination
+func (s *Store) filterPipelines(projectID int, filter models.PipelineFilter) []models.Pipeline {
+	return s.listPipelines(func(p *models.Pipeline) bool {
+		return p.ProjectID == projectID &&
+			(filter.Status == "" || p.Status == filter.Status) &&
+			(filter.Branch == "" || p.Branch == filter.Branch)
+	})
+}
+
+// lastPipeline returns the pipeline with the highest ID among pipelines, nil when empty
+func lastPipeline(pipelines []models.Pipeline) *models.Pipeline {
+	if len(pipelines) == 0 {
+		return nil
+	}
+	return &pipelines[len(pipelines)-1]
+}
+
+func (s *Store) CreatePipeline(ctx context.Context, projectID int, branch, commitHash string) (*models.Pipeline, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.projects[projectID]; !ok {
+		return nil, fmt.Errorf("failed to create pipeline: project not found")
+	}
+	p := &models.Pipeline{ID: s.id(), ProjectID: projectID, Status: "pending", Branch: branch, CommitHash: commitHash, CreatedAt: time.Now()}
+	s.pipelines[p.ID] = p
+	c := *p
+	return &c, nil
+}
+
+func (s *Store) GetPipeline(ctx context.Context, id int) (*models.Pipeline, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.pipelines[id]
+	if !ok {
+		return nil, fmt.Errorf("pipeline not found")
+	}
+	c := *p
+	return &c, nil
+}
+
+func (s *Store) GetPipelinesByProject(ctx context.Context, projectID int, filter models.PipelineFilter) ([]models.Pipeline, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pipelines := s.filterPipelines(projectID, filter)
+	slices.Reverse(pipelines)
+	if filter.Offset > 0 {
+		pipelines = pipelines[min(filter.Offset, len(pipelines)):]
+	}
+	if filter.Limit > 0 {
+		pipelines = pipelines[:min(filter.Limit, len(pipelines))]
+	}
+	if len(pipelines) == 0 {
+		return nil, nil
+	}
+	return pipelines, nil
+}
+
+func (s *Store) CountPipelinesByProject(ctx context.Context, projectID int, filter models.PipelineFilter) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.filterPipelines(projectID, filter)), nil
+}
+
+func (s *Store) GetLastSuccessfulPipeline(ctx context.Context, projectID int) (*models.Pipeline, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return lastPipeline(s.listPipelines(func(p *models.Pipeline) bool {
+		return p.ProjectID == projectID && p.Status == "success"
+	})), nil
+}
+
+func (s *Store) GetLatestFinishedPipeline(ctx context.Context, projectID int, branch string) (*models.Pipeline, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return lastPipeline(s.listPipelines(func(p *models.Pipeline) bool {
+		return p.ProjectID == projectID && (branch == "" || p.Branch == branch) && (p.Status == "success" || p.Status == "failed")
+	})), nil
+}
+
+// isActiveStatus reports whether a pipeline is still waiting or running
+func isActiveStatus(status string) bool {
+	return status == "pending" || status == "queued" || status == "running"
+}
+
+func (s *Store) GetActivePipelinesByBranch(ctx context.Context, projectID int, branch string) ([]models.Pipeline, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.listPipelines(func(p *models.Pipeline) bool {
+		return p.ProjectID == projectID && p.Branch == branch && (isActiveStatus(p.Status) || p.Status == "manual")
+	}), nil
+}
+
+func (s *Store) GetUnfinishedPipelines(ctx context.Context) ([]models.Pipeline, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.listPipelines(func(p *models.Pipeline) bool { return isActiveStatus(p.Status) }), nil
+}
+
+func (s *Store) UpdatePipelineStatus(ctx context.Context, id int, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.pipelines[id]
+	if !ok {
+		return fmt.Errorf("failed to update pipeline status: pipeline not found")
+	}
+	p.Status = status
+	now := time.Now()
+	if isFinalStatus(status) {
+		p.FinishedAt = &now
+	} else {
+		p.FailureReason = ""
+	}
+	if status == "running" {
+		p.StartedAt = &now
+	}
+	s.publish(events.Event{Type: events.TypePipeline, ID: id, ProjectID: p.ProjectID, PipelineID: id, Status: status})
+	return nil
+}
+
+func (s *Store) FailPipeline(ctx context.Context, id int, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.pipelines[id]
+	if !ok {
+		return fmt.Errorf("failed to fail pipeline: pipeline not found")
+	}
+	now := time.Now()
+	p.Status, p.FailureReason, p.FinishedAt = "failed", reason, &now
+	s.publish(events.Event{Type: events.TypePipeline, ID: id, ProjectID: p.ProjectID, PipelineID: id, Status: "failed"})
+	return nil
+}
+
+func (s *Store) SetPipelineTrigger(ctx context.Context, id int, tag, defaultBranch string, changedFiles []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.pipelines[id]
+	if !ok {
+		return fmt.Errorf("pipeline not found")
+	}
+	p.Tag, p.DefaultBranch, p.ChangedFiles = tag, defaultBranch, slices.Clone(changedFiles)
+	return nil
+}
+
+func (s *Store) PrunePipelines(ctx context.Context, projectID int, before time.Time, action string, dryRun bool) (*models.RetentionResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := &models.RetentionResult{Action: action, DryRun: dryRun, Before: before}
+
+	retained := make(map[int]bool)
+	latest := make(map[string]int)
+	for _, p := range s.pipelines {
+		if p.ProjectID == projectID && p.Status == "success" && p.ID > latest[p.Branch] {
+			latest[p.Branch] = p.ID
+		}
+	}
+	for _, id := range latest {
+		retained[id] = true
+	}
+	for _, env := range s.environments[projectID] {
+		if v, ok := s.environmentVersions[env.ID]; ok {
+			retained[v.PipelineID] = true
+		}
+	}
+	for _, preview := range s.previews {
+		if preview.ProjectID == projectID {
+			retained[preview.PipelineID] = true
+		}
+	}
+
+	for id, p := range s.pipelines {
+		finishedAt := p.CreatedAt
+		if p.FinishedAt != nil {
+			finishedAt = *p.FinishedAt
+		}
+		archive := action == models.RetentionActionArchive
+		if p.ProjectID != projectID || !isFinalStatus(p.Status) || !finishedAt.Before(before) || retained[id] || (archive && p.ArchivedAt != nil) {
+			continue
+		}
+		result.Pipelines++
+		var jobIDs []int
+		for jobID, j := range s.jobs {
+			if j.PipelineID == id {
+				jobIDs = append(jobIDs, jobID)
+			}
+		}
+		result.Jobs += len(jobIDs)
+		for _, d := range s.deployments {
+			if d.PipelineID == id {
+				result.Deployments++
+			}
+		}
+		if dryRun {
+			continue
+		}
+		if !archive {
+			s.deletePipeline(id)
+			continue
+		}
+		for _, jobID := range jobIDs {
+			delete(s.logs, jobID)
+		}
+		for artifactID, a := range s.artifacts {
+			if a.PipelineID == id {
+				delete(s.artifacts, artifactID)
+			}
+		}
+		delete(s.deploymentLogs, id)
+		now := time.Now()
+		p.ArchivedAt = &now
+	}
+	return result, nil
+}
+
+// ============== Job Operations ==============
+
+func (s *Store) CreateJob(ctx context.Context, pipelineID int, name, stage, image string) (*models.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.pipelines[pipelineID]; !ok {
+		return nil, fmt.Errorf("failed to create job: pipeline not found")
+	}
+	j := &models.Job{ID: s.id(), PipelineID: pipelineID, Name: name, Stage: stage, Image: image, Status: "pending"}
+	s.jobs[j.ID] = j
+	c := *j
+	return &c, nil
+}
+
+func (s *Store) GetJob(ctx context.Context, id int) (*models.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[id]
+	if !ok {
+		return nil, fmt.Errorf("job not found")
+	}
+	c := *j
+	return &c, nil
+}
+
+func (s *Store) GetJobByName(ctx context.Context, pipelineID int, name string) (*models.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, j := range s.jobs {
+		if j.PipelineID == pipelineID && j.Name == name {
+			c := *j
+			return &c, nil
+		}
+	}
+	return nil, fmt.Errorf("job not found")
+}
+
+// pipelineJobs returns the jobs of a pipeline by ascending ID
+func (s *Store) pipelineJobs(pipelineID int) []*models.Job {
+	var jobs []*models.Job
+	for _, j := range s.jobs {
+		if j.PipelineID == pipelineID {
+			jobs = append(jobs, j)
+		}
+	}
+	sort.Slice(jobs, func(a, b int) bool { return jobs[a].ID < jobs[b].ID })
+	return jobs
+}
+
+func (s *Store) GetJobsByPipeline(ctx context.Context, pipelineID int) ([]models.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var jobs []models.Job
+	for _, j := range s.pipelineJobs(pipelineID) {
+		jobs = append(jobs, *j)
+	}
+	return jobs, nil
+}
+
+func (s *Store) SetJobUsage(ctx context.Context, id int, usage models.ResourceUsage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[id]
+	if !ok {
+		return fmt.Errorf("failed to set job usage: job not found")
+	}
+	j.Usage = &usage
+	return nil
+}
+
+func (s *Store) UpdateJobStatus(ctx context.Context, id int, status string, exitCode *int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[id]
+	if !ok {
+		return fmt.Errorf("failed to update job status: job not found")
+	}
+	now := time.Now()
+	j.Status = status
+	if status == "running" {
+		j.StartedAt = &now
+	} else if status == "success" || status == "failed" || status == "cancelled" {
+		j.ExitCode = 0
+		if exitCode != nil {
+			j.ExitCode = *exitCode
+		}
+		j.FinishedAt = &now
+	}
+	s.publish(events.Event{Type: events.TypeJob, ID: id, ProjectID: s.pipelines[j.PipelineID].ProjectID, PipelineID: j.PipelineID, Status: status})
+	return nil
+}
+
+func (s *Store) GetSucceededJobNames(ctx context.Context, projectID int, commitHash string) (map[string]bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make(map[string]bool)
+	for _, j := range s.jobs {
+		p := s.pipelines[j.PipelineID]
+		if p.ProjectID == projectID && p.CommitHash == commitHash && j.Status == "success" {
+			names[j.Name] = true
+		}
+	}
+	return names, nil
+}
+
+func (s *Store) CancelUnfinishedJobs(ctx context.Context, pipelineID int) error {
+	return s.finishJobs(pipelineID, []string{"pending", "running", "manual"}, "cancelled")
+}
+
+func (s *Store) FailRunningJobs(ctx context.Context, pipelineID int) error {
+	return s.finishJobs(pipelineID, []string{"running"}, "failed")
+}
+
+// finishJobs moves the jobs of a pipeline in one of the given statuses to a final status
+func (s *Store) finishJobs(pipelineID int, from []string, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for _, j := range s.pipelineJobs(pipelineID) {
+		if slices.Contains(from, j.Status) {
+			j.Status, j.FinishedAt = status, &now
+			s.publish(events.Event{Type: events.TypeJob, ID: j.ID, ProjectID: s.pipelines[pipelineID].ProjectID, PipelineID: pipelineID, Status: status})
+		}
+	}
+	return nil
+}
+
+// ============== Log Operations ==============
+
+func (s *Store) CreateLogBatch(ctx context.Context, jobID int, contents []string) error {
+	now := time.Now()
+	entries := make([]models.LogLine, len(contents))
+	for i, content := range contents {
+		entries[i] = models.LogLine{Content: content, Stream: models.LogStreamSystem, CreatedAt: now}
+	}
+	return s.CreateLogEntries(ctx, jobID, entries)
+}
+
+func (s *Store) CreateLogEntries(ctx context.Context, jobID int, entries []models.LogLine) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(entries) == 0 {
+		return nil
+	}
+	if _, ok := s.jobs[jobID]; !ok {
+		return fmt.Errorf("failed to store log chunk: job not found")
+	}
+	// Line IDs are their position in the job log, as with chunked storage
+	for _, entry := range entries {
+		entry.ID, entry.JobID = len(s.logs[jobID])+1, jobID
+		s.logs[jobID] = append(s.logs[jobID], entry)
+	}
+	return nil
+}
+
+func (s *Store) GetLogsByJob(ctx context.Context, jobID int) ([]models.LogLine, error) {
+	return s.GetLogsAfter(ctx, jobID, 0)
+}
+
+func (s *Store) GetLogsAfter(ctx context.Context, jobID, afterID int) ([]models.LogLine, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	logs := s.logs[jobID]
+	if afterID >= len(logs) {
+		return nil, nil
+	}
+	return slices.Clone(logs[max(afterID, 0):]), nil
+}
+
+// ============== Vulnerability Operations ==============
+
+func (s *Store) CreateVulnerabilities(ctx context.Context, jobID int, vulns []models.Vulnerability) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(vulns) == 0 {
+		return nil
+	}
+	if _, ok := s.jobs[jobID]; !ok {
+		return fmt.Errorf("failed to create vulnerability: job not found")
+	}
+	now := time.Now()
+	for _, v := range vulns {
+		v.ID, v.JobID, v.JobName, v.CreatedAt = s.id(), jobID, "", now
+		s.vulnerabilities[jobID] = append(s.vulnerabilities[jobID], v)
+	}
+	return nil
+}
+
+func (s *Store) GetVulnerabilitiesByPipeline(ctx context.Context, pipelineID int) ([]models.Vulnerability, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var vulns []models.Vulnerability
+	for _, j := range s.pipelineJobs(pipelineID) {
+		for _, v := range s.vulnerabilities[j.ID] {
+			v.JobName = j.Name
+			vulns = append(vulns, v)
+		}
+	}
+	return vulns, nil
+}
+
+// ============== Artifact Operations ==============
+
+func (s *Store) CreateArtifact(ctx context.Context, a *models.Artifact, content []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.pipelines[a.PipelineID]; !ok {
+		return fmt.Errorf("failed to create artifact: pipeline not found")
+	}
+	a.ID, a.Size, a.CreatedAt = s.id(), len(content), time.Now()
+	s.artifacts[a.ID] = &artifact{Artifact: *a, content: slices.Clone(content)}
+	return nil
+}
+
+func (s *Store) GetArtifactsByPipeline(ctx context.Context, pipelineID int) ([]models.Artifact, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var artifacts []models.Artifact
+	for _, a := range s.artifacts {
+		if a.PipelineID == pipelineID {
+			artifacts = append(artifacts, a.Artifact)
+		}
+	}
+	sort.Slice(artifacts, func(i, j int) bool { return artifacts[i].ID < artifacts[j].ID })
+	return artifacts, nil
+}
+
+func (s *Store) GetArtifactContent(ctx context.Context, pipelineID, id int) (*models.Artifact, []byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.artifacts[id]
+	if !ok || a.PipelineID != pipelineID {
+		return nil, nil, fmt.Errorf("artifact not found")
+	}
+	c := a.Artifact
+	return &c, slices.Clone(a.content), nil
+}
+
+// ============== Deployment Operations ==============
+
+func (s *Store) CreateDeployment(ctx context.Context, pipelineID int, environment string) (*models.Deployment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	return s.createDeployment(pipelineID, environment, "deploying", &now)
+}
+
+func (s *Store) CreatePendingDeployment(ctx context.Context, pipelineID int, environment string) (*models.Deployment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, err := s.createDeployment(pipelineID, environment, "pending", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pending deployment: %w", err)
+	}
+	return d, nil
+}
+
+// createDeployment stores the deployment of a pipeline, a pipeline having at most one
+func (s *Store) createDeployment(pipelineID int, environment, status string, startedAt *time.Time) (*models.Deployment, error) {
+	if _, ok := s.pipelines[pipelineID]; !ok {
+		return nil, fmt.Errorf("pipeline not found")
+	}
+	for _, d := range s.deployments {
+		if d.PipelineID == pipelineID {
+			return nil, fmt.Errorf("deployment of pipeline %d already exists", pipelineID)
+		}
+	}
+	d := &models.Deployment{ID: s.id(), PipelineID: pipelineID, Status: status, Environment: environment, StartedAt: startedAt}
+	s.deployments[d.ID] = d
+	c := *d
+	return &c, nil
+}
+
+func (s *Store) UpdateDeploymentStatus(ctx context.Context, id int, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.deployments[id]
+	if !ok {
+		return fmt.Errorf("failed to update deployment status: deployment not found")
+	}
+	now := time.Now()
+	d.Status = status
+	if status == "success" || status == "failed" || status == "rolled_back" || status == "cancelled" || status == "stopped" {
+		d.FinishedAt = &now
+	} else if status == "deploying" {
+		d.StartedAt = &now
+	}
+	s.publish(events.Event{Type: events.TypeDeployment, ID: id, ProjectID: s.pipelines[d.PipelineID].ProjectID, PipelineID: d.PipelineID, Status: status})
+	return nil
+}
+
+func (s *Store) GetDeploymentByPipeline(ctx context.Context, pipelineID int) (*models.Deployment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, d := range s.deployments {
+		if d.PipelineID == pipelineID {
+			c := *d
+			return &c, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *Store) CreateDeploymentLog(ctx context.Context, pipelineID int, content string) (*models.DeploymentLog, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.pipelines[pipelineID]; !ok {
+		return nil, fmt.Errorf("failed to create deployment log: pipeline not found")
+	}
+	l := models.DeploymentLog{ID: s.id(), PipelineID: pipelineID, Content: content, CreatedAt: time.Now()}
+	s.deploymentLogs[pipelineID] = append(s.deploymentLogs[pipelineID], l)
+	return &l, nil
+}
+
+func (s *Store) GetDeploymentLogs(ctx context.Context, pipelineID int) ([]models.DeploymentLog, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.deploymentLogs[pipelineID]), nil
+}
+
+func (s *Store) GetLastDeployedPipeline(ctx context.Context, projectID int, environment string) (*models.Pipeline, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deployed := make(map[int]bool)
+	for _, d := range s.deployments {
+		if d.Status == "success" && d.Environment == environment {
+			deployed[d.PipelineID] = true
+		}
+	}
+	return lastPipeline(s.listPipelines(func(p *models.Pipeline) bool {
+		return p.ProjectID == projectID && deployed[p.ID]
+	})), nil
+}
+
+// ============== Variable Operations ==============
+
+func (s *Store) CreateVariable(ctx context.Context, v *models.Variable) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.projects[v.ProjectID]; !ok {
+		return fmt.Errorf("project not found")
+	}
+	if v.EnvironmentScope == "" {
+		v.EnvironmentScope = models.AllEnvironments
+	}
+	for _, existing := range s.variables[v.ProjectID] {
+		if existing.Key == v.Key && existing.EnvironmentScope == v.EnvironmentScope {
+			return fmt.Errorf("variable %s already exists", v.Key)
+		}
+	}
+	v.ID, v.CreatedAt = s.id(), time.Now()
+	c := *v
+	s.variables[v.ProjectID] = append(s.variables[v.ProjectID], &c)
+	return nil
+}
+
+func (s *Store) GetVariablesByProject(ctx context.Context, projectID int) ([]models.Variable, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var variables []models.Variable
+	for _, v := range s.variables[projectID] {
+		variables = append(variables, *v)
+	}
+	return variables, nil
+}
+
+func (s *Store) UpdateVariable(ctx context.Context, projectID int, key, scope string, value *string, isSecret *bool) (*models.Variable, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, v := range s.variables[projectID] {
+		if v.Key == key && v.EnvironmentScope == scope {
+			if value != nil {
+				v.Value = *value
+			}
+			if isSecret != nil {
+				v.IsSecret = *isSecret
+			}
+			c := *v
+			return &c, nil
+		}
+	}
+	return nil, fmt.Errorf("variable not found")
+}
+
+func (s *Store) DeleteVariable(ctx context.Context, projectID int, key, scope string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.variables[projectID] = slices.DeleteFunc(s.variables[projectID], func(v *models.Variable) bool {
+		return v.Key == key && v.EnvironmentScope == scope
+	})
+	return nil
+}
+
+// ============== Environment Operations ==============
+
+func (s *Store) CreateEnvironment(ctx context.Context, env *models.Environment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.projects[env.ProjectID]; !ok {
+		return fmt.Errorf("failed to create environment: project not found")
+	}
+	if s.findEnvironment(env.ProjectID, env.Name) != nil {
+		return fmt.Errorf("environment already exists")
+	}
+	environmentDefaults(env)
+	env.ID, env.CreatedAt = s.id(), time.Now()
+	s.environments[env.ProjectID] = append(s.environments[env.ProjectID], copyEnvironment(env))
+	return nil
+}
+
+func copyEnvironment(env *models.Environment) *models.Environment {
+	c := *env
+	c.SSHHosts = slices.Clone(env.SSHHosts)
+	c.ProtectedBranches = slices.Clone(env.ProtectedBranches)
+	c.PreDeploy, c.PostDeploy = slices.Clone(env.PreDeploy), slices.Clone(env.PostDeploy)
+	return &c
+}
+
+// environmentDefaults fills the unset settings of an environment like the database does
+func environmentDefaults(env *models.Environment) {
+	if env.DeploymentFilename == "" {
+		env.DeploymentFilename = "docker-compose.yml"
+	}
+	if env.DeploymentStrategy == "" {
+		env.DeploymentStrategy = models.StrategyRecreate
+	}
+	if env.CanaryReplicas == 0 {
+		env.CanaryReplicas = 1
+	}
+	if env.CanaryBakeSeconds == 0 {
+		env.CanaryBakeSeconds = 60
+	}
+	if env.RolloutBatchSize == 0 {
+		env.RolloutBatchSize = 1
+	}
+}
+
+// findEnvironment returns the stored environment of a project, nil if absent
+func (s *Store) findEnvironment(projectID int, name string) *models.Environment {
+	for _, env := range s.environments[projectID] {
+		if env.Name == name {
+			return env
+		}
+	}
+	return nil
+}
+
+func (s *Store) GetEnvironment(ctx context.Context, projectID int, name string) (*models.Environment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	env := s.findEnvironment(projectID, name)
+	if env == nil {
+		return nil, fmt.Errorf("environment not found")
+	}
+	return copyEnvironment(env), nil
+}
+
+func (s *Store) GetEnvironmentsByProject(ctx context.Context, projectID int) ([]models.Environment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var environments []models.Environment
+	for _, env := range s.environments[projectID] {
+		environments = append(environments, *copyEnvironment(env))
+	}
+	sort.Slice(environments, func(i, j int) bool { return environments[i].Name < environments[j].Name })
+	return environments, nil
+}
+
+func (s *Store) UpdateEnvironment(ctx context.Context, env *models.Environment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := s.findEnvironment(env.ProjectID, env.Name)
+	if stored == nil {
+		return fmt.Errorf("environment not found")
+	}
+	environmentDefaults(env)
+	env.ID, env.CreatedAt = stored.ID, stored.CreatedAt
+	*stored = *copyEnvironment(env)
+	return nil
+}
+
+func (s *Store) DeleteEnvironment(ctx context.Context, projectID int, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.findEnvironment(projectID, name) == nil {
+		return fmt.Errorf("environment not found")
+	}
+	env := s.findEnvironment(projectID, name)
+	delete(s.environmentVersions, env.ID)
+	s.environments[projectID] = slices.DeleteFunc(s.environments[projectID], func(env *models.Environment) bool { return env.Name == name })
+	return nil
+}
+
+func (s *Store) SetEnvironmentVersion(ctx context.Context, projectID int, v *models.EnvironmentVersion) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	env := s.findEnvironment(projectID, v.Environment)
+	if env == nil {
+		return fmt.Errorf("environment not found")
+	}
+	v.DeployedAt = time.Now()
+	c := *v
+	c.Images = slices.Clone(v.Images)
+	s.environmentVersions[env.ID] = &c
+	env.StoppedAt = nil
+	return nil
+}
+
+func (s *Store) SetEnvironmentStopped(ctx context.Context, projectID int, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	env := s.findEnvironment(projectID, name)
+	if env == nil {
+		return fmt.Errorf("environment not found")
+	}
+	now := time.Now()
+	env.StoppedAt = &now
+	return nil
+}
+
+func (s *Store) GetEnvironmentVersion(ctx context.Context, projectID int, name string) (*models.EnvironmentVersion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	env := s.findEnvironment(projectID, name)
+	if env == nil {
+		return nil, fmt.Errorf("environment not found")
+	}
+	v, ok := s.environmentVersions[env.ID]
+	if !ok || env.StoppedAt != nil {
+		return nil, nil
+	}
+	c := *v
+	c.Images = slices.Clone(v.Images)
+	return &c, nil
+}
+
+// ============== Preview Operations ==============
+
+func (s *Store) SavePreview(ctx context.Context, p *models.Preview) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	p.DeployedAt, p.CreatedAt = now, now
+	for _, stored := range s.previews {
+		if stored.ProjectID == p.ProjectID && stored.Environment == p.Environment && stored.Branch == p.Branch {
+			p.ID, p.CreatedAt = stored.ID, stored.CreatedAt
+			break
+		}
+	}
+	if p.ID == 0 {
+		p.ID = s.id()
+	}
+	c := *p
+	s.previews[p.ID] = &c
+	return nil
+}
+
+func (s *Store) GetPreview(ctx context.Context, projectID, id int) (*models.Preview, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.previews[id]
+	if !ok || p.ProjectID != projectID {
+		return nil, fmt.Errorf("preview not found")
+	}
+	c := *p
+	return &c, nil
+}
+
+func (s *Store) GetPreviewsByProject(ctx context.Context, projectID int) ([]models.Preview, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var previews []models.Preview
+	for _, p := range s.previews {
+		if p.ProjectID == projectID {
+			previews = append(previews, *p)
+		}
+	}
+	sort.Slice(previews, func(i, j int) bool { return previews[i].DeployedAt.After(previews[j].DeployedAt) })
+	return previews, nil
+}
+
+func (s *Store) GetPreviews(ctx context.Context) ([]models.Preview, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var previews []models.Preview
+	for _, p := range s.previews {
+		previews = append(previews, *p)
+	}
+	sort.Slice(previews, func(i, j int) bool { return previews[i].DeployedAt.Before(previews[j].DeployedAt) })
+	return previews, nil
+}
+
+func (s *Store) DeletePreview(ctx context.Context, projectID, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.previews[id]
+	if !ok || p.ProjectID != projectID {
+		return fmt.Errorf("preview not found")
+	}
+	delete(s.previews, id)
+	return nil
+}
+
+// ============== Runner Operations ==============
+
+func (s *Store) CreateRunner(ctx context.Context, name, tokenHash string) (*models.Runner, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := &runner{Runner: models.Runner{ID: s.id(), Name: name, CreatedAt: time.Now()}, tokenHash: tokenHash}
+	s.runners[r.ID] = r
+	c := r.Runner
+	return &c, nil
+}
+
+func (s *Store) GetRunnerByToken(ctx context.Context, tokenHash string) (*models.Runner, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.runners {
+		if r.tokenHash == tokenHash {
+			now := time.Now()
+			r.LastSeenAt = &now
+			c := r.Runner
+			return &c, nil
+		}
+	}
+	return nil, fmt.Errorf("runner not found")
+}
+
+func (s *Store) GetRunners(ctx context.Context) ([]models.Runner, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var runners []models.Runner
+	for _, r := range s.runners {
+		runners = append(runners, r.Runner)
+	}
+	sort.Slice(runners, func(i, j int) bool { return runners[i].ID < runners[j].ID })
+	return runners, nil
+}
+
+func (s *Store) DeleteRunner(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.runners[id]; !ok {
+		return fmt.Errorf("runner not found")
+	}
+	delete(s.runners, id)
+	return nil
+}
+
+// ============== Webhook Operations ==============
+
+func (s *Store) CreateWebhook(ctx context.Context, w *models.Webhook) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.projects[w.ProjectID]; !ok {
+		return fmt.Errorf("failed to create webhook: project not found")
+	}
+	w.ID, w.CreatedAt = s.id(), time.Now()
+	c := *w
+	c.Events = slices.Clone(w.Events)
+	s.webhooks[w.ID] = &c
+	return nil
+}
+
+func (s *Store) GetWebhooksByProject(ctx context.Context, projectID int) ([]models.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var webhooks []models.Webhook
+	for _, w := range s.webhooks {
+		if w.ProjectID == projectID {
+			c := *w
+			c.Events = append([]string{}, w.Events...)
+			webhooks = append(webhooks, c)
+		}
+	}
+	sort.Slice(webhooks, func(i, j int) bool { return webhooks[i].ID < webhooks[j].ID })
+	return webhooks, nil
+}
+
+func (s *Store) DeleteWebhook(ctx context.Context, projectID, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if w, ok := s.webhooks[id]; !ok || w.ProjectID != projectID {
+		return fmt.Errorf("webhook not found")
+	}
+	delete(s.webhooks, id)
+	return nil
+}
+
+// ============== API Token Operations ==============
+
+// copyAPIToken returns a copy of a stored token
+func copyAPIToken(t *apiToken) *models.APIToken {
+	c := t.APIToken
+	c.Scopes = append([]string{}, t.Scopes...)
+	return &c
+}
+
+func (s *Store) CreateAPIToken(ctx context.Context, t *models.APIToken, tokenHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[t.UserID]; !ok {
+		return fmt.Errorf("failed to create API token: user not found")
+	}
+	t.ID, t.CreatedAt = s.id(), time.Now()
+	token := &apiToken{APIToken: *t, tokenHash: tokenHash}
+	token.Scopes = slices.Clone(t.Scopes)
+	s.apiTokens[t.ID] = token
+	return nil
+}
+
+func (s *Store) GetAPITokenByHash(ctx context.Context, tokenHash string) (*models.APIToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for _, t := range s.apiTokens {
+		if t.tokenHash == tokenHash && (t.ExpiresAt == nil || t.ExpiresAt.After(now)) {
+			t.LastUsedAt = &now
+			return copyAPIToken(t), nil
+		}
+	}
+	return nil, fmt.Errorf("API token not found")
+}
+
+func (s *Store) GetAPITokensByUser(ctx context.Context, userID int) ([]models.APIToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var tokens []models.APIToken
+	for _, t := range s.apiTokens {
+		if t.UserID == userID {
+			tokens = append(tokens, *copyAPIToken(t))
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].ID < tokens[j].ID })
+	return tokens, nil
+}
+
+func (s *Store) DeleteAPIToken(ctx context.Context, userID, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.apiTokens[id]; !ok || t.UserID != userID {
+		return fmt.Errorf("API token not found")
+	}
+	delete(s.apiTokens, id)
+	return nil
+}
+
+// ============== Delivery Operations ==============
+
+// copyWebhookDelivery returns a copy of a stored delivery
+func copyWebhookDelivery(d *models.WebhookDelivery) *models.WebhookDelivery {
+	c := *d
+	c.Headers = maps.Clone(d.Headers)
+	return &c
+}
+
+func (s *Store) CreateWebhookDelivery(ctx context.Context, d *models.WebhookDelivery) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if d.DeliveryID != "" {
+		for _, existing := range s.deliveries {
+			if existing.DeliveryID == d.DeliveryID {
+				if existing.Status != "failed" {
+					return false, nil
+				}
+				d.ID = existing.ID
+			}
+		}
+	}
+	if d.ID == 0 {
+		d.ID = s.id()
+	}
+	d.Status, d.Reason, d.PipelineID, d.ReceivedAt = "received", "", nil, time.Now()
+	s.deliveries[d.ID] = copyWebhookDelivery(d)
+	return true, nil
+}
+
+func (s *Store) FinishWebhookDelivery(ctx context.Context, d *models.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.deliveries[d.ID]; ok {
+		existing.ProjectID, existing.Status, existing.Reason, existing.PipelineID = d.ProjectID, d.Status, d.Reason, d.PipelineID
+	}
+	return nil
+}
+
+func (s *Store) GetWebhookDeliveriesByProject(ctx context.Context, projectID, limit int) ([]models.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var deliveries []models.WebhookDelivery
+	for _, d := range s.deliveries {
+		if d.ProjectID != nil && *d.ProjectID == projectID {
+			c := *d
+			c.Headers, c.Payload = nil, ""
+			deliveries = append(deliveries, c)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].ID > deliveries[j].ID })
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+func (s *Store) GetWebhookDelivery(ctx context.Context, projectID, id int) (*models.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.deliveries[id]
+	if !ok || d.ProjectID == nil || *d.ProjectID != projectID {
+		return nil, fmt.Errorf("webhook delivery not found")
+	}
+	return copyWebhookDelivery(d), nil
+}
+
+func (s *Store) ClaimIdempotencyKey(ctx context.Context, projectID int, key string) (bool, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := fmt.Sprintf("%d/%s", projectID, key)
+	if k, ok := s.idempotencyKeys[id]; ok {
+		return false, k.pipelineID, nil
+	}
+	s.idempotencyKeys[id] = &idempotencyKey{createdAt: time.Now()}
+	return true, 0, nil
+}
+
+func (s *Store) SetIdempotencyKeyPipeline(ctx context.Context, projectID int, key string, pipelineID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if k, ok := s.idempotencyKeys[fmt.Sprintf("%d/%s", projectID, key)]; ok {
+		k.pipelineID = pipelineID
+	}
+	return nil
+}
+
+func (s *Store) ReleaseIdempotencyKey(ctx context.Context, projectID int, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.idempotencyKeys, fmt.Sprintf("%d/%s", projectID, key))
+	return nil
+}
+
+func (s *Store) DeleteDeliveriesBefore(ctx context.Context, before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	removed := 0
+	for id, d := range s.deliveries {
+		if d.ReceivedAt.Before(before) {
+			delete(s.deliveries, id)
+			removed++
+		}
+	}
+	for id, k := range s.idempotencyKeys {
+		if k.createdAt.Before(before) {
+			delete(s.idempotencyKeys, id)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// cloneTemplate copies a template with its variables and environments
+func cloneTemplate(t *models.ProjectTemplate) *models.ProjectTemplate {
+	c := *t
+	c.Variables = slices.Clone(t.Variables)
+	c.Environments = slices.Clone(t.Environments)
+	return &c
+}
+
+func (s *Store) CreateTemplate(ctx context.Context, t *models.ProjectTemplate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t.PipelineFilename == "" {
+		t.PipelineFilename = "pipeline.yml"
+	}
+	t.ID = s.id()
+	t.CreatedAt = time.Now()
+	s.templates[t.ID] = cloneTemplate(t)
+	return nil
+}
+
+func (s *Store) GetTemplate(ctx context.Context, id int) (*models.ProjectTemplate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.templates[id]
+	if !ok {
+		return nil, fmt.Errorf("template not found")
+	}
+	return cloneTemplate(t), nil
+}
+
+func (s *Store) GetTemplatesForUser(ctx context.Context, userID int) ([]models.ProjectTemplate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var templates []models.ProjectTemplate
+	for _, t := range s.templates {
+		if t.OwnerID == userID || (t.OrganizationID != nil && s.organizationRole(*t.OrganizationID, userID) != "") {
+			templates = append(templates, *cloneTemplate(t))
+		}
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		if templates[i].Name != templates[j].Name {
+			return templates[i].Name < templates[j].Name
+		}
+		return templates[i].ID < templates[j].ID
+	})
+	return templates, nil
+}
+
+func (s *Store) UpdateTemplate(ctx context.Context, t *models.ProjectTemplate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.templates[t.ID]
+	if !ok {
+		return fmt.Errorf("template not found")
+	}
+	if t.PipelineFilename == "" {
+		t.PipelineFilename = "pipeline.yml"
+	}
+	c := cloneTemplate(t)
+	c.OwnerID, c.CreatedAt = stored.OwnerID, stored.CreatedAt
+	s.templates[t.ID] = c
+	return nil
+}
+
+func (s *Store) DeleteTemplate(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.templates[id]; !ok {
+		return fmt.Errorf("template not found")
+	}
+	delete(s.templates, id)
+	return nil
+}
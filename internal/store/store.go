@@ -0,0 +1,236 @@
+// Package store defines the persistence interfaces consumed by the API, the executors and the notifiers
+// The database package implements them on PostgreSQL and SQLite, and memstore in memory for tests.
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/models"
+)
+
+// ErrEmailTaken is returned when creating a local account with the email of an existing user
+var ErrEmailTaken = errors.New("email already registered")
+
+// UserStore persists users, their credentials, password resets and email verifications
+type UserStore interface {
+	CreateUser(ctx context.Context, user *models.User) error
+	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
+	GetUserByID(ctx context.Context, id int) (*models.User, error)
+	CreateLocalUser(ctx context.Context, user *models.User, passwordHash string) error
+	GetUserPasswordHash(ctx context.Context, email string) (*models.User, string, error)
+	SetUserPassword(ctx context.Context, userID int, passwordHash string) error
+	SetUserOAuthToken(ctx context.Context, userID int, token string) error
+	GetUserOAuthToken(ctx context.Context, userID int) (string, error)
+	CreatePasswordReset(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error
+	ConsumePasswordReset(ctx context.Context, tokenHash string) (int, error)
+	CreateEmailVerification(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error
+	ConsumeEmailVerification(ctx context.Context, tokenHash string) (int, error)
+	SetEmailVerified(ctx context.Context, userID int) error
+}
+
+// ProjectStore persists projects and their members
+type ProjectStore interface {
+	CreateProject(ctx context.Context, project *models.NewProject) (*models.Project, error)
+	GetProject(ctx context.Context, id int) (*models.Project, error)
+	GetAllProjects(ctx context.Context) ([]models.Project, error)
+	GetProjectsForUser(ctx context.Context, userID int) ([]models.Project, error)
+	FindProjectByUrl(ctx context.Context, url string) (*models.Project, error)
+	UpdateProject(ctx context.Context, id int, project *models.NewProject) (*models.Project, error)
+	DeleteProject(ctx context.Context, id int) error
+	SetProjectOrganization(ctx context.Context, projectID int, organizationID *int) error
+	SetProjectDeployKey(ctx context.Context, projectID int, privateKey, publicKey string) error
+	GetProjectBadgeToken(ctx context.Context, projectID int) (string, error)
+	SetProjectBadgeToken(ctx context.Context, projectID int, token string) error
+	TransferProjectOwnership(ctx context.Context, projectID, newOwnerID int) error
+	GetProjectsByOrganization(ctx context.Context, organizationID int) ([]models.Project, error)
+	GetProjectMemberRole(ctx context.Context, projectID, userID int) (string, error)
+	AddProjectMember(ctx context.Context, projectID, userID int, role string) error
+	GetProjectMembers(ctx context.Context, projectID int) ([]models.ProjectMember, error)
+	RemoveProjectMember(ctx context.Context, projectID, userID int) error
+}
+
+// OrganizationStore persists organizations, their members and teams
+type OrganizationStore interface {
+	CreateOrganization(ctx context.Context, name string, ownerID int) (*models.Organization, error)
+	GetOrganization(ctx context.Context, id int) (*models.Organization, error)
+	GetOrganizationsForUser(ctx context.Context, userID int) ([]models.Organization, error)
+	UpdateOrganization(ctx context.Context, id int, name string) (*models.Organization, error)
+	DeleteOrganization(ctx context.Context, id int) error
+	GetOrganizationMemberRole(ctx context.Context, organizationID, userID int) (string, error)
+	AddOrganizationMember(ctx context.Context, organizationID, userID int, role string) error
+	GetOrganizationMembers(ctx context.Context, organizationID int) ([]models.OrganizationMember, error)
+	RemoveOrganizationMember(ctx context.Context, organizationID, userID int) error
+	CreateTeam(ctx context.Context, organizationID int, name, role string) (*models.Team, error)
+	GetTeam(ctx context.Context, id int) (*models.Team, error)
+	GetTeamsByOrganization(ctx context.Context, organizationID int) ([]models.Team, error)
+	UpdateTeam(ctx context.Context, id int, name, role string) (*models.Team, error)
+	DeleteTeam(ctx context.Context, id int) error
+	AddTeamMember(ctx context.Context, teamID, userID int) error
+	GetTeamMembers(ctx context.Context, teamID int) ([]models.TeamMember, error)
+	RemoveTeamMember(ctx context.Context, teamID, userID int) error
+}
+
+// PipelineStore persists pipelines
+type PipelineStore interface {
+	CreatePipeline(ctx context.Context, projectID int, branch, commitHash string) (*models.Pipeline, error)
+	GetPipeline(ctx context.Context, id int) (*models.Pipeline, error)
+	GetPipelinesByProject(ctx context.Context, projectID int, filter models.PipelineFilter) ([]models.Pipeline, error)
+	CountPipelinesByProject(ctx context.Context, projectID int, filter models.PipelineFilter) (int, error)
+	GetLastSuccessfulPipeline(ctx context.Context, projectID int) (*models.Pipeline, error)
+	GetLatestFinishedPipeline(ctx context.Context, projectID int, branch string) (*models.Pipeline, error)
+	GetActivePipelinesByBranch(ctx context.Context, projectID int, branch string) ([]models.Pipeline, error)
+	GetUnfinishedPipelines(ctx context.Context) ([]models.Pipeline, error)
+	UpdatePipelineStatus(ctx context.Context, id int, status string) error
+	FailPipeline(ctx context.Context, id int, reason string) error
+	// SetPipelineTrigger records the tag, default branch and changed files of the push a pipeline runs for
+	SetPipelineTrigger(ctx context.Context, id int, tag, defaultBranch string, changedFiles []string) error
+	// PrunePipelines deletes or archives, per the RetentionAction, the pipelines of a project finished before a time
+	// The latest successful pipeline of each branch and the deployed ones are kept. A dry run only counts.
+	PrunePipelines(ctx context.Context, projectID int, before time.Time, action string, dryRun bool) (*models.RetentionResult, error)
+}
+
+// JobStore persists the jobs of pipelines
+type JobStore interface {
+	CreateJob(ctx context.Context, pipelineID int, name, stage, image string) (*models.Job, error)
+	GetJob(ctx context.Context, id int) (*models.Job, error)
+	GetJobByName(ctx context.Context, pipelineID int, name string) (*models.Job, error)
+	GetJobsByPipeline(ctx context.Context, pipelineID int) ([]models.Job, error)
+	UpdateJobStatus(ctx context.Context, id int, status string, exitCode *int) error
+	SetJobUsage(ctx context.Context, id int, usage models.ResourceUsage) error
+	GetSucceededJobNames(ctx context.Context, projectID int, commitHash string) (map[string]bool, error)
+	CancelUnfinishedJobs(ctx context.Context, pipelineID int) error
+	FailRunningJobs(ctx context.Context, pipelineID int) error
+}
+
+// LogStore persists the log lines of jobs
+type LogStore interface {
+	CreateLogBatch(ctx context.Context, jobID int, contents []string) error
+	CreateLogEntries(ctx context.Context, jobID int, entries []models.LogLine) error
+	GetLogsByJob(ctx context.Context, jobID int) ([]models.LogLine, error)
+	GetLogsAfter(ctx context.Context, jobID, afterID int) ([]models.LogLine, error)
+}
+
+// VulnerabilityStore persists the findings of security-scan jobs
+type VulnerabilityStore interface {
+	CreateVulnerabilities(ctx context.Context, jobID int, vulns []models.Vulnerability) error
+	GetVulnerabilitiesByPipeline(ctx context.Context, pipelineID int) ([]models.Vulnerability, error)
+}
+
+// ArtifactStore persists the files produced by pipelines
+type ArtifactStore interface {
+	CreateArtifact(ctx context.Context, a *models.Artifact, content []byte) error
+	GetArtifactsByPipeline(ctx context.Context, pipelineID int) ([]models.Artifact, error)
+	GetArtifactContent(ctx context.Context, pipelineID, id int) (*models.Artifact, []byte, error)
+}
+
+// DeploymentStore persists deployments and their logs
+type DeploymentStore interface {
+	CreateDeployment(ctx context.Context, pipelineID int, environment string) (*models.Deployment, error)
+	CreatePendingDeployment(ctx context.Context, pipelineID int, environment string) (*models.Deployment, error)
+	UpdateDeploymentStatus(ctx context.Context, id int, status string) error
+	GetDeploymentByPipeline(ctx context.Context, pipelineID int) (*models.Deployment, error)
+	CreateDeploymentLog(ctx context.Context, pipelineID int, content string) (*models.DeploymentLog, error)
+	GetDeploymentLogs(ctx context.Context, pipelineID int) ([]models.DeploymentLog, error)
+	GetLastDeployedPipeline(ctx context.Context, projectID int, environment string) (*models.Pipeline, error)
+}
+
+// EnvironmentStore persists the deployment environments of projects
+type EnvironmentStore interface {
+	CreateEnvironment(ctx context.Context, env *models.Environment) error
+	GetEnvironment(ctx context.Context, projectID int, name string) (*models.Environment, error)
+	GetEnvironmentsByProject(ctx context.Context, projectID int) ([]models.Environment, error)
+	UpdateEnvironment(ctx context.Context, env *models.Environment) error
+	DeleteEnvironment(ctx context.Context, projectID int, name string) error
+	SetEnvironmentVersion(ctx context.Context, projectID int, v *models.EnvironmentVersion) error
+	GetEnvironmentVersion(ctx context.Context, projectID int, name string) (*models.EnvironmentVersion, error)
+	SetEnvironmentStopped(ctx context.Context, projectID int, name string) error
+	SavePreview(ctx context.Context, p *models.Preview) error
+	GetPreview(ctx context.Context, projectID, id int) (*models.Preview, error)
+	GetPreviewsByProject(ctx context.Context, projectID int) ([]models.Preview, error)
+	GetPreviews(ctx context.Context) ([]models.Preview, error)
+	DeletePreview(ctx context.Context, projectID, id int) error
+}
+
+// VariableStore persists the CI/CD variables of projects
+type VariableStore interface {
+	CreateVariable(ctx context.Context, v *models.Variable) error
+	GetVariablesByProject(ctx context.Context, projectID int) ([]models.Variable, error)
+	UpdateVariable(ctx context.Context, projectID int, key, scope string, value *string, isSecret *bool) (*models.Variable, error)
+	DeleteVariable(ctx context.Context, projectID int, key, scope string) error
+}
+
+// RunnerStore persists the registered runners
+type RunnerStore interface {
+	CreateRunner(ctx context.Context, name, tokenHash string) (*models.Runner, error)
+	GetRunnerByToken(ctx context.Context, tokenHash string) (*models.Runner, error)
+	GetRunners(ctx context.Context) ([]models.Runner, error)
+	DeleteRunner(ctx context.Context, id int) error
+}
+
+// WebhookStore persists the outbound webhooks of projects
+type WebhookStore interface {
+	CreateWebhook(ctx context.Context, w *models.Webhook) error
+	GetWebhooksByProject(ctx context.Context, projectID int) ([]models.Webhook, error)
+	DeleteWebhook(ctx context.Context, projectID, id int) error
+}
+
+// TokenStore persists the personal access tokens of users
+type TokenStore interface {
+	CreateAPIToken(ctx context.Context, t *models.APIToken, tokenHash string) error
+	GetAPITokenByHash(ctx context.Context, tokenHash string) (*models.APIToken, error)
+	GetAPITokensByUser(ctx context.Context, userID int) ([]models.APIToken, error)
+	DeleteAPIToken(ctx context.Context, userID, id int) error
+}
+
+// DeliveryStore logs the webhook deliveries of repository hosts and deduplicates them and the retried manual triggers
+// A failed delivery or released key can be claimed again, so that the retry is processed.
+type DeliveryStore interface {
+	// CreateWebhookDelivery records a received delivery, false when its delivery ID was already received and did not fail
+	CreateWebhookDelivery(ctx context.Context, d *models.WebhookDelivery) (bool, error)
+	// FinishWebhookDelivery records the outcome of a delivery: its project, status, reason and pipeline
+	FinishWebhookDelivery(ctx context.Context, d *models.WebhookDelivery) error
+	// GetWebhookDeliveriesByProject lists the latest deliveries of a project, newest first and without their headers and payload
+	GetWebhookDeliveriesByProject(ctx context.Context, projectID, limit int) ([]models.WebhookDelivery, error)
+	GetWebhookDelivery(ctx context.Context, projectID, id int) (*models.WebhookDelivery, error)
+	// ClaimIdempotencyKey records the key of a manual trigger, or returns the pipeline of an earlier request with the key, 0 while it is in progress
+	ClaimIdempotencyKey(ctx context.Context, projectID int, key string) (claimed bool, pipelineID int, err error)
+	SetIdempotencyKeyPipeline(ctx context.Context, projectID int, key string, pipelineID int) error
+	ReleaseIdempotencyKey(ctx context.Context, projectID int, key string) error
+	// DeleteDeliveriesBefore forgets the deliveries and keys received before a time, returning how many were removed
+	DeleteDeliveriesBefore(ctx context.Context, before time.Time) (int, error)
+}
+
+// TemplateStore persists the templates projects are created from
+type TemplateStore interface {
+	CreateTemplate(ctx context.Context, t *models.ProjectTemplate) error
+	GetTemplate(ctx context.Context, id int) (*models.ProjectTemplate, error)
+	// GetTemplatesForUser lists the templates of a user and of the organizations they belong to
+	GetTemplatesForUser(ctx context.Context, userID int) ([]models.ProjectTemplate, error)
+	UpdateTemplate(ctx context.Context, t *models.ProjectTemplate) error
+	DeleteTemplate(ctx context.Context, id int) error
+}
+
+// Store is the whole persistence layer
+type Store interface {
+	UserStore
+	ProjectStore
+	OrganizationStore
+	PipelineStore
+	JobStore
+	LogStore
+	VulnerabilityStore
+	ArtifactStore
+	DeploymentStore
+	EnvironmentStore
+	VariableStore
+	RunnerStore
+	WebhookStore
+	TokenStore
+	DeliveryStore
+	TemplateStore
+
+	// Ping checks that the store is reachable
+	Ping(ctx context.Context) error
+}
@@ -1,11 +1,18 @@
 package main
 
 import (
+	"context"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/api"
 	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/database"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/logstore"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/internal/secrets"
 	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/logger"
+	"github.com/Soif2Sang/imt-cloud-CI-CD-backend.git/pkg/tracing"
 	"github.com/joho/godotenv"
 )
 
@@ -20,8 +27,22 @@ func main() {
 
 	logger.Info("Démarrage du moteur CI/CD...")
 
+	// Export traces when an OTLP endpoint is configured
+	shutdownTracing, err := tracing.Init(context.Background())
+	if err != nil {
+		logger.Warn("Tracing disabled: " + err.Error())
+		shutdownTracing = func(context.Context) error { return nil }
+	}
+
+	// Project secrets are sealed with ENCRYPTION_KEY or by Vault
+	secretBackend, err := secrets.FromEnv()
+	if err != nil {
+		logger.Error("Failed to configure secrets backend: " + err.Error())
+		os.Exit(1)
+	}
+
 	// Initialize database connection
-	db, err := database.New(os.Getenv("ENCRYPTION_KEY"))
+	db, err := database.New(secretBackend)
 	if err != nil {
 		logger.Warn("Warning: Could not connect to database: " + err.Error())
 		logger.Warn("Running without database persistence...")
@@ -29,6 +50,17 @@ func main() {
 	} else {
 		defer db.Close()
 		logger.Info("Connected to database successfully")
+
+		// Job logs go to object storage when a bucket is configured
+		store, err := logstore.NewS3FromEnv(context.Background())
+		if err != nil {
+			logger.Error("Failed to configure log storage: " + err.Error())
+			os.Exit(1)
+		}
+		if store != nil {
+			db.SetLogStore(store)
+			logger.Info("Storing job logs in bucket " + os.Getenv("LOG_S3_BUCKET"))
+		}
 	}
 
 	// Get port from environment or use default
@@ -48,9 +80,29 @@ func main() {
 	logger.Info("Webhook endpoint: http://localhost:" + port + "/webhook/github")
 	logger.Info("Health check: http://localhost:" + port + "/health")
 
+	// Stop the running pipelines on SIGINT/SIGTERM
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		sigCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		<-sigCtx.Done()
+
+		logger.Info("Shutting down, cancelling running pipelines...")
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			logger.Warn("Shutdown incomplete: " + err.Error())
+		}
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Warn("Failed to flush traces: " + err.Error())
+		}
+	}()
+
 	// Start the server (this blocks)
 	if err := server.Start(); err != nil {
 		logger.Error("Server error: " + err.Error())
 		os.Exit(1)
 	}
+	<-shutdownDone
 }